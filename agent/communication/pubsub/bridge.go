@@ -0,0 +1,358 @@
+// bridge.go - WebSocket and SSE Bridge for Browser Clients
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBridgeHeartbeat = 15 * time.Second
+	defaultBridgeBuffer    = 64
+	bridgeWriteWait        = 10 * time.Second
+)
+
+// ErrSubjectNotBridged is returned for subjects outside the bridge's
+// whitelist
+var ErrSubjectNotBridged = errors.New("subject not exposed by the bridge")
+
+var (
+	bridgeClients = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "Wavine_bridge_clients",
+		Help: "Browser clients connected to the bridge",
+	}, []string{"transport"})
+
+	bridgeDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_bridge_messages_dropped_total",
+		Help: "Messages not forwarded to a browser client, by reason",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(bridgeClients, bridgeDropped)
+}
+
+// BridgeConfig chooses what the bridge exposes and to whom
+type BridgeConfig struct {
+	// Subjects lists the subjects, wildcards allowed, clients may follow,
+	// e.g. "agents.*.*.status" and "tasks.progress.>"
+	Subjects []string
+	// Authenticate identifies the client's tenant from its request; an
+	// error rejects the connection
+	Authenticate func(r *http.Request) (tenantID string, err error)
+	// TenantOf returns the tenant a message belongs to, given the payload
+	// before any CloudEvents envelope is removed. By default the tenant
+	// token of agents.<tenant>.… and tenants.<tenant>.… subjects, else the
+	// payload's tenant_id or CloudEvents tenant extension. Messages
+	// without a tenant are never forwarded.
+	TenantOf func(subject string, data []byte) string
+	// AllowedOrigins lists the origins WebSocket clients may connect
+	// from; empty allows only the bridge's own host
+	AllowedOrigins []string
+	// Heartbeat is how often idle connections are pinged; 15s by default
+	Heartbeat time.Duration
+	// Buffer is how many messages may queue for one client before it is
+	// disconnected as too slow; 64 by default
+	Buffer int
+}
+
+// Bridge forwards whitelisted subjects to authenticated browser clients
+// over WebSocket or server-sent events. Each client only ever receives
+// its own tenant's messages.
+type Bridge struct {
+	en       *EnterpriseNATS
+	cfg      BridgeConfig
+	upgrader websocket.Upgrader
+}
+
+// bridgeFrame is one message as the browser sees it
+type bridgeFrame struct {
+	Subject string          `json:"subject"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// NewBridge returns a bridge over en's connection
+func (en *EnterpriseNATS) NewBridge(cfg BridgeConfig) (*Bridge, error) {
+	if cfg.Authenticate == nil {
+		return nil, fmt.Errorf("bridge needs an authenticator")
+	}
+	if len(cfg.Subjects) == 0 {
+		return nil, fmt.Errorf("bridge needs at least one subject")
+	}
+	if cfg.TenantOf == nil {
+		cfg.TenantOf = messageTenant
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = defaultBridgeHeartbeat
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = defaultBridgeBuffer
+	}
+	b := &Bridge{en: en, cfg: cfg}
+	if len(cfg.AllowedOrigins) > 0 {
+		b.upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			for _, allowed := range cfg.AllowedOrigins {
+				if origin == allowed {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return b, nil
+}
+
+// messageTenant is the default BridgeConfig.TenantOf
+func messageTenant(subject string, data []byte) string {
+	if strings.HasPrefix(subject, agentSubjectPrefix) || strings.HasPrefix(subject, tenantSubjectPrefix) {
+		if tokens := strings.Split(subject, "."); len(tokens) > 2 {
+			return tokens[1]
+		}
+	}
+	var body struct {
+		TenantID string `json:"tenant_id"`
+		// Tenant is the CloudEvents extension attribute
+		Tenant string `json:"tenant"`
+	}
+	if json.Unmarshal(data, &body) != nil {
+		return ""
+	}
+	if body.TenantID != "" {
+		return body.TenantID
+	}
+	return body.Tenant
+}
+
+// bridged reports whether subject, which may hold wildcards, lies wholly
+// within one of the whitelisted subjects
+func (b *Bridge) bridged(subject string) bool {
+	for _, pattern := range b.cfg.Subjects {
+		if subjectWithin(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectWithin reports whether every subject matched by sub is also
+// matched by pattern
+func subjectWithin(pattern, sub string) bool {
+	want := strings.Split(pattern, ".")
+	got := strings.Split(sub, ".")
+	for i, token := range want {
+		if token == ">" {
+			return len(got) > i
+		}
+		if i >= len(got) || got[i] == ">" {
+			return false
+		}
+		if token != "*" && (token != got[i] || got[i] == "*") {
+			return false
+		}
+	}
+	return len(want) == len(got)
+}
+
+// Handler serves the bridge. Clients name subjects in the query:
+//
+//	GET /api/stream?subject=agents.acme.*.status&subject=tasks.progress.>
+//
+// Requests carrying a WebSocket upgrade get JSON frames over the socket;
+// others get a text/event-stream. Either way each message arrives as
+// {"subject": ..., "data": ...}.
+func (b *Bridge) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		tenantID, err := b.cfg.Authenticate(r)
+		if err != nil || tenantID == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		subjects := r.URL.Query()["subject"]
+		if len(subjects) == 0 {
+			http.Error(w, "at least one subject is required", http.StatusBadRequest)
+			return
+		}
+		for _, s := range subjects {
+			if !b.bridged(s) {
+				http.Error(w, fmt.Sprintf("%v: %s", ErrSubjectNotBridged, s), http.StatusForbidden)
+				return
+			}
+		}
+
+		frames := make(chan bridgeFrame, b.cfg.Buffer)
+		slow := make(chan struct{})
+		var closed bool
+		forward := func(msg *nats.Msg) {
+			// the tenant is read before a CloudEvent is unwrapped, so its
+			// tenant extension is seen
+			raw, err := b.en.openPayload(msg.Subject, msg.Header, msg.Data)
+			if err != nil {
+				bridgeDropped.WithLabelValues("payload_error").Inc()
+				return
+			}
+			if b.cfg.TenantOf(msg.Subject, raw) != tenantID {
+				bridgeDropped.WithLabelValues("tenant").Inc()
+				return
+			}
+			data, err := eventData(msg.Header, raw)
+			if err != nil {
+				bridgeDropped.WithLabelValues("payload_error").Inc()
+				return
+			}
+			if !json.Valid(data) {
+				data, _ = json.Marshal(string(data))
+			}
+			select {
+			case frames <- bridgeFrame{Subject: msg.Subject, Data: data}:
+			default:
+				bridgeDropped.WithLabelValues("slow_client").Inc()
+				if !closed {
+					closed = true
+					close(slow)
+				}
+			}
+		}
+
+		// every subject feeds one channel, so forward runs on a single
+		// goroutine and slow is closed at most once
+		var subs []*nats.Subscription
+		defer func() {
+			for _, sub := range subs {
+				_ = sub.Unsubscribe()
+			}
+		}()
+		msgs := make(chan *nats.Msg, b.cfg.Buffer)
+		for _, s := range subjects {
+			sub, err := b.en.conn.ChanSubscribe(s, msgs)
+			if err != nil {
+				http.Error(w, "subscribe failed", http.StatusBadGateway)
+				return
+			}
+			subs = append(subs, sub)
+		}
+		go func() {
+			for {
+				select {
+				case msg := <-msgs:
+					forward(msg)
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}()
+
+		if websocket.IsWebSocketUpgrade(r) {
+			b.serveWebSocket(w, r, tenantID, frames, slow)
+			return
+		}
+		b.serveEvents(w, r, tenantID, frames, slow)
+	}
+}
+
+func (b *Bridge) serveWebSocket(w http.ResponseWriter, r *http.Request, tenantID string, frames <-chan bridgeFrame, slow <-chan struct{}) {
+	conn, err := b.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already answered the request
+		return
+	}
+	defer conn.Close()
+	bridgeClients.WithLabelValues("websocket").Inc()
+	defer bridgeClients.WithLabelValues("websocket").Dec()
+
+	// the read loop notices the browser going away and answers pings
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(b.cfg.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case f := <-frames:
+			_ = conn.SetWriteDeadline(time.Now().Add(bridgeWriteWait))
+			if err := conn.WriteJSON(f); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(bridgeWriteWait)); err != nil {
+				return
+			}
+		case <-slow:
+			b.en.logger.Warn("Disconnecting slow bridge client", zap.String("tenant_id", tenantID))
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "client too slow"),
+				time.Now().Add(bridgeWriteWait))
+			return
+		case <-gone:
+			return
+		case <-b.en.shutdownChan:
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(bridgeWriteWait))
+			return
+		}
+	}
+}
+
+func (b *Bridge) serveEvents(w http.ResponseWriter, r *http.Request, tenantID string, frames <-chan bridgeFrame, slow <-chan struct{}) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	bridgeClients.WithLabelValues("sse").Inc()
+	defer bridgeClients.WithLabelValues("sse").Dec()
+
+	ticker := time.NewTicker(b.cfg.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case f := <-frames:
+			data, err := json.Marshal(f)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-slow:
+			b.en.logger.Warn("Disconnecting slow bridge client", zap.String("tenant_id", tenantID))
+			return
+		case <-r.Context().Done():
+			return
+		case <-b.en.shutdownChan:
+			return
+		}
+	}
+}
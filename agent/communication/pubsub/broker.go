@@ -0,0 +1,44 @@
+// broker.go - Transport-Independent Messaging
+package messaging
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Broker publishes JSON payloads on subjects and delivers them to
+// handlers. A handler error redelivers the message, up to maxDeliver
+// times, after which it goes to the dead-letter queue. EnterpriseNATS and
+// KafkaBroker satisfy it.
+type Broker interface {
+	Publish(ctx context.Context, subject string, payload interface{}) error
+	Subscribe(subject string, handler func([]byte) error) (Subscription, error)
+	Shutdown()
+}
+
+const (
+	BackendNATS  = "nats"
+	BackendKafka = "kafka"
+)
+
+// BrokerConfig selects and configures a backend
+type BrokerConfig struct {
+	// Backend is BackendNATS (the default) or BackendKafka
+	Backend string
+	NATS    Config
+	Kafka   KafkaConfig
+}
+
+// NewBroker connects to the configured backend
+func NewBroker(cfg BrokerConfig, logger *zap.Logger) (Broker, error) {
+	switch cfg.Backend {
+	case "", BackendNATS:
+		return NewEnterpriseNATS(cfg.NATS, logger)
+	case BackendKafka:
+		return NewKafkaBroker(cfg.Kafka, logger)
+	default:
+		return nil, fmt.Errorf("unknown messaging backend %q", cfg.Backend)
+	}
+}
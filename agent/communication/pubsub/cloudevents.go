@@ -0,0 +1,135 @@
+// cloudevents.go - CloudEvents 1.0 Envelope
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// CloudEventsSpecVersion is the CloudEvents version written
+	CloudEventsSpecVersion = "1.0"
+	// cloudEventsContentType marks structured-mode events, as the
+	// CloudEvents NATS binding prescribes
+	cloudEventsContentType = "application/cloudevents+json"
+	hdrContentType         = "Content-Type"
+)
+
+// CloudEventsConfig turns on the CloudEvents envelope for published
+// events
+type CloudEventsConfig struct {
+	// Source identifies this producer, e.g. "/nuzon/agent-controller"
+	Source string
+	// TypePrefix is prepended to the subject to form the event type; by
+	// default "ai.nuzon."
+	TypePrefix string
+}
+
+// CloudEvent is a structured-mode CloudEvents 1.0 event. Tenant, Agent
+// and TraceParent are extension attributes.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+
+	Tenant      string `json:"tenant,omitempty"`
+	Agent       string `json:"agent,omitempty"`
+	TraceParent string `json:"traceparent,omitempty"`
+}
+
+type agentKey struct{}
+
+// WithAgent marks ctx as acting for agentID, recorded in the agent
+// extension of CloudEvents published under it
+func WithAgent(ctx context.Context, agentID string) context.Context {
+	return context.WithValue(ctx, agentKey{}, agentID)
+}
+
+// AgentFromContext returns the agent set by WithAgent, if any
+func AgentFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(agentKey{}).(string)
+	return id
+}
+
+// wrapEvent replaces msg's payload with a CloudEvent carrying it when
+// the envelope is configured. id becomes the event ID; an empty id gets
+// a fresh one.
+func (en *EnterpriseNATS) wrapEvent(ctx context.Context, msg *nats.Msg, id string) error {
+	return wrapCloudEvent(ctx, en.cfg.CloudEvents, msg, id)
+}
+
+// wrapCloudEvent is wrapEvent for any broker configured with ce
+func wrapCloudEvent(ctx context.Context, ce *CloudEventsConfig, msg *nats.Msg, id string) error {
+	if ce == nil {
+		return nil
+	}
+	if id == "" {
+		var err error
+		if id, err = correlationID(); err != nil {
+			return err
+		}
+	}
+	prefix := ce.TypePrefix
+	if prefix == "" {
+		prefix = "ai.nuzon."
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	data, err := json.Marshal(CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              id,
+		Source:          ce.Source,
+		Type:            prefix + msg.Subject,
+		Subject:         msg.Subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            msg.Data,
+		Tenant:          TenantFromContext(ctx),
+		Agent:           AgentFromContext(ctx),
+		TraceParent:     carrier.Get("traceparent"),
+	})
+	if err != nil {
+		return fmt.Errorf("cloudevent encoding failed: %w", err)
+	}
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	msg.Data = data
+	msg.Header.Set(hdrContentType, cloudEventsContentType)
+	return nil
+}
+
+// receivePayload returns what the publisher passed to Publish: decrypted
+// and, for CloudEvents, unwrapped. Subscribers see the same payload
+// whether or not the envelope is on.
+func (en *EnterpriseNATS) receivePayload(msg *nats.Msg) ([]byte, error) {
+	data, err := en.openPayload(msg.Subject, msg.Header, msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	return eventData(msg.Header, data)
+}
+
+// eventData unwraps the data of an opened CloudEvents payload, returning
+// other payloads unchanged
+func eventData(header nats.Header, data []byte) ([]byte, error) {
+	if header.Get(hdrContentType) != cloudEventsContentType {
+		return data, nil
+	}
+	var event CloudEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("malformed cloudevent: %w", err)
+	}
+	return event.Data, nil
+}
@@ -0,0 +1,186 @@
+// consumer.go - Durable Pull Consumers with Work Sharing
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultFetchBatch   = 32
+	defaultFetchWait    = 5 * time.Second
+	defaultConsumerAck  = 30 * time.Second
+	consumerLagInterval = 10 * time.Second
+	consumerRetryWait   = 2 * time.Second
+)
+
+var (
+	consumerLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "Wavine_nats_consumer_pending_messages",
+		Help: "Messages in the stream not yet delivered to a durable consumer",
+	}, []string{"consumer"})
+
+	consumerAckPending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "Wavine_nats_consumer_ack_pending_messages",
+		Help: "Messages delivered to a durable consumer and not yet acknowledged",
+	}, []string{"consumer"})
+
+	consumerRecreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_nats_consumer_recreated_total",
+		Help: "Durable consumers bound again after their stream or consumer changed",
+	}, []string{"consumer"})
+)
+
+func init() {
+	prometheus.MustRegister(consumerLag, consumerAckPending, consumerRecreated)
+}
+
+// ConsumerConfig describes a durable pull consumer
+type ConsumerConfig struct {
+	// Durable names the consumer. Every process consuming under the same
+	// name is one queue group: each message goes to one of them, and
+	// progress survives restarts.
+	Durable string
+	Subject string
+	// Batch is how many messages one fetch asks for; 32 by default
+	Batch int
+	// MaxWait bounds how long a fetch waits for a full batch; 5s by
+	// default
+	MaxWait time.Duration
+	// AckWait is how long a message may be worked on before it is
+	// redelivered; 30s by default
+	AckWait time.Duration
+}
+
+func (c ConsumerConfig) withDefaults() ConsumerConfig {
+	if c.Batch <= 0 {
+		c.Batch = defaultFetchBatch
+	}
+	if c.MaxWait <= 0 {
+		c.MaxWait = defaultFetchWait
+	}
+	if c.AckWait <= 0 {
+		c.AckWait = defaultConsumerAck
+	}
+	return c
+}
+
+// Consume fetches batches from a durable pull consumer and runs handler
+// on each message until ctx ends. Failed messages are redelivered and
+// dead-lettered like Subscribe's. When the stream or the consumer is
+// deleted or recreated, the consumer is bound again and consumption
+// continues.
+func (en *EnterpriseNATS) Consume(ctx context.Context, cfg ConsumerConfig, handler func([]byte) error) error {
+	if cfg.Durable == "" || cfg.Subject == "" {
+		return fmt.Errorf("durable consumer needs a name and a subject")
+	}
+	cfg = cfg.withDefaults()
+	defer consumerLag.DeleteLabelValues(cfg.Durable)
+	defer consumerAckPending.DeleteLabelValues(cfg.Durable)
+
+	for {
+		err := en.consume(ctx, cfg, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		consumerRecreated.WithLabelValues(cfg.Durable).Inc()
+		en.logger.Warn("Durable consumer lost, rebinding",
+			zap.String("consumer", cfg.Durable), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-en.shutdownChan:
+			return nil
+		case <-time.After(consumerRetryWait):
+		}
+	}
+}
+
+// consume runs one binding of the consumer until it breaks
+func (en *EnterpriseNATS) consume(ctx context.Context, cfg ConsumerConfig, handler func([]byte) error) error {
+	stream, err := en.ensureConsumer(cfg)
+	if err != nil {
+		return err
+	}
+	// binding to a consumer created outside the subscription keeps it on
+	// the server for the rest of the group when this one unsubscribes
+	sub, err := en.js.PullSubscribe(cfg.Subject, cfg.Durable, nats.Bind(stream, cfg.Durable), nats.ManualAck())
+	if err != nil {
+		return fmt.Errorf("pull subscribe failed: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	var lastLag time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-en.shutdownChan:
+			return nil
+		default:
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, cfg.MaxWait)
+		msgs, err := sub.Fetch(cfg.Batch, nats.Context(fetchCtx))
+		cancel()
+		switch {
+		case err == nil, errors.Is(err, context.DeadlineExceeded), errors.Is(err, nats.ErrTimeout):
+		case errors.Is(err, nats.ErrConsumerDeleted), errors.Is(err, nats.ErrConsumerNotFound),
+			errors.Is(err, nats.ErrStreamNotFound), errors.Is(err, nats.ErrBadSubscription),
+			errors.Is(err, nats.ErrConnectionClosed):
+			return err
+		default:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			en.logger.Warn("Fetch failed", zap.String("consumer", cfg.Durable), zap.Error(err))
+		}
+		for _, msg := range msgs {
+			en.handle(cfg.Subject, msg, handler)
+		}
+
+		if time.Since(lastLag) >= consumerLagInterval {
+			lastLag = time.Now()
+			info, err := sub.ConsumerInfo()
+			if err != nil {
+				if errors.Is(err, nats.ErrConsumerNotFound) || errors.Is(err, nats.ErrStreamNotFound) {
+					return err
+				}
+				continue
+			}
+			consumerLag.WithLabelValues(cfg.Durable).Set(float64(info.NumPending))
+			consumerAckPending.WithLabelValues(cfg.Durable).Set(float64(info.NumAckPending))
+		}
+	}
+}
+
+// ensureConsumer creates the durable consumer if it does not exist and
+// returns its stream
+func (en *EnterpriseNATS) ensureConsumer(cfg ConsumerConfig) (string, error) {
+	stream, err := en.js.StreamNameBySubject(cfg.Subject)
+	if err != nil {
+		return "", fmt.Errorf("no stream for %s: %w", cfg.Subject, err)
+	}
+	if _, err := en.js.ConsumerInfo(stream, cfg.Durable); err == nil {
+		return stream, nil
+	} else if !errors.Is(err, nats.ErrConsumerNotFound) {
+		return "", fmt.Errorf("consumer lookup failed: %w", err)
+	}
+	_, err = en.js.AddConsumer(stream, &nats.ConsumerConfig{
+		Durable:       cfg.Durable,
+		FilterSubject: cfg.Subject,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       cfg.AckWait,
+		MaxDeliver:    maxDeliver,
+	})
+	if err != nil && !errors.Is(err, nats.ErrConsumerNameAlreadyInUse) {
+		return "", fmt.Errorf("consumer creation failed: %w", err)
+	}
+	return stream, nil
+}
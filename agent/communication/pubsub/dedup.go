@@ -0,0 +1,193 @@
+// dedup.go - Exactly-Once Publishing and Idempotent Handlers
+package messaging
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	dedupBucket     = "DEDUP"
+	defaultDedupTTL = 24 * time.Hour
+	// publishAttemptTimeout bounds each wait for a stream ack, so a caller
+	// without a deadline, such as the outbox relay, cannot hang on one
+	publishAttemptTimeout = 5 * time.Second
+)
+
+var msgDuplicates = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_nats_messages_duplicate_total",
+	Help: "Publishes dropped by stream deduplication and deliveries skipped as already handled",
+}, []string{"subject", "stage"})
+
+func init() {
+	prometheus.MustRegister(msgDuplicates)
+}
+
+// PublishOnce publishes payload with id as its Nats-Msg-Id and waits for
+// the stream to store it. id must identify the business event, e.g.
+// "task:<task id>", so that retrying PublishOnce with the same id after
+// a timeout or reconnect is dropped by the stream instead of stored
+// twice. Deduplication holds for the stream's Duplicates window, two
+// minutes unless the stream configures another. Transient failures are
+// retried until ctx ends; a subject no stream captures fails at once.
+func (en *EnterpriseNATS) PublishOnce(ctx context.Context, subject, id string, payload interface{}) error {
+	if id == "" {
+		return fmt.Errorf("exactly-once publish needs a message ID")
+	}
+	if err := authorizePublish(en.confine(ctx), subject); err != nil {
+		return err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+	if err := en.validatePayload(ctx, subject, data); err != nil {
+		msgFailed.WithLabelValues(subject, "schema_violation").Inc()
+		return err
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set(nats.MsgIdHdr, id)
+	if err := en.wrapEvent(ctx, msg, id); err != nil {
+		return err
+	}
+	if err := en.sealMsg(msg); err != nil {
+		msgFailed.WithLabelValues(subject, "encrypt_error").Inc()
+		return err
+	}
+
+	msgPublished.WithLabelValues(subject).Inc()
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, publishAttemptTimeout)
+		ack, err := en.js.PublishMsg(msg, nats.Context(attemptCtx))
+		cancel()
+		if err == nil {
+			if ack.Duplicate {
+				msgDuplicates.WithLabelValues(subject, "publish").Inc()
+			} else {
+				msgDelivered.WithLabelValues(subject).Inc()
+			}
+			return nil
+		}
+		if !retryablePublish(err) || ctx.Err() != nil {
+			msgFailed.WithLabelValues(subject, "publish_error").Inc()
+			return fmt.Errorf("publish failed: %w", err)
+		}
+		en.logger.Warn("Publish not acknowledged, retrying with the same ID",
+			zap.String("subject", subject), zap.String("id", id), zap.Int("attempt", attempt), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			msgFailed.WithLabelValues(subject, "publish_error").Inc()
+			return fmt.Errorf("publish failed: %w", ctx.Err())
+		case <-time.After(time.Duration(attempt) * 250 * time.Millisecond):
+		}
+	}
+}
+
+// retryablePublish reports whether a publish may have failed only
+// because the connection or the stream leader was briefly unavailable.
+// ErrNoResponders is permanent: no stream captures the subject, and
+// retrying would spin until the caller's context ends.
+func retryablePublish(err error) bool {
+	return errors.Is(err, nats.ErrTimeout) || errors.Is(err, nats.ErrNoStreamResponse) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// DedupStore remembers which messages a handler has already applied.
+// Handlers wrapped with Idempotent consult it, so a redelivery after a
+// lost ack does not apply a message twice.
+type DedupStore interface {
+	Seen(ctx context.Context, key string) (bool, error)
+	Mark(ctx context.Context, key string) error
+}
+
+// Idempotent wraps handler so messages whose key was already handled are
+// acknowledged without running it again. key extracts the business ID
+// from a payload, the same ID the publisher passed to PublishOnce. The
+// key is marked only after handler succeeds, so handler must still
+// tolerate the rare concurrent redelivery of a message it is working on;
+// Idempotent removes the common case of redelivery after completion.
+func Idempotent(store DedupStore, subject string, key func(data []byte) (string, error), handler func([]byte) error) func([]byte) error {
+	return func(data []byte) error {
+		k, err := key(data)
+		if err != nil {
+			return fmt.Errorf("dedup key: %w", err)
+		}
+		ctx := context.Background()
+		seen, err := store.Seen(ctx, k)
+		if err != nil {
+			// failing redelivers the message later rather than risking a
+			// second application now
+			return fmt.Errorf("dedup lookup failed: %w", err)
+		}
+		if seen {
+			msgDuplicates.WithLabelValues(subject, "handle").Inc()
+			return nil
+		}
+		if err := handler(data); err != nil {
+			return err
+		}
+		if err := store.Mark(ctx, k); err != nil {
+			return fmt.Errorf("dedup mark failed: %w", err)
+		}
+		return nil
+	}
+}
+
+// kvDedupStore keeps handled keys in a JetStream key-value bucket whose
+// entries expire after the bucket TTL
+type kvDedupStore struct {
+	kv nats.KeyValue
+}
+
+// DedupStore returns a store backed by the DEDUP key-value bucket,
+// creating it with ttl (one day when zero) on first use. Keys must
+// outlive every redelivery, so ttl should exceed the longest a message
+// can stay unacknowledged.
+func (en *EnterpriseNATS) DedupStore(ttl time.Duration) (DedupStore, error) {
+	if ttl <= 0 {
+		ttl = defaultDedupTTL
+	}
+	kv, err := en.js.KeyValue(dedupBucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = en.js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:  dedupBucket,
+			TTL:     ttl,
+			Storage: nats.FileStorage,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dedup bucket unavailable: %w", err)
+	}
+	return &kvDedupStore{kv: kv}, nil
+}
+
+// dedupKey encodes business IDs, which may hold characters KV keys cannot
+func dedupKey(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func (s *kvDedupStore) Seen(ctx context.Context, key string) (bool, error) {
+	_, err := s.kv.Get(dedupKey(key))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *kvDedupStore) Mark(ctx context.Context, key string) error {
+	_, err := s.kv.Put(dedupKey(key), []byte(time.Now().UTC().Format(time.RFC3339)))
+	return err
+}
@@ -0,0 +1,334 @@
+// dlq.go - Dead-Letter Queues with Inspection and Redrive
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// deadLetterStream holds every dead letter under dlq.<subject>
+	deadLetterStream        = "DLQ"
+	deadLetterSubjectPrefix = "dlq."
+	defaultDeadLetterMaxAge = 14 * 24 * time.Hour
+
+	// headers recording why a message was dead-lettered
+	hdrDeadSubject    = "Dlq-Subject"
+	hdrDeadError      = "Dlq-Error"
+	hdrDeadDeliveries = "Dlq-Deliveries"
+	hdrDeadStreamSeq  = "Dlq-Stream-Seq"
+	hdrDeadConsumer   = "Dlq-Consumer"
+
+	maxDeadLetterList = 1000
+)
+
+// ErrDeadLetterNotFound is returned for a sequence not in the DLQ
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+var deadLetters = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_nats_dead_letters_total",
+	Help: "Messages moved to or redriven from the dead-letter queue",
+}, []string{"subject", "action"})
+
+func init() {
+	prometheus.MustRegister(deadLetters)
+}
+
+// DeadLetter is a message whose handler failed on every delivery
+type DeadLetter struct {
+	// Seq identifies the dead letter in the DLQ stream
+	Seq uint64 `json:"seq"`
+	// Subject is where the message was originally published
+	Subject    string          `json:"subject"`
+	Data       json.RawMessage `json:"data"`
+	Error      string          `json:"error"`
+	Deliveries int             `json:"deliveries"`
+	// StreamSeq is the message's sequence in its original stream
+	StreamSeq uint64    `json:"stream_seq"`
+	Consumer  string    `json:"consumer,omitempty"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// DeadLetterSubject is where dead letters of subject are kept
+func DeadLetterSubject(subject string) string {
+	return deadLetterSubjectPrefix + subject
+}
+
+func (en *EnterpriseNATS) ensureDeadLetterStream() error {
+	if _, err := en.js.StreamInfo(deadLetterStream); err == nil {
+		return nil
+	} else if !errors.Is(err, nats.ErrStreamNotFound) {
+		return fmt.Errorf("dead-letter stream lookup failed: %w", err)
+	}
+	maxAge := en.cfg.DeadLetterMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultDeadLetterMaxAge
+	}
+	_, err := en.js.AddStream(&nats.StreamConfig{
+		Name:      deadLetterStream,
+		Subjects:  []string{deadLetterSubjectPrefix + ">"},
+		Retention: nats.LimitsPolicy,
+		Storage:   nats.FileStorage,
+		MaxAge:    maxAge,
+	})
+	if err != nil {
+		return fmt.Errorf("dead-letter stream creation failed: %w", err)
+	}
+	return nil
+}
+
+// deadLetter moves a message that failed its last delivery to the DLQ
+// and terminates it. If the DLQ cannot take it the message is left to
+// expire from its stream, as before.
+func (en *EnterpriseNATS) deadLetter(msg *nats.Msg, meta *nats.MsgMetadata, cause error) {
+	dead := nats.NewMsg(DeadLetterSubject(msg.Subject))
+	dead.Data = msg.Data
+	dead.Header.Set(hdrDeadSubject, msg.Subject)
+	dead.Header.Set(hdrDeadError, cause.Error())
+	dead.Header.Set(hdrDeadDeliveries, strconv.FormatUint(meta.NumDelivered, 10))
+	dead.Header.Set(hdrDeadStreamSeq, strconv.FormatUint(meta.Sequence.Stream, 10))
+	dead.Header.Set(hdrDeadConsumer, meta.Consumer)
+	// encrypted payloads stay sealed under their original subject's key,
+	// and CloudEvents keep their content type
+	for _, h := range []string{hdrEncAlg, hdrEncKeyID, hdrContentType} {
+		if v := msg.Header.Get(h); v != "" {
+			dead.Header.Set(h, v)
+		}
+	}
+
+	if _, err := en.js.PublishMsg(dead); err != nil {
+		msgFailed.WithLabelValues(msg.Subject, "dead_letter_error").Inc()
+		en.logger.Error("Dead letter not stored",
+			zap.String("subject", msg.Subject), zap.Error(err))
+		_ = msg.Nak()
+		return
+	}
+	deadLetters.WithLabelValues(msg.Subject, "stored").Inc()
+	en.logger.Warn("Message dead-lettered",
+		zap.String("subject", msg.Subject),
+		zap.Uint64("deliveries", meta.NumDelivered),
+		zap.Error(cause))
+	_ = msg.Term()
+}
+
+// DeadLetters lists up to limit dead letters of subject, which may use
+// wildcards, oldest first and starting after seq
+func (en *EnterpriseNATS) DeadLetters(ctx context.Context, subject string, afterSeq uint64, limit int) ([]DeadLetter, error) {
+	if limit <= 0 || limit > maxDeadLetterList {
+		limit = maxDeadLetterList
+	}
+	start := nats.DeliverAll()
+	if afterSeq > 0 {
+		start = nats.StartSequence(afterSeq + 1)
+	}
+	sub, err := en.js.SubscribeSync(DeadLetterSubject(subject),
+		nats.BindStream(deadLetterStream), nats.OrderedConsumer(), start)
+	if err != nil {
+		return nil, fmt.Errorf("dead-letter listing failed: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	letters := []DeadLetter{}
+	for len(letters) < limit {
+		// an empty DLQ delivers nothing, so wait only briefly
+		waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+		msg, err := sub.NextMsgWithContext(waitCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			break
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			return nil, fmt.Errorf("dead-letter metadata unreadable: %w", err)
+		}
+		letters = append(letters, en.newDeadLetter(meta.Sequence.Stream, msg.Header, msg.Data, meta.Timestamp))
+		if meta.NumPending == 0 {
+			break
+		}
+	}
+	return letters, nil
+}
+
+// DeadLetter returns one dead letter by its DLQ sequence
+func (en *EnterpriseNATS) DeadLetter(ctx context.Context, seq uint64) (DeadLetter, error) {
+	raw, err := en.js.GetMsg(deadLetterStream, seq, nats.Context(ctx))
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return DeadLetter{}, fmt.Errorf("%w: %d", ErrDeadLetterNotFound, seq)
+	}
+	if err != nil {
+		return DeadLetter{}, fmt.Errorf("dead-letter lookup failed: %w", err)
+	}
+	return en.newDeadLetter(raw.Sequence, raw.Header, raw.Data, raw.Time), nil
+}
+
+// Redrive publishes a dead letter again on its original subject and
+// removes it from the DLQ. A non-nil payload replaces the original, e.g.
+// to fix the field that made every delivery fail.
+func (en *EnterpriseNATS) Redrive(ctx context.Context, seq uint64, payload json.RawMessage) error {
+	raw, err := en.js.GetMsg(deadLetterStream, seq, nats.Context(ctx))
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return fmt.Errorf("%w: %d", ErrDeadLetterNotFound, seq)
+	}
+	if err != nil {
+		return fmt.Errorf("dead-letter lookup failed: %w", err)
+	}
+	msg := nats.NewMsg(raw.Header.Get(hdrDeadSubject))
+	subject := msg.Subject
+	if payload != nil {
+		// a replacement goes through the checks Publish applies, under the
+		// tenant and agent of the event it replaces
+		if err := en.validatePayload(ctx, subject, payload); err != nil {
+			msgFailed.WithLabelValues(subject, "schema_violation").Inc()
+			return err
+		}
+		msg.Data = payload
+		if err := en.wrapEvent(en.eventContext(ctx, subject, raw.Header, raw.Data), msg, ""); err != nil {
+			return err
+		}
+		if err := en.sealMsg(msg); err != nil {
+			return err
+		}
+	} else {
+		msg.Data = raw.Data
+		for _, h := range []string{hdrEncAlg, hdrEncKeyID, hdrContentType} {
+			if v := raw.Header.Get(h); v != "" {
+				msg.Header.Set(h, v)
+			}
+		}
+	}
+	if _, err := en.js.PublishMsg(msg, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("redrive publish failed: %w", err)
+	}
+	msgPublished.WithLabelValues(subject).Inc()
+	if err := en.js.DeleteMsg(deadLetterStream, seq, nats.Context(ctx)); err != nil {
+		// the message is live again; a leftover DLQ entry only risks a
+		// second redrive
+		en.logger.Warn("Redriven dead letter not removed", zap.Uint64("seq", seq), zap.Error(err))
+	}
+	deadLetters.WithLabelValues(subject, "redriven").Inc()
+	return nil
+}
+
+// eventContext returns ctx carrying the tenant and agent recorded in the
+// CloudEvent a dead letter holds, if it holds one
+func (en *EnterpriseNATS) eventContext(ctx context.Context, subject string, h nats.Header, data []byte) context.Context {
+	if h.Get(hdrContentType) != cloudEventsContentType {
+		return ctx
+	}
+	plain, err := en.openPayload(subject, h, data)
+	if err != nil {
+		return ctx
+	}
+	var event CloudEvent
+	if json.Unmarshal(plain, &event) != nil {
+		return ctx
+	}
+	if event.Tenant != "" {
+		ctx = WithTenant(ctx, event.Tenant)
+	}
+	if event.Agent != "" {
+		ctx = WithAgent(ctx, event.Agent)
+	}
+	return ctx
+}
+
+func (en *EnterpriseNATS) newDeadLetter(seq uint64, h nats.Header, data []byte, at time.Time) DeadLetter {
+	if plain, err := en.openPayload(h.Get(hdrDeadSubject), h, data); err == nil {
+		data = plain
+	}
+	deliveries, _ := strconv.Atoi(h.Get(hdrDeadDeliveries))
+	streamSeq, _ := strconv.ParseUint(h.Get(hdrDeadStreamSeq), 10, 64)
+	letter := DeadLetter{
+		Seq:        seq,
+		Subject:    h.Get(hdrDeadSubject),
+		Data:       data,
+		Error:      h.Get(hdrDeadError),
+		Deliveries: deliveries,
+		StreamSeq:  streamSeq,
+		Consumer:   h.Get(hdrDeadConsumer),
+		FailedAt:   at,
+	}
+	if !json.Valid(data) {
+		// keep the listing encodable for payloads that are not JSON
+		letter.Data, _ = json.Marshal(data)
+	}
+	return letter
+}
+
+// DeadLetterHandler serves the DLQ under /api/dead-letters/:
+//
+//	GET  /api/dead-letters/?subject=&after=&limit=  list, oldest first
+//	GET  /api/dead-letters/{seq}                    one dead letter
+//	POST /api/dead-letters/{seq}/redrive            optional replacement payload as the body
+func (en *EnterpriseNATS) DeadLetterHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/dead-letters/"), "/")
+
+		var (
+			body any
+			err  error
+		)
+		switch {
+		case r.Method == http.MethodGet && path == "":
+			q := r.URL.Query()
+			subject := q.Get("subject")
+			if subject == "" {
+				subject = ">"
+			}
+			after, _ := strconv.ParseUint(q.Get("after"), 10, 64)
+			limit, _ := strconv.Atoi(q.Get("limit"))
+			body, err = en.DeadLetters(r.Context(), subject, after, limit)
+		default:
+			seq, perr := strconv.ParseUint(path, 10, 64)
+			if perr != nil {
+				http.NotFound(w, r)
+				return
+			}
+			switch {
+			case r.Method == http.MethodGet && action == "":
+				body, err = en.DeadLetter(r.Context(), seq)
+			case r.Method == http.MethodPost && action == "redrive":
+				var payload json.RawMessage
+				if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+					http.Error(w, "payload must be JSON", http.StatusBadRequest)
+					return
+				}
+				if err = en.Redrive(r.Context(), seq, payload); err == nil {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+		}
+
+		switch {
+		case errors.Is(err, ErrDeadLetterNotFound):
+			http.NotFound(w, r)
+			return
+		case errors.Is(err, ErrSchemaViolation):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
@@ -0,0 +1,207 @@
+// encryption.go - End-to-End Payload Encryption
+package messaging
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	qcrypto "cirium.ai/core/crypto"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// headers describing how a payload was sealed; the key itself never
+	// leaves the publisher and subscriber
+	hdrEncAlg   = "Enc-Alg"
+	hdrEncKeyID = "Enc-Key-Id"
+
+	encAlgAES256GCM = "A256GCM"
+)
+
+var (
+	ErrPayloadKeyUnknown = errors.New("payload key unknown")
+	ErrPayloadSealed     = errors.New("payload is encrypted and no keyring is set")
+	ErrPayloadPlaintext  = errors.New("plaintext payload on an encrypted subject")
+)
+
+var payloadCrypto = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_nats_payload_crypto_total",
+	Help: "Payloads sealed and opened by end-to-end encryption, by outcome",
+}, []string{"subject", "op"})
+
+func init() {
+	prometheus.MustRegister(payloadCrypto)
+}
+
+// PayloadEncryptionConfig chooses which subjects are encrypted and with
+// which root keys
+type PayloadEncryptionConfig struct {
+	// CurrentKeyID names the root key new payloads are sealed with
+	CurrentKeyID string
+	// Keys holds every root key still needed to open retained messages,
+	// by key ID; each must be at least 32 bytes
+	Keys map[string][]byte
+	// Subjects lists the subjects, wildcards allowed, whose payloads are
+	// encrypted
+	Subjects []string
+	// AcceptPlaintext lets subscribers take unencrypted payloads on those
+	// subjects while publishers are being rolled over
+	AcceptPlaintext bool
+}
+
+// PayloadKeyring seals and opens payloads with AES-256-GCM under keys
+// derived per subject from the configured roots, so a compromised NATS
+// cluster or its storage only ever holds ciphertext. The subject is bound
+// as additional data, so a payload moved to another subject fails to open.
+type PayloadKeyring struct {
+	cfg   PayloadEncryptionConfig
+	aeads sync.Map // keyID + "\x00" + subject -> cipher.AEAD
+}
+
+// NewPayloadKeyring checks cfg and returns a keyring for it
+func NewPayloadKeyring(cfg PayloadEncryptionConfig) (*PayloadKeyring, error) {
+	if _, ok := cfg.Keys[cfg.CurrentKeyID]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrPayloadKeyUnknown, cfg.CurrentKeyID)
+	}
+	for id, root := range cfg.Keys {
+		if len(root) < 32 {
+			return nil, fmt.Errorf("payload root key %q shorter than 32 bytes", id)
+		}
+	}
+	if len(cfg.Subjects) == 0 {
+		return nil, fmt.Errorf("payload encryption needs at least one subject")
+	}
+	return &PayloadKeyring{cfg: cfg}, nil
+}
+
+// Covers reports whether payloads on subject are encrypted
+func (k *PayloadKeyring) Covers(subject string) bool {
+	for _, pattern := range k.cfg.Subjects {
+		if subjectMatches(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *PayloadKeyring) aead(keyID, subject string) (cipher.AEAD, error) {
+	cacheKey := keyID + "\x00" + subject
+	if a, ok := k.aeads.Load(cacheKey); ok {
+		return a.(cipher.AEAD), nil
+	}
+	root, ok := k.cfg.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrPayloadKeyUnknown, keyID)
+	}
+	key, err := qcrypto.DeriveSubjectKey(root, qcrypto.PurposeMessaging, subject)
+	if err != nil {
+		return nil, fmt.Errorf("subject key derivation failed: %w", err)
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	k.aeads.Store(cacheKey, gcm)
+	return gcm, nil
+}
+
+// seal encrypts data for subject under the current key, returning the
+// nonce-prefixed ciphertext
+func (k *PayloadKeyring) seal(subject string, data []byte) ([]byte, error) {
+	gcm, err := k.aead(k.cfg.CurrentKeyID, subject)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(data)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("nonce generation failed: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, data, []byte(subject)), nil
+}
+
+func (k *PayloadKeyring) open(subject, keyID string, data []byte) ([]byte, error) {
+	gcm, err := k.aead(keyID, subject)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("sealed payload truncated")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, []byte(subject))
+	if err != nil {
+		return nil, fmt.Errorf("payload authentication failed: %w", err)
+	}
+	return plain, nil
+}
+
+// encryptionHolder gives a broker an optional payload keyring
+type encryptionHolder struct {
+	keyring atomic.Pointer[PayloadKeyring]
+}
+
+// SetPayloadKeyring encrypts payloads on the keyring's subjects from now
+// on and opens encrypted payloads before handlers see them
+func (h *encryptionHolder) SetPayloadKeyring(k *PayloadKeyring) {
+	h.keyring.Store(k)
+}
+
+// sealMsg encrypts msg's payload in place when its subject is covered
+func (h *encryptionHolder) sealMsg(msg *nats.Msg) error {
+	k := h.keyring.Load()
+	if k == nil || !k.Covers(msg.Subject) {
+		return nil
+	}
+	sealed, err := k.seal(msg.Subject, msg.Data)
+	if err != nil {
+		payloadCrypto.WithLabelValues(msg.Subject, "seal_failed").Inc()
+		return fmt.Errorf("payload encryption failed: %w", err)
+	}
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	msg.Data = sealed
+	msg.Header.Set(hdrEncAlg, encAlgAES256GCM)
+	msg.Header.Set(hdrEncKeyID, k.cfg.CurrentKeyID)
+	payloadCrypto.WithLabelValues(msg.Subject, "sealed").Inc()
+	return nil
+}
+
+// openPayload returns the plaintext of a payload published on subject,
+// described by header
+func (h *encryptionHolder) openPayload(subject string, header nats.Header, data []byte) ([]byte, error) {
+	k := h.keyring.Load()
+	alg := header.Get(hdrEncAlg)
+	if alg == "" {
+		if k != nil && k.Covers(subject) && !k.cfg.AcceptPlaintext {
+			payloadCrypto.WithLabelValues(subject, "open_failed").Inc()
+			return nil, ErrPayloadPlaintext
+		}
+		return data, nil
+	}
+	if k == nil {
+		payloadCrypto.WithLabelValues(subject, "open_failed").Inc()
+		return nil, ErrPayloadSealed
+	}
+	if alg != encAlgAES256GCM {
+		payloadCrypto.WithLabelValues(subject, "open_failed").Inc()
+		return nil, fmt.Errorf("unsupported payload algorithm %q", alg)
+	}
+	plain, err := k.open(subject, header.Get(hdrEncKeyID), data)
+	if err != nil {
+		payloadCrypto.WithLabelValues(subject, "open_failed").Inc()
+		return nil, err
+	}
+	payloadCrypto.WithLabelValues(subject, "opened").Inc()
+	return plain, nil
+}
@@ -0,0 +1,409 @@
+// envelope.go - Typed Agent-to-Agent Messaging
+package messaging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// EnvelopeVersion is the wire version written by this package; receivers
+// reject envelopes from a newer major version
+const EnvelopeVersion = 1
+
+// agentSubjectPrefix roots every agent inbox: agents.<tenant>.<agent>.inbox
+const agentSubjectPrefix = "agents."
+
+var (
+	// ErrDeadlineExceeded is returned for envelopes whose deadline passed
+	// before they were handled
+	ErrDeadlineExceeded = errors.New("message deadline exceeded")
+	// ErrUnknownSchema is returned for content schemas the receiver has not
+	// registered
+	ErrUnknownSchema = errors.New("unknown content schema")
+	// ErrUnauthorized is returned when a delegated token is rejected
+	ErrUnauthorized = errors.New("delegated token rejected")
+)
+
+var agentMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_agent_messages_total",
+	Help: "Inter-agent messages by intent and outcome",
+}, []string{"intent", "outcome"})
+
+func init() {
+	prometheus.MustRegister(agentMessages)
+}
+
+// Intent states what the sender expects of the receiver
+type Intent string
+
+const (
+	// IntentRequest asks for work and expects a reply
+	IntentRequest Intent = "request"
+	// IntentInform shares information; no reply is expected
+	IntentInform Intent = "inform"
+	// IntentDelegate hands work over along with the sender's authority
+	IntentDelegate Intent = "delegate"
+	// IntentReply answers a request
+	IntentReply Intent = "reply"
+	// IntentFailure answers a request that could not be served
+	IntentFailure Intent = "failure"
+)
+
+// Envelope wraps every message exchanged between agents
+type Envelope struct {
+	Version  int    `json:"v"`
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Intent   Intent `json:"intent"`
+	// Schema names the content type, e.g. "research.summary/v1"
+	Schema  string          `json:"schema"`
+	Content json.RawMessage `json:"content,omitempty"`
+	// ReplyTo is the subject replies are published on; it must lie in the
+	// sender's reply inbox, under AgentInboxPrefix
+	ReplyTo string `json:"reply_to,omitempty"`
+	// CorrelationID links a reply to the request's ID
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// Deadline, when set, is when the message stops being worth handling
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// AuthToken carries authority the sender delegates to the receiver
+	AuthToken string    `json:"auth_token,omitempty"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+// Decode unmarshals the envelope's content into v
+func (e *Envelope) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Content, v); err != nil {
+		return fmt.Errorf("content decode failed for %s: %w", e.Schema, err)
+	}
+	return nil
+}
+
+// Expired reports whether the envelope's deadline has passed
+func (e *Envelope) Expired() bool {
+	return e.Deadline != nil && time.Now().After(*e.Deadline)
+}
+
+// RemoteError is returned by Request when the receiver answered with a
+// failure
+type RemoteError struct {
+	Agent   string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("agent %s failed: %s", e.Agent, e.Message)
+}
+
+// SendOption adjusts an outgoing envelope
+type SendOption func(*Envelope)
+
+// WithDeadline sets when the message stops being worth handling
+func WithDeadline(t time.Time) SendOption {
+	return func(e *Envelope) { e.Deadline = &t }
+}
+
+// WithDelegation attaches a token the receiver acts under
+func WithDelegation(token string) SendOption {
+	return func(e *Envelope) { e.AuthToken = token }
+}
+
+// TokenVerifier checks a delegated token against the envelope it arrived
+// in; returning an error rejects the message
+type TokenVerifier func(ctx context.Context, token string, env *Envelope) error
+
+// MessageHandler serves an envelope. For requests the returned content is
+// sent back as the reply; a returned error becomes a failure reply.
+type MessageHandler func(ctx context.Context, env *Envelope) (interface{}, error)
+
+// AgentClient sends and receives envelopes on behalf of one agent
+type AgentClient struct {
+	nats     *EnterpriseNATS
+	tenantID string
+	agentID  string
+	verifier TokenVerifier
+
+	mu      sync.RWMutex
+	schemas map[string]func(json.RawMessage) error
+}
+
+// NewAgentClient binds an agent identity to a NATS connection
+func (en *EnterpriseNATS) NewAgentClient(tenantID, agentID string) (*AgentClient, error) {
+	if !validToken(tenantID) || !validToken(agentID) {
+		return nil, fmt.Errorf("invalid agent address %q/%q", tenantID, agentID)
+	}
+	return &AgentClient{
+		nats:     en,
+		tenantID: tenantID,
+		agentID:  agentID,
+		schemas:  make(map[string]func(json.RawMessage) error),
+	}, nil
+}
+
+// InboxSubject is the subject an agent receives envelopes on
+func InboxSubject(tenantID, agentID string) string {
+	return agentSubjectPrefix + tenantID + "." + agentID + ".inbox"
+}
+
+// RegisterSchema declares a content schema this agent accepts. validate
+// may be nil to accept any JSON; envelopes naming unregistered schemas
+// are refused.
+func (c *AgentClient) RegisterSchema(schema string, validate func(json.RawMessage) error) {
+	if validate == nil {
+		validate = func(json.RawMessage) error { return nil }
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schemas[schema] = validate
+}
+
+// SetTokenVerifier enables checks on delegated tokens; without one,
+// tokens are passed to handlers unverified
+func (c *AgentClient) SetTokenVerifier(v TokenVerifier) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.verifier = v
+}
+
+// Send publishes an envelope to another agent of the same tenant
+func (c *AgentClient) Send(ctx context.Context, to string, intent Intent, schema string, content interface{}, opts ...SendOption) (*Envelope, error) {
+	if !validToken(to) {
+		return nil, fmt.Errorf("invalid recipient %q", to)
+	}
+	env, err := c.envelope(intent, schema, content)
+	if err != nil {
+		return nil, err
+	}
+	env.To = to
+	if deadline, ok := ctx.Deadline(); ok {
+		env.Deadline = &deadline
+	}
+	for _, opt := range opts {
+		opt(env)
+	}
+
+	if err := c.nats.Publish(ctx, InboxSubject(c.tenantID, to), env); err != nil {
+		agentMessages.WithLabelValues(string(intent), "send_error").Inc()
+		return nil, err
+	}
+	agentMessages.WithLabelValues(string(intent), "sent").Inc()
+	return env, nil
+}
+
+// Request sends a request and waits for the reply until ctx ends
+func (c *AgentClient) Request(ctx context.Context, to, schema string, content interface{}, opts ...SendOption) (*Envelope, error) {
+	// the reply inbox lies under the agent's own prefix, the only one its
+	// minted credentials may subscribe to
+	inbox := AgentInboxPrefix(c.tenantID, c.agentID) + "." + strings.TrimPrefix(nats.NewInbox(), nats.InboxPrefix)
+	sub, err := c.nats.conn.SubscribeSync(inbox)
+	if err != nil {
+		return nil, fmt.Errorf("reply subscription failed: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	opts = append(opts, func(e *Envelope) { e.ReplyTo = inbox })
+	req, err := c.Send(ctx, to, IntentRequest, schema, content, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("no reply from %s: %w", to, err)
+		}
+		var reply Envelope
+		if err := json.Unmarshal(msg.Data, &reply); err != nil || reply.CorrelationID != req.ID {
+			continue
+		}
+		if reply.Intent == IntentFailure {
+			var message string
+			_ = reply.Decode(&message)
+			return &reply, &RemoteError{Agent: to, Message: message}
+		}
+		return &reply, nil
+	}
+}
+
+// Listen serves envelopes addressed to this agent until the returned
+// subscription ends or the connection shuts down. Malformed, expired,
+// unauthorized or unknown-schema envelopes are refused without reaching
+// handler, and requests among them get a failure reply.
+func (c *AgentClient) Listen(handler MessageHandler) (Subscription, error) {
+	subject := InboxSubject(c.tenantID, c.agentID)
+	return c.nats.Subscribe(subject, func(data []byte) error {
+		var env Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			agentMessages.WithLabelValues("", "malformed").Inc()
+			c.nats.logger.Warn("Dropping malformed agent message",
+				zap.String("subject", subject), zap.Error(err))
+			return nil
+		}
+
+		ctx := context.Background()
+		if env.Deadline != nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, *env.Deadline)
+			defer cancel()
+		}
+
+		if err := c.admit(ctx, &env); err != nil {
+			agentMessages.WithLabelValues(string(env.Intent), "refused").Inc()
+			c.nats.logger.Warn("Refusing agent message",
+				zap.String("id", env.ID), zap.String("from", env.From), zap.Error(err))
+			c.reply(ctx, &env, nil, err)
+			return nil
+		}
+
+		result, err := handler(ctx, &env)
+		if err != nil {
+			agentMessages.WithLabelValues(string(env.Intent), "failed").Inc()
+		} else {
+			agentMessages.WithLabelValues(string(env.Intent), "handled").Inc()
+		}
+		c.reply(ctx, &env, result, err)
+		return nil
+	})
+}
+
+// admit checks an incoming envelope before it reaches the handler
+func (c *AgentClient) admit(ctx context.Context, env *Envelope) error {
+	if env.Version < 1 || env.Version > EnvelopeVersion {
+		return fmt.Errorf("unsupported envelope version %d", env.Version)
+	}
+	if env.TenantID != c.tenantID {
+		return fmt.Errorf("envelope from tenant %q", env.TenantID)
+	}
+	if env.Expired() {
+		return ErrDeadlineExceeded
+	}
+
+	c.mu.RLock()
+	validate, ok := c.schemas[env.Schema]
+	verifier := c.verifier
+	c.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSchema, env.Schema)
+	}
+	if err := validate(env.Content); err != nil {
+		return fmt.Errorf("content does not match %s: %w", env.Schema, err)
+	}
+	if verifier != nil && env.AuthToken != "" {
+		if err := verifier(ctx, env.AuthToken, env); err != nil {
+			return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+		}
+	}
+	return nil
+}
+
+// reply answers a request on its reply subject; other intents get none.
+// Envelopes arrive through JetStream, which does not keep the requester's
+// NATS reply subject, so ReplyTo is honoured only within the requester's
+// own tenant-scoped inbox and a reply is never sent elsewhere.
+func (c *AgentClient) reply(ctx context.Context, req *Envelope, result interface{}, cause error) {
+	if req.Intent != IntentRequest || req.ReplyTo == "" {
+		return
+	}
+	if !validToken(req.From) || !subjectWithin(AgentInboxPrefix(c.tenantID, req.From)+".>", req.ReplyTo) {
+		agentMessages.WithLabelValues(string(req.Intent), "reply_refused").Inc()
+		c.nats.logger.Warn("Refusing reply outside the requester's inbox",
+			zap.String("id", req.ID), zap.String("from", req.From), zap.String("reply_to", req.ReplyTo))
+		return
+	}
+	intent, content := IntentReply, result
+	if cause != nil {
+		intent, content = IntentFailure, cause.Error()
+	}
+	env, err := c.envelope(intent, req.Schema, content)
+	if err != nil {
+		c.nats.logger.Error("Reply encoding failed", zap.String("id", req.ID), zap.Error(err))
+		return
+	}
+	env.To = req.From
+	env.CorrelationID = req.ID
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		return
+	}
+	// reply inboxes live outside JetStream, so publish on the core
+	// connection
+	if err := c.nats.conn.Publish(req.ReplyTo, data); err != nil {
+		agentMessages.WithLabelValues(string(intent), "send_error").Inc()
+		c.nats.logger.Error("Reply publish failed", zap.String("id", req.ID), zap.Error(err))
+		return
+	}
+	agentMessages.WithLabelValues(string(intent), "sent").Inc()
+}
+
+func (c *AgentClient) envelope(intent Intent, schema string, content interface{}) (*Envelope, error) {
+	if schema == "" {
+		return nil, fmt.Errorf("envelope needs a content schema")
+	}
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("content encode failed: %w", err)
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("message ID generation failed: %w", err)
+	}
+	return &Envelope{
+		Version:  EnvelopeVersion,
+		ID:       hex.EncodeToString(buf),
+		TenantID: c.tenantID,
+		From:     c.agentID,
+		Intent:   intent,
+		Schema:   schema,
+		Content:  raw,
+		SentAt:   time.Now().UTC(),
+	}, nil
+}
+
+// HeartbeatSubject is where an agent announces it is alive
+func HeartbeatSubject(tenantID, agentID string) string {
+	return agentSubjectPrefix + tenantID + "." + agentID + ".heartbeat"
+}
+
+// Heartbeat is published periodically by a live agent
+type Heartbeat struct {
+	TenantID string    `json:"tenant_id"`
+	AgentID  string    `json:"agent_id"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// Heartbeat announces the agent every interval until ctx ends. The
+// manager degrades agents that miss several in a row.
+func (c *AgentClient) Heartbeat(ctx context.Context, interval time.Duration) {
+	subject := HeartbeatSubject(c.tenantID, c.agentID)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		hb := Heartbeat{TenantID: c.tenantID, AgentID: c.agentID, SentAt: time.Now().UTC()}
+		if err := c.nats.Publish(ctx, subject, hb); err != nil && ctx.Err() == nil {
+			c.nats.logger.Warn("Heartbeat publish failed", zap.String("agent", c.agentID), zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// validToken reports whether s can be used as a single subject token
+func validToken(s string) bool {
+	return s != "" && !strings.ContainsAny(s, ".*> \t\r\n")
+}
@@ -0,0 +1,133 @@
+// flow.go - Publish Flow Control and Backpressure
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMaxPending = 256
+	// ackTimeout is how long a publish may wait for its ack
+	ackTimeout = 30 * time.Second
+	// minPublishWindow keeps some async pipelining even while the server
+	// is struggling
+	minPublishWindow = 16
+)
+
+// ErrBackpressure is returned when the server cannot keep up and the
+// caller's context ended before a publish was acknowledged
+var ErrBackpressure = errors.New("publish backpressure")
+
+var (
+	publishPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "Wavine_nats_publish_pending_messages",
+		Help: "Async publishes awaiting their ack",
+	})
+
+	publishWindowSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "Wavine_nats_publish_window_messages",
+		Help: "Current adaptive limit on async publishes awaiting their ack",
+	})
+
+	publishBackpressure = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_nats_publish_backpressure_total",
+		Help: "Publishes slowed or refused because the async window was full",
+	}, []string{"subject", "action"})
+)
+
+func init() {
+	prometheus.MustRegister(publishPending, publishWindowSize, publishBackpressure)
+}
+
+// publishWindow bounds async publishes in flight. The limit follows
+// AIMD: it halves when acks fail or time out and grows by one after a
+// full window of successful acks, up to the configured ceiling.
+type publishWindow struct {
+	mu      sync.Mutex
+	pending int
+	limit   int
+	ceiling int
+	acked   int
+}
+
+func newPublishWindow(ceiling int) *publishWindow {
+	publishWindowSize.Set(float64(ceiling))
+	return &publishWindow{limit: ceiling, ceiling: ceiling}
+}
+
+// tryAcquire reserves a slot, reporting false when the window is full
+func (w *publishWindow) tryAcquire() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pending >= w.limit {
+		return false
+	}
+	w.pending++
+	publishPending.Set(float64(w.pending))
+	return true
+}
+
+// release frees a slot; ok reports whether its publish was acknowledged
+func (w *publishWindow) release(ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending--
+	publishPending.Set(float64(w.pending))
+	if !ok {
+		w.acked = 0
+		w.limit /= 2
+		if w.limit < minPublishWindow {
+			w.limit = minPublishWindow
+		}
+		if w.limit > w.ceiling {
+			w.limit = w.ceiling
+		}
+	} else if w.acked++; w.acked >= w.limit && w.limit < w.ceiling {
+		w.acked = 0
+		w.limit++
+	}
+	publishWindowSize.Set(float64(w.limit))
+}
+
+// PublishPressure reports async publishes awaiting their ack and the
+// current window. pending at or above window means Publish has fallen
+// back to synchronous publishing, so producers that can shed or defer
+// work should do so.
+func (en *EnterpriseNATS) PublishPressure() (pending, window int) {
+	en.window.mu.Lock()
+	defer en.window.mu.Unlock()
+	return en.window.pending, en.window.limit
+}
+
+// publishSync publishes msg and waits for its ack; Publish falls back to
+// it when the async window is full, so the caller is paced by the server
+func (en *EnterpriseNATS) publishSync(ctx context.Context, msg *nats.Msg) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ackTimeout)
+		defer cancel()
+	}
+	pa, err := en.js.PublishMsg(msg, nats.Context(ctx))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			msgFailed.WithLabelValues(msg.Subject, "ack_timeout").Inc()
+			publishBackpressure.WithLabelValues(msg.Subject, "rejected").Inc()
+			return fmt.Errorf("%w: %v", ErrBackpressure, err)
+		}
+		msgFailed.WithLabelValues(msg.Subject, "publish_error").Inc()
+		return fmt.Errorf("publish failed: %w", err)
+	}
+	if pa.Duplicate {
+		msgDuplicates.WithLabelValues(msg.Subject, "publish").Inc()
+		return nil
+	}
+	msgDelivered.WithLabelValues(msg.Subject).Inc()
+	return nil
+}
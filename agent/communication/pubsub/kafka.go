@@ -0,0 +1,440 @@
+// kafka.go - Kafka Broker Backend
+package messaging
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	"go.uber.org/zap"
+)
+
+// subjectHeader carries the full subject of a record, since a topic holds
+// every subject that shares its first token
+const subjectHeader = "subject"
+
+// KafkaConfig configures KafkaBroker
+type KafkaConfig struct {
+	Brokers   []string
+	TLSConfig *tls.Config
+	// SASLMechanism is "", "plain", "scram-sha-256" or "scram-sha-512"
+	SASLMechanism string
+	Username      string
+	Password      string
+	ClientID      string
+	// TopicPrefix is put in front of the topic names subjects map to
+	TopicPrefix string
+	// GroupID, when set, makes subscribers a consumer group that shares
+	// the work and resumes from committed offsets. Without it every
+	// subscriber sees every message published after it started, as with
+	// NATS.
+	GroupID string
+	// CloudEvents, when set, wraps every published event in a CloudEvents
+	// 1.0 envelope, as Config.CloudEvents does for NATS
+	CloudEvents *CloudEventsConfig
+	// ShutdownTimeout bounds how long Shutdown waits for running handlers
+	// and unflushed publishes; 30s by default
+	ShutdownTimeout time.Duration
+}
+
+// KafkaBroker carries subjects over Kafka for estates that do not run
+// NATS. A subject's first token picks the topic (agents.t1.a1.inbox goes
+// to "agents") and the full subject travels as the record key and a
+// header, so wildcard subscriptions behave as they do on NATS.
+type KafkaBroker struct {
+	schemaHolder
+	encryptionHolder
+	producer *kgo.Client
+	cfg      KafkaConfig
+	opts     []kgo.Opt
+	logger   *zap.Logger
+
+	mu           sync.Mutex
+	consumers    map[*kafkaSubscription]struct{}
+	shutdownChan chan struct{}
+	wg           sync.WaitGroup
+}
+
+func NewKafkaBroker(cfg KafkaConfig, logger *zap.Logger) (*KafkaBroker, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka needs at least one broker")
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = defaultShutdownTimeout
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.AllowAutoTopicCreation(),
+	}
+	if cfg.ClientID != "" {
+		opts = append(opts, kgo.ClientID(cfg.ClientID))
+	}
+	if cfg.TLSConfig != nil {
+		opts = append(opts, kgo.DialTLSConfig(cfg.TLSConfig))
+	}
+	switch cfg.SASLMechanism {
+	case "":
+	case "plain":
+		opts = append(opts, kgo.SASL(plain.Auth{User: cfg.Username, Pass: cfg.Password}.AsMechanism()))
+	case "scram-sha-256":
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha256Mechanism()))
+	case "scram-sha-512":
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha512Mechanism()))
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism %q", cfg.SASLMechanism)
+	}
+
+	producer, err := kgo.NewClient(append(opts,
+		// matches the ack timeout of EnterpriseNATS.trackAck
+		kgo.RecordDeliveryTimeout(30*time.Second),
+	)...)
+	if err != nil {
+		return nil, fmt.Errorf("kafka client init failed: %w", err)
+	}
+	return &KafkaBroker{
+		producer:     producer,
+		cfg:          cfg,
+		opts:         opts,
+		logger:       logger,
+		consumers:    make(map[*kafkaSubscription]struct{}),
+		shutdownChan: make(chan struct{}),
+	}, nil
+}
+
+func (kb *KafkaBroker) topic(subject string) string {
+	first, _, _ := strings.Cut(subject, ".")
+	return kb.cfg.TopicPrefix + first
+}
+
+// Publish checks, wraps and seals payload exactly as EnterpriseNATS does,
+// carrying the resulting headers as record headers
+func (kb *KafkaBroker) Publish(ctx context.Context, subject string, payload interface{}) error {
+	if err := authorizePublish(ctx, subject); err != nil {
+		return err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+
+	if err := kb.validatePayload(ctx, subject, data); err != nil {
+		msgFailed.WithLabelValues(subject, "schema_violation").Inc()
+		return err
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	if err := wrapCloudEvent(ctx, kb.cfg.CloudEvents, msg, ""); err != nil {
+		return err
+	}
+	if err := kb.sealMsg(msg); err != nil {
+		msgFailed.WithLabelValues(subject, "encrypt_error").Inc()
+		return err
+	}
+
+	msgPublished.WithLabelValues(subject).Inc()
+
+	record := &kgo.Record{
+		Topic:   kb.topic(subject),
+		Key:     []byte(subject),
+		Value:   msg.Data,
+		Headers: []kgo.RecordHeader{{Key: subjectHeader, Value: []byte(subject)}},
+	}
+	for key, values := range msg.Header {
+		for _, v := range values {
+			record.Headers = append(record.Headers, kgo.RecordHeader{Key: key, Value: []byte(v)})
+		}
+	}
+	// like PublishAsync, the record outlives the caller's context once
+	// it is buffered
+	kb.producer.Produce(context.WithoutCancel(ctx), record, func(_ *kgo.Record, err error) {
+		if err != nil {
+			msgFailed.WithLabelValues(subject, "nack_error").Inc()
+			kb.logger.Error("Message rejected",
+				zap.String("subject", subject),
+				zap.Error(err))
+			return
+		}
+		msgDelivered.WithLabelValues(subject).Inc()
+	})
+	return nil
+}
+
+// Subscribe consumes subject, which may use the NATS wildcards * and >.
+// Kafka cannot hand a message back, so a failing handler is retried in
+// place up to maxDeliver times before the message is dead-lettered. Only
+// handled or dead-lettered records are committed; any other is fetched
+// again.
+func (kb *KafkaBroker) Subscribe(subject string, handler func([]byte) error) (Subscription, error) {
+	opts := append([]kgo.Opt{}, kb.opts...)
+	if first, _, _ := strings.Cut(subject, "."); first == "*" || first == ">" {
+		opts = append(opts, kgo.ConsumeRegex(),
+			kgo.ConsumeTopics("^"+regexp.QuoteMeta(kb.cfg.TopicPrefix)+".+"))
+	} else {
+		opts = append(opts, kgo.ConsumeTopics(kb.topic(subject)))
+	}
+	if kb.cfg.GroupID != "" {
+		opts = append(opts, kgo.ConsumerGroup(kb.cfg.GroupID+"."+subject), kgo.AutoCommitMarks())
+	} else {
+		opts = append(opts, kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()))
+	}
+
+	consumer, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("kafka consumer init failed: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &kafkaSubscription{kb: kb, cancel: cancel, done: make(chan struct{})}
+
+	kb.mu.Lock()
+	select {
+	case <-kb.shutdownChan:
+		kb.mu.Unlock()
+		cancel()
+		consumer.Close()
+		return nil, fmt.Errorf("broker shut down")
+	default:
+	}
+	kb.consumers[s] = struct{}{}
+	kb.wg.Add(1)
+	kb.mu.Unlock()
+
+	go func() {
+		defer kb.wg.Done()
+		defer close(s.done)
+		defer consumer.Close()
+		kb.consume(ctx, s, consumer, subject, handler)
+	}()
+	return s, nil
+}
+
+func (kb *KafkaBroker) consume(ctx context.Context, s *kafkaSubscription, consumer *kgo.Client, subject string, handler func([]byte) error) {
+	for {
+		fetches := consumer.PollFetches(ctx)
+		if fetches.IsClientClosed() {
+			return
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			if ctx.Err() != nil {
+				return
+			}
+			kb.logger.Warn("Kafka fetch failed",
+				zap.String("topic", topic), zap.Int32("partition", partition), zap.Error(err))
+		})
+		// a partition whose record was not done with is rewound to it, and
+		// none of its later records are handled or committed meanwhile
+		rewind := make(map[string]map[int32]kgo.EpochOffset)
+		fetches.EachRecord(func(record *kgo.Record) {
+			if _, held := rewind[record.Topic][record.Partition]; held {
+				return
+			}
+			if s.stopping.Load() || !subjectMatches(subject, recordSubject(record)) {
+				return
+			}
+			s.active.start()
+			defer s.active.done()
+			if !kb.deliver(subject, record, handler) {
+				if rewind[record.Topic] == nil {
+					rewind[record.Topic] = make(map[int32]kgo.EpochOffset)
+				}
+				rewind[record.Topic][record.Partition] = kgo.EpochOffset{Epoch: record.LeaderEpoch, Offset: record.Offset}
+				return
+			}
+			if kb.cfg.GroupID != "" {
+				consumer.MarkCommitRecords(record)
+			}
+		})
+		if len(rewind) > 0 && ctx.Err() == nil {
+			consumer.SetOffsets(rewind)
+		}
+		if kb.cfg.GroupID != "" {
+			if err := consumer.CommitMarkedOffsets(context.Background()); err != nil {
+				kb.logger.Warn("Kafka offset commit failed", zap.String("subject", subject), zap.Error(err))
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// deliver opens record and runs handler on it, retrying in place. It
+// reports whether the record is done with: handled, or dead-lettered
+// after its last attempt. A payload that cannot be opened is dead-lettered
+// at once, since redelivery cannot fix it.
+func (kb *KafkaBroker) deliver(subject string, record *kgo.Record, handler func([]byte) error) bool {
+	header := recordHeader(record)
+	data, err := kb.openPayload(recordSubject(record), header, record.Value)
+	if err == nil {
+		data, err = eventData(header, data)
+	}
+	if err != nil {
+		msgFailed.WithLabelValues(subject, "payload_error").Inc()
+		return kb.deadLetter(record, header, 1, err) == nil
+	}
+	for attempt := 1; ; attempt++ {
+		err := handler(data)
+		if err == nil {
+			msgDelivered.WithLabelValues(subject).Inc()
+			return true
+		}
+		msgFailed.WithLabelValues(subject, "handler_error").Inc()
+		if attempt >= maxDeliver {
+			return kb.deadLetter(record, header, attempt, err) == nil
+		}
+		select {
+		case <-kb.shutdownChan:
+			return false
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+}
+
+// deadLetter copies a record whose handler kept failing to the dlq
+// topic, with the same headers EnterpriseNATS records
+func (kb *KafkaBroker) deadLetter(record *kgo.Record, header nats.Header, deliveries int, cause error) error {
+	subject := recordSubject(record)
+	dead := &kgo.Record{
+		Topic: kb.topic(DeadLetterSubject(subject)),
+		Key:   []byte(subject),
+		Value: record.Value,
+		Headers: []kgo.RecordHeader{
+			{Key: subjectHeader, Value: []byte(DeadLetterSubject(subject))},
+			{Key: hdrDeadSubject, Value: []byte(subject)},
+			{Key: hdrDeadError, Value: []byte(cause.Error())},
+			{Key: hdrDeadDeliveries, Value: []byte(strconv.Itoa(deliveries))},
+			{Key: hdrDeadStreamSeq, Value: []byte(strconv.FormatInt(record.Offset, 10))},
+		},
+	}
+	// encrypted payloads stay sealed under their original subject's key,
+	// and CloudEvents keep their content type
+	for _, h := range []string{hdrEncAlg, hdrEncKeyID, hdrContentType} {
+		if v := header.Get(h); v != "" {
+			dead.Headers = append(dead.Headers, kgo.RecordHeader{Key: h, Value: []byte(v)})
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := kb.producer.ProduceSync(ctx, dead).FirstErr(); err != nil {
+		msgFailed.WithLabelValues(subject, "dead_letter_error").Inc()
+		kb.logger.Error("Dead letter not stored", zap.String("subject", subject), zap.Error(err))
+		return err
+	}
+	deadLetters.WithLabelValues(subject, "stored").Inc()
+	kb.logger.Warn("Message dead-lettered",
+		zap.String("subject", subject), zap.Int("deliveries", deliveries), zap.Error(cause))
+	return nil
+}
+
+// recordHeader returns a record's headers in the form sealing and the
+// CloudEvents envelope describe payloads with
+func recordHeader(record *kgo.Record) nats.Header {
+	header := nats.Header{}
+	for _, h := range record.Headers {
+		header.Add(h.Key, string(h.Value))
+	}
+	return header
+}
+
+func recordSubject(record *kgo.Record) string {
+	for _, h := range record.Headers {
+		if h.Key == subjectHeader {
+			return string(h.Value)
+		}
+	}
+	return string(record.Key)
+}
+
+// subjectMatches applies NATS subject matching: * matches one token and a
+// trailing > one or more
+func subjectMatches(pattern, subject string) bool {
+	want := strings.Split(pattern, ".")
+	got := strings.Split(subject, ".")
+	for i, token := range want {
+		if token == ">" {
+			return len(got) > i
+		}
+		if i >= len(got) || (token != "*" && token != got[i]) {
+			return false
+		}
+	}
+	return len(want) == len(got)
+}
+
+// kafkaSubscription is the handle of one consumer client. Stopping
+// skips the rest of the polled batch, commits what was handled and
+// closes the client.
+type kafkaSubscription struct {
+	kb       *KafkaBroker
+	cancel   context.CancelFunc
+	stopping atomic.Bool
+	active   handlerTracker
+	done     chan struct{}
+}
+
+func (s *kafkaSubscription) stop() {
+	s.stopping.Store(true)
+	s.cancel()
+}
+
+func (s *kafkaSubscription) forget() {
+	s.kb.mu.Lock()
+	delete(s.kb.consumers, s)
+	s.kb.mu.Unlock()
+}
+
+func (s *kafkaSubscription) Unsubscribe() error {
+	s.forget()
+	s.stop()
+	return nil
+}
+
+func (s *kafkaSubscription) Drain(ctx context.Context) error {
+	s.forget()
+	s.stop()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (kb *KafkaBroker) Shutdown() {
+	kb.logger.Info("Initiating graceful shutdown")
+	ctx, cancel := context.WithTimeout(context.Background(), kb.cfg.ShutdownTimeout)
+	defer cancel()
+
+	kb.mu.Lock()
+	close(kb.shutdownChan)
+	for s := range kb.consumers {
+		s.stop()
+	}
+	kb.mu.Unlock()
+	stopped := make(chan struct{})
+	go func() {
+		kb.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		kb.logger.Warn("Shutdown deadline passed with consumers still running")
+	}
+
+	if err := kb.producer.Flush(ctx); err != nil {
+		kb.logger.Error("Flush failed", zap.Error(err))
+	}
+	kb.producer.Close()
+}
@@ -0,0 +1,232 @@
+// lanes.go - Priority Lanes with Weighted Consumption
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Priority selects a task lane; lower values are served first
+type Priority int
+
+const (
+	// PriorityInteractive is for requests a user is waiting on
+	PriorityInteractive Priority = iota
+	// PriorityNormal is the default lane
+	PriorityNormal
+	// PriorityBulk is for background and batch jobs
+	PriorityBulk
+
+	numPriorities = 3
+)
+
+// laneProbeWait bounds how long one lane is polled in a round, so an
+// empty lane cannot hold up the others
+const laneProbeWait = 100 * time.Millisecond
+
+// defaultLaneWeights gives each lane its share of a fetch round
+var defaultLaneWeights = [numPriorities]int{6, 3, 1}
+
+var laneFetched = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_nats_lane_messages_fetched_total",
+	Help: "Messages fetched from each priority lane",
+}, []string{"subject", "lane"})
+
+func init() {
+	prometheus.MustRegister(laneFetched)
+}
+
+// PrioritySubject returns the lane subject of base, e.g. tasks.p0
+func PrioritySubject(base string, p Priority) string {
+	return fmt.Sprintf("%s.p%d", base, p)
+}
+
+// PublishPriority publishes payload on base's lane for p
+func (en *EnterpriseNATS) PublishPriority(ctx context.Context, base string, p Priority, payload interface{}) error {
+	if p < 0 || p >= numPriorities {
+		return fmt.Errorf("priority %d out of range", p)
+	}
+	return en.Publish(ctx, PrioritySubject(base, p), payload)
+}
+
+// LaneConfig describes a weighted consumer over base.p0 to base.p2
+type LaneConfig struct {
+	// Durable names the consumers; each lane gets Durable-p<n>. Processes
+	// sharing it split the work as with ConsumerConfig.
+	Durable string
+	// Subject is the lane base, e.g. "tasks"
+	Subject string
+	// Weights sets each lane's share of a round, highest priority first;
+	// 6/3/1 by default. A lane weighted zero is not consumed; every other
+	// lane gets at least one message per round, so bulk work is slowed but
+	// never starved.
+	Weights [numPriorities]int
+	// Batch is how many messages one round asks for across all lanes;
+	// 32 by default
+	Batch int
+	// AckWait is how long a message may be worked on before it is
+	// redelivered; 30s by default
+	AckWait time.Duration
+}
+
+func (c LaneConfig) withDefaults() LaneConfig {
+	if c.Weights[0] <= 0 && c.Weights[1] <= 0 && c.Weights[2] <= 0 {
+		c.Weights = defaultLaneWeights
+	}
+	if c.Batch <= 0 {
+		c.Batch = defaultFetchBatch
+	}
+	if c.AckWait <= 0 {
+		c.AckWait = defaultConsumerAck
+	}
+	return c
+}
+
+// shares splits a round of batch messages between the lanes by weight
+func (c LaneConfig) shares() [numPriorities]int {
+	var total int
+	for _, w := range c.Weights {
+		if w > 0 {
+			total += w
+		}
+	}
+	var out [numPriorities]int
+	for i, w := range c.Weights {
+		if w <= 0 {
+			continue
+		}
+		out[i] = c.Batch * w / total
+		if out[i] == 0 {
+			out[i] = 1
+		}
+	}
+	return out
+}
+
+// ConsumeLanes runs handler on the lanes of cfg.Subject until ctx ends.
+// Each round fetches from the lanes in priority order by their weights,
+// and a lane's unused share passes to the lanes below it, so idle
+// capacity is never wasted on an empty interactive lane. Failed messages
+// are redelivered and dead-lettered like Consume's.
+func (en *EnterpriseNATS) ConsumeLanes(ctx context.Context, cfg LaneConfig, handler func([]byte) error) error {
+	if cfg.Durable == "" || cfg.Subject == "" {
+		return fmt.Errorf("lane consumer needs a name and a subject")
+	}
+	cfg = cfg.withDefaults()
+	for p := Priority(0); p < numPriorities; p++ {
+		defer consumerLag.DeleteLabelValues(laneDurable(cfg.Durable, p))
+		defer consumerAckPending.DeleteLabelValues(laneDurable(cfg.Durable, p))
+	}
+
+	for {
+		err := en.consumeLanes(ctx, cfg, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		consumerRecreated.WithLabelValues(cfg.Durable).Inc()
+		en.logger.Warn("Lane consumers lost, rebinding",
+			zap.String("consumer", cfg.Durable), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-en.shutdownChan:
+			return nil
+		case <-time.After(consumerRetryWait):
+		}
+	}
+}
+
+func laneDurable(durable string, p Priority) string {
+	return fmt.Sprintf("%s-p%d", durable, p)
+}
+
+func (en *EnterpriseNATS) consumeLanes(ctx context.Context, cfg LaneConfig, handler func([]byte) error) error {
+	var subs [numPriorities]*nats.Subscription
+	for p := Priority(0); p < numPriorities; p++ {
+		if cfg.Weights[p] <= 0 {
+			continue
+		}
+		lane := ConsumerConfig{
+			Durable: laneDurable(cfg.Durable, p),
+			Subject: PrioritySubject(cfg.Subject, p),
+			AckWait: cfg.AckWait,
+		}
+		stream, err := en.ensureConsumer(lane)
+		if err != nil {
+			return err
+		}
+		sub, err := en.js.PullSubscribe(lane.Subject, lane.Durable, nats.Bind(stream, lane.Durable), nats.ManualAck())
+		if err != nil {
+			return fmt.Errorf("pull subscribe failed: %w", err)
+		}
+		defer sub.Unsubscribe()
+		subs[p] = sub
+	}
+
+	shares := cfg.shares()
+	var lastLag time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-en.shutdownChan:
+			return nil
+		default:
+		}
+
+		carry := 0
+		for p, sub := range subs {
+			if sub == nil {
+				continue
+			}
+			want := shares[p] + carry
+			fetchCtx, cancel := context.WithTimeout(ctx, laneProbeWait)
+			msgs, err := sub.Fetch(want, nats.Context(fetchCtx))
+			cancel()
+			switch {
+			case err == nil, errors.Is(err, context.DeadlineExceeded), errors.Is(err, nats.ErrTimeout):
+			case errors.Is(err, nats.ErrConsumerDeleted), errors.Is(err, nats.ErrConsumerNotFound),
+				errors.Is(err, nats.ErrStreamNotFound), errors.Is(err, nats.ErrBadSubscription),
+				errors.Is(err, nats.ErrConnectionClosed):
+				return err
+			default:
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				en.logger.Warn("Lane fetch failed", zap.String("consumer", cfg.Durable),
+					zap.Int("lane", p), zap.Error(err))
+			}
+			carry = want - len(msgs)
+			if len(msgs) > 0 {
+				laneFetched.WithLabelValues(cfg.Subject, fmt.Sprintf("p%d", p)).Add(float64(len(msgs)))
+			}
+			for _, msg := range msgs {
+				en.handle(msg.Subject, msg, handler)
+			}
+		}
+
+		if time.Since(lastLag) >= consumerLagInterval {
+			lastLag = time.Now()
+			for p, sub := range subs {
+				if sub == nil {
+					continue
+				}
+				info, err := sub.ConsumerInfo()
+				if err != nil {
+					if errors.Is(err, nats.ErrConsumerNotFound) || errors.Is(err, nats.ErrStreamNotFound) {
+						return err
+					}
+					continue
+				}
+				consumerLag.WithLabelValues(laneDurable(cfg.Durable, Priority(p))).Set(float64(info.NumPending))
+				consumerAckPending.WithLabelValues(laneDurable(cfg.Durable, Priority(p))).Set(float64(info.NumAckPending))
+			}
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -17,6 +19,10 @@ import (
 	"go.uber.org/zap"
 )
 
+// maxDeliver is how many times a message is handed to a failing handler
+// before it is given up on
+const maxDeliver = 5
+
 var (
 	msgPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "Wavine_nats_messages_published_total",
@@ -34,12 +40,25 @@ var (
 	}, []string{"subject", "error"})
 )
 
+func init() {
+	prometheus.MustRegister(msgPublished, msgDelivered, msgFailed)
+}
+
 type EnterpriseNATS struct {
+	schemaHolder
+	encryptionHolder
 	conn         *nats.Conn
 	js           nats.JetStreamContext
 	cfg          Config
 	logger       *zap.Logger
+	window       *publishWindow
 	shutdownChan chan struct{}
+
+	// active counts every running handler; subs holds live push
+	// subscriptions so Shutdown can stop their deliveries first
+	active handlerTracker
+	subsMu sync.Mutex
+	subs   map[*natsSubscription]struct{}
 }
 
 type Config struct {
@@ -49,9 +68,39 @@ type Config struct {
 	NKeySeed     string
 	StreamConfig *nats.StreamConfig
 	MaxReconnect int
+	// MaxPending caps async publishes awaiting their ack; 256 by default.
+	// The effective window adapts below it as acks slow down.
+	MaxPending int
+	// CredsFile holds user credentials for AuthMethod "creds", e.g. from
+	// CredentialIssuer.MintAgentCredentials
+	CredsFile string
+	// InboxPrefix replaces _INBOX for reply subjects; scoped agent
+	// credentials require AgentInboxPrefix
+	InboxPrefix string
+	// TenantID confines the connection to one tenant's namespace, as the
+	// credentials MintAgentCredentials issues do on the server: publishes
+	// and subscriptions outside it are refused before they are sent
+	TenantID string
+	// CloudEvents, when set, wraps every published event in a CloudEvents
+	// 1.0 envelope so external consumers can read the stream as is
+	CloudEvents *CloudEventsConfig
+	// ShutdownTimeout bounds how long Shutdown waits for running handlers
+	// and unflushed publishes; 30s by default
+	ShutdownTimeout time.Duration
+	// DeadLetterMaxAge is how long messages that exhausted their
+	// deliveries stay in the DLQ; 14 days by default
+	DeadLetterMaxAge time.Duration
+
+	// GetClientCertificate, when set, supplies the mTLS client certificate on
+	// every (re)connect so rotated certificates apply without a restart
+	GetClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
 }
 
 func NewEnterpriseNATS(cfg Config, logger *zap.Logger) (*EnterpriseNATS, error) {
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = defaultShutdownTimeout
+	}
+	shutdownChan := make(chan struct{})
 	opts := []nats.Option{
 		nats.MaxReconnects(cfg.MaxReconnect),
 		nats.ReconnectWait(2*time.Second),
@@ -59,12 +108,28 @@ func NewEnterpriseNATS(cfg Config, logger *zap.Logger) (*EnterpriseNATS, error)
 			logger.Warn("NATS connection lost", zap.Error(err))
 		}),
 		nats.ClosedHandler(func(c *nats.Conn) {
+			select {
+			case <-shutdownChan:
+				// closed by Shutdown
+				return
+			default:
+			}
 			logger.Fatal("NATS connection permanently closed")
 		}),
+		nats.DrainTimeout(cfg.ShutdownTimeout),
 	}
 
-	if cfg.TLSConfig != nil {
-		opts = append(opts, nats.Secure(cfg.TLSConfig))
+	// the connection and its JetStream context share this TLS config, so a
+	// certificate source applies to both even without a base config
+	if cfg.TLSConfig != nil || cfg.GetClientCertificate != nil {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.TLSConfig != nil {
+			tlsConfig = cfg.TLSConfig.Clone()
+		}
+		if cfg.GetClientCertificate != nil {
+			tlsConfig.GetClientCertificate = cfg.GetClientCertificate
+		}
+		opts = append(opts, nats.Secure(tlsConfig))
 	}
 
 	switch cfg.AuthMethod {
@@ -75,7 +140,14 @@ func NewEnterpriseNATS(cfg Config, logger *zap.Logger) (*EnterpriseNATS, error)
 		}
 		opts = append(opts, nats.NkeyFromKeyPair(kp))
 	case "tls":
-		opts = append(opts, nats.ClientCert("", ""))
+		if cfg.GetClientCertificate == nil {
+			opts = append(opts, nats.ClientCert("", ""))
+		}
+	case "creds":
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	}
+	if cfg.InboxPrefix != "" {
+		opts = append(opts, nats.CustomInboxPrefix(cfg.InboxPrefix))
 	}
 
 	conn, err := nats.Connect(strings.Join(cfg.URLs, ","), opts...)
@@ -83,7 +155,10 @@ func NewEnterpriseNATS(cfg Config, logger *zap.Logger) (*EnterpriseNATS, error)
 		return nil, fmt.Errorf("connection failed: %w", err)
 	}
 
-	js, err := conn.JetStream(nats.PublishAsyncMaxPending(256))
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = defaultMaxPending
+	}
+	js, err := conn.JetStream(nats.PublishAsyncMaxPending(cfg.MaxPending))
 	if err != nil {
 		return nil, fmt.Errorf("jetstream init failed: %w", err)
 	}
@@ -93,7 +168,9 @@ func NewEnterpriseNATS(cfg Config, logger *zap.Logger) (*EnterpriseNATS, error)
 		js:           js,
 		cfg:          cfg,
 		logger:       logger,
-		shutdownChan: make(chan struct{}),
+		window:       newPublishWindow(cfg.MaxPending),
+		shutdownChan: shutdownChan,
+		subs:         make(map[*natsSubscription]struct{}),
 	}
 
 	if cfg.StreamConfig != nil {
@@ -101,8 +178,10 @@ func NewEnterpriseNATS(cfg Config, logger *zap.Logger) (*EnterpriseNATS, error)
 			return nil, err
 		}
 	}
+	if err := en.ensureDeadLetterStream(); err != nil {
+		return nil, err
+	}
 
-	prometheus.MustRegister(msgPublished, msgDelivered, msgFailed)
 	return en, nil
 }
 
@@ -119,16 +198,42 @@ func (en *EnterpriseNATS) ensureStream() error {
 	return err
 }
 
+// Publish sends payload asynchronously. When the async window is full it
+// publishes synchronously instead, blocking until the ack arrives or ctx
+// ends with ErrBackpressure.
 func (en *EnterpriseNATS) Publish(ctx context.Context, subject string, payload interface{}) error {
+	if err := authorizePublish(en.confine(ctx), subject); err != nil {
+		return err
+	}
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("marshal failed: %w", err)
 	}
 
+	if err := en.validatePayload(ctx, subject, data); err != nil {
+		msgFailed.WithLabelValues(subject, "schema_violation").Inc()
+		return err
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	if err := en.wrapEvent(ctx, msg, ""); err != nil {
+		return err
+	}
+	if err := en.sealMsg(msg); err != nil {
+		msgFailed.WithLabelValues(subject, "encrypt_error").Inc()
+		return err
+	}
+
 	msgPublished.WithLabelValues(subject).Inc()
 
-	ack, err := en.js.PublishAsync(subject, data)
+	if !en.window.tryAcquire() {
+		publishBackpressure.WithLabelValues(subject, "sync_fallback").Inc()
+		return en.publishSync(ctx, msg)
+	}
+	ack, err := en.js.PublishMsgAsync(msg)
 	if err != nil {
+		en.window.release(false)
 		msgFailed.WithLabelValues(subject, "publish_error").Inc()
 		return fmt.Errorf("publish failed: %w", err)
 	}
@@ -137,30 +242,89 @@ func (en *EnterpriseNATS) Publish(ctx context.Context, subject string, payload i
 	return nil
 }
 
-func (en *EnterpriseNATS) Subscribe(subject string, handler func([]byte) error) error {
-	_, err := en.js.Subscribe(subject, func(msg *nats.Msg) {
-		if err := handler(msg.Data); err != nil {
-			msgFailed.WithLabelValues(subject, "handler_error").Inc()
-			_ = msg.Nak()
+// Subscribe runs handler on every message of subject until the returned
+// subscription is unsubscribed or drained, or the connection shuts down
+func (en *EnterpriseNATS) Subscribe(subject string, handler func([]byte) error) (Subscription, error) {
+	return en.SubscribeSubject(subject, func(_ string, data []byte) error { return handler(data) })
+}
+
+// SubscribeSubject is Subscribe for wildcard subjects whose handler needs
+// the subject each message arrived on. Publishers are held to their
+// subjects by their credentials, so the subject identifies the sender
+// where the payload cannot.
+func (en *EnterpriseNATS) SubscribeSubject(subject string, handler func(subject string, data []byte) error) (Subscription, error) {
+	if err := en.authorizeSubscribe(subject); err != nil {
+		return nil, err
+	}
+	s := &natsSubscription{en: en}
+	sub, err := en.js.Subscribe(subject, func(msg *nats.Msg) {
+		s.active.start()
+		defer s.active.done()
+		en.handle(subject, msg, handler)
+	}, nats.ManualAck(), nats.MaxDeliver(maxDeliver))
+	if err != nil {
+		return nil, err
+	}
+	s.sub = sub
+
+	en.subsMu.Lock()
+	en.subs[s] = struct{}{}
+	en.subsMu.Unlock()
+	return s, nil
+}
+
+func (en *EnterpriseNATS) forget(s *natsSubscription) {
+	en.subsMu.Lock()
+	delete(en.subs, s)
+	en.subsMu.Unlock()
+}
+
+// handle runs handler on a JetStream message and acknowledges it, moving
+// it to the DLQ once its last delivery fails. A payload that cannot be
+// decrypted or decoded is dead-lettered at once, since redelivery cannot fix it.
+func (en *EnterpriseNATS) handle(subject string, msg *nats.Msg, handler func(string, []byte) error) {
+	en.active.start()
+	defer en.active.done()
+	data, err := en.receivePayload(msg)
+	if err != nil {
+		msgFailed.WithLabelValues(subject, "payload_error").Inc()
+		if meta, merr := msg.Metadata(); merr == nil {
+			en.deadLetter(msg, meta, err)
 			return
 		}
-		msgDelivered.WithLabelValues(subject).Inc()
-		_ = msg.Ack()
-	}, nats.ManualAck(), nats.MaxDeliver(5))
-	
-	return err
+		_ = msg.Term()
+		return
+	}
+	if err := handler(msg.Subject, data); err != nil {
+		msgFailed.WithLabelValues(subject, "handler_error").Inc()
+		if meta, merr := msg.Metadata(); merr == nil && meta.NumDelivered >= maxDeliver {
+			en.deadLetter(msg, meta, err)
+			return
+		}
+		_ = msg.Nak()
+		return
+	}
+	msgDelivered.WithLabelValues(subject).Inc()
+	_ = msg.Ack()
 }
 
 func (en *EnterpriseNATS) trackAck(ack nats.PubAckFuture, subject string) {
 	select {
-	case <-ack.Ok():
+	case pa := <-ack.Ok():
+		en.window.release(true)
+		if pa.Duplicate {
+			msgDuplicates.WithLabelValues(subject, "publish").Inc()
+			return
+		}
 		msgDelivered.WithLabelValues(subject).Inc()
 	case err := <-ack.Err():
+		en.window.release(false)
 		msgFailed.WithLabelValues(subject, "nack_error").Inc()
 		en.logger.Error("Message rejected", 
 			zap.String("subject", subject),
 			zap.Error(err))
-	case <-time.After(30 * time.Second):
+	case <-time.After(ackTimeout):
+		en.window.release(false)
 		msgFailed.WithLabelValues(subject, "ack_timeout").Inc()
 		en.logger.Error("Ack timeout",
 			zap.String("subject", subject))
@@ -175,18 +339,40 @@ func (en *EnterpriseNATS) Run() {
 	en.Shutdown()
 }
 
+// Shutdown stops deliveries, waits up to Config.ShutdownTimeout for
+// running handlers and unflushed publishes, then closes the connection
 func (en *EnterpriseNATS) Shutdown() {
 	en.logger.Info("Initiating graceful shutdown")
 	close(en.shutdownChan)
+	ctx, cancel := context.WithTimeout(context.Background(), en.cfg.ShutdownTimeout)
+	defer cancel()
+
+	// stopping deliveries first gives the wait below an end
+	en.subsMu.Lock()
+	for s := range en.subs {
+		if err := s.sub.Drain(); err != nil {
+			en.logger.Warn("Subscription drain failed", zap.String("subject", s.sub.Subject), zap.Error(err))
+		}
+	}
+	en.subsMu.Unlock()
+	if err := en.active.wait(ctx); err != nil {
+		en.logger.Warn("Shutdown deadline passed with handlers still running",
+			zap.Int("handlers", en.active.running()))
+	}
 
 	if !en.conn.IsClosed() {
 		if err := en.conn.Drain(); err != nil {
 			en.logger.Error("Drain failed", zap.Error(err))
 		}
+		ticker := time.NewTicker(drainPollInterval)
+		defer ticker.Stop()
+		for !en.conn.IsClosed() && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+			}
+		}
 	}
 
 	en.conn.Close()
-	prometheus.Unregister(msgPublished)
-	prometheus.Unregister(msgDelivered)
-	prometheus.Unregister(msgFailed)
 }
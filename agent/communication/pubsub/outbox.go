@@ -0,0 +1,218 @@
+// outbox.go - Transactional Outbox Relay
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultOutboxBatch     = 100
+	defaultOutboxInterval  = 500 * time.Millisecond
+	defaultOutboxRetention = 24 * time.Hour
+	outboxCleanupInterval  = 10 * time.Minute
+	// outboxPublishTimeout caps the retries for one row so an unreachable
+	// stream releases the batch's row locks instead of holding them
+	outboxPublishTimeout = 30 * time.Second
+)
+
+var (
+	outboxRelayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_outbox_messages_relayed_total",
+		Help: "Outbox rows published to JetStream, by outcome",
+	}, []string{"subject", "outcome"})
+
+	outboxBacklog = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "Wavine_outbox_unpublished_messages",
+		Help: "Outbox rows written but not yet published",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(outboxRelayed, outboxBacklog)
+}
+
+// OutboxConfig tunes the relay
+type OutboxConfig struct {
+	// Batch is how many rows one pass publishes; 100 by default
+	Batch int
+	// Interval is the pause between passes that found nothing; 500ms by
+	// default
+	Interval time.Duration
+	// Retention is how long published rows are kept for inspection; one
+	// day by default
+	Retention time.Duration
+}
+
+func (c OutboxConfig) withDefaults() OutboxConfig {
+	if c.Batch <= 0 {
+		c.Batch = defaultOutboxBatch
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultOutboxInterval
+	}
+	if c.Retention <= 0 {
+		c.Retention = defaultOutboxRetention
+	}
+	return c
+}
+
+// OutboxRelay publishes rows of the outbox table to JetStream. Writers
+// insert (subject, payload) rows in the same transaction as the change
+// they announce, as agent events and memory writes do, so an event is
+// published if and only if its transaction commits.
+//
+// Each row is published with "outbox:<id>" as its message ID and marked
+// in the same transaction that locked it, so a relay that crashes after
+// publishing republishes the row under the same ID and the stream drops
+// the copy. That holds while the stream's Duplicates window is longer
+// than a relay takes to recover. Relays on several replicas split the
+// rows between them.
+//
+// Delivery is at least once but not ordered: replicas publish their
+// batches concurrently, and ids are drawn before their transactions
+// commit, so a row can become visible after a later id was published.
+// Consumers that need order must carry it in the payload, e.g. the
+// record version of a memory event.
+type OutboxRelay struct {
+	db     *sqlx.DB
+	en     *EnterpriseNATS
+	cfg    OutboxConfig
+	logger *zap.Logger
+}
+
+func NewOutboxRelay(db *sqlx.DB, en *EnterpriseNATS, cfg OutboxConfig, logger *zap.Logger) *OutboxRelay {
+	return &OutboxRelay{db: db, en: en, cfg: cfg.withDefaults(), logger: logger}
+}
+
+type outboxRow struct {
+	ID      int64           `db:"id"`
+	Subject string          `db:"subject"`
+	Payload json.RawMessage `db:"payload"`
+}
+
+// Run relays until ctx ends
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	var lastCleanup time.Time
+	for {
+		n, err := r.relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Warn("Outbox relay pass failed", zap.Error(err))
+		}
+
+		if time.Since(lastCleanup) >= outboxCleanupInterval {
+			lastCleanup = time.Now()
+			r.cleanup(ctx)
+		}
+
+		if n == r.cfg.Batch && err == nil {
+			// more rows are likely waiting
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.en.shutdownChan:
+			return nil
+		case <-time.After(r.cfg.Interval):
+		}
+	}
+}
+
+// relay publishes one batch and returns how many rows it published
+func (r *OutboxRelay) relay(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var rows []outboxRow
+	if err := tx.SelectContext(ctx, &rows,
+		`SELECT id, subject, payload FROM outbox
+		 WHERE published_at IS NULL
+		 ORDER BY id
+		 LIMIT $1
+		 FOR UPDATE SKIP LOCKED`, r.cfg.Batch); err != nil {
+		return 0, fmt.Errorf("outbox query failed: %w", err)
+	}
+
+	published := 0
+	for _, row := range rows {
+		pubCtx, cancel := context.WithTimeout(ctx, outboxPublishTimeout)
+		err := r.en.PublishOnce(pubCtx, row.Subject, "outbox:"+strconv.FormatInt(row.ID, 10), row.Payload)
+		cancel()
+		if err != nil {
+			outboxRelayed.WithLabelValues(row.Subject, "error").Inc()
+			// later rows wait for the next pass rather than racing ahead
+			// of a row that is still failing
+			err = fmt.Errorf("outbox row %d: %w", row.ID, err)
+			if published > 0 {
+				if cerr := r.markPublished(ctx, tx, rows[:published]); cerr != nil {
+					return 0, cerr
+				}
+			}
+			return published, err
+		}
+		outboxRelayed.WithLabelValues(row.Subject, "published").Inc()
+		published++
+	}
+	if published > 0 {
+		if err := r.markPublished(ctx, tx, rows); err != nil {
+			return 0, err
+		}
+	}
+
+	var backlog int64
+	if err := r.db.GetContext(ctx, &backlog,
+		`SELECT COUNT(*) FROM outbox WHERE published_at IS NULL`); err == nil {
+		outboxBacklog.Set(float64(backlog))
+	}
+	return published, nil
+}
+
+func (r *OutboxRelay) markPublished(ctx context.Context, tx *sqlx.Tx, rows []outboxRow) error {
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	query, args, err := sqlx.In(`UPDATE outbox SET published_at = NOW() WHERE id IN (?)`, ids)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, tx.Rebind(query), args...); err != nil {
+		return fmt.Errorf("outbox mark failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	return nil
+}
+
+// cleanup removes rows published longer ago than the retention
+func (r *OutboxRelay) cleanup(ctx context.Context) {
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM outbox WHERE published_at < $1`,
+		time.Now().Add(-r.cfg.Retention)); err != nil && ctx.Err() == nil {
+		r.logger.Warn("Outbox cleanup failed", zap.Error(err))
+	}
+}
+
+/*
+CREATE TABLE IF NOT EXISTS outbox (
+    id           BIGSERIAL PRIMARY KEY,
+    subject      VARCHAR(255) NOT NULL,
+    payload      JSONB NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox (id) WHERE published_at IS NULL;
+*/
@@ -0,0 +1,131 @@
+// replay.go - Historical Replay from JetStream
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+var replayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_nats_messages_replayed_total",
+	Help: "Historical messages handed to replay subscribers",
+}, []string{"subject"})
+
+func init() {
+	prometheus.MustRegister(replayed)
+}
+
+// ReplayOptions choose where a replay starts and how fast it runs. With
+// neither FromSeq nor FromTime the whole retained history is replayed.
+type ReplayOptions struct {
+	// FromSeq is the first stream sequence to deliver
+	FromSeq uint64
+	// FromTime delivers messages stored at or after it; ignored when
+	// FromSeq is set
+	FromTime time.Time
+	// Rate caps messages per second handed to the handler; zero is
+	// unlimited
+	Rate float64
+	// Burst lets that many messages through at once before Rate applies;
+	// defaults to 1
+	Burst int
+	// StopAtEnd ends the replay once it has caught up instead of going on
+	// with live messages, for jobs that only rebuild state
+	StopAtEnd bool
+}
+
+// ReplaySubscribe hands subject's history to handler in stream order,
+// from the position in opts, then keeps delivering new messages until ctx
+// ends. A failing handler is retried up to maxDeliver times before the
+// message is skipped, so one bad record cannot stall a rebuild.
+func (en *EnterpriseNATS) ReplaySubscribe(ctx context.Context, subject string, opts ReplayOptions, handler func([]byte) error) error {
+	start := nats.DeliverAll()
+	switch {
+	case opts.FromSeq > 0:
+		start = nats.StartSequence(opts.FromSeq)
+	case !opts.FromTime.IsZero():
+		start = nats.StartTime(opts.FromTime)
+	}
+	sub, err := en.js.SubscribeSync(subject, nats.OrderedConsumer(), start)
+	if err != nil {
+		return fmt.Errorf("replay subscribe failed: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	limit := rate.Inf
+	if opts.Rate > 0 {
+		limit = rate.Limit(opts.Rate)
+	}
+	burst := opts.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+	limiter := rate.NewLimiter(limit, burst)
+
+	if opts.StopAtEnd {
+		// nothing would ever arrive to say an empty history has ended
+		if info, err := sub.ConsumerInfo(); err == nil && info.NumPending == 0 && info.Delivered.Stream == 0 {
+			return nil
+		}
+	}
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("replay of %s interrupted: %w", subject, err)
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		en.replay(ctx, subject, msg, handler)
+
+		if opts.StopAtEnd {
+			if meta, err := msg.Metadata(); err == nil && meta.NumPending == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+func (en *EnterpriseNATS) replay(ctx context.Context, subject string, msg *nats.Msg, handler func([]byte) error) {
+	en.active.start()
+	defer en.active.done()
+	data, err := en.receivePayload(msg)
+	if err != nil {
+		msgFailed.WithLabelValues(subject, "payload_error").Inc()
+		en.logger.Error("Skipping message the replay cannot read",
+			zap.String("subject", msg.Subject), zap.Error(err))
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		err := handler(data)
+		if err == nil {
+			replayed.WithLabelValues(subject).Inc()
+			return
+		}
+		msgFailed.WithLabelValues(subject, "replay_handler_error").Inc()
+		if attempt >= maxDeliver {
+			var seq uint64
+			if meta, merr := msg.Metadata(); merr == nil {
+				seq = meta.Sequence.Stream
+			}
+			en.logger.Error("Skipping message the replay handler keeps rejecting",
+				zap.String("subject", msg.Subject), zap.Uint64("seq", seq), zap.Error(err))
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+}
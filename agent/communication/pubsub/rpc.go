@@ -0,0 +1,244 @@
+// rpc.go - Request-Reply Helpers over Core NATS
+package messaging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultRequestTimeout applies to requests whose context has no
+	// deadline
+	defaultRequestTimeout = 10 * time.Second
+
+	hdrCorrelationID = "Correlation-Id"
+	// hdrDeadline carries the caller's deadline so responders stop
+	// working on requests nobody is waiting for
+	hdrDeadline = "Deadline"
+)
+
+// Error codes set by the helpers; handlers may return an *RPCError with
+// their own
+const (
+	CodeHandlerError     = "handler_error"
+	CodeDeadlineExceeded = "deadline_exceeded"
+)
+
+var rpcCalls = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "Wavine_nats_rpc_duration_seconds",
+	Help:    "Request-reply round trips by subject and outcome",
+	Buckets: prometheus.DefBuckets,
+}, []string{"subject", "outcome"})
+
+func init() {
+	prometheus.MustRegister(rpcCalls)
+}
+
+var tracer = otel.Tracer("messaging")
+
+// RPCError is the error envelope of a failed request. Handlers return one
+// to choose the code the caller sees.
+type RPCError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// rpcReply is the body of every reply
+type rpcReply struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RPCError       `json:"error,omitempty"`
+}
+
+// RPCHandler serves one request; its result is JSON encoded into the reply
+type RPCHandler func(ctx context.Context, data []byte) (interface{}, error)
+
+// Request sends payload on subject and decodes the reply's result into
+// out, which may be nil. It waits until ctx ends, or ten seconds when ctx
+// has no deadline. A responder's failure comes back as an *RPCError.
+func (en *EnterpriseNATS) Request(ctx context.Context, subject string, payload, out interface{}) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		defer cancel()
+	}
+	ctx, span := tracer.Start(ctx, "nats.request "+subject,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "nats"),
+			attribute.String("messaging.destination.name", subject),
+		))
+	defer span.End()
+
+	started := time.Now()
+	err := en.request(ctx, subject, payload, out)
+	outcome := "ok"
+	var rpcErr *RPCError
+	switch {
+	case errors.As(err, &rpcErr):
+		outcome = rpcErr.Code
+	case errors.Is(err, nats.ErrNoResponders):
+		outcome = "no_responders"
+	case errors.Is(err, context.DeadlineExceeded):
+		outcome = "timeout"
+	case err != nil:
+		outcome = "error"
+	}
+	rpcCalls.WithLabelValues(subject, outcome).Observe(time.Since(started).Seconds())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, outcome)
+	}
+	return err
+}
+
+func (en *EnterpriseNATS) request(ctx context.Context, subject string, payload, out interface{}) error {
+	if err := authorizePublish(en.confine(ctx), subject); err != nil {
+		return err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+	if err := en.validatePayload(ctx, subject, data); err != nil {
+		return err
+	}
+	id, err := correlationID()
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set(hdrCorrelationID, id)
+	deadline, _ := ctx.Deadline()
+	msg.Header.Set(hdrDeadline, deadline.UTC().Format(time.RFC3339Nano))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(http.Header(msg.Header)))
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("messaging.message.conversation_id", id))
+	if err := en.sealMsg(msg); err != nil {
+		return err
+	}
+
+	resp, err := en.conn.RequestMsgWithContext(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", subject, err)
+	}
+	if got := resp.Header.Get(hdrCorrelationID); got != "" && got != id {
+		return fmt.Errorf("reply correlation mismatch: sent %s, got %s", id, got)
+	}
+	var reply rpcReply
+	if err := json.Unmarshal(resp.Data, &reply); err != nil {
+		return fmt.Errorf("malformed reply from %s: %w", subject, err)
+	}
+	if reply.Error != nil {
+		return reply.Error
+	}
+	if out != nil && len(reply.Result) > 0 {
+		if err := json.Unmarshal(reply.Result, out); err != nil {
+			return fmt.Errorf("reply decode failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Respond serves requests on subject with handler. Responders sharing a
+// non-empty queue split the requests between them. Each handler runs
+// under the caller's deadline and trace.
+func (en *EnterpriseNATS) Respond(subject, queue string, handler RPCHandler) error {
+	_, err := en.conn.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
+		en.serveRequest(subject, msg, handler)
+	})
+	if err != nil {
+		return fmt.Errorf("responder subscribe failed: %w", err)
+	}
+	return nil
+}
+
+func (en *EnterpriseNATS) serveRequest(subject string, msg *nats.Msg, handler RPCHandler) {
+	en.active.start()
+	defer en.active.done()
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(),
+		propagation.HeaderCarrier(http.Header(msg.Header)))
+	id := msg.Header.Get(hdrCorrelationID)
+	ctx, span := tracer.Start(ctx, "nats.respond "+subject,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "nats"),
+			attribute.String("messaging.destination.name", subject),
+			attribute.String("messaging.message.conversation_id", id),
+		))
+	defer span.End()
+
+	if v := msg.Header.Get(hdrDeadline); v != "" {
+		if deadline, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+	}
+
+	var reply rpcReply
+	request, err := en.receivePayload(msg)
+	if err != nil {
+		reply.Error = &RPCError{Code: CodeHandlerError, Message: err.Error()}
+	} else if ctx.Err() != nil {
+		reply.Error = &RPCError{Code: CodeDeadlineExceeded, Message: "request expired before it was served"}
+	} else if result, err := handler(ctx, request); err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: CodeHandlerError, Message: err.Error()}
+			if errors.Is(err, context.DeadlineExceeded) {
+				rpcErr.Code = CodeDeadlineExceeded
+			}
+		}
+		reply.Error = rpcErr
+	} else if reply.Result, err = json.Marshal(result); err != nil {
+		reply.Error = &RPCError{Code: CodeHandlerError, Message: "result encode failed: " + err.Error()}
+	}
+	if reply.Error != nil {
+		span.SetStatus(codes.Error, reply.Error.Code)
+	}
+
+	if msg.Reply == "" {
+		return
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+	resp := nats.NewMsg(msg.Reply)
+	resp.Data = data
+	if id != "" {
+		resp.Header.Set(hdrCorrelationID, id)
+	}
+	if err := msg.RespondMsg(resp); err != nil {
+		en.logger.Error("Reply publish failed",
+			zap.String("subject", subject), zap.String("correlation_id", id), zap.Error(err))
+	}
+}
+
+func correlationID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("correlation ID generation failed: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
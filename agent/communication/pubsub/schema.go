@@ -0,0 +1,548 @@
+// schema.go - Subject Schema Registry and Payload Validation
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const schemaBucket = "SCHEMAS"
+
+// minSchemaRefresh bounds how often failed validations reload the store,
+// so a stream of invalid payloads cannot hammer it
+const minSchemaRefresh = 5 * time.Second
+
+var (
+	// ErrSchemaViolation is returned for payloads that do not match their
+	// subject's schema
+	ErrSchemaViolation = errors.New("payload does not match subject schema")
+	// ErrIncompatibleSchema is returned when a new version would break
+	// publishers or subscribers of the previous one
+	ErrIncompatibleSchema = errors.New("schema incompatible with previous version")
+	// ErrSchemaConflict is returned when another replica registered the
+	// same version first
+	ErrSchemaConflict = errors.New("schema version already registered")
+)
+
+// SchemaFormat names how a schema is written
+type SchemaFormat string
+
+const (
+	// FormatJSONSchema schemas are JSON Schema documents
+	FormatJSONSchema SchemaFormat = "json-schema"
+	// FormatProtobuf schemas name a registered protobuf message, e.g.
+	// "nuzon.agent.v1.AgentDefinition"; payloads are its JSON form
+	FormatProtobuf SchemaFormat = "protobuf"
+)
+
+// Compatibility says which earlier versions a new version must work with
+type Compatibility string
+
+const (
+	// CompatBackward versions accept every payload the previous version
+	// accepted, so subscribers can upgrade first. The default.
+	CompatBackward Compatibility = "backward"
+	// CompatForward versions only produce payloads the previous version
+	// accepts, so publishers can upgrade first
+	CompatForward Compatibility = "forward"
+	// CompatFull versions are both
+	CompatFull Compatibility = "full"
+	// CompatNone skips the check
+	CompatNone Compatibility = "none"
+)
+
+// SchemaVersion is one registered version of a subject's contract.
+// Subject may use the * and > wildcards.
+type SchemaVersion struct {
+	Subject       string          `json:"subject"`
+	Version       int             `json:"version"`
+	Format        SchemaFormat    `json:"format"`
+	Schema        json.RawMessage `json:"schema"`
+	Compatibility Compatibility   `json:"compatibility"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// SchemaStore persists schema versions so every replica validates against
+// the same contracts
+type SchemaStore interface {
+	LoadSchemas(ctx context.Context) ([]SchemaVersion, error)
+	// SaveSchema returns ErrSchemaConflict if the version exists
+	SaveSchema(ctx context.Context, v SchemaVersion) error
+}
+
+// compiledSchema validates payloads of one version
+type compiledSchema struct {
+	version SchemaVersion
+	check   func(data []byte) error
+}
+
+// SchemaRegistry maps subjects to versioned schemas. Brokers given one
+// refuse to publish payloads that do not match the latest version.
+type SchemaRegistry struct {
+	store SchemaStore
+
+	mu       sync.RWMutex
+	versions map[string][]compiledSchema
+	// lastRefresh is when a failed validation last reloaded the store, in
+	// Unix nanoseconds
+	lastRefresh atomic.Int64
+}
+
+// NewSchemaRegistry loads the schemas in store; a nil store keeps them in
+// this process only
+func NewSchemaRegistry(ctx context.Context, store SchemaStore) (*SchemaRegistry, error) {
+	r := &SchemaRegistry{store: store, versions: make(map[string][]compiledSchema)}
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Refresh reloads versions other replicas registered
+func (r *SchemaRegistry) Refresh(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+	stored, err := r.store.LoadSchemas(ctx)
+	if err != nil {
+		return fmt.Errorf("schema load failed: %w", err)
+	}
+	versions := make(map[string][]compiledSchema)
+	for _, v := range stored {
+		c, err := compileVersion(v)
+		if err != nil {
+			return fmt.Errorf("stored schema %s v%d: %w", v.Subject, v.Version, err)
+		}
+		versions[v.Subject] = append(versions[v.Subject], c)
+	}
+	for _, list := range versions {
+		sort.Slice(list, func(i, j int) bool { return list[i].version.Version < list[j].version.Version })
+	}
+	r.mu.Lock()
+	r.versions = versions
+	r.mu.Unlock()
+	return nil
+}
+
+// Register adds the next version of subject's schema after checking it
+// against the latest one under compat (CompatBackward when empty)
+func (r *SchemaRegistry) Register(ctx context.Context, subject string, format SchemaFormat, schema json.RawMessage, compat Compatibility) (SchemaVersion, error) {
+	if compat == "" {
+		compat = CompatBackward
+	}
+	r.mu.RLock()
+	history := r.versions[subject]
+	r.mu.RUnlock()
+
+	v := SchemaVersion{
+		Subject:       subject,
+		Version:       len(history) + 1,
+		Format:        format,
+		Schema:        schema,
+		Compatibility: compat,
+		CreatedAt:     time.Now().UTC(),
+	}
+	c, err := compileVersion(v)
+	if err != nil {
+		return SchemaVersion{}, err
+	}
+	if len(history) > 0 {
+		if err := checkCompatibility(history[len(history)-1].version, v); err != nil {
+			return SchemaVersion{}, err
+		}
+	}
+
+	if r.store != nil {
+		if err := r.store.SaveSchema(ctx, v); err != nil {
+			return SchemaVersion{}, err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.versions[subject]) != len(history) {
+		return SchemaVersion{}, fmt.Errorf("%w: %s v%d", ErrSchemaConflict, subject, v.Version)
+	}
+	r.versions[subject] = append(history, c)
+	return v, nil
+}
+
+// Versions returns every version of subject, oldest first
+func (r *SchemaRegistry) Versions(subject string) []SchemaVersion {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]SchemaVersion, 0, len(r.versions[subject]))
+	for _, c := range r.versions[subject] {
+		out = append(out, c.version)
+	}
+	return out
+}
+
+// lookup finds the latest schema governing subject: an exact
+// registration, else the matching pattern with the fewest wildcards
+func (r *SchemaRegistry) lookup(subject string) (compiledSchema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if list := r.versions[subject]; len(list) > 0 {
+		return list[len(list)-1], true
+	}
+	var (
+		best      compiledSchema
+		bestWilds = -1
+	)
+	for pattern, list := range r.versions {
+		if len(list) == 0 || !subjectMatches(pattern, subject) {
+			continue
+		}
+		wilds := strings.Count(pattern, "*") + strings.Count(pattern, ">")
+		if bestWilds < 0 || wilds < bestWilds {
+			best, bestWilds = list[len(list)-1], wilds
+		}
+	}
+	return best, bestWilds >= 0
+}
+
+// Validate checks data against the latest schema of subject. Subjects
+// without a schema accept anything.
+func (r *SchemaRegistry) Validate(ctx context.Context, subject string, data []byte) error {
+	c, ok := r.lookup(subject)
+	if !ok {
+		return nil
+	}
+	err := c.check(data)
+	if err == nil {
+		return nil
+	}
+	// another replica may have registered a newer version this payload
+	// was written for
+	if r.refreshAfterViolation(ctx) {
+		if latest, ok := r.lookup(subject); ok && latest.version.Version != c.version.Version {
+			if err = latest.check(data); err == nil {
+				return nil
+			}
+			c = latest
+		}
+	}
+	return fmt.Errorf("%w: %s v%d: %v", ErrSchemaViolation, subject, c.version.Version, err)
+}
+
+// refreshAfterViolation reloads the store at most once per
+// minSchemaRefresh across all callers, reporting whether this call did
+func (r *SchemaRegistry) refreshAfterViolation(ctx context.Context) bool {
+	if r.store == nil {
+		return false
+	}
+	now := time.Now().UnixNano()
+	last := r.lastRefresh.Load()
+	if now-last < int64(minSchemaRefresh) || !r.lastRefresh.CompareAndSwap(last, now) {
+		return false
+	}
+	return r.Refresh(ctx) == nil
+}
+
+func compileVersion(v SchemaVersion) (compiledSchema, error) {
+	switch v.Format {
+	case FormatJSONSchema:
+		c := jsonschema.NewCompiler()
+		c.Draft = jsonschema.Draft2020
+		id := v.Subject + "/v" + strconv.Itoa(v.Version)
+		if err := c.AddResource(id, bytes.NewReader(v.Schema)); err != nil {
+			return compiledSchema{}, fmt.Errorf("invalid JSON schema: %w", err)
+		}
+		schema, err := c.Compile(id)
+		if err != nil {
+			return compiledSchema{}, fmt.Errorf("invalid JSON schema: %w", err)
+		}
+		return compiledSchema{version: v, check: func(data []byte) error {
+			var doc any
+			if err := json.Unmarshal(data, &doc); err != nil {
+				return fmt.Errorf("not valid JSON: %w", err)
+			}
+			return schema.Validate(doc)
+		}}, nil
+	case FormatProtobuf:
+		mt, err := protoMessageType(v.Schema)
+		if err != nil {
+			return compiledSchema{}, err
+		}
+		return compiledSchema{version: v, check: func(data []byte) error {
+			return protojson.Unmarshal(data, mt.New().Interface())
+		}}, nil
+	default:
+		return compiledSchema{}, fmt.Errorf("unknown schema format %q", v.Format)
+	}
+}
+
+func protoMessageType(schema json.RawMessage) (protoreflect.MessageType, error) {
+	var name string
+	if err := json.Unmarshal(schema, &name); err != nil {
+		return nil, fmt.Errorf("protobuf schema must be a message name: %w", err)
+	}
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("protobuf message %s not linked in: %w", name, err)
+	}
+	return mt, nil
+}
+
+// checkCompatibility compares next with prev under next's mode
+func checkCompatibility(prev, next SchemaVersion) error {
+	if next.Compatibility == CompatNone {
+		return nil
+	}
+	if prev.Format != next.Format {
+		return fmt.Errorf("%w: format changed from %s to %s", ErrIncompatibleSchema, prev.Format, next.Format)
+	}
+	var problems []string
+	if next.Compatibility == CompatBackward || next.Compatibility == CompatFull {
+		problems = append(problems, compareSchemas(prev, next)...)
+	}
+	if next.Compatibility == CompatForward || next.Compatibility == CompatFull {
+		problems = append(problems, compareSchemas(next, prev)...)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrIncompatibleSchema, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// compareSchemas lists why reader would reject payloads writer accepts
+func compareSchemas(writer, reader SchemaVersion) []string {
+	switch writer.Format {
+	case FormatProtobuf:
+		w, werr := protoMessageType(writer.Schema)
+		r, rerr := protoMessageType(reader.Schema)
+		if werr != nil || rerr != nil {
+			return []string{"protobuf message not linked in"}
+		}
+		return compareMessages(w.Descriptor(), r.Descriptor(), "")
+	default:
+		var w, r map[string]any
+		if json.Unmarshal(writer.Schema, &w) != nil || json.Unmarshal(reader.Schema, &r) != nil {
+			return []string{"schema is not a JSON object"}
+		}
+		return compareObjects(w, r, "")
+	}
+}
+
+// compareObjects checks the parts of JSON Schema that contracts drift on:
+// types, required properties and closed property sets
+func compareObjects(writer, reader map[string]any, path string) []string {
+	var problems []string
+	if wt, rt := writer["type"], reader["type"]; rt != nil && !typesCovered(wt, rt) {
+		problems = append(problems, fmt.Sprintf("%s: type %v no longer accepts %v", pathName(path), rt, wt))
+	}
+
+	wRequired := stringSet(writer["required"])
+	for name := range stringSet(reader["required"]) {
+		if !wRequired[name] {
+			problems = append(problems, fmt.Sprintf("%s: %q became required", pathName(path), name))
+		}
+	}
+
+	wProps, _ := writer["properties"].(map[string]any)
+	rProps, _ := reader["properties"].(map[string]any)
+	closed := reader["additionalProperties"] == false
+	for name, wp := range wProps {
+		rp, ok := rProps[name]
+		if !ok {
+			if closed {
+				problems = append(problems, fmt.Sprintf("%s: %q was removed", pathName(path), name))
+			}
+			continue
+		}
+		wm, _ := wp.(map[string]any)
+		rm, _ := rp.(map[string]any)
+		if wm != nil && rm != nil {
+			problems = append(problems, compareObjects(wm, rm, path+"."+name)...)
+		}
+	}
+	if wi, ok := writer["items"].(map[string]any); ok {
+		if ri, ok := reader["items"].(map[string]any); ok {
+			problems = append(problems, compareObjects(wi, ri, path+"[]")...)
+		}
+	}
+	return problems
+}
+
+// compareMessages checks that reader decodes every field writer sends as
+// the same kind
+func compareMessages(writer, reader protoreflect.MessageDescriptor, path string) []string {
+	var problems []string
+	fields := writer.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		wf := fields.Get(i)
+		rf := reader.Fields().ByNumber(wf.Number())
+		name := path + "." + string(wf.Name())
+		switch {
+		case rf == nil:
+			problems = append(problems, fmt.Sprintf("%s: field %d was removed", name, wf.Number()))
+		case rf.Kind() != wf.Kind() || rf.Cardinality() != wf.Cardinality():
+			problems = append(problems, fmt.Sprintf("%s: field %d changed type", name, wf.Number()))
+		case wf.Kind() == protoreflect.MessageKind && wf.Message().FullName() != rf.Message().FullName():
+			problems = append(problems, compareMessages(wf.Message(), rf.Message(), name)...)
+		}
+	}
+	return problems
+}
+
+func typesCovered(writer, reader any) bool {
+	accepted := stringSet(reader)
+	if s, ok := reader.(string); ok {
+		accepted[s] = true
+	}
+	if accepted["number"] {
+		accepted["integer"] = true
+	}
+	if writer == nil {
+		// an untyped writer may send anything
+		return false
+	}
+	if s, ok := writer.(string); ok {
+		return accepted[s]
+	}
+	for t := range stringSet(writer) {
+		if !accepted[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func stringSet(v any) map[string]bool {
+	set := make(map[string]bool)
+	list, _ := v.([]any)
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			set[s] = true
+		}
+	}
+	return set
+}
+
+func pathName(path string) string {
+	if path == "" {
+		return "$"
+	}
+	return "$" + path
+}
+
+// schemaValidator is implemented by brokers that accept a registry
+type schemaValidator interface {
+	validatePayload(ctx context.Context, subject string, data []byte) error
+}
+
+// SubscribeTyped decodes each message on subject into T before calling
+// handler, after validating it when the broker has a schema registry.
+// Payloads that fail either fail like handler errors and end up in the
+// dead-letter queue.
+func SubscribeTyped[T any](b Broker, subject string, handler func(T) error) (Subscription, error) {
+	validator, _ := b.(schemaValidator)
+	return b.Subscribe(subject, func(data []byte) error {
+		if validator != nil {
+			if err := validator.validatePayload(context.Background(), subject, data); err != nil {
+				return err
+			}
+		}
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrSchemaViolation, subject, err)
+		}
+		return handler(v)
+	})
+}
+
+// schemaHolder gives a broker an optional registry
+type schemaHolder struct {
+	schemas atomic.Pointer[SchemaRegistry]
+}
+
+// SetSchemaRegistry makes Publish refuse payloads that do not match
+// their subject's schema
+func (h *schemaHolder) SetSchemaRegistry(r *SchemaRegistry) {
+	h.schemas.Store(r)
+}
+
+func (h *schemaHolder) validatePayload(ctx context.Context, subject string, data []byte) error {
+	r := h.schemas.Load()
+	if r == nil {
+		return nil
+	}
+	return r.Validate(ctx, subject, data)
+}
+
+// kvSchemaStore keeps schema versions in a JetStream key-value bucket,
+// one key per version
+type kvSchemaStore struct {
+	kv nats.KeyValue
+}
+
+// SchemaStore returns a store backed by the SCHEMAS key-value bucket,
+// creating it on first use
+func (en *EnterpriseNATS) SchemaStore() (SchemaStore, error) {
+	kv, err := en.js.KeyValue(schemaBucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = en.js.CreateKeyValue(&nats.KeyValueConfig{Bucket: schemaBucket, Storage: nats.FileStorage})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("schema bucket unavailable: %w", err)
+	}
+	return &kvSchemaStore{kv: kv}, nil
+}
+
+// schemaKey encodes the subject, since KV keys cannot hold wildcards
+func schemaKey(subject string, version int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(subject)) + ".v" + strconv.Itoa(version)
+}
+
+func (s *kvSchemaStore) LoadSchemas(ctx context.Context) ([]SchemaVersion, error) {
+	keys, err := s.kv.Keys(nats.Context(ctx))
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]SchemaVersion, 0, len(keys))
+	for _, key := range keys {
+		entry, err := s.kv.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %w", key, err)
+		}
+		var v SchemaVersion
+		if err := json.Unmarshal(entry.Value(), &v); err != nil {
+			return nil, fmt.Errorf("corrupt schema %s: %w", key, err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+func (s *kvSchemaStore) SaveSchema(ctx context.Context, v SchemaVersion) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := s.kv.Create(schemaKey(v.Subject, v.Version), data); err != nil {
+		if errors.Is(err, nats.ErrKeyExists) {
+			return fmt.Errorf("%w: %s v%d", ErrSchemaConflict, v.Subject, v.Version)
+		}
+		return fmt.Errorf("schema save failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// subscription.go - Subscription Handles and In-Flight Handler Tracking
+package messaging
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	drainPollInterval      = 50 * time.Millisecond
+)
+
+// Subscription is a live subscription returned by Subscribe. Unsubscribe
+// stops deliveries at once; Drain stops them, lets queued and running
+// handlers finish, and returns when they have or ctx ends.
+//
+// It is an alias of an interface literal so packages that do not import
+// messaging can name the same type in their own broker interfaces.
+type Subscription = interface {
+	Unsubscribe() error
+	Drain(ctx context.Context) error
+}
+
+// handlerTracker counts running handlers and lets callers wait for none.
+// Unlike sync.WaitGroup it may gain handlers while someone waits.
+type handlerTracker struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{}
+}
+
+func (t *handlerTracker) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.n == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.n++
+}
+
+func (t *handlerTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.n--
+	if t.n == 0 {
+		close(t.idle)
+	}
+}
+
+func (t *handlerTracker) running() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.n
+}
+
+// wait returns once no handler runs, or ctx's error when it ends first
+func (t *handlerTracker) wait(ctx context.Context) error {
+	t.mu.Lock()
+	if t.n == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	idle := t.idle
+	t.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// natsSubscription is the handle of a JetStream push subscription
+type natsSubscription struct {
+	en     *EnterpriseNATS
+	sub    *nats.Subscription
+	active handlerTracker
+}
+
+func (s *natsSubscription) Unsubscribe() error {
+	s.en.forget(s)
+	return s.sub.Unsubscribe()
+}
+
+func (s *natsSubscription) Drain(ctx context.Context) error {
+	s.en.forget(s)
+	if err := s.sub.Drain(); err != nil {
+		return err
+	}
+	// the client delivers what it already holds before the subscription
+	// becomes invalid
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for s.sub.IsValid() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return s.active.wait(ctx)
+}
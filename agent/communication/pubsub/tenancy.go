@@ -0,0 +1,229 @@
+// tenancy.go - Tenant Isolation by Subject Namespace and Scoped Credentials
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tenantSubjectPrefix roots subjects owned by one tenant that are not
+// about a single agent: tenants.<tenant>.…
+const tenantSubjectPrefix = "tenants."
+
+const defaultCredentialTTL = 24 * time.Hour
+
+// ErrSubjectDenied is returned when a tenant touches a subject outside
+// its namespace
+var ErrSubjectDenied = errors.New("subject outside tenant namespace")
+
+var subjectDenied = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_nats_subject_denied_total",
+	Help: "Publishes and subscriptions refused for crossing tenant namespaces",
+}, []string{"operation"})
+
+func init() {
+	prometheus.MustRegister(subjectDenied)
+}
+
+type tenantKey struct{}
+
+// WithTenant marks ctx as acting for tenantID; Publish then refuses
+// subjects outside that tenant's namespace
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant set by WithTenant, if any
+func TenantFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	return id
+}
+
+// TenantSubjects returns the namespaces tenantID owns: its agents'
+// subjects and its own tenants.<tenant> tree
+func TenantSubjects(tenantID string) []string {
+	return []string{
+		agentSubjectPrefix + tenantID + ".>",
+		tenantSubjectPrefix + tenantID + ".>",
+	}
+}
+
+// TenantSubject returns a subject in tenantID's own tree, e.g.
+// TenantSubject("acme", "tasks.progress") is tenants.acme.tasks.progress
+func TenantSubject(tenantID, subject string) string {
+	return tenantSubjectPrefix + tenantID + "." + subject
+}
+
+// checkTenantSubject reports whether tenantID may use subject, which may
+// hold wildcards
+func checkTenantSubject(tenantID, subject string) error {
+	if !validToken(tenantID) {
+		return fmt.Errorf("%w: invalid tenant %q", ErrSubjectDenied, tenantID)
+	}
+	for _, ns := range TenantSubjects(tenantID) {
+		if subjectWithin(ns, subject) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrSubjectDenied, subject)
+}
+
+// authorizePublish enforces the namespace of a tenant set on ctx
+func authorizePublish(ctx context.Context, subject string) error {
+	tenantID := TenantFromContext(ctx)
+	if tenantID == "" {
+		return nil
+	}
+	if err := checkTenantSubject(tenantID, subject); err != nil {
+		subjectDenied.WithLabelValues("publish").Inc()
+		return err
+	}
+	return nil
+}
+
+// confine marks ctx with the tenant the connection is confined to, unless
+// it already acts for one
+func (en *EnterpriseNATS) confine(ctx context.Context) context.Context {
+	if en.cfg.TenantID == "" || TenantFromContext(ctx) != "" {
+		return ctx
+	}
+	return WithTenant(ctx, en.cfg.TenantID)
+}
+
+// authorizeSubscribe enforces the namespace of the tenant the connection
+// is confined to
+func (en *EnterpriseNATS) authorizeSubscribe(subject string) error {
+	if en.cfg.TenantID == "" {
+		return nil
+	}
+	if err := checkTenantSubject(en.cfg.TenantID, subject); err != nil {
+		subjectDenied.WithLabelValues("subscribe").Inc()
+		return err
+	}
+	return nil
+}
+
+// TenantNATS is a view of the connection confined to one tenant's
+// namespace. Services acting for a tenant should use it rather than
+// EnterpriseNATS so a subject built from untrusted input cannot reach
+// another tenant's events.
+type TenantNATS struct {
+	en       *EnterpriseNATS
+	tenantID string
+}
+
+// ForTenant returns the view of en confined to tenantID
+func (en *EnterpriseNATS) ForTenant(tenantID string) (*TenantNATS, error) {
+	if !validToken(tenantID) {
+		return nil, fmt.Errorf("invalid tenant %q", tenantID)
+	}
+	return &TenantNATS{en: en, tenantID: tenantID}, nil
+}
+
+func (t *TenantNATS) Publish(ctx context.Context, subject string, payload interface{}) error {
+	return t.en.Publish(WithTenant(ctx, t.tenantID), subject, payload)
+}
+
+func (t *TenantNATS) Subscribe(subject string, handler func([]byte) error) (Subscription, error) {
+	if err := checkTenantSubject(t.tenantID, subject); err != nil {
+		subjectDenied.WithLabelValues("subscribe").Inc()
+		return nil, err
+	}
+	return t.en.Subscribe(subject, handler)
+}
+
+// CredentialIssuer mints NATS user credentials confined to one agent's
+// tenant. Tenants given their own account are fully separated by the
+// server; the rest share the platform account and are held to their
+// subject namespace by the user permissions.
+type CredentialIssuer struct {
+	platform nkeys.KeyPair
+	accounts map[string]nkeys.KeyPair
+}
+
+// NewCredentialIssuer signs with the platform account's seed, and with
+// accountSeeds[tenant] for tenants mapped to their own account
+func NewCredentialIssuer(platformSeed string, accountSeeds map[string]string) (*CredentialIssuer, error) {
+	platform, err := nkeys.FromSeed([]byte(platformSeed))
+	if err != nil {
+		return nil, fmt.Errorf("platform signing key invalid: %w", err)
+	}
+	ci := &CredentialIssuer{platform: platform, accounts: make(map[string]nkeys.KeyPair, len(accountSeeds))}
+	for tenantID, seed := range accountSeeds {
+		kp, err := nkeys.FromSeed([]byte(seed))
+		if err != nil {
+			return nil, fmt.Errorf("account key of tenant %s invalid: %w", tenantID, err)
+		}
+		ci.accounts[tenantID] = kp
+	}
+	return ci, nil
+}
+
+// AgentInboxPrefix is the reply-inbox prefix credentials minted for an
+// agent allow. AgentClient.Request waits for replies under it; other
+// requests of the connection need nats.CustomInboxPrefix set to it.
+func AgentInboxPrefix(tenantID, agentID string) string {
+	return "_INBOX." + tenantID + "." + agentID
+}
+
+// MintAgentCredentials returns a creds file for agentID valid for ttl (a
+// day when zero). The user may publish and subscribe only within its
+// tenant's namespace and its own reply inbox.
+func (ci *CredentialIssuer) MintAgentCredentials(tenantID, agentID string, ttl time.Duration) ([]byte, error) {
+	if !validToken(tenantID) || !validToken(agentID) {
+		return nil, fmt.Errorf("invalid tenant or agent ID")
+	}
+	if ttl <= 0 {
+		ttl = defaultCredentialTTL
+	}
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		return nil, fmt.Errorf("user key generation failed: %w", err)
+	}
+	userPub, err := user.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	userSeed, err := user.Seed()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.NewUserClaims(userPub)
+	claims.Name = tenantID + "/" + agentID
+	claims.Expires = time.Now().Add(ttl).Unix()
+	claims.Tags.Add("tenant:"+tenantID, "agent:"+agentID)
+
+	inbox := AgentInboxPrefix(tenantID, agentID) + ".>"
+	claims.Sub.Allow.Add(inbox)
+	claims.Pub.Allow.Add(inbox)
+	signer, own := ci.accounts[tenantID]
+	if own {
+		// the account boundary already isolates the tenant
+		claims.Pub.Allow.Add(">")
+		claims.Sub.Allow.Add(">")
+	} else {
+		signer = ci.platform
+		for _, ns := range TenantSubjects(tenantID) {
+			claims.Pub.Allow.Add(ns)
+			claims.Sub.Allow.Add(ns)
+		}
+		// replies to requests the agent serves go to the caller's inbox
+		claims.Resp = &jwt.ResponsePermission{MaxMsgs: 1, Expires: time.Minute}
+	}
+	token, err := claims.Encode(signer)
+	if err != nil {
+		return nil, fmt.Errorf("user JWT signing failed: %w", err)
+	}
+	creds, err := jwt.FormatUserConfig(token, userSeed)
+	if err != nil {
+		return nil, fmt.Errorf("creds formatting failed: %w", err)
+	}
+	return creds, nil
+}
@@ -24,6 +24,9 @@ const (
 	StateDegraded
 	StateMaintenance
 	StateTerminating
+	// StateSuspended freezes a component without tearing it down; it keeps
+	// its in-flight context and resumes where it stopped
+	StateSuspended
 )
 
 var stateStrings = map[State]string{
@@ -33,6 +36,7 @@ var stateStrings = map[State]string{
 	StateDegraded:    "DEGRADED",
 	StateMaintenance: "MAINTENANCE",
 	StateTerminating: "TERMINATING",
+	StateSuspended:   "SUSPENDED",
 }
 
 // LifecycleManager coordinates distributed state transitions
@@ -125,6 +129,23 @@ func (lm *LifecycleManager) Transition(ctx context.Context, newState State, reas
 	return nil
 }
 
+// Suspend freezes the component, remembering the state Resume returns to
+func (lm *LifecycleManager) Suspend(ctx context.Context, reason string) error {
+	return lm.Transition(ctx, StateSuspended, reason)
+}
+
+// Resume returns a suspended component to the state it was suspended from
+func (lm *LifecycleManager) Resume(ctx context.Context, reason string) error {
+	lm.mu.RLock()
+	current, previous := lm.currentState, lm.previousState
+	lm.mu.RUnlock()
+
+	if current != StateSuspended {
+		return fmt.Errorf("cannot resume from %s", stateStrings[current])
+	}
+	return lm.Transition(ctx, previous, reason)
+}
+
 // Shutdown performs graceful termination sequence
 func (lm *LifecycleManager) Shutdown(ctx context.Context) error {
 	ctx, span := lm.tracer.Start(ctx, "LifecycleManager.Shutdown")
@@ -179,10 +200,11 @@ func validTransition(from, to State) bool {
 	transitionMatrix := map[State][]State{
 		StateBooting:     {StateConfiguring, StateTerminating},
 		StateConfiguring: {StateHealthy, StateDegraded},
-		StateHealthy:     {StateDegraded, StateMaintenance},
-		StateDegraded:    {StateHealthy, StateMaintenance},
-		StateMaintenance: {StateHealthy, StateTerminating},
+		StateHealthy:     {StateDegraded, StateMaintenance, StateSuspended},
+		StateDegraded:    {StateHealthy, StateMaintenance, StateSuspended},
+		StateMaintenance: {StateHealthy, StateTerminating, StateSuspended},
 		StateTerminating: {},
+		StateSuspended:   {StateHealthy, StateDegraded, StateMaintenance, StateTerminating},
 	}
 	for _, valid := range transitionMatrix[from] {
 		if to == valid {
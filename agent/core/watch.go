@@ -0,0 +1,208 @@
+// watch.go - State Transition Feed
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"go.uber.org/zap"
+)
+
+// transitionKey holds the latest transition; its etcd revision history is
+// the transition feed
+const transitionKey = "nuzon/state/transitions"
+
+// ErrCompacted is returned when the requested revision is older than the
+// history etcd retains; callers resync from Current
+var ErrCompacted = errors.New("transition history compacted")
+
+func (s State) String() string {
+	if name, ok := stateStrings[s]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+func parseState(name string) (State, error) {
+	for s, n := range stateStrings {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown state %q", name)
+}
+
+func (t StateTransition) String() string {
+	return t.From.String() + "->" + t.To.String()
+}
+
+// transitionRecord is the stored form of a StateTransition; states are
+// kept by name so renumbering the enum cannot corrupt history
+type transitionRecord struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Timestamp time.Time `json:"timestamp"`
+	Reason    string    `json:"reason"`
+}
+
+// TransitionEvent is a transition delivered by Watch. Revision orders
+// events and resumes a watch after it; Err is set on the final event of a
+// watch that failed.
+type TransitionEvent struct {
+	StateTransition
+	Revision int64
+	Err      error
+}
+
+func (lm *LifecycleManager) persistTransition(ctx context.Context, t StateTransition) error {
+	data, err := json.Marshal(transitionRecord{
+		From:      t.From.String(),
+		To:        t.To.String(),
+		Timestamp: t.Timestamp,
+		Reason:    t.Reason,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = lm.etcdClient.Put(ctx, transitionKey, string(data))
+	return err
+}
+
+func decodeTransition(data []byte, revision int64) (TransitionEvent, error) {
+	var rec transitionRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return TransitionEvent{}, fmt.Errorf("corrupt transition at revision %d: %v", revision, err)
+	}
+	from, err := parseState(rec.From)
+	if err != nil {
+		return TransitionEvent{}, err
+	}
+	to, err := parseState(rec.To)
+	if err != nil {
+		return TransitionEvent{}, err
+	}
+	return TransitionEvent{
+		StateTransition: StateTransition{From: from, To: to, Timestamp: rec.Timestamp, Reason: rec.Reason},
+		Revision:        revision,
+	}, nil
+}
+
+// Current returns the latest transition. Watching from its Revision+1
+// misses nothing that follows it.
+func (lm *LifecycleManager) Current(ctx context.Context) (TransitionEvent, error) {
+	resp, err := lm.etcdClient.Get(ctx, transitionKey)
+	if err != nil {
+		return TransitionEvent{}, fmt.Errorf("transition read failed: %v", err)
+	}
+	if len(resp.Kvs) == 0 {
+		// nothing recorded yet; watch from the next revision
+		return TransitionEvent{Revision: resp.Header.Revision}, nil
+	}
+	kv := resp.Kvs[0]
+	return decodeTransition(kv.Value, kv.ModRevision)
+}
+
+// Watch streams transitions from fromRevision onwards, replaying any
+// etcd still retains; zero streams only new ones. The channel closes when
+// ctx ends; a watch that fails sends a last event carrying Err, which is
+// ErrCompacted when the replay start is no longer available.
+func (lm *LifecycleManager) Watch(ctx context.Context, fromRevision int64) <-chan TransitionEvent {
+	events := make(chan TransitionEvent, 64)
+
+	go func() {
+		defer close(events)
+
+		opts := []clientv3.OpOption{}
+		if fromRevision > 0 {
+			opts = append(opts, clientv3.WithRev(fromRevision))
+		}
+		send := func(ev TransitionEvent) bool {
+			select {
+			case events <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for resp := range lm.etcdClient.Watch(clientv3.WithRequireLeader(ctx), transitionKey, opts...) {
+			if resp.CompactRevision != 0 {
+				send(TransitionEvent{Err: fmt.Errorf("%w: oldest available revision is %d",
+					ErrCompacted, resp.CompactRevision)})
+				return
+			}
+			if err := resp.Err(); err != nil {
+				send(TransitionEvent{Err: err})
+				return
+			}
+			for _, ev := range resp.Events {
+				if ev.Type != clientv3.EventTypePut {
+					continue
+				}
+				event, err := decodeTransition(ev.Kv.Value, ev.Kv.ModRevision)
+				if err != nil {
+					lm.logger.Warn("Skipping unreadable transition", zap.Error(err))
+					continue
+				}
+				if !send(event) {
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// WatchHandler streams transitions as server-sent events. The
+// from_revision query parameter, or a Last-Event-ID header on reconnect,
+// replays from a revision.
+func (lm *LifecycleManager) WatchHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		var from int64
+		if v := r.URL.Query().Get("from_revision"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid from_revision", http.StatusBadRequest)
+				return
+			}
+			from = n
+		} else if v := r.Header.Get("Last-Event-ID"); v != "" {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				from = n + 1
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for ev := range lm.Watch(r.Context(), from) {
+			if ev.Err != nil {
+				fmt.Fprintf(w, "event: error\ndata: %q\n\n", ev.Err.Error())
+				flusher.Flush()
+				return
+			}
+			data, _ := json.Marshal(transitionRecord{
+				From:      ev.From.String(),
+				To:        ev.To.String(),
+				Timestamp: ev.Timestamp,
+				Reason:    ev.Reason,
+			})
+			fmt.Fprintf(w, "id: %d\nevent: transition\ndata: %s\n\n", ev.Revision, data)
+			flusher.Flush()
+		}
+	}
+}
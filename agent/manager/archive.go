@@ -0,0 +1,107 @@
+// archive.go - Encrypted Export and Restore of Agent Memory
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	qcrypto "cirium.ai/core/crypto"
+	"cirium.ai/core/memory"
+)
+
+// maxArchiveUpload bounds one memory import
+const maxArchiveUpload = 8 << 30
+
+// MemoryArchiver exports and restores an agent's memory as encrypted
+// archives. memory.MemoryAdapter satisfies it.
+type MemoryArchiver interface {
+	ExportAgentMemory(ctx context.Context, agentID string, w io.Writer, archiveKey [32]byte) (memory.ArchiveManifest, error)
+	ImportAgentMemory(ctx context.Context, r io.Reader, archiveKey [32]byte, targetAgentID string) (memory.ImportResult, error)
+}
+
+// SetMemoryArchiver enables the memory export and import endpoints.
+// Archives are sealed under a key derived from root for the agent's
+// tenant, so they can only be restored into the tenant they came from.
+func (m *Manager) SetMemoryArchiver(a MemoryArchiver, root []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.archiver = a
+	m.archiveRoot = append([]byte(nil), root...)
+}
+
+// getMemoryArchiver returns the archiver and the archive key of tenantID
+func (m *Manager) getMemoryArchiver(tenantID string) (MemoryArchiver, [32]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.archiver == nil {
+		return nil, [32]byte{}, fmt.Errorf("memory archives require a memory archiver")
+	}
+	key, err := qcrypto.DeriveTenantKey(m.archiveRoot, qcrypto.PurposeMemoryArchive, tenantID)
+	if err != nil {
+		return nil, [32]byte{}, fmt.Errorf("archive key derivation failed: %w", err)
+	}
+	return m.archiver, key, nil
+}
+
+// ExportMemory streams agentID's memory to w as an archive sealed under
+// its tenant's archive key
+func (m *Manager) ExportMemory(ctx context.Context, agentID string, w io.Writer) (memory.ArchiveManifest, error) {
+	def, err := m.GetAgent(ctx, agentID)
+	if err != nil {
+		return memory.ArchiveManifest{}, err
+	}
+	archiver, key, err := m.getMemoryArchiver(def.TenantID)
+	if err != nil {
+		return memory.ArchiveManifest{}, err
+	}
+	manifest, err := archiver.ExportAgentMemory(memory.WithTenant(ctx, def.TenantID), agentID, w, key)
+	if err != nil {
+		return memory.ArchiveManifest{}, fmt.Errorf("memory export failed: %w", err)
+	}
+	slog.Info("agent memory exported", "agent_id", agentID, "records", manifest.Records)
+	return manifest, nil
+}
+
+// ImportMemory restores an archive into agentID's memory. Records land
+// after the versions the agent already has; nothing is overwritten.
+// Only archives exported from the agent's tenant open.
+func (m *Manager) ImportMemory(ctx context.Context, agentID string, r io.Reader) (memory.ImportResult, error) {
+	def, err := m.GetAgent(ctx, agentID)
+	if err != nil {
+		return memory.ImportResult{}, err
+	}
+	archiver, key, err := m.getMemoryArchiver(def.TenantID)
+	if err != nil {
+		return memory.ImportResult{}, err
+	}
+	result, err := archiver.ImportAgentMemory(memory.WithTenant(ctx, def.TenantID), r, key, agentID)
+	if err != nil {
+		return memory.ImportResult{}, fmt.Errorf("memory import failed: %w", err)
+	}
+	slog.Info("agent memory imported", "agent_id", agentID,
+		"source", result.Manifest.AgentID, "records", result.Imported)
+	return result, nil
+}
+
+// serveMemoryExport streams the archive as the response body. Its record
+// count follows in a trailer, as the manifest is only final once the
+// last record is written. An export failing midway leaves the archive
+// without its end frame, which restoring it detects.
+func (m *Manager) serveMemoryExport(w http.ResponseWriter, r *http.Request, agentID string) error {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Trailer", "X-Archive-Records")
+	manifest, err := m.ExportMemory(r.Context(), agentID, w)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("X-Archive-Records", strconv.Itoa(manifest.Records))
+	return nil
+}
+
+func (m *Manager) serveMemoryImport(w http.ResponseWriter, r *http.Request, agentID string) (memory.ImportResult, error) {
+	return m.ImportMemory(r.Context(), agentID, http.MaxBytesReader(w, r.Body, maxArchiveUpload))
+}
@@ -0,0 +1,78 @@
+// backlog.go - Pending Task Metrics for Autoscaling
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const backlogInterval = 15 * time.Second
+
+// PendingTasksMetric is the gauge the operator scales AIAgent deployments
+// on, through the Prometheus adapter or KEDA
+const PendingTasksMetric = "Wavine_agent_pending_tasks"
+
+var pendingTasks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: PendingTasksMetric,
+	Help: "Queued and running tasks per agent",
+}, []string{"tenant_id", "agent_id"})
+
+func init() {
+	prometheus.MustRegister(pendingTasks)
+}
+
+// RunBacklogMetrics refreshes the pending task gauge until ctx ends.
+// Every replica reports the same totals, so scalers should take the max
+// across replicas rather than the sum.
+func (m *Manager) RunBacklogMetrics(ctx context.Context) error {
+	ticker := time.NewTicker(backlogInterval)
+	defer ticker.Stop()
+	reported := make(map[[2]string]bool)
+	for {
+		if err := m.refreshBacklog(ctx, reported); err != nil && ctx.Err() == nil {
+			slog.Warn("task backlog refresh failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshBacklog sets the gauge for every agent with pending tasks and
+// zeroes the agents in reported that no longer have any
+func (m *Manager) refreshBacklog(ctx context.Context, reported map[[2]string]bool) error {
+	var rows []struct {
+		TenantID string `db:"tenant_id"`
+		AgentID  string `db:"agent_id"`
+		Pending  int64  `db:"pending"`
+	}
+	if err := m.db.SelectContext(ctx, &rows, `
+		SELECT tenant_id, agent_id, COUNT(*) AS pending
+		FROM agent_tasks
+		WHERE state IN ('queued', 'running')
+		GROUP BY tenant_id, agent_id`); err != nil {
+		return err
+	}
+	seen := make(map[[2]string]bool, len(rows))
+	for _, r := range rows {
+		seen[[2]string{r.TenantID, r.AgentID}] = true
+		pendingTasks.WithLabelValues(r.TenantID, r.AgentID).Set(float64(r.Pending))
+	}
+	// an emptied queue must read zero, not its last value, or the
+	// autoscaler never scales the agent back down
+	for key := range reported {
+		if !seen[key] {
+			pendingTasks.WithLabelValues(key[0], key[1]).Set(0)
+		}
+	}
+	for key := range seen {
+		reported[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+// blueprints.go - Versioned Agent Blueprints
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	// ErrBlueprintNotFound is returned for unknown blueprints or versions
+	ErrBlueprintNotFound = errors.New("blueprint not found")
+	// ErrAgentNotFound is returned for agents that were never created
+	ErrAgentNotFound = errors.New("agent not found")
+	// ErrAgentExists is returned when creating an agent whose ID is taken
+	ErrAgentExists = errors.New("agent already exists")
+	// ErrInvalidParameters wraps parameter validation failures
+	ErrInvalidParameters = errors.New("invalid blueprint parameters")
+)
+
+// MemoryPolicy configures an agent's long-term memory
+type MemoryPolicy struct {
+	RetentionDays int  `json:"retention_days,omitempty"`
+	MaxRecords    int  `json:"max_records,omitempty"`
+	Shared        bool `json:"shared,omitempty"`
+}
+
+// ResourceProfile sizes the workload an agent runs in
+type ResourceProfile struct {
+	CPU            string `json:"cpu,omitempty"`
+	Memory         string `json:"memory,omitempty"`
+	GPU            int    `json:"gpu,omitempty"`
+	MaxConcurrency int    `json:"max_concurrency,omitempty"`
+}
+
+// BlueprintParameter is a value deployments supply when instantiating
+type BlueprintParameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Default     string `json:"default,omitempty"`
+}
+
+// Blueprint is a reusable agent definition. BasePrompt is a text/template
+// over the parameters, e.g. "You support {{.product}} customers".
+// PromptName instead renders the agent's tenant's template of that name
+// from the prompt store, so prompt changes go through its versioning and
+// audit trail. Scopes are the tool
+// scopes granted to agents created from it.
+type Blueprint struct {
+	Name        string               `json:"name"`
+	Version     int                  `json:"version"`
+	Description string               `json:"description,omitempty"`
+	BasePrompt  string               `json:"base_prompt,omitempty"`
+	PromptName  string               `json:"prompt_name,omitempty"`
+	Tools       []string             `json:"tools,omitempty"`
+	Scopes      []string             `json:"scopes,omitempty"`
+	Memory      MemoryPolicy         `json:"memory"`
+	Resources   ResourceProfile      `json:"resources"`
+	Parameters  []BlueprintParameter `json:"parameters,omitempty"`
+	CreatedAt   time.Time            `json:"created_at"`
+}
+
+// AgentDefinition is an agent instantiated from a blueprint version, with
+// its parameters applied. PromptVersion is the stored prompt version
+// rendered for blueprints that name one.
+type AgentDefinition struct {
+	ID               string            `json:"id"`
+	TenantID         string            `json:"tenant_id"`
+	Blueprint        string            `json:"blueprint"`
+	BlueprintVersion int               `json:"blueprint_version"`
+	Parameters       map[string]string `json:"parameters,omitempty"`
+	Prompt           string            `json:"prompt"`
+	PromptVersion    int               `json:"prompt_version,omitempty"`
+	Tools            []string          `json:"tools,omitempty"`
+	Scopes           []string          `json:"scopes,omitempty"`
+	Memory           MemoryPolicy      `json:"memory"`
+	Resources        ResourceProfile   `json:"resources"`
+	ClonedFrom       string            `json:"cloned_from,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+func (b Blueprint) prompt() (*template.Template, error) {
+	return template.New(b.Name).Option("missingkey=error").Parse(b.BasePrompt)
+}
+
+// PromptRenderer renders a tenant's stored prompt templates; prompts.Store
+// satisfies it. subject keeps a caller on one experiment variant.
+type PromptRenderer interface {
+	RenderPrompt(ctx context.Context, tenantID, name string, vars map[string]string, subject string) (string, int, error)
+}
+
+// SetPrompts enables blueprints that name a stored prompt
+func (m *Manager) SetPrompts(r PromptRenderer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prompts = r
+}
+
+func (m *Manager) getPrompts() (PromptRenderer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.prompts == nil {
+		return nil, fmt.Errorf("no prompt store configured")
+	}
+	return m.prompts, nil
+}
+
+// RegisterBlueprint stores b as the blueprint's next version. Its prompt
+// must parse and its tools must be registered.
+func (m *Manager) RegisterBlueprint(ctx context.Context, b Blueprint) (Blueprint, error) {
+	if b.Name == "" || (b.BasePrompt == "") == (b.PromptName == "") {
+		return Blueprint{}, fmt.Errorf("blueprint needs a name and either a base prompt or a prompt name")
+	}
+	if _, err := b.prompt(); err != nil {
+		return Blueprint{}, fmt.Errorf("invalid base prompt: %w", err)
+	}
+	seen := make(map[string]bool)
+	for _, p := range b.Parameters {
+		if p.Name == "" || seen[p.Name] {
+			return Blueprint{}, fmt.Errorf("blueprint parameter names must be unique and non-empty")
+		}
+		seen[p.Name] = true
+	}
+	for _, tool := range b.Tools {
+		if _, err := m.Tools().Get(ctx, tool); err != nil {
+			return Blueprint{}, fmt.Errorf("blueprint tool %s: %w", tool, err)
+		}
+	}
+
+	spec, err := json.Marshal(b)
+	if err != nil {
+		return Blueprint{}, err
+	}
+	err = m.db.QueryRowContext(ctx, `
+		INSERT INTO agent_blueprints (name, version, spec)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2
+		FROM agent_blueprints WHERE name = $1
+		RETURNING version, created_at`, b.Name, spec).Scan(&b.Version, &b.CreatedAt)
+	if err != nil {
+		return Blueprint{}, fmt.Errorf("blueprint registration failed: %w", err)
+	}
+	slog.Info("blueprint registered", "name", b.Name, "version", b.Version)
+	return b, nil
+}
+
+// GetBlueprint returns a blueprint version, the latest when version is 0
+func (m *Manager) GetBlueprint(ctx context.Context, name string, version int) (Blueprint, error) {
+	var (
+		spec      []byte
+		createdAt time.Time
+	)
+	err := m.db.QueryRowContext(ctx, `
+		SELECT version, spec, created_at FROM agent_blueprints
+		WHERE name = $1 AND ($2 = 0 OR version = $2)
+		ORDER BY version DESC LIMIT 1`, name, version).Scan(&version, &spec, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Blueprint{}, fmt.Errorf("%w: %s v%d", ErrBlueprintNotFound, name, version)
+	}
+	if err != nil {
+		return Blueprint{}, fmt.Errorf("blueprint query failed: %w", err)
+	}
+	var b Blueprint
+	if err := json.Unmarshal(spec, &b); err != nil {
+		return Blueprint{}, fmt.Errorf("corrupt blueprint %s v%d: %w", name, version, err)
+	}
+	b.Version, b.CreatedAt = version, createdAt
+	return b, nil
+}
+
+// ListBlueprints returns the latest version of every blueprint
+func (m *Manager) ListBlueprints(ctx context.Context) ([]Blueprint, error) {
+	var names []string
+	if err := m.db.SelectContext(ctx, &names,
+		`SELECT DISTINCT name FROM agent_blueprints ORDER BY name`); err != nil {
+		return nil, fmt.Errorf("blueprint list failed: %w", err)
+	}
+	blueprints := make([]Blueprint, 0, len(names))
+	for _, name := range names {
+		b, err := m.GetBlueprint(ctx, name, 0)
+		if err != nil {
+			return nil, err
+		}
+		blueprints = append(blueprints, b)
+	}
+	return blueprints, nil
+}
+
+// render applies params to b, filling defaults and rejecting unknown or
+// missing values
+func (b Blueprint) render(params map[string]string) (map[string]string, string, error) {
+	values := make(map[string]string, len(b.Parameters))
+	known := make(map[string]bool, len(b.Parameters))
+	var missing []string
+	for _, p := range b.Parameters {
+		known[p.Name] = true
+		v, ok := params[p.Name]
+		switch {
+		case ok:
+			values[p.Name] = v
+		case p.Required:
+			missing = append(missing, p.Name)
+		default:
+			values[p.Name] = p.Default
+		}
+	}
+	var unknown []string
+	for name := range params {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(missing) > 0 || len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, "", fmt.Errorf("%w: missing %v, unknown %v", ErrInvalidParameters, missing, unknown)
+	}
+
+	tmpl, err := b.prompt()
+	if err != nil {
+		return nil, "", err
+	}
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, values); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidParameters, err)
+	}
+	return values, prompt.String(), nil
+}
+
+// CreateAgentFromTemplate instantiates an agent from a blueprint version.
+// With version 0 the version is routed like a session (see RouteSession),
+// so a running rollout's canary gets only its share of new agents.
+// Deployments pass only parameter values; prompt, tools, memory policy and
+// resources come from the blueprint.
+func (m *Manager) CreateAgentFromTemplate(ctx context.Context, tenantID, agentID, blueprint string, version int, params map[string]string) (AgentDefinition, error) {
+	if agentID == "" {
+		return AgentDefinition{}, fmt.Errorf("agent needs an id")
+	}
+	if version == 0 {
+		var err error
+		if version, err = m.RouteSession(ctx, blueprint, agentID); err != nil {
+			return AgentDefinition{}, err
+		}
+	}
+	b, err := m.GetBlueprint(ctx, blueprint, version)
+	if err != nil {
+		return AgentDefinition{}, err
+	}
+	values, prompt, err := b.render(params)
+	if err != nil {
+		return AgentDefinition{}, err
+	}
+	var promptVersion int
+	if b.PromptName != "" {
+		renderer, err := m.getPrompts()
+		if err != nil {
+			return AgentDefinition{}, err
+		}
+		// the agent ID keeps each agent on one side of a prompt experiment
+		if prompt, promptVersion, err = renderer.RenderPrompt(ctx, tenantID, b.PromptName, values, agentID); err != nil {
+			return AgentDefinition{}, fmt.Errorf("%w: prompt %s: %v", ErrInvalidParameters, b.PromptName, err)
+		}
+	}
+
+	def := AgentDefinition{
+		ID:               agentID,
+		TenantID:         tenantID,
+		Blueprint:        b.Name,
+		BlueprintVersion: b.Version,
+		Parameters:       values,
+		Prompt:           prompt,
+		PromptVersion:    promptVersion,
+		Tools:            b.Tools,
+		Scopes:           b.Scopes,
+		Memory:           b.Memory,
+		Resources:        b.Resources,
+	}
+	spec, err := json.Marshal(def)
+	if err != nil {
+		return AgentDefinition{}, err
+	}
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return AgentDefinition{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO agents (id, tenant_id, blueprint, blueprint_version, spec)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING`, agentID, tenantID, b.Name, b.Version, spec)
+	if err != nil {
+		return AgentDefinition{}, fmt.Errorf("agent creation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return AgentDefinition{}, fmt.Errorf("%w: %s", ErrAgentExists, agentID)
+	}
+	if err := m.appendEvent(ctx, tx, tenantID, agentID, EventAgentCreated, json.RawMessage(spec)); err != nil {
+		return AgentDefinition{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return AgentDefinition{}, fmt.Errorf("commit failed: %w", err)
+	}
+	slog.Info("agent created from blueprint", "agent_id", agentID, "tenant_id", tenantID,
+		"blueprint", b.Name, "version", b.Version)
+	return m.GetAgent(ctx, agentID)
+}
+
+// GetAgent returns an agent's definition
+func (m *Manager) GetAgent(ctx context.Context, agentID string) (AgentDefinition, error) {
+	var (
+		spec      []byte
+		createdAt time.Time
+	)
+	err := m.db.QueryRowContext(ctx,
+		`SELECT spec, created_at FROM agents WHERE id = $1`, agentID).Scan(&spec, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AgentDefinition{}, fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+	}
+	if err != nil {
+		return AgentDefinition{}, fmt.Errorf("agent query failed: %w", err)
+	}
+	var def AgentDefinition
+	if err := json.Unmarshal(spec, &def); err != nil {
+		return AgentDefinition{}, fmt.Errorf("corrupt agent %s: %w", agentID, err)
+	}
+	def.CreatedAt = createdAt
+	return def, nil
+}
+
+// BlueprintHandler serves blueprints under /api/blueprints/:
+//
+//	POST /api/blueprints/                register a new version
+//	GET  /api/blueprints/                latest version of each
+//	GET  /api/blueprints/{name}?version= one version, latest by default
+//
+// Blueprints are shared by every tenant, so the route takes the admin
+// permission.
+func (m *Manager) BlueprintHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/api/blueprints/")
+		if strings.Contains(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		var (
+			body any
+			err  error
+		)
+		switch {
+		case r.Method == http.MethodPost && name == "":
+			var b Blueprint
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&b); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			if b, err = m.RegisterBlueprint(r.Context(), b); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			body = b
+		case r.Method == http.MethodGet && name == "":
+			body, err = m.ListBlueprints(r.Context())
+		case r.Method == http.MethodGet:
+			version, _ := strconv.Atoi(r.URL.Query().Get("version"))
+			body, err = m.GetBlueprint(r.Context(), name, version)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrBlueprintNotFound):
+			http.NotFound(w, r)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_blueprints (
+    name       VARCHAR(255) NOT NULL,
+    version    INT NOT NULL,
+    spec       JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (name, version)
+);
+
+CREATE TABLE IF NOT EXISTS agents (
+    id                VARCHAR(255) PRIMARY KEY,
+    tenant_id         VARCHAR(255) NOT NULL DEFAULT '',
+    blueprint         VARCHAR(255) NOT NULL DEFAULT '',
+    blueprint_version INT NOT NULL DEFAULT 0,
+    spec              JSONB NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_agents_tenant ON agents (tenant_id);
+*/
@@ -0,0 +1,189 @@
+// checkpoint.go - Agent Execution Checkpointing and Resume
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const defaultCheckpointInterval = 15 * time.Second
+
+// CheckpointStore persists serialized execution state per agent and task,
+// so tasks of one agent running side by side keep separate checkpoints.
+// memory.MemoryAdapter satisfies it, sealing checkpoints like any other
+// memory record.
+type CheckpointStore interface {
+	SaveCheckpoint(ctx context.Context, agentID, taskID string, seq int64, state []byte) error
+	// LatestCheckpoint returns a zero seq and nil state when there is none
+	LatestCheckpoint(ctx context.Context, agentID, taskID string) (int64, []byte, error)
+	ClearCheckpoints(ctx context.Context, agentID, taskID string) error
+}
+
+// ToolCall is a tool invocation the agent issued but has not yet seen the
+// result of
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// ExecutionState is what an agent needs to continue a task where it left
+// off
+type ExecutionState struct {
+	AgentID string `json:"agent_id"`
+	TaskID  string `json:"task_id"`
+	// Position is the index of the next conversation turn to process
+	Position         int             `json:"position"`
+	PendingToolCalls []ToolCall      `json:"pending_tool_calls,omitempty"`
+	Scratchpad       json.RawMessage `json:"scratchpad,omitempty"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+// Execution tracks the state of one running task and checkpoints it
+// periodically. Handlers get it from ExecutionFromContext.
+type Execution struct {
+	store   CheckpointStore
+	agentID string
+	taskID  string
+	// saved is told of each persisted state, for the agent's history
+	saved func(ctx context.Context, state json.RawMessage)
+
+	mu      sync.Mutex
+	state   ExecutionState
+	seq     int64
+	dirty   bool
+	resumed bool
+}
+
+type executionKey struct{}
+
+// ExecutionFromContext returns the execution of the task being handled, or
+// nil when checkpointing is not configured
+func ExecutionFromContext(ctx context.Context) *Execution {
+	exec, _ := ctx.Value(executionKey{}).(*Execution)
+	return exec
+}
+
+// State returns a copy of the current execution state
+func (e *Execution) State() ExecutionState {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	state := e.state
+	state.PendingToolCalls = append([]ToolCall(nil), e.state.PendingToolCalls...)
+	return state
+}
+
+// Resumed reports whether the state came from a checkpoint of an earlier
+// attempt rather than starting fresh
+func (e *Execution) Resumed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.resumed
+}
+
+// Update applies fn to the state; the change is persisted at the next
+// checkpoint
+func (e *Execution) Update(fn func(*ExecutionState)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fn(&e.state)
+	e.state.UpdatedAt = time.Now().UTC()
+	e.dirty = true
+}
+
+// Checkpoint persists the state now if it changed since the last save.
+// Handlers call it after steps that would be expensive to repeat.
+func (e *Execution) Checkpoint(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.dirty {
+		e.mu.Unlock()
+		return nil
+	}
+	e.seq++
+	seq := e.seq
+	raw, err := json.Marshal(e.state)
+	e.dirty = false
+	e.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("checkpoint serialization failed: %w", err)
+	}
+
+	if err := e.store.SaveCheckpoint(ctx, e.agentID, e.taskID, seq, raw); err != nil {
+		e.mu.Lock()
+		e.dirty = true
+		e.mu.Unlock()
+		return err
+	}
+	if e.saved != nil {
+		e.saved(ctx, raw)
+	}
+	return nil
+}
+
+// SetCheckpointStore enables execution checkpointing for task workers
+func (m *Manager) SetCheckpointStore(store CheckpointStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints = store
+}
+
+func (m *Manager) getCheckpointStore() CheckpointStore {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.checkpoints
+}
+
+// ResumeExecution loads the latest checkpoint of agentID for taskID, or a
+// fresh state when the task has none
+func (m *Manager) ResumeExecution(ctx context.Context, agentID, taskID string) (*Execution, error) {
+	store := m.getCheckpointStore()
+	if store == nil {
+		return nil, fmt.Errorf("checkpointing not configured")
+	}
+	exec := newExecution(store, agentID, taskID)
+	seq, raw, err := store.LatestCheckpoint(ctx, agentID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	// later saves must sort after whatever an earlier attempt stored
+	exec.seq = seq
+	if raw == nil {
+		return exec, nil
+	}
+	var state ExecutionState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, fmt.Errorf("corrupt checkpoint for %s task %s: %w", agentID, taskID, err)
+	}
+	exec.state = state
+	exec.resumed = true
+	return exec, nil
+}
+
+func newExecution(store CheckpointStore, agentID, taskID string) *Execution {
+	return &Execution{
+		store:   store,
+		agentID: agentID,
+		taskID:  taskID,
+		state:   ExecutionState{AgentID: agentID, TaskID: taskID},
+	}
+}
+
+// runCheckpoints saves exec every interval until ctx ends
+func (m *Manager) runCheckpoints(ctx context.Context, exec *Execution) {
+	ticker := time.NewTicker(m.cfg.CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := exec.Checkpoint(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("agent checkpoint failed", "agent_id", exec.agentID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// clone.go - Agent Cloning with Copy-on-Write Memory
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cirium.ai/core/memory"
+)
+
+// MemoryForker branches an agent's memory without copying it.
+// memory.MemoryAdapter satisfies it.
+type MemoryForker interface {
+	ForkAgentMemory(ctx context.Context, parentID, childID string) (memory.Fork, error)
+}
+
+// SetMemoryForker enables cloning agents together with their memory
+func (m *Manager) SetMemoryForker(f MemoryForker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.forker = f
+}
+
+func (m *Manager) getMemoryForker() (MemoryForker, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.forker == nil {
+		return nil, fmt.Errorf("cloning memory requires a memory forker")
+	}
+	return m.forker, nil
+}
+
+// CloneOptions tunes CloneAgent
+type CloneOptions struct {
+	// Memory branches the source's memory into the clone. The clone reads
+	// everything the source remembered at the time of cloning; writes on
+	// either side stay on that side.
+	Memory bool `json:"memory,omitempty"`
+}
+
+// CloneAgent creates cloneID with sourceID's configuration in the source's
+// tenant, recording the source in ClonedFrom. With opts.Memory the clone also starts from a
+// copy-on-write branch of the source's memory, so a long-lived agent can
+// be branched for an experiment without touching it.
+func (m *Manager) CloneAgent(ctx context.Context, sourceID, cloneID string, opts CloneOptions) (AgentDefinition, error) {
+	if cloneID == "" {
+		return AgentDefinition{}, fmt.Errorf("agent needs an id")
+	}
+	var forker MemoryForker
+	if opts.Memory {
+		var err error
+		if forker, err = m.getMemoryForker(); err != nil {
+			return AgentDefinition{}, err
+		}
+	}
+	def, err := m.GetAgent(ctx, sourceID)
+	if err != nil {
+		return AgentDefinition{}, err
+	}
+
+	def.ID = cloneID
+	def.ClonedFrom = sourceID
+	spec, err := json.Marshal(def)
+	if err != nil {
+		return AgentDefinition{}, err
+	}
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return AgentDefinition{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO agents (id, tenant_id, blueprint, blueprint_version, spec)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING`, cloneID, def.TenantID, def.Blueprint, def.BlueprintVersion, spec)
+	if err != nil {
+		return AgentDefinition{}, fmt.Errorf("agent clone failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return AgentDefinition{}, fmt.Errorf("%w: %s", ErrAgentExists, cloneID)
+	}
+	if err := m.appendEvent(ctx, tx, def.TenantID, cloneID, EventAgentCreated, json.RawMessage(spec)); err != nil {
+		return AgentDefinition{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return AgentDefinition{}, fmt.Errorf("commit failed: %w", err)
+	}
+
+	if forker != nil {
+		fork, err := forker.ForkAgentMemory(memory.WithTenant(ctx, def.TenantID), sourceID, cloneID)
+		if err != nil {
+			// an agent without the memory it was cloned for would mislead
+			// whoever experiments with it
+			if _, derr := m.db.ExecContext(context.WithoutCancel(ctx), `
+				WITH events AS (DELETE FROM agent_events WHERE agent_id = $1)
+				DELETE FROM agents WHERE id = $1`, cloneID); derr != nil {
+				slog.Error("clone cleanup failed", "agent_id", cloneID, "error", derr)
+			}
+			return AgentDefinition{}, fmt.Errorf("memory fork failed: %w", err)
+		}
+		slog.Info("agent memory forked", "agent_id", cloneID, "source", sourceID, "version", fork.Version)
+	}
+	slog.Info("agent cloned", "agent_id", cloneID, "source", sourceID, "tenant_id", def.TenantID)
+	return m.GetAgent(ctx, cloneID)
+}
+
+// AgentHandler serves agent operations under /api/agents/:
+//
+//	GET  /api/agents/{id}                       agent definition
+//	GET  /api/agents/{id}/events?after=&limit=  history, oldest first
+//	GET  /api/agents/{id}/replay?seq=&until=    state rebuilt from history
+//	POST /api/agents/{id}/clone                 {"id": ..., "memory": true}
+//	GET  /api/agents/{id}/memory/export         encrypted memory archive
+//	POST /api/agents/{id}/memory/import         restore an archive into the agent
+//
+// Callers reach only the agents of their own tenant.
+func (m *Manager) AgentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/agents/"), "/")
+		if id == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		def, err := m.ownedAgent(r.Context(), id)
+		var body any
+		switch {
+		case err != nil:
+			// answered below
+		case r.Method == http.MethodGet && action == "":
+			body = def
+		case r.Method == http.MethodGet && action == "events":
+			q := r.URL.Query()
+			after, _ := strconv.ParseInt(q.Get("after"), 10, 64)
+			limit, _ := strconv.Atoi(q.Get("limit"))
+			body, err = m.AgentEvents(r.Context(), id, after, limit)
+		case r.Method == http.MethodGet && action == "replay":
+			q := r.URL.Query()
+			seq, _ := strconv.ParseInt(q.Get("seq"), 10, 64)
+			var until time.Time
+			if v := q.Get("until"); v != "" {
+				if until, err = time.Parse(time.RFC3339, v); err != nil {
+					http.Error(w, "until must be RFC 3339", http.StatusBadRequest)
+					return
+				}
+			}
+			body, err = m.ReplayAgent(r.Context(), id, seq, until)
+		case r.Method == http.MethodPost && action == "clone":
+			var req struct {
+				ID string `json:"id"`
+				CloneOptions
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			if body, err = m.CloneAgent(r.Context(), id, req.ID, req.CloneOptions); err == nil {
+				w.WriteHeader(http.StatusCreated)
+			}
+		case r.Method == http.MethodGet && action == "memory/export":
+			if err = m.serveMemoryExport(w, r, id); err == nil {
+				return
+			}
+		case r.Method == http.MethodPost && action == "memory/import":
+			body, err = m.serveMemoryImport(w, r, id)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrAgentNotFound):
+			http.NotFound(w, r)
+			return
+		case errors.Is(err, ErrAgentExists), errors.Is(err, memory.ErrForkExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, memory.ErrArchiveCorrupt):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
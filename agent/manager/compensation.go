@@ -0,0 +1,277 @@
+// compensation.go - Tool Steps, Retry Policies and Compensation for Workflows
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ToolTaskKind is the task kind of workflow steps and compensations that
+// call a tool; run a worker for it with ToolTaskHandler
+const ToolTaskKind = "tool.invoke"
+
+var compensationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_agent_workflow_compensations_total",
+	Help: "Workflow step compensations by outcome",
+}, []string{"outcome"})
+
+func init() {
+	prometheus.MustRegister(compensationsTotal)
+}
+
+// Compensation undoes a workflow step, either by calling a tool or by
+// running a task of Kind. AgentID defaults to the step's agent.
+type Compensation struct {
+	Tool    string          `json:"tool,omitempty"`
+	Kind    string          `json:"kind,omitempty"`
+	AgentID string          `json:"agent_id,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Retry   RetryPolicy     `json:"retry,omitempty"`
+}
+
+// ToolPolicy is how workflows call a tool unless a step says otherwise
+type ToolPolicy struct {
+	Retry RetryPolicy `json:"retry,omitempty"`
+	// Compensate undoes a call, e.g. by calling a cleanup tool
+	Compensate *Compensation `json:"compensate,omitempty"`
+}
+
+// ToolTaskPayload is the task payload of a tool call made by a workflow.
+// Scopes narrow the grants of the task's agent and never extend them.
+type ToolTaskPayload struct {
+	RunID  string          `json:"run_id"`
+	StepID string          `json:"step_id"`
+	Tool   string          `json:"tool"`
+	Scopes []string        `json:"scopes,omitempty"`
+	Input  json.RawMessage `json:"input"`
+}
+
+// CompensationPayload is the task payload of a compensation of Kind
+type CompensationPayload struct {
+	RunID  string          `json:"run_id"`
+	StepID string          `json:"step_id"`
+	Input  json.RawMessage `json:"input"`
+	Params json.RawMessage `json:"params,omitempty"`
+	// Output and Error are what the compensated step produced
+	Output json.RawMessage `json:"output,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+func (c *Compensation) validate(stepID string) error {
+	if (c.Tool == "") == (c.Kind == "") {
+		return fmt.Errorf("%w: compensation of step %q needs exactly one of a tool and a kind",
+			ErrInvalidWorkflow, stepID)
+	}
+	return nil
+}
+
+// resolveTools turns tool steps into tool tasks and fills in the retry and
+// compensation policies of the tools they call. The run keeps these, so
+// re-registering a tool does not change runs already started.
+func (m *Manager) resolveTools(ctx context.Context, spec *WorkflowSpec) error {
+	policies := make(map[string]ToolPolicy)
+	policy := func(name string) (ToolPolicy, error) {
+		if p, ok := policies[name]; ok {
+			return p, nil
+		}
+		tool, err := m.Tools().Get(ctx, name)
+		if errors.Is(err, ErrToolNotFound) {
+			return ToolPolicy{}, fmt.Errorf("%w: unknown tool %q", ErrInvalidWorkflow, name)
+		}
+		if err != nil {
+			return ToolPolicy{}, err
+		}
+		policies[name] = tool.Policy
+		return tool.Policy, nil
+	}
+
+	for i := range spec.Steps {
+		st := &spec.Steps[i]
+		if st.Tool != "" {
+			p, err := policy(st.Tool)
+			if err != nil {
+				return err
+			}
+			st.Kind = ToolTaskKind
+			if st.Retry == (RetryPolicy{}) {
+				st.Retry = p.Retry
+			}
+			if st.Compensate == nil && p.Compensate != nil {
+				c := *p.Compensate
+				st.Compensate = &c
+			}
+		}
+		if c := st.Compensate; c != nil && c.Tool != "" && c.Retry == (RetryPolicy{}) {
+			p, err := policy(c.Tool)
+			if err != nil {
+				return err
+			}
+			c.Retry = p.Retry
+		}
+	}
+	return nil
+}
+
+// ToolTaskHandler executes the tool calls of workflow steps and
+// compensations. Calls that can never succeed fail without retries.
+func (m *Manager) ToolTaskHandler() TaskHandler {
+	return func(ctx context.Context, task Task) (json.RawMessage, error) {
+		var p ToolTaskPayload
+		if err := json.Unmarshal(task.Payload, &p); err != nil {
+			return nil, Permanent(fmt.Errorf("invalid tool task payload: %w", err))
+		}
+		// the payload's scopes only narrow what the agent was granted
+		scopes, err := m.callerScopes(ctx, task.TenantID, task.AgentID, p.Scopes)
+		if err != nil {
+			return nil, Permanent(err)
+		}
+		caller := Caller{TenantID: task.TenantID, AgentID: task.AgentID, Scopes: scopes}
+		output, err := m.Tools().Invoke(ctx, caller, p.Tool, p.Input)
+		switch {
+		case errors.Is(err, ErrToolNotFound), errors.Is(err, ErrToolForbidden),
+			errors.Is(err, ErrInvalidToolInput), errors.Is(err, ErrBudgetExceeded):
+			return nil, Permanent(err)
+		case err != nil:
+			return nil, err
+		}
+		return output, nil
+	}
+}
+
+// toolInput is what a tool step passes its tool: the step's params, or
+// the run's input when it has none
+func toolInput(params, input json.RawMessage) json.RawMessage {
+	if len(params) > 0 {
+		return params
+	}
+	return input
+}
+
+// compensable reports whether a failed run has steps to undo
+func compensable(spec WorkflowSpec, steps map[string]*stepRow) bool {
+	for _, st := range spec.Steps {
+		state := steps[st.ID].State
+		if st.Compensate != nil && (state == StepSucceeded || state == StepFailed) {
+			return true
+		}
+	}
+	return false
+}
+
+// compensateWorkflow advances a compensating run, one step at a time in
+// the reverse order the steps finished, so later steps are undone before
+// the ones they built on. Steps that failed are compensated too, to clean
+// up whatever they did before failing. A failed compensation is recorded
+// and the rest still run. Once none remain the run fails with its original
+// error.
+func (m *Manager) compensateWorkflow(ctx context.Context, tx *sqlx.Tx, runID, tenantID string,
+	input json.RawMessage, spec WorkflowSpec, steps map[string]*stepRow) (*Task, bool, error) {
+	for _, st := range spec.Steps {
+		row := steps[st.ID]
+		if row.State != StepCompensating {
+			continue
+		}
+		switch TaskState(row.CompState.String) {
+		case TaskSucceeded:
+			row.State, row.dirty = StepCompensated, true
+			compensationsTotal.WithLabelValues("succeeded").Inc()
+		case TaskFailed, TaskExpired, TaskCancelled:
+			row.State, row.dirty = StepCompensationFailed, true
+			row.Error = strings.TrimPrefix(row.Error+"; ", "; ") +
+				fmt.Sprintf("compensation task %s: %s", row.CompState.String, row.CompError.String)
+			compensationsTotal.WithLabelValues("failed").Inc()
+			slog.Warn("workflow compensation failed", "run_id", runID, "step", st.ID, "error", row.CompError.String)
+		default:
+			// still running
+			return nil, false, nil
+		}
+	}
+
+	var pending []WorkflowStep
+	for _, st := range spec.Steps {
+		state := steps[st.ID].State
+		if st.Compensate != nil && (state == StepSucceeded || state == StepFailed) {
+			pending = append(pending, st)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, true, nil
+	}
+	// steps settled in this pass have no finish time yet and are the latest
+	sort.SliceStable(pending, func(i, j int) bool {
+		a, b := steps[pending[i].ID].FinishedAt, steps[pending[j].ID].FinishedAt
+		if !a.Valid || !b.Valid {
+			return !a.Valid && b.Valid
+		}
+		return a.Time.After(b.Time)
+	})
+
+	st := pending[0]
+	task, err := m.scheduleCompensation(ctx, tx, runID, tenantID, input, st, steps[st.ID])
+	if err != nil {
+		return nil, false, err
+	}
+	row := steps[st.ID]
+	row.State, row.CompTaskID, row.dirty = StepCompensating, task.ID, true
+	return &task, false, nil
+}
+
+func (m *Manager) scheduleCompensation(ctx context.Context, tx *sqlx.Tx, runID, tenantID string,
+	input json.RawMessage, st WorkflowStep, row *stepRow) (Task, error) {
+	c := st.Compensate
+	spec := TaskSpec{
+		TenantID: tenantID,
+		AgentID:  c.AgentID,
+		Kind:     c.Kind,
+		Priority: st.Priority,
+		Retry:    c.Retry,
+	}
+	if spec.AgentID == "" {
+		spec.AgentID = st.AgentID
+	}
+
+	var payload any
+	if c.Tool != "" {
+		spec.Kind = ToolTaskKind
+		// a cleanup tool usually needs what the step was called with,
+		// e.g. the name of what it created
+		params := c.Params
+		if len(params) == 0 {
+			params = toolInput(st.Params, input)
+		}
+		payload = ToolTaskPayload{RunID: runID, StepID: st.ID, Tool: c.Tool, Scopes: st.Scopes, Input: params}
+	} else {
+		payload = CompensationPayload{
+			RunID: runID, StepID: st.ID, Input: input, Params: c.Params,
+			Output: row.Output, Error: row.Error,
+		}
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Task{}, err
+	}
+	spec.Payload = raw
+	return m.insertTask(ctx, tx, spec)
+}
+
+// compensationErrors lists the steps whose compensation failed
+func compensationErrors(spec WorkflowSpec, steps map[string]*stepRow) string {
+	var failed []string
+	for _, st := range spec.Steps {
+		if steps[st.ID].State == StepCompensationFailed {
+			failed = append(failed, st.ID)
+		}
+	}
+	if len(failed) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("; compensation failed for steps %s", strings.Join(failed, ", "))
+}
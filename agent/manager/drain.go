@@ -0,0 +1,121 @@
+// drain.go - Graceful Task Draining on Shutdown
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+
+	// handoffTimeout bounds the wait for stopped handlers to checkpoint
+	// and hand their tasks back
+	handoffTimeout = 10 * time.Second
+)
+
+// drainState tracks this replica's running tasks so Drain can wait for
+// them. startTask and Drain share drainMu, so no task starts once draining.
+type drainState struct {
+	draining bool
+	drained  chan struct{}
+	// halted stops handlers still running when the drain deadline passes
+	halted chan struct{}
+}
+
+// startTask registers a claimed task as running, or reports false when
+// the replica is draining and the task must go back to the queue
+func (m *Manager) startTask() bool {
+	m.drainMu.Lock()
+	defer m.drainMu.Unlock()
+	if m.drain.draining {
+		return false
+	}
+	m.running.Add(1)
+	return true
+}
+
+func (m *Manager) isDraining() bool {
+	m.drainMu.Lock()
+	defer m.drainMu.Unlock()
+	return m.drain.draining
+}
+
+// halted reports whether Drain has stopped the remaining handlers
+func (m *Manager) halted() bool {
+	select {
+	case <-m.drain.halted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain prepares the replica for shutdown. Workers stop claiming tasks
+// and running ones get until ctx ends, or DrainTimeout, to finish. Any
+// still running then are stopped: their execution state is checkpointed
+// and the tasks go back to the queue without using up an attempt, so a
+// peer replica resumes them right away instead of after the lease lapses.
+// Drain returns once every task has finished or been handed back; call it
+// before cancelling the workers' context.
+func (m *Manager) Drain(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.DrainTimeout)
+	defer cancel()
+
+	m.drainMu.Lock()
+	if !m.drain.draining {
+		m.drain.draining = true
+		close(m.drain.drained)
+	}
+	m.drainMu.Unlock()
+	slog.Info("draining agent tasks", "worker", m.cfg.WorkerID)
+
+	idle := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		slog.Info("agent tasks drained", "worker", m.cfg.WorkerID)
+		return nil
+	case <-ctx.Done():
+	}
+
+	slog.Warn("drain deadline passed, handing remaining tasks to peers", "worker", m.cfg.WorkerID)
+	m.drainMu.Lock()
+	if !m.halted() {
+		close(m.drain.halted)
+	}
+	m.drainMu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-time.After(handoffTimeout):
+		// the leases of tasks whose handlers ignore cancellation lapse
+		// and peers take them over then
+		return fmt.Errorf("agent task handlers did not stop within %s", handoffTimeout)
+	}
+}
+
+// releaseTask hands a task this worker stopped back to the queue without
+// counting the attempt, and wakes peer workers for it
+func (m *Manager) releaseTask(ctx context.Context, task Task, worker string) error {
+	res, err := m.db.ExecContext(ctx, `
+		UPDATE agent_tasks
+		SET state = 'queued', worker = '', attempts = GREATEST(attempts - 1, 0),
+		    lease_expires_at = NULL, not_before = NOW(), updated_at = NOW()
+		WHERE id = $1 AND worker = $2 AND state = 'running'`, task.ID, worker)
+	if err != nil {
+		return fmt.Errorf("task release failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	tasksTotal.WithLabelValues(task.Kind, "handed_off").Inc()
+	m.notifyTask(ctx, task)
+	return nil
+}
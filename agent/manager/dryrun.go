@@ -0,0 +1,350 @@
+// dryrun.go - Dry Runs with Intercepted Tool Calls
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Sources of a simulated tool response, in the order simulate tries them
+const (
+	DryRunRecorded  = "recorded"
+	DryRunSimulated = "simulated"
+	DryRunSynthetic = "synthetic"
+)
+
+var dryRunCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_agent_dry_run_calls_total",
+	Help: "Tool calls intercepted by dry runs, by tool and response source",
+}, []string{"tool", "source"})
+
+func init() {
+	prometheus.MustRegister(dryRunCalls)
+}
+
+// ToolDryRun describes a tool to dry runs. Tools are assumed to have side
+// effects, so by default a dry run never reaches their executor.
+type ToolDryRun struct {
+	// ReadOnly tools change nothing and run for real in dry runs, so the
+	// agent reasons over live data
+	ReadOnly bool `json:"read_only,omitempty"`
+	// Record stores real responses for dry runs to replay
+	Record bool `json:"record,omitempty"`
+}
+
+// ToolSimulator answers a dry-run call to one tool, e.g. with a canned
+// response keyed on the input
+type ToolSimulator func(ctx context.Context, caller Caller, input json.RawMessage) (json.RawMessage, error)
+
+type dryRunKey struct{}
+
+// WithDryRun marks ctx as part of dry run runID. Tool calls made under it
+// are intercepted unless the tool is read-only. Tasks submitted with
+// DryRun set get this context, with the task ID as the run ID.
+func WithDryRun(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, runID)
+}
+
+// DryRunFromContext returns the dry run ctx belongs to, if any
+func DryRunFromContext(ctx context.Context) (string, bool) {
+	runID, ok := ctx.Value(dryRunKey{}).(string)
+	return runID, ok
+}
+
+// DryRunCall is an intercepted tool call as logged for review
+type DryRunCall struct {
+	ID       int64           `db:"id" json:"id"`
+	RunID    string          `db:"run_id" json:"run_id"`
+	TenantID string          `db:"tenant_id" json:"tenant_id"`
+	AgentID  string          `db:"agent_id" json:"agent_id"`
+	Tool     string          `db:"tool" json:"tool"`
+	Version  int             `db:"version" json:"version"`
+	Input    json.RawMessage `db:"input" json:"input"`
+	Output   json.RawMessage `db:"output" json:"output,omitempty"`
+	// Source is where the response came from: recorded, simulated or
+	// synthetic
+	Source    string    `db:"source" json:"source"`
+	Error     string    `db:"error" json:"error,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// SetSimulator answers dry-run calls to the named tool with sim when no
+// recorded response matches
+func (r *ToolRegistry) SetSimulator(name string, sim ToolSimulator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.simulators[name] = sim
+}
+
+// simulate answers an intercepted call from, in order: a response recorded
+// for the same input, the tool's simulator, or a skeleton built from its
+// output schema. Every interception is logged under the run.
+func (r *ToolRegistry) simulate(ctx context.Context, tool compiledTool, caller Caller, runID string, input json.RawMessage) (json.RawMessage, error) {
+	spec := tool.spec
+	output, source, err := r.respond(ctx, spec, caller, input)
+	if err == nil && tool.output != nil {
+		if verr := validate(tool.output, output); verr != nil {
+			err = fmt.Errorf("%w: %s: %v", ErrInvalidToolOutput, spec.Name, verr)
+		}
+	}
+
+	call := DryRunCall{
+		RunID:    runID,
+		TenantID: caller.TenantID,
+		AgentID:  caller.AgentID,
+		Tool:     spec.Name,
+		Version:  spec.Version,
+		Input:    input,
+		Output:   output,
+		Source:   source,
+	}
+	if err != nil {
+		call.Output = nil
+		call.Error = err.Error()
+	}
+	if lerr := r.logDryRunCall(context.WithoutCancel(ctx), call); lerr != nil {
+		slog.Warn("dry run call not logged", "run_id", runID, "tool", spec.Name, "error", lerr)
+	}
+	r.m.recordEvent(ctx, caller.TenantID, caller.AgentID, EventToolCalled, ToolCallEvent{
+		Tool: spec.Name, Version: spec.Version, Input: input,
+		Output: call.Output, Error: call.Error, DryRun: runID,
+	})
+
+	dryRunCalls.WithLabelValues(spec.Name, source).Inc()
+	if err != nil {
+		toolCalls.WithLabelValues(spec.Name, "dry_run_error").Inc()
+		return nil, fmt.Errorf("tool %s failed: %w", spec.Name, err)
+	}
+	toolCalls.WithLabelValues(spec.Name, "dry_run").Inc()
+	return output, nil
+}
+
+func (r *ToolRegistry) respond(ctx context.Context, spec ToolSpec, caller Caller, input json.RawMessage) (json.RawMessage, string, error) {
+	hash, err := inputHash(input)
+	if err != nil {
+		return nil, DryRunRecorded, err
+	}
+	var recorded []byte
+	err = r.m.db.QueryRowContext(ctx, `
+		SELECT output FROM agent_tool_recordings
+		WHERE name = $1 AND input_hash = $2`, spec.Name, hash).Scan(&recorded)
+	switch {
+	case err == nil:
+		return recorded, DryRunRecorded, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, DryRunRecorded, fmt.Errorf("recording lookup failed: %w", err)
+	}
+
+	r.mu.RLock()
+	sim, ok := r.simulators[spec.Name]
+	r.mu.RUnlock()
+	if ok {
+		output, err := sim(ctx, caller, input)
+		return output, DryRunSimulated, err
+	}
+
+	output, err := json.Marshal(synthesize(spec.OutputSchema))
+	return output, DryRunSynthetic, err
+}
+
+// record keeps a real response for dry runs to replay; the latest response
+// to an input wins
+func (r *ToolRegistry) record(ctx context.Context, spec ToolSpec, input, output json.RawMessage) error {
+	hash, err := inputHash(input)
+	if err != nil {
+		return err
+	}
+	_, err = r.m.db.ExecContext(ctx, `
+		INSERT INTO agent_tool_recordings (name, input_hash, version, input, output)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name, input_hash) DO UPDATE
+		SET version = EXCLUDED.version, input = EXCLUDED.input, output = EXCLUDED.output,
+		    recorded_at = NOW()`,
+		spec.Name, hash, spec.Version, []byte(input), []byte(output))
+	return err
+}
+
+func (r *ToolRegistry) logDryRunCall(ctx context.Context, call DryRunCall) error {
+	output := []byte(call.Output)
+	if len(output) == 0 {
+		output = nil
+	}
+	_, err := r.m.db.ExecContext(ctx, `
+		INSERT INTO agent_dry_run_calls (run_id, tenant_id, agent_id, tool, version, input, output, source, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		call.RunID, call.TenantID, call.AgentID, call.Tool, call.Version, []byte(call.Input), output,
+		call.Source, call.Error)
+	return err
+}
+
+// DryRunCalls lists the tool calls a tenant's dry run intercepted, oldest
+// first
+func (m *Manager) DryRunCalls(ctx context.Context, tenantID, runID string) ([]DryRunCall, error) {
+	var calls []DryRunCall
+	err := sqlx.SelectContext(ctx, m.db, &calls, `
+		SELECT id, run_id, tenant_id, agent_id, tool, version, input,
+		       COALESCE(output, 'null'::jsonb) AS output, source, error, created_at
+		FROM agent_dry_run_calls WHERE run_id = $1 AND tenant_id = $2
+		ORDER BY id`, runID, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("dry run query failed: %w", err)
+	}
+	return calls, nil
+}
+
+// DryRunHandler serves GET /api/dry-runs/{run_id}, the intercepted calls
+// of one dry run. Callers see only their own tenant's calls; a platform
+// caller names the tenant with ?tenant_id=.
+func (m *Manager) DryRunHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runID := strings.TrimPrefix(r.URL.Path, "/api/dry-runs/")
+		if r.Method != http.MethodGet || runID == "" || strings.Contains(runID, "/") {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		tenantID, ok := requestTenant(w, r, r.URL.Query().Get("tenant_id"))
+		if !ok {
+			return
+		}
+		calls, err := m.DryRunCalls(r.Context(), tenantID, runID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(calls)
+	}
+}
+
+// inputHash keys recordings on the input's content, so key order and
+// whitespace do not matter
+func inputHash(input json.RawMessage) (string, error) {
+	var v any
+	if err := json.Unmarshal(input, &v); err != nil {
+		return "", fmt.Errorf("not valid JSON: %w", err)
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// synthesize builds a placeholder value from a JSON Schema, preferring the
+// schema's own const, default, examples and enum values. Tools without an
+// output schema get an empty object.
+func synthesize(schema json.RawMessage) any {
+	if len(schema) == 0 {
+		return map[string]any{}
+	}
+	var s map[string]any
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return map[string]any{}
+	}
+	return synthesizeValue(s, 0)
+}
+
+func synthesizeValue(s map[string]any, depth int) any {
+	if v, ok := s["const"]; ok {
+		return v
+	}
+	if v, ok := s["default"]; ok {
+		return v
+	}
+	if examples, ok := s["examples"].([]any); ok && len(examples) > 0 {
+		return examples[0]
+	}
+	if enum, ok := s["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alts, ok := s[key].([]any); ok && len(alts) > 0 {
+			if alt, ok := alts[0].(map[string]any); ok {
+				return synthesizeValue(alt, depth+1)
+			}
+		}
+	}
+	// recursive schemas stop here rather than loop
+	if depth > 8 {
+		return nil
+	}
+
+	typ := s["type"]
+	if types, ok := typ.([]any); ok && len(types) > 0 {
+		typ = types[0]
+	}
+	switch typ {
+	case "object":
+		obj := map[string]any{}
+		props, _ := s["properties"].(map[string]any)
+		for name, p := range props {
+			if ps, ok := p.(map[string]any); ok {
+				obj[name] = synthesizeValue(ps, depth+1)
+			}
+		}
+		return obj
+	case "array":
+		items, ok := s["items"].(map[string]any)
+		min, _ := s["minItems"].(float64)
+		arr := []any{}
+		for i := 0; ok && i < int(min); i++ {
+			arr = append(arr, synthesizeValue(items, depth+1))
+		}
+		return arr
+	case "string":
+		return ""
+	case "integer", "number":
+		if min, ok := s["minimum"].(float64); ok {
+			return min
+		}
+		return 0
+	case "boolean":
+		return false
+	case "null":
+		return nil
+	}
+	if _, ok := s["properties"]; ok {
+		return synthesizeValue(map[string]any{"type": "object", "properties": s["properties"]}, depth)
+	}
+	return nil
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_tool_recordings (
+    name        VARCHAR(255) NOT NULL,
+    input_hash  CHAR(64) NOT NULL,
+    version     INT NOT NULL,
+    input       JSONB NOT NULL,
+    output      JSONB NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (name, input_hash)
+);
+
+CREATE TABLE IF NOT EXISTS agent_dry_run_calls (
+    id         BIGSERIAL PRIMARY KEY,
+    run_id     VARCHAR(64) NOT NULL,
+    tenant_id  VARCHAR(255) NOT NULL DEFAULT '',
+    agent_id   VARCHAR(255) NOT NULL,
+    tool       VARCHAR(255) NOT NULL,
+    version    INT NOT NULL,
+    input      JSONB NOT NULL,
+    output     JSONB,
+    source     VARCHAR(16) NOT NULL,
+    error      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_agent_dry_run_calls_run ON agent_dry_run_calls (run_id, id);
+*/
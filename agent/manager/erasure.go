@@ -0,0 +1,88 @@
+// erasure.go - Right-to-Erasure Requests for Data Subjects
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"cirium.ai/core/memory"
+)
+
+// MemoryEraser erases everything memory holds about a data subject.
+// memory.MemoryAdapter satisfies it.
+type MemoryEraser interface {
+	Erase(ctx context.Context, subjectID string) (*memory.ErasureReport, error)
+}
+
+// SetMemoryEraser enables erasure requests
+func (m *Manager) SetMemoryEraser(e MemoryEraser) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eraser = e
+}
+
+func (m *Manager) getMemoryEraser() (MemoryEraser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.eraser == nil {
+		return nil, fmt.Errorf("erasure requires a memory eraser")
+	}
+	return m.eraser, nil
+}
+
+// EraseDataSubject erases subjectID's memories, vectors and audit entries
+// in tenantID and returns the signed erasure report
+func (m *Manager) EraseDataSubject(ctx context.Context, tenantID, subjectID string) (*memory.ErasureReport, error) {
+	eraser, err := m.getMemoryEraser()
+	if err != nil {
+		return nil, err
+	}
+	if tenantID == "" || subjectID == "" {
+		return nil, fmt.Errorf("erasure needs a tenant and a data subject")
+	}
+	report, err := eraser.Erase(memory.WithTenant(ctx, tenantID), subjectID)
+	if err != nil {
+		return nil, fmt.Errorf("erasure failed: %w", err)
+	}
+	slog.Info("data subject erased", "tenant_id", tenantID, "report_id", report.ReportID,
+		"records", len(report.Records), "incomplete", len(report.Incomplete))
+	return report, nil
+}
+
+// ErasureHandler serves POST /api/erasures/ with a subject_id, answering
+// with the signed erasure report. The subject is erased in the caller's
+// tenant; only platform principals name a tenant_id.
+func (m *Manager) ErasureHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/erasures/" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			TenantID  string `json:"tenant_id"`
+			SubjectID string `json:"subject_id"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.SubjectID == "" {
+			http.Error(w, "subject_id is required", http.StatusBadRequest)
+			return
+		}
+		tenantID, ok := requestTenant(w, r, req.TenantID)
+		if !ok {
+			return
+		}
+		report, err := m.EraseDataSubject(r.Context(), tenantID, req.SubjectID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
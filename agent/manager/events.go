@@ -0,0 +1,238 @@
+// events.go - Event-Sourced Agent History and Replay
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const maxEventBatch = 1000
+
+// AgentEventType names a change to an agent
+type AgentEventType string
+
+const (
+	// EventAgentCreated carries the new AgentDefinition
+	EventAgentCreated AgentEventType = "agent.created"
+	// EventStateChanged carries the new lifecycle state
+	EventStateChanged AgentEventType = "agent.state_changed"
+	// EventCheckpointed carries the ExecutionState that was saved
+	EventCheckpointed AgentEventType = "execution.checkpointed"
+	// EventToolCalled carries a ToolCallEvent
+	EventToolCalled AgentEventType = "tool.called"
+	// EventTaskFinished carries a TaskEvent
+	EventTaskFinished AgentEventType = "task.finished"
+)
+
+// AgentEvent is one entry of an agent's append-only history. Seq orders
+// events across all agents.
+type AgentEvent struct {
+	Seq       int64           `json:"seq" db:"seq"`
+	TenantID  string          `json:"tenant_id" db:"tenant_id"`
+	AgentID   string          `json:"agent_id" db:"agent_id"`
+	Type      AgentEventType  `json:"type" db:"type"`
+	Data      json.RawMessage `json:"data" db:"data"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+// stateChange is the data of EventStateChanged. The liveness sweeper
+// writes it in SQL, so keep the two in step.
+type stateChange struct {
+	State       AgentState `json:"state"`
+	ResumeState AgentState `json:"resume_state,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+// ToolCallEvent is the data of EventToolCalled
+type ToolCallEvent struct {
+	Tool    string          `json:"tool"`
+	Version int             `json:"version"`
+	Input   json.RawMessage `json:"input"`
+	Output  json.RawMessage `json:"output,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	// DryRun is the run ID when the call was intercepted
+	DryRun string `json:"dry_run,omitempty"`
+}
+
+// TaskEvent is the data of EventTaskFinished for one attempt
+type TaskEvent struct {
+	TaskID  string          `json:"task_id"`
+	Kind    string          `json:"kind"`
+	Attempt int             `json:"attempt"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// eventSubjectPrefix is where agent events are published when
+// Config.PublishEvents is set, followed by the event type
+const eventSubjectPrefix = "agent.events."
+
+// appendEvent adds an event through q, which should be the transaction
+// making the change so history and state cannot disagree
+func (m *Manager) appendEvent(ctx context.Context, q sqlx.ExecerContext, tenantID, agentID string, typ AgentEventType, data any) error {
+	if agentID == "" {
+		// work done outside any agent has no history to belong to
+		return nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("event serialization failed: %w", err)
+	}
+	query := `INSERT INTO agent_events (tenant_id, agent_id, type, data) VALUES ($1, $2, $3, $4)`
+	if m.cfg.PublishEvents {
+		query = `WITH event AS (` + query + ` RETURNING *) ` + outboxInsert("event")
+	}
+	if _, err := q.ExecContext(ctx, query, tenantID, agentID, typ, raw); err != nil {
+		return fmt.Errorf("event append failed: %w", err)
+	}
+	return nil
+}
+
+// outboxInsert copies the events returned by the CTE named src into the
+// messaging outbox
+func outboxInsert(src string) string {
+	return `INSERT INTO outbox (subject, payload)
+		SELECT '` + eventSubjectPrefix + `' || ` + src + `.type, to_jsonb(` + src + `) FROM ` + src
+}
+
+// relayEvents returns a CTE, to follow the one named src in a statement
+// that writes agent_events RETURNING *, relaying those events through the
+// outbox when Config.PublishEvents is set
+func (m *Manager) relayEvents(src string) string {
+	if !m.cfg.PublishEvents {
+		return ""
+	}
+	return `, relay AS (` + outboxInsert(src) + `)`
+}
+
+// recordEvent appends an event for a change that is already committed,
+// e.g. a tool call, logging rather than failing the caller
+func (m *Manager) recordEvent(ctx context.Context, tenantID, agentID string, typ AgentEventType, data any) {
+	if err := m.appendEvent(context.WithoutCancel(ctx), m.db, tenantID, agentID, typ, data); err != nil {
+		slog.Warn("agent event not recorded", "agent_id", agentID, "type", typ, "error", err)
+	}
+}
+
+// AgentEvents returns agentID's events after seq, oldest first
+func (m *Manager) AgentEvents(ctx context.Context, agentID string, afterSeq int64, limit int) ([]AgentEvent, error) {
+	if limit <= 0 || limit > maxEventBatch {
+		limit = maxEventBatch
+	}
+	events := []AgentEvent{}
+	err := m.db.SelectContext(ctx, &events, `
+		SELECT seq, tenant_id, agent_id, type, data, created_at
+		FROM agent_events
+		WHERE agent_id = $1 AND seq > $2
+		ORDER BY seq
+		LIMIT $3`, agentID, afterSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("agent event query failed: %w", err)
+	}
+	return events, nil
+}
+
+// AgentReplay is an agent as rebuilt from its events
+type AgentReplay struct {
+	AgentID    string           `json:"agent_id"`
+	Definition *AgentDefinition `json:"definition,omitempty"`
+	Status     AgentStatus      `json:"status"`
+	// Execution is the last checkpointed execution state
+	Execution *ExecutionState `json:"execution,omitempty"`
+	LastTask  *TaskEvent      `json:"last_task,omitempty"`
+	LastTool  *ToolCallEvent  `json:"last_tool,omitempty"`
+	// Seq and At identify the last event applied
+	Seq    int64     `json:"seq"`
+	At     time.Time `json:"at"`
+	Events int       `json:"events"`
+}
+
+// ReplayAgent rebuilds agentID from its history up to and including
+// untilSeq, or up to until, whichever comes first; zero values mean no
+// bound. Stepping either bound back shows what the agent knew and what
+// state it was in before a decision.
+func (m *Manager) ReplayAgent(ctx context.Context, agentID string, untilSeq int64, until time.Time) (AgentReplay, error) {
+	replay := AgentReplay{AgentID: agentID, Status: AgentStatus{AgentID: agentID, State: AgentHealthy}}
+	var after int64
+	for {
+		events, err := m.AgentEvents(ctx, agentID, after, maxEventBatch)
+		if err != nil {
+			return AgentReplay{}, err
+		}
+		for _, ev := range events {
+			if (untilSeq > 0 && ev.Seq > untilSeq) || (!until.IsZero() && ev.CreatedAt.After(until)) {
+				return replay, nil
+			}
+			if err := replay.apply(ev); err != nil {
+				return AgentReplay{}, fmt.Errorf("event %d: %w", ev.Seq, err)
+			}
+		}
+		if len(events) < maxEventBatch {
+			return replay, nil
+		}
+		after = events[len(events)-1].Seq
+	}
+}
+
+func (r *AgentReplay) apply(ev AgentEvent) error {
+	switch ev.Type {
+	case EventAgentCreated:
+		var def AgentDefinition
+		if err := json.Unmarshal(ev.Data, &def); err != nil {
+			return err
+		}
+		def.CreatedAt = ev.CreatedAt
+		r.Definition = &def
+	case EventStateChanged:
+		var change stateChange
+		if err := json.Unmarshal(ev.Data, &change); err != nil {
+			return err
+		}
+		r.Status.State, r.Status.ResumeState, r.Status.Reason = change.State, change.ResumeState, change.Reason
+		r.Status.UpdatedAt = ev.CreatedAt
+	case EventCheckpointed:
+		var state ExecutionState
+		if err := json.Unmarshal(ev.Data, &state); err != nil {
+			return err
+		}
+		r.Execution = &state
+	case EventTaskFinished:
+		var task TaskEvent
+		if err := json.Unmarshal(ev.Data, &task); err != nil {
+			return err
+		}
+		r.LastTask = &task
+		// a finished task leaves no execution to resume
+		if r.Execution != nil && r.Execution.TaskID == task.TaskID && task.Error == "" {
+			r.Execution = nil
+		}
+	case EventToolCalled:
+		var call ToolCallEvent
+		if err := json.Unmarshal(ev.Data, &call); err != nil {
+			return err
+		}
+		r.LastTool = &call
+	}
+	// unknown types come from newer replicas; skipping them keeps old
+	// replicas able to replay
+	r.Seq, r.At = ev.Seq, ev.CreatedAt
+	r.Events++
+	return nil
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_events (
+    seq        BIGSERIAL PRIMARY KEY,
+    tenant_id  VARCHAR(255) NOT NULL DEFAULT '',
+    agent_id   VARCHAR(255) NOT NULL,
+    type       VARCHAR(64) NOT NULL,
+    data       JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_events_agent ON agent_events (agent_id, seq);
+*/
@@ -0,0 +1,183 @@
+// lifecycle.go - Per-Agent Lifecycle State
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrInvalidTransition is returned when an agent's current state does not
+// allow the requested change
+var ErrInvalidTransition = errors.New("invalid agent state transition")
+
+// AgentState names an agent's lifecycle state, using the same names as
+// the component FSM in agent/core
+type AgentState string
+
+const (
+	AgentHealthy     AgentState = "HEALTHY"
+	AgentDegraded    AgentState = "DEGRADED"
+	AgentMaintenance AgentState = "MAINTENANCE"
+	AgentSuspended   AgentState = "SUSPENDED"
+	AgentTerminating AgentState = "TERMINATING"
+)
+
+// AgentStatus is the recorded lifecycle state of one agent. Agents without
+// a record are HEALTHY.
+type AgentStatus struct {
+	AgentID string     `json:"agent_id" db:"agent_id"`
+	State   AgentState `json:"state" db:"state"`
+	// ResumeState is where ResumeAgent returns a suspended agent
+	ResumeState AgentState `json:"resume_state,omitempty" db:"resume_state"`
+	Reason      string     `json:"reason,omitempty" db:"reason"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// GetAgentStatus returns an agent's lifecycle state
+func (m *Manager) GetAgentStatus(ctx context.Context, agentID string) (AgentStatus, error) {
+	var status AgentStatus
+	err := m.db.GetContext(ctx, &status, `
+		SELECT agent_id, state, resume_state, reason, updated_at
+		FROM agent_status WHERE agent_id = $1`, agentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AgentStatus{AgentID: agentID, State: AgentHealthy}, nil
+	}
+	if err != nil {
+		return AgentStatus{}, fmt.Errorf("agent status query failed: %w", err)
+	}
+	return status, nil
+}
+
+// PauseAgent suspends an agent: none of its tasks are claimed until it is
+// resumed, and tasks it is running lose their lease at the next heartbeat,
+// checkpoint their execution state and go back to the queue without using
+// up an attempt. Pausing a suspended agent changes only the reason.
+func (m *Manager) PauseAgent(ctx context.Context, agentID, reason string) (AgentStatus, error) {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return AgentStatus{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO agent_status (agent_id, state) VALUES ($1, 'HEALTHY')
+		ON CONFLICT (agent_id) DO NOTHING`, agentID); err != nil {
+		return AgentStatus{}, fmt.Errorf("agent status insert failed: %w", err)
+	}
+	var current struct {
+		State    AgentState `db:"state"`
+		TenantID string     `db:"tenant_id"`
+	}
+	if err := tx.GetContext(ctx, &current,
+		`SELECT state, tenant_id FROM agent_status WHERE agent_id = $1 FOR UPDATE`, agentID); err != nil {
+		return AgentStatus{}, fmt.Errorf("agent status query failed: %w", err)
+	}
+	if current.State == AgentTerminating {
+		return AgentStatus{}, fmt.Errorf("%w: %s → %s", ErrInvalidTransition, current.State, AgentSuspended)
+	}
+
+	var status AgentStatus
+	err = tx.GetContext(ctx, &status, `
+		UPDATE agent_status
+		SET state = 'SUSPENDED',
+		    resume_state = CASE WHEN state = 'SUSPENDED' THEN resume_state ELSE state END,
+		    reason = $2, updated_at = NOW()
+		WHERE agent_id = $1
+		RETURNING agent_id, state, resume_state, reason, updated_at`, agentID, reason)
+	if err != nil {
+		return AgentStatus{}, fmt.Errorf("agent pause failed: %w", err)
+	}
+	if err := m.appendEvent(ctx, tx, current.TenantID, agentID, EventStateChanged, stateChange{
+		State: status.State, ResumeState: status.ResumeState, Reason: status.Reason,
+	}); err != nil {
+		return AgentStatus{}, err
+	}
+	// hand running tasks back to the queue; their workers see the lost
+	// lease at the next heartbeat and checkpoint before stopping
+	res, err := tx.ExecContext(ctx, `
+		UPDATE agent_tasks
+		SET state = 'queued', worker = '', attempts = GREATEST(attempts - 1, 0),
+		    lease_expires_at = NULL, not_before = NOW(), updated_at = NOW()
+		WHERE agent_id = $1 AND state = 'running'`, agentID)
+	if err != nil {
+		return AgentStatus{}, fmt.Errorf("agent task release failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return AgentStatus{}, fmt.Errorf("commit failed: %w", err)
+	}
+
+	released, _ := res.RowsAffected()
+	slog.Info("agent paused", "agent_id", agentID, "reason", reason, "released_tasks", released)
+	return status, nil
+}
+
+// ResumeAgent returns a suspended agent to the state it was paused from
+// and wakes workers for its queued tasks
+func (m *Manager) ResumeAgent(ctx context.Context, agentID, reason string) (AgentStatus, error) {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return AgentStatus{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var resumed struct {
+		AgentStatus
+		TenantID string `db:"tenant_id"`
+	}
+	err = tx.GetContext(ctx, &resumed, `
+		UPDATE agent_status
+		SET state = COALESCE(NULLIF(resume_state, ''), 'HEALTHY'), resume_state = '',
+		    reason = $2, updated_at = NOW()
+		WHERE agent_id = $1 AND state = 'SUSPENDED'
+		RETURNING agent_id, tenant_id, state, resume_state, reason, updated_at`, agentID, reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		current, err := m.GetAgentStatus(ctx, agentID)
+		if err != nil {
+			return AgentStatus{}, err
+		}
+		return AgentStatus{}, fmt.Errorf("%w: %s is %s, not %s",
+			ErrInvalidTransition, agentID, current.State, AgentSuspended)
+	}
+	if err != nil {
+		return AgentStatus{}, fmt.Errorf("agent resume failed: %w", err)
+	}
+	status := resumed.AgentStatus
+	if err := m.appendEvent(ctx, tx, resumed.TenantID, agentID, EventStateChanged, stateChange{
+		State: status.State, Reason: status.Reason,
+	}); err != nil {
+		return AgentStatus{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return AgentStatus{}, fmt.Errorf("commit failed: %w", err)
+	}
+	slog.Info("agent resumed", "agent_id", agentID, "state", status.State, "reason", reason)
+
+	var kinds []string
+	if err := m.db.SelectContext(ctx, &kinds, `
+		SELECT DISTINCT kind FROM agent_tasks WHERE agent_id = $1 AND state = 'queued'`,
+		agentID); err != nil {
+		slog.Warn("resumed agent task lookup failed", "agent_id", agentID, "error", err)
+	}
+	for _, kind := range kinds {
+		m.notifyTask(ctx, Task{Kind: kind})
+	}
+	return status, nil
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_status (
+    agent_id     VARCHAR(255) PRIMARY KEY,
+    tenant_id    VARCHAR(255) NOT NULL DEFAULT '',
+    state        VARCHAR(32) NOT NULL,
+    resume_state VARCHAR(32) NOT NULL DEFAULT '',
+    reason       TEXT NOT NULL DEFAULT '',
+    -- last_heartbeat stays NULL for agents that never sent one
+    last_heartbeat TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+*/
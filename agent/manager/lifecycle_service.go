@@ -0,0 +1,98 @@
+// lifecycle_service.go - Agent Lifecycle gRPC Service
+package agent
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	agentv1 "github.com/Wavine-ai/protos/agent/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// LifecycleServer serves the operator RPCs of AgentLifecycleService over
+// the manager
+type LifecycleServer struct {
+	agentv1.UnimplementedAgentLifecycleServiceServer
+
+	m *Manager
+}
+
+func NewLifecycleServer(m *Manager) *LifecycleServer {
+	return &LifecycleServer{m: m}
+}
+
+// Register attaches the service to a gRPC server
+func (s *LifecycleServer) Register(g *grpc.Server) {
+	agentv1.RegisterAgentLifecycleServiceServer(g, s)
+}
+
+func (s *LifecycleServer) PauseAgent(ctx context.Context, req *agentv1.PauseAgentRequest) (*agentv1.AgentStateResponse, error) {
+	if req.GetAgentId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent_id is required")
+	}
+	st, err := s.m.PauseAgent(ctx, req.GetAgentId(), req.GetReason())
+	if err != nil {
+		return nil, lifecycleError("pause agent", err)
+	}
+	return stateResponse(st), nil
+}
+
+func (s *LifecycleServer) ResumeAgent(ctx context.Context, req *agentv1.ResumeAgentRequest) (*agentv1.AgentStateResponse, error) {
+	if req.GetAgentId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent_id is required")
+	}
+	st, err := s.m.ResumeAgent(ctx, req.GetAgentId(), req.GetReason())
+	if err != nil {
+		return nil, lifecycleError("resume agent", err)
+	}
+	return stateResponse(st), nil
+}
+
+func (s *LifecycleServer) CreateAgentFromTemplate(ctx context.Context, req *agentv1.CreateAgentFromTemplateRequest) (*agentv1.AgentDefinition, error) {
+	if req.GetAgentId() == "" || req.GetBlueprint() == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent_id and blueprint are required")
+	}
+	def, err := s.m.CreateAgentFromTemplate(ctx, req.GetTenantId(), req.GetAgentId(),
+		req.GetBlueprint(), int(req.GetBlueprintVersion()), req.GetParameters())
+	switch {
+	case errors.Is(err, ErrBlueprintNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrAgentExists):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrInvalidParameters):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, lifecycleError("create agent", err)
+	}
+	return &agentv1.AgentDefinition{
+		AgentId:          def.ID,
+		TenantId:         def.TenantID,
+		Blueprint:        def.Blueprint,
+		BlueprintVersion: int32(def.BlueprintVersion),
+		Parameters:       def.Parameters,
+		Prompt:           def.Prompt,
+		Tools:            def.Tools,
+		CreatedAt:        timestamppb.New(def.CreatedAt),
+	}, nil
+}
+
+func stateResponse(st AgentStatus) *agentv1.AgentStateResponse {
+	return &agentv1.AgentStateResponse{
+		AgentId:   st.AgentID,
+		State:     string(st.State),
+		Reason:    st.Reason,
+		UpdatedAt: timestamppb.New(st.UpdatedAt),
+	}
+}
+
+func lifecycleError(op string, err error) error {
+	if errors.Is(err, ErrInvalidTransition) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	slog.Error("lifecycle operation failed", "op", op, "error", err)
+	return status.Errorf(codes.Internal, "%s failed: %v", op, err)
+}
@@ -0,0 +1,212 @@
+// liveness.go - Heartbeat Liveness Detection
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultHeartbeatInterval = 10 * time.Second
+	defaultHeartbeatMisses   = 3
+
+	// heartbeatSubject matches agents.<tenant>.<agent>.heartbeat, where
+	// the messaging package's AgentClient.Heartbeat publishes
+	heartbeatSubject = "agents.*.*.heartbeat"
+	// alertSubjectPrefix is followed by the tenant ID
+	alertSubjectPrefix = "agent.alerts."
+
+	// livenessReason marks a DEGRADED state set by the sweeper, so only
+	// those are cleared by a returning heartbeat
+	livenessReason = "missed heartbeats"
+)
+
+var livenessTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_agent_liveness_transitions_total",
+	Help: "Agent state changes driven by heartbeats",
+}, []string{"state"})
+
+func init() {
+	prometheus.MustRegister(livenessTransitions)
+}
+
+// Restarter restarts an agent's runtime, e.g. through the operator
+type Restarter interface {
+	RestartAgent(ctx context.Context, tenantID, agentID string) error
+}
+
+// SetRestarter enables restarts of agents degraded for missed heartbeats
+func (m *Manager) SetRestarter(r Restarter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.restarter = r
+}
+
+func (m *Manager) getRestarter() Restarter {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.restarter
+}
+
+// SubjectNotifier is a Notifier that reports the subject each message
+// arrived on; messaging.EnterpriseNATS satisfies it. Liveness needs it
+// because only the subject, which an agent's credentials confine it to,
+// says whose heartbeat a message is.
+type SubjectNotifier interface {
+	SubscribeSubject(subject string, handler func(subject string, data []byte) error) (Subscription, error)
+}
+
+// heartbeatSender parses agents.<tenant>.<agent>.heartbeat
+func heartbeatSender(subject string) (tenantID, agentID string, ok bool) {
+	parts := strings.Split(subject, ".")
+	if len(parts) != 4 || parts[0] != "agents" || parts[3] != "heartbeat" || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+type livenessAlert struct {
+	TenantID      string     `json:"tenant_id" db:"tenant_id"`
+	AgentID       string     `json:"agent_id" db:"agent_id"`
+	State         AgentState `json:"state" db:"state"`
+	LastHeartbeat time.Time  `json:"last_heartbeat" db:"last_heartbeat"`
+	Restarted     bool       `json:"restarted" db:"-"`
+}
+
+// RunLiveness tracks agent heartbeats until ctx ends. An agent that has
+// sent at least one heartbeat and then misses HeartbeatMisses in a row
+// goes from HEALTHY to DEGRADED, an alert is published on
+// agent.alerts.<tenant> and, with a Restarter set, the agent is
+// restarted. Its next heartbeat returns it to HEALTHY. Any number of
+// replicas may run this; each silent agent is degraded exactly once.
+func (m *Manager) RunLiveness(ctx context.Context) error {
+	n, ok := m.getNotifier().(SubjectNotifier)
+	if !ok {
+		return fmt.Errorf("liveness requires a notifier that reports subjects")
+	}
+	sub, err := n.SubscribeSubject(heartbeatSubject, func(subject string, _ []byte) error {
+		tenantID, agentID, ok := heartbeatSender(subject)
+		if !ok {
+			// malformed heartbeats are dropped rather than redelivered
+			return nil
+		}
+		return m.recordHeartbeat(ctx, tenantID, agentID)
+	})
+	if err != nil {
+		return fmt.Errorf("heartbeat subscribe failed: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	ticker := time.NewTicker(m.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := m.degradeSilentAgents(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("liveness sweep failed", "error", err)
+			}
+		}
+	}
+}
+
+// recordHeartbeat notes a heartbeat and revives an agent the sweeper
+// degraded. Heartbeats naming an agent outside tenantID are dropped.
+func (m *Manager) recordHeartbeat(ctx context.Context, tenantID, agentID string) error {
+	var revived bool
+	// the revival's history event is written by the same statement
+	err := m.db.GetContext(ctx, &revived, `
+		WITH prev AS (
+		    SELECT state = 'DEGRADED' AND reason = $3 AS degraded
+		    FROM agent_status WHERE agent_id = $1
+		), beat AS (
+		    INSERT INTO agent_status (agent_id, tenant_id, state, last_heartbeat)
+		    SELECT id, tenant_id, 'HEALTHY', NOW() FROM agents WHERE id = $1 AND tenant_id = $2
+		    ON CONFLICT (agent_id) DO UPDATE SET
+		        last_heartbeat = NOW(),
+		        state = CASE WHEN agent_status.state = 'DEGRADED' AND agent_status.reason = $3
+		                     THEN 'HEALTHY' ELSE agent_status.state END,
+		        reason = CASE WHEN agent_status.state = 'DEGRADED' AND agent_status.reason = $3
+		                      THEN '' ELSE agent_status.reason END,
+		        updated_at = CASE WHEN agent_status.state = 'DEGRADED' AND agent_status.reason = $3
+		                          THEN NOW() ELSE agent_status.updated_at END
+		    WHERE agent_status.tenant_id = EXCLUDED.tenant_id
+		    RETURNING COALESCE((SELECT degraded FROM prev), false) AS revived
+		), event AS (
+		    INSERT INTO agent_events (tenant_id, agent_id, type, data)
+		    SELECT $2, $1, $4, jsonb_build_object('state', 'HEALTHY') FROM beat WHERE revived
+		    RETURNING *
+		)`+m.relayEvents("event")+`
+		SELECT revived FROM beat`,
+		agentID, tenantID, livenessReason, EventStateChanged)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Warn("heartbeat for unknown agent dropped", "tenant_id", tenantID, "agent_id", agentID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("heartbeat record failed: %w", err)
+	}
+	if revived {
+		livenessTransitions.WithLabelValues(string(AgentHealthy)).Inc()
+		slog.Info("agent heartbeat resumed", "tenant_id", tenantID, "agent_id", agentID)
+	}
+	return nil
+}
+
+// degradeSilentAgents moves HEALTHY agents whose heartbeats stopped to
+// DEGRADED
+func (m *Manager) degradeSilentAgents(ctx context.Context) error {
+	silence := m.cfg.HeartbeatInterval * time.Duration(m.cfg.HeartbeatMisses)
+	var silent []livenessAlert
+	err := m.db.SelectContext(ctx, &silent, `
+		WITH silent AS (
+		    UPDATE agent_status
+		    SET state = 'DEGRADED', reason = $2, updated_at = NOW()
+		    WHERE state = 'HEALTHY' AND last_heartbeat < NOW() - make_interval(secs => $1)
+		    RETURNING tenant_id, agent_id, state, last_heartbeat
+		), event AS (
+		    INSERT INTO agent_events (tenant_id, agent_id, type, data)
+		    SELECT tenant_id, agent_id, $3, jsonb_build_object('state', state, 'reason', $2::text)
+		    FROM silent
+		    RETURNING *
+		)`+m.relayEvents("event")+`
+		SELECT tenant_id, agent_id, state, last_heartbeat FROM silent`,
+		silence.Seconds(), livenessReason, EventStateChanged)
+	if err != nil {
+		return fmt.Errorf("silent agent update failed: %w", err)
+	}
+
+	restarter := m.getRestarter()
+	for _, alert := range silent {
+		livenessTransitions.WithLabelValues(string(AgentDegraded)).Inc()
+		slog.Error("agent missed heartbeats, degraded",
+			"tenant_id", alert.TenantID, "agent_id", alert.AgentID,
+			"last_heartbeat", alert.LastHeartbeat)
+
+		if restarter != nil {
+			if err := restarter.RestartAgent(ctx, alert.TenantID, alert.AgentID); err != nil {
+				slog.Warn("agent restart failed", "agent_id", alert.AgentID, "error", err)
+			} else {
+				alert.Restarted = true
+			}
+		}
+		if n := m.getNotifier(); n != nil {
+			if err := n.Publish(ctx, alertSubjectPrefix+alert.TenantID, alert); err != nil {
+				slog.Warn("liveness alert failed", "agent_id", alert.AgentID, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+CREATE INDEX IF NOT EXISTS idx_agent_status_heartbeat ON agent_status (last_heartbeat) WHERE state = 'HEALTHY';
+*/
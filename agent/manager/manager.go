@@ -0,0 +1,154 @@
+// manager.go - Agent Fleet Manager
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultTaskLease    = 30 * time.Second
+	defaultPollInterval = 5 * time.Second
+	defaultMaxAttempts  = 3
+)
+
+// Config tunes the manager; zero values take the defaults above
+type Config struct {
+	// WorkerID names this replica in task leases; defaults to hostname
+	// and PID
+	WorkerID string
+	// TaskLease is how long a claimed task stays with its worker without
+	// a heartbeat before another replica may take it over
+	TaskLease time.Duration
+	// PollInterval bounds how long an idle worker waits before checking
+	// the queue when no submit notification arrives
+	PollInterval time.Duration
+	// MaxAttempts applies to tasks submitted without a retry policy
+	MaxAttempts int
+	// CheckpointInterval paces background saves of execution state
+	CheckpointInterval time.Duration
+	// ShardCount splits agents into shards owned by one replica at a time
+	// (see RunShards); zero lets every replica drive every agent. Changing
+	// it requires an empty task queue.
+	ShardCount int
+	// Pricing turns metered usage into cost for spend reports and budgets
+	Pricing Pricing
+	// HeartbeatInterval is how often agents are expected to heartbeat and
+	// how often RunLiveness looks for silent ones
+	HeartbeatInterval time.Duration
+	// HeartbeatMisses is how many consecutive heartbeats an agent may miss
+	// before it is marked DEGRADED
+	HeartbeatMisses int
+	// ModelLimit is every agent's default limit on outbound model calls
+	// (see Models)
+	ModelLimit ModelLimit
+	// DrainTimeout bounds how long Drain lets running tasks finish before
+	// handing them to peer replicas
+	DrainTimeout time.Duration
+	// PublishEvents writes every agent event to the messaging outbox in
+	// the same statement as its history entry, so messaging.OutboxRelay
+	// publishes it on agent.events.<type> exactly when the change commits
+	PublishEvents bool
+}
+
+func (c Config) withDefaults() Config {
+	if c.WorkerID == "" {
+		host, _ := os.Hostname()
+		c.WorkerID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if c.TaskLease <= 0 {
+		c.TaskLease = defaultTaskLease
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
+	}
+	if c.CheckpointInterval <= 0 {
+		c.CheckpointInterval = defaultCheckpointInterval
+	}
+	if c.HeartbeatInterval <= 0 {
+		c.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if c.HeartbeatMisses <= 0 {
+		c.HeartbeatMisses = defaultHeartbeatMisses
+	}
+	if c.DrainTimeout <= 0 {
+		c.DrainTimeout = defaultDrainTimeout
+	}
+	return c
+}
+
+// Notifier carries task-submitted hints between replicas so idle workers
+// wake immediately instead of waiting for their next poll. Postgres stays
+// the source of truth; a lost notification only delays a task.
+// Any messaging.Broker satisfies it.
+type Notifier interface {
+	Publish(ctx context.Context, subject string, payload interface{}) error
+	Subscribe(subject string, handler func([]byte) error) (Subscription, error)
+}
+
+// Subscription is the handle Notifier.Subscribe returns; the alias makes
+// it the same type as messaging.Subscription
+type Subscription = interface {
+	Unsubscribe() error
+	Drain(ctx context.Context) error
+}
+
+// Manager coordinates the agent fleet of one controller replica. Replicas
+// share state through Postgres, so any number can run side by side.
+type Manager struct {
+	db  *sqlx.DB
+	cfg Config
+
+	mu          sync.RWMutex
+	notifier    Notifier
+	checkpoints CheckpointStore
+	restarter   Restarter
+	transcripts TranscriptStore
+	prompts     PromptRenderer
+	forker      MemoryForker
+	archiver    MemoryArchiver
+	archiveRoot []byte
+	eraser      MemoryEraser
+	services    []serviceCredential
+	connPolicy  ConnectionPolicy
+
+	toolsOnce sync.Once
+	tools     *ToolRegistry
+
+	modelsOnce sync.Once
+	models     *ModelGate
+
+	drainMu sync.Mutex
+	drain   drainState
+	running sync.WaitGroup
+}
+
+func NewManager(db *sql.DB, cfg Config) *Manager {
+	return &Manager{
+		db:    sqlx.NewDb(db, "postgres"),
+		cfg:   cfg.withDefaults(),
+		drain: drainState{drained: make(chan struct{}), halted: make(chan struct{})},
+	}
+}
+
+// SetNotifier enables cross-replica wakeups for task workers
+func (m *Manager) SetNotifier(n Notifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifier = n
+}
+
+func (m *Manager) getNotifier() Notifier {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.notifier
+}
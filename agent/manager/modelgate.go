@@ -0,0 +1,276 @@
+// modelgate.go - Rate Limits and Concurrency Caps for Model Calls
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+const defaultModelQueueTimeout = 30 * time.Second
+
+var (
+	// ErrModelRateLimited is returned when a model call would exceed a
+	// requests-per-minute limit and the policy sheds it
+	ErrModelRateLimited = errors.New("model call rate limited")
+	// ErrModelOverloaded is returned when a model call finds every slot
+	// busy and the policy sheds it
+	ErrModelOverloaded = errors.New("model call concurrency exhausted")
+)
+
+var (
+	modelCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_agent_model_calls_total",
+		Help: "Outbound model calls by limit scope and outcome",
+	}, []string{"scope", "outcome"})
+	modelQueueWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "Wavine_agent_model_queue_wait_seconds",
+		Help:    "Time model calls spent waiting for a slot or rate token",
+		Buckets: prometheus.ExponentialBuckets(0.005, 4, 8),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(modelCalls, modelQueueWait)
+}
+
+// ShedPolicy decides what happens to a model call over its limits
+type ShedPolicy string
+
+const (
+	// ShedQueue waits up to QueueTimeout for capacity, with at most
+	// MaxQueued calls waiting; calls beyond either are shed
+	ShedQueue ShedPolicy = "queue"
+	// ShedReject fails calls over the limits at once
+	ShedReject ShedPolicy = "reject"
+)
+
+// ModelLimit caps outbound model calls of one agent or provider key.
+// Zero limits are unlimited; the policy defaults to ShedQueue with a 30s
+// queue timeout.
+type ModelLimit struct {
+	Concurrency       int           `json:"concurrency,omitempty"`
+	RequestsPerMinute int           `json:"requests_per_minute,omitempty"`
+	Burst             int           `json:"burst,omitempty"`
+	Policy            ShedPolicy    `json:"policy,omitempty"`
+	QueueTimeout      time.Duration `json:"queue_timeout,omitempty"`
+	MaxQueued         int           `json:"max_queued,omitempty"`
+}
+
+// modelBucket enforces one ModelLimit
+type modelBucket struct {
+	limit   ModelLimit
+	slots   chan struct{}
+	limiter *rate.Limiter
+
+	mu     sync.Mutex
+	queued int
+}
+
+func newModelBucket(limit ModelLimit) *modelBucket {
+	if limit.Policy == "" {
+		limit.Policy = ShedQueue
+	}
+	if limit.QueueTimeout <= 0 {
+		limit.QueueTimeout = defaultModelQueueTimeout
+	}
+	b := &modelBucket{limit: limit}
+	if limit.Concurrency > 0 {
+		b.slots = make(chan struct{}, limit.Concurrency)
+	}
+	if limit.RequestsPerMinute > 0 {
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		b.limiter = rate.NewLimiter(rate.Limit(float64(limit.RequestsPerMinute)/60), burst)
+	}
+	return b
+}
+
+// enqueue reserves a place in the wait queue
+func (b *modelBucket) enqueue() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit.MaxQueued > 0 && b.queued >= b.limit.MaxQueued {
+		return false
+	}
+	b.queued++
+	return true
+}
+
+func (b *modelBucket) dequeue() {
+	b.mu.Lock()
+	b.queued--
+	b.mu.Unlock()
+}
+
+// acquire takes a concurrency slot and a rate token before deadline; the
+// returned func gives the slot back
+func (b *modelBucket) acquire(ctx context.Context, deadline time.Time) (func(), error) {
+	release := func() {}
+	if b.slots != nil {
+		select {
+		case b.slots <- struct{}{}:
+		default:
+			if b.limit.Policy == ShedReject || !b.enqueue() {
+				return nil, ErrModelOverloaded
+			}
+			timer := time.NewTimer(time.Until(deadline))
+			select {
+			case b.slots <- struct{}{}:
+				timer.Stop()
+				b.dequeue()
+			case <-timer.C:
+				b.dequeue()
+				return nil, ErrModelOverloaded
+			case <-ctx.Done():
+				timer.Stop()
+				b.dequeue()
+				return nil, ctx.Err()
+			}
+		}
+		release = func() { <-b.slots }
+	}
+
+	if b.limiter != nil {
+		if b.limit.Policy == ShedReject {
+			if !b.limiter.Allow() {
+				release()
+				return nil, ErrModelRateLimited
+			}
+			return release, nil
+		}
+		res := b.limiter.Reserve()
+		delay := res.Delay()
+		if !res.OK() || time.Now().Add(delay).After(deadline) {
+			res.Cancel()
+			release()
+			return nil, ErrModelRateLimited
+		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				res.Cancel()
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return release, nil
+}
+
+// ModelGate guards outbound model calls so one runaway agent cannot use up
+// a provider quota shared by the fleet. Every call passes two buckets:
+// one for the calling agent and one for the provider key it bills to.
+// Limits are held per replica; divide fleet-wide quotas by the replica
+// count when configuring keys.
+type ModelGate struct {
+	defaults ModelLimit
+
+	mu         sync.Mutex
+	agentLimit map[string]ModelLimit
+	keyLimit   map[string]ModelLimit
+	agents     map[string]*modelBucket
+	keys       map[string]*modelBucket
+}
+
+// Models returns the manager's model call gate, created on first use with
+// Config.ModelLimit as every agent's default limit
+func (m *Manager) Models() *ModelGate {
+	m.modelsOnce.Do(func() {
+		m.models = &ModelGate{
+			defaults:   m.cfg.ModelLimit,
+			agentLimit: make(map[string]ModelLimit),
+			keyLimit:   make(map[string]ModelLimit),
+			agents:     make(map[string]*modelBucket),
+			keys:       make(map[string]*modelBucket),
+		}
+	})
+	return m.models
+}
+
+// SetAgentLimit overrides the default limit for one agent
+func (g *ModelGate) SetAgentLimit(agentID string, limit ModelLimit) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.agentLimit[agentID] = limit
+	delete(g.agents, agentID)
+}
+
+// SetKeyLimit limits calls billed to a provider key. key names the key,
+// e.g. "openai:prod"; never pass the secret itself, it labels metrics.
+func (g *ModelGate) SetKeyLimit(key string, limit ModelLimit) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.keyLimit[key] = limit
+	delete(g.keys, key)
+}
+
+func (g *ModelGate) buckets(agentID, key string) (agent, provider *modelBucket) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	agent, ok := g.agents[agentID]
+	if !ok {
+		limit, ok := g.agentLimit[agentID]
+		if !ok {
+			limit = g.defaults
+		}
+		agent = newModelBucket(limit)
+		g.agents[agentID] = agent
+	}
+	provider, ok = g.keys[key]
+	if !ok {
+		// keys without a configured limit are unlimited
+		provider = newModelBucket(g.keyLimit[key])
+		g.keys[key] = provider
+	}
+	return agent, provider
+}
+
+// Do runs call once the agent's and the provider key's limits allow it.
+// Calls over a limit wait or are shed with ErrModelOverloaded or
+// ErrModelRateLimited, depending on that limit's policy.
+func (g *ModelGate) Do(ctx context.Context, agentID, key string, call func(context.Context) error) error {
+	agent, provider := g.buckets(agentID, key)
+	started := time.Now()
+
+	releaseAgent, err := agent.acquire(ctx, started.Add(agent.limit.QueueTimeout))
+	if err != nil {
+		modelCalls.WithLabelValues("agent", shedOutcome(err)).Inc()
+		return fmt.Errorf("agent %s: %w", agentID, err)
+	}
+	defer releaseAgent()
+	releaseKey, err := provider.acquire(ctx, time.Now().Add(provider.limit.QueueTimeout))
+	if err != nil {
+		modelCalls.WithLabelValues("key", shedOutcome(err)).Inc()
+		return fmt.Errorf("provider key %s: %w", key, err)
+	}
+	defer releaseKey()
+	modelQueueWait.Observe(time.Since(started).Seconds())
+
+	if err := call(ctx); err != nil {
+		modelCalls.WithLabelValues("call", "error").Inc()
+		return err
+	}
+	modelCalls.WithLabelValues("call", "ok").Inc()
+	return nil
+}
+
+func shedOutcome(err error) string {
+	switch {
+	case errors.Is(err, ErrModelRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrModelOverloaded):
+		return "overloaded"
+	}
+	return "cancelled"
+}
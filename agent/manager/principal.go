@@ -0,0 +1,274 @@
+// principal.go - Bearer Credentials and Tenant Scoping for the HTTP API
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Permission is a capability a credential carries on the HTTP API
+type Permission string
+
+const (
+	// PermAdmin implies every other permission and manages the fleet-wide
+	// blueprints and rollouts
+	PermAdmin Permission = "admin"
+	// PermAgents drives agents, tasks, workflows, sessions and dry runs
+	PermAgents Permission = "agents"
+	// PermErasure files right-to-erasure requests
+	PermErasure Permission = "erasure"
+	// PermPrompts manages prompt templates and experiments
+	PermPrompts Permission = "prompts"
+)
+
+var ErrUnauthenticated = errors.New("missing or invalid credential")
+
+// Principal is the authenticated caller of an API request. A principal
+// bound to a tenant acts only for that tenant; a platform principal, such
+// as the operator's service credential, has no tenant and names the
+// tenant on each request.
+type Principal struct {
+	Subject     string       `json:"subject"`
+	TenantID    string       `json:"tenant_id,omitempty"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// Has reports whether the principal carries perm
+func (p Principal) Has(perm Permission) bool {
+	return slices.Contains(p.Permissions, PermAdmin) || slices.Contains(p.Permissions, perm)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns ctx carrying p
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal Authenticated put on ctx
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// serviceCredential is a token loaded at startup rather than issued into
+// api_credentials, for callers that must work before any credential exists
+type serviceCredential struct {
+	digest    [sha256.Size]byte
+	principal Principal
+}
+
+// AddServiceCredential accepts token as p, e.g. the operator's mounted
+// controller token
+func (m *Manager) AddServiceCredential(token string, p Principal) error {
+	if token == "" || p.Subject == "" {
+		return fmt.Errorf("service credential needs a token and a subject")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.services = append(m.services, serviceCredential{digest: sha256.Sum256([]byte(token)), principal: p})
+	return nil
+}
+
+// IssueCredential creates a bearer token for p that expires after ttl, or
+// never when ttl is zero. Only the token's digest is stored, so the token
+// is returned exactly once.
+func (m *Manager) IssueCredential(ctx context.Context, p Principal, ttl time.Duration) (id, token string, err error) {
+	if p.Subject == "" || len(p.Permissions) == 0 {
+		return "", "", fmt.Errorf("credential needs a subject and at least one permission")
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(secret)
+	digest := sha256.Sum256([]byte(token))
+	if id, err = newTaskID(); err != nil {
+		return "", "", err
+	}
+	perms, err := json.Marshal(p.Permissions)
+	if err != nil {
+		return "", "", err
+	}
+	var expires sql.NullTime
+	if ttl > 0 {
+		expires = sql.NullTime{Time: time.Now().Add(ttl), Valid: true}
+	}
+	if _, err := m.db.ExecContext(ctx, `
+		INSERT INTO api_credentials (id, token_sha256, subject, tenant_id, permissions, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		id, digest[:], p.Subject, p.TenantID, perms, expires); err != nil {
+		return "", "", fmt.Errorf("credential insert failed: %w", err)
+	}
+	return id, token, nil
+}
+
+// RevokeCredential stops an issued credential from authenticating
+func (m *Manager) RevokeCredential(ctx context.Context, id string) error {
+	res, err := m.db.ExecContext(ctx, `
+		UPDATE api_credentials SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("credential revocation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("credential %s not found", id)
+	}
+	return nil
+}
+
+// authenticate resolves a bearer token to its principal
+func (m *Manager) authenticate(ctx context.Context, token string) (Principal, error) {
+	digest := sha256.Sum256([]byte(token))
+
+	m.mu.RLock()
+	services := m.services
+	m.mu.RUnlock()
+	for _, s := range services {
+		if subtle.ConstantTimeCompare(digest[:], s.digest[:]) == 1 {
+			return s.principal, nil
+		}
+	}
+
+	var row struct {
+		Subject     string `db:"subject"`
+		TenantID    string `db:"tenant_id"`
+		Permissions []byte `db:"permissions"`
+	}
+	err := m.db.GetContext(ctx, &row, `
+		SELECT subject, tenant_id, permissions FROM api_credentials
+		WHERE token_sha256 = $1 AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > NOW())`, digest[:])
+	if errors.Is(err, sql.ErrNoRows) {
+		return Principal{}, ErrUnauthenticated
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("credential lookup failed: %w", err)
+	}
+	p := Principal{Subject: row.Subject, TenantID: row.TenantID}
+	if err := json.Unmarshal(row.Permissions, &p.Permissions); err != nil {
+		return Principal{}, fmt.Errorf("credential %s has malformed permissions: %w", row.Subject, err)
+	}
+	return p, nil
+}
+
+// ConnectionPolicy vets the TLS session a request arrived on; a
+// qcrypto.CryptoPolicy satisfies it
+type ConnectionPolicy interface {
+	VerifyConnection(cs tls.ConnectionState) error
+}
+
+// SetConnectionPolicy makes Authenticated refuse requests whose TLS
+// session the policy rejects
+func (m *Manager) SetConnectionPolicy(p ConnectionPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connPolicy = p
+}
+
+// Authenticated admits requests whose bearer credential carries perm and
+// puts the caller's Principal on the request context
+func (m *Manager) Authenticated(perm Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.RLock()
+		policy := m.connPolicy
+		m.mu.RUnlock()
+		if policy != nil {
+			if r.TLS == nil {
+				http.Error(w, "crypto policy requires TLS", http.StatusForbidden)
+				return
+			}
+			if err := policy.VerifyConnection(*r.TLS); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="nuzon"`)
+			http.Error(w, ErrUnauthenticated.Error(), http.StatusUnauthorized)
+			return
+		}
+		p, err := m.authenticate(r.Context(), token)
+		if errors.Is(err, ErrUnauthenticated) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="nuzon"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !p.Has(perm) {
+			http.Error(w, fmt.Sprintf("%s lacks the %s permission", p.Subject, perm), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// requestTenant resolves the tenant a request acts for: the principal's
+// own tenant, or for a platform principal the tenant the request names.
+// A tenant-bound principal naming another tenant is refused. On failure
+// the error response is already written.
+func requestTenant(w http.ResponseWriter, r *http.Request, requested string) (string, bool) {
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, ErrUnauthenticated.Error(), http.StatusUnauthorized)
+		return "", false
+	}
+	switch {
+	case p.TenantID == "" && requested == "":
+		http.Error(w, "tenant_id is required", http.StatusBadRequest)
+		return "", false
+	case p.TenantID == "":
+		return requested, true
+	case requested != "" && requested != p.TenantID:
+		http.Error(w, fmt.Sprintf("%s may not act for tenant %s", p.Subject, requested), http.StatusForbidden)
+		return "", false
+	}
+	return p.TenantID, true
+}
+
+// ownedAgent loads agentID for the principal on ctx. Agents of another
+// tenant are reported as not found, so their existence does not leak.
+func (m *Manager) ownedAgent(ctx context.Context, agentID string) (AgentDefinition, error) {
+	def, err := m.GetAgent(ctx, agentID)
+	if err != nil {
+		return AgentDefinition{}, err
+	}
+	if !actsFor(ctx, def.TenantID) {
+		return AgentDefinition{}, fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+	}
+	return def, nil
+}
+
+// actsFor reports whether the principal on ctx may act for tenantID
+func actsFor(ctx context.Context, tenantID string) bool {
+	p, ok := PrincipalFrom(ctx)
+	return ok && (p.TenantID == "" || p.TenantID == tenantID)
+}
+
+/*
+CREATE TABLE IF NOT EXISTS api_credentials (
+    id           VARCHAR(64) PRIMARY KEY,
+    token_sha256 BYTEA NOT NULL UNIQUE,
+    subject      VARCHAR(255) NOT NULL,
+    tenant_id    VARCHAR(255) NOT NULL DEFAULT '',
+    permissions  JSONB NOT NULL DEFAULT '[]',
+    expires_at   TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+*/
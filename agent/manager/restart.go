@@ -0,0 +1,51 @@
+// restart.go - Agent Restarts Through the Operator
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RestartedAtAnnotation on an AIAgent is copied by the operator onto its
+// pod template, so changing it rolls the agent's pods
+const RestartedAtAnnotation = "agent.Wavine.ai/restarted-at"
+
+var aiAgentKind = schema.GroupVersionKind{Group: "ai.nuzon.io", Version: "v1alpha1", Kind: "AIAgent"}
+
+// OperatorRestarter restarts agents by stamping their AIAgent resource;
+// the AIAgent is expected to share the agent's ID as its name
+type OperatorRestarter struct {
+	client client.Client
+	// namespace maps a tenant to the namespace its agents run in
+	namespace func(tenantID string) string
+}
+
+// NewOperatorRestarter restarts agents through c. A nil namespace func
+// uses the tenant ID as the namespace.
+func NewOperatorRestarter(c client.Client, namespace func(tenantID string) string) *OperatorRestarter {
+	if namespace == nil {
+		namespace = func(tenantID string) string { return tenantID }
+	}
+	return &OperatorRestarter{client: c, namespace: namespace}
+}
+
+// RestartAgent implements Restarter
+func (r *OperatorRestarter) RestartAgent(ctx context.Context, tenantID, agentID string) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(aiAgentKind)
+	obj.SetNamespace(r.namespace(tenantID))
+	obj.SetName(agentID)
+
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`,
+		RestartedAtAnnotation, time.Now().UTC().Format(time.RFC3339))
+	if err := r.client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, []byte(patch))); err != nil {
+		return fmt.Errorf("restart of %s/%s failed: %w", obj.GetNamespace(), agentID, err)
+	}
+	return nil
+}
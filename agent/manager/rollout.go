@@ -0,0 +1,574 @@
+// rollout.go - Progressive Rollout of Blueprint Versions
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultRolloutSamples      = 50
+	defaultRolloutErrorMargin  = 0.05
+	defaultRolloutQualityDrop  = 0.05
+	defaultRolloutEvaluateEach = 30 * time.Second
+
+	// rolloutSubjectPrefix is followed by the blueprint name
+	rolloutSubjectPrefix = "agent.rollouts."
+)
+
+var (
+	// ErrRolloutNotFound is returned for unknown rollouts
+	ErrRolloutNotFound = errors.New("rollout not found")
+	// ErrRolloutActive is returned when a blueprint already has a rollout
+	// in progress
+	ErrRolloutActive = errors.New("rollout already in progress")
+)
+
+var rolloutEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_agent_rollout_events_total",
+	Help: "Blueprint rollout step, promotion and rollback events",
+}, []string{"blueprint", "event"})
+
+func init() {
+	prometheus.MustRegister(rolloutEvents)
+}
+
+// RolloutState is where a rollout stands
+type RolloutState string
+
+const (
+	RolloutRunning    RolloutState = "running"
+	RolloutPromoted   RolloutState = "promoted"
+	RolloutRolledBack RolloutState = "rolled_back"
+)
+
+// RolloutSpec describes a progressive rollout of a blueprint version.
+// Zero values take the defaults above.
+type RolloutSpec struct {
+	Blueprint string `json:"blueprint"`
+	// CanaryVersion is the version rolled out; zero picks the latest
+	CanaryVersion int `json:"canary_version,omitempty"`
+	// Steps are the percentages of new sessions sent to the canary, in
+	// order; the last step should be 100. Default: 5, 25, 50, 100.
+	Steps []int `json:"steps,omitempty"`
+	// MinSamples is how many canary outcomes each step needs before it is
+	// judged
+	MinSamples int `json:"min_samples,omitempty"`
+	// MaxErrorRateIncrease is how far the canary's error rate may exceed
+	// the base version's before it is rolled back
+	MaxErrorRateIncrease float64 `json:"max_error_rate_increase,omitempty"`
+	// MaxQualityDrop is how far the canary's mean quality score may fall
+	// below the base version's before it is rolled back
+	MaxQualityDrop float64 `json:"max_quality_drop,omitempty"`
+}
+
+// VersionStats are the outcomes a version collected in the current step
+type VersionStats struct {
+	Samples        int     `json:"samples" db:"samples"`
+	Errors         int     `json:"errors" db:"errors"`
+	QualitySum     float64 `json:"quality_sum" db:"quality_sum"`
+	QualitySamples int     `json:"quality_samples" db:"quality_samples"`
+}
+
+// ErrorRate is the share of samples that failed
+func (s VersionStats) ErrorRate() float64 {
+	if s.Samples == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Samples)
+}
+
+// Quality is the mean quality score, and whether any were reported
+func (s VersionStats) Quality() (float64, bool) {
+	if s.QualitySamples == 0 {
+		return 0, false
+	}
+	return s.QualitySum / float64(s.QualitySamples), true
+}
+
+// RolloutSteps are canary percentages, stored as a JSON array
+type RolloutSteps []int
+
+// Value implements driver.Valuer
+func (s RolloutSteps) Value() (driver.Value, error) {
+	return json.Marshal([]int(s))
+}
+
+// Scan implements sql.Scanner
+func (s *RolloutSteps) Scan(src any) error {
+	data, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("rollout steps: unexpected %T", src)
+	}
+	return json.Unmarshal(data, (*[]int)(s))
+}
+
+// Rollout is a blueprint version being rolled out
+type Rollout struct {
+	ID            string       `json:"id" db:"id"`
+	Blueprint     string       `json:"blueprint" db:"blueprint"`
+	BaseVersion   int          `json:"base_version" db:"base_version"`
+	CanaryVersion int          `json:"canary_version" db:"canary_version"`
+	Steps         RolloutSteps `json:"steps" db:"steps"`
+	Step          int          `json:"step" db:"step"`
+	MinSamples    int          `json:"min_samples" db:"min_samples"`
+	MaxErrorRate  float64      `json:"max_error_rate_increase" db:"max_error_rate_increase"`
+	MaxQuality    float64      `json:"max_quality_drop" db:"max_quality_drop"`
+	State         RolloutState `json:"state" db:"state"`
+	Reason        string       `json:"reason,omitempty" db:"reason"`
+	CreatedAt     time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at" db:"updated_at"`
+
+	Base   VersionStats `json:"base" db:"-"`
+	Canary VersionStats `json:"canary" db:"-"`
+}
+
+// Percent is the share of new sessions currently sent to the canary
+func (r Rollout) Percent() int {
+	switch {
+	case r.State == RolloutPromoted:
+		return 100
+	case r.State == RolloutRolledBack || len(r.Steps) == 0:
+		return 0
+	}
+	return r.Steps[r.Step]
+}
+
+// StartRollout begins sending a share of new sessions to a blueprint
+// version. The base is the version sessions get today.
+func (m *Manager) StartRollout(ctx context.Context, spec RolloutSpec) (Rollout, error) {
+	if len(spec.Steps) == 0 {
+		spec.Steps = []int{5, 25, 50, 100}
+	}
+	for i, p := range spec.Steps {
+		if p <= 0 || p > 100 || (i > 0 && p <= spec.Steps[i-1]) {
+			return Rollout{}, fmt.Errorf("rollout steps must rise within 1-100, got %v", spec.Steps)
+		}
+	}
+	if spec.MinSamples <= 0 {
+		spec.MinSamples = defaultRolloutSamples
+	}
+	if spec.MaxErrorRateIncrease <= 0 {
+		spec.MaxErrorRateIncrease = defaultRolloutErrorMargin
+	}
+	if spec.MaxQualityDrop <= 0 {
+		spec.MaxQualityDrop = defaultRolloutQualityDrop
+	}
+
+	canary, err := m.GetBlueprint(ctx, spec.Blueprint, spec.CanaryVersion)
+	if err != nil {
+		return Rollout{}, err
+	}
+	base, err := m.stableVersion(ctx, spec.Blueprint)
+	if err != nil {
+		return Rollout{}, err
+	}
+	if base == canary.Version {
+		return Rollout{}, fmt.Errorf("%s v%d is already serving", spec.Blueprint, base)
+	}
+
+	id, err := newTaskID()
+	if err != nil {
+		return Rollout{}, err
+	}
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Rollout{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	// the partial unique index allows one running rollout per blueprint
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO agent_rollouts (id, blueprint, base_version, canary_version, steps, step,
+		                            min_samples, max_error_rate_increase, max_quality_drop, state)
+		VALUES ($1, $2, $3, $4, $5, 0, $6, $7, $8, 'running')
+		ON CONFLICT (blueprint) WHERE state = 'running' DO NOTHING`,
+		id, spec.Blueprint, base, canary.Version, RolloutSteps(spec.Steps),
+		spec.MinSamples, spec.MaxErrorRateIncrease, spec.MaxQualityDrop)
+	if err != nil {
+		return Rollout{}, fmt.Errorf("rollout insert failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Rollout{}, fmt.Errorf("%w: %s", ErrRolloutActive, spec.Blueprint)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO agent_rollout_stats (rollout_id, version) VALUES ($1, $2), ($1, $3)`,
+		id, base, canary.Version); err != nil {
+		return Rollout{}, fmt.Errorf("rollout stats insert failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Rollout{}, fmt.Errorf("commit failed: %w", err)
+	}
+
+	slog.Info("blueprint rollout started", "rollout_id", id, "blueprint", spec.Blueprint,
+		"base", base, "canary", canary.Version, "percent", spec.Steps[0])
+	rolloutEvents.WithLabelValues(spec.Blueprint, "started").Inc()
+	return m.GetRollout(ctx, id)
+}
+
+// stableVersion is the version a blueprint's sessions get outside a
+// rollout: the outcome of its last finished rollout, or the latest
+// version for blueprints never rolled out. Once a blueprint has been
+// rolled out, newer versions only reach sessions through a rollout.
+func (m *Manager) stableVersion(ctx context.Context, blueprint string) (int, error) {
+	var version int
+	err := m.db.GetContext(ctx, &version, `
+		SELECT CASE WHEN state = 'promoted' THEN canary_version ELSE base_version END
+		FROM agent_rollouts WHERE blueprint = $1 AND state <> 'running'
+		ORDER BY updated_at DESC LIMIT 1`, blueprint)
+	if errors.Is(err, sql.ErrNoRows) {
+		b, err := m.GetBlueprint(ctx, blueprint, 0)
+		return b.Version, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("stable version query failed: %w", err)
+	}
+	return version, nil
+}
+
+// RouteSession picks the blueprint version a new session runs, or a new
+// agent is created from. During a rollout a session lands on the canary
+// with the current step's probability; the choice is stable for a
+// session ID.
+func (m *Manager) RouteSession(ctx context.Context, blueprint, sessionID string) (int, error) {
+	var r Rollout
+	err := m.db.GetContext(ctx, &r, `
+		SELECT id, blueprint, base_version, canary_version, steps, step, min_samples,
+		       max_error_rate_increase, max_quality_drop, state, reason, created_at, updated_at
+		FROM agent_rollouts WHERE blueprint = $1 AND state = 'running'`, blueprint)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m.stableVersion(ctx, blueprint)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("rollout query failed: %w", err)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(r.ID + "\x00" + sessionID))
+	if int(h.Sum32()%100) < r.Percent() {
+		return r.CanaryVersion, nil
+	}
+	return r.BaseVersion, nil
+}
+
+// RecordOutcome adds a session or task result to a running rollout's
+// stats. quality is an optional score in [0, 1] from an evaluator or user
+// feedback. Outcomes for blueprints without a running rollout are
+// dropped.
+func (m *Manager) RecordOutcome(ctx context.Context, blueprint string, version int, failed bool, quality *float64) error {
+	if quality != nil && (*quality < 0 || *quality > 1) {
+		return fmt.Errorf("quality score %v outside [0, 1]", *quality)
+	}
+	_, err := m.db.ExecContext(ctx, `
+		UPDATE agent_rollout_stats s
+		SET samples = samples + 1,
+		    errors = errors + CASE WHEN $3 THEN 1 ELSE 0 END,
+		    quality_sum = quality_sum + COALESCE($4, 0),
+		    quality_samples = quality_samples + CASE WHEN $4 IS NULL THEN 0 ELSE 1 END
+		FROM agent_rollouts r
+		WHERE r.blueprint = $1 AND r.state = 'running'
+		  AND s.rollout_id = r.id AND s.version = $2`,
+		blueprint, version, failed, quality)
+	if err != nil {
+		return fmt.Errorf("rollout outcome record failed: %w", err)
+	}
+	return nil
+}
+
+// recordTaskOutcome counts a finished task against the blueprint version
+// its agent was created from
+func (m *Manager) recordTaskOutcome(ctx context.Context, agentID string, taskErr error) {
+	_, err := m.db.ExecContext(ctx, `
+		UPDATE agent_rollout_stats s
+		SET samples = samples + 1, errors = errors + CASE WHEN $2 THEN 1 ELSE 0 END
+		FROM agents a, agent_rollouts r
+		WHERE a.id = $1 AND r.blueprint = a.blueprint AND r.state = 'running'
+		  AND s.rollout_id = r.id AND s.version = a.blueprint_version`,
+		agentID, taskErr != nil)
+	if err != nil {
+		slog.Warn("rollout outcome not recorded", "agent_id", agentID, "error", err)
+	}
+}
+
+// GetRollout returns a rollout and its current step's stats
+func (m *Manager) GetRollout(ctx context.Context, id string) (Rollout, error) {
+	return m.getRollout(ctx, m.db, id, false)
+}
+
+func (m *Manager) getRollout(ctx context.Context, q sqlx.QueryerContext, id string, lock bool) (Rollout, error) {
+	query := `
+		SELECT id, blueprint, base_version, canary_version, steps, step, min_samples,
+		       max_error_rate_increase, max_quality_drop, state, reason, created_at, updated_at
+		FROM agent_rollouts WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	var r Rollout
+	err := sqlx.GetContext(ctx, q, &r, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Rollout{}, fmt.Errorf("%w: %s", ErrRolloutNotFound, id)
+	}
+	if err != nil {
+		return Rollout{}, fmt.Errorf("rollout query failed: %w", err)
+	}
+	if err := sqlx.GetContext(ctx, q, &r.Base, `
+		SELECT samples, errors, quality_sum, quality_samples
+		FROM agent_rollout_stats WHERE rollout_id = $1 AND version = $2`,
+		id, r.BaseVersion); err != nil {
+		return Rollout{}, fmt.Errorf("rollout stats query failed: %w", err)
+	}
+	if err := sqlx.GetContext(ctx, q, &r.Canary, `
+		SELECT samples, errors, quality_sum, quality_samples
+		FROM agent_rollout_stats WHERE rollout_id = $1 AND version = $2`,
+		id, r.CanaryVersion); err != nil {
+		return Rollout{}, fmt.Errorf("rollout stats query failed: %w", err)
+	}
+	return r, nil
+}
+
+// ListRollouts returns a blueprint's rollouts, newest first
+func (m *Manager) ListRollouts(ctx context.Context, blueprint string) ([]Rollout, error) {
+	var ids []string
+	if err := m.db.SelectContext(ctx, &ids, `
+		SELECT id FROM agent_rollouts WHERE blueprint = $1
+		ORDER BY created_at DESC LIMIT 50`, blueprint); err != nil {
+		return nil, fmt.Errorf("rollout listing failed: %w", err)
+	}
+	rollouts := make([]Rollout, 0, len(ids))
+	for _, id := range ids {
+		r, err := m.GetRollout(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		rollouts = append(rollouts, r)
+	}
+	return rollouts, nil
+}
+
+// PromoteRollout finishes a rollout in the canary's favour right away
+func (m *Manager) PromoteRollout(ctx context.Context, id, reason string) (Rollout, error) {
+	return m.finishRollout(ctx, id, RolloutPromoted, reason)
+}
+
+// RollbackRollout returns every new session to the base version
+func (m *Manager) RollbackRollout(ctx context.Context, id, reason string) (Rollout, error) {
+	return m.finishRollout(ctx, id, RolloutRolledBack, reason)
+}
+
+func (m *Manager) finishRollout(ctx context.Context, id string, state RolloutState, reason string) (Rollout, error) {
+	res, err := m.db.ExecContext(ctx, `
+		UPDATE agent_rollouts SET state = $2, reason = $3, updated_at = NOW()
+		WHERE id = $1 AND state = 'running'`, id, state, reason)
+	if err != nil {
+		return Rollout{}, fmt.Errorf("rollout update failed: %w", err)
+	}
+	r, err := m.GetRollout(ctx, id)
+	if err != nil {
+		return Rollout{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Rollout{}, fmt.Errorf("%w: rollout %s is %s", ErrInvalidTransition, id, r.State)
+	}
+	m.announceRollout(ctx, r, string(state))
+	return r, nil
+}
+
+// RunRollouts judges running rollouts until ctx ends. A step whose canary
+// has MinSamples outcomes either advances to the next step, with fresh
+// stats for both versions, or rolls back when the canary errs or scores
+// worse than the base by more than the rollout allows. Passing the last
+// step promotes the canary.
+func (m *Manager) RunRollouts(ctx context.Context) error {
+	ticker := time.NewTicker(defaultRolloutEvaluateEach)
+	defer ticker.Stop()
+	for {
+		var ids []string
+		if err := m.db.SelectContext(ctx, &ids,
+			`SELECT id FROM agent_rollouts WHERE state = 'running'`); err != nil && ctx.Err() == nil {
+			slog.Error("rollout sweep failed", "error", err)
+		}
+		for _, id := range ids {
+			if err := m.evaluateRollout(ctx, id); err != nil && ctx.Err() == nil {
+				slog.Warn("rollout evaluation failed", "rollout_id", id, "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Manager) evaluateRollout(ctx context.Context, id string) error {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	r, err := m.getRollout(ctx, tx, id, true)
+	if err != nil {
+		return err
+	}
+	if r.State != RolloutRunning || r.Canary.Samples < r.MinSamples {
+		return nil
+	}
+
+	event, reason := "advanced", ""
+	if d := r.Canary.ErrorRate() - r.Base.ErrorRate(); d > r.MaxErrorRate {
+		event, reason = "rolled_back", fmt.Sprintf("error rate %.1f%% above base", d*100)
+	} else if cq, ok := r.Canary.Quality(); ok {
+		if bq, ok := r.Base.Quality(); ok && bq-cq > r.MaxQuality {
+			event, reason = "rolled_back", fmt.Sprintf("quality %.3f below base", bq-cq)
+		}
+	}
+	if event == "advanced" && r.Step == len(r.Steps)-1 {
+		event, reason = "promoted", "passed every step"
+	}
+
+	switch event {
+	case "advanced":
+		_, err = tx.ExecContext(ctx, `
+			UPDATE agent_rollouts SET step = step + 1, updated_at = NOW() WHERE id = $1`, id)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE agent_rollout_stats
+				SET samples = 0, errors = 0, quality_sum = 0, quality_samples = 0
+				WHERE rollout_id = $1`, id)
+		}
+	default:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE agent_rollouts SET state = $2, reason = $3, updated_at = NOW()
+			WHERE id = $1`, id, event, reason)
+	}
+	if err != nil {
+		return fmt.Errorf("rollout update failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+
+	if r, err = m.GetRollout(ctx, id); err != nil {
+		return err
+	}
+	m.announceRollout(ctx, r, event)
+	return nil
+}
+
+func (m *Manager) announceRollout(ctx context.Context, r Rollout, event string) {
+	rolloutEvents.WithLabelValues(r.Blueprint, event).Inc()
+	attrs := []any{"rollout_id", r.ID, "blueprint", r.Blueprint, "base", r.BaseVersion,
+		"canary", r.CanaryVersion, "percent", r.Percent(), "reason", r.Reason}
+	if event == string(RolloutRolledBack) {
+		slog.Warn("blueprint rollout rolled back", attrs...)
+	} else {
+		slog.Info("blueprint rollout "+strings.ReplaceAll(event, "_", " "), attrs...)
+	}
+	if n := m.getNotifier(); n != nil {
+		if err := n.Publish(ctx, rolloutSubjectPrefix+r.Blueprint, r); err != nil {
+			slog.Warn("rollout notification failed", "rollout_id", r.ID, "error", err)
+		}
+	}
+}
+
+// RolloutHandler serves /api/rollouts/:
+//
+//	POST /api/rollouts/                  start a rollout
+//	GET  /api/rollouts/?blueprint=name   list a blueprint's rollouts
+//	GET  /api/rollouts/{id}              one rollout with its stats
+//	POST /api/rollouts/{id}/promote      promote now
+//	POST /api/rollouts/{id}/rollback     roll back now
+//
+// Like blueprints, rollouts affect every tenant and take the admin
+// permission.
+func (m *Manager) RolloutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/rollouts/"), "/")
+
+		var (
+			body any
+			err  error
+		)
+		switch {
+		case r.Method == http.MethodPost && id == "":
+			var spec RolloutSpec
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&spec); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			body, err = m.StartRollout(r.Context(), spec)
+			if err == nil {
+				w.WriteHeader(http.StatusCreated)
+			}
+		case r.Method == http.MethodGet && id == "":
+			body, err = m.ListRollouts(r.Context(), r.URL.Query().Get("blueprint"))
+		case r.Method == http.MethodGet && action == "":
+			body, err = m.GetRollout(r.Context(), id)
+		case r.Method == http.MethodPost && action == "promote":
+			body, err = m.PromoteRollout(r.Context(), id, "promoted manually")
+		case r.Method == http.MethodPost && action == "rollback":
+			body, err = m.RollbackRollout(r.Context(), id, "rolled back manually")
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrRolloutNotFound), errors.Is(err, ErrBlueprintNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, ErrRolloutActive), errors.Is(err, ErrInvalidTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_rollouts (
+    id                      VARCHAR(64) PRIMARY KEY,
+    blueprint               VARCHAR(255) NOT NULL,
+    base_version            INT NOT NULL,
+    canary_version          INT NOT NULL,
+    steps                   JSONB NOT NULL,
+    step                    INT NOT NULL DEFAULT 0,
+    min_samples             INT NOT NULL,
+    max_error_rate_increase DOUBLE PRECISION NOT NULL,
+    max_quality_drop        DOUBLE PRECISION NOT NULL,
+    state                   VARCHAR(16) NOT NULL,
+    reason                  TEXT NOT NULL DEFAULT '',
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_agent_rollouts_running ON agent_rollouts (blueprint) WHERE state = 'running';
+CREATE INDEX IF NOT EXISTS idx_agent_rollouts_blueprint ON agent_rollouts (blueprint, updated_at DESC);
+
+CREATE TABLE IF NOT EXISTS agent_rollout_stats (
+    rollout_id      VARCHAR(64) NOT NULL REFERENCES agent_rollouts(id) ON DELETE CASCADE,
+    version         INT NOT NULL,
+    samples         INT NOT NULL DEFAULT 0,
+    errors          INT NOT NULL DEFAULT 0,
+    quality_sum     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    quality_samples INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (rollout_id, version)
+);
+*/
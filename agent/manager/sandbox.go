@@ -0,0 +1,467 @@
+// sandbox.go - WASM Sandbox for Untrusted Tools
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// RuntimeWASM is the ToolSpec runtime served by Sandbox. Its Target is the
+// "sha256:<hex>" digest returned by UploadModule.
+const RuntimeWASM = "wasm"
+
+const (
+	defaultSandboxMemoryMB   = 64
+	defaultSandboxTimeout    = 10 * time.Second
+	defaultSandboxOutput     = 1 << 20
+	defaultSandboxConcurrent = 16
+
+	maxKVValue = 64 << 10
+	wasmPageMB = 16 // 64KiB pages per MiB
+)
+
+// Host call results below zero; a non-negative result is the number of
+// bytes written to the guest buffer
+const (
+	hostDenied   int32 = -1
+	hostFailed   int32 = -2
+	hostTooLarge int32 = -3
+	hostNotFound int32 = -4
+)
+
+// ErrModuleDigest is returned when a stored module no longer matches its
+// digest
+var ErrModuleDigest = errors.New("module digest mismatch")
+
+// SandboxPolicy is what a tool may do inside the sandbox. Limits above the
+// sandbox's own maximums are clamped.
+type SandboxPolicy struct {
+	MemoryMB  int `json:"memory_mb,omitempty"`
+	TimeoutMS int `json:"timeout_ms,omitempty"`
+	// HTTPHosts are the hostnames reachable over HTTPS via http_request
+	HTTPHosts []string `json:"http_hosts,omitempty"`
+	// KV grants kv_get and kv_put on a store private to the tool and tenant
+	KV bool `json:"kv,omitempty"`
+}
+
+// SandboxConfig bounds every sandboxed invocation
+type SandboxConfig struct {
+	MaxMemoryMB    int
+	MaxTimeout     time.Duration
+	MaxOutputBytes int
+	MaxConcurrent  int
+}
+
+func (c SandboxConfig) withDefaults() SandboxConfig {
+	if c.MaxMemoryMB <= 0 {
+		c.MaxMemoryMB = defaultSandboxMemoryMB
+	}
+	if c.MaxTimeout <= 0 {
+		c.MaxTimeout = defaultSandboxTimeout
+	}
+	if c.MaxOutputBytes <= 0 {
+		c.MaxOutputBytes = defaultSandboxOutput
+	}
+	if c.MaxConcurrent <= 0 {
+		c.MaxConcurrent = defaultSandboxConcurrent
+	}
+	return c
+}
+
+// ToolAuditor receives a record of every sandboxed invocation.
+// auditor.EnterpriseAuditor satisfies it.
+type ToolAuditor interface {
+	RecordToolCall(ctx context.Context, tenantID, agentID, tool string, version int, err error)
+}
+
+// Sandbox runs tools compiled to WASI modules. A module reads its JSON
+// input from stdin and writes its JSON result to stdout; it has no
+// filesystem, environment or clock beyond what WASI fakes, and reaches the
+// outside world only through the host functions its policy grants.
+//
+// Host functions, imported from module "agent":
+//
+//	http_request(req_ptr, req_len, out_ptr, out_cap) i32
+//	kv_get(key_ptr, key_len, out_ptr, out_cap) i32
+//	kv_put(key_ptr, key_len, val_ptr, val_len) i32
+type Sandbox struct {
+	m       *Manager
+	cfg     SandboxConfig
+	auditor ToolAuditor
+	cache   wazero.CompilationCache
+	slots   chan struct{}
+
+	mu      sync.RWMutex
+	modules map[string][]byte
+}
+
+// NewSandbox creates the WASM runtime and registers it with the manager's
+// tool registry. auditor may be nil, in which case invocations are only
+// logged.
+func NewSandbox(m *Manager, cfg SandboxConfig, auditor ToolAuditor) *Sandbox {
+	cfg = cfg.withDefaults()
+	s := &Sandbox{
+		m:       m,
+		cfg:     cfg,
+		auditor: auditor,
+		cache:   wazero.NewCompilationCache(),
+		slots:   make(chan struct{}, cfg.MaxConcurrent),
+		modules: make(map[string][]byte),
+	}
+	m.Tools().SetExecutor(RuntimeWASM, s)
+	return s
+}
+
+// Close releases compiled modules
+func (s *Sandbox) Close(ctx context.Context) error {
+	return s.cache.Close(ctx)
+}
+
+// UploadModule stores a compiled module and returns the digest tools
+// reference it by
+func (s *Sandbox) UploadModule(ctx context.Context, wasm []byte) (string, error) {
+	sum := sha256.Sum256(wasm)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	// compiling rejects invalid modules before a tool can point at them
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCompilationCache(s.cache))
+	defer r.Close(ctx)
+	if _, err := r.CompileModule(ctx, wasm); err != nil {
+		return "", fmt.Errorf("invalid module: %w", err)
+	}
+
+	if _, err := s.m.db.ExecContext(ctx,
+		`INSERT INTO agent_tool_modules (digest, module) VALUES ($1, $2)
+		 ON CONFLICT (digest) DO NOTHING`, digest, wasm); err != nil {
+		return "", fmt.Errorf("module upload failed: %w", err)
+	}
+	return digest, nil
+}
+
+func (s *Sandbox) module(ctx context.Context, digest string) ([]byte, error) {
+	s.mu.RLock()
+	wasm, ok := s.modules[digest]
+	s.mu.RUnlock()
+	if ok {
+		return wasm, nil
+	}
+
+	err := s.m.db.QueryRowContext(ctx,
+		`SELECT module FROM agent_tool_modules WHERE digest = $1`, digest).Scan(&wasm)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("module %s not found", digest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("module query failed: %w", err)
+	}
+	sum := sha256.Sum256(wasm)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("%w: %s", ErrModuleDigest, digest)
+	}
+
+	s.mu.Lock()
+	s.modules[digest] = wasm
+	s.mu.Unlock()
+	return wasm, nil
+}
+
+// Execute runs one invocation in a fresh instance under the tool's limits
+func (s *Sandbox) Execute(ctx context.Context, tool ToolSpec, caller Caller, input json.RawMessage) (output json.RawMessage, err error) {
+	start := time.Now()
+	var hostCalls atomic.Int32
+	defer func() {
+		s.audit(ctx, tool, caller, time.Since(start), int(hostCalls.Load()), err)
+	}()
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	wasm, err := s.module(ctx, tool.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := tool.Sandbox
+	memoryMB := s.cfg.MaxMemoryMB
+	if policy.MemoryMB > 0 && policy.MemoryMB < memoryMB {
+		memoryMB = policy.MemoryMB
+	}
+	timeout := s.cfg.MaxTimeout
+	if t := time.Duration(policy.TimeoutMS) * time.Millisecond; t > 0 && t < timeout {
+		timeout = t
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCompilationCache(s.cache).
+		WithMemoryLimitPages(uint32(memoryMB*wasmPageMB)).
+		WithCloseOnContextDone(true))
+	defer r.Close(context.Background())
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		return nil, fmt.Errorf("wasi setup failed: %w", err)
+	}
+	host := &sandboxHost{s: s, tool: tool, caller: caller, calls: &hostCalls}
+	if err := host.instantiate(ctx, r); err != nil {
+		return nil, fmt.Errorf("host module setup failed: %w", err)
+	}
+
+	compiled, err := r.CompileModule(ctx, wasm)
+	if err != nil {
+		return nil, fmt.Errorf("module compilation failed: %w", err)
+	}
+
+	stdout := &limitedBuffer{max: s.cfg.MaxOutputBytes}
+	stderr := &limitedBuffer{max: 4 << 10}
+	mod, err := r.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(stdout).
+		WithStderr(stderr))
+	if mod != nil {
+		mod.Close(context.Background())
+	}
+
+	var exit *sys.ExitError
+	switch {
+	case errors.As(err, &exit) && exit.ExitCode() == 0:
+	case errors.As(err, &exit) && exit.ExitCode() == sys.ExitCodeDeadlineExceeded:
+		return nil, fmt.Errorf("tool exceeded %s time limit", timeout)
+	case errors.As(err, &exit) && exit.ExitCode() == sys.ExitCodeContextCanceled:
+		return nil, context.Canceled
+	case errors.As(err, &exit):
+		return nil, fmt.Errorf("tool exited with code %d: %s", exit.ExitCode(), stderr.String())
+	case err != nil:
+		return nil, fmt.Errorf("tool trapped: %w", err)
+	}
+	if stdout.overflow {
+		return nil, fmt.Errorf("tool output exceeds %d bytes", s.cfg.MaxOutputBytes)
+	}
+	return json.RawMessage(stdout.Bytes()), nil
+}
+
+func (s *Sandbox) audit(ctx context.Context, tool ToolSpec, caller Caller, took time.Duration, hostCalls int, err error) {
+	attrs := []any{"tool", tool.Name, "version", tool.Version, "tenant_id", caller.TenantID,
+		"agent_id", caller.AgentID, "duration", took, "host_calls", hostCalls}
+	if err != nil {
+		slog.Warn("sandboxed tool failed", append(attrs, "error", err)...)
+	} else {
+		slog.Info("sandboxed tool invoked", attrs...)
+	}
+	if s.auditor != nil {
+		s.auditor.RecordToolCall(context.WithoutCancel(ctx), caller.TenantID, caller.AgentID, tool.Name, tool.Version, err)
+	}
+}
+
+// sandboxHost serves the host functions of one invocation
+type sandboxHost struct {
+	s      *Sandbox
+	tool   ToolSpec
+	caller Caller
+	calls  *atomic.Int32
+}
+
+func (h *sandboxHost) instantiate(ctx context.Context, r wazero.Runtime) error {
+	_, err := r.NewHostModuleBuilder("agent").
+		NewFunctionBuilder().WithFunc(h.httpRequest).Export("http_request").
+		NewFunctionBuilder().WithFunc(h.kvGet).Export("kv_get").
+		NewFunctionBuilder().WithFunc(h.kvPut).Export("kv_put").
+		Instantiate(ctx)
+	return err
+}
+
+type sandboxRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    []byte            `json:"body,omitempty"`
+}
+
+type sandboxResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    []byte            `json:"body,omitempty"`
+}
+
+func (h *sandboxHost) httpRequest(ctx context.Context, mod api.Module, reqPtr, reqLen, outPtr, outCap uint32) int32 {
+	h.calls.Add(1)
+	raw, ok := mod.Memory().Read(reqPtr, reqLen)
+	if !ok {
+		return hostFailed
+	}
+	var req sandboxRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return hostFailed
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil || !h.hostAllowed(target) {
+		slog.Warn("sandboxed tool http denied", "tool", h.tool.Name, "url", req.URL)
+		return hostDenied
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, target.String(), bytes.NewReader(req.Body))
+	if err != nil {
+		return hostFailed
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	client := &http.Client{
+		CheckRedirect: func(next *http.Request, _ []*http.Request) error {
+			if !h.hostAllowed(next.URL) {
+				return fmt.Errorf("redirect to %s not permitted", next.URL.Host)
+			}
+			return nil
+		},
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return hostFailed
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(outCap)+1))
+	if err != nil {
+		return hostFailed
+	}
+	out := sandboxResponse{Status: resp.StatusCode, Headers: make(map[string]string), Body: body}
+	for k := range resp.Header {
+		out.Headers[k] = resp.Header.Get(k)
+	}
+	encoded, err := json.Marshal(out)
+	if err != nil {
+		return hostFailed
+	}
+	return writeGuest(mod, outPtr, outCap, encoded)
+}
+
+func (h *sandboxHost) hostAllowed(u *url.URL) bool {
+	if u.Scheme != "https" {
+		return false
+	}
+	for _, host := range h.tool.Sandbox.HTTPHosts {
+		if u.Hostname() == host {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *sandboxHost) kvGet(ctx context.Context, mod api.Module, keyPtr, keyLen, outPtr, outCap uint32) int32 {
+	h.calls.Add(1)
+	if !h.tool.Sandbox.KV {
+		return hostDenied
+	}
+	key, ok := mod.Memory().Read(keyPtr, keyLen)
+	if !ok {
+		return hostFailed
+	}
+	var value []byte
+	err := h.s.m.db.QueryRowContext(ctx,
+		`SELECT value FROM agent_tool_kv WHERE tenant_id = $1 AND tool = $2 AND key = $3`,
+		h.caller.TenantID, h.tool.Name, string(key)).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return hostNotFound
+	}
+	if err != nil {
+		slog.Warn("sandbox kv read failed", "tool", h.tool.Name, "error", err)
+		return hostFailed
+	}
+	return writeGuest(mod, outPtr, outCap, value)
+}
+
+func (h *sandboxHost) kvPut(ctx context.Context, mod api.Module, keyPtr, keyLen, valPtr, valLen uint32) int32 {
+	h.calls.Add(1)
+	if !h.tool.Sandbox.KV {
+		return hostDenied
+	}
+	if valLen > maxKVValue {
+		return hostTooLarge
+	}
+	key, ok := mod.Memory().Read(keyPtr, keyLen)
+	if !ok {
+		return hostFailed
+	}
+	value, ok := mod.Memory().Read(valPtr, valLen)
+	if !ok {
+		return hostFailed
+	}
+	if _, err := h.s.m.db.ExecContext(ctx,
+		`INSERT INTO agent_tool_kv (tenant_id, tool, key, value, updated_at)
+		 VALUES ($1, $2, $3, $4, NOW())
+		 ON CONFLICT (tenant_id, tool, key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()`,
+		h.caller.TenantID, h.tool.Name, string(key), value); err != nil {
+		slog.Warn("sandbox kv write failed", "tool", h.tool.Name, "error", err)
+		return hostFailed
+	}
+	return 0
+}
+
+func writeGuest(mod api.Module, ptr, capacity uint32, data []byte) int32 {
+	if uint32(len(data)) > capacity {
+		return hostTooLarge
+	}
+	if !mod.Memory().Write(ptr, data) {
+		return hostFailed
+	}
+	return int32(len(data))
+}
+
+// limitedBuffer keeps the first max bytes written and notes any overflow
+// rather than failing the guest's write
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.overflow = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_tool_modules (
+    digest     VARCHAR(80) PRIMARY KEY,
+    module     BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS agent_tool_kv (
+    tenant_id  VARCHAR(255) NOT NULL,
+    tool       VARCHAR(255) NOT NULL,
+    key        TEXT NOT NULL,
+    value      BYTEA NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, tool, key)
+);
+*/
@@ -0,0 +1,692 @@
+// sessions.go - Conversation Sessions
+package agent
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cirium.ai/core/memory"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultSessionTTL      = 24 * time.Hour
+	maxSessionReadBatch    = 500
+	sessionStreamPoll      = time.Second
+	sessionNamespacePrefix = "session/"
+)
+
+var (
+	// ErrSessionNotFound is returned for unknown or deleted sessions
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionClosed is returned when appending to a session that is
+	// closed or past its TTL
+	ErrSessionClosed = errors.New("session closed")
+	// ErrNotParticipant is returned when a message's sender is neither a
+	// participant nor the session's agent
+	ErrNotParticipant = errors.New("not a session participant")
+)
+
+// TranscriptStore keeps session transcripts as append-only memory
+// namespaces. memory.MemoryAdapter satisfies it.
+type TranscriptStore interface {
+	CreateNamespace(ctx context.Context, namespace, ownerAgentID string) error
+	AppendShared(ctx context.Context, namespace, agentID string, data any) (int64, error)
+	ReadShared(ctx context.Context, namespace, agentID string, afterSeq int64, limit int) ([]memory.SharedMemory, error)
+}
+
+// SetTranscriptStore enables sessions
+func (m *Manager) SetTranscriptStore(s TranscriptStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transcripts = s
+}
+
+func (m *Manager) getTranscripts() (TranscriptStore, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.transcripts == nil {
+		return nil, fmt.Errorf("sessions require a transcript store")
+	}
+	return m.transcripts, nil
+}
+
+// SessionState is where a session stands
+type SessionState string
+
+const (
+	SessionActive  SessionState = "active"
+	SessionClosed  SessionState = "closed"
+	SessionExpired SessionState = "expired"
+)
+
+// Session is a conversation between participants and one agent. Its
+// transcript lives in the memory namespace named by Transcript; LastSeq
+// is the sequence of its newest message, from which clients resume.
+type Session struct {
+	ID           string          `json:"id" db:"id"`
+	TenantID     string          `json:"tenant_id" db:"tenant_id"`
+	AgentID      string          `json:"agent_id" db:"agent_id"`
+	Participants SessionMembers  `json:"participants" db:"participants"`
+	Transcript   string          `json:"transcript" db:"transcript"`
+	State        SessionState    `json:"state" db:"state"`
+	Metadata     json.RawMessage `json:"metadata,omitempty" db:"metadata"`
+	LastSeq      int64           `json:"last_seq" db:"last_seq"`
+	// TTL is how long the session stays open after its last message
+	TTL       Duration  `json:"ttl" db:"ttl_seconds"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// SessionMembers are a session's participant IDs, stored as a JSON array
+type SessionMembers []string
+
+// Scan implements sql.Scanner
+func (s *SessionMembers) Scan(src any) error {
+	data, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("session participants: unexpected %T", src)
+	}
+	return json.Unmarshal(data, (*[]string)(s))
+}
+
+// Duration is a time.Duration kept as whole seconds in Postgres and as a
+// Go duration string in JSON
+type Duration time.Duration
+
+// Scan implements sql.Scanner
+func (d *Duration) Scan(src any) error {
+	n, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("duration: unexpected %T", src)
+	}
+	*d = Duration(time.Duration(n) * time.Second)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// seconds is d in whole seconds, rounded up so a sub-second TTL does not
+// store as zero and expire its session at once
+func (d Duration) seconds() int64 {
+	return int64((time.Duration(d) + time.Second - 1) / time.Second)
+}
+
+// SessionSpec creates a session
+type SessionSpec struct {
+	TenantID     string          `json:"tenant_id"`
+	AgentID      string          `json:"agent_id"`
+	Participants []string        `json:"participants,omitempty"`
+	Metadata     json.RawMessage `json:"metadata,omitempty"`
+	TTL          Duration        `json:"ttl,omitempty"`
+}
+
+// SessionMessage is one transcript entry
+type SessionMessage struct {
+	Seq int64 `json:"seq,omitempty"`
+	// Role is e.g. "user", "agent", "tool" or "system"
+	Role string `json:"role"`
+	// Participant identifies the sender within its role
+	Participant string          `json:"participant,omitempty"`
+	Content     json.RawMessage `json:"content"`
+	SentAt      time.Time       `json:"sent_at"`
+}
+
+const sessionColumns = `id, tenant_id, agent_id, participants, transcript, state, metadata,
+	last_seq, ttl_seconds, expires_at, created_at, updated_at`
+
+// CreateSession opens a session and its transcript namespace, owned by
+// the session's agent, which must belong to the session's tenant
+func (m *Manager) CreateSession(ctx context.Context, spec SessionSpec) (Session, error) {
+	store, err := m.getTranscripts()
+	if err != nil {
+		return Session{}, err
+	}
+	if spec.AgentID == "" {
+		return Session{}, fmt.Errorf("session needs an agent")
+	}
+	def, err := m.GetAgent(ctx, spec.AgentID)
+	if err != nil {
+		return Session{}, err
+	}
+	if def.TenantID != spec.TenantID {
+		return Session{}, fmt.Errorf("%w: %s", ErrAgentNotFound, spec.AgentID)
+	}
+	if spec.TTL <= 0 {
+		spec.TTL = Duration(defaultSessionTTL)
+	}
+	if spec.Participants == nil {
+		spec.Participants = []string{}
+	}
+	if len(spec.Metadata) == 0 {
+		spec.Metadata = json.RawMessage("{}")
+	}
+	participants, err := json.Marshal(spec.Participants)
+	if err != nil {
+		return Session{}, err
+	}
+	id, err := newTaskID()
+	if err != nil {
+		return Session{}, err
+	}
+	transcript := sessionNamespacePrefix + id
+
+	if err := store.CreateNamespace(memory.WithTenant(ctx, spec.TenantID), transcript, spec.AgentID); err != nil {
+		return Session{}, fmt.Errorf("transcript creation failed: %w", err)
+	}
+	var s Session
+	err = m.db.GetContext(ctx, &s, `
+		INSERT INTO agent_sessions (id, tenant_id, agent_id, participants, transcript, state,
+		                            metadata, ttl_seconds, expires_at)
+		VALUES ($1, $2, $3, $4, $5, 'active', $6, $7, NOW() + make_interval(secs => $7))
+		RETURNING `+sessionColumns,
+		id, spec.TenantID, spec.AgentID, participants, transcript, []byte(spec.Metadata),
+		spec.TTL.seconds())
+	if err != nil {
+		return Session{}, fmt.Errorf("session insert failed: %w", err)
+	}
+	slog.Info("session created", "session_id", id, "tenant_id", spec.TenantID, "agent_id", spec.AgentID)
+	return s, nil
+}
+
+// GetSession returns a session; sessions past their TTL read as expired
+func (m *Manager) GetSession(ctx context.Context, id string) (Session, error) {
+	return m.getSession(ctx, m.db, id, false)
+}
+
+func (m *Manager) getSession(ctx context.Context, q sqlx.QueryerContext, id string, lock bool) (Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM agent_sessions WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	var s Session
+	err := sqlx.GetContext(ctx, q, &s, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("session query failed: %w", err)
+	}
+	if s.State == SessionActive && time.Now().After(s.ExpiresAt) {
+		s.State = SessionExpired
+	}
+	return s, nil
+}
+
+// ListSessions returns a tenant's sessions, newest activity first,
+// optionally only those of one agent
+func (m *Manager) ListSessions(ctx context.Context, tenantID, agentID string, limit int) ([]Session, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	sessions := []Session{}
+	if err := m.db.SelectContext(ctx, &sessions, `
+		SELECT `+sessionColumns+` FROM agent_sessions
+		WHERE tenant_id = $1 AND ($2 = '' OR agent_id = $2)
+		ORDER BY updated_at DESC LIMIT $3`, tenantID, agentID, limit); err != nil {
+		return nil, fmt.Errorf("session listing failed: %w", err)
+	}
+	for i := range sessions {
+		if sessions[i].State == SessionActive && time.Now().After(sessions[i].ExpiresAt) {
+			sessions[i].State = SessionExpired
+		}
+	}
+	return sessions, nil
+}
+
+// SessionUpdate changes a session's mutable fields; nil fields are kept
+type SessionUpdate struct {
+	Participants *[]string       `json:"participants,omitempty"`
+	Metadata     json.RawMessage `json:"metadata,omitempty"`
+	TTL          *Duration       `json:"ttl,omitempty"`
+}
+
+// UpdateSession applies an update. A new TTL counts from now.
+func (m *Manager) UpdateSession(ctx context.Context, id string, u SessionUpdate) (Session, error) {
+	var participants []byte
+	if u.Participants != nil {
+		var err error
+		if participants, err = json.Marshal(*u.Participants); err != nil {
+			return Session{}, err
+		}
+	}
+	var ttl sql.NullInt64
+	if u.TTL != nil {
+		if *u.TTL <= 0 {
+			return Session{}, fmt.Errorf("session ttl must be positive")
+		}
+		ttl = sql.NullInt64{Int64: u.TTL.seconds(), Valid: true}
+	}
+	var s Session
+	err := m.db.GetContext(ctx, &s, `
+		UPDATE agent_sessions SET
+		    participants = COALESCE($2, participants),
+		    metadata = COALESCE($3, metadata),
+		    ttl_seconds = COALESCE($4, ttl_seconds),
+		    expires_at = CASE WHEN $4::BIGINT IS NULL THEN expires_at
+		                      ELSE NOW() + make_interval(secs => $4) END,
+		    updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+sessionColumns,
+		id, participants, []byte(u.Metadata), ttl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("session update failed: %w", err)
+	}
+	return s, nil
+}
+
+// CloseSession stops a session taking messages; its transcript stays
+// readable and ResumeSession reopens it
+func (m *Manager) CloseSession(ctx context.Context, id string) (Session, error) {
+	return m.setSessionState(ctx, id, SessionClosed, `state = 'active'`)
+}
+
+// ResumeSession reopens a closed or expired session for another TTL.
+// Clients continue the conversation after the returned LastSeq.
+func (m *Manager) ResumeSession(ctx context.Context, id string) (Session, error) {
+	return m.setSessionState(ctx, id, SessionActive, `TRUE`)
+}
+
+func (m *Manager) setSessionState(ctx context.Context, id string, state SessionState, guard string) (Session, error) {
+	var s Session
+	err := m.db.GetContext(ctx, &s, `
+		UPDATE agent_sessions SET state = $2, updated_at = NOW(),
+		    expires_at = CASE WHEN $2 = 'active' THEN NOW() + make_interval(secs => ttl_seconds)
+		                      ELSE expires_at END
+		WHERE id = $1 AND `+guard+`
+		RETURNING `+sessionColumns, id, state)
+	if errors.Is(err, sql.ErrNoRows) {
+		current, err := m.GetSession(ctx, id)
+		if err != nil {
+			return Session{}, err
+		}
+		return Session{}, fmt.Errorf("%w: session %s is %s", ErrInvalidTransition, id, current.State)
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("session update failed: %w", err)
+	}
+	slog.Info("session "+string(state), "session_id", id)
+	return s, nil
+}
+
+// DeleteSession removes a session. Its transcript entries age out of
+// memory under the namespace's retention.
+func (m *Manager) DeleteSession(ctx context.Context, id string) error {
+	res, err := m.db.ExecContext(ctx, `DELETE FROM agent_sessions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("session delete failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return nil
+}
+
+// AppendMessage adds a message to an active session's transcript and
+// extends its TTL. The message's Participant must be one of the session's
+// participants or its agent. The returned message carries its sequence.
+func (m *Manager) AppendMessage(ctx context.Context, id string, msg SessionMessage) (SessionMessage, error) {
+	store, err := m.getTranscripts()
+	if err != nil {
+		return SessionMessage{}, err
+	}
+	if msg.Role == "" || len(msg.Content) == 0 {
+		return SessionMessage{}, fmt.Errorf("message needs a role and content")
+	}
+
+	// the row lock orders appends so last_seq only moves forward
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return SessionMessage{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	s, err := m.getSession(ctx, tx, id, true)
+	if err != nil {
+		return SessionMessage{}, err
+	}
+	if s.State != SessionActive {
+		return SessionMessage{}, fmt.Errorf("%w: %s is %s", ErrSessionClosed, id, s.State)
+	}
+	if msg.Participant != s.AgentID && !slices.Contains(s.Participants, msg.Participant) {
+		return SessionMessage{}, fmt.Errorf("%w: %q in %s", ErrNotParticipant, msg.Participant, id)
+	}
+
+	msg.Seq = 0
+	msg.SentAt = time.Now().UTC()
+	seq, err := store.AppendShared(memory.WithTenant(ctx, s.TenantID), s.Transcript, s.AgentID, msg)
+	if err != nil {
+		return SessionMessage{}, fmt.Errorf("transcript append failed: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE agent_sessions
+		SET last_seq = $2, updated_at = NOW(), expires_at = NOW() + make_interval(secs => ttl_seconds)
+		WHERE id = $1`, id, seq); err != nil {
+		return SessionMessage{}, fmt.Errorf("session update failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return SessionMessage{}, fmt.Errorf("commit failed: %w", err)
+	}
+	msg.Seq = seq
+	return msg, nil
+}
+
+// ReadMessages returns up to limit transcript messages after afterSeq,
+// oldest first
+func (m *Manager) ReadMessages(ctx context.Context, id string, afterSeq int64, limit int) ([]SessionMessage, error) {
+	store, err := m.getTranscripts()
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.GetSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxSessionReadBatch {
+		limit = maxSessionReadBatch
+	}
+	entries, err := store.ReadShared(memory.WithTenant(ctx, s.TenantID), s.Transcript, s.AgentID, afterSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("transcript read failed: %w", err)
+	}
+	msgs := make([]SessionMessage, 0, len(entries))
+	for _, e := range entries {
+		var msg SessionMessage
+		if err := json.Unmarshal(e.Data, &msg); err != nil {
+			return nil, fmt.Errorf("transcript entry %d: %w", e.Seq, err)
+		}
+		msg.Seq = e.Seq
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// SessionHandler serves /api/sessions/:
+//
+//	POST   /api/sessions/                          create a session
+//	GET    /api/sessions/?tenant_id=&agent_id=      list sessions
+//	GET    /api/sessions/{id}                      one session
+//	PATCH  /api/sessions/{id}                      update participants, metadata or TTL
+//	DELETE /api/sessions/{id}                      delete
+//	POST   /api/sessions/{id}/close                close
+//	POST   /api/sessions/{id}/resume               reopen
+//	GET    /api/sessions/{id}/messages?after=N     read the transcript
+//	POST   /api/sessions/{id}/messages             append a stream of NDJSON
+//	                                               messages, acknowledged one
+//	                                               NDJSON line each
+//	GET    /api/sessions/{id}/stream?after=N       follow the transcript as
+//	                                               server-sent events
+//
+// Callers reach only the sessions of their own tenant. A tenant-bound
+// caller appends messages as itself; only a platform caller relaying for
+// others names each message's participant.
+func (m *Manager) SessionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/sessions/"), "/")
+		if id != "" {
+			if _, err := m.ownedSession(r.Context(), id); err != nil {
+				http.Error(w, err.Error(), sessionErrorStatus(err))
+				return
+			}
+		}
+
+		switch {
+		case action == "messages" && r.Method == http.MethodPost:
+			m.appendStream(w, r, id)
+			return
+		case action == "stream" && r.Method == http.MethodGet:
+			m.followStream(w, r, id)
+			return
+		}
+
+		var (
+			body any
+			err  error
+		)
+		status := http.StatusOK
+		switch {
+		case r.Method == http.MethodPost && id == "":
+			var spec SessionSpec
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&spec); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			tenantID, ok := requestTenant(w, r, spec.TenantID)
+			if !ok {
+				return
+			}
+			spec.TenantID = tenantID
+			body, err = m.CreateSession(r.Context(), spec)
+			status = http.StatusCreated
+		case r.Method == http.MethodGet && id == "":
+			q := r.URL.Query()
+			tenantID, ok := requestTenant(w, r, q.Get("tenant_id"))
+			if !ok {
+				return
+			}
+			limit, _ := strconv.Atoi(q.Get("limit"))
+			body, err = m.ListSessions(r.Context(), tenantID, q.Get("agent_id"), limit)
+		case r.Method == http.MethodGet && action == "":
+			body, err = m.GetSession(r.Context(), id)
+		case r.Method == http.MethodPatch && action == "":
+			var u SessionUpdate
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&u); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			body, err = m.UpdateSession(r.Context(), id, u)
+		case r.Method == http.MethodDelete && action == "":
+			if err = m.DeleteSession(r.Context(), id); err == nil {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		case r.Method == http.MethodPost && action == "close":
+			body, err = m.CloseSession(r.Context(), id)
+		case r.Method == http.MethodPost && action == "resume":
+			body, err = m.ResumeSession(r.Context(), id)
+		case r.Method == http.MethodGet && action == "messages":
+			q := r.URL.Query()
+			after, _ := strconv.ParseInt(q.Get("after"), 10, 64)
+			limit, _ := strconv.Atoi(q.Get("limit"))
+			body, err = m.ReadMessages(r.Context(), id, after, limit)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), sessionErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func sessionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrAgentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrSessionClosed), errors.Is(err, ErrInvalidTransition):
+		return http.StatusConflict
+	case errors.Is(err, memory.ErrNamespaceAccess), errors.Is(err, ErrNotParticipant):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// appendStream appends NDJSON messages as they arrive, answering each
+// with its stored form or an error line; the first error ends the stream
+func (m *Manager) appendStream(w http.ResponseWriter, r *http.Request, id string) {
+	p, _ := PrincipalFrom(r.Context())
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var msg SessionMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			enc.Encode(map[string]string{"error": "invalid message: " + err.Error()})
+			return
+		}
+		if p.TenantID != "" {
+			msg.Participant = p.Subject
+		}
+		stored, err := m.AppendMessage(r.Context(), id, msg)
+		if err != nil {
+			enc.Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		enc.Encode(stored)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if err := scanner.Err(); err != nil && r.Context().Err() == nil {
+		enc.Encode(map[string]string{"error": err.Error()})
+	}
+}
+
+// followStream sends transcript messages after the requested sequence, or
+// the Last-Event-ID on reconnect, and keeps following new ones
+func (m *Manager) followStream(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	after, _ := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			after = n
+		}
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(sessionStreamPoll)
+	defer ticker.Stop()
+	for {
+		msgs, err := m.ReadMessages(r.Context(), id, after, maxSessionReadBatch)
+		if err != nil {
+			if r.Context().Err() == nil {
+				fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+				flusher.Flush()
+			}
+			return
+		}
+		for _, msg := range msgs {
+			data, _ := json.Marshal(msg)
+			fmt.Fprintf(w, "id: %d\nevent: message\ndata: %s\n\n", msg.Seq, data)
+			after = msg.Seq
+		}
+		if len(msgs) > 0 {
+			flusher.Flush()
+		}
+		if len(msgs) == maxSessionReadBatch {
+			continue
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ownedSession loads id for the principal on ctx; sessions of another
+// tenant are reported as not found
+func (m *Manager) ownedSession(ctx context.Context, id string) (Session, error) {
+	s, err := m.GetSession(ctx, id)
+	if err != nil {
+		return Session{}, err
+	}
+	if !actsFor(ctx, s.TenantID) {
+		return Session{}, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return s, nil
+}
+
+// RunSessions marks sessions past their TTL expired until ctx ends
+func (m *Manager) RunSessions(ctx context.Context) error {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		res, err := m.db.ExecContext(ctx, `
+			UPDATE agent_sessions SET state = 'expired', updated_at = NOW()
+			WHERE state = 'active' AND expires_at < NOW()`)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("session expiry sweep failed", "error", err)
+		} else if err == nil {
+			if n, _ := res.RowsAffected(); n > 0 {
+				slog.Info("sessions expired", "count", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_sessions (
+    id           VARCHAR(64) PRIMARY KEY,
+    tenant_id    VARCHAR(255) NOT NULL DEFAULT '',
+    agent_id     VARCHAR(255) NOT NULL,
+    participants JSONB NOT NULL DEFAULT '[]',
+    transcript   VARCHAR(255) NOT NULL,
+    state        VARCHAR(16) NOT NULL,
+    metadata     JSONB NOT NULL DEFAULT '{}',
+    last_seq     BIGINT NOT NULL DEFAULT 0,
+    ttl_seconds  BIGINT NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_sessions_tenant ON agent_sessions (tenant_id, agent_id, updated_at DESC);
+CREATE INDEX IF NOT EXISTS idx_agent_sessions_expiry ON agent_sessions (expires_at) WHERE state = 'active';
+*/
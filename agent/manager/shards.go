@@ -0,0 +1,269 @@
+// shards.go - Agent Shard Ownership Across Replicas
+package agent
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+)
+
+const (
+	shardKeyPrefix   = "agents/shards/"
+	replicaKeyPrefix = "agents/replicas/"
+
+	defaultShardSessionTTL = 10 // seconds
+	defaultRebalanceEvery  = 5 * time.Second
+)
+
+// shardOf maps an agent to its shard. With sharding disabled every agent
+// is in shard 0.
+func (m *Manager) shardOf(agentID string) int {
+	if m.cfg.ShardCount <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(agentID))
+	return int(h.Sum32() % uint32(m.cfg.ShardCount))
+}
+
+// ownedShardFilter restricts a query on agent_tasks to shards held by the
+// worker bound to placeholder; empty when sharding is off
+func (m *Manager) ownedShardFilter(placeholder string) string {
+	if m.cfg.ShardCount <= 0 {
+		return ""
+	}
+	return ` AND shard IN (SELECT shard FROM agent_shards WHERE owner = ` + placeholder + `)`
+}
+
+// RunShards keeps this replica's share of agent shards until ctx ends.
+// Replicas announce themselves in etcd and each holds at most
+// ceil(shards/replicas) shards, taking free ones and releasing extras as
+// replicas come and go. A shard is held through a key bound to the
+// replica's etcd session, so a dead replica's shards free up when its
+// lease expires.
+//
+// Ownership is fenced in Postgres: the etcd revision that granted a shard
+// is recorded with it, a takeover only succeeds with a newer revision, and
+// tasks still running under the previous owner are handed back to the
+// queue. Claims and heartbeats check the recorded owner, so a replica that
+// lost a shard cannot keep driving its agents.
+func (m *Manager) RunShards(ctx context.Context, cli *clientv3.Client) error {
+	if m.cfg.ShardCount <= 0 {
+		return fmt.Errorf("sharding not configured")
+	}
+	for {
+		err := m.holdShards(ctx, cli)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		slog.Warn("shard session ended, rejoining", "worker", m.cfg.WorkerID, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// holdShards runs one etcd session: it ends, and every shard key with it,
+// when the session's lease is lost
+func (m *Manager) holdShards(ctx context.Context, cli *clientv3.Client) error {
+	session, err := concurrency.NewSession(cli,
+		concurrency.WithTTL(defaultShardSessionTTL), concurrency.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("etcd session failed: %w", err)
+	}
+	defer session.Close()
+
+	self := m.cfg.WorkerID
+	if _, err := cli.Put(ctx, replicaKeyPrefix+self, self, clientv3.WithLease(session.Lease())); err != nil {
+		return fmt.Errorf("replica registration failed: %w", err)
+	}
+	slog.Info("joined agent shard group", "worker", self, "shards", m.cfg.ShardCount)
+
+	watch := cli.Watch(ctx, replicaKeyPrefix, clientv3.WithPrefix())
+	ticker := time.NewTicker(defaultRebalanceEvery)
+	defer ticker.Stop()
+	for {
+		if err := m.rebalance(ctx, cli, session); err != nil && ctx.Err() == nil {
+			slog.Warn("shard rebalance failed", "worker", self, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			m.releaseAll(context.Background(), cli)
+			return ctx.Err()
+		case <-session.Done():
+			return fmt.Errorf("etcd session expired")
+		case <-watch:
+		case <-ticker.C:
+		}
+	}
+}
+
+// rebalance brings the shards this replica holds to its fair share
+func (m *Manager) rebalance(ctx context.Context, cli *clientv3.Client, session *concurrency.Session) error {
+	self := m.cfg.WorkerID
+
+	replicas, err := cli.Get(ctx, replicaKeyPrefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return fmt.Errorf("replica listing failed: %w", err)
+	}
+	owners, err := cli.Get(ctx, shardKeyPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return fmt.Errorf("shard listing failed: %w", err)
+	}
+
+	held := make(map[int]bool, len(owners.Kvs))
+	var mine []int
+	for _, kv := range owners.Kvs {
+		shard, err := strconv.Atoi(strings.TrimPrefix(string(kv.Key), shardKeyPrefix))
+		if err != nil {
+			continue
+		}
+		held[shard] = true
+		if string(kv.Value) == self {
+			mine = append(mine, shard)
+		}
+	}
+
+	count := int(replicas.Count)
+	if count < 1 {
+		count = 1
+	}
+	target := (m.cfg.ShardCount + count - 1) / count
+
+	for len(mine) > target {
+		shard := mine[len(mine)-1]
+		mine = mine[:len(mine)-1]
+		if err := m.releaseShard(ctx, cli, shard); err != nil {
+			return err
+		}
+	}
+	for shard := 0; shard < m.cfg.ShardCount && len(mine) < target; shard++ {
+		if held[shard] {
+			continue
+		}
+		ok, err := m.acquireShard(ctx, cli, session, shard)
+		if err != nil {
+			return err
+		}
+		if ok {
+			mine = append(mine, shard)
+		}
+	}
+	return nil
+}
+
+// acquireShard takes a free shard. The etcd revision of the claim becomes
+// the shard's fencing token in Postgres.
+func (m *Manager) acquireShard(ctx context.Context, cli *clientv3.Client, session *concurrency.Session, shard int) (bool, error) {
+	key := shardKeyPrefix + strconv.Itoa(shard)
+	resp, err := cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, m.cfg.WorkerID, clientv3.WithLease(session.Lease()))).
+		Commit()
+	if err != nil {
+		return false, fmt.Errorf("shard %d claim failed: %w", shard, err)
+	}
+	if !resp.Succeeded {
+		return false, nil
+	}
+	fence := resp.Header.Revision
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO agent_shards (shard, owner, fence, updated_at) VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (shard) DO UPDATE SET owner = EXCLUDED.owner, fence = EXCLUDED.fence, updated_at = NOW()
+		WHERE agent_shards.fence < EXCLUDED.fence`,
+		shard, m.cfg.WorkerID, fence)
+	if err != nil {
+		return false, fmt.Errorf("shard %d fencing failed: %w", shard, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// a newer claim already landed; ours is stale
+		cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", fence)).
+			Then(clientv3.OpDelete(key)).
+			Commit()
+		return false, nil
+	}
+	// the previous owner's tasks go back to the queue; its heartbeats and
+	// completions now fail the owner check and it stops driving them
+	taken, err := tx.ExecContext(ctx, `
+		UPDATE agent_tasks
+		SET state = 'queued', worker = '', attempts = GREATEST(attempts - 1, 0),
+		    lease_expires_at = NULL, not_before = NOW(), updated_at = NOW()
+		WHERE shard = $1 AND state = 'running' AND worker <> $2`, shard, m.cfg.WorkerID)
+	if err != nil {
+		return false, fmt.Errorf("shard %d task takeover failed: %w", shard, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit failed: %w", err)
+	}
+
+	requeued, _ := taken.RowsAffected()
+	slog.Info("agent shard acquired", "shard", shard, "worker", m.cfg.WorkerID,
+		"fence", fence, "requeued_tasks", requeued)
+	return true, nil
+}
+
+// releaseShard gives a shard up for another replica to take
+func (m *Manager) releaseShard(ctx context.Context, cli *clientv3.Client, shard int) error {
+	// keep the row and its fence so a delayed, older claim cannot win
+	if _, err := m.db.ExecContext(ctx, `
+		UPDATE agent_shards SET owner = '', updated_at = NOW()
+		WHERE shard = $1 AND owner = $2`, shard, m.cfg.WorkerID); err != nil {
+		return fmt.Errorf("shard %d release failed: %w", shard, err)
+	}
+	key := shardKeyPrefix + strconv.Itoa(shard)
+	if _, err := cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", m.cfg.WorkerID)).
+		Then(clientv3.OpDelete(key)).
+		Commit(); err != nil {
+		return fmt.Errorf("shard %d release failed: %w", shard, err)
+	}
+	slog.Info("agent shard released", "shard", shard, "worker", m.cfg.WorkerID)
+	return nil
+}
+
+// releaseAll hands every shard back on shutdown so survivors take over
+// without waiting for the lease to expire
+func (m *Manager) releaseAll(ctx context.Context, cli *clientv3.Client) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var shards []int
+	if err := m.db.SelectContext(ctx, &shards,
+		`SELECT shard FROM agent_shards WHERE owner = $1`, m.cfg.WorkerID); err != nil {
+		slog.Warn("shard release on shutdown failed", "error", err)
+		return
+	}
+	for _, shard := range shards {
+		if err := m.releaseShard(ctx, cli, shard); err != nil {
+			slog.Warn("shard release on shutdown failed", "shard", shard, "error", err)
+		}
+	}
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_shards (
+    shard      INT PRIMARY KEY,
+    owner      VARCHAR(255) NOT NULL,
+    fence      BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_tasks_shard ON agent_tasks (shard) WHERE state = 'running';
+*/
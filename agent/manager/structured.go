@@ -0,0 +1,202 @@
+// structured.go - Schema-Checked Model Output with Bounded Repair
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultMaxRepairs = 2
+
+// ErrInvalidOutput is returned when a model's response still fails its
+// schema after every repair attempt
+var ErrInvalidOutput = errors.New("model output does not match schema")
+
+var structuredOutputs = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_agent_structured_outputs_total",
+	Help: "Schema-checked model responses by outcome",
+}, []string{"outcome"})
+
+func init() {
+	prometheus.MustRegister(structuredOutputs)
+}
+
+// Generator produces a model completion for a prompt. Implementations
+// report the tokens each completion used with MeterTokens.
+type Generator interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// ConstrainedGenerator is a Generator whose backend can restrict decoding
+// to a JSON Schema, e.g. through a JSON mode or grammar sampling. Its
+// responses are still validated, since backends support schemas unevenly.
+type ConstrainedGenerator interface {
+	Generator
+	GenerateJSON(ctx context.Context, prompt string, schema json.RawMessage) (string, error)
+}
+
+// OutputSpec declares the response a prompt must produce
+type OutputSpec struct {
+	// Schema is a JSON Schema document the response must match
+	Schema json.RawMessage `json:"schema"`
+	// MaxRepairs bounds how often the model is re-asked after an invalid
+	// response; zero uses the default of 2 and a negative value disables
+	// re-asking
+	MaxRepairs int `json:"max_repairs,omitempty"`
+	// Key is the provider key the calls bill to, for the model gate
+	Key string `json:"key,omitempty"`
+}
+
+// StructuredOutput is a response that matched its schema
+type StructuredOutput struct {
+	Value json.RawMessage `json:"value"`
+	// Attempts counts model calls, including re-asks
+	Attempts int `json:"attempts"`
+	// Repaired is set when the first response needed extraction or a
+	// re-ask to become valid
+	Repaired bool `json:"repaired"`
+}
+
+// OutputError reports a response that could not be repaired
+type OutputError struct {
+	Attempts int
+	// Last is the final raw response
+	Last string
+	Err  error
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("%v after %d attempts: %v", ErrInvalidOutput, e.Attempts, e.Err)
+}
+
+func (e *OutputError) Unwrap() error { return ErrInvalidOutput }
+
+// GenerateStructured asks gen for a response matching spec.Schema and
+// decodes it into out, which may be nil. Each call passes the agent's
+// model gate. An invalid response is first repaired locally, by pulling
+// the JSON out of prose or code fences, then by re-asking the model with
+// the validation errors, up to MaxRepairs times.
+func (m *Manager) GenerateStructured(ctx context.Context, agentID string, gen Generator, prompt string,
+	spec OutputSpec, out any) (StructuredOutput, error) {
+	schema, err := compileSchema("output", spec.Schema)
+	if err != nil {
+		return StructuredOutput{}, fmt.Errorf("invalid output schema: %w", err)
+	}
+	repairs := spec.MaxRepairs
+	if repairs == 0 {
+		repairs = defaultMaxRepairs
+	}
+	if repairs < 0 {
+		repairs = 0
+	}
+	constrained, _ := gen.(ConstrainedGenerator)
+
+	var (
+		result StructuredOutput
+		last   string
+		cause  error
+	)
+	ask := prompt
+	for result.Attempts <= repairs {
+		err := m.Models().Do(ctx, agentID, spec.Key, func(ctx context.Context) error {
+			var err error
+			if constrained != nil {
+				last, err = constrained.GenerateJSON(ctx, ask, spec.Schema)
+			} else {
+				last, err = gen.Generate(ctx, ask)
+			}
+			return err
+		})
+		result.Attempts++
+		if err != nil {
+			structuredOutputs.WithLabelValues("error").Inc()
+			return result, fmt.Errorf("model call failed: %w", err)
+		}
+
+		raw, extracted := extractJSON(last)
+		if cause = validate(schema, raw); cause == nil {
+			result.Value = raw
+			result.Repaired = extracted || result.Attempts > 1
+			if out != nil {
+				if err := json.Unmarshal(raw, out); err != nil {
+					return result, fmt.Errorf("output decode failed: %w", err)
+				}
+			}
+			structuredOutputs.WithLabelValues(structuredOutcome(result)).Inc()
+			return result, nil
+		}
+		slog.Debug("model output failed schema", "agent_id", agentID, "attempt", result.Attempts, "error", cause)
+		ask = repairPrompt(prompt, spec.Schema, last, cause)
+	}
+	structuredOutputs.WithLabelValues("failed").Inc()
+	return result, &OutputError{Attempts: result.Attempts, Last: last, Err: cause}
+}
+
+func structuredOutcome(r StructuredOutput) string {
+	switch {
+	case r.Attempts > 1:
+		return "reasked"
+	case r.Repaired:
+		return "extracted"
+	}
+	return "valid"
+}
+
+// extractJSON returns the JSON a response carries. Models often wrap it in
+// a code fence or a sentence; the outermost object or array is taken, and
+// extracted reports that the response needed it.
+func extractJSON(text string) (raw json.RawMessage, extracted bool) {
+	trimmed := strings.TrimSpace(text)
+	if json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed), false
+	}
+	if start := strings.Index(trimmed, "```"); start >= 0 {
+		body := trimmed[start+3:]
+		// drop the fence's language tag
+		if nl := strings.IndexByte(body, '\n'); nl >= 0 {
+			body = body[nl+1:]
+		}
+		if end := strings.Index(body, "```"); end >= 0 {
+			if candidate := strings.TrimSpace(body[:end]); json.Valid([]byte(candidate)) {
+				return json.RawMessage(candidate), true
+			}
+		}
+	}
+	for _, open := range []byte{'{', '['} {
+		start := strings.IndexByte(trimmed, open)
+		if start < 0 {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(trimmed[start:]))
+		var v json.RawMessage
+		if err := dec.Decode(&v); err == nil {
+			return v, true
+		}
+	}
+	return json.RawMessage(trimmed), false
+}
+
+// repairPrompt re-asks for a response, showing the model what it sent and
+// why it was rejected
+func repairPrompt(prompt string, schema json.RawMessage, last string, cause error) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, schema); err != nil {
+		compact.Write(schema)
+	}
+	return fmt.Sprintf(`%s
+
+Your previous response was rejected:
+%s
+
+It failed validation: %v
+
+Reply again with only a JSON value matching this schema, without commentary or code fences:
+%s`, prompt, last, cause, compact.String())
+}
@@ -0,0 +1,252 @@
+// task_api.go - HTTP Task API and Externally Executed Tasks
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JobTaskKind is the kind of one-shot tasks run outside the controller,
+// by the operator's AgentJobs. No in-process worker claims it.
+const JobTaskKind = "agent.job"
+
+// ErrTaskNotClaimable is returned when claiming a task that is finished,
+// out of attempts or leased to a live worker
+var ErrTaskNotClaimable = errors.New("task not claimable")
+
+// ClaimTask leases one task to an external worker, such as the pod of a
+// Kubernetes Job. External workers own no shards: their claims,
+// heartbeats and results are fenced by the lease alone. A task requeued
+// after a failed attempt is claimable at once, as the external scheduler
+// applies its own backoff.
+func (m *Manager) ClaimTask(ctx context.Context, id, worker string) (Task, error) {
+	var task Task
+	err := m.db.GetContext(ctx, &task, `
+		UPDATE agent_tasks
+		SET state = 'running', worker = $2, attempts = attempts + 1,
+		    lease_expires_at = NOW() + make_interval(secs => $3), updated_at = NOW()
+		WHERE id = $1
+		  AND (state = 'queued' OR (state = 'running' AND lease_expires_at < NOW()))
+		  AND attempts < max_attempts
+		  AND (deadline IS NULL OR deadline > NOW())
+		RETURNING `+taskColumns,
+		id, worker, m.cfg.TaskLease.Seconds())
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := m.GetTask(ctx, id); err != nil {
+			return Task{}, err
+		}
+		return Task{}, fmt.Errorf("%w: %s", ErrTaskNotClaimable, id)
+	}
+	if err != nil {
+		return Task{}, fmt.Errorf("task claim failed: %w", err)
+	}
+	return task, nil
+}
+
+// taskView is a task as the API returns it
+type taskView struct {
+	ID       string          `json:"id"`
+	TenantID string          `json:"tenant_id"`
+	AgentID  string          `json:"agent_id"`
+	Kind     string          `json:"kind"`
+	Payload  json.RawMessage `json:"payload"`
+	State    TaskState       `json:"state"`
+	Attempts int             `json:"attempts"`
+	// MaxAttempts bounds Attempts
+	MaxAttempts int             `json:"max_attempts"`
+	Deadline    *time.Time      `json:"deadline,omitempty"`
+	Worker      string          `json:"worker,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+func viewTask(t Task) taskView {
+	v := taskView{
+		ID: t.ID, TenantID: t.TenantID, AgentID: t.AgentID, Kind: t.Kind, Payload: t.Payload,
+		State: t.State, Attempts: t.Attempts, MaxAttempts: t.MaxAttempts, Worker: t.Worker,
+		Error: t.Error, CreatedAt: t.CreatedAt, UpdatedAt: t.UpdatedAt,
+	}
+	if t.Deadline.Valid {
+		v.Deadline = &t.Deadline.Time
+	}
+	if string(t.Result) != "null" {
+		v.Result = t.Result
+	}
+	return v
+}
+
+// submitRequest is the body of a task submission. Blueprint, when set,
+// first creates the agent from it unless it exists.
+type submitRequest struct {
+	TenantID    string          `json:"tenant_id"`
+	AgentID     string          `json:"agent_id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Priority    int             `json:"priority"`
+	Deadline    time.Time       `json:"deadline"`
+	MaxAttempts int             `json:"max_attempts"`
+	Blueprint   *struct {
+		Name       string            `json:"name"`
+		Version    int               `json:"version"`
+		Parameters map[string]string `json:"parameters"`
+	} `json:"blueprint,omitempty"`
+}
+
+func (m *Manager) submitFromRequest(ctx context.Context, req submitRequest) (Task, error) {
+	if b := req.Blueprint; b != nil {
+		_, err := m.CreateAgentFromTemplate(ctx, req.TenantID, req.AgentID, b.Name, b.Version, b.Parameters)
+		if err != nil && !errors.Is(err, ErrAgentExists) {
+			return Task{}, err
+		}
+	}
+	def, err := m.GetAgent(ctx, req.AgentID)
+	if err != nil {
+		return Task{}, err
+	}
+	if def.TenantID != req.TenantID {
+		return Task{}, fmt.Errorf("%w: %s", ErrAgentNotFound, req.AgentID)
+	}
+	return m.SubmitTask(ctx, TaskSpec{
+		TenantID: req.TenantID,
+		AgentID:  req.AgentID,
+		Kind:     req.Kind,
+		Payload:  req.Payload,
+		Priority: req.Priority,
+		Deadline: req.Deadline,
+		Retry:    RetryPolicy{MaxAttempts: req.MaxAttempts},
+	})
+}
+
+// TasksHandler serves the task queue under /api/tasks/:
+//
+//	POST /api/tasks/                 submit a task
+//	GET  /api/tasks/{id}             task state and result
+//	POST /api/tasks/{id}/cancel      cancel a queued or running task
+//
+// External workers report on the tasks they run through:
+//
+//	POST /api/tasks/{id}/claim       {"worker": ...}
+//	POST /api/tasks/{id}/heartbeat   {"worker": ...}
+//	POST /api/tasks/{id}/complete    {"worker": ..., "result": ..., "usage": {...}}
+//	POST /api/tasks/{id}/fail        {"worker": ..., "error": ..., "permanent": false, "usage": {...}}
+//
+// The optional usage reports the prompt and completion tokens the task's
+// model calls used. Callers reach only their own tenant's tasks and agents.
+func (m *Manager) TasksHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/tasks/"), "/")
+		if id != "" {
+			if _, err := m.ownedTask(r.Context(), id); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		}
+
+		var report struct {
+			Worker    string          `json:"worker"`
+			Result    json.RawMessage `json:"result"`
+			Error     string          `json:"error"`
+			Permanent bool            `json:"permanent"`
+			Usage     Usage           `json:"usage"`
+		}
+		if r.Method == http.MethodPost && action != "" && action != "cancel" {
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&report); err != nil || report.Worker == "" {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var (
+			task Task
+			err  error
+		)
+		switch {
+		case r.Method == http.MethodPost && id == "":
+			var req submitRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			tenantID, ok := requestTenant(w, r, req.TenantID)
+			if !ok {
+				return
+			}
+			req.TenantID = tenantID
+			if task, err = m.submitFromRequest(r.Context(), req); err == nil {
+				w.WriteHeader(http.StatusCreated)
+			}
+		case r.Method == http.MethodGet && action == "":
+			task, err = m.GetTask(r.Context(), id)
+		case r.Method == http.MethodPost && action == "cancel":
+			if err = m.CancelTask(r.Context(), id); err == nil {
+				task, err = m.GetTask(r.Context(), id)
+			}
+		case r.Method == http.MethodPost && action == "claim":
+			task, err = m.ClaimTask(r.Context(), id, report.Worker)
+		case r.Method == http.MethodPost && action == "heartbeat":
+			if err = m.heartbeatTask(r.Context(), id, report.Worker, ""); err == nil {
+				task, err = m.GetTask(r.Context(), id)
+			}
+		case r.Method == http.MethodPost && (action == "complete" || action == "fail"):
+			if task, err = m.GetTask(r.Context(), id); err != nil {
+				break
+			}
+			if action == "complete" {
+				err = m.completeTask(r.Context(), task, report.Worker, report.Result, "")
+			} else {
+				cause := errors.New(report.Error)
+				if report.Permanent {
+					cause = Permanent(cause)
+				}
+				err = m.FailTask(r.Context(), task, report.Worker, cause)
+			}
+			if err != nil {
+				break
+			}
+			tokens := Usage{PromptTokens: report.Usage.PromptTokens, CompletionTokens: report.Usage.CompletionTokens}
+			if uerr := m.RecordUsage(context.WithoutCancel(r.Context()), task.TenantID, task.AgentID, tokens); uerr != nil {
+				slog.Warn("task usage not recorded", "task_id", task.ID, "error", uerr)
+			}
+			task, err = m.GetTask(r.Context(), id)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrTaskNotFound), errors.Is(err, ErrAgentNotFound), errors.Is(err, ErrBlueprintNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, ErrTaskNotClaimable), errors.Is(err, ErrLeaseLost):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(viewTask(task))
+	}
+}
+
+// ownedTask loads id for the principal on ctx; tasks of another tenant are
+// reported as not found
+func (m *Manager) ownedTask(ctx context.Context, id string) (Task, error) {
+	task, err := m.GetTask(ctx, id)
+	if err != nil {
+		return Task{}, err
+	}
+	if !actsFor(ctx, task.TenantID) {
+		return Task{}, fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+	}
+	return task, nil
+}
@@ -0,0 +1,668 @@
+// tasks.go - Durable Agent Task Queue
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// taskSubjectPrefix is the NATS subject family for submit notifications;
+// the task kind is appended
+const taskSubjectPrefix = "agent.tasks."
+
+var (
+	// ErrTaskNotFound is returned for unknown task IDs
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrLeaseLost is returned when a worker reports on a task that has
+	// since been reclaimed by another replica or cancelled
+	ErrLeaseLost = errors.New("task lease lost")
+)
+
+var (
+	tasksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_agent_tasks_total",
+		Help: "Agent tasks by kind and outcome",
+	}, []string{"kind", "outcome"})
+
+	taskWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "Wavine_agent_task_wait_seconds",
+		Help:    "Time from task submission to first claim",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 14),
+	}, []string{"kind"})
+)
+
+func init() {
+	prometheus.MustRegister(tasksTotal, taskWait)
+}
+
+// TaskState is a task's position in its lifecycle. Succeeded, failed,
+// expired and cancelled are final.
+type TaskState string
+
+const (
+	TaskQueued    TaskState = "queued"
+	TaskRunning   TaskState = "running"
+	TaskSucceeded TaskState = "succeeded"
+	TaskFailed    TaskState = "failed"
+	TaskExpired   TaskState = "expired"
+	TaskCancelled TaskState = "cancelled"
+)
+
+// RetryPolicy controls how a failed attempt is retried. Backoff doubles
+// from InitialBackoff up to MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts    int           `json:"max_attempts"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = time.Second
+	}
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = 5 * time.Minute
+	}
+	d := time.Duration(float64(initial) * math.Pow(2, float64(attempt-1)))
+	if d > max || d <= 0 {
+		d = max
+	}
+	return d
+}
+
+// TaskSpec is what a caller submits
+type TaskSpec struct {
+	TenantID string
+	AgentID  string
+	Kind     string
+	Payload  json.RawMessage
+	// Priority orders claims; higher runs first
+	Priority int
+	// Deadline, when set, expires the task if it has not succeeded by then
+	Deadline time.Time
+	Retry    RetryPolicy
+	// DryRun runs the task with side-effecting tool calls intercepted;
+	// see WithDryRun
+	DryRun bool
+}
+
+// Task is the persisted record of a unit of agent work
+type Task struct {
+	ID       string          `db:"id"`
+	TenantID string          `db:"tenant_id"`
+	AgentID  string          `db:"agent_id"`
+	Kind     string          `db:"kind"`
+	Payload  json.RawMessage `db:"payload"`
+	Priority int             `db:"priority"`
+	Deadline sql.NullTime    `db:"deadline"`
+	State    TaskState       `db:"state"`
+	Attempts int             `db:"attempts"`
+	// MaxAttempts and the backoff bounds come from the RetryPolicy
+	MaxAttempts    int             `db:"max_attempts"`
+	InitialBackoff time.Duration   `db:"initial_backoff"`
+	MaxBackoff     time.Duration   `db:"max_backoff"`
+	Shard          int             `db:"shard"`
+	DryRun         bool            `db:"dry_run"`
+	Worker         string          `db:"worker"`
+	LeaseExpiresAt sql.NullTime    `db:"lease_expires_at"`
+	NotBefore      time.Time       `db:"not_before"`
+	Result         json.RawMessage `db:"result"`
+	Error          string          `db:"error"`
+	CreatedAt      time.Time       `db:"created_at"`
+	UpdatedAt      time.Time       `db:"updated_at"`
+}
+
+func (t Task) retryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: t.MaxAttempts, InitialBackoff: t.InitialBackoff, MaxBackoff: t.MaxBackoff}
+}
+
+const taskColumns = `id, tenant_id, agent_id, kind, payload, priority, deadline, state, attempts,
+	max_attempts, initial_backoff, max_backoff, shard, dry_run, worker, lease_expires_at, not_before,
+	COALESCE(result, 'null'::jsonb) AS result, error, created_at, updated_at`
+
+// permanentError marks a handler failure that must not be retried
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps a handler error so the task fails without further
+// attempts, for inputs that can never succeed
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// SubmitTask queues a task and notifies idle workers of its kind
+func (m *Manager) SubmitTask(ctx context.Context, spec TaskSpec) (Task, error) {
+	task, err := m.insertTask(ctx, m.db, spec)
+	if err != nil {
+		return Task{}, err
+	}
+	m.notifyTask(ctx, task)
+	return task, nil
+}
+
+// insertTask queues spec through q, which may be a transaction; callers
+// notify workers once it is committed
+func (m *Manager) insertTask(ctx context.Context, q sqlx.QueryerContext, spec TaskSpec) (Task, error) {
+	if spec.Kind == "" || spec.AgentID == "" {
+		return Task{}, fmt.Errorf("task needs a kind and an agent")
+	}
+	if spec.Retry.MaxAttempts <= 0 {
+		spec.Retry.MaxAttempts = m.cfg.MaxAttempts
+	}
+	if spec.Payload == nil {
+		spec.Payload = json.RawMessage("{}")
+	}
+	var deadline sql.NullTime
+	if !spec.Deadline.IsZero() {
+		deadline = sql.NullTime{Time: spec.Deadline, Valid: true}
+	}
+
+	id, err := newTaskID()
+	if err != nil {
+		return Task{}, err
+	}
+	var task Task
+	err = sqlx.GetContext(ctx, q, &task, `
+		INSERT INTO agent_tasks (id, tenant_id, agent_id, kind, payload, priority, deadline,
+		                         max_attempts, initial_backoff, max_backoff, shard, dry_run)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING `+taskColumns,
+		id, spec.TenantID, spec.AgentID, spec.Kind, []byte(spec.Payload), spec.Priority, deadline,
+		spec.Retry.MaxAttempts, spec.Retry.InitialBackoff, spec.Retry.MaxBackoff, m.shardOf(spec.AgentID),
+		spec.DryRun)
+	if err != nil {
+		tasksTotal.WithLabelValues(spec.Kind, "submit_error").Inc()
+		return Task{}, fmt.Errorf("task submission failed: %w", err)
+	}
+	tasksTotal.WithLabelValues(spec.Kind, "submitted").Inc()
+	return task, nil
+}
+
+func (m *Manager) notifyTask(ctx context.Context, task Task) {
+	if n := m.getNotifier(); n != nil {
+		if err := n.Publish(ctx, taskSubjectPrefix+task.Kind, map[string]string{"id": task.ID}); err != nil {
+			slog.Warn("task notification failed", "task_id", task.ID, "error", err)
+		}
+	}
+}
+
+// GetTask returns a task's current record
+func (m *Manager) GetTask(ctx context.Context, id string) (Task, error) {
+	var task Task
+	err := m.db.GetContext(ctx, &task, `SELECT `+taskColumns+` FROM agent_tasks WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return task, fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+	}
+	if err != nil {
+		return task, fmt.Errorf("task lookup failed: %w", err)
+	}
+	return task, nil
+}
+
+// CancelTask stops a queued or running task. A running worker finds out
+// at its next heartbeat.
+func (m *Manager) CancelTask(ctx context.Context, id string) error {
+	res, err := m.db.ExecContext(ctx, `
+		UPDATE agent_tasks SET state = 'cancelled', updated_at = NOW()
+		WHERE id = $1 AND state IN ('queued', 'running')`, id)
+	if err != nil {
+		return fmt.Errorf("task cancel failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := m.GetTask(ctx, id); err != nil {
+			return err
+		}
+		return fmt.Errorf("task %s already finished", id)
+	}
+	return nil
+}
+
+// ClaimTasks leases up to limit runnable tasks of the given kinds to
+// worker, highest priority first. Tasks whose previous lease expired are
+// claimable again, so a crashed worker's tasks are retried. Tasks of
+// suspended agents, or stopped by a hard budget, wait. A draining replica
+// claims nothing.
+func (m *Manager) ClaimTasks(ctx context.Context, worker string, kinds []string, limit int) ([]Task, error) {
+	if len(kinds) == 0 || limit <= 0 || m.isDraining() {
+		return nil, nil
+	}
+	params := []interface{}{worker, m.cfg.TaskLease.Seconds(), kinds}
+	if m.cfg.ShardCount > 0 {
+		params = append(params, worker)
+	}
+	params = append(params, limit)
+
+	q, args, err := sqlx.In(`
+		UPDATE agent_tasks
+		SET state = 'running', worker = ?, attempts = attempts + 1,
+		    lease_expires_at = NOW() + make_interval(secs => ?), updated_at = NOW()
+		WHERE id IN (
+		    SELECT id FROM agent_tasks
+		    WHERE kind IN (?)
+		      AND ((state = 'queued' AND not_before <= NOW())
+		           OR (state = 'running' AND lease_expires_at < NOW() AND attempts < max_attempts))
+		      AND (deadline IS NULL OR deadline > NOW())
+		      AND NOT EXISTS (SELECT 1 FROM agent_status s
+		                      WHERE s.agent_id = agent_tasks.agent_id AND s.state = 'SUSPENDED')`+
+		budgetFilter+m.ownedShardFilter("?")+`
+		    ORDER BY priority DESC, created_at
+		    LIMIT ?
+		    FOR UPDATE SKIP LOCKED)
+		RETURNING `+taskColumns,
+		params...)
+	if err != nil {
+		return nil, fmt.Errorf("query build failed: %w", err)
+	}
+	var tasks []Task
+	if err := m.db.SelectContext(ctx, &tasks, sqlx.Rebind(sqlx.DOLLAR, q), args...); err != nil {
+		return nil, fmt.Errorf("task claim failed: %w", err)
+	}
+	for _, t := range tasks {
+		if t.Attempts == 1 {
+			taskWait.WithLabelValues(t.Kind).Observe(time.Since(t.CreatedAt).Seconds())
+		}
+	}
+	return tasks, nil
+}
+
+// HeartbeatTask extends worker's lease on a task. ErrLeaseLost means the
+// task was cancelled or reclaimed and the worker must stop.
+func (m *Manager) HeartbeatTask(ctx context.Context, id, worker string) error {
+	return m.heartbeatTask(ctx, id, worker, m.ownedShardFilter("$2"))
+}
+
+// heartbeatTask extends the lease of a task whose row also matches
+// shardFilter
+func (m *Manager) heartbeatTask(ctx context.Context, id, worker, shardFilter string) error {
+	res, err := m.db.ExecContext(ctx, `
+		UPDATE agent_tasks
+		SET lease_expires_at = NOW() + make_interval(secs => $3), updated_at = NOW()
+		WHERE id = $1 AND worker = $2 AND state = 'running'`+shardFilter,
+		id, worker, m.cfg.TaskLease.Seconds())
+	if err != nil {
+		return fmt.Errorf("task heartbeat failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// CompleteTask records a successful result
+func (m *Manager) CompleteTask(ctx context.Context, task Task, worker string, result json.RawMessage) error {
+	return m.completeTask(ctx, task, worker, result, m.ownedShardFilter("$2"))
+}
+
+// completeTask records the result of a task whose row also matches
+// shardFilter
+func (m *Manager) completeTask(ctx context.Context, task Task, worker string, result json.RawMessage, shardFilter string) error {
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE agent_tasks
+		SET state = 'succeeded', result = $3, error = '', lease_expires_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND worker = $2 AND state = 'running'`+shardFilter,
+		task.ID, worker, []byte(result))
+	if err != nil {
+		return fmt.Errorf("task completion failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	if err := m.appendEvent(ctx, tx, task.TenantID, task.AgentID, EventTaskFinished, TaskEvent{
+		TaskID: task.ID, Kind: task.Kind, Attempt: task.Attempts, Result: result,
+	}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	tasksTotal.WithLabelValues(task.Kind, "succeeded").Inc()
+	return nil
+}
+
+// FailTask records a failed attempt. The task is requeued with backoff
+// while attempts and deadline allow, unless cause is Permanent.
+func (m *Manager) FailTask(ctx context.Context, task Task, worker string, cause error) error {
+	policy := task.retryPolicy()
+	notBefore := time.Now().Add(policy.backoff(task.Attempts))
+
+	var perm permanentError
+	retry := !errors.As(cause, &perm) && task.Attempts < policy.MaxAttempts &&
+		(!task.Deadline.Valid || notBefore.Before(task.Deadline.Time))
+	state, outcome := TaskFailed, "failed"
+	if retry {
+		state, outcome = TaskQueued, "retried"
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE agent_tasks
+		SET state = $3, error = $4, not_before = $5, lease_expires_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND worker = $2 AND state = 'running'`,
+		task.ID, worker, state, cause.Error(), notBefore)
+	if err != nil {
+		return fmt.Errorf("task failure update failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	if err := m.appendEvent(ctx, tx, task.TenantID, task.AgentID, EventTaskFinished, TaskEvent{
+		TaskID: task.ID, Kind: task.Kind, Attempt: task.Attempts, Error: cause.Error(),
+	}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	tasksTotal.WithLabelValues(task.Kind, outcome).Inc()
+	return nil
+}
+
+// reapTasks finalizes tasks that can no longer run: past their deadline,
+// or abandoned by a crashed worker after their last attempt
+func (m *Manager) reapTasks(ctx context.Context) error {
+	var rows []struct {
+		Kind  string    `db:"kind"`
+		State TaskState `db:"state"`
+	}
+	err := m.db.SelectContext(ctx, &rows, `
+		UPDATE agent_tasks
+		SET state = CASE WHEN deadline <= NOW() THEN 'expired' ELSE 'failed' END,
+		    error = CASE WHEN deadline <= NOW() THEN error ELSE 'worker lease expired on final attempt' END,
+		    lease_expires_at = NULL, updated_at = NOW()
+		WHERE (state = 'queued' AND deadline <= NOW())
+		   OR (state = 'running' AND lease_expires_at < NOW()
+		       AND (deadline <= NOW() OR attempts >= max_attempts))
+		RETURNING kind, state`)
+	if err != nil {
+		return fmt.Errorf("task reaping failed: %w", err)
+	}
+	for _, r := range rows {
+		tasksTotal.WithLabelValues(r.Kind, string(r.State)).Inc()
+	}
+	return nil
+}
+
+// TaskHandler executes one task. Returning an error fails the attempt;
+// wrap it with Permanent to skip retries. The context is cancelled when
+// the deadline passes or the lease is lost.
+type TaskHandler func(ctx context.Context, task Task) (json.RawMessage, error)
+
+// RunWorker claims and executes tasks of the given kinds with up to
+// concurrency in flight until ctx is cancelled or the manager drains. A
+// drain lets running tasks finish; cancelling ctx stops them.
+func (m *Manager) RunWorker(ctx context.Context, kinds []string, concurrency int, handler TaskHandler) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	worker := m.cfg.WorkerID
+
+	wake := make(chan struct{}, 1)
+	if n := m.getNotifier(); n != nil {
+		for _, kind := range kinds {
+			sub, err := n.Subscribe(taskSubjectPrefix+kind, func([]byte) error {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+				return nil
+			})
+			if err != nil {
+				slog.Warn("task notification subscribe failed, polling only", "kind", kind, "error", err)
+				continue
+			}
+			defer sub.Unsubscribe()
+		}
+	}
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.reapTasks(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("task reaping failed", "error", err)
+		}
+
+		free := concurrency - len(slots)
+		tasks, err := m.ClaimTasks(ctx, worker, kinds, free)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("task claim failed", "worker", worker, "error", err)
+		}
+		for _, task := range tasks {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(task Task) {
+				defer wg.Done()
+				defer func() {
+					<-slots
+					select {
+					case wake <- struct{}{}:
+					default:
+					}
+				}()
+				m.execute(ctx, worker, task, handler)
+			}(task)
+		}
+
+		// a full batch suggests more work is waiting
+		if len(tasks) > 0 && len(tasks) == free {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.drain.drained:
+			return nil
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// execute runs one claimed task, heartbeating its lease until the handler
+// returns. With checkpointing configured the handler resumes from the
+// state an earlier attempt saved.
+func (m *Manager) execute(ctx context.Context, worker string, task Task, handler TaskHandler) {
+	if !m.startTask() {
+		// claimed just as the drain began
+		releaseCtx, stop := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer stop()
+		if err := m.releaseTask(releaseCtx, task, worker); err != nil && !errors.Is(err, ErrLeaseLost) {
+			slog.Warn("task hand-off failed", "task_id", task.ID, "error", err)
+		}
+		return
+	}
+	defer m.running.Done()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-m.drain.halted:
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+	if task.Deadline.Valid {
+		var stop context.CancelFunc
+		runCtx, stop = context.WithDeadline(runCtx, task.Deadline.Time)
+		defer stop()
+	}
+	if task.DryRun {
+		runCtx = WithDryRun(runCtx, task.ID)
+	}
+
+	var exec *Execution
+	if m.getCheckpointStore() != nil {
+		var err error
+		if exec, err = m.ResumeExecution(runCtx, task.AgentID, task.ID); err != nil {
+			// starting over is slower but still correct
+			slog.Warn("checkpoint load failed, starting fresh", "task_id", task.ID, "error", err)
+			exec = newExecution(m.getCheckpointStore(), task.AgentID, task.ID)
+			// the stored sequence is unknown; a clock-based one still sorts
+			// after it
+			exec.seq = time.Now().UnixNano()
+		}
+		exec.saved = func(ctx context.Context, state json.RawMessage) {
+			m.recordEvent(ctx, task.TenantID, task.AgentID, EventCheckpointed, state)
+		}
+		runCtx = context.WithValue(runCtx, executionKey{}, exec)
+		go m.runCheckpoints(runCtx, exec)
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.cfg.TaskLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := m.HeartbeatTask(runCtx, task.ID, worker); errors.Is(err, ErrLeaseLost) {
+				slog.Warn("task lease lost, stopping", "task_id", task.ID)
+				cancel()
+				return
+			} else if err != nil && runCtx.Err() == nil {
+				slog.Warn("task heartbeat failed", "task_id", task.ID, "error", err)
+			}
+		}
+	}()
+
+	runCtx, meter := withUsageMeter(runCtx)
+	started := time.Now()
+	result, err := handler(runCtx, task)
+	if uerr := m.RecordUsage(context.WithoutCancel(ctx), task.TenantID, task.AgentID, Usage{
+		PromptTokens:     meter.prompt.Load(),
+		CompletionTokens: meter.completion.Load(),
+		ComputeSeconds:   time.Since(started).Seconds(),
+	}); uerr != nil {
+		slog.Warn("task usage not recorded", "task_id", task.ID, "error", uerr)
+	}
+
+	// report on a fresh context so a deadline-cancelled run still records
+	// its outcome
+	reportCtx, stop := context.WithTimeout(context.Background(), 10*time.Second)
+	defer stop()
+	if exec != nil {
+		m.settleExecution(reportCtx, exec, err == nil || errors.As(err, new(permanentError)))
+	}
+	if ctx.Err() != nil {
+		// shutting down without a drain; the lease lapses and another
+		// replica resumes from the checkpoint
+		return
+	}
+	if err != nil && m.halted() {
+		// stopped by the drain deadline rather than failed: a peer
+		// resumes it from the checkpoint now
+		if err := m.releaseTask(reportCtx, task, worker); err != nil && !errors.Is(err, ErrLeaseLost) {
+			slog.Error("task hand-off failed", "task_id", task.ID, "error", err)
+		}
+		return
+	}
+	if !task.DryRun {
+		// simulated runs must not sway a canary's stats
+		m.recordTaskOutcome(reportCtx, task.AgentID, err)
+	}
+
+	if err != nil {
+		err = m.FailTask(reportCtx, task, worker, err)
+	} else {
+		err = m.CompleteTask(reportCtx, task, worker, result)
+	}
+	if err != nil {
+		if !errors.Is(err, ErrLeaseLost) {
+			slog.Error("task outcome not recorded", "task_id", task.ID, "error", err)
+		}
+		return
+	}
+	// move a workflow waiting on this task along now rather than at the
+	// next sweep
+	if err := m.advanceTaskWorkflow(reportCtx, task.ID); err != nil {
+		slog.Warn("workflow advance failed", "task_id", task.ID, "error", err)
+	}
+}
+
+// settleExecution clears the checkpoints of finished work, or saves the
+// latest state so the next attempt resumes from it
+func (m *Manager) settleExecution(ctx context.Context, exec *Execution, finished bool) {
+	var err error
+	if finished {
+		err = exec.store.ClearCheckpoints(ctx, exec.agentID, exec.taskID)
+	} else {
+		err = exec.Checkpoint(ctx)
+	}
+	if err != nil {
+		slog.Warn("final agent checkpoint failed", "agent_id", exec.agentID, "task_id", exec.taskID, "error", err)
+	}
+}
+
+func newTaskID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("task ID generation failed: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_tasks (
+    id               VARCHAR(64) PRIMARY KEY,
+    tenant_id        VARCHAR(255) NOT NULL DEFAULT '',
+    agent_id         VARCHAR(255) NOT NULL,
+    kind             VARCHAR(255) NOT NULL,
+    payload          JSONB NOT NULL DEFAULT '{}',
+    priority         INT NOT NULL DEFAULT 0,
+    deadline         TIMESTAMPTZ,
+    state            VARCHAR(16) NOT NULL DEFAULT 'queued',
+    attempts         INT NOT NULL DEFAULT 0,
+    max_attempts     INT NOT NULL,
+    initial_backoff  BIGINT NOT NULL DEFAULT 0,
+    max_backoff      BIGINT NOT NULL DEFAULT 0,
+    shard            INT NOT NULL DEFAULT 0,
+    dry_run          BOOLEAN NOT NULL DEFAULT FALSE,
+    worker           VARCHAR(255) NOT NULL DEFAULT '',
+    lease_expires_at TIMESTAMPTZ,
+    not_before       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    result           JSONB,
+    error            TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_tasks_claim
+    ON agent_tasks (kind, priority DESC, created_at)
+    WHERE state IN ('queued', 'running');
+*/
@@ -0,0 +1,496 @@
+// tools.go - Typed Tool Registry with Call Validation
+package agent
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrToolNotFound is returned for tools that are not registered
+	ErrToolNotFound = errors.New("tool not found")
+	// ErrToolForbidden is returned when the caller lacks a required scope
+	ErrToolForbidden = errors.New("tool call not permitted")
+	// ErrToolRateLimited is returned when a caller exceeds a tool's limit
+	ErrToolRateLimited = errors.New("tool rate limit exceeded")
+	// ErrInvalidToolInput and ErrInvalidToolOutput wrap schema violations
+	ErrInvalidToolInput  = errors.New("tool input does not match schema")
+	ErrInvalidToolOutput = errors.New("tool output does not match schema")
+)
+
+var toolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_agent_tool_calls_total",
+	Help: "Tool calls by tool and outcome",
+}, []string{"tool", "outcome"})
+
+func init() {
+	prometheus.MustRegister(toolCalls)
+}
+
+// ToolAuth lists what a caller must hold to invoke a tool
+type ToolAuth struct {
+	// Scopes must all be granted to the calling agent
+	Scopes []string `json:"scopes,omitempty"`
+	// Credential names the secret the executor injects; agents never see it
+	Credential string `json:"credential,omitempty"`
+}
+
+// ToolRateLimit caps calls per agent. Limits are enforced per controller
+// replica.
+type ToolRateLimit struct {
+	PerMinute int `json:"per_minute"`
+	Burst     int `json:"burst"`
+}
+
+// ToolSpec declares a tool. InputSchema and OutputSchema are JSON Schema
+// documents; an empty OutputSchema accepts any result.
+type ToolSpec struct {
+	Name         string          `json:"name"`
+	Version      int             `json:"version"`
+	Description  string          `json:"description"`
+	InputSchema  json.RawMessage `json:"input_schema"`
+	OutputSchema json.RawMessage `json:"output_schema,omitempty"`
+	Auth         ToolAuth        `json:"auth"`
+	RateLimit    ToolRateLimit   `json:"rate_limit"`
+	// Sandbox grants capabilities to tools run in the WASM runtime
+	Sandbox SandboxPolicy `json:"sandbox,omitempty"`
+	// DryRun says how the tool behaves when a dry run calls it
+	DryRun ToolDryRun `json:"dry_run,omitempty"`
+	// Policy is the retry and compensation workflows use for the tool
+	Policy ToolPolicy `json:"policy,omitempty"`
+	// Runtime selects the executor and Target what it runs: a URL, a
+	// module digest, a built-in name
+	Runtime   string    `json:"runtime"`
+	Target    string    `json:"target"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Caller identifies who is invoking a tool
+type Caller struct {
+	TenantID string
+	AgentID  string
+	Scopes   []string
+}
+
+func (c Caller) has(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolExecutor runs a validated tool call
+type ToolExecutor interface {
+	Execute(ctx context.Context, tool ToolSpec, caller Caller, input json.RawMessage) (json.RawMessage, error)
+}
+
+// compiledTool caches a spec's compiled schemas, keyed by toolKey
+type compiledTool struct {
+	spec   ToolSpec
+	input  *jsonschema.Schema
+	output *jsonschema.Schema
+}
+
+// ToolRegistry stores tool declarations in Postgres and validates every
+// call against them before it reaches an executor
+type ToolRegistry struct {
+	m *Manager
+
+	mu         sync.RWMutex
+	compiled   map[string]compiledTool
+	limiters   map[string]*rate.Limiter
+	executors  map[string]ToolExecutor
+	simulators map[string]ToolSimulator
+}
+
+// Tools returns the manager's tool registry
+func (m *Manager) Tools() *ToolRegistry {
+	m.toolsOnce.Do(func() {
+		m.tools = &ToolRegistry{
+			m:          m,
+			compiled:   make(map[string]compiledTool),
+			limiters:   make(map[string]*rate.Limiter),
+			executors:  make(map[string]ToolExecutor),
+			simulators: make(map[string]ToolSimulator),
+		}
+	})
+	return m.tools
+}
+
+// SetExecutor routes tools of the given runtime to exec
+func (r *ToolRegistry) SetExecutor(runtime string, exec ToolExecutor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.executors[runtime] = exec
+}
+
+// Register validates a tool's schemas and stores it as a new version
+func (r *ToolRegistry) Register(ctx context.Context, spec ToolSpec) (ToolSpec, error) {
+	if spec.Name == "" || spec.Runtime == "" {
+		return ToolSpec{}, fmt.Errorf("tool needs a name and a runtime")
+	}
+	if _, err := compileTool(spec); err != nil {
+		return ToolSpec{}, err
+	}
+	auth, err := json.Marshal(spec.Auth)
+	if err != nil {
+		return ToolSpec{}, err
+	}
+	limit, err := json.Marshal(spec.RateLimit)
+	if err != nil {
+		return ToolSpec{}, err
+	}
+	sandbox, err := json.Marshal(spec.Sandbox)
+	if err != nil {
+		return ToolSpec{}, err
+	}
+	dryRun, err := json.Marshal(spec.DryRun)
+	if err != nil {
+		return ToolSpec{}, err
+	}
+	if c := spec.Policy.Compensate; c != nil {
+		if (c.Tool == "") == (c.Kind == "") {
+			return ToolSpec{}, fmt.Errorf("compensation of tool %s needs exactly one of a tool and a kind", spec.Name)
+		}
+	}
+	policy, err := json.Marshal(spec.Policy)
+	if err != nil {
+		return ToolSpec{}, err
+	}
+	output := spec.OutputSchema
+	if len(output) == 0 {
+		output = nil
+	}
+
+	err = r.m.db.QueryRowContext(ctx, `
+		INSERT INTO agent_tools (name, version, description, input_schema, output_schema, auth, rate_limit, sandbox,
+		                         runtime, target, dry_run, policy)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+		FROM agent_tools WHERE name = $1
+		RETURNING version, updated_at`,
+		spec.Name, spec.Description, []byte(spec.InputSchema), []byte(output), auth, limit, sandbox,
+		spec.Runtime, spec.Target, dryRun, policy).Scan(&spec.Version, &spec.UpdatedAt)
+	if err != nil {
+		return ToolSpec{}, fmt.Errorf("tool registration failed: %w", err)
+	}
+
+	// other replicas see the new version on their next call; limiters are
+	// per version too, as it may change the limit
+	r.mu.Lock()
+	r.evict(spec.Name)
+	r.mu.Unlock()
+	return spec, nil
+}
+
+// toolKey names a tool version in the compiled and limiter caches
+func toolKey(name string, version int) string {
+	return fmt.Sprintf("%s@%d", name, version)
+}
+
+// evict drops every cached version of name; r.mu must be held
+func (r *ToolRegistry) evict(name string) {
+	for key := range r.compiled {
+		if strings.HasPrefix(key, name+"@") {
+			delete(r.compiled, key)
+		}
+	}
+	for key := range r.limiters {
+		if strings.HasPrefix(key, name+"@") {
+			delete(r.limiters, key)
+		}
+	}
+}
+
+// Get returns the latest version of a tool
+func (r *ToolRegistry) Get(ctx context.Context, name string) (ToolSpec, error) {
+	tools, err := r.query(ctx, `WHERE name = $1`, name)
+	if err != nil {
+		return ToolSpec{}, err
+	}
+	if len(tools) == 0 {
+		return ToolSpec{}, fmt.Errorf("%w: %s", ErrToolNotFound, name)
+	}
+	return tools[0], nil
+}
+
+// Discover lists the latest version of every tool caller may invoke, for
+// agents to choose from at runtime
+func (r *ToolRegistry) Discover(ctx context.Context, caller Caller) ([]ToolSpec, error) {
+	tools, err := r.query(ctx, ``)
+	if err != nil {
+		return nil, err
+	}
+	allowed := tools[:0]
+	for _, t := range tools {
+		if authorized(t, caller) {
+			allowed = append(allowed, t)
+		}
+	}
+	return allowed, nil
+}
+
+func (r *ToolRegistry) query(ctx context.Context, where string, args ...any) ([]ToolSpec, error) {
+	rows, err := r.m.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (name) name, version, description, input_schema,
+		       COALESCE(output_schema, 'null'::jsonb), auth, rate_limit, sandbox, runtime, target, dry_run, policy, updated_at
+		FROM agent_tools `+where+`
+		ORDER BY name, version DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("tool query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var tools []ToolSpec
+	for rows.Next() {
+		var t ToolSpec
+		var input, output, auth, limit, sandbox, dryRun, policy []byte
+		if err := rows.Scan(&t.Name, &t.Version, &t.Description, &input, &output, &auth, &limit, &sandbox,
+			&t.Runtime, &t.Target, &dryRun, &policy, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		t.InputSchema = input
+		if !bytes.Equal(output, []byte("null")) {
+			t.OutputSchema = output
+		}
+		if err := json.Unmarshal(auth, &t.Auth); err != nil {
+			return nil, fmt.Errorf("corrupt auth for tool %s: %w", t.Name, err)
+		}
+		if err := json.Unmarshal(limit, &t.RateLimit); err != nil {
+			return nil, fmt.Errorf("corrupt rate limit for tool %s: %w", t.Name, err)
+		}
+		if err := json.Unmarshal(sandbox, &t.Sandbox); err != nil {
+			return nil, fmt.Errorf("corrupt sandbox policy for tool %s: %w", t.Name, err)
+		}
+		if err := json.Unmarshal(dryRun, &t.DryRun); err != nil {
+			return nil, fmt.Errorf("corrupt dry run settings for tool %s: %w", t.Name, err)
+		}
+		if err := json.Unmarshal(policy, &t.Policy); err != nil {
+			return nil, fmt.Errorf("corrupt policy for tool %s: %w", t.Name, err)
+		}
+		tools = append(tools, t)
+	}
+	return tools, rows.Err()
+}
+
+// Invoke authorizes, rate limits and validates a call, runs it on the
+// tool's executor and validates the result. In a dry run, calls to tools
+// not marked read-only are answered by simulate instead.
+func (r *ToolRegistry) Invoke(ctx context.Context, caller Caller, name string, input json.RawMessage) (json.RawMessage, error) {
+	tool, err := r.tool(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	spec := tool.spec
+
+	if !authorized(spec, caller) {
+		toolCalls.WithLabelValues(name, "forbidden").Inc()
+		return nil, fmt.Errorf("%w: %s requires scopes %v", ErrToolForbidden, name, spec.Auth.Scopes)
+	}
+	if !r.allow(spec, caller) {
+		toolCalls.WithLabelValues(name, "rate_limited").Inc()
+		return nil, fmt.Errorf("%w: %s", ErrToolRateLimited, name)
+	}
+	if err := validate(tool.input, input); err != nil {
+		toolCalls.WithLabelValues(name, "invalid_input").Inc()
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidToolInput, name, err)
+	}
+
+	runID, dryRun := DryRunFromContext(ctx)
+	if dryRun && !spec.DryRun.ReadOnly {
+		return r.simulate(ctx, tool, caller, runID, input)
+	}
+
+	if err := r.m.checkBudget(ctx, caller.TenantID, caller.AgentID); err != nil {
+		toolCalls.WithLabelValues(name, "over_budget").Inc()
+		return nil, err
+	}
+
+	r.mu.RLock()
+	exec, ok := r.executors[spec.Runtime]
+	r.mu.RUnlock()
+	if !ok {
+		toolCalls.WithLabelValues(name, "error").Inc()
+		return nil, fmt.Errorf("no executor for runtime %q", spec.Runtime)
+	}
+
+	output, err := exec.Execute(ctx, spec, caller, input)
+	call := ToolCallEvent{Tool: name, Version: spec.Version, Input: input, Output: output}
+	if err != nil {
+		call.Output, call.Error = nil, err.Error()
+	}
+	r.m.recordEvent(ctx, caller.TenantID, caller.AgentID, EventToolCalled, call)
+	if uerr := r.m.RecordUsage(context.WithoutCancel(ctx), caller.TenantID, caller.AgentID,
+		Usage{ToolCalls: 1}); uerr != nil {
+		slog.Warn("tool usage not recorded", "tool", name, "error", uerr)
+	}
+	if err != nil {
+		toolCalls.WithLabelValues(name, "error").Inc()
+		return nil, fmt.Errorf("tool %s failed: %w", name, err)
+	}
+	if tool.output != nil {
+		if err := validate(tool.output, output); err != nil {
+			toolCalls.WithLabelValues(name, "invalid_output").Inc()
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidToolOutput, name, err)
+		}
+	}
+	if spec.DryRun.Record && !dryRun {
+		if err := r.record(context.WithoutCancel(ctx), spec, input, output); err != nil {
+			slog.Warn("tool response not recorded", "tool", name, "error", err)
+		}
+	}
+	toolCalls.WithLabelValues(name, "ok").Inc()
+	return output, nil
+}
+
+// tool returns the compiled latest version of name. The version is looked
+// up on every call, so a version registered through another replica is
+// picked up at once; only its compilation is cached.
+func (r *ToolRegistry) tool(ctx context.Context, name string) (compiledTool, error) {
+	var latest sql.NullInt64
+	if err := r.m.db.QueryRowContext(ctx,
+		`SELECT MAX(version) FROM agent_tools WHERE name = $1`, name).Scan(&latest); err != nil {
+		return compiledTool{}, fmt.Errorf("tool query failed: %w", err)
+	}
+	if !latest.Valid {
+		return compiledTool{}, fmt.Errorf("%w: %s", ErrToolNotFound, name)
+	}
+
+	r.mu.RLock()
+	tool, ok := r.compiled[toolKey(name, int(latest.Int64))]
+	r.mu.RUnlock()
+	if ok {
+		return tool, nil
+	}
+
+	spec, err := r.Get(ctx, name)
+	if err != nil {
+		return compiledTool{}, err
+	}
+	if tool, err = compileTool(spec); err != nil {
+		return compiledTool{}, err
+	}
+	r.mu.Lock()
+	r.evict(name)
+	r.compiled[toolKey(name, spec.Version)] = tool
+	r.mu.Unlock()
+	return tool, nil
+}
+
+func (r *ToolRegistry) allow(spec ToolSpec, caller Caller) bool {
+	if spec.RateLimit.PerMinute <= 0 {
+		return true
+	}
+	key := toolKey(spec.Name, spec.Version) + "\x00" + caller.AgentID
+
+	r.mu.Lock()
+	lim, ok := r.limiters[key]
+	if !ok {
+		burst := spec.RateLimit.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		lim = rate.NewLimiter(rate.Limit(float64(spec.RateLimit.PerMinute)/60), burst)
+		r.limiters[key] = lim
+	}
+	r.mu.Unlock()
+	return lim.Allow()
+}
+
+// callerScopes resolves the scopes agentID calls tools with from the
+// grants stored with the agent. requested narrows them; asking for a scope
+// the agent was not granted fails with ErrToolForbidden.
+func (m *Manager) callerScopes(ctx context.Context, tenantID, agentID string, requested []string) ([]string, error) {
+	def, err := m.GetAgent(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if def.TenantID != tenantID {
+		return nil, fmt.Errorf("%w: agent %s is not in tenant %s", ErrToolForbidden, agentID, tenantID)
+	}
+	if len(requested) == 0 {
+		return def.Scopes, nil
+	}
+	granted := Caller{Scopes: def.Scopes}
+	for _, scope := range requested {
+		if !granted.has(scope) {
+			return nil, fmt.Errorf("%w: agent %s is not granted scope %q", ErrToolForbidden, agentID, scope)
+		}
+	}
+	return requested, nil
+}
+
+func authorized(spec ToolSpec, caller Caller) bool {
+	for _, scope := range spec.Auth.Scopes {
+		if !caller.has(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func compileTool(spec ToolSpec) (compiledTool, error) {
+	tool := compiledTool{spec: spec}
+	var err error
+	if tool.input, err = compileSchema(spec.Name+"/input", spec.InputSchema); err != nil {
+		return tool, fmt.Errorf("invalid input schema for %s: %w", spec.Name, err)
+	}
+	if len(spec.OutputSchema) > 0 {
+		if tool.output, err = compileSchema(spec.Name+"/output", spec.OutputSchema); err != nil {
+			return tool, fmt.Errorf("invalid output schema for %s: %w", spec.Name, err)
+		}
+	}
+	return tool, nil
+}
+
+func compileSchema(id string, raw json.RawMessage) (*jsonschema.Schema, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("schema is empty")
+	}
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft2020
+	if err := c.AddResource(id, bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return c.Compile(id)
+}
+
+func validate(schema *jsonschema.Schema, raw json.RawMessage) error {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("not valid JSON: %w", err)
+	}
+	return schema.Validate(v)
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_tools (
+    name          VARCHAR(255) NOT NULL,
+    version       INT NOT NULL,
+    description   TEXT NOT NULL DEFAULT '',
+    input_schema  JSONB NOT NULL,
+    output_schema JSONB,
+    auth          JSONB NOT NULL DEFAULT '{}',
+    rate_limit    JSONB NOT NULL DEFAULT '{}',
+    sandbox       JSONB NOT NULL DEFAULT '{}',
+    runtime       VARCHAR(64) NOT NULL,
+    target        TEXT NOT NULL DEFAULT '',
+    dry_run       JSONB NOT NULL DEFAULT '{}',
+    policy        JSONB NOT NULL DEFAULT '{}',
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (name, version)
+);
+*/
@@ -0,0 +1,458 @@
+// usage.go - Per-Agent Usage, Cost and Budgets
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// budgetSubjectPrefix carries budget warnings and stops for alerting; the
+// tenant ID is appended
+const budgetSubjectPrefix = "agent.budgets."
+
+const defaultSoftBudgetRatio = 0.8
+
+// ErrBudgetExceeded is returned for work by an agent whose hard budget is
+// spent for the current period
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+var (
+	usageTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_agent_usage_total",
+		Help: "Metered agent usage by resource",
+	}, []string{"tenant", "resource"})
+
+	budgetEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_agent_budget_events_total",
+		Help: "Budget thresholds crossed by level",
+	}, []string{"tenant", "level"})
+)
+
+func init() {
+	prometheus.MustRegister(usageTotal, budgetEvents)
+}
+
+// Pricing converts usage into cost for chargeback, in the billing
+// currency's units
+type Pricing struct {
+	PerThousandPromptTokens     float64 `json:"per_thousand_prompt_tokens"`
+	PerThousandCompletionTokens float64 `json:"per_thousand_completion_tokens"`
+	PerToolCall                 float64 `json:"per_tool_call"`
+	PerComputeSecond            float64 `json:"per_compute_second"`
+}
+
+// Usage is metered consumption; RecordUsage adds it to the period totals
+type Usage struct {
+	PromptTokens     int64   `json:"prompt_tokens" db:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens" db:"completion_tokens"`
+	ToolCalls        int64   `json:"tool_calls" db:"tool_calls"`
+	ComputeSeconds   float64 `json:"compute_seconds" db:"compute_seconds"`
+}
+
+func (u Usage) cost(p Pricing) float64 {
+	return float64(u.PromptTokens)/1000*p.PerThousandPromptTokens +
+		float64(u.CompletionTokens)/1000*p.PerThousandCompletionTokens +
+		float64(u.ToolCalls)*p.PerToolCall +
+		u.ComputeSeconds*p.PerComputeSecond
+}
+
+// Spend is usage over one monthly period. AgentID is empty for tenant
+// totals.
+type Spend struct {
+	TenantID string    `json:"tenant_id" db:"tenant_id"`
+	AgentID  string    `json:"agent_id,omitempty" db:"agent_id"`
+	Period   time.Time `json:"period" db:"period"`
+	Usage
+	Cost float64 `json:"cost" db:"-"`
+}
+
+// Budget caps an agent's, or with an empty AgentID a whole tenant's,
+// monthly usage. Zero limits are unlimited. Crossing SoftRatio of any
+// limit warns; reaching a limit warns again, and with HardStop set the
+// affected agents get no more work until the period ends or the budget is
+// raised.
+type Budget struct {
+	TenantID         string  `json:"tenant_id" db:"tenant_id"`
+	AgentID          string  `json:"agent_id,omitempty" db:"agent_id"`
+	TokenLimit       int64   `json:"token_limit,omitempty" db:"token_limit"`
+	ToolCallLimit    int64   `json:"tool_call_limit,omitempty" db:"tool_call_limit"`
+	ComputeSecsLimit float64 `json:"compute_seconds_limit,omitempty" db:"compute_seconds_limit"`
+	CostLimit        float64 `json:"cost_limit,omitempty" db:"cost_limit"`
+	SoftRatio        float64 `json:"soft_ratio,omitempty" db:"soft_ratio"`
+	HardStop         bool    `json:"hard_stop" db:"hard_stop"`
+}
+
+// usedRatio is the largest fraction of any limit spent
+func (b Budget) usedRatio(s Spend) float64 {
+	var ratio float64
+	check := func(used, limit float64) {
+		if limit > 0 && used/limit > ratio {
+			ratio = used / limit
+		}
+	}
+	check(float64(s.PromptTokens+s.CompletionTokens), float64(b.TokenLimit))
+	check(float64(s.ToolCalls), float64(b.ToolCallLimit))
+	check(s.ComputeSeconds, b.ComputeSecsLimit)
+	check(s.Cost, b.CostLimit)
+	return ratio
+}
+
+// usageMeter collects the tokens reported by the model calls of one
+// running task
+type usageMeter struct {
+	prompt     atomic.Int64
+	completion atomic.Int64
+}
+
+type usageMeterKey struct{}
+
+func withUsageMeter(ctx context.Context) (context.Context, *usageMeter) {
+	meter := &usageMeter{}
+	return context.WithValue(ctx, usageMeterKey{}, meter), meter
+}
+
+// MeterTokens adds the tokens of one model completion to the task running
+// on ctx; they are recorded against the task's agent, and count toward
+// its token budgets, when the task ends. Generators call it with the
+// counts their provider returns. Outside a task it does nothing.
+func MeterTokens(ctx context.Context, promptTokens, completionTokens int64) {
+	if meter, ok := ctx.Value(usageMeterKey{}).(*usageMeter); ok {
+		meter.prompt.Add(promptTokens)
+		meter.completion.Add(completionTokens)
+	}
+}
+
+// billingPeriod is the first day of t's month in UTC
+func billingPeriod(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// RecordUsage meters usage against an agent and evaluates the budgets
+// covering it
+func (m *Manager) RecordUsage(ctx context.Context, tenantID, agentID string, u Usage) error {
+	if u == (Usage{}) {
+		return nil
+	}
+	period := billingPeriod(time.Now())
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO agent_usage (tenant_id, agent_id, period, prompt_tokens, completion_tokens, tool_calls, compute_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (tenant_id, agent_id, period) DO UPDATE SET
+		    prompt_tokens = agent_usage.prompt_tokens + EXCLUDED.prompt_tokens,
+		    completion_tokens = agent_usage.completion_tokens + EXCLUDED.completion_tokens,
+		    tool_calls = agent_usage.tool_calls + EXCLUDED.tool_calls,
+		    compute_seconds = agent_usage.compute_seconds + EXCLUDED.compute_seconds`,
+		tenantID, agentID, period, u.PromptTokens, u.CompletionTokens, u.ToolCalls, u.ComputeSeconds); err != nil {
+		return fmt.Errorf("usage update failed: %w", err)
+	}
+
+	var crossed []budgetEvent
+	for _, scope := range []string{agentID, ""} {
+		ev, err := m.evaluateBudget(ctx, tx, tenantID, scope, period)
+		if err != nil {
+			return err
+		}
+		if ev != nil {
+			crossed = append(crossed, *ev)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+
+	usageTotal.WithLabelValues(tenantID, "prompt_tokens").Add(float64(u.PromptTokens))
+	usageTotal.WithLabelValues(tenantID, "completion_tokens").Add(float64(u.CompletionTokens))
+	usageTotal.WithLabelValues(tenantID, "tool_calls").Add(float64(u.ToolCalls))
+	usageTotal.WithLabelValues(tenantID, "compute_seconds").Add(u.ComputeSeconds)
+
+	for _, ev := range crossed {
+		m.announceBudget(ctx, ev)
+	}
+	return nil
+}
+
+type budgetEvent struct {
+	TenantID string  `json:"tenant_id"`
+	AgentID  string  `json:"agent_id,omitempty"`
+	Level    string  `json:"level"`
+	Ratio    float64 `json:"ratio"`
+	Stopped  bool    `json:"stopped"`
+}
+
+// evaluateBudget checks one budget against the period's spend and marks
+// the thresholds crossed, once per period each
+func (m *Manager) evaluateBudget(ctx context.Context, tx *sqlx.Tx, tenantID, agentID string, period time.Time) (*budgetEvent, error) {
+	var b struct {
+		Budget
+		WarnedPeriod   sql.NullTime `db:"warned_period"`
+		ExceededPeriod sql.NullTime `db:"exceeded_period"`
+	}
+	err := tx.GetContext(ctx, &b, `
+		SELECT tenant_id, agent_id, token_limit, tool_call_limit, compute_seconds_limit, cost_limit,
+		       soft_ratio, hard_stop, warned_period, exceeded_period
+		FROM agent_budgets WHERE tenant_id = $1 AND agent_id = $2
+		FOR UPDATE`, tenantID, agentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("budget query failed: %w", err)
+	}
+
+	spend, err := m.spend(ctx, tx, tenantID, agentID, period)
+	if err != nil {
+		return nil, err
+	}
+	ratio := b.usedRatio(spend)
+	soft := b.SoftRatio
+	if soft <= 0 {
+		soft = defaultSoftBudgetRatio
+	}
+
+	var level string
+	switch {
+	case ratio >= 1 && !(b.ExceededPeriod.Valid && b.ExceededPeriod.Time.Equal(period)):
+		level = "exceeded"
+		_, err = tx.ExecContext(ctx, `
+			UPDATE agent_budgets SET exceeded_period = $3, warned_period = $3
+			WHERE tenant_id = $1 AND agent_id = $2`, tenantID, agentID, period)
+	case ratio >= soft && !(b.WarnedPeriod.Valid && b.WarnedPeriod.Time.Equal(period)):
+		level = "warning"
+		_, err = tx.ExecContext(ctx, `
+			UPDATE agent_budgets SET warned_period = $3
+			WHERE tenant_id = $1 AND agent_id = $2`, tenantID, agentID, period)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("budget update failed: %w", err)
+	}
+	return &budgetEvent{
+		TenantID: tenantID,
+		AgentID:  agentID,
+		Level:    level,
+		Ratio:    ratio,
+		Stopped:  level == "exceeded" && b.HardStop,
+	}, nil
+}
+
+func (m *Manager) announceBudget(ctx context.Context, ev budgetEvent) {
+	budgetEvents.WithLabelValues(ev.TenantID, ev.Level).Inc()
+	attrs := []any{"tenant_id", ev.TenantID, "agent_id", ev.AgentID, "used", ev.Ratio, "stopped", ev.Stopped}
+	if ev.Level == "exceeded" {
+		slog.Error("agent budget exceeded", attrs...)
+	} else {
+		slog.Warn("agent budget nearly spent", attrs...)
+	}
+	if n := m.getNotifier(); n != nil {
+		if err := n.Publish(ctx, budgetSubjectPrefix+ev.TenantID, ev); err != nil {
+			slog.Warn("budget notification failed", "tenant_id", ev.TenantID, "error", err)
+		}
+	}
+}
+
+// spend totals an agent's period usage, or the tenant's with an empty
+// agentID
+func (m *Manager) spend(ctx context.Context, q sqlx.QueryerContext, tenantID, agentID string, period time.Time) (Spend, error) {
+	s := Spend{TenantID: tenantID, AgentID: agentID, Period: period}
+	err := sqlx.GetContext(ctx, q, &s.Usage, `
+		SELECT COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+		       COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+		       COALESCE(SUM(tool_calls), 0) AS tool_calls,
+		       COALESCE(SUM(compute_seconds), 0) AS compute_seconds
+		FROM agent_usage
+		WHERE tenant_id = $1 AND ($2 = '' OR agent_id = $2) AND period = $3`,
+		tenantID, agentID, period)
+	if err != nil {
+		return Spend{}, fmt.Errorf("spend query failed: %w", err)
+	}
+	s.Cost = s.Usage.cost(m.cfg.Pricing)
+	return s, nil
+}
+
+// GetSpend returns usage and cost for the period containing at, for one
+// agent or, with an empty agentID, the whole tenant
+func (m *Manager) GetSpend(ctx context.Context, tenantID, agentID string, at time.Time) (Spend, error) {
+	return m.spend(ctx, m.db, tenantID, agentID, billingPeriod(at))
+}
+
+// ListSpend breaks a tenant's period spend down by agent
+func (m *Manager) ListSpend(ctx context.Context, tenantID string, at time.Time) ([]Spend, error) {
+	spends := []Spend{}
+	err := m.db.SelectContext(ctx, &spends, `
+		SELECT tenant_id, agent_id, period, prompt_tokens, completion_tokens, tool_calls, compute_seconds
+		FROM agent_usage WHERE tenant_id = $1 AND period = $2
+		ORDER BY agent_id`, tenantID, billingPeriod(at))
+	if err != nil {
+		return nil, fmt.Errorf("spend query failed: %w", err)
+	}
+	for i := range spends {
+		spends[i].Cost = spends[i].Usage.cost(m.cfg.Pricing)
+	}
+	return spends, nil
+}
+
+// SetBudget creates or replaces a budget. Thresholds already crossed
+// this period are re-evaluated at the next recorded usage.
+func (m *Manager) SetBudget(ctx context.Context, b Budget) error {
+	if b.TenantID == "" {
+		return fmt.Errorf("budget needs a tenant")
+	}
+	if _, err := m.db.ExecContext(ctx, `
+		INSERT INTO agent_budgets (tenant_id, agent_id, token_limit, tool_call_limit, compute_seconds_limit,
+		                           cost_limit, soft_ratio, hard_stop)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (tenant_id, agent_id) DO UPDATE SET
+		    token_limit = EXCLUDED.token_limit, tool_call_limit = EXCLUDED.tool_call_limit,
+		    compute_seconds_limit = EXCLUDED.compute_seconds_limit, cost_limit = EXCLUDED.cost_limit,
+		    soft_ratio = EXCLUDED.soft_ratio, hard_stop = EXCLUDED.hard_stop,
+		    warned_period = NULL, exceeded_period = NULL`,
+		b.TenantID, b.AgentID, b.TokenLimit, b.ToolCallLimit, b.ComputeSecsLimit,
+		b.CostLimit, b.SoftRatio, b.HardStop); err != nil {
+		return fmt.Errorf("budget update failed: %w", err)
+	}
+	return nil
+}
+
+// checkBudget fails with ErrBudgetExceeded when a hard budget covering the
+// agent is spent for the current period
+func (m *Manager) checkBudget(ctx context.Context, tenantID, agentID string) error {
+	var stopped bool
+	err := m.db.GetContext(ctx, &stopped, `
+		SELECT EXISTS (SELECT 1 FROM agent_budgets
+		               WHERE tenant_id = $1 AND agent_id IN ('', $2)
+		                 AND hard_stop AND exceeded_period = $3)`,
+		tenantID, agentID, billingPeriod(time.Now()))
+	if err != nil {
+		return fmt.Errorf("budget check failed: %w", err)
+	}
+	if stopped {
+		return fmt.Errorf("%w for agent %s", ErrBudgetExceeded, agentID)
+	}
+	return nil
+}
+
+// budgetFilter excludes tasks of agents stopped by a hard budget from
+// claims on agent_tasks
+const budgetFilter = `
+		      AND NOT EXISTS (SELECT 1 FROM agent_budgets b
+		                      WHERE b.tenant_id = agent_tasks.tenant_id
+		                        AND b.agent_id IN ('', agent_tasks.agent_id)
+		                        AND b.hard_stop
+		                        AND b.exceeded_period = date_trunc('month', NOW() AT TIME ZONE 'UTC')::date)`
+
+// UsageHandler serves spend and budgets under /api/usage/:
+//
+//	GET /api/usage/?tenant_id=&agent_id=&period=2006-01   spend
+//	GET /api/usage/agents?tenant_id=&period=2006-01       spend by agent
+//	PUT /api/usage/budget                                 set a budget
+//
+// Spend is reported for the caller's tenant; setting budgets takes the
+// admin permission.
+func (m *Manager) UsageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		at := time.Now()
+		if p := q.Get("period"); p != "" {
+			t, err := time.Parse("2006-01", p)
+			if err != nil {
+				http.Error(w, "period must be YYYY-MM", http.StatusBadRequest)
+				return
+			}
+			at = t
+		}
+
+		var (
+			body any
+			err  error
+		)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/usage/":
+			tenantID, ok := requestTenant(w, r, q.Get("tenant_id"))
+			if !ok {
+				return
+			}
+			body, err = m.GetSpend(r.Context(), tenantID, q.Get("agent_id"), at)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/usage/agents":
+			tenantID, ok := requestTenant(w, r, q.Get("tenant_id"))
+			if !ok {
+				return
+			}
+			body, err = m.ListSpend(r.Context(), tenantID, at)
+		case r.Method == http.MethodPut && r.URL.Path == "/api/usage/budget":
+			// a tenant must not lift its own spending limits
+			if p, _ := PrincipalFrom(r.Context()); !p.Has(PermAdmin) {
+				http.Error(w, "setting budgets requires the admin permission", http.StatusForbidden)
+				return
+			}
+			var b Budget
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&b); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			tenantID, ok := requestTenant(w, r, b.TenantID)
+			if !ok {
+				return
+			}
+			b.TenantID = tenantID
+			if err = m.SetBudget(r.Context(), b); err == nil {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+/*
+CREATE TABLE IF NOT EXISTS agent_usage (
+    tenant_id         VARCHAR(255) NOT NULL,
+    agent_id          VARCHAR(255) NOT NULL,
+    period            DATE NOT NULL,
+    prompt_tokens     BIGINT NOT NULL DEFAULT 0,
+    completion_tokens BIGINT NOT NULL DEFAULT 0,
+    tool_calls        BIGINT NOT NULL DEFAULT 0,
+    compute_seconds   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, period, agent_id)
+);
+
+CREATE TABLE IF NOT EXISTS agent_budgets (
+    tenant_id             VARCHAR(255) NOT NULL,
+    agent_id              VARCHAR(255) NOT NULL DEFAULT '',
+    token_limit           BIGINT NOT NULL DEFAULT 0,
+    tool_call_limit       BIGINT NOT NULL DEFAULT 0,
+    compute_seconds_limit DOUBLE PRECISION NOT NULL DEFAULT 0,
+    cost_limit            DOUBLE PRECISION NOT NULL DEFAULT 0,
+    soft_ratio            DOUBLE PRECISION NOT NULL DEFAULT 0,
+    hard_stop             BOOLEAN NOT NULL DEFAULT FALSE,
+    warned_period         DATE,
+    exceeded_period       DATE,
+    PRIMARY KEY (tenant_id, agent_id)
+);
+*/
@@ -0,0 +1,912 @@
+// workflow.go - Durable DAG Workflow Engine
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ErrWorkflowNotFound is returned for unknown workflow runs
+	ErrWorkflowNotFound = errors.New("workflow not found")
+	// ErrInvalidWorkflow wraps workflow spec validation failures
+	ErrInvalidWorkflow = errors.New("invalid workflow")
+)
+
+var workflowsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_agent_workflows_total",
+	Help: "Workflow runs by outcome",
+}, []string{"outcome"})
+
+func init() {
+	prometheus.MustRegister(workflowsTotal)
+}
+
+// WorkflowState is the lifecycle of a run
+type WorkflowState string
+
+const (
+	WorkflowRunning   WorkflowState = "running"
+	WorkflowSucceeded WorkflowState = "succeeded"
+	WorkflowFailed    WorkflowState = "failed"
+	WorkflowCancelled WorkflowState = "cancelled"
+
+	// WorkflowCompensating runs have failed and are undoing their steps
+	WorkflowCompensating WorkflowState = "compensating"
+)
+
+// StepState is the lifecycle of one step within a run
+type StepState string
+
+const (
+	StepPending   StepState = "pending"
+	StepRunning   StepState = "running"
+	StepSucceeded StepState = "succeeded"
+	StepFailed    StepState = "failed"
+	StepSkipped   StepState = "skipped"
+	StepCancelled StepState = "cancelled"
+
+	// compensation states of steps in compensating runs
+	StepCompensating       StepState = "compensating"
+	StepCompensated        StepState = "compensated"
+	StepCompensationFailed StepState = "uncompensated"
+)
+
+func (s StepState) done() bool {
+	return s == StepSucceeded || s == StepSkipped
+}
+
+// JoinMode decides when a step with several dependencies may start
+type JoinMode string
+
+const (
+	// JoinAll waits for every dependency; the default
+	JoinAll JoinMode = "all"
+	// JoinAny starts on the first dependency to succeed
+	JoinAny JoinMode = "any"
+)
+
+// Condition gates a step on the output of one of its dependencies. The
+// step is skipped unless the value at Path equals Equals, or differs from
+// it when Negate is set.
+type Condition struct {
+	Step string `json:"step"`
+	// Path is a dot-separated field path into the step's JSON output;
+	// empty compares the whole output
+	Path   string          `json:"path,omitempty"`
+	Equals json.RawMessage `json:"equals"`
+	Negate bool            `json:"negate,omitempty"`
+}
+
+// WorkflowStep runs as a task of Kind on AgentID, or as a call to Tool
+// with Params as its input. Scopes restrict a tool step to some of the
+// scopes granted to its agent. Steps without a dependency start
+// immediately; several steps depending on one fan out from it.
+type WorkflowStep struct {
+	ID        string          `json:"id"`
+	AgentID   string          `json:"agent_id"`
+	Kind      string          `json:"kind,omitempty"`
+	Tool      string          `json:"tool,omitempty"`
+	Scopes    []string        `json:"scopes,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	DependsOn []string        `json:"depends_on,omitempty"`
+	Join      JoinMode        `json:"join,omitempty"`
+	When      *Condition      `json:"when,omitempty"`
+	Retry     RetryPolicy     `json:"retry,omitempty"`
+	Priority  int             `json:"priority,omitempty"`
+	// TimeoutSeconds bounds the step's task from when it is scheduled
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// Compensate undoes the step if the run fails. Tool steps default
+	// to the tool's retry and compensation policies.
+	Compensate *Compensation `json:"compensate,omitempty"`
+}
+
+// WorkflowSpec declares a pipeline as a DAG of steps
+type WorkflowSpec struct {
+	Name  string         `json:"name"`
+	Steps []WorkflowStep `json:"steps"`
+}
+
+// StepPayload is the task payload of a workflow step
+type StepPayload struct {
+	RunID  string          `json:"run_id"`
+	StepID string          `json:"step_id"`
+	Input  json.RawMessage `json:"input"`
+	Params json.RawMessage `json:"params,omitempty"`
+	// Upstream holds the outputs of the dependencies that succeeded
+	Upstream map[string]json.RawMessage `json:"upstream,omitempty"`
+}
+
+// StepStatus reports one step of a run
+type StepStatus struct {
+	ID         string          `json:"id" db:"step_id"`
+	State      StepState       `json:"state" db:"state"`
+	TaskID     string          `json:"task_id,omitempty" db:"task_id"`
+	Attempts   int             `json:"attempts" db:"attempts"`
+	Output     json.RawMessage `json:"output,omitempty" db:"output"`
+	Error      string          `json:"error,omitempty" db:"error"`
+	StartedAt  sql.NullTime    `json:"-" db:"started_at"`
+	FinishedAt sql.NullTime    `json:"-" db:"finished_at"`
+	// CompensationTaskID is the task that undid the step, if any
+	CompensationTaskID string `json:"compensation_task_id,omitempty" db:"compensation_task_id"`
+}
+
+// WorkflowStatus reports a run and its steps
+type WorkflowStatus struct {
+	ID        string          `json:"id" db:"id"`
+	TenantID  string          `json:"tenant_id" db:"tenant_id"`
+	Name      string          `json:"name" db:"name"`
+	State     WorkflowState   `json:"state" db:"state"`
+	Output    json.RawMessage `json:"output,omitempty" db:"output"`
+	Error     string          `json:"error,omitempty" db:"error"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at" db:"updated_at"`
+	Steps     []StepStatus    `json:"steps,omitempty" db:"-"`
+}
+
+// validate checks spec and orders its steps so every step follows its
+// dependencies
+func (spec *WorkflowSpec) validate() error {
+	if spec.Name == "" || len(spec.Steps) == 0 {
+		return fmt.Errorf("%w: needs a name and at least one step", ErrInvalidWorkflow)
+	}
+	byID := make(map[string]WorkflowStep, len(spec.Steps))
+	for _, st := range spec.Steps {
+		if st.ID == "" || st.AgentID == "" || (st.Kind == "") == (st.Tool == "") {
+			return fmt.Errorf("%w: every step needs an id, an agent and either a kind or a tool", ErrInvalidWorkflow)
+		}
+		if st.Compensate != nil {
+			if err := st.Compensate.validate(st.ID); err != nil {
+				return err
+			}
+		}
+		if _, dup := byID[st.ID]; dup {
+			return fmt.Errorf("%w: duplicate step %q", ErrInvalidWorkflow, st.ID)
+		}
+		if st.Join != "" && st.Join != JoinAll && st.Join != JoinAny {
+			return fmt.Errorf("%w: step %q has unknown join %q", ErrInvalidWorkflow, st.ID, st.Join)
+		}
+		byID[st.ID] = st
+	}
+	for _, st := range spec.Steps {
+		for _, dep := range st.DependsOn {
+			if _, ok := byID[dep]; !ok {
+				return fmt.Errorf("%w: step %q depends on unknown step %q", ErrInvalidWorkflow, st.ID, dep)
+			}
+		}
+		if st.When != nil && !contains(st.DependsOn, st.When.Step) {
+			return fmt.Errorf("%w: step %q conditions on %q, which it does not depend on",
+				ErrInvalidWorkflow, st.ID, st.When.Step)
+		}
+	}
+
+	// depth-first topological sort; a step met again while still on the
+	// stack closes a cycle
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int, len(byID))
+	ordered := make([]WorkflowStep, 0, len(byID))
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch marks[id] {
+		case visiting:
+			return fmt.Errorf("%w: cycle through step %q", ErrInvalidWorkflow, id)
+		case visited:
+			return nil
+		}
+		marks[id] = visiting
+		for _, dep := range byID[id].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[id] = visited
+		ordered = append(ordered, byID[id])
+		return nil
+	}
+	for _, st := range spec.Steps {
+		if err := visit(st.ID); err != nil {
+			return err
+		}
+	}
+	spec.Steps = ordered
+	return nil
+}
+
+// StartWorkflow persists a run of spec and schedules its first steps
+func (m *Manager) StartWorkflow(ctx context.Context, tenantID string, spec WorkflowSpec, input json.RawMessage) (string, error) {
+	if err := spec.validate(); err != nil {
+		return "", err
+	}
+	if err := m.resolveTools(ctx, &spec); err != nil {
+		return "", err
+	}
+	for _, st := range spec.Steps {
+		if st.Tool == "" || len(st.Scopes) == 0 {
+			continue
+		}
+		if _, err := m.callerScopes(ctx, tenantID, st.AgentID, st.Scopes); err != nil {
+			return "", fmt.Errorf("%w: step %q: %v", ErrInvalidWorkflow, st.ID, err)
+		}
+	}
+	if input == nil {
+		input = json.RawMessage("{}")
+	}
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	id, err := newTaskID()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO workflow_runs (id, tenant_id, name, spec, input, state)
+		VALUES ($1, $2, $3, $4, $5, 'running')`,
+		id, tenantID, spec.Name, raw, []byte(input)); err != nil {
+		return "", fmt.Errorf("workflow insert failed: %w", err)
+	}
+	for _, st := range spec.Steps {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO workflow_steps (run_id, step_id, state) VALUES ($1, $2, 'pending')`,
+			id, st.ID); err != nil {
+			return "", fmt.Errorf("workflow step insert failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit failed: %w", err)
+	}
+	workflowsTotal.WithLabelValues("started").Inc()
+
+	// the sweep picks the run up if this fails
+	if err := m.advanceWorkflow(ctx, id); err != nil {
+		slog.Warn("workflow scheduling deferred", "run_id", id, "error", err)
+	}
+	return id, nil
+}
+
+// GetWorkflow reports a run and the state of each step
+func (m *Manager) GetWorkflow(ctx context.Context, runID string) (WorkflowStatus, error) {
+	var status WorkflowStatus
+	err := m.db.GetContext(ctx, &status, `
+		SELECT id, tenant_id, name, state, COALESCE(output, 'null'::jsonb) AS output, error, created_at, updated_at
+		FROM workflow_runs WHERE id = $1`, runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return WorkflowStatus{}, fmt.Errorf("%w: %s", ErrWorkflowNotFound, runID)
+	}
+	if err != nil {
+		return WorkflowStatus{}, fmt.Errorf("workflow query failed: %w", err)
+	}
+	err = m.db.SelectContext(ctx, &status.Steps, `
+		SELECT s.step_id, s.state, s.task_id, COALESCE(t.attempts, 0) AS attempts,
+		       COALESCE(s.output, 'null'::jsonb) AS output, s.error, s.started_at, s.finished_at,
+		       s.compensation_task_id
+		FROM workflow_steps s
+		LEFT JOIN agent_tasks t ON t.id = NULLIF(s.task_id, '')
+		WHERE s.run_id = $1
+		ORDER BY s.started_at NULLS LAST, s.step_id`, runID)
+	if err != nil {
+		return WorkflowStatus{}, fmt.Errorf("workflow step query failed: %w", err)
+	}
+	return status, nil
+}
+
+// ListWorkflows returns a tenant's most recent runs, optionally filtered
+// by state, without their steps
+func (m *Manager) ListWorkflows(ctx context.Context, tenantID string, state WorkflowState, limit int) ([]WorkflowStatus, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	runs := []WorkflowStatus{}
+	err := m.db.SelectContext(ctx, &runs, `
+		SELECT id, tenant_id, name, state, COALESCE(output, 'null'::jsonb) AS output, error, created_at, updated_at
+		FROM workflow_runs
+		WHERE tenant_id = $1 AND ($2 = '' OR state = $2)
+		ORDER BY created_at DESC
+		LIMIT $3`, tenantID, string(state), limit)
+	if err != nil {
+		return nil, fmt.Errorf("workflow list failed: %w", err)
+	}
+	return runs, nil
+}
+
+// CancelWorkflow stops a running workflow and cancels its outstanding
+// tasks
+func (m *Manager) CancelWorkflow(ctx context.Context, runID string) error {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var state WorkflowState
+	err = tx.GetContext(ctx, &state, `SELECT state FROM workflow_runs WHERE id = $1 FOR UPDATE`, runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrWorkflowNotFound, runID)
+	}
+	if err != nil {
+		return fmt.Errorf("workflow query failed: %w", err)
+	}
+	if state != WorkflowRunning {
+		return nil
+	}
+	if err := m.finishWorkflow(ctx, tx, runID, WorkflowCancelled, nil, "cancelled"); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	workflowsTotal.WithLabelValues(string(WorkflowCancelled)).Inc()
+	return nil
+}
+
+// RunWorkflows sweeps running and compensating workflows until ctx ends,
+// advancing any whose step tasks finished without the completing worker
+// advancing them
+func (m *Manager) RunWorkflows(ctx context.Context) error {
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		var ids []string
+		err := m.db.SelectContext(ctx, &ids, `
+			SELECT r.id FROM workflow_runs r
+			WHERE (r.state = 'running' AND (
+			    EXISTS (SELECT 1 FROM workflow_steps s JOIN agent_tasks t ON t.id = s.task_id
+			            WHERE s.run_id = r.id AND s.state = 'running'
+			              AND t.state IN ('succeeded', 'failed', 'expired', 'cancelled'))
+			    OR NOT EXISTS (SELECT 1 FROM workflow_steps s
+			                   WHERE s.run_id = r.id AND s.state = 'running')))
+			   OR (r.state = 'compensating' AND NOT EXISTS (
+			    SELECT 1 FROM workflow_steps s JOIN agent_tasks t ON t.id = s.compensation_task_id
+			    WHERE s.run_id = r.id AND s.state = 'compensating' AND t.state IN ('queued', 'running')))
+			LIMIT 100`)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("workflow sweep failed", "error", err)
+		}
+		for _, id := range ids {
+			if err := m.advanceWorkflow(ctx, id); err != nil && ctx.Err() == nil {
+				slog.Warn("workflow advance failed", "run_id", id, "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// advanceTaskWorkflow advances the run a task belongs to, if any
+func (m *Manager) advanceTaskWorkflow(ctx context.Context, taskID string) error {
+	var runID string
+	err := m.db.GetContext(ctx, &runID, `
+		SELECT run_id FROM workflow_steps WHERE task_id = $1 OR compensation_task_id = $1
+		LIMIT 1`, taskID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("workflow step lookup failed: %w", err)
+	}
+	return m.advanceWorkflow(ctx, runID)
+}
+
+// stepRow is a step joined with the state of its task
+type stepRow struct {
+	StepID     string          `db:"step_id"`
+	State      StepState       `db:"state"`
+	TaskID     string          `db:"task_id"`
+	Output     json.RawMessage `db:"output"`
+	Error      string          `db:"error"`
+	TaskState  sql.NullString  `db:"task_state"`
+	TaskResult json.RawMessage `db:"task_result"`
+	TaskError  sql.NullString  `db:"task_error"`
+	FinishedAt sql.NullTime    `db:"finished_at"`
+	CompTaskID string          `db:"compensation_task_id"`
+	CompState  sql.NullString  `db:"compensation_state"`
+	CompError  sql.NullString  `db:"compensation_error"`
+
+	dirty bool
+}
+
+func (r *stepRow) settle(state StepState, output json.RawMessage, msg string) {
+	r.State, r.Output, r.Error, r.dirty = state, output, msg, true
+}
+
+// advanceWorkflow moves a run forward under a row lock, so replicas
+// advancing the same run concurrently take turns: finished tasks settle
+// their steps, then steps whose dependencies allow it are skipped or
+// scheduled in dependency order. A failed run with steps to undo moves to
+// compensating instead of failed; see compensateWorkflow.
+func (m *Manager) advanceWorkflow(ctx context.Context, runID string) error {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var run struct {
+		TenantID string          `db:"tenant_id"`
+		Spec     json.RawMessage `db:"spec"`
+		Input    json.RawMessage `db:"input"`
+		State    WorkflowState   `db:"state"`
+		Error    string          `db:"error"`
+	}
+	err = tx.GetContext(ctx, &run,
+		`SELECT tenant_id, spec, input, state, error FROM workflow_runs WHERE id = $1 FOR UPDATE`, runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrWorkflowNotFound, runID)
+	}
+	if err != nil {
+		return fmt.Errorf("workflow query failed: %w", err)
+	}
+	if run.State != WorkflowRunning && run.State != WorkflowCompensating {
+		return nil
+	}
+	var spec WorkflowSpec
+	if err := json.Unmarshal(run.Spec, &spec); err != nil {
+		return fmt.Errorf("corrupt spec for workflow %s: %w", runID, err)
+	}
+
+	var rows []*stepRow
+	err = tx.SelectContext(ctx, &rows, `
+		SELECT s.step_id, s.state, s.task_id, s.output, s.error, s.finished_at,
+		       t.state AS task_state, t.result AS task_result, t.error AS task_error,
+		       s.compensation_task_id, c.state AS compensation_state, c.error AS compensation_error
+		FROM workflow_steps s
+		LEFT JOIN agent_tasks t ON t.id = NULLIF(s.task_id, '')
+		LEFT JOIN agent_tasks c ON c.id = NULLIF(s.compensation_task_id, '')
+		WHERE s.run_id = $1`, runID)
+	if err != nil {
+		return fmt.Errorf("workflow step query failed: %w", err)
+	}
+	steps := make(map[string]*stepRow, len(rows))
+	for _, r := range rows {
+		steps[r.StepID] = r
+	}
+
+	var (
+		failure   string
+		submitted []Task
+	)
+	compensating := run.State == WorkflowCompensating
+	if !compensating {
+		for _, st := range spec.Steps {
+			row := steps[st.ID]
+			if row.State != StepRunning {
+				continue
+			}
+			switch TaskState(row.TaskState.String) {
+			case TaskSucceeded:
+				row.settle(StepSucceeded, row.TaskResult, "")
+			case TaskFailed, TaskExpired, TaskCancelled:
+				row.settle(StepFailed, nil, fmt.Sprintf("task %s: %s", row.TaskState.String, row.TaskError.String))
+				failure = fmt.Sprintf("step %s failed: %s", st.ID, row.Error)
+			}
+		}
+	}
+
+	if !compensating && failure == "" {
+		for _, st := range spec.Steps {
+			row := steps[st.ID]
+			if row.State != StepPending {
+				continue
+			}
+			ready, skip := stepReady(st, steps)
+			if !ready && !skip {
+				continue
+			}
+			// an any-join may be ready before the step its condition
+			// reads has finished; the condition waits for that output
+			if !skip && st.When != nil {
+				if s := steps[st.When.Step].State; s == StepPending || s == StepRunning {
+					continue
+				}
+			}
+			if skip || (st.When != nil && !st.When.holds(steps[st.When.Step])) {
+				row.settle(StepSkipped, nil, "")
+				continue
+			}
+			task, err := m.scheduleStep(ctx, tx, runID, run.TenantID, run.Input, st, steps)
+			if err != nil {
+				return err
+			}
+			row.State, row.TaskID, row.dirty = StepRunning, task.ID, true
+			submitted = append(submitted, task)
+		}
+	}
+	if err := saveSteps(ctx, tx, runID, rows); err != nil {
+		return err
+	}
+
+	if failure != "" && compensable(spec, steps) {
+		if err := cancelOutstanding(ctx, tx, runID); err != nil {
+			return err
+		}
+		compensating, run.Error = true, failure
+		workflowsTotal.WithLabelValues(string(WorkflowCompensating)).Inc()
+		slog.Info("workflow compensating", "run_id", runID, "name", spec.Name, "error", failure)
+	}
+	compensated := false
+	if compensating {
+		task, done, err := m.compensateWorkflow(ctx, tx, runID, run.TenantID, run.Input, spec, steps)
+		if err != nil {
+			return err
+		}
+		if task != nil {
+			submitted = append(submitted, *task)
+		}
+		compensated = done
+		if err := saveSteps(ctx, tx, runID, rows); err != nil {
+			return err
+		}
+	}
+
+	outcome := WorkflowState("")
+	switch {
+	case compensated:
+		outcome = WorkflowFailed
+		err = m.finishWorkflow(ctx, tx, runID, WorkflowFailed, nil, run.Error+compensationErrors(spec, steps))
+	case compensating:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE workflow_runs SET state = 'compensating', error = $2, updated_at = NOW()
+			WHERE id = $1`, runID, run.Error)
+	case failure != "":
+		outcome = WorkflowFailed
+		err = m.finishWorkflow(ctx, tx, runID, WorkflowFailed, nil, failure)
+	case allDone(steps):
+		outcome = WorkflowSucceeded
+		err = m.finishWorkflow(ctx, tx, runID, WorkflowSucceeded, workflowOutput(spec, steps), "")
+	default:
+		_, err = tx.ExecContext(ctx, `UPDATE workflow_runs SET updated_at = NOW() WHERE id = $1`, runID)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+
+	if outcome != "" {
+		workflowsTotal.WithLabelValues(string(outcome)).Inc()
+		slog.Info("workflow finished", "run_id", runID, "name", spec.Name, "state", outcome)
+	}
+	for _, task := range submitted {
+		m.notifyTask(ctx, task)
+	}
+	return nil
+}
+
+// saveSteps writes back the steps advanceWorkflow changed
+func saveSteps(ctx context.Context, tx *sqlx.Tx, runID string, rows []*stepRow) error {
+	for _, row := range rows {
+		if !row.dirty {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE workflow_steps
+			SET state = $3, task_id = $4, output = $5, error = $6, compensation_task_id = $7,
+			    started_at = CASE WHEN $3 = 'running' THEN NOW() ELSE started_at END,
+			    finished_at = CASE WHEN $3 IN ('succeeded', 'failed', 'skipped') THEN NOW() ELSE finished_at END
+			WHERE run_id = $1 AND step_id = $2`,
+			runID, row.StepID, row.State, row.TaskID, nullJSON(row.Output), row.Error, row.CompTaskID); err != nil {
+			return fmt.Errorf("workflow step update failed: %w", err)
+		}
+		row.dirty = false
+	}
+	return nil
+}
+
+// stepReady reports whether st's dependencies let it start, or rule it
+// out because none that it needs succeeded
+func stepReady(st WorkflowStep, steps map[string]*stepRow) (ready, skip bool) {
+	var succeeded, finished int
+	for _, dep := range st.DependsOn {
+		switch steps[dep].State {
+		case StepSucceeded:
+			succeeded++
+			finished++
+		case StepSkipped:
+			finished++
+		}
+	}
+	all := finished == len(st.DependsOn)
+	if len(st.DependsOn) == 0 {
+		return true, false
+	}
+	if st.Join == JoinAny {
+		return succeeded > 0, all && succeeded == 0
+	}
+	return all && succeeded > 0, all && succeeded == 0
+}
+
+func (m *Manager) scheduleStep(ctx context.Context, tx *sqlx.Tx, runID, tenantID string, input json.RawMessage,
+	st WorkflowStep, steps map[string]*stepRow) (Task, error) {
+	var payload any
+	if st.Tool != "" {
+		payload = ToolTaskPayload{RunID: runID, StepID: st.ID, Tool: st.Tool, Scopes: st.Scopes,
+			Input: toolInput(st.Params, input)}
+	} else {
+		p := StepPayload{RunID: runID, StepID: st.ID, Input: input, Params: st.Params}
+		for _, dep := range st.DependsOn {
+			if steps[dep].State == StepSucceeded {
+				if p.Upstream == nil {
+					p.Upstream = make(map[string]json.RawMessage)
+				}
+				p.Upstream[dep] = steps[dep].Output
+			}
+		}
+		payload = p
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Task{}, err
+	}
+
+	spec := TaskSpec{
+		TenantID: tenantID,
+		AgentID:  st.AgentID,
+		Kind:     st.Kind,
+		Payload:  raw,
+		Priority: st.Priority,
+		Retry:    st.Retry,
+	}
+	if st.TimeoutSeconds > 0 {
+		spec.Deadline = time.Now().Add(time.Duration(st.TimeoutSeconds) * time.Second)
+	}
+	return m.insertTask(ctx, tx, spec)
+}
+
+// finishWorkflow records a run's outcome and cancels whatever it still
+// has outstanding
+func (m *Manager) finishWorkflow(ctx context.Context, tx *sqlx.Tx, runID string, state WorkflowState,
+	output json.RawMessage, msg string) error {
+	if err := cancelOutstanding(ctx, tx, runID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE workflow_runs SET state = $2, output = $3, error = $4, updated_at = NOW()
+		WHERE id = $1`, runID, state, nullJSON(output), msg); err != nil {
+		return fmt.Errorf("workflow update failed: %w", err)
+	}
+	return nil
+}
+
+// cancelOutstanding cancels a run's pending steps and running tasks
+func cancelOutstanding(ctx context.Context, tx *sqlx.Tx, runID string) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE agent_tasks
+		SET state = 'cancelled', lease_expires_at = NULL, updated_at = NOW()
+		WHERE state IN ('queued', 'running')
+		  AND id IN (SELECT task_id FROM workflow_steps WHERE run_id = $1 AND state = 'running')`,
+		runID); err != nil {
+		return fmt.Errorf("workflow task cancellation failed: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE workflow_steps SET state = 'cancelled', finished_at = NOW()
+		WHERE run_id = $1 AND state IN ('pending', 'running')`, runID); err != nil {
+		return fmt.Errorf("workflow step cancellation failed: %w", err)
+	}
+	return nil
+}
+
+func allDone(steps map[string]*stepRow) bool {
+	for _, r := range steps {
+		if !r.State.done() {
+			return false
+		}
+	}
+	return true
+}
+
+// workflowOutput collects the outputs of the steps nothing depends on
+func workflowOutput(spec WorkflowSpec, steps map[string]*stepRow) json.RawMessage {
+	needed := make(map[string]bool)
+	for _, st := range spec.Steps {
+		for _, dep := range st.DependsOn {
+			needed[dep] = true
+		}
+	}
+	out := make(map[string]json.RawMessage)
+	for _, st := range spec.Steps {
+		if !needed[st.ID] && steps[st.ID].State == StepSucceeded {
+			out[st.ID] = steps[st.ID].Output
+		}
+	}
+	raw, _ := json.Marshal(out)
+	return raw
+}
+
+// holds evaluates c against the row of the step it references
+func (c *Condition) holds(row *stepRow) bool {
+	if row.State != StepSucceeded {
+		return false
+	}
+	var value any
+	if err := json.Unmarshal(row.Output, &value); err != nil {
+		return false
+	}
+	if c.Path != "" {
+		for _, field := range strings.Split(c.Path, ".") {
+			obj, ok := value.(map[string]any)
+			if !ok {
+				return c.Negate
+			}
+			if value, ok = obj[field]; !ok {
+				return c.Negate
+			}
+		}
+	}
+	var want any
+	if err := json.Unmarshal(c.Equals, &want); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(value, want) != c.Negate
+}
+
+// WorkflowHandler serves the workflow API under /api/workflows/:
+//
+//	POST   /api/workflows/                  start a run
+//	GET    /api/workflows/?tenant_id=&state= list runs
+//	GET    /api/workflows/{id}              run and step status
+//	DELETE /api/workflows/{id}              cancel a run
+//
+// Runs are started and seen in the caller's tenant; only platform
+// callers name a tenant_id.
+func (m *Manager) WorkflowHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/workflows/")
+		if strings.Contains(id, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		var (
+			body any
+			err  error
+		)
+		switch {
+		case r.Method == http.MethodPost && id == "":
+			var req struct {
+				TenantID string          `json:"tenant_id"`
+				Spec     WorkflowSpec    `json:"spec"`
+				Input    json.RawMessage `json:"input"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			tenantID, ok := requestTenant(w, r, req.TenantID)
+			if !ok {
+				return
+			}
+			var runID string
+			if runID, err = m.StartWorkflow(r.Context(), tenantID, req.Spec, req.Input); err == nil {
+				w.WriteHeader(http.StatusAccepted)
+				body = map[string]string{"id": runID}
+			}
+		case r.Method == http.MethodGet && id == "":
+			q := r.URL.Query()
+			tenantID, ok := requestTenant(w, r, q.Get("tenant_id"))
+			if !ok {
+				return
+			}
+			limit, _ := strconv.Atoi(q.Get("limit"))
+			body, err = m.ListWorkflows(r.Context(), tenantID, WorkflowState(q.Get("state")), limit)
+		case r.Method == http.MethodGet:
+			body, err = m.ownedWorkflow(r.Context(), id)
+		case r.Method == http.MethodDelete && id != "":
+			if _, err = m.ownedWorkflow(r.Context(), id); err != nil {
+				break
+			}
+			if err = m.CancelWorkflow(r.Context(), id); err == nil {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrWorkflowNotFound):
+			http.NotFound(w, r)
+			return
+		case errors.Is(err, ErrInvalidWorkflow):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// ownedWorkflow returns runID's status if the principal on ctx may see it;
+// runs of other tenants are not found
+func (m *Manager) ownedWorkflow(ctx context.Context, runID string) (WorkflowStatus, error) {
+	status, err := m.GetWorkflow(ctx, runID)
+	if err != nil {
+		return WorkflowStatus{}, err
+	}
+	if !actsFor(ctx, status.TenantID) {
+		return WorkflowStatus{}, fmt.Errorf("%w: %s", ErrWorkflowNotFound, runID)
+	}
+	return status, nil
+}
+
+func nullJSON(raw json.RawMessage) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+CREATE TABLE IF NOT EXISTS workflow_runs (
+    id         VARCHAR(64) PRIMARY KEY,
+    tenant_id  VARCHAR(255) NOT NULL DEFAULT '',
+    name       VARCHAR(255) NOT NULL,
+    spec       JSONB NOT NULL,
+    input      JSONB NOT NULL DEFAULT '{}',
+    state      VARCHAR(16) NOT NULL,
+    output     JSONB,
+    error      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_workflow_runs_tenant ON workflow_runs (tenant_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_workflow_runs_running ON workflow_runs (id) WHERE state IN ('running', 'compensating');
+
+CREATE TABLE IF NOT EXISTS workflow_steps (
+    run_id      VARCHAR(64) NOT NULL REFERENCES workflow_runs(id) ON DELETE CASCADE,
+    step_id     VARCHAR(255) NOT NULL,
+    state       VARCHAR(16) NOT NULL,
+    task_id     VARCHAR(64) NOT NULL DEFAULT '',
+    output      JSONB,
+    error       TEXT NOT NULL DEFAULT '',
+    started_at  TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    compensation_task_id VARCHAR(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (run_id, step_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workflow_steps_task ON workflow_steps (task_id) WHERE task_id <> '';
+CREATE INDEX IF NOT EXISTS idx_workflow_steps_compensation ON workflow_steps (compensation_task_id)
+    WHERE compensation_task_id <> '';
+*/
@@ -0,0 +1,137 @@
+// handler.go - Prompt Store HTTP API
+package prompts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type caller struct {
+	tenantID string
+	actor    string
+}
+
+type callerKey struct{}
+
+// WithCaller returns ctx carrying the authenticated caller of a request:
+// the tenant whose prompts it reaches and the actor its changes are
+// recorded under. Handler serves only requests that carry one.
+func WithCaller(ctx context.Context, tenantID, actor string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller{tenantID: tenantID, actor: actor})
+}
+
+// Handler serves /api/prompts/ for the caller WithCaller put on the
+// request context:
+//
+//	GET  /api/prompts/                      every prompt's head
+//	POST /api/prompts/                      create a version
+//	POST /api/prompts/render                render a prompt
+//	GET  /api/prompts/{name}?version=N      one version, the active one by default
+//	GET  /api/prompts/{name}/versions       version history
+//	GET  /api/prompts/{name}/events         audit trail
+//	POST /api/prompts/{name}/activate       {"version": N}
+//	POST /api/prompts/{name}/experiment     {"variants": [...]}
+//	DELETE /api/prompts/{name}/experiment
+//	POST /api/prompts/{name}/evaluations?version=N
+//
+// Authors, actors and evaluators are always the caller.
+func (s *Store) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := r.Context().Value(callerKey{}).(caller)
+		if !ok || c.tenantID == "" || c.actor == "" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/prompts/"), "/")
+		q := r.URL.Query()
+		ctx := r.Context()
+
+		var (
+			body any
+			err  error
+		)
+		status := http.StatusOK
+		switch {
+		case r.Method == http.MethodGet && name == "":
+			body, err = s.Heads(ctx, c.tenantID)
+		case r.Method == http.MethodPost && name == "":
+			var t Template
+			if !decode(w, r, &t) {
+				return
+			}
+			t.Author = c.actor
+			body, err = s.Create(ctx, c.tenantID, t)
+			status = http.StatusCreated
+		case r.Method == http.MethodPost && name == "render" && action == "":
+			var req RenderRequest
+			if !decode(w, r, &req) {
+				return
+			}
+			body, err = s.Render(ctx, c.tenantID, req)
+		case r.Method == http.MethodGet && action == "":
+			version, _ := strconv.Atoi(q.Get("version"))
+			body, err = s.Get(ctx, c.tenantID, name, version)
+		case r.Method == http.MethodGet && action == "versions":
+			body, err = s.History(ctx, c.tenantID, name)
+		case r.Method == http.MethodGet && action == "events":
+			limit, _ := strconv.Atoi(q.Get("limit"))
+			body, err = s.Events(ctx, c.tenantID, name, limit)
+		case r.Method == http.MethodPost && action == "activate":
+			var req struct {
+				Version int `json:"version"`
+			}
+			if !decode(w, r, &req) {
+				return
+			}
+			body, err = s.Activate(ctx, c.tenantID, name, req.Version, c.actor)
+		case r.Method == http.MethodPost && action == "experiment":
+			var req struct {
+				Variants []Variant `json:"variants"`
+			}
+			if !decode(w, r, &req) {
+				return
+			}
+			body, err = s.StartExperiment(ctx, c.tenantID, name, req.Variants, c.actor)
+		case r.Method == http.MethodDelete && action == "experiment":
+			body, err = s.StopExperiment(ctx, c.tenantID, name, c.actor)
+		case r.Method == http.MethodPost && action == "evaluations":
+			var e Evaluation
+			if !decode(w, r, &e) {
+				return
+			}
+			e.EvaluatedBy = c.actor
+			version, _ := strconv.Atoi(q.Get("version"))
+			body, err = s.AddEvaluation(ctx, c.tenantID, name, version, e)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, ErrInvalidTemplate), errors.Is(err, ErrInvalidVariables):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(v); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,601 @@
+// prompts.go - Versioned Prompt Template Store
+package prompts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ErrNotFound is returned for unknown prompts or versions
+	ErrNotFound = errors.New("prompt not found")
+	// ErrInvalidVariables wraps variable validation failures at render time
+	ErrInvalidVariables = errors.New("invalid prompt variables")
+	// ErrInvalidTemplate is returned for templates that do not parse or
+	// declare bad variables
+	ErrInvalidTemplate = errors.New("invalid prompt template")
+)
+
+var renders = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_prompt_renders_total",
+	Help: "Prompt renders by prompt, version and outcome",
+}, []string{"prompt", "version", "outcome"})
+
+func init() {
+	prometheus.MustRegister(renders)
+}
+
+// Variable is a value a template expects
+type Variable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Default     string `json:"default,omitempty"`
+}
+
+// Evaluation records how a version scored offline
+type Evaluation struct {
+	Dataset     string             `json:"dataset"`
+	Scores      map[string]float64 `json:"scores"`
+	Notes       string             `json:"notes,omitempty"`
+	EvaluatedBy string             `json:"evaluated_by,omitempty"`
+	EvaluatedAt time.Time          `json:"evaluated_at"`
+}
+
+// Template is one version of a prompt
+type Template struct {
+	Name        string       `json:"name"`
+	Version     int          `json:"version"`
+	Body        string       `json:"body"`
+	Variables   []Variable   `json:"variables,omitempty"`
+	Evaluations []Evaluation `json:"evaluations,omitempty"`
+	Author      string       `json:"author"`
+	ChangeNote  string       `json:"change_note,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+func (t Template) parse() (*template.Template, error) {
+	return template.New(t.Name).Option("missingkey=error").Parse(t.Body)
+}
+
+// Variant is a share of renders given to a version during an experiment
+type Variant struct {
+	Version int `json:"version"`
+	Weight  int `json:"weight"`
+}
+
+// Head is where a prompt points: the version agents render, and an
+// optional experiment splitting renders between versions
+type Head struct {
+	Name          string    `json:"name"`
+	ActiveVersion int       `json:"active_version"`
+	Experiment    []Variant `json:"experiment,omitempty"`
+	UpdatedBy     string    `json:"updated_by"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Event is an entry of a prompt's audit trail
+type Event struct {
+	Name      string          `json:"name" db:"name"`
+	Action    string          `json:"action" db:"action"`
+	Version   int             `json:"version" db:"version"`
+	Actor     string          `json:"actor" db:"actor"`
+	Detail    json.RawMessage `json:"detail,omitempty" db:"detail"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+// Rendered is a prompt ready to send, with the version that produced it so
+// outcomes can be attributed
+type Rendered struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+	// Variant is true when an experiment chose the version
+	Variant bool `json:"variant,omitempty"`
+}
+
+// Store keeps prompt templates in Postgres, each tenant's apart from every
+// other's. Every version is immutable; changing what agents render means
+// creating a version or moving the head, both of which land in the audit
+// trail.
+type Store struct {
+	db *sqlx.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: sqlx.NewDb(db, "postgres")}
+}
+
+// Create stores t as the prompt's next version. The first version of a
+// prompt becomes active; later ones wait for Activate.
+func (s *Store) Create(ctx context.Context, tenantID string, t Template) (Template, error) {
+	if t.Name == "" || t.Body == "" || t.Author == "" {
+		return Template{}, fmt.Errorf("%w: name, body and author are required", ErrInvalidTemplate)
+	}
+	if _, err := t.parse(); err != nil {
+		return Template{}, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	seen := make(map[string]bool)
+	for _, v := range t.Variables {
+		if v.Name == "" || seen[v.Name] {
+			return Template{}, fmt.Errorf("%w: variable names must be unique and non-empty", ErrInvalidTemplate)
+		}
+		seen[v.Name] = true
+	}
+	variables, err := json.Marshal(t.Variables)
+	if err != nil {
+		return Template{}, err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Template{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	// the head row serializes version numbering per prompt
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO prompt_heads (tenant_id, name, active_version, updated_by) VALUES ($1, $2, 0, $3)
+		ON CONFLICT (tenant_id, name) DO NOTHING`, tenantID, t.Name, t.Author); err != nil {
+		return Template{}, fmt.Errorf("prompt head insert failed: %w", err)
+	}
+	var active int
+	if err := tx.GetContext(ctx, &active,
+		`SELECT active_version FROM prompt_heads WHERE tenant_id = $1 AND name = $2 FOR UPDATE`,
+		tenantID, t.Name); err != nil {
+		return Template{}, fmt.Errorf("prompt head query failed: %w", err)
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO prompt_templates (tenant_id, name, version, body, variables, author, change_note)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5, $6
+		FROM prompt_templates WHERE tenant_id = $1 AND name = $2
+		RETURNING version, created_at`,
+		tenantID, t.Name, t.Body, variables, t.Author, t.ChangeNote).Scan(&t.Version, &t.CreatedAt)
+	if err != nil {
+		return Template{}, fmt.Errorf("prompt insert failed: %w", err)
+	}
+	if active == 0 {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE prompt_heads SET active_version = $3, updated_by = $4, updated_at = NOW()
+			WHERE tenant_id = $1 AND name = $2`, tenantID, t.Name, t.Version, t.Author); err != nil {
+			return Template{}, fmt.Errorf("prompt activation failed: %w", err)
+		}
+	}
+	if err := record(ctx, tx, tenantID, t.Name, "create", t.Version, t.Author, map[string]string{"note": t.ChangeNote}); err != nil {
+		return Template{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Template{}, fmt.Errorf("commit failed: %w", err)
+	}
+	slog.Info("prompt version created", "tenant_id", tenantID, "prompt", t.Name, "version", t.Version, "author", t.Author)
+	return t, nil
+}
+
+type templateRow struct {
+	Name        string    `db:"name"`
+	Version     int       `db:"version"`
+	Body        string    `db:"body"`
+	Variables   []byte    `db:"variables"`
+	Evaluations []byte    `db:"evaluations"`
+	Author      string    `db:"author"`
+	ChangeNote  string    `db:"change_note"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+func (r templateRow) template() (Template, error) {
+	t := Template{
+		Name: r.Name, Version: r.Version, Body: r.Body,
+		Author: r.Author, ChangeNote: r.ChangeNote, CreatedAt: r.CreatedAt,
+	}
+	if err := json.Unmarshal(r.Variables, &t.Variables); err != nil {
+		return Template{}, fmt.Errorf("corrupt prompt %s v%d: %w", r.Name, r.Version, err)
+	}
+	if err := json.Unmarshal(r.Evaluations, &t.Evaluations); err != nil {
+		return Template{}, fmt.Errorf("corrupt prompt %s v%d: %w", r.Name, r.Version, err)
+	}
+	return t, nil
+}
+
+const templateColumns = `name, version, body, variables, evaluations, author, change_note, created_at`
+
+// Get returns a prompt version, the active one when version is 0
+func (s *Store) Get(ctx context.Context, tenantID, name string, version int) (Template, error) {
+	var row templateRow
+	err := s.db.GetContext(ctx, &row, `
+		SELECT `+templateColumns+` FROM prompt_templates
+		WHERE tenant_id = $1 AND name = $2 AND version = CASE WHEN $3 = 0
+		    THEN (SELECT active_version FROM prompt_heads WHERE tenant_id = $1 AND name = $2) ELSE $3 END`,
+		tenantID, name, version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Template{}, fmt.Errorf("%w: %s v%d", ErrNotFound, name, version)
+	}
+	if err != nil {
+		return Template{}, fmt.Errorf("prompt query failed: %w", err)
+	}
+	return row.template()
+}
+
+// History returns every version of a prompt, newest first
+func (s *Store) History(ctx context.Context, tenantID, name string) ([]Template, error) {
+	var rows []templateRow
+	if err := s.db.SelectContext(ctx, &rows, `
+		SELECT `+templateColumns+` FROM prompt_templates
+		WHERE tenant_id = $1 AND name = $2 ORDER BY version DESC`, tenantID, name); err != nil {
+		return nil, fmt.Errorf("prompt history query failed: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	templates := make([]Template, 0, len(rows))
+	for _, row := range rows {
+		t, err := row.template()
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+type headRow struct {
+	Name          string    `db:"name"`
+	ActiveVersion int       `db:"active_version"`
+	Experiment    []byte    `db:"experiment"`
+	UpdatedBy     string    `db:"updated_by"`
+	UpdatedAt     time.Time `db:"updated_at"`
+}
+
+func (r headRow) head() (Head, error) {
+	h := Head{Name: r.Name, ActiveVersion: r.ActiveVersion, UpdatedBy: r.UpdatedBy, UpdatedAt: r.UpdatedAt}
+	if len(r.Experiment) > 0 {
+		if err := json.Unmarshal(r.Experiment, &h.Experiment); err != nil {
+			return Head{}, fmt.Errorf("corrupt experiment for %s: %w", r.Name, err)
+		}
+	}
+	return h, nil
+}
+
+// Heads lists a tenant's prompts with their active versions and experiments
+func (s *Store) Heads(ctx context.Context, tenantID string) ([]Head, error) {
+	var rows []headRow
+	if err := s.db.SelectContext(ctx, &rows, `
+		SELECT name, active_version, experiment, updated_by, updated_at
+		FROM prompt_heads WHERE tenant_id = $1 ORDER BY name`, tenantID); err != nil {
+		return nil, fmt.Errorf("prompt listing failed: %w", err)
+	}
+	heads := make([]Head, 0, len(rows))
+	for _, row := range rows {
+		h, err := row.head()
+		if err != nil {
+			return nil, err
+		}
+		heads = append(heads, h)
+	}
+	return heads, nil
+}
+
+// Head returns where a prompt points
+func (s *Store) Head(ctx context.Context, tenantID, name string) (Head, error) {
+	var row headRow
+	err := s.db.GetContext(ctx, &row, `
+		SELECT name, active_version, experiment, updated_by, updated_at
+		FROM prompt_heads WHERE tenant_id = $1 AND name = $2`, tenantID, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Head{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return Head{}, fmt.Errorf("prompt head query failed: %w", err)
+	}
+	return row.head()
+}
+
+// Activate points the prompt at version. Reverting is activating an
+// earlier version.
+func (s *Store) Activate(ctx context.Context, tenantID, name string, version int, actor string) (Head, error) {
+	return s.moveHead(ctx, tenantID, name, "activate", actor, version, nil, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE prompt_heads SET active_version = $3, updated_by = $4, updated_at = NOW()
+			WHERE tenant_id = $1 AND name = $2`, tenantID, name, version, actor)
+		return err
+	})
+}
+
+// StartExperiment splits renders between versions by weight. Subjects
+// keep their variant for the experiment's lifetime.
+func (s *Store) StartExperiment(ctx context.Context, tenantID, name string, variants []Variant, actor string) (Head, error) {
+	if len(variants) < 2 {
+		return Head{}, fmt.Errorf("%w: an experiment needs at least two variants", ErrInvalidTemplate)
+	}
+	for _, v := range variants {
+		if v.Weight <= 0 {
+			return Head{}, fmt.Errorf("%w: variant weights must be positive", ErrInvalidTemplate)
+		}
+	}
+	raw, err := json.Marshal(variants)
+	if err != nil {
+		return Head{}, err
+	}
+	return s.moveHead(ctx, tenantID, name, "experiment", actor, 0, variants, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE prompt_heads SET experiment = $3, updated_by = $4, updated_at = NOW()
+			WHERE tenant_id = $1 AND name = $2`, tenantID, name, raw, actor)
+		return err
+	}, versionsOf(variants)...)
+}
+
+// StopExperiment returns every render to the active version
+func (s *Store) StopExperiment(ctx context.Context, tenantID, name, actor string) (Head, error) {
+	return s.moveHead(ctx, tenantID, name, "stop_experiment", actor, 0, nil, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE prompt_heads SET experiment = NULL, updated_by = $3, updated_at = NOW()
+			WHERE tenant_id = $1 AND name = $2`, tenantID, name, actor)
+		return err
+	})
+}
+
+func versionsOf(variants []Variant) []int {
+	versions := make([]int, len(variants))
+	for i, v := range variants {
+		versions[i] = v.Version
+	}
+	return versions
+}
+
+// moveHead applies an update to a prompt's head after checking the
+// versions it references exist, and records it
+func (s *Store) moveHead(ctx context.Context, tenantID, name, action, actor string, version int, detail any, update func(*sqlx.Tx) error, refs ...int) (Head, error) {
+	if actor == "" {
+		return Head{}, fmt.Errorf("an actor is required to change %s", name)
+	}
+	if version > 0 {
+		refs = append(refs, version)
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Head{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, v := range refs {
+		var exists bool
+		if err := tx.GetContext(ctx, &exists, `
+			SELECT EXISTS (SELECT 1 FROM prompt_templates
+			               WHERE tenant_id = $1 AND name = $2 AND version = $3)`,
+			tenantID, name, v); err != nil {
+			return Head{}, fmt.Errorf("prompt query failed: %w", err)
+		}
+		if !exists {
+			return Head{}, fmt.Errorf("%w: %s v%d", ErrNotFound, name, v)
+		}
+	}
+	if err := update(tx); err != nil {
+		return Head{}, fmt.Errorf("prompt head update failed: %w", err)
+	}
+	if err := record(ctx, tx, tenantID, name, action, version, actor, detail); err != nil {
+		return Head{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Head{}, fmt.Errorf("commit failed: %w", err)
+	}
+	slog.Info("prompt head changed", "tenant_id", tenantID, "prompt", name, "action", action,
+		"version", version, "actor", actor)
+	return s.Head(ctx, tenantID, name)
+}
+
+// AddEvaluation attaches an evaluation result to a version
+func (s *Store) AddEvaluation(ctx context.Context, tenantID, name string, version int, e Evaluation) (Template, error) {
+	if e.EvaluatedAt.IsZero() {
+		e.EvaluatedAt = time.Now().UTC()
+	}
+	raw, err := json.Marshal([]Evaluation{e})
+	if err != nil {
+		return Template{}, err
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Template{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE prompt_templates SET evaluations = evaluations || $4::JSONB
+		WHERE tenant_id = $1 AND name = $2 AND version = $3`, tenantID, name, version, raw)
+	if err != nil {
+		return Template{}, fmt.Errorf("evaluation update failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Template{}, fmt.Errorf("%w: %s v%d", ErrNotFound, name, version)
+	}
+	if err := record(ctx, tx, tenantID, name, "evaluate", version, e.EvaluatedBy, e); err != nil {
+		return Template{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Template{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return s.Get(ctx, tenantID, name, version)
+}
+
+// Events returns a prompt's audit trail, newest first
+func (s *Store) Events(ctx context.Context, tenantID, name string, limit int) ([]Event, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	events := []Event{}
+	if err := s.db.SelectContext(ctx, &events, `
+		SELECT name, action, version, actor, detail, created_at FROM prompt_events
+		WHERE tenant_id = $1 AND name = $2 ORDER BY id DESC LIMIT $3`, tenantID, name, limit); err != nil {
+		return nil, fmt.Errorf("prompt events query failed: %w", err)
+	}
+	return events, nil
+}
+
+func record(ctx context.Context, tx *sqlx.Tx, tenantID, name, action string, version int, actor string, detail any) error {
+	raw, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO prompt_events (tenant_id, name, action, version, actor, detail)
+		VALUES ($1, $2, $3, $4, $5, $6)`, tenantID, name, action, version, actor, raw); err != nil {
+		return fmt.Errorf("prompt event insert failed: %w", err)
+	}
+	return nil
+}
+
+// RenderRequest asks for a prompt rendered with vars
+type RenderRequest struct {
+	Name string            `json:"name"`
+	Vars map[string]string `json:"vars,omitempty"`
+	// Version pins a version; zero uses the head
+	Version int `json:"version,omitempty"`
+	// Subject keeps a caller, e.g. a session or agent ID, on one
+	// experiment variant
+	Subject string `json:"subject,omitempty"`
+}
+
+// Render resolves the version to use, through the head's experiment when
+// one runs, and executes it with the request's variables
+func (s *Store) Render(ctx context.Context, tenantID string, req RenderRequest) (Rendered, error) {
+	version, variant := req.Version, false
+	if version == 0 {
+		head, err := s.Head(ctx, tenantID, req.Name)
+		if err != nil {
+			return Rendered{}, err
+		}
+		version = head.ActiveVersion
+		if len(head.Experiment) > 0 {
+			version, variant = pickVariant(head, req.Subject), true
+		}
+	}
+	t, err := s.Get(ctx, tenantID, req.Name, version)
+	if err != nil {
+		return Rendered{}, err
+	}
+	text, err := t.Render(req.Vars)
+	label := fmt.Sprint(t.Version)
+	if err != nil {
+		renders.WithLabelValues(t.Name, label, "error").Inc()
+		return Rendered{}, err
+	}
+	renders.WithLabelValues(t.Name, label, "ok").Inc()
+	return Rendered{Name: t.Name, Version: t.Version, Text: text, Variant: variant}, nil
+}
+
+// RenderPrompt renders a tenant's prompt through its head for subject,
+// returning the text and the version used
+func (s *Store) RenderPrompt(ctx context.Context, tenantID, name string, vars map[string]string, subject string) (string, int, error) {
+	r, err := s.Render(ctx, tenantID, RenderRequest{Name: name, Vars: vars, Subject: subject})
+	if err != nil {
+		return "", 0, err
+	}
+	return r.Text, r.Version, nil
+}
+
+// pickVariant maps a subject onto the experiment's weights
+func pickVariant(h Head, subject string) int {
+	total := 0
+	for _, v := range h.Experiment {
+		total += v.Weight
+	}
+	f := fnv.New32a()
+	f.Write([]byte(h.Name + "\x00" + subject))
+	point := int(f.Sum32() % uint32(total))
+	for _, v := range h.Experiment {
+		if point < v.Weight {
+			return v.Version
+		}
+		point -= v.Weight
+	}
+	return h.ActiveVersion
+}
+
+// Render executes the template, filling defaults and rejecting unknown or
+// missing variables
+func (t Template) Render(vars map[string]string) (string, error) {
+	values := make(map[string]string, len(t.Variables))
+	known := make(map[string]bool, len(t.Variables))
+	var missing []string
+	for _, v := range t.Variables {
+		known[v.Name] = true
+		val, ok := vars[v.Name]
+		switch {
+		case ok:
+			values[v.Name] = val
+		case v.Required:
+			missing = append(missing, v.Name)
+		default:
+			values[v.Name] = v.Default
+		}
+	}
+	var unknown []string
+	for name := range vars {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(missing) > 0 || len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", fmt.Errorf("%w: missing %v, unknown %v", ErrInvalidVariables, missing, unknown)
+	}
+
+	tmpl, err := t.parse()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, values); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidVariables, err)
+	}
+	return out.String(), nil
+}
+
+/*
+CREATE TABLE IF NOT EXISTS prompt_heads (
+    tenant_id      VARCHAR(255) NOT NULL,
+    name           VARCHAR(255) NOT NULL,
+    active_version INT NOT NULL,
+    experiment     JSONB,
+    updated_by     VARCHAR(255) NOT NULL,
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    tenant_id   VARCHAR(255) NOT NULL,
+    name        VARCHAR(255) NOT NULL,
+    version     INT NOT NULL,
+    body        TEXT NOT NULL,
+    variables   JSONB NOT NULL DEFAULT '[]',
+    evaluations JSONB NOT NULL DEFAULT '[]',
+    author      VARCHAR(255) NOT NULL,
+    change_note TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, name, version),
+    FOREIGN KEY (tenant_id, name) REFERENCES prompt_heads (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS prompt_events (
+    id         BIGSERIAL PRIMARY KEY,
+    tenant_id  VARCHAR(255) NOT NULL,
+    name       VARCHAR(255) NOT NULL,
+    action     VARCHAR(32) NOT NULL,
+    version    INT NOT NULL DEFAULT 0,
+    actor      VARCHAR(255) NOT NULL,
+    detail     JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_prompt_events_name ON prompt_events (tenant_id, name, id DESC);
+*/
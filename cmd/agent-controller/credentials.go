@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"cirium.ai/core/agent"
+)
+
+const credentialsUsage = `usage: agent-controller credentials <command> [flags]
+
+commands:
+  issue   create an API bearer token and print its id and token
+  revoke  revoke the credential named by -id
+
+Permissions are a comma-separated list of admin, agents, erasure and
+prompts. A credential without -tenant is a platform credential that names
+the tenant on each request.`
+
+// runCredentials serves "agent-controller credentials ..."
+func runCredentials(ctx context.Context, agents *agent.Manager, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(credentialsUsage)
+	}
+	cmd := args[0]
+	fs := flag.NewFlagSet("credentials "+cmd, flag.ContinueOnError)
+	subject := fs.String("subject", "", "user or service the credential identifies")
+	tenant := fs.String("tenant", "", "tenant the credential is bound to")
+	perms := fs.String("permissions", "", "comma-separated permissions")
+	ttl := fs.Duration("ttl", 0, "lifetime of the credential; zero never expires")
+	id := fs.String("id", "", "credential to revoke")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "issue":
+		p := agent.Principal{Subject: *subject, TenantID: *tenant}
+		for _, perm := range strings.Split(*perms, ",") {
+			if perm = strings.TrimSpace(perm); perm != "" {
+				p.Permissions = append(p.Permissions, agent.Permission(perm))
+			}
+		}
+		credID, token, err := agents.IssueCredential(ctx, p, *ttl)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "id: %s\ntoken: %s\n", credID, token)
+		return err
+
+	case "revoke":
+		if *id == "" {
+			return errors.New("revoke requires -id")
+		}
+		return agents.RevokeCredential(ctx, *id)
+
+	default:
+		return fmt.Errorf("unknown credentials command %q\n%s", cmd, credentialsUsage)
+	}
+}
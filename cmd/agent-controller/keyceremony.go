@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cirium.ai/core/crypto/keyceremony"
+)
+
+const keyCeremonyUsage = `usage: agent-controller key-ceremony <command> [flags]
+
+commands:
+  init    generate a new root key and print its shares
+  import  escrow the existing root key read from -key-file and print its shares
+  rotate  re-split the root key; reads a quorum of current shares from stdin
+  export  print the root key; reads a quorum of shares from stdin
+
+Shares are base64, one per line. The escrow file holds only the public
+share-set description and is written by init, import and rotate.`
+
+// runKeyCeremony serves "agent-controller key-ceremony ..."
+func runKeyCeremony(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(keyCeremonyUsage)
+	}
+	cmd := args[0]
+	fs := flag.NewFlagSet("key-ceremony "+cmd, flag.ContinueOnError)
+	escrowPath := fs.String("escrow", "/var/lib/nuzon/root-key-escrow.json", "escrow description file")
+	shares := fs.Int("shares", 5, "number of shares to issue")
+	threshold := fs.Int("threshold", 3, "shares needed to reconstruct the root key")
+	keyFile := fs.String("key-file", "", "existing root key, raw or base64 (import only)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "init":
+		escrow, issued, err := keyceremony.Initialize(*shares, *threshold)
+		if err != nil {
+			return err
+		}
+		return finishCeremony(*escrowPath, escrow, issued, stdout)
+
+	case "import":
+		if *keyFile == "" {
+			return errors.New("import requires -key-file")
+		}
+		key, err := readRootKey(*keyFile)
+		if err != nil {
+			return err
+		}
+		defer clear(key)
+		escrow, issued, err := keyceremony.ImportRootKey(key, *shares, *threshold)
+		if err != nil {
+			return err
+		}
+		return finishCeremony(*escrowPath, escrow, issued, stdout)
+
+	case "rotate":
+		escrow, err := readEscrow(*escrowPath)
+		if err != nil {
+			return err
+		}
+		current, err := readShares(stdin)
+		if err != nil {
+			return err
+		}
+		defer wipeShares(current)
+		next, issued, err := keyceremony.Rotate(escrow, current, *shares, *threshold)
+		if err != nil {
+			return err
+		}
+		return finishCeremony(*escrowPath, next, issued, stdout)
+
+	case "export":
+		escrow, err := readEscrow(*escrowPath)
+		if err != nil {
+			return err
+		}
+		current, err := readShares(stdin)
+		if err != nil {
+			return err
+		}
+		defer wipeShares(current)
+		key, err := keyceremony.Export(escrow, current)
+		if err != nil {
+			return err
+		}
+		defer clear(key)
+		_, err = fmt.Fprintln(stdout, base64.StdEncoding.EncodeToString(key))
+		return err
+
+	default:
+		return fmt.Errorf("unknown key-ceremony command %q\n%s", cmd, keyCeremonyUsage)
+	}
+}
+
+// finishCeremony persists the escrow before handing out shares, so shares
+// are never issued for a share set the controller cannot verify
+func finishCeremony(path string, escrow keyceremony.Escrow, issued [][]byte, stdout io.Writer) error {
+	defer wipeShares(issued)
+	raw, err := json.MarshalIndent(escrow, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		return fmt.Errorf("escrow write failed: %w", err)
+	}
+	for _, s := range issued {
+		if _, err := fmt.Fprintln(stdout, base64.StdEncoding.EncodeToString(s)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readEscrow(path string) (keyceremony.Escrow, error) {
+	var escrow keyceremony.Escrow
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return escrow, fmt.Errorf("escrow read failed: %w", err)
+	}
+	if err := json.Unmarshal(raw, &escrow); err != nil {
+		return escrow, fmt.Errorf("escrow parse failed: %w", err)
+	}
+	return escrow, nil
+}
+
+// readRootKey accepts the key as 32 raw bytes or base64 text
+func readRootKey(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("root key read failed: %w", err)
+	}
+	if len(raw) == 32 {
+		return raw, nil
+	}
+	defer clear(raw)
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("root key is neither 32 raw bytes nor base64: %w", err)
+	}
+	return key, nil
+}
+
+func readShares(r io.Reader) ([][]byte, error) {
+	var shares [][]byte
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		s, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			wipeShares(shares)
+			return nil, fmt.Errorf("share %d is not base64: %w", len(shares)+1, err)
+		}
+		shares = append(shares, s)
+	}
+	if err := sc.Err(); err != nil {
+		wipeShares(shares)
+		return nil, err
+	}
+	return shares, nil
+}
+
+func wipeShares(shares [][]byte) {
+	for _, s := range shares {
+		clear(s)
+	}
+}
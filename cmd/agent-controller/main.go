@@ -6,26 +6,39 @@ import (
 	"database/sql"
 	"embed"
 	_ "embed"
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"cirium.ai/core/agent"
+	auditor "cirium.ai/core/audit"
 	"cirium.ai/core/auth"
 	"cirium.ai/core/config"
+	qcrypto "cirium.ai/core/crypto"
+	"cirium.ai/core/crypto/keyceremony"
 	"cirium.ai/core/crypto/quantum"
+	"cirium.ai/core/crypto/verify"
 	"cirium.ai/core/db"
+	"cirium.ai/core/messaging"
+	"cirium.ai/core/prompts"
 	"cirium.ai/core/telemetry"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -46,12 +59,47 @@ func main() {
 	}))
 	slog.SetDefault(logger)
 
+	// Enter FIPS 140-3 mode before any key material is handled
+	if err := qcrypto.EnableFIPSFromEnv(); err != nil {
+		slog.Error("FIPS mode initialization failed", "error", err)
+		os.Exit(1)
+	}
+
+	// "agent-controller crypto-verify" runs the known-answer tests and exits
+	if len(os.Args) > 1 && os.Args[1] == "crypto-verify" {
+		report := verify.Run(ctx)
+		json.NewEncoder(os.Stdout).Encode(report)
+		if !report.Passed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "agent-controller key-ceremony ..." splits, rotates or exports the
+	// root key under M-of-N escrow and exits
+	if len(os.Args) > 1 && os.Args[1] == "key-ceremony" {
+		if err := runKeyCeremony(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			slog.Error("key ceremony failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Strict mode refuses to boot on hosts whose primitives misbehave
+	if os.Getenv("NUZON_CRYPTO_STRICT") == "1" {
+		if err := verify.Strict(ctx); err != nil {
+			slog.Error("crypto self-tests failed", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	// Load quantum-safe root certificates
 	qtlsConfig, err := quantum.NewServerConfig()
 	if err != nil {
 		slog.Error("quantum TLS initialization failed", "error", err)
 		os.Exit(1)
 	}
+	qtlsConfig = qcrypto.ApplyFIPSTLS(qtlsConfig)
 
 	// Load multi-environment configuration
 	cfg, err := config.Load(ctx, configFS)
@@ -60,6 +108,45 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Enforce the environment's crypto policy on the server TLS configuration
+	var policy *qcrypto.CryptoPolicy
+	if policyPath := os.Getenv("CRYPTO_POLICY_PATH"); policyPath != "" {
+		policies, err := qcrypto.LoadPolicySet(policyPath)
+		if err != nil {
+			slog.Error("crypto policy loading failed", "error", err)
+			os.Exit(1)
+		}
+		if policy, err = policies.For(os.Getenv("DEPLOY_ENV")); err != nil {
+			slog.Error("crypto policy selection failed", "error", err)
+			os.Exit(1)
+		}
+		if qtlsConfig, err = policy.ApplyTLS(qtlsConfig); err != nil {
+			slog.Error("server TLS configuration violates crypto policy", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Issue and renew the server certificate through ACME when configured
+	var certManager *qcrypto.CertLifecycleManager
+	if acmeDir := os.Getenv("ACME_DIRECTORY_URL"); acmeDir != "" {
+		certManager, err = qcrypto.NewCertLifecycleManager(qcrypto.ACMEConfig{
+			DirectoryURL: acmeDir,
+			Email:        os.Getenv("ACME_EMAIL"),
+			Hosts:        splitList(os.Getenv("ACME_HOSTS")),
+			CacheDir:     "/var/lib/nuzon/acme",
+		})
+		if err != nil {
+			slog.Error("ACME initialization failed", "error", err)
+			os.Exit(1)
+		}
+		certManager.Bind(qtlsConfig)
+		go func() {
+			if err := certManager.Run(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("certificate lifecycle manager stopped", "error", err)
+			}
+		}()
+	}
+
 	// Initialize observability
 	shutdownTelemetry, err := telemetry.Init(ctx, cfg.Telemetry)
 	if err != nil {
@@ -85,18 +172,105 @@ func main() {
 	// Initialize core subsystems
 	authService := auth.NewService(sqlDB, cfg.Auth)
 	agentManager := agent.NewManager(sqlDB, cfg.Agents)
+	if policy != nil {
+		agentManager.SetConnectionPolicy(policy)
+	}
+	promptStore := prompts.NewStore(sqlDB)
+	agentManager.SetPrompts(promptStore)
+
+	// "agent-controller credentials ..." issues or revokes API credentials
+	// and exits
+	if len(os.Args) > 1 && os.Args[1] == "credentials" {
+		if err := runCredentials(ctx, agentManager, os.Args[2:], os.Stdout); err != nil {
+			slog.Error("credential command failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Wake idle task workers across replicas over NATS when configured. The
+	// ACME certificate is presented for mTLS through the manager, so
+	// renewals apply on the next reconnect.
+	var broker *messaging.EnterpriseNATS
+	if urls := splitList(os.Getenv("NATS_URLS")); len(urls) > 0 {
+		natsCfg := messaging.Config{
+			URLs:         urls,
+			TLSConfig:    qcrypto.ApplyFIPSTLS(&tls.Config{MinVersion: tls.VersionTLS12}),
+			MaxReconnect: -1,
+		}
+		if certManager != nil {
+			natsCfg.AuthMethod = "tls"
+			natsCfg.GetClientCertificate = certManager.GetClientCertificate
+		}
+		zl, err := zap.NewProduction()
+		if err != nil {
+			slog.Error("messaging logger initialization failed", "error", err)
+			os.Exit(1)
+		}
+		if broker, err = messaging.NewEnterpriseNATS(natsCfg, zl); err != nil {
+			slog.Error("NATS connection failed", "error", err)
+			os.Exit(1)
+		}
+		agentManager.SetNotifier(broker)
+	}
+
+	// The operator authenticates with the token of its controller-token
+	// secret, as a platform principal naming each resource's namespace as
+	// its tenant
+	if path := os.Getenv("OPERATOR_TOKEN_FILE"); path != "" {
+		token, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("operator token read failed", "error", err)
+			os.Exit(1)
+		}
+		operator := agent.Principal{Subject: "operator", Permissions: []agent.Permission{agent.PermAgents}}
+		if err := agentManager.AddServiceCredential(strings.TrimSpace(string(token)), operator); err != nil {
+			slog.Error("operator credential rejected", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// With an escrowed root key the controller starts sealed, and reports
+	// unready, until a quorum of custodians submits shares to /api/unseal
+	var unsealer *keyceremony.Unsealer
+	if path := os.Getenv("ROOT_KEY_ESCROW_PATH"); path != "" {
+		escrow, err := readEscrow(path)
+		if err != nil {
+			slog.Error("root key escrow unavailable", "error", err)
+			os.Exit(1)
+		}
+		unsealer = keyceremony.NewUnsealer(escrow)
+	}
+
+	// The audit store keeps signed proofs of rotation, downloadable from
+	// /admin/attestations/
+	var audit *auditor.EnterpriseAuditor
+	if path := os.Getenv("AUDIT_DB_PATH"); path != "" {
+		if audit, err = auditor.NewEnterpriseAuditor(auditor.AuditConfig{
+			DatabasePath:  path,
+			MaxQueueSize:  10000,
+			Workers:       4,
+			RetentionDays: 365,
+			EncryptionKey: os.Getenv("AUDIT_CRYPTO_KEY"),
+		}); err != nil {
+			slog.Error("audit system initialization failed", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	// Create gRPC server with quantum-safe TLS
 	grpcServer := grpc.NewServer(
 		grpc.Creds(credentials.NewTLS(qtlsConfig)),
 		grpc.ChainUnaryInterceptor(
 			auth.GRPCInterceptor(authService),
+			policyInterceptor(policy),
 			otelgrpc.UnaryServerInterceptor(),
 		),
 	)
 
 	// Register gRPC services
 	agent.RegisterAgentServiceServer(grpcServer, agentManager)
+	agent.NewLifecycleServer(agentManager).Register(grpcServer)
 	auth.RegisterAuthServiceServer(grpcServer, authService)
 
 	// Create HTTP gateway mux
@@ -114,7 +288,7 @@ func main() {
 	// Configure HTTP server
 	httpSrv := &http.Server{
 		Addr:         cfg.Server.HTTPAddr,
-		Handler:      registerHTTPRoutes(httpMux, sqlDB, cfg),
+		Handler:      registerHTTPRoutes(httpMux, sqlDB, cfg, agentManager, promptStore, unsealer, audit),
 		TLSConfig:    qtlsConfig,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 30 * time.Second,
@@ -125,12 +299,68 @@ func main() {
 	var wg sync.WaitGroup
 	startServers(ctx, &wg, cfg.Server.GRPCAddr, grpcServer, httpSrv)
 
+	// Advance workflows whose steps finished on any replica
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		agentManager.RunWorkflows(ctx)
+	}()
+
+	// Execute the tool calls of workflow steps and compensations
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		agentManager.RunWorker(ctx, []string{agent.ToolTaskKind}, 8, agentManager.ToolTaskHandler())
+	}()
+
+	// Judge blueprint rollouts and promote or roll them back
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		agentManager.RunRollouts(ctx)
+	}()
+
+	// Expire idle sessions
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		agentManager.RunSessions(ctx)
+	}()
+
+	// Degrade agents whose heartbeats stop
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := agentManager.RunLiveness(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("agent liveness tracking disabled", "error", err)
+		}
+	}()
+
+	// Report per-agent task backlogs for the operator's autoscalers
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		agentManager.RunBacklogMetrics(ctx)
+	}()
+
+	// Rotate tenant memory keys when a schedule is configured
+	if err := startKeyRotation(ctx, &wg, sqlDB, policy); err != nil {
+		slog.Error("memory key rotation setup failed", "error", err)
+		os.Exit(1)
+	}
+
 	// Wait for termination signals
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	<-sigCh
 
-	slog.Info("shutdown signal received, draining connections")
+	// Finish or hand off running agent tasks before stopping the workers
+	slog.Info("shutdown signal received, draining agent tasks")
+	if err := agentManager.Drain(context.Background()); err != nil {
+		slog.Warn("agent task drain incomplete", "error", err)
+	}
+
+	slog.Info("draining connections")
 	cancel()
 	
 	if err := httpSrv.Shutdown(ctx); err != nil {
@@ -138,6 +368,24 @@ func main() {
 	}
 	grpcServer.GracefulStop()
 	wg.Wait()
+	if broker != nil {
+		broker.Shutdown()
+	}
+	if audit != nil {
+		audit.Shutdown()
+	}
+}
+
+// splitList splits a comma-separated setting, dropping blank entries such
+// as the one a trailing comma leaves
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
 }
 
 func startServers(ctx context.Context, wg *sync.WaitGroup, grpcAddr string, grpcServer *grpc.Server, httpSrv *http.Server) {
@@ -167,15 +415,54 @@ func startServers(ctx context.Context, wg *sync.WaitGroup, grpcAddr string, grpc
 	}()
 }
 
-func registerHTTPRoutes(mux *runtime.ServeMux, db *sql.DB, cfg *config.Config) http.Handler {
+// policyInterceptor refuses gRPC calls whose TLS session the crypto policy
+// rejects, as Manager.Authenticated does for the HTTP API
+func policyInterceptor(policy *qcrypto.CryptoPolicy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if policy == nil {
+			return handler(ctx, req)
+		}
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.PermissionDenied, "crypto policy requires TLS")
+		}
+		tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok {
+			return nil, status.Error(codes.PermissionDenied, "crypto policy requires TLS")
+		}
+		if err := policy.VerifyConnection(tlsInfo.State); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
+
+func registerHTTPRoutes(mux *runtime.ServeMux, db *sql.DB, cfg *config.Config, agents *agent.Manager,
+	promptStore *prompts.Store, unsealer *keyceremony.Unsealer, audit *auditor.EnterpriseAuditor) http.Handler {
 	rootMux := http.NewServeMux()
 	
 	// Register monitoring endpoints
 	rootMux.Handle("/metrics", telemetry.Handler())
-	rootMux.Handle("/health", healthCheckHandler(db))
+	rootMux.Handle("/health", healthCheckHandler(db, unsealer))
 
 	// API routes
 	rootMux.Handle("/api/", http.StripPrefix("/api", mux))
+	rootMux.Handle("/api/workflows/", agents.Authenticated(agent.PermAgents, agents.WorkflowHandler()))
+	rootMux.Handle("/api/usage/", agents.Authenticated(agent.PermAgents, agents.UsageHandler()))
+	rootMux.Handle("/api/blueprints/", agents.Authenticated(agent.PermAdmin, agents.BlueprintHandler()))
+	rootMux.Handle("/api/agents/", agents.Authenticated(agent.PermAgents, agents.AgentHandler()))
+	rootMux.Handle("/api/tasks/", agents.Authenticated(agent.PermAgents, agents.TasksHandler()))
+	rootMux.Handle("/api/rollouts/", agents.Authenticated(agent.PermAdmin, agents.RolloutHandler()))
+	rootMux.Handle("/api/sessions/", agents.Authenticated(agent.PermAgents, agents.SessionHandler()))
+	rootMux.Handle("/api/erasures/", agents.Authenticated(agent.PermErasure, agents.ErasureHandler()))
+	rootMux.Handle("/api/dry-runs/", agents.Authenticated(agent.PermAgents, agents.DryRunHandler()))
+	rootMux.Handle("/api/prompts/", agents.Authenticated(agent.PermPrompts, promptCaller(promptStore.Handler())))
+	if unsealer != nil {
+		rootMux.Handle("/api/unseal", agents.Authenticated(agent.PermAdmin, keyceremony.UnsealHandler(unsealer)))
+	}
+	if audit != nil {
+		rootMux.Handle("/admin/attestations/", agents.Authenticated(agent.PermAdmin, audit.AttestationHandler()))
+	}
 
 	// Apply middleware chain
 	return auth.MiddlewareChain(rootMux,
@@ -185,12 +472,43 @@ func registerHTTPRoutes(mux *runtime.ServeMux, db *sql.DB, cfg *config.Config) h
 	)
 }
 
-func healthCheckHandler(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if err := db.PingContext(r.Context()); err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
+// promptCaller hands the authenticated principal to the prompt store as
+// its caller. A platform principal names the tenant with ?tenant_id=.
+func promptCaller(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := agent.PrincipalFrom(r.Context())
+		tenantID, requested := p.TenantID, r.URL.Query().Get("tenant_id")
+		switch {
+		case tenantID == "" && requested == "":
+			http.Error(w, "tenant_id is required", http.StatusBadRequest)
+			return
+		case tenantID == "":
+			tenantID = requested
+		case requested != "" && requested != tenantID:
+			http.Error(w, fmt.Sprintf("%s may not act for tenant %s", p.Subject, requested), http.StatusForbidden)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		next.ServeHTTP(w, r.WithContext(prompts.WithCaller(r.Context(), tenantID, p.Subject)))
+	})
+}
+
+func healthCheckHandler(db *sql.DB, unsealer *keyceremony.Unsealer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dbOK := db.PingContext(r.Context()) == nil
+		fips := qcrypto.CurrentFIPSStatus()
+		sealed := unsealer != nil && unsealer.Sealed()
+
+		status := http.StatusOK
+		if !dbOK || !fips.Compliant || sealed {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]any{
+			"database": dbOK,
+			"fips":     fips,
+			"sealed":   sealed,
+		})
 	}
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	qcrypto "cirium.ai/core/crypto"
+	"cirium.ai/core/memory"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+)
+
+// startKeyRotation rotates each tenant's memory key on a schedule when
+// MEMORY_KEY_ROTATION_INTERVAL is set. Tenant keys are wrapped by the KMS
+// key MEMORY_KMS_KEY of MEMORY_KMS_PROVIDER ("aws" or "gcp"); when
+// MEMORY_REDIS_ADDRS is set, the working tier there is re-sealed as well.
+func startKeyRotation(ctx context.Context, wg *sync.WaitGroup, sqlDB *sql.DB, policy *qcrypto.CryptoPolicy) error {
+	raw := os.Getenv("MEMORY_KEY_ROTATION_INTERVAL")
+	if raw == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("MEMORY_KEY_ROTATION_INTERVAL must be a positive duration, got %q", raw)
+	}
+	kms, err := memoryKMS(ctx)
+	if err != nil {
+		return err
+	}
+
+	db := sqlx.NewDb(sqlDB, "postgres")
+	keyring := memory.NewTenantKeyring(db, qcrypto.NewEnvelopeEncryptor(kms, nil, qcrypto.EnvelopeConfig{Purpose: "memory"}))
+
+	var working memory.WorkingRewriter
+	if addrs := os.Getenv("MEMORY_REDIS_ADDRS"); addrs != "" {
+		client := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: splitList(addrs)})
+		working = memory.NewRedisWorkingStore(client, 0)
+	}
+	schedule := qcrypto.RotationSchedule{
+		Interval: interval,
+		Stores:   []qcrypto.SealedStore{memory.NewWorkingResealer(db, working)},
+	}
+
+	engine := qcrypto.NewMemoryRotationEngine(sqlDB, policy)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := engine.RunScheduled(ctx, keyring.RotationKeyring(), schedule); err != nil && ctx.Err() == nil {
+			slog.Error("memory key rotation stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// memoryKMS connects to the KMS holding the key that wraps tenant memory keys
+func memoryKMS(ctx context.Context) (qcrypto.KMSProvider, error) {
+	keyID := os.Getenv("MEMORY_KMS_KEY")
+	if keyID == "" {
+		return nil, fmt.Errorf("memory key rotation requires MEMORY_KMS_KEY")
+	}
+	switch provider := os.Getenv("MEMORY_KMS_PROVIDER"); provider {
+	case "aws":
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("aws configuration failed: %w", err)
+		}
+		return qcrypto.NewAWSKMSProvider(cfg, keyID), nil
+	case "gcp":
+		return qcrypto.NewGCPKMSProvider(ctx, keyID)
+	default:
+		return nil, fmt.Errorf("unknown MEMORY_KMS_PROVIDER %q, want aws or gcp", provider)
+	}
+}
@@ -0,0 +1,105 @@
+// core/memory/checkpoints.go
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// checkpointsKept is how many execution checkpoints survive per agent and
+// task; the older ones only guard against a torn latest write
+const checkpointsKept = 3
+
+type checkpointRow struct {
+	Seq    int64  `db:"seq"`
+	Data   []byte `db:"data"`
+	KeyID  string `db:"key_id"`
+	Cipher string `db:"cipher"`
+}
+
+// SaveCheckpoint stores the serialized execution state of an agent's task
+// under seq, sealed like any other record. Callers increase seq with every
+// save; a save older than the task's latest checkpoint is ignored, so a
+// stalled replica cannot roll back one that took the task over.
+func (m *MemoryAdapter) SaveCheckpoint(ctx context.Context, agentID, taskID string, seq int64, state []byte) error {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("checkpoint").Observe(time.Since(start).Seconds())
+	}()
+
+	keyID, cipherName, sealed, err := m.seal(ctx, state)
+	if err != nil {
+		memOpsCounter.WithLabelValues("checkpoint", "error").Inc()
+		return err
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO agent_checkpoints (agent_id, task_id, seq, tenant_id, data, key_id, cipher, created_at)
+		 SELECT $1, $2, $3, $4, $5, $6, $7, NOW()
+		 WHERE NOT EXISTS (
+		     SELECT 1 FROM agent_checkpoints WHERE agent_id = $1 AND task_id = $2 AND seq >= $3)`,
+		agentID, taskID, seq, TenantFromContext(ctx), sealed, keyID, cipherName); err != nil {
+		memOpsCounter.WithLabelValues("checkpoint", "error").Inc()
+		return fmt.Errorf("checkpoint insert failed: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM agent_checkpoints
+		 WHERE agent_id = $1 AND task_id = $2 AND seq < (
+		     SELECT MIN(seq) FROM (
+		         SELECT seq FROM agent_checkpoints WHERE agent_id = $1 AND task_id = $2
+		         ORDER BY seq DESC LIMIT $3) kept)`, agentID, taskID, checkpointsKept); err != nil {
+		memOpsCounter.WithLabelValues("checkpoint", "error").Inc()
+		return fmt.Errorf("checkpoint pruning failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		memOpsCounter.WithLabelValues("checkpoint", "error").Inc()
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	memOpsCounter.WithLabelValues("checkpoint", "success").Inc()
+	return nil
+}
+
+// LatestCheckpoint returns the newest checkpoint of agentID's task, or a
+// zero seq and nil state when it has none
+func (m *MemoryAdapter) LatestCheckpoint(ctx context.Context, agentID, taskID string) (int64, []byte, error) {
+	var row checkpointRow
+	err := m.db.GetContext(ctx, &row,
+		`SELECT seq, data, key_id, cipher FROM agent_checkpoints
+		 WHERE agent_id = $1 AND task_id = $2
+		 ORDER BY seq DESC
+		 LIMIT 1`, agentID, taskID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		memOpsCounter.WithLabelValues("resume", "error").Inc()
+		return 0, nil, fmt.Errorf("checkpoint query failed: %w", err)
+	}
+
+	state, err := m.openRecord(ctx, MemoryRecord{Data: row.Data, KeyID: row.KeyID, Cipher: row.Cipher})
+	if err != nil {
+		memOpsCounter.WithLabelValues("resume", "error").Inc()
+		return 0, nil, err
+	}
+	memOpsCounter.WithLabelValues("resume", "success").Inc()
+	return row.Seq, state, nil
+}
+
+// ClearCheckpoints drops the checkpoints of an agent's task once it has
+// finished, leaving those of the agent's other tasks in place
+func (m *MemoryAdapter) ClearCheckpoints(ctx context.Context, agentID, taskID string) error {
+	if _, err := m.db.ExecContext(ctx,
+		`DELETE FROM agent_checkpoints WHERE agent_id = $1 AND task_id = $2`, agentID, taskID); err != nil {
+		return fmt.Errorf("checkpoint deletion failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,508 @@
+// core/memory/erasure.go
+package memory
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// dataSubjectKey is the metadata key recording whose personal data a memory
+// holds; see WithDataSubject
+const dataSubjectKey = "data_subject"
+
+// dataSubjectsKey lists the data subjects of a record derived from
+// several others' memories, such as a compaction summary
+const dataSubjectsKey = "data_subjects"
+
+type subjectCtxKey struct{}
+
+// WithDataSubject tags memories written with ctx as personal data of
+// subjectID so Erase can find them later
+func WithDataSubject(ctx context.Context, subjectID string) context.Context {
+	return context.WithValue(ctx, subjectCtxKey{}, subjectID)
+}
+
+// tagSubject merges the context's data subject, if any, into metadata
+func tagSubject(ctx context.Context, metadata []byte) ([]byte, error) {
+	subject, ok := ctx.Value(subjectCtxKey{}).(string)
+	if !ok || subject == "" {
+		return metadata, nil
+	}
+	meta := map[string]any{}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &meta); err != nil {
+			return nil, fmt.Errorf("metadata parse failed: %w", err)
+		}
+	}
+	meta[dataSubjectKey] = subject
+	return json.Marshal(meta)
+}
+
+// withoutSubject keeps writes on ctx from being tagged with its data
+// subject, for records that carry their sources' subjects instead
+func withoutSubject(ctx context.Context) context.Context {
+	return context.WithValue(ctx, subjectCtxKey{}, "")
+}
+
+// subjectsOf collects the data subjects tagged on records, sorted
+func subjectsOf(records []MemoryRecord) []string {
+	seen := make(map[string]bool)
+	for _, rec := range records {
+		var meta struct {
+			Subject  string   `json:"data_subject"`
+			Subjects []string `json:"data_subjects"`
+		}
+		if json.Unmarshal(rec.Metadata, &meta) != nil {
+			continue
+		}
+		if meta.Subject != "" {
+			seen[meta.Subject] = true
+		}
+		for _, s := range meta.Subjects {
+			seen[s] = true
+		}
+	}
+	subjects := make([]string, 0, len(seen))
+	for s := range seen {
+		subjects = append(subjects, s)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// tagSubjects marks metadata of a derived record with its sources' data
+// subjects, so erasing any one of them erases the record too
+func tagSubjects(meta map[string]any, subjects []string) {
+	switch len(subjects) {
+	case 0:
+	case 1:
+		meta[dataSubjectKey] = subjects[0]
+	default:
+		meta[dataSubjectsKey] = subjects
+	}
+}
+
+// VectorEraser is implemented by vector indexes that can delete entries
+type VectorEraser interface {
+	Delete(ctx context.Context, agentID string, memoryIDs []string) error
+}
+
+// WorkingEraser is implemented by WorkingStores that can enumerate their
+// agents and remove individual items, letting Erase purge working memory
+type WorkingEraser interface {
+	Agents(ctx context.Context) ([]string, error)
+	Remove(ctx context.Context, agentID string, items [][]byte) (int64, error)
+}
+
+// AuditEraser removes audit entries recorded about a data subject; the
+// audit package's EnterpriseAuditor satisfies it
+type AuditEraser interface {
+	EraseSubject(ctx context.Context, subjectID string) (int64, error)
+}
+
+// ErasureMethod says how a record was made unrecoverable
+type ErasureMethod string
+
+const (
+	// ErasureHardDelete removed the row and its payload
+	ErasureHardDelete ErasureMethod = "hard_delete"
+	// ErasureCryptoShred destroyed the sealed data key of an offloaded
+	// payload; the object itself is deleted best-effort and otherwise
+	// expires under the bucket lifecycle rule
+	ErasureCryptoShred ErasureMethod = "crypto_shred"
+)
+
+// ErasedRecord is one memory removed by Erase
+type ErasedRecord struct {
+	ID       string        `json:"id"`
+	AgentID  string        `json:"agent_id"`
+	Version  int           `json:"version"`
+	Archived bool          `json:"archived"`
+	Method   ErasureMethod `json:"method"`
+}
+
+// ErasureReport is the signed evidence of an erasure request. It carries a
+// SHA-256 digest of the subject identifier, never the identifier itself.
+type ErasureReport struct {
+	ReportID      string         `json:"report_id"`
+	TenantID      string         `json:"tenant_id"`
+	SubjectDigest string         `json:"subject_sha256"`
+	RequestedAt   time.Time      `json:"requested_at"`
+	CompletedAt   time.Time      `json:"completed_at"`
+	Records       []ErasedRecord `json:"records"`
+	BlobRefs      int            `json:"blob_refs_released"`
+	// ReclaimedBytes is the payload storage freed, shared blobs included
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+	// SharedEntries are entries of shared namespaces the subject is in
+	SharedEntries int `json:"shared_entries"`
+	// ProvenanceRows are the content digests linking summaries to the
+	// memories they replaced
+	ProvenanceRows int64 `json:"provenance_rows"`
+	// WorkingItems are items removed from the working-memory tier,
+	// including those set aside after a failed demotion
+	WorkingItems  int64 `json:"working_items"`
+	VectorEntries int   `json:"vector_entries"`
+	AuditEntries  int64 `json:"audit_entries"`
+	// Incomplete lists erasure steps that failed outside the database
+	// transaction and need follow-up
+	Incomplete []string `json:"incomplete,omitempty"`
+
+	SignatureAlgorithm string `json:"signature_algorithm"`
+	Signature          []byte `json:"signature"`
+}
+
+// signedBody is the canonical encoding covered by the signature
+func (r ErasureReport) signedBody() ([]byte, error) {
+	r.Signature = nil
+	return json.Marshal(r)
+}
+
+// Verify checks the report signature against pub
+func (r ErasureReport) Verify(pub crypto.PublicKey) error {
+	body, err := r.signedBody()
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(pub, body, r.Signature); err != nil {
+		return fmt.Errorf("erasure report %s: %w", r.ReportID, err)
+	}
+	return nil
+}
+
+// ErasureConfig signs erasure reports. Any crypto.Signer works; Ed25519
+// keys sign the report directly, others sign its SHA-256 digest. Audit,
+// when set, erases the subject's audit entries along with its memories.
+type ErasureConfig struct {
+	Signer crypto.Signer
+	Audit  AuditEraser
+}
+
+// Erase removes every memory tagged with subjectID in the context's tenant,
+// working, live and archived, including summaries derived from them and shared
+// namespace entries, along with the provenance digests of those summaries.
+// It releases deduplicated blobs, deletes offloaded objects, vector entries
+// and audit entries, invalidates caches and returns a signed report.
+// Working memory is purged first, so a later demotion cannot store the
+// subject's items again. Database rows are removed in one transaction;
+// failures in the object
+// store, vector index or audit log after commit are recorded in
+// Report.Incomplete.
+func (m *MemoryAdapter) Erase(ctx context.Context, subjectID string) (*ErasureReport, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("erase").Observe(time.Since(start).Seconds())
+	}()
+
+	report, err := m.erase(ctx, subjectID, start)
+	if err != nil {
+		memOpsCounter.WithLabelValues("erase", "error").Inc()
+		return nil, err
+	}
+	memOpsCounter.WithLabelValues("erase", "success").Inc()
+	return report, nil
+}
+
+func (m *MemoryAdapter) erase(ctx context.Context, subjectID string, requestedAt time.Time) (*ErasureReport, error) {
+	if subjectID == "" {
+		return nil, errors.New("erasure requires a data subject")
+	}
+	if m.config.Erasure.Signer == nil {
+		return nil, errors.New("erasure requires a report signer")
+	}
+
+	match, err := json.Marshal(map[string]string{dataSubjectKey: subjectID})
+	if err != nil {
+		return nil, err
+	}
+	derived, err := json.Marshal(map[string][]string{dataSubjectsKey: {subjectID}})
+	if err != nil {
+		return nil, err
+	}
+	tenantID := TenantFromContext(ctx)
+	digest := sha256.Sum256([]byte(subjectID))
+	report := &ErasureReport{
+		ReportID:      generateUUID(),
+		TenantID:      tenantID,
+		SubjectDigest: hex.EncodeToString(digest[:]),
+		RequestedAt:   requestedAt.UTC(),
+	}
+
+	if err := m.eraseWorking(ctx, subjectID, report); err != nil {
+		return nil, err
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var live, archived []expiredRow
+	if err := tx.SelectContext(ctx, &live,
+		`DELETE FROM memories
+		 WHERE tenant_id = $1 AND (metadata @> $2::jsonb OR metadata @> $3::jsonb)
+		 RETURNING id, agent_id, version, content_hash, storage, octet_length(data) AS size`,
+		tenantID, string(match), string(derived)); err != nil {
+		return nil, fmt.Errorf("memory erasure failed: %w", err)
+	}
+	if err := tx.SelectContext(ctx, &archived,
+		`DELETE FROM memories_archive
+		 WHERE tenant_id = $1 AND (metadata @> $2::jsonb OR metadata @> $3::jsonb)
+		 RETURNING id, agent_id, version, content_hash, storage, octet_length(data) AS size`,
+		tenantID, string(match), string(derived)); err != nil {
+		return nil, fmt.Errorf("archive erasure failed: %w", err)
+	}
+	var shared []int64
+	if err := tx.SelectContext(ctx, &shared,
+		`DELETE FROM memory_namespace_entries
+		 WHERE tenant_id = $1 AND (metadata @> $2::jsonb OR metadata @> $3::jsonb)
+		 RETURNING seq`,
+		tenantID, string(match), string(derived)); err != nil {
+		return nil, fmt.Errorf("shared entry erasure failed: %w", err)
+	}
+	report.SharedEntries = len(shared)
+	// items that failed demotion still hold the subject's data
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM working_dead_letters WHERE tenant_id = $1 AND subject_id = $2`, tenantID, subjectID)
+	if err != nil {
+		return nil, fmt.Errorf("dead letter erasure failed: %w", err)
+	}
+	deadLetters, _ := res.RowsAffected()
+	report.WorkingItems += deadLetters
+
+	var (
+		refs    []blobRef
+		ids     []string
+		objects []string
+		byAgent = make(map[string][]string)
+		freed   = make(map[string]int64)
+	)
+	collect := func(rows []expiredRow, isArchived bool) {
+		for _, row := range rows {
+			method := ErasureHardDelete
+			if row.Storage == storageObject {
+				method = ErasureCryptoShred
+				objects = append(objects, row.ID)
+			}
+			if row.ContentHash != nil {
+				refs = append(refs, blobRef{AgentID: row.AgentID, ContentHash: row.ContentHash})
+			}
+			if !isArchived {
+				freed[row.AgentID] += row.Size
+			}
+			report.ReclaimedBytes += row.Size
+			ids = append(ids, row.ID)
+			// archiving leaves embeddings in place, so both are erased
+			byAgent[row.AgentID] = append(byAgent[row.AgentID], row.ID)
+			report.Records = append(report.Records, ErasedRecord{
+				ID:       row.ID,
+				AgentID:  row.AgentID,
+				Version:  row.Version,
+				Archived: isArchived,
+				Method:   method,
+			})
+		}
+	}
+	collect(live, false)
+	collect(archived, true)
+
+	blobs, err := releaseBlobs(ctx, tx, refs)
+	if err != nil {
+		return nil, err
+	}
+	report.BlobRefs = len(refs)
+	for agentID, size := range blobs {
+		freed[agentID] += size
+		report.ReclaimedBytes += size
+	}
+
+	// erased summaries take their provenance along, and so do erased
+	// memories still referenced as a summary's source
+	if len(ids) > 0 {
+		q, args, err := sqlx.In(
+			`DELETE FROM memory_provenance WHERE summary_id IN (?) OR source_id IN (?)`, ids, ids)
+		if err != nil {
+			return nil, fmt.Errorf("query build failed: %w", err)
+		}
+		res, err := tx.ExecContext(ctx, tx.Rebind(q), args...)
+		if err != nil {
+			return nil, fmt.Errorf("provenance erasure failed: %w", err)
+		}
+		report.ProvenanceRows, _ = res.RowsAffected()
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit failed: %w", err)
+	}
+
+	for _, row := range live {
+		m.invalidate(ctx, row.AgentID, row.Version)
+	}
+	for agentID, size := range freed {
+		memSizeGauge.WithLabelValues(agentID).Sub(float64(size))
+	}
+	m.eraseObjects(ctx, objects, report)
+	m.eraseVectors(ctx, byAgent, report)
+	m.eraseAudit(ctx, subjectID, report)
+
+	report.CompletedAt = time.Now().UTC()
+	if err := m.signReport(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// eraseWorking removes the subject's items from every agent's working
+// memory. Unlike the steps after the database commit it fails the
+// erasure, since items left behind would be demoted into storage again.
+func (m *MemoryAdapter) eraseWorking(ctx context.Context, subjectID string, report *ErasureReport) error {
+	if m.config.Working == nil {
+		return nil
+	}
+	eraser, ok := m.config.Working.(WorkingEraser)
+	if !ok {
+		report.Incomplete = append(report.Incomplete, "working memory does not support deletion")
+		return nil
+	}
+	agents, err := eraser.Agents(ctx)
+	if err != nil {
+		return fmt.Errorf("working memory scan failed: %w", err)
+	}
+	tenantID := TenantFromContext(ctx)
+	for _, agentID := range agents {
+		items, err := m.config.Working.Recent(ctx, agentID, math.MaxInt32)
+		if err != nil {
+			return fmt.Errorf("working memory read failed: %w", err)
+		}
+		var matched [][]byte
+		for _, raw := range items {
+			var item workingItem
+			if json.Unmarshal(raw, &item) != nil || item.Subject != subjectID {
+				continue
+			}
+			// items remembered before tenants were recorded match any tenant
+			if item.Tenant != "" && item.Tenant != tenantID {
+				continue
+			}
+			matched = append(matched, raw)
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		n, err := eraser.Remove(ctx, agentID, matched)
+		if err != nil {
+			return fmt.Errorf("working memory erasure for agent %s failed: %w", agentID, err)
+		}
+		report.WorkingItems += n
+	}
+	return nil
+}
+
+// eraseObjects deletes offloaded payloads, noting failures in the report
+func (m *MemoryAdapter) eraseObjects(ctx context.Context, recordIDs []string, report *ErasureReport) {
+	if m.config.Offload.Store == nil {
+		return
+	}
+	for _, id := range recordIDs {
+		if err := m.config.Offload.Store.Delete(ctx, objectKey(id)); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			report.Incomplete = append(report.Incomplete,
+				fmt.Sprintf("object %s delete failed: %v", objectKey(id), err))
+		}
+	}
+}
+
+// eraseVectors removes embeddings of erased memories from the vector index
+func (m *MemoryAdapter) eraseVectors(ctx context.Context, byAgent map[string][]string, report *ErasureReport) {
+	if m.config.Index == nil || len(byAgent) == 0 {
+		return
+	}
+	eraser, ok := m.config.Index.(VectorEraser)
+	if !ok {
+		report.Incomplete = append(report.Incomplete, "vector index does not support deletion")
+		return
+	}
+	for agentID, ids := range byAgent {
+		if err := eraser.Delete(ctx, agentID, ids); err != nil {
+			report.Incomplete = append(report.Incomplete,
+				fmt.Sprintf("vector delete for agent %s failed: %v", agentID, err))
+			continue
+		}
+		report.VectorEntries += len(ids)
+	}
+}
+
+// eraseAudit removes the subject's audit entries, noting a failure in the
+// report
+func (m *MemoryAdapter) eraseAudit(ctx context.Context, subjectID string, report *ErasureReport) {
+	if m.config.Erasure.Audit == nil {
+		return
+	}
+	n, err := m.config.Erasure.Audit.EraseSubject(ctx, subjectID)
+	if err != nil {
+		report.Incomplete = append(report.Incomplete, fmt.Sprintf("audit erasure failed: %v", err))
+		return
+	}
+	report.AuditEntries = n
+}
+
+func (m *MemoryAdapter) signReport(report *ErasureReport) error {
+	signer := m.config.Erasure.Signer
+	switch signer.Public().(type) {
+	case ed25519.PublicKey:
+		report.SignatureAlgorithm = "Ed25519"
+	default:
+		report.SignatureAlgorithm = "SHA256"
+	}
+	body, err := report.signedBody()
+	if err != nil {
+		return fmt.Errorf("report encoding failed: %w", err)
+	}
+
+	var sig []byte
+	if report.SignatureAlgorithm == "Ed25519" {
+		sig, err = signer.Sign(rand.Reader, body, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(body)
+		sig, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return fmt.Errorf("report signing failed: %w", err)
+	}
+	report.Signature = sig
+	return nil
+}
+
+func verifySignature(pub crypto.PublicKey, body, sig []byte) error {
+	digest := sha256.Sum256(body)
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		if ed25519.Verify(key, body, sig) {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(key, digest[:], sig) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return errors.New("signature mismatch")
+}
@@ -0,0 +1,223 @@
+// core/memory/hot_cache.go
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultHotRecords = 64
+	defaultHotTTL     = time.Hour
+
+	// InvalidationSubject carries cache invalidations between replicas
+	InvalidationSubject = "nuzon.memory.invalidate"
+)
+
+// InvalidationBus fans cache invalidations out to every adapter replica;
+// the messaging package's EnterpriseNATS satisfies it
+type InvalidationBus interface {
+	Publish(ctx context.Context, subject string, payload interface{}) error
+	Subscribe(subject string, handler func([]byte) error) (Subscription, error)
+}
+
+// Subscription is the handle InvalidationBus.Subscribe returns; the alias
+// makes it the same type as messaging.Subscription
+type Subscription = interface {
+	Unsubscribe() error
+	Drain(ctx context.Context) error
+}
+
+type invalidation struct {
+	AgentID string `json:"agent_id,omitempty"`
+	Version int    `json:"version,omitempty"`
+	All     bool   `json:"all,omitempty"`
+	// TenantID and KeyIDs name the data keys a shred destroyed
+	TenantID string   `json:"tenant_id,omitempty"`
+	KeyIDs   []string `json:"key_ids,omitempty"`
+}
+
+// RedisHotCache keeps the most recent sealed records of each agent in Redis.
+// Payloads stay encrypted; the cache only saves the Postgres round trip.
+type RedisHotCache struct {
+	client    redis.UniversalClient
+	perAgent  int
+	ttl       time.Duration
+	keyPrefix string
+}
+
+// NewRedisHotCache retains up to perAgent recent records per agent for ttl
+func NewRedisHotCache(client redis.UniversalClient, perAgent int, ttl time.Duration) *RedisHotCache {
+	if perAgent <= 0 {
+		perAgent = defaultHotRecords
+	}
+	if ttl <= 0 {
+		ttl = defaultHotTTL
+	}
+	return &RedisHotCache{
+		client:    client,
+		perAgent:  perAgent,
+		ttl:       ttl,
+		keyPrefix: "nuzon:memory:hot:",
+	}
+}
+
+func (c *RedisHotCache) recordKey(agentID string, version int) string {
+	return c.keyPrefix + agentID + ":" + strconv.Itoa(version)
+}
+
+func (c *RedisHotCache) indexKey(agentID string) string {
+	return c.keyPrefix + agentID
+}
+
+// Get returns a cached sealed record
+func (c *RedisHotCache) Get(ctx context.Context, agentID string, version int) (MemoryRecord, bool, error) {
+	raw, err := c.client.Get(ctx, c.recordKey(agentID, version)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return MemoryRecord{}, false, nil
+	}
+	if err != nil {
+		return MemoryRecord{}, false, fmt.Errorf("redis get failed: %w", err)
+	}
+	var record MemoryRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return MemoryRecord{}, false, fmt.Errorf("hot record decoding failed: %w", err)
+	}
+	return record, true, nil
+}
+
+// Put writes a sealed record through and trims the agent's window to the
+// most recent versions
+func (c *RedisHotCache) Put(ctx context.Context, record MemoryRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("hot record encoding failed: %w", err)
+	}
+	index := c.indexKey(record.AgentID)
+
+	pipe := c.client.TxPipeline()
+	pipe.Set(ctx, c.recordKey(record.AgentID, record.Version), raw, c.ttl)
+	pipe.ZAdd(ctx, index, redis.Z{Score: float64(record.Version), Member: record.Version})
+	pipe.Expire(ctx, index, c.ttl)
+	evicted := pipe.ZRange(ctx, index, 0, int64(-c.perAgent-1))
+	pipe.ZRemRangeByRank(ctx, index, 0, int64(-c.perAgent-1))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis write failed: %w", err)
+	}
+
+	if stale := evicted.Val(); len(stale) > 0 {
+		keys := make([]string, 0, len(stale))
+		for _, v := range stale {
+			keys = append(keys, c.keyPrefix+record.AgentID+":"+v)
+		}
+		if err := c.client.Del(ctx, keys...).Err(); err != nil {
+			return fmt.Errorf("redis eviction failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Delete removes a single version
+func (c *RedisHotCache) Delete(ctx context.Context, agentID string, version int) error {
+	pipe := c.client.TxPipeline()
+	pipe.Del(ctx, c.recordKey(agentID, version))
+	pipe.ZRem(ctx, c.indexKey(agentID), version)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis delete failed: %w", err)
+	}
+	return nil
+}
+
+// lookupCached checks the in-process LRU, then the Redis hot tier
+func (m *MemoryAdapter) lookupCached(ctx context.Context, agentID string, version int) (MemoryRecord, bool) {
+	if record, ok := m.cache.Get(agentID, version); ok {
+		return record, true
+	}
+	if m.config.HotCache == nil {
+		return MemoryRecord{}, false
+	}
+	record, ok, err := m.config.HotCache.Get(ctx, agentID, version)
+	if err != nil {
+		memOpsCounter.WithLabelValues("hot_cache", "error").Inc()
+		return MemoryRecord{}, false
+	}
+	if ok {
+		memOpsCounter.WithLabelValues("hot_cache", "hit").Inc()
+		m.cache.Set(record)
+	}
+	return record, ok
+}
+
+// cacheRecord writes a committed record to both cache tiers
+func (m *MemoryAdapter) cacheRecord(ctx context.Context, record MemoryRecord) {
+	m.cache.Set(record)
+	if m.config.HotCache == nil {
+		return
+	}
+	if err := m.config.HotCache.Put(ctx, record); err != nil {
+		memOpsCounter.WithLabelValues("hot_cache", "error").Inc()
+	}
+}
+
+// invalidate drops a record from every cache tier on every replica
+func (m *MemoryAdapter) invalidate(ctx context.Context, agentID string, version int) {
+	m.cache.Remove(agentID, version)
+	if m.config.HotCache != nil {
+		if err := m.config.HotCache.Delete(ctx, agentID, version); err != nil {
+			memOpsCounter.WithLabelValues("hot_cache", "error").Inc()
+		}
+	}
+	m.publishInvalidation(ctx, invalidation{AgentID: agentID, Version: version})
+}
+
+// invalidateAll purges the in-process cache on every replica. Hot-tier
+// entries age out by TTL; they hold only ciphertext.
+func (m *MemoryAdapter) invalidateAll(ctx context.Context) {
+	m.cache.Purge()
+	m.publishInvalidation(ctx, invalidation{All: true})
+}
+
+func (m *MemoryAdapter) publishInvalidation(ctx context.Context, msg invalidation) {
+	if m.config.Invalidation == nil {
+		return
+	}
+	if err := m.config.Invalidation.Publish(ctx, InvalidationSubject, msg); err != nil {
+		memOpsCounter.WithLabelValues("invalidate", "error").Inc()
+	}
+}
+
+// forgetKeys evicts shredded data keys and the AEADs built from them
+func (m *MemoryAdapter) forgetKeys(tenantID string, keyIDs []string) {
+	for _, id := range keyIDs {
+		m.aeads.drop(id)
+	}
+	if keyring, ok := m.config.Keyring.(*TenantKeyring); ok {
+		keyring.forget(tenantID, keyIDs)
+	}
+}
+
+// subscribeInvalidations applies invalidations published by other replicas
+func (m *MemoryAdapter) subscribeInvalidations() error {
+	_, err := m.config.Invalidation.Subscribe(InvalidationSubject, func(data []byte) error {
+		var msg invalidation
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return fmt.Errorf("invalidation decoding failed: %w", err)
+		}
+		if len(msg.KeyIDs) > 0 {
+			m.forgetKeys(msg.TenantID, msg.KeyIDs)
+		}
+		if msg.All {
+			m.cache.Purge()
+		} else {
+			m.cache.Remove(msg.AgentID, msg.Version)
+		}
+		return nil
+	})
+	return err
+}
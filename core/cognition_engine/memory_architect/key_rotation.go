@@ -0,0 +1,211 @@
+// core/memory/key_rotation.go
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	qcrypto "cirium.ai/core/crypto"
+	"github.com/jmoiron/sqlx"
+)
+
+// RotationKeyring adapts k to the crypto package's MemoryKeyring, which
+// KeyMigrationEngine.RunScheduled rotates tenant by tenant
+func (k *TenantKeyring) RotationKeyring() qcrypto.MemoryKeyring {
+	return rotationKeyring{keys: k}
+}
+
+type rotationKeyring struct {
+	keys *TenantKeyring
+}
+
+func (r rotationKeyring) Tenants(ctx context.Context) ([]string, error) {
+	var tenants []string
+	if err := r.keys.db.SelectContext(ctx, &tenants,
+		`SELECT tenant_id FROM tenant_keys WHERE state = 'active' ORDER BY tenant_id`); err != nil {
+		return nil, fmt.Errorf("tenant key query failed: %w", err)
+	}
+	return tenants, nil
+}
+
+func (r rotationKeyring) ActiveKey(ctx context.Context, tenantID string) (string, [32]byte, error) {
+	return r.keys.ActiveKey(WithTenant(ctx, tenantID))
+}
+
+func (r rotationKeyring) Key(ctx context.Context, keyID string) ([32]byte, error) {
+	return r.keys.Key(ctx, keyID)
+}
+
+// NewKey stores a pending DEK, which opens records re-sealed under it but
+// seals nothing new until Activate
+func (r rotationKeyring) NewKey(ctx context.Context, tenantID string) (string, [32]byte, error) {
+	key, wrapped, err := r.keys.kek.GenerateDataKey(ctx)
+	if err != nil {
+		return "", [32]byte{}, fmt.Errorf("tenant key generation failed: %w", err)
+	}
+	keyID := generateUUID()
+	if _, err := r.keys.db.ExecContext(ctx,
+		`INSERT INTO tenant_keys (key_id, tenant_id, wrapped_dek, state, created_at)
+		 VALUES ($1, $2, $3, 'pending', $4)`,
+		keyID, tenantID, wrapped, time.Now().UTC()); err != nil {
+		clear(key[:])
+		return "", [32]byte{}, fmt.Errorf("tenant key insert failed: %w", err)
+	}
+	r.keys.remember(keyID, key)
+	return keyID, key, nil
+}
+
+// Activate retires the tenant's active DEK in favour of keyID. It is a
+// no-op once keyID is active, so a rotation resumed after activation
+// completes cleanly.
+func (r rotationKeyring) Activate(ctx context.Context, tenantID, keyID string) error {
+	tx, err := r.keys.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE tenant_keys SET state = 'retired', retired_at = NOW()
+		 WHERE tenant_id = $1 AND state = 'active' AND key_id <> $2`, tenantID, keyID); err != nil {
+		return fmt.Errorf("tenant key retire failed: %w", err)
+	}
+	res, err := tx.ExecContext(ctx,
+		`UPDATE tenant_keys SET state = 'active'
+		 WHERE key_id = $1 AND tenant_id = $2 AND state IN ('pending', 'active')`, keyID, tenantID)
+	if err != nil {
+		return fmt.Errorf("tenant key activation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("tenant key %s is not pending for tenant %s", keyID, tenantID)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Other replicas pick the new key up once their cached active key
+	// expires; records they seal meanwhile stay readable under the retired one
+	r.keys.mu.Lock()
+	r.keys.active[tenantID] = keyID
+	r.keys.mu.Unlock()
+	return nil
+}
+
+// WorkingRewriter is implemented by WorkingStores that can enumerate their
+// agents and swap an item in place, letting key rotation re-seal working
+// memory
+type WorkingRewriter interface {
+	WorkingStore
+	Agents(ctx context.Context) ([]string, error)
+	Replace(ctx context.Context, agentID string, old, updated []byte) (bool, error)
+}
+
+// WorkingResealer re-seals working-memory items during a key rotation,
+// both in the working store and in working_dead_letters. It is a
+// qcrypto.SealedStore for RotationSchedule.Stores.
+type WorkingResealer struct {
+	db    *sqlx.DB
+	store WorkingRewriter
+}
+
+// NewWorkingResealer covers the dead letters in db and store, which may be
+// nil when no working tier is configured
+func NewWorkingResealer(db *sqlx.DB, store WorkingRewriter) *WorkingResealer {
+	return &WorkingResealer{db: db, store: store}
+}
+
+func (w *WorkingResealer) Reseal(ctx context.Context, oldKeyID string, reseal qcrypto.ResealFunc) (int, error) {
+	n, err := w.resealDeadLetters(ctx, oldKeyID, reseal)
+	if err != nil || w.store == nil {
+		return n, err
+	}
+
+	agents, err := w.store.Agents(ctx)
+	if err != nil {
+		return n, fmt.Errorf("working memory scan failed: %w", err)
+	}
+	for _, agentID := range agents {
+		items, err := w.store.Recent(ctx, agentID, math.MaxInt32)
+		if err != nil {
+			return n, fmt.Errorf("working memory read failed: %w", err)
+		}
+		for _, raw := range items {
+			updated, ok, err := resealWorkingItem(raw, oldKeyID, reseal)
+			if err != nil {
+				return n, fmt.Errorf("working item of agent %s: %w", agentID, err)
+			}
+			if !ok {
+				continue
+			}
+			// an item demoted or erased meanwhile is simply gone
+			replaced, err := w.store.Replace(ctx, agentID, raw, updated)
+			if err != nil {
+				return n, fmt.Errorf("working memory rewrite for agent %s failed: %w", agentID, err)
+			}
+			if replaced {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+// resealDeadLetters rewrites the dead-lettered items sealed under oldKeyID
+// in one transaction; there are few, as each marks a failed demotion
+func (w *WorkingResealer) resealDeadLetters(ctx context.Context, oldKeyID string, reseal qcrypto.ResealFunc) (int, error) {
+	tx, err := w.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var rows []struct {
+		ID   int64  `db:"id"`
+		Item []byte `db:"item"`
+	}
+	if err := tx.SelectContext(ctx, &rows,
+		`SELECT id, item FROM working_dead_letters
+		 WHERE convert_from(item, 'UTF8')::jsonb->>'key_id' = $1
+		 FOR UPDATE`, oldKeyID); err != nil {
+		return 0, fmt.Errorf("dead letter query failed: %w", err)
+	}
+	n := 0
+	for _, row := range rows {
+		updated, ok, err := resealWorkingItem(row.Item, oldKeyID, reseal)
+		if err != nil {
+			return 0, fmt.Errorf("dead letter %d: %w", row.ID, err)
+		}
+		if !ok {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE working_dead_letters SET item = $1 WHERE id = $2`, updated, row.ID); err != nil {
+			return 0, fmt.Errorf("dead letter update failed: %w", err)
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
+
+// resealWorkingItem returns raw sealed under the rotation's new key, or
+// false when raw is not sealed under oldKeyID. Undecodable items are left
+// alone, as demotion dead-letters them.
+func resealWorkingItem(raw []byte, oldKeyID string, reseal qcrypto.ResealFunc) ([]byte, bool, error) {
+	var item workingItem
+	if json.Unmarshal(raw, &item) != nil || item.KeyID != oldKeyID {
+		return nil, false, nil
+	}
+	keyID, cipherName, sealed, err := reseal(item.Cipher, item.Data)
+	if err != nil {
+		return nil, false, err
+	}
+	item.KeyID, item.Cipher, item.Data = keyID, cipherName, sealed
+	updated, err := json.Marshal(item)
+	if err != nil {
+		return nil, false, fmt.Errorf("working item encoding failed: %w", err)
+	}
+	return updated, true, nil
+}
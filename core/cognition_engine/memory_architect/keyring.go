@@ -0,0 +1,146 @@
+// core/memory/keyring.go
+package memory
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	qcrypto "cirium.ai/core/crypto"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// defaultKeyID labels records sealed with MemoryConfig.EncryptionKey
+const defaultKeyID = "initial"
+
+// newMemoryAEAD builds the AEAD a record was (or will be) sealed with
+func newMemoryAEAD(name string, key []byte) (cipher.AEAD, error) {
+	switch name {
+	case qcrypto.CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case qcrypto.CipherChaCha20Poly1305, "":
+		return chacha20poly1305.New(key)
+	default:
+		return nil, fmt.Errorf("unknown memory cipher %q", name)
+	}
+}
+
+// sealingCipher is AES-GCM in FIPS mode and ChaCha20-Poly1305 otherwise
+func (m *MemoryAdapter) sealingCipher() string {
+	return qcrypto.SymmetricAEADName()
+}
+
+// MemoryKeyring resolves memory-encryption keys by identifier so records
+// sealed before and after a key rotation remain readable. Implementations
+// may scope ActiveKey to the tenant on ctx (see TenantKeyring).
+type MemoryKeyring interface {
+	ActiveKey(ctx context.Context) (string, [32]byte, error)
+	Key(ctx context.Context, keyID string) ([32]byte, error)
+}
+
+// aeadCache holds the AEADs built from unwrapped keys for keyCacheTTL,
+// like the keyring holds the keys themselves
+type aeadCache struct {
+	mu    sync.RWMutex
+	byKey map[string]cachedAEAD
+}
+
+type cachedAEAD struct {
+	aead    cipher.AEAD
+	expires time.Time
+}
+
+func (c *aeadCache) get(keyID string) (cipher.AEAD, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.byKey[keyID]
+	if !ok || !time.Now().Before(entry.expires) {
+		return nil, false
+	}
+	return entry.aead, true
+}
+
+// drop removes every cached AEAD derived from keyID
+func (c *aeadCache) drop(keyID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.byKey {
+		if strings.HasPrefix(k, keyID+"/") {
+			delete(c.byKey, k)
+		}
+	}
+}
+
+func (c *aeadCache) put(keyID string, a cipher.AEAD) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byKey == nil {
+		c.byKey = make(map[string]cachedAEAD)
+	}
+	c.byKey[keyID] = cachedAEAD{aead: a, expires: time.Now().Add(keyCacheTTL)}
+}
+
+// sealingAEAD returns the cipher and key ID new records must be written with
+func (m *MemoryAdapter) sealingAEAD(ctx context.Context) (string, cipher.AEAD, error) {
+	name := m.sealingCipher()
+	if m.config.Keyring == nil {
+		a, err := m.openingAEAD(ctx, defaultKeyID, name)
+		return defaultKeyID, a, err
+	}
+	keyID, key, err := m.config.Keyring.ActiveKey(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("active key lookup failed: %w", err)
+	}
+	if a, ok := m.aeads.get(keyID + "/" + name); ok {
+		return keyID, a, nil
+	}
+	a, err := newMemoryAEAD(name, key[:])
+	if err != nil {
+		return "", nil, err
+	}
+	m.aeads.put(keyID+"/"+name, a)
+	return keyID, a, nil
+}
+
+// openingAEAD returns the cipher for a record sealed under keyID with cipherName
+func (m *MemoryAdapter) openingAEAD(ctx context.Context, keyID, cipherName string) (cipher.AEAD, error) {
+	if cipherName == "" {
+		cipherName = qcrypto.CipherChaCha20Poly1305
+	}
+	if keyID == "" {
+		keyID = defaultKeyID
+	}
+	if keyID == defaultKeyID && cipherName == qcrypto.CipherChaCha20Poly1305 {
+		return m.aead, nil
+	}
+
+	cacheKey := keyID + "/" + cipherName
+	if a, ok := m.aeads.get(cacheKey); ok {
+		return a, nil
+	}
+
+	var key [32]byte
+	if keyID == defaultKeyID || m.config.Keyring == nil {
+		key = m.config.EncryptionKey
+	} else {
+		k, err := m.config.Keyring.Key(ctx, keyID)
+		if err != nil {
+			return nil, fmt.Errorf("key %s lookup failed: %w", keyID, err)
+		}
+		key = k
+	}
+	a, err := newMemoryAEAD(cipherName, key[:])
+	if err != nil {
+		return nil, err
+	}
+	m.aeads.put(cacheKey, a)
+	return a, nil
+}
@@ -0,0 +1,142 @@
+// core/memory/lru_cache.go
+package memory
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// recordOverhead approximates the fixed per-entry cost of a cached record
+const recordOverhead = 256
+
+var (
+	memCacheEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "Wavine_memory_cache_events_total",
+			Help: "Memory record cache lookups and evictions by event",
+		},
+		[]string{"event"},
+	)
+
+	memCacheBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "Wavine_memory_cache_bytes",
+			Help: "Bytes of encrypted memory records held in the cache",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(memCacheEvents, memCacheBytes)
+}
+
+type cacheKey struct {
+	agentID string
+	version int
+}
+
+type cacheEntry struct {
+	key    cacheKey
+	record MemoryRecord
+	size   int
+}
+
+// LRUCache holds encrypted memory records keyed on (agentID, version),
+// bounded by both entry count and total bytes
+type LRUCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	order      *list.List
+	entries    map[cacheKey]*list.Element
+}
+
+// NewLRUCache creates a cache bounded to maxEntries records and, when
+// maxBytes is positive, to maxBytes of record payload
+func NewLRUCache(maxEntries, maxBytes int) *LRUCache {
+	return &LRUCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		entries:    make(map[cacheKey]*list.Element),
+	}
+}
+
+// Get returns the cached record for agentID at version, skipping expired records
+func (c *LRUCache) Get(agentID string, version int) (MemoryRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[cacheKey{agentID, version}]
+	if !ok {
+		memCacheEvents.WithLabelValues("miss").Inc()
+		return MemoryRecord{}, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if entry.record.ExpiresAt.Valid && time.Now().After(entry.record.ExpiresAt.Time) {
+		c.removeElement(el)
+		memCacheEvents.WithLabelValues("miss").Inc()
+		return MemoryRecord{}, false
+	}
+	c.order.MoveToFront(el)
+	memCacheEvents.WithLabelValues("hit").Inc()
+	return entry.record, true
+}
+
+// Set inserts or replaces a record and evicts least-recently-used entries
+// until the cache is within bounds
+func (c *LRUCache) Set(record MemoryRecord) {
+	if c.maxEntries <= 0 {
+		return
+	}
+	size := recordOverhead + len(record.Data) + len(record.Metadata) + len(record.ContentHash)
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey{record.AgentID, record.Version}
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, record: record, size: size})
+	c.bytes += size
+
+	for c.order.Len() > c.maxEntries || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.removeElement(c.order.Back())
+		memCacheEvents.WithLabelValues("eviction").Inc()
+	}
+	memCacheBytes.Set(float64(c.bytes))
+}
+
+// Remove invalidates a single version
+func (c *LRUCache) Remove(agentID string, version int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[cacheKey{agentID, version}]; ok {
+		c.removeElement(el)
+		memCacheBytes.Set(float64(c.bytes))
+	}
+}
+
+// Purge drops every entry
+func (c *LRUCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.entries)
+	c.bytes = 0
+	memCacheBytes.Set(0)
+}
+
+func (c *LRUCache) removeElement(el *list.Element) {
+	entry := c.order.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
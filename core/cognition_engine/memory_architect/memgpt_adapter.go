@@ -6,10 +6,12 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"time"
 
+	qcrypto "cirium.ai/core/crypto"
 	"github.com/jmoiron/sqlx"
 	"github.com/klauspost/compress/zstd"
 	"github.com/prometheus/client_golang/prometheus"
@@ -49,21 +51,109 @@ func init() {
 
 // MemoryRecord represents an encrypted memory unit with versioning
 type MemoryRecord struct {
-	ID        string    `db:"id"`
-	AgentID   string    `db:"agent_id"`
-	Version   int       `db:"version"`
-	Data      []byte    `db:"data"`
-	Metadata  []byte    `db:"metadata"`
-	CreatedAt time.Time `db:"created_at"`
-	ExpiresAt time.Time `db:"expires_at"`
+	ID        string      `db:"id"`
+	TenantID  string      `db:"tenant_id"`
+	AgentID   string      `db:"agent_id"`
+	Version   int         `db:"version"`
+	Data      []byte      `db:"data"`
+	Metadata  []byte      `db:"metadata"`
+	KeyID     string      `db:"key_id"`
+	Cipher    string      `db:"cipher"`
+	Class     MemoryClass `db:"class"`
+	CreatedAt time.Time   `db:"created_at"`
+
+	// ExpiresAt is cleared while a snapshot pins the record (see
+	// CreateSnapshot) and restored once no snapshot holds it
+	ExpiresAt sql.NullTime `db:"expires_at"`
+
+	// ConsolidatedAt is set once an episodic record is folded into a
+	// semantic summary
+	ConsolidatedAt sql.NullTime `db:"consolidated_at"`
+
+	// ContentHash references a shared memory_blobs payload when Data is empty
+	ContentHash []byte `db:"content_hash"`
+
+	// Storage is "object" when Data holds a sealed pointer to an offloaded payload
+	Storage string `db:"storage"`
 }
 
 // MemoryConfig contains encryption and storage parameters
 type MemoryConfig struct {
-	PostgresDSN      string
+	PostgresDSN string
+	// EncryptionKey seals records when no Keyring is configured and opens
+	// legacy records carrying the "initial" key ID. New deployments should
+	// use a TenantKeyring so each tenant has its own wrapped DEK.
 	EncryptionKey    [32]byte
 	CompressionLevel zstd.EncoderLevel
-	CacheSize        int
+	// CacheSize bounds cached records by count and CacheMaxBytes, when
+	// positive, by encrypted payload size
+	CacheSize     int
+	CacheMaxBytes int
+
+	// WrappedEncryptionKey, when set, is unwrapped through KeyProvider
+	// and takes precedence over EncryptionKey
+	WrappedEncryptionKey []byte
+	KeyProvider          DataKeyProvider
+
+	// Keyring, when set, supplies rotating keys; records carry the ID of
+	// the key they were sealed with and are re-encrypted under the active
+	// key as they are read
+	Keyring MemoryKeyring
+
+	// Policy, when set, must permit the memory AEAD before the adapter starts
+	Policy CipherPolicy
+
+	// Embedder and Index, when both set, make memories searchable by meaning
+	Embedder Embedder
+	Index    VectorIndex
+
+	// GC removes expired records; see RunGC
+	GC GCConfig
+
+	// HotCache, when set, serves recent records from Redis ahead of
+	// Postgres; Invalidation propagates cache invalidations to replicas
+	HotCache     *RedisHotCache
+	Invalidation InvalidationBus
+
+	// PublishEvents records a MemoryStoredSubject event in the messaging
+	// outbox within each write's transaction, for the outbox relay to
+	// publish once the write commits
+	PublishEvents bool
+
+	// Compaction summarizes old, low-salience memories; see RunCompaction
+	Compaction CompactionConfig
+
+	// Offload moves large payloads to object storage
+	Offload OffloadConfig
+
+	// PII classifies direct writes and tags or redacts findings before
+	// encryption
+	PII PIIConfig
+
+	// Erasure signs right-to-be-forgotten reports; see Erase
+	Erasure ErasureConfig
+
+	// Snapshots bounds per-agent snapshot retention; see CreateSnapshot
+	Snapshots SnapshotRetention
+
+	// Dedup stores identical payloads for the same agent once, with
+	// reference counting
+	Dedup bool
+
+	// Working and Tiers enable the tiered memory model; see Remember and Recall
+	Working    WorkingStore
+	Summarizer Summarizer
+	Tiers      TierPolicy
+}
+
+// CipherPolicy is consulted before a symmetric cipher is put into use
+type CipherPolicy interface {
+	CheckCipher(name string) error
+}
+
+// DataKeyProvider resolves a KMS-wrapped data key into plaintext
+type DataKeyProvider interface {
+	DataKey(ctx context.Context, wrapped []byte) ([32]byte, error)
 }
 
 // MemoryAdapter implements secure long-term memory storage
@@ -74,6 +164,7 @@ type MemoryAdapter struct {
 	decoder   *zstd.Decoder
 	cache     *LRUCache
 	config    MemoryConfig
+	aeads     aeadCache
 }
 
 // NewMemoryAdapter creates a new memory subsystem instance
@@ -83,6 +174,21 @@ func NewMemoryAdapter(ctx context.Context, cfg MemoryConfig) (*MemoryAdapter, er
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	if cfg.KeyProvider != nil && len(cfg.WrappedEncryptionKey) > 0 {
+		key, err := cfg.KeyProvider.DataKey(ctx, cfg.WrappedEncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap encryption key: %w", err)
+		}
+		cfg.EncryptionKey = key
+	}
+
+	sealCipher := qcrypto.SymmetricAEADName()
+	if cfg.Policy != nil {
+		if err := cfg.Policy.CheckCipher(sealCipher); err != nil {
+			return nil, fmt.Errorf("memory cipher rejected: %w", err)
+		}
+	}
+
 	aead, err := chacha20poly1305.New(cfg.EncryptionKey[:])
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize crypto: %w", err)
@@ -98,82 +204,228 @@ func NewMemoryAdapter(ctx context.Context, cfg MemoryConfig) (*MemoryAdapter, er
 		return nil, fmt.Errorf("failed to initialize decompressor: %w", err)
 	}
 
-	return &MemoryAdapter{
+	adapter := &MemoryAdapter{
 		db:        db,
 		aead:      aead,
 		encoder:   encoder,
 		decoder:   decoder,
-		cache:     NewLRUCache(cfg.CacheSize),
+		cache:     NewLRUCache(cfg.CacheSize, cfg.CacheMaxBytes),
 		config:    cfg,
-	}, nil
+	}
+	if cfg.Invalidation != nil {
+		if err := adapter.subscribeInvalidations(); err != nil {
+			return nil, fmt.Errorf("failed to subscribe to cache invalidations: %w", err)
+		}
+	}
+	return adapter, nil
 }
 
 // StoreMemory persists encrypted memory with version control
 func (m *MemoryAdapter) StoreMemory(ctx context.Context, agentID string, data any) (string, error) {
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		memOpsCounter.WithLabelValues("store", "error").Inc()
+		return "", fmt.Errorf("serialization failed: %w", err)
+	}
+	return m.storePlaintext(ctx, agentID, plaintext, ClassEpisodic, []byte(`{"source":"direct_input"}`))
+}
+
+// storePlaintext screens, seals and inserts a serialized memory of the given class
+func (m *MemoryAdapter) storePlaintext(ctx context.Context, agentID string, plaintext []byte, class MemoryClass, metadata []byte) (string, error) {
 	start := time.Now()
 	defer func() {
 		memLatencyHist.WithLabelValues("store").Observe(time.Since(start).Seconds())
 	}()
 
-	plaintext, err := json.Marshal(data)
+	record, plaintext, err := m.newRecord(ctx, agentID, plaintext, class, metadata)
 	if err != nil {
 		memOpsCounter.WithLabelValues("store", "error").Inc()
-		return "", fmt.Errorf("serialization failed: %w", err)
+		return "", err
 	}
 
-	compressed := m.encoder.EncodeAll(plaintext, make([]byte, 0, len(plaintext)))
-	
-	nonce := make([]byte, m.aead.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
-		memOpsCounter.WithLabelValues("store", "error").Inc()
-		return "", fmt.Errorf("nonce generation failed: %w", err)
+	// Concurrent appenders may claim the same version; retry with the next one
+	var written int
+	for attempt := 1; ; attempt++ {
+		written, err = m.commitRecord(ctx, &record, plaintext, anyVersion)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrVersionConflict) || attempt == maxVersionRetries {
+			m.discardRecord(ctx, record)
+			memOpsCounter.WithLabelValues("store", "error").Inc()
+			return "", err
+		}
+	}
+
+	m.cacheRecord(ctx, record)
+	memSizeGauge.WithLabelValues(record.AgentID).Add(float64(written))
+	memOpsCounter.WithLabelValues("store", "success").Inc()
+	m.indexMemory(ctx, record, plaintext)
+	return record.ID, nil
+}
+
+// recordTTL is how long a memory record lives before GC collects it
+const recordTTL = 720 * time.Hour
+
+// newRecord screens plaintext for PII and seals it into an unversioned
+// record for agentID, offloading it to object storage when it exceeds the
+// offload threshold. It returns the screened plaintext, which callers must
+// index and hash in place of the original.
+func (m *MemoryAdapter) newRecord(ctx context.Context, agentID string, plaintext []byte, class MemoryClass, metadata []byte) (MemoryRecord, []byte, error) {
+	plaintext, metadata, err := m.screenPII(ctx, plaintext, metadata)
+	if err != nil {
+		return MemoryRecord{}, nil, err
+	}
+	if metadata, err = tagSubject(ctx, metadata); err != nil {
+		return MemoryRecord{}, nil, err
 	}
 
-	encrypted := m.aead.Seal(nil, nonce, compressed, nil)
+	now := time.Now().UTC()
 	record := MemoryRecord{
 		ID:        generateUUID(),
+		TenantID:  TenantFromContext(ctx),
 		AgentID:   agentID,
 		Version:   1,
-		Data:      append(nonce, encrypted...),
-		Metadata:  []byte(`{"source":"direct_input"}`),
-		CreatedAt: time.Now().UTC(),
-		ExpiresAt: time.Now().UTC().Add(720 * time.Hour),
+		Metadata:  metadata,
+		Class:     class,
+		Storage:   storageInline,
+		CreatedAt: now,
+		ExpiresAt: sql.NullTime{Time: now.Add(recordTTL), Valid: true},
+	}
+	if m.shouldOffload(plaintext) {
+		return record, plaintext, m.offload(ctx, &record, plaintext)
 	}
 
-	tx, err := m.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	keyID, cipherName, sealed, err := m.seal(ctx, plaintext)
 	if err != nil {
-		memOpsCounter.WithLabelValues("store", "error").Inc()
-		return "", fmt.Errorf("transaction start failed: %w", err)
+		return MemoryRecord{}, nil, err
 	}
-	defer tx.Rollback()
+	record.Data, record.KeyID, record.Cipher = sealed, keyID, cipherName
+	return record, plaintext, nil
+}
 
-	if err := tx.GetContext(ctx, &record.Version, 
-		`SELECT COALESCE(MAX(version),0)+1 
-		 FROM memories 
-		 WHERE agent_id = \$1`, agentID); err != nil {
-		memOpsCounter.WithLabelValues("store", "error").Inc()
-		return "", fmt.Errorf("versioning failed: %w", err)
+// discardRecord cleans up after a record that was built but never committed
+func (m *MemoryAdapter) discardRecord(ctx context.Context, record MemoryRecord) {
+	if record.Storage == storageObject {
+		m.deleteObjects(ctx, []string{record.ID})
+	}
+}
+
+// insertRecord assigns the next version and inserts record within tx,
+// returning the bytes newly written to storage. Unless expected is
+// anyVersion, the agent's latest version must equal expected.
+func (m *MemoryAdapter) insertRecord(ctx context.Context, tx *sqlx.Tx, record *MemoryRecord, plaintext []byte, expected int) (int, error) {
+	var current int
+	// forks continue numbering from the version they branched at
+	if err := tx.GetContext(ctx, &current,
+		`SELECT GREATEST(COALESCE(MAX(version), 0), `+forkVersion+`)
+		 FROM memories
+		 WHERE agent_id = $1`, record.AgentID); err != nil {
+		return 0, fmt.Errorf("versioning failed: %w", err)
+	}
+	if expected != anyVersion && current != expected {
+		return 0, &VersionConflictError{AgentID: record.AgentID, Expected: expected, Current: current}
+	}
+	record.Version = current + 1
+
+	written := len(record.Data)
+	if m.config.Dedup && record.Storage != storageObject {
+		hash, err := m.contentHash(ctx, record.AgentID, record.KeyID, plaintext)
+		if err != nil {
+			return 0, err
+		}
+		if written, err = m.attachBlob(ctx, tx, record, hash); err != nil {
+			return 0, err
+		}
 	}
 
 	if _, err := tx.NamedExecContext(ctx, 
 		`INSERT INTO memories 
-		 (id, agent_id, version, data, metadata, created_at, expires_at)
+		 (id, tenant_id, agent_id, version, data, metadata, key_id, cipher, class, content_hash, storage, created_at, expires_at)
 		 VALUES 
-		 (:id, :agent_id, :version, :data, :metadata, :created_at, :expires_at)`, 
+		 (:id, :tenant_id, :agent_id, :version, :data, :metadata, :key_id, :cipher, :class, :content_hash, :storage, :created_at, :expires_at)`, 
 		 record); err != nil {
-		memOpsCounter.WithLabelValues("store", "error").Inc()
-		return "", fmt.Errorf("insert failed: %w", err)
+		if isVersionRace(err) {
+			return 0, &VersionConflictError{AgentID: record.AgentID, Expected: expected, Current: record.Version}
+		}
+		return 0, fmt.Errorf("insert failed: %w", err)
+	}
+	return written, nil
+}
+
+// commitRecord inserts record in its own serializable transaction
+func (m *MemoryAdapter) commitRecord(ctx context.Context, record *MemoryRecord, plaintext []byte, expected int) (int, error) {
+	tx, err := m.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return 0, fmt.Errorf("transaction start failed: %w", err)
 	}
+	defer tx.Rollback()
 
+	written, err := m.insertRecord(ctx, tx, record, plaintext, expected)
+	if err != nil {
+		return 0, err
+	}
+	if m.config.PublishEvents {
+		if err := writeStoredEvent(ctx, tx, record); err != nil {
+			return 0, err
+		}
+	}
 	if err := tx.Commit(); err != nil {
-		memOpsCounter.WithLabelValues("store", "error").Inc()
-		return "", fmt.Errorf("commit failed: %w", err)
+		if isVersionRace(err) {
+			return 0, &VersionConflictError{AgentID: record.AgentID, Expected: expected, Current: record.Version}
+		}
+		return 0, fmt.Errorf("commit failed: %w", err)
 	}
+	return written, nil
+}
 
-	m.cache.Set(record.ID, record)
-	memSizeGauge.WithLabelValues(record.AgentID).Add(float64(len(record.Data)))
-	memOpsCounter.WithLabelValues("store", "success").Inc()
-	return record.ID, nil
+// MemoryStoredSubject carries a memoryStored event for every committed
+// write when MemoryConfig.PublishEvents is set
+const MemoryStoredSubject = "nuzon.memory.stored"
+
+// memoryStored announces a write; the payload itself stays in Postgres
+type memoryStored struct {
+	TenantID string      `json:"tenant_id,omitempty"`
+	AgentID  string      `json:"agent_id"`
+	RecordID string      `json:"record_id"`
+	Version  int         `json:"version"`
+	Class    MemoryClass `json:"class"`
+}
+
+// writeStoredEvent adds the outbox row announcing record to tx
+func writeStoredEvent(ctx context.Context, tx *sqlx.Tx, record *MemoryRecord) error {
+	payload, err := json.Marshal(memoryStored{
+		TenantID: record.TenantID,
+		AgentID:  record.AgentID,
+		RecordID: record.ID,
+		Version:  record.Version,
+		Class:    record.Class,
+	})
+	if err != nil {
+		return fmt.Errorf("event serialization failed: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO outbox (subject, payload) VALUES ($1, $2)`, MemoryStoredSubject, payload); err != nil {
+		return fmt.Errorf("outbox write failed: %w", err)
+	}
+	return nil
+}
+
+// seal compresses and encrypts plaintext under the active key, returning the
+// key ID, cipher name and nonce-prefixed ciphertext
+func (m *MemoryAdapter) seal(ctx context.Context, plaintext []byte) (string, string, []byte, error) {
+	compressed := m.encoder.EncodeAll(plaintext, make([]byte, 0, len(plaintext)))
+
+	keyID, aead, err := m.sealingAEAD(ctx)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", nil, fmt.Errorf("nonce generation failed: %w", err)
+	}
+	return keyID, m.sealingCipher(), aead.Seal(nonce, nonce, compressed, nil), nil
 }
 
 // RetrieveMemory fetches and decrypts memory records
@@ -184,41 +436,68 @@ func (m *MemoryAdapter) RetrieveMemory(ctx context.Context, agentID string, vers
 	}()
 
 	var record MemoryRecord
-	if cached, ok := m.cache.Get(agentID); ok {
-		record = cached.(MemoryRecord)
+	if cached, ok := m.lookupCached(ctx, agentID, version); ok {
+		record = cached
 	} else {
 		err := m.db.GetContext(ctx, &record,
 			`SELECT * FROM memories 
 			 WHERE agent_id = \$1 AND version = \$2
 			 ORDER BY created_at DESC 
 			 LIMIT 1`, agentID, version)
+		if errors.Is(err, sql.ErrNoRows) {
+			// a fork reads what it has not rewritten from its parent
+			record, err = m.inheritedRecord(ctx, agentID, version)
+		}
 		if err != nil {
 			memOpsCounter.WithLabelValues("retrieve", "error").Inc()
 			return nil, fmt.Errorf("query failed: %w", err)
 		}
-		m.cache.Set(record.ID, record)
+		m.cacheRecord(ctx, record)
 	}
 
-	nonceSize := m.aead.NonceSize()
-	if len(record.Data) < nonceSize {
+	decompressed, err := m.openRecord(ctx, record)
+	if err != nil {
 		memOpsCounter.WithLabelValues("retrieve", "error").Inc()
+		return nil, err
+	}
+	m.reencryptIfStale(ctx, record, decompressed)
+
+	memOpsCounter.WithLabelValues("retrieve", "success").Inc()
+	return decompressed, nil
+}
+
+// openRecord decrypts and decompresses a stored record's payload
+func (m *MemoryAdapter) openRecord(ctx context.Context, record MemoryRecord) ([]byte, error) {
+	if record.KeyID == dedupKeyID {
+		var err error
+		if record, err = m.resolveBlob(ctx, record); err != nil {
+			return nil, err
+		}
+	}
+
+	aead, err := m.openingAEAD(ctx, record.KeyID, record.Cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(record.Data) < nonceSize {
 		return nil, fmt.Errorf("invalid ciphertext length")
 	}
 
 	nonce, ciphertext := record.Data[:nonceSize], record.Data[nonceSize:]
-	compressed, err := m.aead.Open(nil, nonce, ciphertext, nil)
+	compressed, err := aead.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		memOpsCounter.WithLabelValues("retrieve", "error").Inc()
 		return nil, fmt.Errorf("decryption failed: %w", err)
 	}
 
 	decompressed, err := m.decoder.DecodeAll(compressed, nil)
 	if err != nil {
-		memOpsCounter.WithLabelValues("retrieve", "error").Inc()
 		return nil, fmt.Errorf("decompression failed: %w", err)
 	}
-
-	memOpsCounter.WithLabelValues("retrieve", "success").Inc()
+	if record.Storage == storageObject {
+		return m.fetchObject(ctx, decompressed)
+	}
 	return decompressed, nil
 }
 
@@ -226,14 +505,149 @@ func (m *MemoryAdapter) RetrieveMemory(ctx context.Context, agentID string, vers
 /*
 CREATE TABLE IF NOT EXISTS memories (
     id          UUID PRIMARY KEY,
+    tenant_id   VARCHAR(255) NOT NULL DEFAULT 'default',
     agent_id    VARCHAR(255) NOT NULL,
     version     INTEGER NOT NULL,
     data        BYTEA NOT NULL,
     metadata    JSONB NOT NULL,
+    key_id      VARCHAR(128) NOT NULL DEFAULT 'initial',
+    cipher      VARCHAR(32) NOT NULL DEFAULT 'chacha20-poly1305',
+    class       VARCHAR(16) NOT NULL DEFAULT 'episodic',
+    consolidated_at TIMESTAMP WITH TIME ZONE,
+    content_hash BYTEA,
+    storage     VARCHAR(16) NOT NULL DEFAULT 'inline',
     created_at  TIMESTAMP WITH TIME ZONE NOT NULL,
-    expires_at  TIMESTAMP WITH TIME ZONE NOT NULL
+    expires_at  TIMESTAMP WITH TIME ZONE -- NULL while pinned by a snapshot
 );
 
-CREATE INDEX idx_agent_version ON memories (agent_id, version);
+CREATE UNIQUE INDEX idx_agent_version ON memories (agent_id, version);
 CREATE INDEX idx_expiration ON memories (expires_at);
+CREATE INDEX idx_unconsolidated ON memories (agent_id, created_at)
+    WHERE class = 'episodic' AND consolidated_at IS NULL;
+CREATE INDEX idx_metadata ON memories USING GIN (metadata jsonb_path_ops);
+CREATE INDEX idx_agent_created ON memories (agent_id, created_at, version);
+
+CREATE TABLE IF NOT EXISTS memory_blobs (
+    agent_id     VARCHAR(255) NOT NULL,
+    content_hash BYTEA NOT NULL,
+    data         BYTEA NOT NULL,
+    key_id       VARCHAR(128) NOT NULL,
+    cipher       VARCHAR(32) NOT NULL,
+    refcount     INTEGER NOT NULL,
+    PRIMARY KEY (agent_id, content_hash)
+);
+
+CREATE TABLE IF NOT EXISTS tenant_keys (
+    key_id       UUID PRIMARY KEY,
+    tenant_id    VARCHAR(255) NOT NULL,
+    wrapped_dek  BYTEA,
+    state        VARCHAR(16) NOT NULL, -- pending, active, retired or destroyed
+    created_at   TIMESTAMP WITH TIME ZONE NOT NULL,
+    retired_at   TIMESTAMP WITH TIME ZONE,
+    destroyed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX idx_tenant_active_key ON tenant_keys (tenant_id) WHERE state = 'active';
+
+CREATE TABLE IF NOT EXISTS memory_provenance (
+    summary_id        UUID NOT NULL,
+    source_id         UUID NOT NULL,
+    source_version    INTEGER NOT NULL,
+    source_sha256     BYTEA NOT NULL,
+    source_created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (summary_id, source_id)
+);
+
+CREATE TABLE IF NOT EXISTS memory_namespaces (
+    tenant_id   VARCHAR(255) NOT NULL,
+    namespace   VARCHAR(255) NOT NULL,
+    created_by  VARCHAR(255) NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (tenant_id, namespace)
+);
+
+CREATE TABLE IF NOT EXISTS memory_namespace_members (
+    tenant_id   VARCHAR(255) NOT NULL,
+    namespace   VARCHAR(255) NOT NULL,
+    agent_id    VARCHAR(255) NOT NULL,
+    role        SMALLINT NOT NULL,
+    PRIMARY KEY (tenant_id, namespace, agent_id),
+    FOREIGN KEY (tenant_id, namespace) REFERENCES memory_namespaces ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS memory_namespace_entries (
+    seq             BIGSERIAL PRIMARY KEY,
+    tenant_id       VARCHAR(255) NOT NULL,
+    namespace       VARCHAR(255) NOT NULL,
+    author_agent_id VARCHAR(255) NOT NULL,
+    data            BYTEA NOT NULL,
+    metadata        JSONB NOT NULL,
+    key_id          VARCHAR(128) NOT NULL,
+    cipher          VARCHAR(32) NOT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at      TIMESTAMP WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (tenant_id, namespace) REFERENCES memory_namespaces ON DELETE CASCADE
+);
+
+CREATE INDEX idx_namespace_seq ON memory_namespace_entries (tenant_id, namespace, seq);
+CREATE INDEX idx_namespace_expiry ON memory_namespace_entries (expires_at);
+
+CREATE TABLE IF NOT EXISTS memory_snapshots (
+    id          UUID PRIMARY KEY,
+    tenant_id   VARCHAR(255) NOT NULL,
+    agent_id    VARCHAR(255) NOT NULL,
+    name        VARCHAR(255) NOT NULL,
+    version     INTEGER NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_snapshot_agent ON memory_snapshots (agent_id, created_at);
+
+CREATE TABLE IF NOT EXISTS memory_snapshot_members (
+    snapshot_id UUID NOT NULL REFERENCES memory_snapshots ON DELETE CASCADE,
+    memory_id   UUID NOT NULL REFERENCES memories ON DELETE CASCADE,
+    PRIMARY KEY (snapshot_id, memory_id)
+);
+
+CREATE INDEX idx_snapshot_member_memory ON memory_snapshot_members (memory_id);
+
+CREATE TABLE IF NOT EXISTS memory_forks (
+    agent_id        VARCHAR(255) PRIMARY KEY,
+    tenant_id       VARCHAR(255) NOT NULL,
+    parent_agent_id VARCHAR(255) NOT NULL,
+    snapshot_id     UUID NOT NULL REFERENCES memory_snapshots ON DELETE RESTRICT,
+    version         INTEGER NOT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_fork_parent ON memory_forks (parent_agent_id);
+
+CREATE TABLE IF NOT EXISTS memories_archive (
+    LIKE memories INCLUDING DEFAULTS,
+    archived_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS working_dead_letters (
+    id          BIGSERIAL PRIMARY KEY,
+    tenant_id   VARCHAR(255) NOT NULL,
+    agent_id    VARCHAR(255) NOT NULL,
+    subject_id  VARCHAR(255) NOT NULL DEFAULT '',
+    item        BYTEA NOT NULL,
+    error       TEXT NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_working_dead_letters_subject ON working_dead_letters (tenant_id, subject_id);
+
+CREATE TABLE IF NOT EXISTS agent_checkpoints (
+    agent_id    VARCHAR(255) NOT NULL,
+    task_id     VARCHAR(64) NOT NULL,
+    seq         BIGINT NOT NULL,
+    tenant_id   VARCHAR(255) NOT NULL,
+    data        BYTEA NOT NULL,
+    key_id      VARCHAR(128) NOT NULL,
+    cipher      VARCHAR(32) NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (agent_id, task_id, seq)
+);
 */
@@ -0,0 +1,353 @@
+// core/memory/memory_archive.go
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	archiveMagic         = "NZMEMARC"
+	archiveFormatVersion = 1
+	archiveChunkSize     = 1 << 20
+	maxArchiveFrame      = archiveChunkSize + 4096
+)
+
+// Archive frame types
+const (
+	frameManifest byte = iota + 1
+	frameRecord
+	frameChunk
+	frameEnd
+)
+
+var ErrArchiveCorrupt = errors.New("memory archive corrupt or tampered")
+
+// ArchiveManifest describes the contents of an exported memory archive
+type ArchiveManifest struct {
+	FormatVersion int       `json:"format_version"`
+	AgentID       string    `json:"agent_id"`
+	ExportedAt    time.Time `json:"exported_at"`
+	Records       int       `json:"records"`
+	ChunkSize     int       `json:"chunk_size"`
+}
+
+type archiveRecordHeader struct {
+	Version   int             `json:"version"`
+	Class     MemoryClass     `json:"class"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	Size      int             `json:"size"`
+	SHA256    []byte          `json:"sha256"`
+}
+
+// ImportResult summarizes an ImportAgentMemory call
+type ImportResult struct {
+	Manifest ArchiveManifest
+	Imported int
+}
+
+// archiveStream seals or opens sequential frames. Each frame's AAD binds its
+// position, so reordered frames fail to open; a missing end frame reveals
+// truncation.
+type archiveStream struct {
+	aead cipher.AEAD
+	seq  uint64
+}
+
+func (s *archiveStream) aad() []byte {
+	return binary.BigEndian.AppendUint64([]byte(archiveMagic), s.seq)
+}
+
+func (s *archiveStream) writeFrame(w io.Writer, kind byte, body []byte) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("nonce generation failed: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, append([]byte{kind}, body...), s.aad())
+	s.seq++
+
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(sealed)))
+	if _, err := w.Write(n[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(sealed)
+	return err
+}
+
+func (s *archiveStream) readFrame(r io.Reader) (byte, []byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrArchiveCorrupt, err)
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	ns := s.aead.NonceSize()
+	if size > maxArchiveFrame || int(size) < ns+s.aead.Overhead()+1 {
+		return 0, nil, fmt.Errorf("%w: invalid frame length", ErrArchiveCorrupt)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(r, sealed); err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrArchiveCorrupt, err)
+	}
+
+	plain, err := s.aead.Open(nil, sealed[:ns], sealed[ns:], s.aad())
+	if err != nil {
+		return 0, nil, ErrArchiveCorrupt
+	}
+	s.seq++
+	return plain[0], plain[1:], nil
+}
+
+// ExportAgentMemory writes every live memory of agentID to w as an archive
+// encrypted under archiveKey. Records are decrypted with this environment's
+// keys and re-sealed, so the archive can be imported anywhere the archive
+// key is known.
+func (m *MemoryAdapter) ExportAgentMemory(ctx context.Context, agentID string, w io.Writer, archiveKey [32]byte) (ArchiveManifest, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("export").Observe(time.Since(start).Seconds())
+	}()
+
+	var versions []int
+	if err := m.db.SelectContext(ctx, &versions,
+		`SELECT version FROM memories
+		 WHERE agent_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		 ORDER BY version`, agentID); err != nil {
+		memOpsCounter.WithLabelValues("export", "error").Inc()
+		return ArchiveManifest{}, fmt.Errorf("query failed: %w", err)
+	}
+
+	cipherName := m.sealingCipher()
+	aead, err := newMemoryAEAD(cipherName, archiveKey[:])
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	stream := &archiveStream{aead: aead}
+
+	bw := bufio.NewWriter(w)
+	header := append([]byte(archiveMagic), byte(len(cipherName)))
+	if _, err := bw.Write(append(header, cipherName...)); err != nil {
+		return ArchiveManifest{}, fmt.Errorf("archive write failed: %w", err)
+	}
+
+	manifest := ArchiveManifest{
+		FormatVersion: archiveFormatVersion,
+		AgentID:       agentID,
+		ExportedAt:    time.Now().UTC(),
+		Records:       len(versions),
+		ChunkSize:     archiveChunkSize,
+	}
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("manifest encoding failed: %w", err)
+	}
+	if err := stream.writeFrame(bw, frameManifest, body); err != nil {
+		return ArchiveManifest{}, fmt.Errorf("archive write failed: %w", err)
+	}
+
+	// Records are loaded one at a time to bound memory use
+	for _, version := range versions {
+		var record MemoryRecord
+		if err := m.db.GetContext(ctx, &record,
+			`SELECT * FROM memories WHERE agent_id = $1 AND version = $2`, agentID, version); err != nil {
+			memOpsCounter.WithLabelValues("export", "error").Inc()
+			return ArchiveManifest{}, fmt.Errorf("version %d: query failed: %w", version, err)
+		}
+		plaintext, err := m.openRecord(ctx, record)
+		if err != nil {
+			memOpsCounter.WithLabelValues("export", "error").Inc()
+			return ArchiveManifest{}, fmt.Errorf("version %d: %w", version, err)
+		}
+
+		sum := sha256.Sum256(plaintext)
+		hdr, err := json.Marshal(archiveRecordHeader{
+			Version:   record.Version,
+			Class:     record.Class,
+			Metadata:  record.Metadata,
+			CreatedAt: record.CreatedAt,
+			ExpiresAt: record.expiry(),
+			Size:      len(plaintext),
+			SHA256:    sum[:],
+		})
+		if err != nil {
+			return ArchiveManifest{}, fmt.Errorf("record header encoding failed: %w", err)
+		}
+		if err := stream.writeFrame(bw, frameRecord, hdr); err != nil {
+			return ArchiveManifest{}, fmt.Errorf("archive write failed: %w", err)
+		}
+		for off := 0; off < len(plaintext); off += archiveChunkSize {
+			end := min(off+archiveChunkSize, len(plaintext))
+			if err := stream.writeFrame(bw, frameChunk, plaintext[off:end]); err != nil {
+				return ArchiveManifest{}, fmt.Errorf("archive write failed: %w", err)
+			}
+		}
+		clear(plaintext)
+	}
+
+	if err := stream.writeFrame(bw, frameEnd, nil); err != nil {
+		return ArchiveManifest{}, fmt.Errorf("archive write failed: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return ArchiveManifest{}, fmt.Errorf("archive write failed: %w", err)
+	}
+	memOpsCounter.WithLabelValues("export", "success").Inc()
+	return manifest, nil
+}
+
+// ImportAgentMemory restores an archive produced by ExportAgentMemory.
+// Records are re-sealed with this environment's active key and appended
+// after any existing versions of targetAgentID (the archived agent ID when
+// empty) in a single transaction; relative version order is preserved.
+func (m *MemoryAdapter) ImportAgentMemory(ctx context.Context, r io.Reader, archiveKey [32]byte, targetAgentID string) (ImportResult, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("import").Observe(time.Since(start).Seconds())
+	}()
+
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(archiveMagic)+1)
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic[:len(archiveMagic)]) != archiveMagic {
+		return ImportResult{}, fmt.Errorf("%w: bad header", ErrArchiveCorrupt)
+	}
+	cipherName := make([]byte, magic[len(archiveMagic)])
+	if _, err := io.ReadFull(br, cipherName); err != nil {
+		return ImportResult{}, fmt.Errorf("%w: bad header", ErrArchiveCorrupt)
+	}
+	aead, err := newMemoryAEAD(string(cipherName), archiveKey[:])
+	if err != nil {
+		return ImportResult{}, err
+	}
+	stream := &archiveStream{aead: aead}
+
+	kind, body, err := stream.readFrame(br)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	var result ImportResult
+	if kind != frameManifest || json.Unmarshal(body, &result.Manifest) != nil {
+		return ImportResult{}, fmt.Errorf("%w: missing manifest", ErrArchiveCorrupt)
+	}
+	if result.Manifest.FormatVersion != archiveFormatVersion {
+		return ImportResult{}, fmt.Errorf("unsupported archive format version %d", result.Manifest.FormatVersion)
+	}
+	if targetAgentID == "" {
+		targetAgentID = result.Manifest.AgentID
+	}
+
+	tx, err := m.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var base int
+	if err := tx.GetContext(ctx, &base,
+		`SELECT COALESCE(MAX(version),0) FROM memories WHERE agent_id = $1`, targetAgentID); err != nil {
+		return ImportResult{}, fmt.Errorf("versioning failed: %w", err)
+	}
+
+	var size int
+	var hdr *archiveRecordHeader
+	var payload bytes.Buffer
+	flush := func() error {
+		if hdr == nil {
+			return nil
+		}
+		raw := payload.Bytes()
+		if sum := sha256.Sum256(raw); len(raw) != hdr.Size || !bytes.Equal(sum[:], hdr.SHA256) {
+			return fmt.Errorf("%w: record %d checksum mismatch", ErrArchiveCorrupt, hdr.Version)
+		}
+		// archives may come from a deployment that did not screen, or
+		// screened with other classifiers
+		plaintext, metadata, err := m.screenPII(ctx, raw, hdr.Metadata)
+		if err != nil {
+			return err
+		}
+		keyID, cipher, sealed, err := m.seal(ctx, plaintext)
+		if err != nil {
+			return err
+		}
+		result.Imported++
+		record := MemoryRecord{
+			ID:        generateUUID(),
+			TenantID:  TenantFromContext(ctx),
+			AgentID:   targetAgentID,
+			Version:   base + result.Imported,
+			Data:      sealed,
+			Metadata:  metadata,
+			KeyID:     keyID,
+			Cipher:    cipher,
+			Class:     hdr.Class,
+			CreatedAt: hdr.CreatedAt,
+			ExpiresAt: sql.NullTime{Time: hdr.ExpiresAt, Valid: true},
+		}
+		if _, err := tx.NamedExecContext(ctx,
+			`INSERT INTO memories
+			 (id, tenant_id, agent_id, version, data, metadata, key_id, cipher, class, created_at, expires_at)
+			 VALUES
+			 (:id, :tenant_id, :agent_id, :version, :data, :metadata, :key_id, :cipher, :class, :created_at, :expires_at)`,
+			record); err != nil {
+			return fmt.Errorf("insert failed: %w", err)
+		}
+		size += len(sealed)
+		clear(plaintext)
+		payload.Reset()
+		hdr = nil
+		return nil
+	}
+
+	for {
+		kind, body, err := stream.readFrame(br)
+		if err != nil {
+			memOpsCounter.WithLabelValues("import", "error").Inc()
+			return ImportResult{}, err
+		}
+		switch kind {
+		case frameRecord:
+			if err := flush(); err != nil {
+				memOpsCounter.WithLabelValues("import", "error").Inc()
+				return ImportResult{}, err
+			}
+			hdr = new(archiveRecordHeader)
+			if err := json.Unmarshal(body, hdr); err != nil {
+				return ImportResult{}, fmt.Errorf("%w: bad record header", ErrArchiveCorrupt)
+			}
+		case frameChunk:
+			if hdr == nil || payload.Len()+len(body) > hdr.Size {
+				return ImportResult{}, fmt.Errorf("%w: unexpected chunk", ErrArchiveCorrupt)
+			}
+			payload.Write(body)
+		case frameEnd:
+			if err := flush(); err != nil {
+				memOpsCounter.WithLabelValues("import", "error").Inc()
+				return ImportResult{}, err
+			}
+			if result.Imported != result.Manifest.Records {
+				return ImportResult{}, fmt.Errorf("%w: manifest lists %d records, archive holds %d",
+					ErrArchiveCorrupt, result.Manifest.Records, result.Imported)
+			}
+			if err := tx.Commit(); err != nil {
+				memOpsCounter.WithLabelValues("import", "error").Inc()
+				return ImportResult{}, fmt.Errorf("commit failed: %w", err)
+			}
+			memSizeGauge.WithLabelValues(targetAgentID).Add(float64(size))
+			memOpsCounter.WithLabelValues("import", "success").Inc()
+			return result, nil
+		default:
+			return ImportResult{}, fmt.Errorf("%w: unknown frame type %d", ErrArchiveCorrupt, kind)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// core/memory/memory_batch.go
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// maxBatchInsertRows keeps multi-row INSERTs under Postgres' 65535 bind parameter limit
+const maxBatchInsertRows = 1000
+
+// BatchResult reports the outcome of one item in a StoreMemoryBatch call;
+// exactly one of ID or Err is set
+type BatchResult struct {
+	ID      string
+	Version int
+	Err     error
+}
+
+// StoreMemoryBatch serializes, compresses and encrypts items concurrently,
+// then inserts every item that sealed successfully in a single transaction.
+// Results are positionally aligned with items. The returned error is non-nil
+// only when the transaction itself fails, in which case nothing was stored;
+// a *VersionConflictError means a concurrent writer won and the batch may be
+// retried.
+func (m *MemoryAdapter) StoreMemoryBatch(ctx context.Context, agentID string, items []any) ([]BatchResult, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("store_batch").Observe(time.Since(start).Seconds())
+	}()
+
+	results := make([]BatchResult, len(items))
+	records := make([]*MemoryRecord, len(items))
+	plaintexts := make([][]byte, len(items))
+
+	workers := runtime.GOMAXPROCS(0)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				plaintext, err := json.Marshal(items[i])
+				if err != nil {
+					results[i].Err = fmt.Errorf("serialization failed: %w", err)
+					continue
+				}
+				plaintext, metadata, err := m.screenPII(ctx, plaintext, []byte(`{"source":"batch_input"}`))
+				if err != nil {
+					results[i].Err = err
+					continue
+				}
+				if metadata, err = tagSubject(ctx, metadata); err != nil {
+					results[i].Err = err
+					continue
+				}
+				keyID, cipherName, sealed, err := m.seal(ctx, plaintext)
+				if err != nil {
+					results[i].Err = err
+					continue
+				}
+				now := time.Now().UTC()
+				plaintexts[i] = plaintext
+				records[i] = &MemoryRecord{
+					ID:        generateUUID(),
+					TenantID:  TenantFromContext(ctx),
+					AgentID:   agentID,
+					Data:      sealed,
+					Metadata:  metadata,
+					KeyID:     keyID,
+					Cipher:    cipherName,
+					Class:     ClassEpisodic,
+					CreatedAt: now,
+					ExpiresAt: sql.NullTime{Time: now.Add(recordTTL), Valid: true},
+				}
+			}
+		}()
+	}
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var sealed []MemoryRecord
+	var positions []int
+	for i, r := range records {
+		if r != nil {
+			sealed = append(sealed, *r)
+			positions = append(positions, i)
+		} else {
+			memOpsCounter.WithLabelValues("store", "error").Inc()
+		}
+	}
+	if len(sealed) == 0 {
+		return results, nil
+	}
+
+	tx, err := m.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		memOpsCounter.WithLabelValues("store_batch", "error").Inc()
+		return nil, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var base int
+	// forks continue numbering from the version they branched at
+	if err := tx.GetContext(ctx, &base,
+		`SELECT GREATEST(COALESCE(MAX(version), 0), `+forkVersion+`)
+		 FROM memories
+		 WHERE agent_id = $1`, agentID); err != nil {
+		memOpsCounter.WithLabelValues("store_batch", "error").Inc()
+		return nil, fmt.Errorf("versioning failed: %w", err)
+	}
+	var size int
+	for i := range sealed {
+		sealed[i].Version = base + i + 1
+		written := len(sealed[i].Data)
+		if m.config.Dedup {
+			hash, err := m.contentHash(ctx, agentID, sealed[i].KeyID, plaintexts[positions[i]])
+			if err != nil {
+				memOpsCounter.WithLabelValues("store_batch", "error").Inc()
+				return nil, err
+			}
+			if written, err = m.attachBlob(ctx, tx, &sealed[i], hash); err != nil {
+				memOpsCounter.WithLabelValues("store_batch", "error").Inc()
+				return nil, err
+			}
+		}
+		size += written
+	}
+
+	for lo := 0; lo < len(sealed); lo += maxBatchInsertRows {
+		hi := min(lo+maxBatchInsertRows, len(sealed))
+		if _, err := tx.NamedExecContext(ctx,
+			`INSERT INTO memories
+			 (id, tenant_id, agent_id, version, data, metadata, key_id, cipher, class, content_hash, created_at, expires_at)
+			 VALUES
+			 (:id, :tenant_id, :agent_id, :version, :data, :metadata, :key_id, :cipher, :class, :content_hash, :created_at, :expires_at)`,
+			sealed[lo:hi]); err != nil {
+			memOpsCounter.WithLabelValues("store_batch", "error").Inc()
+			if isVersionRace(err) {
+				return nil, &VersionConflictError{AgentID: agentID, Expected: base, Current: base}
+			}
+			return nil, fmt.Errorf("batch insert failed: %w", err)
+		}
+	}
+	if m.config.PublishEvents {
+		for i := range sealed {
+			if err := writeStoredEvent(ctx, tx, &sealed[i]); err != nil {
+				memOpsCounter.WithLabelValues("store_batch", "error").Inc()
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		memOpsCounter.WithLabelValues("store_batch", "error").Inc()
+		if isVersionRace(err) {
+			return nil, &VersionConflictError{AgentID: agentID, Expected: base, Current: base}
+		}
+		return nil, fmt.Errorf("commit failed: %w", err)
+	}
+
+	for j, record := range sealed {
+		i := positions[j]
+		results[i] = BatchResult{ID: record.ID, Version: record.Version}
+		m.cacheRecord(ctx, record)
+		m.indexMemory(ctx, record, plaintexts[i])
+		memOpsCounter.WithLabelValues("store", "success").Inc()
+	}
+	memSizeGauge.WithLabelValues(agentID).Add(float64(size))
+	memOpsCounter.WithLabelValues("store_batch", "success").Inc()
+	return results, nil
+}
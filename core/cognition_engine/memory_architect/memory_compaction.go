@@ -0,0 +1,265 @@
+// core/memory/memory_compaction.go
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCompactionInterval = time.Hour
+	defaultCompactionMinAge   = 7 * 24 * time.Hour
+	defaultCompactionSalience = 0.3
+	defaultCompactionGroup    = 50
+	defaultCompactionAgents   = 100
+)
+
+const defaultCompactionPrompt = `You are compacting an AI agent's long-term memory.
+Condense the following memories into a short factual summary that preserves
+names, decisions, outcomes and any commitments. Omit small talk and repetition.
+
+`
+
+// LLMProvider is the completion interface the compaction pipeline calls
+type LLMProvider interface {
+	Complete(ctx context.Context, prompt string) (string, error)
+}
+
+// CompactionConfig controls MemGPT-style paging of stale memories into
+// condensed summaries. A record's salience is the "importance" value in its
+// metadata, defaulting to 0.5 when absent.
+type CompactionConfig struct {
+	Provider    LLMProvider
+	Interval    time.Duration
+	MinAge      time.Duration
+	MaxSalience float64
+	GroupSize   int
+	Prompt      string
+}
+
+func (c CompactionConfig) withDefaults() CompactionConfig {
+	if c.Interval <= 0 {
+		c.Interval = defaultCompactionInterval
+	}
+	if c.MinAge <= 0 {
+		c.MinAge = defaultCompactionMinAge
+	}
+	if c.MaxSalience <= 0 {
+		c.MaxSalience = defaultCompactionSalience
+	}
+	if c.GroupSize <= 1 {
+		c.GroupSize = defaultCompactionGroup
+	}
+	if c.Prompt == "" {
+		c.Prompt = defaultCompactionPrompt
+	}
+	return c
+}
+
+// CompactionResult summarizes one agent's compaction pass
+type CompactionResult struct {
+	SummaryID      string
+	Compacted      int
+	ReclaimedBytes int64
+}
+
+// compactionFilter selects old, low-salience episodic records given the
+// placeholder positions of the age cutoff and salience ceiling. A missing
+// or non-numeric importance counts as 0.5 rather than failing the cast.
+func compactionFilter(cutoffArg, salienceArg int) string {
+	return fmt.Sprintf(`class = 'episodic'
+		   AND created_at < $%d
+		   AND expires_at > NOW()
+		   AND CASE WHEN jsonb_typeof(metadata->'importance') = 'number'
+		            THEN (metadata->>'importance')::float ELSE 0.5 END < $%d
+		   AND `+notPinned, cutoffArg, salienceArg)
+}
+
+// RunCompaction compacts every eligible agent each interval until ctx ends
+func (m *MemoryAdapter) RunCompaction(ctx context.Context) {
+	cfg := m.config.Compaction.withDefaults()
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			var agents []string
+			if err := m.db.SelectContext(ctx, &agents,
+				`SELECT DISTINCT agent_id FROM memories
+				 WHERE `+compactionFilter(1, 2)+`
+				 LIMIT $3`, time.Now().Add(-cfg.MinAge), cfg.MaxSalience, defaultCompactionAgents); err != nil {
+				slog.Error("memory compaction scan failed", "error", err)
+				continue
+			}
+			for _, agentID := range agents {
+				res, err := m.CompactAgent(ctx, agentID)
+				if err != nil {
+					slog.Error("memory compaction failed", "agent_id", agentID, "error", err)
+					continue
+				}
+				if res.Compacted > 0 {
+					slog.Info("memory compaction completed", "agent_id", agentID,
+						"records", res.Compacted, "reclaimed_bytes", res.ReclaimedBytes)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CompactAgent replaces up to GroupSize of agentID's oldest low-salience
+// memories with a single LLM-written summary. The originals are deleted in
+// the same transaction and recorded in memory_provenance with their content
+// digests, so the summary stays traceable to what it replaced.
+func (m *MemoryAdapter) CompactAgent(ctx context.Context, agentID string) (CompactionResult, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("compact").Observe(time.Since(start).Seconds())
+	}()
+
+	cfg := m.config.Compaction.withDefaults()
+	if cfg.Provider == nil {
+		return CompactionResult{}, fmt.Errorf("memory compaction not configured")
+	}
+
+	var originals []MemoryRecord
+	if err := m.db.SelectContext(ctx, &originals,
+		`SELECT * FROM memories
+		 WHERE agent_id = $1 AND `+compactionFilter(2, 3)+`
+		 ORDER BY created_at
+		 LIMIT $4`, agentID, time.Now().Add(-cfg.MinAge), cfg.MaxSalience, cfg.GroupSize); err != nil {
+		memOpsCounter.WithLabelValues("compact", "error").Inc()
+		return CompactionResult{}, fmt.Errorf("candidate query failed: %w", err)
+	}
+	if len(originals) < 2 {
+		return CompactionResult{}, nil
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString(cfg.Prompt)
+	digests := make([][]byte, len(originals))
+	for i, rec := range originals {
+		data, err := m.openRecord(ctx, rec)
+		if err != nil {
+			memOpsCounter.WithLabelValues("compact", "error").Inc()
+			return CompactionResult{}, fmt.Errorf("memory %s: %w", rec.ID, err)
+		}
+		sum := sha256.Sum256(data)
+		digests[i] = sum[:]
+		fmt.Fprintf(&prompt, "[%s] %s\n", rec.CreatedAt.Format(time.RFC3339), data)
+		clear(data)
+	}
+
+	summary, err := cfg.Provider.Complete(ctx, prompt.String())
+	if err != nil {
+		memOpsCounter.WithLabelValues("compact", "error").Inc()
+		return CompactionResult{}, fmt.Errorf("summarization failed: %w", err)
+	}
+	plaintext, err := json.Marshal(summary)
+	if err != nil {
+		return CompactionResult{}, fmt.Errorf("serialization failed: %w", err)
+	}
+	meta := map[string]any{
+		"source":    "compaction",
+		"compacted": len(originals),
+		"from":      originals[0].CreatedAt,
+		"to":        originals[len(originals)-1].CreatedAt,
+	}
+	tagSubjects(meta, subjectsOf(originals))
+	metadata, err := json.Marshal(meta)
+	if err != nil {
+		return CompactionResult{}, fmt.Errorf("serialization failed: %w", err)
+	}
+
+	summaryRec, plaintext, err := m.newRecord(withoutSubject(ctx), agentID, plaintext, ClassSemantic, metadata)
+	if err != nil {
+		memOpsCounter.WithLabelValues("compact", "error").Inc()
+		return CompactionResult{}, err
+	}
+	// an offloaded summary is orphaned unless the compaction commits
+	committed := false
+	defer func() {
+		if !committed {
+			m.discardRecord(ctx, summaryRec)
+		}
+	}()
+
+	tx, err := m.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return CompactionResult{}, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	written, err := m.insertRecord(ctx, tx, &summaryRec, plaintext, anyVersion)
+	if err != nil {
+		memOpsCounter.WithLabelValues("compact", "error").Inc()
+		return CompactionResult{}, err
+	}
+
+	var reclaimed int64
+	var refs []blobRef
+	for i, rec := range originals {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO memory_provenance
+			 (summary_id, source_id, source_version, source_sha256, source_created_at)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			summaryRec.ID, rec.ID, rec.Version, digests[i], rec.CreatedAt); err != nil {
+			memOpsCounter.WithLabelValues("compact", "error").Inc()
+			return CompactionResult{}, fmt.Errorf("provenance insert failed: %w", err)
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM memories WHERE id = $1`, rec.ID)
+		if err != nil {
+			memOpsCounter.WithLabelValues("compact", "error").Inc()
+			return CompactionResult{}, fmt.Errorf("original delete failed: %w", err)
+		}
+		// A concurrent GC or erasure may already have removed the record
+		if n, _ := res.RowsAffected(); n == 0 {
+			return CompactionResult{}, fmt.Errorf("memory %s changed during compaction", rec.ID)
+		}
+		reclaimed += int64(len(rec.Data))
+		if rec.ContentHash != nil {
+			refs = append(refs, blobRef{AgentID: rec.AgentID, ContentHash: rec.ContentHash})
+		}
+	}
+	blobs, err := releaseBlobs(ctx, tx, refs)
+	if err != nil {
+		memOpsCounter.WithLabelValues("compact", "error").Inc()
+		return CompactionResult{}, err
+	}
+	for _, size := range blobs {
+		reclaimed += size
+	}
+
+	if err := tx.Commit(); err != nil {
+		memOpsCounter.WithLabelValues("compact", "error").Inc()
+		return CompactionResult{}, fmt.Errorf("commit failed: %w", err)
+	}
+	committed = true
+
+	var objects []string
+	for _, rec := range originals {
+		m.invalidate(ctx, rec.AgentID, rec.Version)
+		if rec.Storage == storageObject {
+			objects = append(objects, rec.ID)
+		}
+	}
+	m.deleteObjects(ctx, objects)
+	m.cacheRecord(ctx, summaryRec)
+	m.indexMemory(ctx, summaryRec, plaintext)
+	memSizeGauge.WithLabelValues(agentID).Add(float64(int64(written) - reclaimed))
+	memGCReclaimedBytes.Add(float64(reclaimed))
+	memOpsCounter.WithLabelValues("compact", "success").Inc()
+	return CompactionResult{
+		SummaryID:      summaryRec.ID,
+		Compacted:      len(originals),
+		ReclaimedBytes: reclaimed,
+	}, nil
+}
@@ -0,0 +1,116 @@
+// core/memory/memory_dedup.go
+package memory
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// dedupKeyID marks records whose ciphertext lives in memory_blobs
+const dedupKeyID = "dedup"
+
+// contentHash identifies identical payloads for one agent. It is keyed
+// by the data key the payload was sealed under, the tenant's own key when
+// a keyring is configured, so the stored hash cannot be used to confirm
+// guesses about memory contents; payloads only deduplicate within a key.
+func (m *MemoryAdapter) contentHash(ctx context.Context, agentID, keyID string, plaintext []byte) ([]byte, error) {
+	key := m.config.EncryptionKey
+	if m.config.Keyring != nil && keyID != defaultKeyID {
+		k, err := m.config.Keyring.Key(ctx, keyID)
+		if err != nil {
+			return nil, fmt.Errorf("dedup key %s lookup failed: %w", keyID, err)
+		}
+		key = k
+	}
+	keySeed := sha256.Sum256(append([]byte("nuzon/memory/dedup/v1"), key[:]...))
+	clear(key[:])
+	mac := hmac.New(sha256.New, keySeed[:])
+	mac.Write([]byte(agentID))
+	mac.Write([]byte{0})
+	mac.Write(plaintext)
+	return mac.Sum(nil), nil
+}
+
+// attachBlob stores record's ciphertext in memory_blobs, or takes another
+// reference to an identical existing blob, and rewrites record to point at
+// it. It returns the bytes newly written to blob storage.
+func (m *MemoryAdapter) attachBlob(ctx context.Context, tx *sqlx.Tx, record *MemoryRecord, hash []byte) (int, error) {
+	var inserted bool
+	if err := tx.GetContext(ctx, &inserted,
+		`INSERT INTO memory_blobs (agent_id, content_hash, data, key_id, cipher, refcount)
+		 VALUES ($1, $2, $3, $4, $5, 1)
+		 ON CONFLICT (agent_id, content_hash)
+		 DO UPDATE SET refcount = memory_blobs.refcount + 1
+		 RETURNING (xmax = 0)`,
+		record.AgentID, hash, record.Data, record.KeyID, record.Cipher); err != nil {
+		return 0, fmt.Errorf("blob upsert failed: %w", err)
+	}
+
+	written := 0
+	if inserted {
+		written = len(record.Data)
+		memOpsCounter.WithLabelValues("dedup", "miss").Inc()
+	} else {
+		memOpsCounter.WithLabelValues("dedup", "hit").Inc()
+	}
+	record.ContentHash = hash
+	record.Data = []byte{}
+	record.KeyID = dedupKeyID
+	return written, nil
+}
+
+// resolveBlob replaces a deduplicated record's payload with the shared blob
+func (m *MemoryAdapter) resolveBlob(ctx context.Context, record MemoryRecord) (MemoryRecord, error) {
+	var blob struct {
+		Data   []byte `db:"data"`
+		KeyID  string `db:"key_id"`
+		Cipher string `db:"cipher"`
+	}
+	if err := m.db.GetContext(ctx, &blob,
+		`SELECT data, key_id, cipher FROM memory_blobs
+		 WHERE agent_id = $1 AND content_hash = $2`, record.AgentID, record.ContentHash); err != nil {
+		return record, fmt.Errorf("blob lookup failed: %w", err)
+	}
+	record.Data, record.KeyID, record.Cipher = blob.Data, blob.KeyID, blob.Cipher
+	return record, nil
+}
+
+type blobRef struct {
+	AgentID     string `db:"agent_id"`
+	ContentHash []byte `db:"content_hash"`
+}
+
+// releaseBlobs drops one reference per entry and deletes blobs no longer
+// referenced, returning the bytes reclaimed per agent. The decrement and
+// the delete are separate statements: a data-modifying CTE's changes are
+// invisible to the rest of its statement, so a DELETE joined on it never
+// sees the decremented row.
+func releaseBlobs(ctx context.Context, tx *sqlx.Tx, refs []blobRef) (map[string]int64, error) {
+	reclaimed := make(map[string]int64)
+	for _, ref := range refs {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE memory_blobs SET refcount = refcount - 1
+			 WHERE agent_id = $1 AND content_hash = $2`, ref.AgentID, ref.ContentHash); err != nil {
+			return nil, fmt.Errorf("blob release failed: %w", err)
+		}
+		var size int64
+		err := tx.GetContext(ctx, &size,
+			`DELETE FROM memory_blobs
+			 WHERE agent_id = $1 AND content_hash = $2 AND refcount <= 0
+			 RETURNING octet_length(data)`, ref.AgentID, ref.ContentHash)
+		if err == nil {
+			reclaimed[ref.AgentID] += size
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("blob delete failed: %w", err)
+		}
+	}
+	return reclaimed, nil
+}
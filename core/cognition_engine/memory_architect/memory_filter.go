@@ -0,0 +1,432 @@
+// core/memory/memory_filter.go
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrInvalidFilter wraps every filter parse error
+var ErrInvalidFilter = errors.New("invalid memory filter")
+
+// Filter is a parsed metadata query such as
+//
+//	source = "tool_output" AND importance > 0.7 AND created_at > "2024-01-01T00:00:00Z"
+//
+// Comparisons use = != < <= > >=, combine with AND, OR, NOT and parentheses,
+// and accept quoted strings, numbers, true and false. created_at,
+// expires_at, version and class address record columns; any other
+// identifier is a metadata key, with dots descending into nested objects.
+// Equality on metadata compiles to JSONB containment so it can use the GIN
+// index; all values are bound as parameters.
+type Filter struct {
+	root filterNode
+}
+
+// ParseFilter compiles a filter expression; an empty expression matches all
+func ParseFilter(expr string) (*Filter, error) {
+	toks, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return &Filter{}, nil
+	}
+	p := &filterParser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.toks[p.pos].text)
+	}
+	return &Filter{root: root}, nil
+}
+
+// SQL renders the filter as a WHERE fragment whose placeholders start at
+// $firstArg, returning the fragment and its arguments
+func (f *Filter) SQL(firstArg int) (string, []any) {
+	if f == nil || f.root == nil {
+		return "TRUE", nil
+	}
+	b := &sqlBuilder{next: firstArg}
+	f.root.render(b)
+	return b.sb.String(), b.args
+}
+
+// RetrievedMemory is a decrypted record returned by RetrieveMemories
+type RetrievedMemory struct {
+	ID        string
+	Version   int
+	Class     MemoryClass
+	Data      []byte
+	Metadata  []byte
+	CreatedAt time.Time
+}
+
+// RetrieveMemories returns up to limit live memories of agentID matching
+// filter, newest first
+func (m *MemoryAdapter) RetrieveMemories(ctx context.Context, agentID, filter string, limit int) ([]RetrievedMemory, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("retrieve_filtered").Observe(time.Since(start).Seconds())
+	}()
+
+	f, err := ParseFilter(filter)
+	if err != nil {
+		memOpsCounter.WithLabelValues("retrieve_filtered", "error").Inc()
+		return nil, err
+	}
+	where, args := f.SQL(3)
+
+	var records []MemoryRecord
+	if err := m.db.SelectContext(ctx, &records,
+		`SELECT * FROM memories
+		 WHERE agent_id = $1 AND (expires_at IS NULL OR expires_at > NOW()) AND (`+where+`)
+		 ORDER BY version DESC
+		 LIMIT $2`, append([]any{agentID, limit}, args...)...); err != nil {
+		memOpsCounter.WithLabelValues("retrieve_filtered", "error").Inc()
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	out := make([]RetrievedMemory, 0, len(records))
+	for _, record := range records {
+		data, err := m.openRecord(ctx, record)
+		if err != nil {
+			memOpsCounter.WithLabelValues("retrieve_filtered", "error").Inc()
+			return nil, fmt.Errorf("memory %s: %w", record.ID, err)
+		}
+		out = append(out, RetrievedMemory{
+			ID:        record.ID,
+			Version:   record.Version,
+			Class:     record.Class,
+			Data:      data,
+			Metadata:  record.Metadata,
+			CreatedAt: record.CreatedAt,
+		})
+	}
+	memOpsCounter.WithLabelValues("retrieve_filtered", "success").Inc()
+	return out, nil
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+}
+
+func lexFilter(s string) ([]filterToken, error) {
+	var toks []filterToken
+	r := []rune(s)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			toks = append(toks, filterToken{tokLParen, "("})
+			i++
+		case c == ')':
+			toks = append(toks, filterToken{tokRParen, ")"})
+			i++
+		case c == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(r) && r[j] != '"'; j++ {
+				if r[j] == '\\' && j+1 < len(r) {
+					j++
+				}
+				sb.WriteRune(r[j])
+			}
+			if j >= len(r) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			toks = append(toks, filterToken{tokString, sb.String()})
+			i = j + 1
+		case strings.ContainsRune("=!<>", c):
+			j := i + 1
+			if j < len(r) && r[j] == '=' {
+				j++
+			}
+			op := string(r[i:j])
+			if op == "!" {
+				return nil, fmt.Errorf("%w: unexpected '!'", ErrInvalidFilter)
+			}
+			toks = append(toks, filterToken{tokOp, op})
+			i = j
+		case c == '-' || c == '.' || unicode.IsDigit(c):
+			j := i + 1
+			for j < len(r) && (unicode.IsDigit(r[j]) || r[j] == '.' || r[j] == 'e' || r[j] == 'E' || r[j] == '-' || r[j] == '+') {
+				j++
+			}
+			if _, err := strconv.ParseFloat(string(r[i:j]), 64); err != nil {
+				return nil, fmt.Errorf("%w: bad number %q", ErrInvalidFilter, string(r[i:j]))
+			}
+			toks = append(toks, filterToken{tokNumber, string(r[i:j])})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i + 1
+			for j < len(r) && (r[j] == '_' || r[j] == '.' || unicode.IsLetter(r[j]) || unicode.IsDigit(r[j])) {
+				j++
+			}
+			toks = append(toks, filterToken{tokIdent, string(r[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q", ErrInvalidFilter, c)
+		}
+	}
+	return toks, nil
+}
+
+// Parser
+
+type filterParser struct {
+	toks []filterToken
+	pos  int
+}
+
+func (p *filterParser) peekKeyword(kw string) bool {
+	return p.pos < len(p.toks) && p.toks[p.pos].kind == tokIdent && strings.EqualFold(p.toks[p.pos].text, kw)
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &boolNode{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("AND") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &boolNode{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("%w: unexpected end of expression", ErrInvalidFilter)
+	}
+	if p.peekKeyword("NOT") {
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{inner: inner}, nil
+	}
+	if p.toks[p.pos].kind == tokLParen {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.toks) || p.toks[p.pos].kind != tokRParen {
+			return nil, fmt.Errorf("%w: missing ')'", ErrInvalidFilter)
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	if p.pos+3 > len(p.toks) {
+		return nil, fmt.Errorf("%w: incomplete comparison", ErrInvalidFilter)
+	}
+	field, op, val := p.toks[p.pos], p.toks[p.pos+1], p.toks[p.pos+2]
+	if field.kind != tokIdent || op.kind != tokOp {
+		return nil, fmt.Errorf("%w: expected <field> <op> <value> near %q", ErrInvalidFilter, field.text)
+	}
+	if !filterOps[op.text] {
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, op.text)
+	}
+	node := &cmpNode{field: field.text, op: op.text}
+	switch {
+	case val.kind == tokString:
+		node.value = val.text
+	case val.kind == tokNumber:
+		f, _ := strconv.ParseFloat(val.text, 64)
+		node.value = f
+	case val.kind == tokIdent && (strings.EqualFold(val.text, "true") || strings.EqualFold(val.text, "false")):
+		node.value = strings.EqualFold(val.text, "true")
+	default:
+		return nil, fmt.Errorf("%w: expected a value after %s %s", ErrInvalidFilter, field.text, op.text)
+	}
+	if err := node.validate(); err != nil {
+		return nil, err
+	}
+	p.pos += 3
+	return node, nil
+}
+
+// AST and SQL rendering
+
+type sqlBuilder struct {
+	sb   strings.Builder
+	args []any
+	next int
+}
+
+func (b *sqlBuilder) bind(v any) string {
+	b.args = append(b.args, v)
+	b.next++
+	return "$" + strconv.Itoa(b.next-1)
+}
+
+type filterNode interface {
+	render(b *sqlBuilder)
+}
+
+type boolNode struct {
+	op          string
+	left, right filterNode
+}
+
+func (n *boolNode) render(b *sqlBuilder) {
+	b.sb.WriteString("(")
+	n.left.render(b)
+	b.sb.WriteString(" " + n.op + " ")
+	n.right.render(b)
+	b.sb.WriteString(")")
+}
+
+type notNode struct {
+	inner filterNode
+}
+
+func (n *notNode) render(b *sqlBuilder) {
+	b.sb.WriteString("NOT (")
+	n.inner.render(b)
+	b.sb.WriteString(")")
+}
+
+type cmpNode struct {
+	field string
+	op    string
+	value any
+}
+
+// filterOps are the comparisons a filter may use; the lexer accepts
+// other runs of =!<> so they can be reported here
+var filterOps = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+var filterColumns = map[string]string{
+	"created_at": "timestamptz",
+	"expires_at": "timestamptz",
+	"version":    "integer",
+	"class":      "text",
+}
+
+func (n *cmpNode) validate() error {
+	for _, part := range strings.Split(n.field, ".") {
+		if part == "" {
+			return fmt.Errorf("%w: bad field %q", ErrInvalidFilter, n.field)
+		}
+	}
+	typ, isColumn := filterColumns[n.field]
+	if !isColumn {
+		if _, ok := n.value.(bool); ok && n.op != "=" && n.op != "!=" {
+			return fmt.Errorf("%w: booleans support only = and !=", ErrInvalidFilter)
+		}
+		return nil
+	}
+	switch v := n.value.(type) {
+	case string:
+		if typ == "timestamptz" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				return fmt.Errorf("%w: %s needs an RFC 3339 timestamp", ErrInvalidFilter, n.field)
+			}
+		}
+		if typ == "integer" {
+			return fmt.Errorf("%w: %s needs a number", ErrInvalidFilter, n.field)
+		}
+	case float64:
+		if typ != "integer" {
+			return fmt.Errorf("%w: %s needs a quoted value", ErrInvalidFilter, n.field)
+		}
+	default:
+		return fmt.Errorf("%w: %s cannot be compared with a boolean", ErrInvalidFilter, n.field)
+	}
+	return nil
+}
+
+func (n *cmpNode) render(b *sqlBuilder) {
+	if typ, ok := filterColumns[n.field]; ok {
+		b.sb.WriteString(n.field + " " + sqlOp(n.op) + " " + b.bind(n.value) + "::" + typ)
+		return
+	}
+
+	path := strings.Split(n.field, ".")
+	if n.op == "=" || n.op == "!=" {
+		// Containment is answered by the jsonb_path_ops GIN index
+		doc := any(n.value)
+		for i := len(path) - 1; i >= 0; i-- {
+			doc = map[string]any{path[i]: doc}
+		}
+		raw, _ := json.Marshal(doc)
+		if n.op == "!=" {
+			b.sb.WriteString("NOT ")
+		}
+		b.sb.WriteString("metadata @> " + b.bind(string(raw)) + "::jsonb")
+		return
+	}
+
+	keys := make([]string, len(path))
+	for i, part := range path {
+		keys[i] = b.bind(part)
+	}
+	extract := "jsonb_extract_path_text(metadata, " + strings.Join(keys, ", ") + ")"
+	switch n.value.(type) {
+	case float64:
+		// Non-numeric values compare as NULL, matching nothing, instead of
+		// failing the cast for the whole query
+		b.sb.WriteString("CASE WHEN jsonb_typeof(jsonb_extract_path(metadata, " + strings.Join(keys, ", ") +
+			")) = 'number' THEN (" + extract + ")::numeric END " + n.op + " " + b.bind(n.value) + "::numeric")
+	default:
+		b.sb.WriteString(extract + " " + n.op + " " + b.bind(n.value))
+	}
+}
+
+func sqlOp(op string) string {
+	if op == "!=" {
+		return "<>"
+	}
+	return op
+}
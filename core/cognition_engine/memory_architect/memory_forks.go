@@ -0,0 +1,183 @@
+// core/memory/memory_forks.go
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// maxForkDepth bounds how many ancestors a read follows, guarding against
+// a corrupted fork chain that loops
+const maxForkDepth = 16
+
+// forkVersion is the version the own records of the agent in $1 continue
+// from: its fork point, or zero for agents that are not forks
+const forkVersion = `COALESCE((SELECT version FROM memory_forks WHERE agent_id = $1), 0)`
+
+var (
+	// ErrForkExists is returned when the target agent already has memory
+	// or is already a fork
+	ErrForkExists = errors.New("memory fork target is not empty")
+	// ErrForkNotFound is returned for agents that are not forks
+	ErrForkNotFound = errors.New("memory fork not found")
+)
+
+// Fork records that an agent's memory branched from a parent. The fork
+// shares the parent's records up to Version through a pinned snapshot
+// instead of copying them; writes to either side only ever add records to
+// that side, so neither sees the other's later changes.
+type Fork struct {
+	AgentID       string    `db:"agent_id"`
+	ParentAgentID string    `db:"parent_agent_id"`
+	SnapshotID    string    `db:"snapshot_id"`
+	Version       int       `db:"version"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// ForkAgentMemory branches parentID's memory into childID, which must have
+// no memory of its own yet. Reading versions up to the fork point resolves
+// to the parent's records; the child's first write becomes version
+// Version+1. Listing, history and semantic search cover only the child's
+// own records.
+func (m *MemoryAdapter) ForkAgentMemory(ctx context.Context, parentID, childID string) (Fork, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("fork").Observe(time.Since(start).Seconds())
+	}()
+
+	fork, err := m.forkAgentMemory(ctx, parentID, childID)
+	if err != nil {
+		memOpsCounter.WithLabelValues("fork", "error").Inc()
+		return Fork{}, err
+	}
+	memOpsCounter.WithLabelValues("fork", "success").Inc()
+	return fork, nil
+}
+
+func (m *MemoryAdapter) forkAgentMemory(ctx context.Context, parentID, childID string) (Fork, error) {
+	if parentID == childID {
+		return Fork{}, fmt.Errorf("agent %s cannot fork its own memory", parentID)
+	}
+	var taken bool
+	if err := m.db.GetContext(ctx, &taken,
+		`SELECT EXISTS (SELECT 1 FROM memories WHERE agent_id = $1)
+		     OR EXISTS (SELECT 1 FROM memory_forks WHERE agent_id = $1)`, childID); err != nil {
+		return Fork{}, fmt.Errorf("fork target check failed: %w", err)
+	}
+	if taken {
+		return Fork{}, fmt.Errorf("%w: %s", ErrForkExists, childID)
+	}
+
+	// the snapshot pins the parent's records against GC, compaction and
+	// retention for as long as the fork exists
+	snap, err := m.createSnapshot(ctx, parentID, "fork:"+childID)
+	if err != nil {
+		return Fork{}, err
+	}
+	// a parent that is itself a fork with no writes of its own still
+	// shares everything up to its own fork point
+	if snap.Version == 0 {
+		if parent, err := m.GetFork(ctx, parentID); err == nil {
+			snap.Version = parent.Version
+		}
+	}
+
+	fork := Fork{
+		AgentID:       childID,
+		ParentAgentID: parentID,
+		SnapshotID:    snap.ID,
+		Version:       snap.Version,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if _, err := m.db.ExecContext(ctx,
+		`INSERT INTO memory_forks (agent_id, tenant_id, parent_agent_id, snapshot_id, version, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		fork.AgentID, TenantFromContext(ctx), fork.ParentAgentID, fork.SnapshotID, fork.Version,
+		fork.CreatedAt); err != nil {
+		if derr := m.DeleteSnapshot(ctx, parentID, snap.ID); derr != nil {
+			slog.Warn("fork snapshot cleanup failed", "agent_id", parentID, "snapshot_id", snap.ID, "error", derr)
+		}
+		if isVersionRace(err) {
+			return Fork{}, fmt.Errorf("%w: %s", ErrForkExists, childID)
+		}
+		return Fork{}, fmt.Errorf("fork insert failed: %w", err)
+	}
+	return fork, nil
+}
+
+// GetFork returns the fork agentID's memory branched from
+func (m *MemoryAdapter) GetFork(ctx context.Context, agentID string) (Fork, error) {
+	var fork Fork
+	err := m.db.GetContext(ctx, &fork,
+		`SELECT agent_id, parent_agent_id, snapshot_id, version, created_at
+		 FROM memory_forks WHERE agent_id = $1`, agentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Fork{}, ErrForkNotFound
+	}
+	if err != nil {
+		return Fork{}, fmt.Errorf("fork lookup failed: %w", err)
+	}
+	return fork, nil
+}
+
+// DropFork detaches agentID from its parent, releasing the parent's shared
+// records to normal GC. The agent loses access to the versions it
+// inherited, so call it when discarding a fork.
+func (m *MemoryAdapter) DropFork(ctx context.Context, agentID string) error {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var snapshotID string
+	err = tx.GetContext(ctx, &snapshotID,
+		`DELETE FROM memory_forks WHERE agent_id = $1 RETURNING snapshot_id`, agentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrForkNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("fork delete failed: %w", err)
+	}
+	var parentID string
+	if err := tx.GetContext(ctx, &parentID,
+		`DELETE FROM memory_snapshots WHERE id = $1 RETURNING agent_id`, snapshotID); err != nil {
+		return fmt.Errorf("fork snapshot delete failed: %w", err)
+	}
+	released, err := releasePins(ctx, tx, parentID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	m.pinObjects(ctx, released, false)
+	return nil
+}
+
+// inheritedRecord finds the record agentID shares with an ancestor at
+// version, following nested forks
+func (m *MemoryAdapter) inheritedRecord(ctx context.Context, agentID string, version int) (MemoryRecord, error) {
+	for depth := 0; depth < maxForkDepth; depth++ {
+		var parentID string
+		err := m.db.GetContext(ctx, &parentID,
+			`SELECT parent_agent_id FROM memory_forks
+			 WHERE agent_id = $1 AND version >= $2`, agentID, version)
+		if err != nil {
+			return MemoryRecord{}, err
+		}
+
+		var record MemoryRecord
+		err = m.db.GetContext(ctx, &record,
+			`SELECT * FROM memories WHERE agent_id = $1 AND version = $2`, parentID, version)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return record, err
+		}
+		agentID = parentID
+	}
+	return MemoryRecord{}, fmt.Errorf("fork chain of %s is deeper than %d", agentID, maxForkDepth)
+}
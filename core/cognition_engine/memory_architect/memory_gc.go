@@ -0,0 +1,234 @@
+// core/memory/memory_gc.go
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultGCInterval  = 10 * time.Minute
+	defaultGCBatchSize = 500
+)
+
+var (
+	memGCRecordsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "Wavine_memory_gc_records_total",
+			Help: "Expired memory records removed by the garbage collector",
+		},
+		[]string{"action"},
+	)
+
+	memGCReclaimedBytes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "Wavine_memory_gc_reclaimed_bytes_total",
+			Help: "Encrypted bytes reclaimed from expired memory records",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(memGCRecordsCounter, memGCReclaimedBytes)
+}
+
+// GCConfig controls expiry enforcement
+type GCConfig struct {
+	Interval  time.Duration
+	BatchSize int
+	// Archive moves expired records to memories_archive instead of deleting them
+	Archive bool
+}
+
+// RunGC enforces expires_at until ctx is cancelled
+func (m *MemoryAdapter) RunGC(ctx context.Context) {
+	interval := m.config.GC.Interval
+	if interval <= 0 {
+		interval = defaultGCInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			records, bytes, err := m.CollectExpired(ctx)
+			if err != nil {
+				slog.Error("memory GC pass failed", "error", err)
+				continue
+			}
+			if records > 0 {
+				slog.Info("memory GC pass completed", "records", records, "reclaimed_bytes", bytes)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CollectExpired removes expired records and shared namespace entries
+// batch by batch and reports how many were removed and how many encrypted
+// bytes were reclaimed
+func (m *MemoryAdapter) CollectExpired(ctx context.Context) (int, int64, error) {
+	batchSize := m.config.GC.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultGCBatchSize
+	}
+
+	var records int
+	var reclaimed int64
+	for _, collect := range []func(context.Context, int) (int, int64, error){m.collectBatch, m.collectSharedBatch} {
+		for {
+			n, bytes, err := collect(ctx, batchSize)
+			records += n
+			reclaimed += bytes
+			if err != nil {
+				return records, reclaimed, err
+			}
+			if n < batchSize {
+				break
+			}
+		}
+	}
+	return records, reclaimed, nil
+}
+
+type expiredRow struct {
+	ID          string `db:"id"`
+	AgentID     string `db:"agent_id"`
+	Version     int    `db:"version"`
+	ContentHash []byte `db:"content_hash"`
+	Storage     string `db:"storage"`
+	Size        int64  `db:"size"`
+}
+
+func (m *MemoryAdapter) collectBatch(ctx context.Context, batchSize int) (int, int64, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("gc").Observe(time.Since(start).Seconds())
+	}()
+
+	// SKIP LOCKED lets several replicas collect concurrently without contention
+	query := `DELETE FROM memories
+		 WHERE id IN (
+		     SELECT id FROM memories
+		     WHERE expires_at < NOW() AND ` + notPinned + `
+		     ORDER BY expires_at
+		     LIMIT $1
+		     FOR UPDATE SKIP LOCKED)
+		 RETURNING id, agent_id, version, content_hash, storage, octet_length(data) AS size`
+	action := "deleted"
+	if m.config.GC.Archive {
+		query = `WITH expired AS (
+		     DELETE FROM memories
+		     WHERE id IN (
+		         SELECT id FROM memories
+		         WHERE expires_at < NOW() AND ` + notPinned + `
+		         ORDER BY expires_at
+		         LIMIT $1
+		         FOR UPDATE SKIP LOCKED)
+		     RETURNING *)
+		 INSERT INTO memories_archive
+		 SELECT expired.*, NOW() FROM expired
+		 RETURNING id, agent_id, version, content_hash, storage, octet_length(data) AS size`
+		action = "archived"
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		memOpsCounter.WithLabelValues("gc", "error").Inc()
+		return 0, 0, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var rows []expiredRow
+	if err := tx.SelectContext(ctx, &rows, query, batchSize); err != nil {
+		memOpsCounter.WithLabelValues("gc", "error").Inc()
+		return 0, 0, fmt.Errorf("expired memory collection failed: %w", err)
+	}
+
+	freed := make(map[string]int64)
+	for _, row := range rows {
+		freed[row.AgentID] += row.Size
+		m.invalidate(ctx, row.AgentID, row.Version)
+	}
+
+	// Archived records keep their blob references so they stay restorable
+	if !m.config.GC.Archive {
+		var refs []blobRef
+		for _, row := range rows {
+			if row.ContentHash != nil {
+				refs = append(refs, blobRef{AgentID: row.AgentID, ContentHash: row.ContentHash})
+			}
+		}
+		blobs, err := releaseBlobs(ctx, tx, refs)
+		if err != nil {
+			memOpsCounter.WithLabelValues("gc", "error").Inc()
+			return 0, 0, err
+		}
+		for agentID, size := range blobs {
+			freed[agentID] += size
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		memOpsCounter.WithLabelValues("gc", "error").Inc()
+		return 0, 0, fmt.Errorf("commit failed: %w", err)
+	}
+
+	// Archived records keep their offloaded objects as well
+	if !m.config.GC.Archive {
+		var objects []string
+		for _, row := range rows {
+			if row.Storage == storageObject {
+				objects = append(objects, row.ID)
+			}
+		}
+		m.deleteObjects(ctx, objects)
+	}
+
+	var reclaimed int64
+	for agentID, size := range freed {
+		memSizeGauge.WithLabelValues(agentID).Sub(float64(size))
+		reclaimed += size
+	}
+	memGCRecordsCounter.WithLabelValues(action).Add(float64(len(rows)))
+	memGCReclaimedBytes.Add(float64(reclaimed))
+	memOpsCounter.WithLabelValues("gc", "success").Inc()
+	return len(rows), reclaimed, nil
+}
+
+// collectSharedBatch deletes expired entries of shared namespace logs.
+// They are never archived: a namespace log is a window of recent shared
+// context, not an agent's own history.
+func (m *MemoryAdapter) collectSharedBatch(ctx context.Context, batchSize int) (int, int64, error) {
+	var rows []struct {
+		Namespace string `db:"namespace"`
+		Size      int64  `db:"size"`
+	}
+	if err := m.db.SelectContext(ctx, &rows,
+		`DELETE FROM memory_namespace_entries
+		 WHERE seq IN (
+		     SELECT seq FROM memory_namespace_entries
+		     WHERE expires_at < NOW()
+		     ORDER BY expires_at
+		     LIMIT $1
+		     FOR UPDATE SKIP LOCKED)
+		 RETURNING namespace, octet_length(data) AS size`, batchSize); err != nil {
+		memOpsCounter.WithLabelValues("gc", "error").Inc()
+		return 0, 0, fmt.Errorf("expired shared entry collection failed: %w", err)
+	}
+
+	var reclaimed int64
+	for _, row := range rows {
+		memSizeGauge.WithLabelValues("ns:" + row.Namespace).Sub(float64(row.Size))
+		reclaimed += row.Size
+	}
+	memGCRecordsCounter.WithLabelValues("shared_deleted").Add(float64(len(rows)))
+	memGCReclaimedBytes.Add(float64(reclaimed))
+	return len(rows), reclaimed, nil
+}
@@ -0,0 +1,196 @@
+// core/memory/memory_history.go
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangeOp is the kind of a structural difference between two versions
+type ChangeOp string
+
+const (
+	ChangeAdd     ChangeOp = "add"
+	ChangeRemove  ChangeOp = "remove"
+	ChangeReplace ChangeOp = "replace"
+)
+
+// Change is one difference between consecutive versions, addressed by an
+// RFC 6901 JSON Pointer. Payloads that are not JSON produce a single
+// replace at the root with the values encoded as strings.
+type Change struct {
+	Op   ChangeOp        `json:"op"`
+	Path string          `json:"path"`
+	Old  json.RawMessage `json:"old,omitempty"`
+	New  json.RawMessage `json:"new,omitempty"`
+}
+
+// MemoryRevision is one version of an agent's memory with the changes that
+// produced it from the previous version
+type MemoryRevision struct {
+	ID        string
+	Version   int
+	Class     MemoryClass
+	Data      []byte
+	Metadata  []byte
+	CreatedAt time.Time
+	// ExpiresAt is zero while a snapshot pins the revision
+	ExpiresAt time.Time
+	Changes   []Change
+}
+
+// GetMemoryHistory returns every stored version of agentID's memory, oldest
+// first, including expired versions that have not been collected yet. The
+// first revision's Changes describe it as added from nothing.
+func (m *MemoryAdapter) GetMemoryHistory(ctx context.Context, agentID string) ([]MemoryRevision, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("history").Observe(time.Since(start).Seconds())
+	}()
+
+	history, err := m.memoryHistory(ctx, agentID)
+	if err != nil {
+		memOpsCounter.WithLabelValues("history", "error").Inc()
+		return nil, err
+	}
+	memOpsCounter.WithLabelValues("history", "success").Inc()
+	return history, nil
+}
+
+func (m *MemoryAdapter) memoryHistory(ctx context.Context, agentID string) ([]MemoryRevision, error) {
+	rows, err := m.db.QueryxContext(ctx,
+		`SELECT * FROM memories WHERE agent_id = $1 ORDER BY version`, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("history query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		history []MemoryRevision
+		prev    []byte
+	)
+	for rows.Next() {
+		var record MemoryRecord
+		if err := rows.StructScan(&record); err != nil {
+			return nil, fmt.Errorf("history scan failed: %w", err)
+		}
+		data, err := m.openRecord(ctx, record)
+		if err != nil {
+			return nil, fmt.Errorf("memory %s: %w", record.ID, err)
+		}
+		history = append(history, MemoryRevision{
+			ID:        record.ID,
+			Version:   record.Version,
+			Class:     record.Class,
+			Data:      data,
+			Metadata:  record.Metadata,
+			CreatedAt: record.CreatedAt,
+			ExpiresAt: record.ExpiresAt.Time,
+			Changes:   DiffMemory(prev, data),
+		})
+		prev = data
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("history scan failed: %w", err)
+	}
+	return history, nil
+}
+
+// DiffMemory computes the structural changes from before to after. A nil
+// before yields a single add at the root.
+func DiffMemory(before, after []byte) []Change {
+	if before == nil {
+		return []Change{{Op: ChangeAdd, Path: "", New: asJSON(after)}}
+	}
+	var a, b any
+	if json.Unmarshal(before, &a) != nil || json.Unmarshal(after, &b) != nil {
+		if string(before) == string(after) {
+			return nil
+		}
+		return []Change{{Op: ChangeReplace, Path: "", Old: asJSON(before), New: asJSON(after)}}
+	}
+	var changes []Change
+	diffValues("", a, b, &changes)
+	return changes
+}
+
+func diffValues(path string, a, b any, out *[]Change) {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, seen := av[k]; !seen {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := path + "/" + escapePointer(k)
+			x, inA := av[k]
+			y, inB := bv[k]
+			switch {
+			case !inB:
+				*out = append(*out, Change{Op: ChangeRemove, Path: p, Old: mustJSON(x)})
+			case !inA:
+				*out = append(*out, Change{Op: ChangeAdd, Path: p, New: mustJSON(y)})
+			default:
+				diffValues(p, x, y, out)
+			}
+		}
+		return
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		common := len(av)
+		if len(bv) < common {
+			common = len(bv)
+		}
+		for i := 0; i < common; i++ {
+			diffValues(path+"/"+strconv.Itoa(i), av[i], bv[i], out)
+		}
+		// Removals run from the end so each pointer stays valid when the
+		// changes are applied in order
+		for i := len(av) - 1; i >= common; i-- {
+			*out = append(*out, Change{Op: ChangeRemove, Path: path + "/" + strconv.Itoa(i), Old: mustJSON(av[i])})
+		}
+		for i := common; i < len(bv); i++ {
+			*out = append(*out, Change{Op: ChangeAdd, Path: path + "/" + strconv.Itoa(i), New: mustJSON(bv[i])})
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*out = append(*out, Change{Op: ChangeReplace, Path: path, Old: mustJSON(a), New: mustJSON(b)})
+	}
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func mustJSON(v any) json.RawMessage {
+	raw, _ := json.Marshal(v)
+	return raw
+}
+
+// asJSON passes JSON payloads through and encodes anything else as a string
+func asJSON(data []byte) json.RawMessage {
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	return mustJSON(string(data))
+}
@@ -0,0 +1,210 @@
+// core/memory/memory_listing.go
+package memory
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or were
+// issued for a different ordering
+var ErrInvalidCursor = errors.New("invalid memory cursor")
+
+// ListOrder selects the sort key for ListMemories
+type ListOrder string
+
+const (
+	OrderVersionAsc    ListOrder = "version_asc"
+	OrderVersionDesc   ListOrder = "version_desc"
+	OrderCreatedAtAsc  ListOrder = "created_at_asc"
+	OrderCreatedAtDesc ListOrder = "created_at_desc"
+)
+
+// ListOptions controls a ListMemories page
+type ListOptions struct {
+	// Filter is a ParseFilter expression; empty lists everything
+	Filter string
+	// Order defaults to OrderVersionAsc
+	Order ListOrder
+	// PageSize defaults to 100 and is capped at 1000
+	PageSize int
+	// Cursor is the NextCursor of the previous page; empty starts over
+	Cursor string
+	// IncludeData decrypts payloads; without it only metadata is returned
+	IncludeData bool
+}
+
+// MemoryPage is one page of ListMemories results
+type MemoryPage struct {
+	Items []RetrievedMemory
+	// NextCursor is empty on the last page
+	NextCursor string
+	// TotalEstimate is the planner's row estimate for the whole listing,
+	// filled on the first page only; -1 when unavailable
+	TotalEstimate int64
+}
+
+type listCursor struct {
+	Order     ListOrder `json:"o"`
+	Version   int       `json:"v"`
+	CreatedAt time.Time `json:"t"`
+}
+
+func (c listCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string, order ListOrder) (*listCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c listCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Order != order {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// ListMemories pages through an agent's live memories using keyset
+// pagination on (created_at, version) or version, so every page costs an
+// index range scan regardless of depth
+func (m *MemoryAdapter) ListMemories(ctx context.Context, agentID string, opts ListOptions) (MemoryPage, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("list").Observe(time.Since(start).Seconds())
+	}()
+
+	page, err := m.listMemories(ctx, agentID, opts)
+	if err != nil {
+		memOpsCounter.WithLabelValues("list", "error").Inc()
+		return MemoryPage{}, err
+	}
+	memOpsCounter.WithLabelValues("list", "success").Inc()
+	return page, nil
+}
+
+func (m *MemoryAdapter) listMemories(ctx context.Context, agentID string, opts ListOptions) (MemoryPage, error) {
+	if opts.Order == "" {
+		opts.Order = OrderVersionAsc
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = defaultPageSize
+	}
+	if opts.PageSize > maxPageSize {
+		opts.PageSize = maxPageSize
+	}
+
+	var orderBy, cmp string
+	switch opts.Order {
+	case OrderVersionAsc:
+		orderBy, cmp = "version ASC", ">"
+	case OrderVersionDesc:
+		orderBy, cmp = "version DESC", "<"
+	case OrderCreatedAtAsc:
+		orderBy, cmp = "created_at ASC, version ASC", ">"
+	case OrderCreatedAtDesc:
+		orderBy, cmp = "created_at DESC, version DESC", "<"
+	default:
+		return MemoryPage{}, fmt.Errorf("unknown list order %q", opts.Order)
+	}
+
+	cursor, err := decodeCursor(opts.Cursor, opts.Order)
+	if err != nil {
+		return MemoryPage{}, err
+	}
+	filter, err := ParseFilter(opts.Filter)
+	if err != nil {
+		return MemoryPage{}, err
+	}
+
+	args := []any{agentID}
+	where := `agent_id = $1 AND (expires_at IS NULL OR expires_at > NOW())`
+	if cursor != nil {
+		switch opts.Order {
+		case OrderVersionAsc, OrderVersionDesc:
+			where += ` AND version ` + cmp + ` $2`
+			args = append(args, cursor.Version)
+		default:
+			where += ` AND (created_at, version) ` + cmp + ` ($2, $3)`
+			args = append(args, cursor.CreatedAt, cursor.Version)
+		}
+	}
+	filterSQL, filterArgs := filter.SQL(len(args) + 1)
+	where += ` AND (` + filterSQL + `)`
+	args = append(args, filterArgs...)
+
+	page := MemoryPage{TotalEstimate: -1}
+	if cursor == nil {
+		page.TotalEstimate = m.estimateRows(ctx, where, args)
+	}
+
+	var records []MemoryRecord
+	if err := m.db.SelectContext(ctx, &records,
+		`SELECT * FROM memories WHERE `+where+
+			` ORDER BY `+orderBy+
+			` LIMIT `+strconv.Itoa(opts.PageSize+1), args...); err != nil {
+		return MemoryPage{}, fmt.Errorf("query failed: %w", err)
+	}
+
+	if len(records) > opts.PageSize {
+		records = records[:opts.PageSize]
+		last := records[len(records)-1]
+		page.NextCursor = listCursor{
+			Order:     opts.Order,
+			Version:   last.Version,
+			CreatedAt: last.CreatedAt,
+		}.encode()
+	}
+
+	page.Items = make([]RetrievedMemory, 0, len(records))
+	for _, record := range records {
+		item := RetrievedMemory{
+			ID:        record.ID,
+			Version:   record.Version,
+			Class:     record.Class,
+			Metadata:  record.Metadata,
+			CreatedAt: record.CreatedAt,
+		}
+		if opts.IncludeData {
+			if item.Data, err = m.openRecord(ctx, record); err != nil {
+				return MemoryPage{}, fmt.Errorf("memory %s: %w", record.ID, err)
+			}
+		}
+		page.Items = append(page.Items, item)
+	}
+	return page, nil
+}
+
+// estimateRows asks the planner how many rows match instead of counting
+// them, which would scan the whole listing
+func (m *MemoryAdapter) estimateRows(ctx context.Context, where string, args []any) int64 {
+	var raw []byte
+	if err := m.db.QueryRowContext(ctx,
+		`EXPLAIN (FORMAT JSON) SELECT 1 FROM memories WHERE `+where, args...).Scan(&raw); err != nil {
+		return -1
+	}
+	var plan []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plan); err != nil || len(plan) == 0 {
+		return -1
+	}
+	return int64(plan[0].Plan.Rows)
+}
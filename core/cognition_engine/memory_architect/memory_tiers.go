@@ -0,0 +1,402 @@
+// core/memory/memory_tiers.go
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MemoryClass identifies the tier a memory lives in
+type MemoryClass string
+
+const (
+	// ClassWorking is short-lived recent context held in the WorkingStore
+	ClassWorking MemoryClass = "working"
+	// ClassEpisodic is an individual experience persisted in Postgres
+	ClassEpisodic MemoryClass = "episodic"
+	// ClassSemantic is a consolidated summary of many episodes
+	ClassSemantic MemoryClass = "semantic"
+)
+
+const (
+	defaultWorkingCapacity = 32
+	defaultWorkingRecall   = 4
+	defaultConsolidateMin  = 20
+	defaultConsolidateMax  = 200
+)
+
+// WorkingStore holds sealed working-memory items per agent, newest first.
+// Oldest reads up to n of the oldest items, oldest first, without removing
+// them; TrimOldest removes them once they are safely stored elsewhere.
+type WorkingStore interface {
+	Push(ctx context.Context, agentID string, item []byte) (int64, error)
+	Recent(ctx context.Context, agentID string, n int) ([][]byte, error)
+	Oldest(ctx context.Context, agentID string, n int) ([][]byte, error)
+	TrimOldest(ctx context.Context, agentID string, n int) error
+}
+
+// Summarizer condenses episodic memories into a semantic summary
+type Summarizer interface {
+	Summarize(ctx context.Context, agentID string, episodes [][]byte) (string, error)
+}
+
+// TierPolicy governs movement between tiers. Working memory beyond
+// WorkingCapacity is demoted to episodic storage; once ConsolidateMin
+// unconsolidated episodes accumulate, Consolidate promotes them into a
+// semantic summary.
+type TierPolicy struct {
+	WorkingCapacity int
+	WorkingRecall   int
+	ConsolidateMin  int
+	ConsolidateMax  int
+}
+
+func (p TierPolicy) withDefaults() TierPolicy {
+	if p.WorkingCapacity <= 0 {
+		p.WorkingCapacity = defaultWorkingCapacity
+	}
+	if p.WorkingRecall <= 0 {
+		p.WorkingRecall = defaultWorkingRecall
+	}
+	if p.ConsolidateMin <= 0 {
+		p.ConsolidateMin = defaultConsolidateMin
+	}
+	if p.ConsolidateMax < p.ConsolidateMin {
+		p.ConsolidateMax = defaultConsolidateMax
+	}
+	return p
+}
+
+// workingItem is the sealed envelope stored in the WorkingStore
+type workingItem struct {
+	KeyID     string    `json:"key_id"`
+	Cipher    string    `json:"cipher"`
+	Data      []byte    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+	// Subject is the data subject the item was remembered for, carried
+	// over to its episodic record on demotion
+	Subject string `json:"subject,omitempty"`
+	// Tenant scopes the item for erasure, as working keys are per agent
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Remember records data in working memory, demoting the oldest items to
+// episodic storage when the working set exceeds its capacity. Without a
+// WorkingStore it stores directly as an episodic memory.
+func (m *MemoryAdapter) Remember(ctx context.Context, agentID string, data any) error {
+	if m.config.Working == nil {
+		_, err := m.StoreMemory(ctx, agentID, data)
+		return err
+	}
+
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		memOpsCounter.WithLabelValues("remember", "error").Inc()
+		return fmt.Errorf("serialization failed: %w", err)
+	}
+	// screened now, since the item sits in Redis until it is demoted
+	if plaintext, _, err = m.screenPII(ctx, plaintext, nil); err != nil {
+		memOpsCounter.WithLabelValues("remember", "error").Inc()
+		return err
+	}
+	keyID, cipherName, sealed, err := m.seal(ctx, plaintext)
+	if err != nil {
+		memOpsCounter.WithLabelValues("remember", "error").Inc()
+		return err
+	}
+	subject, _ := ctx.Value(subjectCtxKey{}).(string)
+	item, err := json.Marshal(workingItem{
+		KeyID:     keyID,
+		Cipher:    cipherName,
+		Data:      sealed,
+		CreatedAt: time.Now().UTC(),
+		Subject:   subject,
+		Tenant:    TenantFromContext(ctx),
+	})
+	if err != nil {
+		memOpsCounter.WithLabelValues("remember", "error").Inc()
+		return fmt.Errorf("working item encoding failed: %w", err)
+	}
+
+	size, err := m.config.Working.Push(ctx, agentID, item)
+	if err != nil {
+		memOpsCounter.WithLabelValues("remember", "error").Inc()
+		return fmt.Errorf("working memory write failed: %w", err)
+	}
+	memOpsCounter.WithLabelValues("remember", "success").Inc()
+
+	policy := m.config.Tiers.withDefaults()
+	if overflow := int(size) - policy.WorkingCapacity; overflow > 0 {
+		return m.demote(ctx, agentID, overflow)
+	}
+	return nil
+}
+
+// demote moves the n oldest working items into episodic storage. Items
+// are trimmed from working memory only after they are stored, so a failed
+// store leaves them to be demoted again; the agent lock keeps concurrent
+// demotions from storing or trimming the same items twice. An item that
+// cannot be stored, e.g. one sealed under a key no longer available, is
+// moved to working_dead_letters so it does not block every later demotion.
+func (m *MemoryAdapter) demote(ctx context.Context, agentID string, n int) error {
+	return m.withAgentLock(ctx, "demote", agentID, func() error {
+		items, err := m.config.Working.Oldest(ctx, agentID, n)
+		if err != nil {
+			return fmt.Errorf("working memory read failed: %w", err)
+		}
+		for done, raw := range items {
+			plaintext, item, err := m.openWorkingItem(ctx, raw)
+			if err == nil {
+				// the item keeps its own subject, not that of the write demoting it
+				_, err = m.storePlaintext(WithDataSubject(ctx, item.Subject), agentID, plaintext, ClassEpisodic,
+					[]byte(`{"source":"working_memory"}`))
+			}
+			if err == nil {
+				memOpsCounter.WithLabelValues("demote", "success").Inc()
+				continue
+			}
+			memOpsCounter.WithLabelValues("demote", "error").Inc()
+			if derr := m.deadLetterWorking(ctx, agentID, raw, item, err); derr != nil {
+				// Postgres itself is failing; keep the rest for the next demotion
+				if terr := m.config.Working.TrimOldest(ctx, agentID, done); terr != nil {
+					return fmt.Errorf("working memory eviction failed: %w", terr)
+				}
+				return fmt.Errorf("working memory demotion failed: %w", errors.Join(err, derr))
+			}
+			slog.Warn("working memory item dead-lettered", "agent_id", agentID, "error", err)
+		}
+		if err := m.config.Working.TrimOldest(ctx, agentID, len(items)); err != nil {
+			return fmt.Errorf("working memory eviction failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// deadLetterWorking keeps a working item that failed demotion, still
+// sealed, for an operator to inspect or replay
+func (m *MemoryAdapter) deadLetterWorking(ctx context.Context, agentID string, raw []byte, item workingItem, cause error) error {
+	tenantID := item.Tenant
+	if tenantID == "" {
+		tenantID = TenantFromContext(ctx)
+	}
+	if _, err := m.db.ExecContext(ctx,
+		`INSERT INTO working_dead_letters (tenant_id, agent_id, subject_id, item, error, created_at)
+		 VALUES ($1, $2, $3, $4, $5, NOW())`,
+		tenantID, agentID, item.Subject, raw, cause.Error()); err != nil {
+		return fmt.Errorf("dead letter insert failed: %w", err)
+	}
+	return nil
+}
+
+// withAgentLock runs fn holding a Postgres advisory lock on scope for the
+// caller's tenant and agentID. When another replica holds the lock it
+// returns without running fn; that replica is doing the same work.
+func (m *MemoryAdapter) withAgentLock(ctx context.Context, scope, agentID string, fn func() error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer conn.Close()
+
+	key := "memory:" + scope + ":" + TenantFromContext(ctx) + ":" + agentID
+	var locked bool
+	if err := conn.GetContext(ctx, &locked, `SELECT pg_try_advisory_lock(hashtext($1))`, key); err != nil {
+		return fmt.Errorf("advisory lock failed: %w", err)
+	}
+	if !locked {
+		return nil
+	}
+	// the lock belongs to this session, so it is released on this
+	// connection even if ctx has ended
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, key)
+	return fn()
+}
+
+func (m *MemoryAdapter) openWorkingItem(ctx context.Context, raw []byte) ([]byte, workingItem, error) {
+	var item workingItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return nil, item, fmt.Errorf("working item decoding failed: %w", err)
+	}
+	plaintext, err := m.openRecord(ctx, MemoryRecord{
+		Data:   item.Data,
+		KeyID:  item.KeyID,
+		Cipher: item.Cipher,
+	})
+	return plaintext, item, err
+}
+
+// Consolidate promotes an agent's unconsolidated episodic memories into a
+// single semantic summary. It returns the summary's record ID, or "" when
+// fewer than ConsolidateMin episodes are pending or another replica is
+// consolidating the agent's memories.
+func (m *MemoryAdapter) Consolidate(ctx context.Context, agentID string) (string, error) {
+	if m.config.Summarizer == nil {
+		return "", fmt.Errorf("memory consolidation not configured")
+	}
+	var summaryID string
+	err := m.withAgentLock(ctx, "consolidate", agentID, func() error {
+		var err error
+		summaryID, err = m.consolidate(ctx, agentID)
+		return err
+	})
+	return summaryID, err
+}
+
+func (m *MemoryAdapter) consolidate(ctx context.Context, agentID string) (string, error) {
+	policy := m.config.Tiers.withDefaults()
+
+	var episodes []MemoryRecord
+	if err := m.db.SelectContext(ctx, &episodes,
+		`SELECT * FROM memories
+		 WHERE agent_id = $1 AND class = $2 AND consolidated_at IS NULL
+		 ORDER BY created_at
+		 LIMIT $3`, agentID, ClassEpisodic, policy.ConsolidateMax); err != nil {
+		memOpsCounter.WithLabelValues("consolidate", "error").Inc()
+		return "", fmt.Errorf("episode query failed: %w", err)
+	}
+	if len(episodes) < policy.ConsolidateMin {
+		return "", nil
+	}
+
+	payloads := make([][]byte, 0, len(episodes))
+	ids := make([]string, 0, len(episodes))
+	for _, ep := range episodes {
+		data, err := m.openRecord(ctx, ep)
+		if err != nil {
+			memOpsCounter.WithLabelValues("consolidate", "error").Inc()
+			return "", fmt.Errorf("memory %s: %w", ep.ID, err)
+		}
+		payloads = append(payloads, data)
+		ids = append(ids, ep.ID)
+	}
+
+	summary, err := m.config.Summarizer.Summarize(ctx, agentID, payloads)
+	if err != nil {
+		memOpsCounter.WithLabelValues("consolidate", "error").Inc()
+		return "", fmt.Errorf("summarization failed: %w", err)
+	}
+	plaintext, err := json.Marshal(summary)
+	if err != nil {
+		return "", fmt.Errorf("serialization failed: %w", err)
+	}
+	meta := map[string]any{
+		"source":   "consolidation",
+		"episodes": ids,
+	}
+	tagSubjects(meta, subjectsOf(episodes))
+	metadata, err := json.Marshal(meta)
+	if err != nil {
+		return "", fmt.Errorf("serialization failed: %w", err)
+	}
+
+	summaryRec, plaintext, err := m.newRecord(withoutSubject(ctx), agentID, plaintext, ClassSemantic, metadata)
+	if err != nil {
+		memOpsCounter.WithLabelValues("consolidate", "error").Inc()
+		return "", err
+	}
+	// an offloaded summary is orphaned unless the consolidation commits
+	committed := false
+	defer func() {
+		if !committed {
+			m.discardRecord(ctx, summaryRec)
+		}
+	}()
+
+	// the summary and the episodes it consumes commit together, so a
+	// failure cannot leave episodes summarized twice or marked but lost
+	tx, err := m.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return "", fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	written, err := m.insertRecord(ctx, tx, &summaryRec, plaintext, anyVersion)
+	if err != nil {
+		memOpsCounter.WithLabelValues("consolidate", "error").Inc()
+		return "", err
+	}
+	if m.config.PublishEvents {
+		if err := writeStoredEvent(ctx, tx, &summaryRec); err != nil {
+			return "", err
+		}
+	}
+
+	q, args, err := sqlx.In(
+		`UPDATE memories SET consolidated_at = NOW() WHERE id IN (?) AND consolidated_at IS NULL`, ids)
+	if err != nil {
+		return "", fmt.Errorf("query build failed: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, tx.Rebind(q), args...)
+	if err != nil {
+		memOpsCounter.WithLabelValues("consolidate", "error").Inc()
+		return "", fmt.Errorf("episode update failed: %w", err)
+	}
+	// a concurrent GC or erasure may already have removed an episode
+	if n, _ := res.RowsAffected(); n != int64(len(ids)) {
+		memOpsCounter.WithLabelValues("consolidate", "error").Inc()
+		return "", fmt.Errorf("episodes of %s changed during consolidation", agentID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		memOpsCounter.WithLabelValues("consolidate", "error").Inc()
+		return "", fmt.Errorf("commit failed: %w", err)
+	}
+	committed = true
+
+	m.cacheRecord(ctx, summaryRec)
+	m.indexMemory(ctx, summaryRec, plaintext)
+	memSizeGauge.WithLabelValues(agentID).Add(float64(written))
+	memOpsCounter.WithLabelValues("consolidate", "success").Inc()
+	return summaryRec.ID, nil
+}
+
+// Recall searches every tier: the most recent working memories come first,
+// followed by episodic and semantic memories ranked by relevance to query
+func (m *MemoryAdapter) Recall(ctx context.Context, agentID, query string, k int) ([]RecalledMemory, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("recall").Observe(time.Since(start).Seconds())
+	}()
+
+	var recalled []RecalledMemory
+	if m.config.Working != nil {
+		policy := m.config.Tiers.withDefaults()
+		items, err := m.config.Working.Recent(ctx, agentID, min(k, policy.WorkingRecall))
+		if err != nil {
+			memOpsCounter.WithLabelValues("recall", "error").Inc()
+			return nil, fmt.Errorf("working memory read failed: %w", err)
+		}
+		for _, raw := range items {
+			data, item, err := m.openWorkingItem(ctx, raw)
+			if err != nil {
+				memOpsCounter.WithLabelValues("recall", "error").Inc()
+				return nil, err
+			}
+			recalled = append(recalled, RecalledMemory{
+				Class:     ClassWorking,
+				Data:      data,
+				Score:     1,
+				CreatedAt: item.CreatedAt,
+			})
+		}
+	}
+
+	if remaining := k - len(recalled); remaining > 0 && m.config.Embedder != nil && m.config.Index != nil {
+		longTerm, err := m.SearchMemories(ctx, agentID, query, remaining)
+		if err != nil {
+			memOpsCounter.WithLabelValues("recall", "error").Inc()
+			return nil, err
+		}
+		recalled = append(recalled, longTerm...)
+	}
+
+	memOpsCounter.WithLabelValues("recall", "success").Inc()
+	return recalled, nil
+}
@@ -0,0 +1,161 @@
+// core/memory/memory_versioning.go
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// anyVersion disables the expected-version check for plain appends
+const anyVersion = -1
+
+const maxVersionRetries = 3
+
+// ErrVersionConflict matches every VersionConflictError
+var ErrVersionConflict = errors.New("memory version conflict")
+
+// VersionConflictError reports a compare-and-set write that lost a race
+type VersionConflictError struct {
+	AgentID  string
+	Expected int
+	Current  int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("memory version conflict for agent %s: expected version %d, found %d",
+		e.AgentID, e.Expected, e.Current)
+}
+
+func (e *VersionConflictError) Unwrap() error { return ErrVersionConflict }
+
+// isVersionRace reports unique-violation and serialization failures, which
+// is how Postgres surfaces two writers claiming the same version
+func isVersionRace(err error) bool {
+	var state interface{ SQLState() string }
+	if !errors.As(err, &state) {
+		return false
+	}
+	switch state.SQLState() {
+	case "23505", "40001":
+		return true
+	}
+	return false
+}
+
+// Conflict describes a rejected compare-and-set write for a resolver
+type Conflict struct {
+	AgentID        string
+	Expected       int
+	CurrentVersion int
+	Current        []byte
+	Proposed       []byte
+}
+
+// ConflictResolver decides what to write when a compare-and-set loses.
+// Returning an error abandons the write and is surfaced to the caller.
+type ConflictResolver interface {
+	Resolve(ctx context.Context, c Conflict) ([]byte, error)
+}
+
+// LastWriteWins writes the proposed payload on top of whatever is current
+type LastWriteWins struct{}
+
+func (LastWriteWins) Resolve(_ context.Context, c Conflict) ([]byte, error) {
+	return c.Proposed, nil
+}
+
+// MergeFunc combines the current and proposed payloads into one
+type MergeFunc func(ctx context.Context, current, proposed []byte) ([]byte, error)
+
+func (f MergeFunc) Resolve(ctx context.Context, c Conflict) ([]byte, error) {
+	return f(ctx, c.Current, c.Proposed)
+}
+
+// StoreMemoryCAS writes data as the version after expectedVersion. When
+// another writer got there first, resolver picks the payload to retry with
+// against the new latest version; a nil resolver returns the
+// *VersionConflictError unresolved. It returns the record ID and version.
+func (m *MemoryAdapter) StoreMemoryCAS(ctx context.Context, agentID string, expectedVersion int, data any, resolver ConflictResolver) (string, int, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("store_cas").Observe(time.Since(start).Seconds())
+	}()
+
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		memOpsCounter.WithLabelValues("store_cas", "error").Inc()
+		return "", 0, fmt.Errorf("serialization failed: %w", err)
+	}
+
+	expected := expectedVersion
+	for attempt := 1; ; attempt++ {
+		record, screened, err := m.newRecord(ctx, agentID, plaintext, ClassEpisodic, []byte(`{"source":"direct_input"}`))
+		if err != nil {
+			memOpsCounter.WithLabelValues("store_cas", "error").Inc()
+			return "", 0, err
+		}
+		plaintext = screened
+
+		written, err := m.commitRecord(ctx, &record, plaintext, expected)
+		if err == nil {
+			m.cacheRecord(ctx, record)
+			memSizeGauge.WithLabelValues(agentID).Add(float64(written))
+			memOpsCounter.WithLabelValues("store_cas", "success").Inc()
+			m.indexMemory(ctx, record, plaintext)
+			return record.ID, record.Version, nil
+		}
+
+		m.discardRecord(ctx, record)
+		var conflict *VersionConflictError
+		if !errors.As(err, &conflict) || resolver == nil || attempt == maxVersionRetries {
+			memOpsCounter.WithLabelValues("store_cas", "conflict").Inc()
+			return "", 0, err
+		}
+
+		current, currentVersion, err := m.latest(ctx, agentID)
+		if err != nil {
+			memOpsCounter.WithLabelValues("store_cas", "error").Inc()
+			return "", 0, err
+		}
+		if plaintext, err = resolver.Resolve(ctx, Conflict{
+			AgentID:        agentID,
+			Expected:       expected,
+			CurrentVersion: currentVersion,
+			Current:        current,
+			Proposed:       plaintext,
+		}); err != nil {
+			memOpsCounter.WithLabelValues("store_cas", "conflict").Inc()
+			return "", 0, fmt.Errorf("conflict resolution failed: %w", err)
+		}
+		expected = currentVersion
+		memOpsCounter.WithLabelValues("store_cas", "resolved").Inc()
+	}
+}
+
+// latest returns the decrypted payload and version of agentID's newest record
+func (m *MemoryAdapter) latest(ctx context.Context, agentID string) ([]byte, int, error) {
+	var record MemoryRecord
+	err := m.db.GetContext(ctx, &record,
+		`SELECT * FROM memories
+		 WHERE agent_id = $1
+		 ORDER BY version DESC
+		 LIMIT 1`, agentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// a fork that has not written yet is at its parent's fork point
+		var fork Fork
+		if fork, err = m.GetFork(ctx, agentID); err == nil {
+			record, err = m.inheritedRecord(ctx, agentID, fork.Version)
+		} else if errors.Is(err, ErrForkNotFound) {
+			err = sql.ErrNoRows
+		}
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("latest version query failed: %w", err)
+	}
+	data, err := m.openRecord(ctx, record)
+	return data, record.Version, err
+}
@@ -0,0 +1,224 @@
+// core/memory/namespaces.go
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNamespaceAccess is returned when an agent lacks the role an operation needs
+var ErrNamespaceAccess = errors.New("namespace access denied")
+
+// NamespaceRole grants increasing rights over a shared namespace
+type NamespaceRole int
+
+const (
+	NamespaceReader NamespaceRole = iota + 1
+	NamespaceWriter
+	NamespaceAdmin
+)
+
+// SharedMemory is one decrypted entry of a namespace's append-only log
+type SharedMemory struct {
+	Seq       int64
+	AuthorID  string
+	Data      []byte
+	Metadata  []byte
+	CreatedAt time.Time
+}
+
+type namespaceEntry struct {
+	Seq       int64     `db:"seq"`
+	Namespace string    `db:"namespace"`
+	AuthorID  string    `db:"author_agent_id"`
+	Data      []byte    `db:"data"`
+	Metadata  []byte    `db:"metadata"`
+	KeyID     string    `db:"key_id"`
+	Cipher    string    `db:"cipher"`
+	CreatedAt time.Time `db:"created_at"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// CreateNamespace registers a shared knowledge pool administered by ownerAgentID
+func (m *MemoryAdapter) CreateNamespace(ctx context.Context, namespace, ownerAgentID string) error {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO memory_namespaces (namespace, tenant_id, created_by, created_at)
+		 VALUES ($1, $2, $3, NOW())`, namespace, TenantFromContext(ctx), ownerAgentID); err != nil {
+		return fmt.Errorf("namespace creation failed: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO memory_namespace_members (tenant_id, namespace, agent_id, role)
+		 VALUES ($1, $2, $3, $4)`, TenantFromContext(ctx), namespace, ownerAgentID, NamespaceAdmin); err != nil {
+		return fmt.Errorf("namespace owner grant failed: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GrantNamespace gives agentID role in namespace; granterID must be an admin
+func (m *MemoryAdapter) GrantNamespace(ctx context.Context, namespace, granterID, agentID string, role NamespaceRole) error {
+	if err := m.authorize(ctx, namespace, granterID, NamespaceAdmin); err != nil {
+		return err
+	}
+	if _, err := m.db.ExecContext(ctx,
+		`INSERT INTO memory_namespace_members (tenant_id, namespace, agent_id, role)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (tenant_id, namespace, agent_id) DO UPDATE SET role = EXCLUDED.role`,
+		TenantFromContext(ctx), namespace, agentID, role); err != nil {
+		return fmt.Errorf("namespace grant failed: %w", err)
+	}
+	return nil
+}
+
+// RevokeNamespace removes agentID from namespace; granterID must be an admin
+func (m *MemoryAdapter) RevokeNamespace(ctx context.Context, namespace, granterID, agentID string) error {
+	if err := m.authorize(ctx, namespace, granterID, NamespaceAdmin); err != nil {
+		return err
+	}
+	if _, err := m.db.ExecContext(ctx,
+		`DELETE FROM memory_namespace_members WHERE tenant_id = $1 AND namespace = $2 AND agent_id = $3`,
+		TenantFromContext(ctx), namespace, agentID); err != nil {
+		return fmt.Errorf("namespace revoke failed: %w", err)
+	}
+	return nil
+}
+
+// AppendShared adds an entry to the namespace log. Entries are ordered by a
+// database sequence rather than read-modify-write versions, so concurrent
+// writers never conflict. Appends to one namespace take turns under an
+// advisory lock held until commit, so sequence numbers commit in order and
+// a reader paging by seq never skips an entry that committed late.
+func (m *MemoryAdapter) AppendShared(ctx context.Context, namespace, agentID string, data any) (int64, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("append_shared").Observe(time.Since(start).Seconds())
+	}()
+
+	if err := m.authorize(ctx, namespace, agentID, NamespaceWriter); err != nil {
+		memOpsCounter.WithLabelValues("append_shared", "denied").Inc()
+		return 0, err
+	}
+
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		memOpsCounter.WithLabelValues("append_shared", "error").Inc()
+		return 0, fmt.Errorf("serialization failed: %w", err)
+	}
+	plaintext, metadata, err := m.screenPII(ctx, plaintext, []byte(`{"source":"shared_append"}`))
+	if err != nil {
+		memOpsCounter.WithLabelValues("append_shared", "error").Inc()
+		return 0, err
+	}
+	metadata, err = tagSubject(ctx, metadata)
+	if err != nil {
+		memOpsCounter.WithLabelValues("append_shared", "error").Inc()
+		return 0, err
+	}
+	keyID, cipherName, sealed, err := m.seal(ctx, plaintext)
+	if err != nil {
+		memOpsCounter.WithLabelValues("append_shared", "error").Inc()
+		return 0, err
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		memOpsCounter.WithLabelValues("append_shared", "error").Inc()
+		return 0, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	tenantID := TenantFromContext(ctx)
+	if _, err := tx.ExecContext(ctx,
+		`SELECT pg_advisory_xact_lock(hashtext($1))`, "memory:namespace:"+tenantID+":"+namespace); err != nil {
+		memOpsCounter.WithLabelValues("append_shared", "error").Inc()
+		return 0, fmt.Errorf("namespace lock failed: %w", err)
+	}
+	now := time.Now().UTC()
+	var seq int64
+	if err := tx.GetContext(ctx, &seq,
+		`INSERT INTO memory_namespace_entries
+		 (tenant_id, namespace, author_agent_id, data, metadata, key_id, cipher, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING seq`,
+		tenantID, namespace, agentID, sealed, metadata,
+		keyID, cipherName, now, now.Add(720*time.Hour)); err != nil {
+		memOpsCounter.WithLabelValues("append_shared", "error").Inc()
+		return 0, fmt.Errorf("insert failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		memOpsCounter.WithLabelValues("append_shared", "error").Inc()
+		return 0, fmt.Errorf("commit failed: %w", err)
+	}
+
+	memSizeGauge.WithLabelValues("ns:" + namespace).Add(float64(len(sealed)))
+	memOpsCounter.WithLabelValues("append_shared", "success").Inc()
+	return seq, nil
+}
+
+// ReadShared returns up to limit live entries after afterSeq, oldest first
+func (m *MemoryAdapter) ReadShared(ctx context.Context, namespace, agentID string, afterSeq int64, limit int) ([]SharedMemory, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("read_shared").Observe(time.Since(start).Seconds())
+	}()
+
+	if err := m.authorize(ctx, namespace, agentID, NamespaceReader); err != nil {
+		memOpsCounter.WithLabelValues("read_shared", "denied").Inc()
+		return nil, err
+	}
+
+	var entries []namespaceEntry
+	if err := m.db.SelectContext(ctx, &entries,
+		`SELECT seq, namespace, author_agent_id, data, metadata, key_id, cipher, created_at, expires_at
+		 FROM memory_namespace_entries
+		 WHERE tenant_id = $1 AND namespace = $2 AND seq > $3 AND expires_at > NOW()
+		 ORDER BY seq
+		 LIMIT $4`, TenantFromContext(ctx), namespace, afterSeq, limit); err != nil {
+		memOpsCounter.WithLabelValues("read_shared", "error").Inc()
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	out := make([]SharedMemory, 0, len(entries))
+	for _, e := range entries {
+		data, err := m.openRecord(ctx, MemoryRecord{Data: e.Data, KeyID: e.KeyID, Cipher: e.Cipher})
+		if err != nil {
+			memOpsCounter.WithLabelValues("read_shared", "error").Inc()
+			return nil, fmt.Errorf("entry %d: %w", e.Seq, err)
+		}
+		out = append(out, SharedMemory{
+			Seq:       e.Seq,
+			AuthorID:  e.AuthorID,
+			Data:      data,
+			Metadata:  e.Metadata,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	memOpsCounter.WithLabelValues("read_shared", "success").Inc()
+	return out, nil
+}
+
+// authorize checks agentID holds at least role in namespace within the
+// caller's tenant
+func (m *MemoryAdapter) authorize(ctx context.Context, namespace, agentID string, role NamespaceRole) error {
+	var granted NamespaceRole
+	err := m.db.GetContext(ctx, &granted,
+		`SELECT role FROM memory_namespace_members
+		 WHERE tenant_id = $1 AND namespace = $2 AND agent_id = $3`,
+		TenantFromContext(ctx), namespace, agentID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && granted < role) {
+		return fmt.Errorf("%w: agent %s in %s", ErrNamespaceAccess, agentID, namespace)
+	}
+	if err != nil {
+		return fmt.Errorf("namespace ACL lookup failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+// core/memory/object_offload.go
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+const (
+	storageInline = "inline"
+	storageObject = "object"
+
+	objectKeyPrefix = "memories/"
+)
+
+// ErrObjectNotFound is returned by ObjectStore.Get for missing keys
+var ErrObjectNotFound = errors.New("memory object not found")
+
+// ObjectStore holds offloaded memory payloads
+type ObjectStore interface {
+	Name() string
+	Put(ctx context.Context, key string, body io.Reader, expiresAt time.Time) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ObjectPinner is implemented by object stores whose bucket lifecycle
+// rules can be told to spare objects a snapshot still holds
+type ObjectPinner interface {
+	SetPinned(ctx context.Context, key string, pinned bool) error
+}
+
+// OffloadConfig moves payloads larger than Threshold bytes out of Postgres
+type OffloadConfig struct {
+	Store     ObjectStore
+	Threshold int
+}
+
+// objectPointer is sealed into memories.data for offloaded records. Each
+// object has its own data key, so rotating the record key only rewrites
+// the pointer and never the object.
+type objectPointer struct {
+	Store  string `json:"store"`
+	Key    string `json:"key"`
+	DEK    []byte `json:"dek"`
+	Cipher string `json:"cipher"`
+	Size   int64  `json:"size"`
+	SHA256 []byte `json:"sha256"`
+}
+
+func objectKey(recordID string) string {
+	return objectKeyPrefix + recordID
+}
+
+func (m *MemoryAdapter) shouldOffload(plaintext []byte) bool {
+	return m.config.Offload.Store != nil && m.config.Offload.Threshold > 0 &&
+		len(plaintext) > m.config.Offload.Threshold
+}
+
+// offload streams plaintext to object storage encrypted under a fresh data
+// key and replaces record's payload with the sealed pointer
+func (m *MemoryAdapter) offload(ctx context.Context, record *MemoryRecord, plaintext []byte) error {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return fmt.Errorf("object key generation failed: %w", err)
+	}
+	defer clear(dek)
+
+	cipherName := m.sealingCipher()
+	aead, err := newMemoryAEAD(cipherName, dek)
+	if err != nil {
+		return err
+	}
+	compressed := m.encoder.EncodeAll(plaintext, make([]byte, 0, len(plaintext)))
+
+	// Objects reuse the archive frame format: position-bound AEAD chunks
+	// terminated by an end frame, encrypted while the upload streams
+	pr, pw := io.Pipe()
+	go func() {
+		stream := &archiveStream{aead: aead}
+		for off := 0; off < len(compressed); off += archiveChunkSize {
+			end := min(off+archiveChunkSize, len(compressed))
+			if err := stream.writeFrame(pw, frameChunk, compressed[off:end]); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(stream.writeFrame(pw, frameEnd, nil))
+	}()
+
+	key := objectKey(record.ID)
+	if err := m.config.Offload.Store.Put(ctx, key, pr, record.ExpiresAt.Time); err != nil {
+		pr.CloseWithError(err)
+		memOpsCounter.WithLabelValues("offload", "error").Inc()
+		return fmt.Errorf("object upload failed: %w", err)
+	}
+
+	sum := sha256.Sum256(compressed)
+	ptr, err := json.Marshal(objectPointer{
+		Store:  m.config.Offload.Store.Name(),
+		Key:    key,
+		DEK:    dek,
+		Cipher: cipherName,
+		Size:   int64(len(compressed)),
+		SHA256: sum[:],
+	})
+	if err != nil {
+		return fmt.Errorf("object pointer encoding failed: %w", err)
+	}
+	defer clear(ptr)
+
+	keyID, ptrCipher, sealed, err := m.seal(ctx, ptr)
+	if err != nil {
+		return err
+	}
+	record.Data, record.KeyID, record.Cipher = sealed, keyID, ptrCipher
+	record.Storage = storageObject
+	memOpsCounter.WithLabelValues("offload", "success").Inc()
+	return nil
+}
+
+// fetchObject downloads and decrypts the payload a sealed pointer refers to
+func (m *MemoryAdapter) fetchObject(ctx context.Context, rawPointer []byte) ([]byte, error) {
+	var ptr objectPointer
+	if err := json.Unmarshal(rawPointer, &ptr); err != nil {
+		return nil, fmt.Errorf("object pointer decoding failed: %w", err)
+	}
+	defer clear(ptr.DEK)
+	if m.config.Offload.Store == nil || ptr.Store != m.config.Offload.Store.Name() {
+		return nil, fmt.Errorf("object store %q not configured", ptr.Store)
+	}
+
+	aead, err := newMemoryAEAD(ptr.Cipher, ptr.DEK)
+	if err != nil {
+		return nil, err
+	}
+	body, err := m.config.Offload.Store.Get(ctx, ptr.Key)
+	if err != nil {
+		memOpsCounter.WithLabelValues("object_fetch", "error").Inc()
+		return nil, fmt.Errorf("object download failed: %w", err)
+	}
+	defer body.Close()
+
+	compressed := bytes.NewBuffer(make([]byte, 0, ptr.Size))
+	stream := &archiveStream{aead: aead}
+	for {
+		kind, chunk, err := stream.readFrame(body)
+		if err != nil {
+			return nil, fmt.Errorf("object %s: %w", ptr.Key, err)
+		}
+		if kind == frameEnd {
+			break
+		}
+		if kind != frameChunk || int64(compressed.Len()+len(chunk)) > ptr.Size {
+			return nil, fmt.Errorf("object %s: %w", ptr.Key, ErrArchiveCorrupt)
+		}
+		compressed.Write(chunk)
+	}
+	if sum := sha256.Sum256(compressed.Bytes()); !bytes.Equal(sum[:], ptr.SHA256) {
+		return nil, fmt.Errorf("object %s: %w", ptr.Key, ErrArchiveCorrupt)
+	}
+
+	plaintext, err := m.decoder.DecodeAll(compressed.Bytes(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("decompression failed: %w", err)
+	}
+	memOpsCounter.WithLabelValues("object_fetch", "success").Inc()
+	return plaintext, nil
+}
+
+// pinObjects marks the offloaded payloads of recordIDs as held by a
+// snapshot, or releases them. Failures are only counted and logged: an
+// unpinned object falls back to the lifecycle backstop.
+func (m *MemoryAdapter) pinObjects(ctx context.Context, recordIDs []string, pinned bool) {
+	pinner, ok := m.config.Offload.Store.(ObjectPinner)
+	if !ok {
+		return
+	}
+	for _, id := range recordIDs {
+		err := pinner.SetPinned(ctx, objectKey(id), pinned)
+		if err != nil && !errors.Is(err, ErrObjectNotFound) {
+			memOpsCounter.WithLabelValues("object_pin", "error").Inc()
+			slog.Warn("memory object pin update failed", "key", objectKey(id), "pinned", pinned, "error", err)
+			continue
+		}
+		memOpsCounter.WithLabelValues("object_pin", "success").Inc()
+	}
+}
+
+// deleteObjects removes offloaded payloads for deleted records. Failures
+// are left to the bucket lifecycle rule.
+func (m *MemoryAdapter) deleteObjects(ctx context.Context, recordIDs []string) {
+	if m.config.Offload.Store == nil {
+		return
+	}
+	for _, id := range recordIDs {
+		if err := m.config.Offload.Store.Delete(ctx, objectKey(id)); err != nil {
+			memOpsCounter.WithLabelValues("object_delete", "error").Inc()
+			continue
+		}
+		memOpsCounter.WithLabelValues("object_delete", "success").Inc()
+	}
+}
@@ -0,0 +1,244 @@
+// core/memory/object_stores.go
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// s3PinnedTag marks S3 objects a snapshot holds; the lifecycle rule only
+// matches objects tagged false
+const s3PinnedTag = "nuzon-pinned"
+
+// S3ObjectStore offloads payloads to an S3 bucket using multipart uploads
+type S3ObjectStore struct {
+	client   *s3.Client
+	uploader *manager.Uploader
+	bucket   string
+}
+
+func NewS3ObjectStore(client *s3.Client, bucket string) *S3ObjectStore {
+	return &S3ObjectStore{client: client, uploader: manager.NewUploader(client), bucket: bucket}
+}
+
+func (s *S3ObjectStore) Name() string { return "s3:" + s.bucket }
+
+func (s *S3ObjectStore) Put(ctx context.Context, key string, body io.Reader, expiresAt time.Time) error {
+	tagging := "nuzon-expires-at=" + expiresAt.UTC().Format("2006-01-02") + "&" + s3PinnedTag + "=false"
+	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		Body:                 body,
+		ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+		Tagging:              aws.String(tagging),
+	})
+	return err
+}
+
+func (s *S3ObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var missing *s3types.NoSuchKey
+	if errors.As(err, &missing) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *S3ObjectStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// SetPinned retags the object, keeping its other tags, so the lifecycle
+// rule skips it while pinned
+func (s *S3ObjectStore) SetPinned(ctx context.Context, key string, pinned bool) error {
+	out, err := s.client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey" {
+		return ErrObjectNotFound
+	}
+	if err != nil {
+		return err
+	}
+	tags := []s3types.Tag{{Key: aws.String(s3PinnedTag), Value: aws.String(strconv.FormatBool(pinned))}}
+	for _, t := range out.TagSet {
+		if aws.ToString(t.Key) != s3PinnedTag {
+			tags = append(tags, t)
+		}
+	}
+	_, err = s.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     aws.String(key),
+		Tagging: &s3types.Tagging{TagSet: tags},
+	})
+	return err
+}
+
+// EnsureLifecycle installs a bucket rule expiring memory objects after maxAge,
+// a backstop for objects the GC could not delete. Objects pinned by a
+// snapshot are excluded through their nuzon-pinned tag; objects uploaded
+// before that tag existed carry none and are not expired by the rule. It
+// replaces the bucket's existing lifecycle configuration.
+func (s *S3ObjectStore) EnsureLifecycle(ctx context.Context, maxAge time.Duration) error {
+	days := int32(maxAge.Hours()/24) + 1
+	_, err := s.client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s.bucket),
+		LifecycleConfiguration: &s3types.BucketLifecycleConfiguration{
+			Rules: []s3types.LifecycleRule{{
+				ID:     aws.String("nuzon-memory-expiry"),
+				Status: s3types.ExpirationStatusEnabled,
+				Filter: &s3types.LifecycleRuleFilter{And: &s3types.LifecycleRuleAndOperator{
+					Prefix: aws.String(objectKeyPrefix),
+					Tags:   []s3types.Tag{{Key: aws.String(s3PinnedTag), Value: aws.String("false")}},
+				}},
+				Expiration: &s3types.LifecycleExpiration{Days: aws.Int32(days)},
+			}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("s3 lifecycle update failed: %w", err)
+	}
+	return nil
+}
+
+// GCSObjectStore offloads payloads to a Cloud Storage bucket
+type GCSObjectStore struct {
+	bucket *storage.BucketHandle
+	name   string
+}
+
+func NewGCSObjectStore(client *storage.Client, bucket string) *GCSObjectStore {
+	return &GCSObjectStore{bucket: client.Bucket(bucket), name: bucket}
+}
+
+func (g *GCSObjectStore) Name() string { return "gcs:" + g.name }
+
+func (g *GCSObjectStore) Put(ctx context.Context, key string, body io.Reader, expiresAt time.Time) error {
+	w := g.bucket.Object(key).NewWriter(ctx)
+	// CustomTime drives the DaysSinceCustomTime lifecycle condition
+	w.CustomTime = expiresAt
+	if _, err := io.Copy(w, body); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (g *GCSObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := g.bucket.Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return r, err
+}
+
+func (g *GCSObjectStore) Delete(ctx context.Context, key string) error {
+	// a held object cannot be deleted, and erasure removes pinned records
+	err := g.SetPinned(ctx, key, false)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = g.bucket.Object(key).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+// SetPinned places or releases a temporary hold on the object; lifecycle
+// rules never delete held objects
+func (g *GCSObjectStore) SetPinned(ctx context.Context, key string, pinned bool) error {
+	_, err := g.bucket.Object(key).Update(ctx, storage.ObjectAttrsToUpdate{TemporaryHold: pinned})
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+// EnsureLifecycle deletes memory objects grace after their record expires.
+// Objects pinned by a snapshot are under a temporary hold and skipped. It
+// replaces the bucket's existing lifecycle rules.
+func (g *GCSObjectStore) EnsureLifecycle(ctx context.Context, grace time.Duration) error {
+	_, err := g.bucket.Update(ctx, storage.BucketAttrsToUpdate{
+		Lifecycle: &storage.Lifecycle{Rules: []storage.LifecycleRule{{
+			Action: storage.LifecycleAction{Type: storage.DeleteAction},
+			Condition: storage.LifecycleCondition{
+				DaysSinceCustomTime: int64(grace.Hours()/24) + 1,
+				MatchesPrefix:       []string{objectKeyPrefix},
+			},
+		}}},
+	})
+	if err != nil {
+		return fmt.Errorf("gcs lifecycle update failed: %w", err)
+	}
+	return nil
+}
+
+// AzureBlobStore offloads payloads to an Azure Blob Storage container.
+// Lifecycle management policies are account-level ARM resources, so expiry
+// beyond the memory GC must be configured on the storage account.
+type AzureBlobStore struct {
+	client    *azblob.Client
+	container string
+}
+
+func NewAzureBlobStore(client *azblob.Client, container string) *AzureBlobStore {
+	return &AzureBlobStore{client: client, container: container}
+}
+
+func (a *AzureBlobStore) Name() string { return "azblob:" + a.container }
+
+func (a *AzureBlobStore) Put(ctx context.Context, key string, body io.Reader, expiresAt time.Time) error {
+	expires := expiresAt.UTC().Format(time.RFC3339)
+	_, err := a.client.UploadStream(ctx, a.container, key, body, &azblob.UploadStreamOptions{
+		Metadata: map[string]*string{"nuzon_expires_at": &expires},
+	})
+	return err
+}
+
+func (a *AzureBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := a.client.DownloadStream(ctx, a.container, key, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (a *AzureBlobStore) Delete(ctx context.Context, key string) error {
+	_, err := a.client.DeleteBlob(ctx, a.container, key, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil
+	}
+	return err
+}
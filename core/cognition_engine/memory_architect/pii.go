@@ -0,0 +1,297 @@
+// core/memory/pii.go
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PII labels produced by the built-in classifier
+const (
+	PIIEmail = "email"
+	PIISSN   = "ssn"
+	PIICard  = "card_number"
+)
+
+// PIIMode selects what happens to detected PII
+type PIIMode int
+
+const (
+	// PIITag records labels in metadata and stores the payload unchanged
+	PIITag PIIMode = iota
+	// PIIRedact replaces each finding with [REDACTED:<label>] before
+	// encryption and records labels in metadata
+	PIIRedact
+)
+
+var piiFindings = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_memory_pii_findings_total",
+	Help: "PII findings in memory writes by label and action",
+}, []string{"label", "action"})
+
+func init() {
+	prometheus.MustRegister(piiFindings)
+}
+
+// PIIFinding locates one detected entity as a byte range of the input
+type PIIFinding struct {
+	Label string `json:"label"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// PIIClassifier finds PII in a single string value of a memory payload
+type PIIClassifier interface {
+	Classify(ctx context.Context, text string) ([]PIIFinding, error)
+}
+
+// PIIConfig enables the classification stage on memory writes. Findings from
+// all classifiers are merged; a classifier error fails the write rather than
+// letting unscreened data through.
+type PIIConfig struct {
+	Classifiers []PIIClassifier
+	Mode        PIIMode
+}
+
+// RegexClassifier detects emails, US SSNs and Luhn-valid card numbers
+type RegexClassifier struct{}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	ssnPattern   = regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+	cardPattern  = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`)
+)
+
+func (RegexClassifier) Classify(_ context.Context, text string) ([]PIIFinding, error) {
+	var findings []PIIFinding
+	for _, loc := range emailPattern.FindAllStringIndex(text, -1) {
+		findings = append(findings, PIIFinding{Label: PIIEmail, Start: loc[0], End: loc[1]})
+	}
+	for _, loc := range ssnPattern.FindAllStringIndex(text, -1) {
+		findings = append(findings, PIIFinding{Label: PIISSN, Start: loc[0], End: loc[1]})
+	}
+	for _, loc := range cardPattern.FindAllStringIndex(text, -1) {
+		if luhnValid(text[loc[0]:loc[1]]) {
+			findings = append(findings, PIIFinding{Label: PIICard, Start: loc[0], End: loc[1]})
+		}
+	}
+	return findings, nil
+}
+
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// HTTPClassifier delegates to an ML entity-recognition service that accepts
+// {"text": "..."} and answers {"findings": [{"label", "start", "end"}]}
+type HTTPClassifier struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func (c *HTTPClassifier) Classify(ctx context.Context, text string) ([]PIIFinding, error) {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("PII classifier request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("PII classifier request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("PII classifier returned %s", resp.Status)
+	}
+
+	var out struct {
+		Findings []PIIFinding `json:"findings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("PII classifier response invalid: %w", err)
+	}
+	for _, f := range out.Findings {
+		if f.Start < 0 || f.End > len(text) || f.Start >= f.End {
+			return nil, fmt.Errorf("PII classifier returned out-of-range finding %+v", f)
+		}
+	}
+	return out.Findings, nil
+}
+
+// screenPII runs the configured classifiers over every string and number in
+// a JSON payload, redacting in place when configured, and merges pii_labels
+// and pii_redacted into metadata. Payloads pass through untouched when no
+// classifier is configured.
+func (m *MemoryAdapter) screenPII(ctx context.Context, plaintext, metadata []byte) ([]byte, []byte, error) {
+	cfg := m.config.PII
+	if len(cfg.Classifiers) == 0 {
+		return plaintext, metadata, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(plaintext))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("PII screening failed: %w", err)
+	}
+
+	labels := make(map[string]bool)
+	doc, err := m.screenValue(ctx, doc, labels)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PII screening failed: %w", err)
+	}
+	if len(labels) == 0 {
+		return plaintext, metadata, nil
+	}
+
+	action := "tagged"
+	if cfg.Mode == PIIRedact {
+		action = "redacted"
+		if plaintext, err = json.Marshal(doc); err != nil {
+			return nil, nil, fmt.Errorf("PII screening failed: %w", err)
+		}
+	}
+
+	sorted := make([]string, 0, len(labels))
+	for label := range labels {
+		sorted = append(sorted, label)
+		piiFindings.WithLabelValues(label, action).Inc()
+	}
+	sort.Strings(sorted)
+
+	meta := map[string]any{}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &meta); err != nil {
+			return nil, nil, fmt.Errorf("metadata parse failed: %w", err)
+		}
+	}
+	meta["pii_labels"] = sorted
+	meta["pii_redacted"] = cfg.Mode == PIIRedact
+	if metadata, err = json.Marshal(meta); err != nil {
+		return nil, nil, fmt.Errorf("metadata serialization failed: %w", err)
+	}
+	return plaintext, metadata, nil
+}
+
+func (m *MemoryAdapter) screenValue(ctx context.Context, v any, labels map[string]bool) (any, error) {
+	switch val := v.(type) {
+	case map[string]any:
+		// keys are screened in order so the suffixes that keep redacted
+		// keys apart are stable
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make(map[string]any, len(val))
+		for _, k := range keys {
+			// keys carry data too, e.g. objects keyed by email address
+			key, err := m.screenText(ctx, k, labels)
+			if err != nil {
+				return nil, err
+			}
+			// distinct keys may redact to the same text; none may be lost
+			for n, base := 2, key; ; n++ {
+				if _, taken := out[key]; !taken {
+					break
+				}
+				key = fmt.Sprintf("%s#%d", base, n)
+			}
+			screened, err := m.screenValue(ctx, val[k], labels)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = screened
+		}
+		return out, nil
+	case []any:
+		for i, child := range val {
+			screened, err := m.screenValue(ctx, child, labels)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = screened
+		}
+		return val, nil
+	case string:
+		return m.screenText(ctx, val, labels)
+	case json.Number:
+		// Card numbers and the like are sometimes serialized as bare numbers
+		redacted, err := m.screenText(ctx, val.String(), labels)
+		if err != nil || redacted == val.String() {
+			return val, err
+		}
+		return redacted, nil
+	}
+	return v, nil
+}
+
+func (m *MemoryAdapter) screenText(ctx context.Context, text string, labels map[string]bool) (string, error) {
+	var findings []PIIFinding
+	for _, c := range m.config.PII.Classifiers {
+		found, err := c.Classify(ctx, text)
+		if err != nil {
+			return "", err
+		}
+		findings = append(findings, found...)
+	}
+	if len(findings) == 0 {
+		return text, nil
+	}
+	for _, f := range findings {
+		labels[f.Label] = true
+	}
+	if m.config.PII.Mode != PIIRedact {
+		return text, nil
+	}
+
+	// Overlapping findings collapse into the earliest one
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+	var sb strings.Builder
+	pos := 0
+	for _, f := range findings {
+		if f.Start < pos {
+			if f.End > pos {
+				pos = f.End
+			}
+			continue
+		}
+		sb.WriteString(text[pos:f.Start])
+		sb.WriteString("[REDACTED:" + f.Label + "]")
+		pos = f.End
+	}
+	sb.WriteString(text[pos:])
+	return sb.String(), nil
+}
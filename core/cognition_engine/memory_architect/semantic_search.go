@@ -0,0 +1,132 @@
+// core/memory/semantic_search.go
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Embedder turns text into a dense vector; the embeddings package's
+// Embedder satisfies it through its Text adapter
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// VectorIndex stores memory embeddings partitioned by agent; vectordb's
+// MemoryIndex implements it over any vector store
+type VectorIndex interface {
+	Upsert(ctx context.Context, agentID, memoryID string, vector []float32) error
+	Search(ctx context.Context, agentID string, vector []float32, k int) ([]VectorMatch, error)
+}
+
+// VectorMatch is one nearest-neighbour hit; higher scores are more relevant
+type VectorMatch struct {
+	MemoryID string
+	Score    float32
+}
+
+// RecalledMemory is a decrypted memory ranked by relevance to a query
+type RecalledMemory struct {
+	ID        string
+	Version   int
+	Class     MemoryClass
+	Data      []byte
+	Score     float32
+	CreatedAt time.Time
+}
+
+// SearchMemories embeds query, finds the k nearest memories for agentID and
+// returns them decrypted, most relevant first
+func (m *MemoryAdapter) SearchMemories(ctx context.Context, agentID, query string, k int) ([]RecalledMemory, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("search").Observe(time.Since(start).Seconds())
+	}()
+
+	if m.config.Embedder == nil || m.config.Index == nil {
+		memOpsCounter.WithLabelValues("search", "error").Inc()
+		return nil, fmt.Errorf("semantic search not configured")
+	}
+
+	vector, err := m.config.Embedder.Embed(ctx, query)
+	if err != nil {
+		memOpsCounter.WithLabelValues("search", "error").Inc()
+		return nil, fmt.Errorf("query embedding failed: %w", err)
+	}
+
+	matches, err := m.config.Index.Search(ctx, agentID, vector, k)
+	if err != nil {
+		memOpsCounter.WithLabelValues("search", "error").Inc()
+		return nil, fmt.Errorf("vector search failed: %w", err)
+	}
+	if len(matches) == 0 {
+		memOpsCounter.WithLabelValues("search", "success").Inc()
+		return nil, nil
+	}
+
+	scores := make(map[string]float32, len(matches))
+	ids := make([]string, 0, len(matches))
+	for _, match := range matches {
+		scores[match.MemoryID] = match.Score
+		ids = append(ids, match.MemoryID)
+	}
+
+	// agent_id is re-checked so a stale or shared index can never leak
+	// another agent's memories
+	q, args, err := sqlx.In(
+		`SELECT * FROM memories
+		 WHERE agent_id = ? AND id IN (?) AND (expires_at IS NULL OR expires_at > NOW())`, agentID, ids)
+	if err != nil {
+		memOpsCounter.WithLabelValues("search", "error").Inc()
+		return nil, fmt.Errorf("query build failed: %w", err)
+	}
+	var records []MemoryRecord
+	if err := m.db.SelectContext(ctx, &records, m.db.Rebind(q), args...); err != nil {
+		memOpsCounter.WithLabelValues("search", "error").Inc()
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	recalled := make([]RecalledMemory, 0, len(records))
+	for _, record := range records {
+		// one unreadable record, e.g. under a shredded key, must not hide
+		// the rest of the results
+		data, err := m.openRecord(ctx, record)
+		if err != nil {
+			memOpsCounter.WithLabelValues("search", "skipped").Inc()
+			continue
+		}
+		recalled = append(recalled, RecalledMemory{
+			ID:        record.ID,
+			Version:   record.Version,
+			Class:     record.Class,
+			Data:      data,
+			Score:     scores[record.ID],
+			CreatedAt: record.CreatedAt,
+		})
+	}
+	sort.Slice(recalled, func(i, j int) bool { return recalled[i].Score > recalled[j].Score })
+
+	memOpsCounter.WithLabelValues("search", "success").Inc()
+	return recalled, nil
+}
+
+// indexMemory embeds a freshly stored record; failures leave the record
+// retrievable by version and are reported through memOpsCounter
+func (m *MemoryAdapter) indexMemory(ctx context.Context, record MemoryRecord, plaintext []byte) {
+	if m.config.Embedder == nil || m.config.Index == nil {
+		return
+	}
+	vector, err := m.config.Embedder.Embed(ctx, string(plaintext))
+	if err == nil {
+		err = m.config.Index.Upsert(ctx, record.AgentID, record.ID, vector)
+	}
+	if err != nil {
+		memOpsCounter.WithLabelValues("index", "error").Inc()
+		return
+	}
+	memOpsCounter.WithLabelValues("index", "success").Inc()
+}
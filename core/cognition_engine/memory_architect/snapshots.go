@@ -0,0 +1,342 @@
+// core/memory/snapshots.go
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrSnapshotNotFound is returned for unknown or pruned snapshot IDs
+	ErrSnapshotNotFound = errors.New("memory snapshot not found")
+	// ErrSnapshotForked is returned when removing a snapshot would take
+	// away records a fork still reads through it
+	ErrSnapshotForked = errors.New("memory snapshot is shared by a fork")
+)
+
+// notPinned excludes records held by a snapshot from GC and compaction
+const notPinned = `NOT EXISTS (SELECT 1 FROM memory_snapshot_members p WHERE p.memory_id = memories.id)`
+
+// notForked keeps retention from dropping the snapshots forks share
+// records through
+const notForked = `NOT EXISTS (SELECT 1 FROM memory_forks f WHERE f.snapshot_id = memory_snapshots.id)`
+
+// SnapshotRetention bounds how many snapshots each agent keeps. Pruned
+// snapshots release their records to normal GC and compaction.
+type SnapshotRetention struct {
+	// KeepLast keeps the newest N snapshots per agent; zero keeps all
+	KeepLast int
+	// MaxAge drops snapshots older than this; zero keeps them forever
+	MaxAge time.Duration
+}
+
+// Snapshot is a consistent cut of an agent's memory. It stores pointers to
+// the records that existed at Version rather than copies of them.
+type Snapshot struct {
+	ID        string    `db:"id"`
+	AgentID   string    `db:"agent_id"`
+	Name      string    `db:"name"`
+	Version   int       `db:"version"`
+	Records   int       `db:"records"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// CreateSnapshot pins every record of agentID up to its latest version and
+// applies the retention policy. Pinned records have their expiry cleared,
+// and their offloaded objects are marked pinned so bucket lifecycle rules
+// skip them, so they stay readable and restorable for as long as a
+// snapshot holds them; once the last such snapshot is gone they expire
+// recordTTL after creation as usual.
+func (m *MemoryAdapter) CreateSnapshot(ctx context.Context, agentID, name string) (Snapshot, error) {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("snapshot").Observe(time.Since(start).Seconds())
+	}()
+
+	snap, objects, err := m.createSnapshot(ctx, agentID, name)
+	if err != nil {
+		memOpsCounter.WithLabelValues("snapshot", "error").Inc()
+		return Snapshot{}, err
+	}
+	memOpsCounter.WithLabelValues("snapshot", "success").Inc()
+	m.pinObjects(ctx, objects, true)
+
+	if err := m.PruneSnapshots(ctx, agentID); err != nil {
+		slog.Warn("snapshot retention failed", "agent_id", agentID, "error", err)
+	}
+	return snap, nil
+}
+
+// createSnapshot returns the snapshot and the newly pinned records whose
+// payloads are offloaded
+func (m *MemoryAdapter) createSnapshot(ctx context.Context, agentID, name string) (Snapshot, []string, error) {
+	// Repeatable read keeps the version and member set on the same cut
+	tx, err := m.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return Snapshot{}, nil, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	snap := Snapshot{
+		ID:        generateUUID(),
+		AgentID:   agentID,
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := tx.GetContext(ctx, &snap.Version,
+		`SELECT COALESCE(MAX(version), 0) FROM memories WHERE agent_id = $1`, agentID); err != nil {
+		return Snapshot{}, nil, fmt.Errorf("snapshot version query failed: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO memory_snapshots (id, tenant_id, agent_id, name, version, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		snap.ID, TenantFromContext(ctx), agentID, name, snap.Version, snap.CreatedAt); err != nil {
+		return Snapshot{}, nil, fmt.Errorf("snapshot insert failed: %w", err)
+	}
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO memory_snapshot_members (snapshot_id, memory_id)
+		 SELECT $1, id FROM memories WHERE agent_id = $2 AND version <= $3`,
+		snap.ID, agentID, snap.Version)
+	if err != nil {
+		return Snapshot{}, nil, fmt.Errorf("snapshot member insert failed: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	snap.Records = int(n)
+	var objects []string
+	if err := tx.SelectContext(ctx, &objects,
+		`WITH pinned AS (
+		     UPDATE memories SET expires_at = NULL
+		     WHERE agent_id = $1 AND version <= $2 AND expires_at IS NOT NULL
+		     RETURNING id, storage)
+		 SELECT id FROM pinned WHERE storage = $3`,
+		agentID, snap.Version, storageObject); err != nil {
+		return Snapshot{}, nil, fmt.Errorf("snapshot pinning failed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Snapshot{}, nil, fmt.Errorf("commit failed: %w", err)
+	}
+	return snap, objects, nil
+}
+
+// ListSnapshots returns agentID's snapshots, newest first
+func (m *MemoryAdapter) ListSnapshots(ctx context.Context, agentID string) ([]Snapshot, error) {
+	var snaps []Snapshot
+	if err := m.db.SelectContext(ctx, &snaps,
+		`SELECT s.id, s.agent_id, s.name, s.version, s.created_at,
+		        (SELECT COUNT(*) FROM memory_snapshot_members p WHERE p.snapshot_id = s.id) AS records
+		 FROM memory_snapshots s
+		 WHERE s.agent_id = $1
+		 ORDER BY s.created_at DESC`, agentID); err != nil {
+		return nil, fmt.Errorf("snapshot query failed: %w", err)
+	}
+	return snaps, nil
+}
+
+// RestoreSnapshot rolls agentID back to the snapshot: records written after
+// it are deleted and the next write continues from the snapshot's version.
+// Snapshots taken after the target are dropped, since their records no
+// longer exist; if a fork branched from one of them the restore is refused
+// with ErrSnapshotForked, as the fork still reads those records.
+func (m *MemoryAdapter) RestoreSnapshot(ctx context.Context, agentID, snapshotID string) error {
+	start := time.Now()
+	defer func() {
+		memLatencyHist.WithLabelValues("restore").Observe(time.Since(start).Seconds())
+	}()
+
+	if err := m.restoreSnapshot(ctx, agentID, snapshotID); err != nil {
+		memOpsCounter.WithLabelValues("restore", "error").Inc()
+		return err
+	}
+	memOpsCounter.WithLabelValues("restore", "success").Inc()
+	return nil
+}
+
+func (m *MemoryAdapter) restoreSnapshot(ctx context.Context, agentID, snapshotID string) error {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var snap Snapshot
+	if err := tx.GetContext(ctx, &snap,
+		`SELECT id, agent_id, name, version, created_at, 0 AS records
+		 FROM memory_snapshots
+		 WHERE id = $1 AND agent_id = $2
+		 FOR UPDATE`, snapshotID, agentID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSnapshotNotFound
+		}
+		return fmt.Errorf("snapshot lookup failed: %w", err)
+	}
+
+	var forks []string
+	if err := tx.SelectContext(ctx, &forks,
+		`SELECT f.agent_id FROM memory_forks f
+		 JOIN memory_snapshots s ON s.id = f.snapshot_id
+		 WHERE s.agent_id = $1 AND s.created_at > $2
+		 ORDER BY f.agent_id`, agentID, snap.CreatedAt); err != nil {
+		return fmt.Errorf("fork lookup failed: %w", err)
+	}
+	if len(forks) > 0 {
+		return fmt.Errorf("%w: later snapshots are forked by %s", ErrSnapshotForked, strings.Join(forks, ", "))
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM memory_snapshots
+		 WHERE agent_id = $1 AND created_at > $2`, agentID, snap.CreatedAt); err != nil {
+		return fmt.Errorf("later snapshot removal failed: %w", err)
+	}
+
+	var rows []expiredRow
+	if err := tx.SelectContext(ctx, &rows,
+		`DELETE FROM memories
+		 WHERE agent_id = $1
+		   AND id NOT IN (SELECT memory_id FROM memory_snapshot_members WHERE snapshot_id = $2)
+		 RETURNING id, agent_id, version, content_hash, storage, octet_length(data) AS size`,
+		agentID, snap.ID); err != nil {
+		return fmt.Errorf("rollback failed: %w", err)
+	}
+	released, err := releasePins(ctx, tx, agentID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		refs    []blobRef
+		objects []string
+		ids     []string
+		freed   int64
+	)
+	for _, row := range rows {
+		freed += row.Size
+		ids = append(ids, row.ID)
+		if row.ContentHash != nil {
+			refs = append(refs, blobRef{AgentID: row.AgentID, ContentHash: row.ContentHash})
+		}
+		if row.Storage == storageObject {
+			objects = append(objects, row.ID)
+		}
+	}
+	blobs, err := releaseBlobs(ctx, tx, refs)
+	if err != nil {
+		return err
+	}
+	freed += blobs[agentID]
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+
+	for _, row := range rows {
+		m.invalidate(ctx, row.AgentID, row.Version)
+	}
+	m.pinObjects(ctx, released, false)
+	memSizeGauge.WithLabelValues(agentID).Sub(float64(freed))
+	m.deleteObjects(ctx, objects)
+	if eraser, ok := m.config.Index.(VectorEraser); ok && len(ids) > 0 {
+		if err := eraser.Delete(ctx, agentID, ids); err != nil {
+			slog.Warn("vector cleanup after restore failed", "agent_id", agentID, "error", err)
+		}
+	}
+	return nil
+}
+
+// DeleteSnapshot drops a snapshot, releasing its records to GC. Snapshots
+// a fork branched from are kept and ErrSnapshotForked is returned.
+func (m *MemoryAdapter) DeleteSnapshot(ctx context.Context, agentID, snapshotID string) error {
+	var forked bool
+	if err := m.db.GetContext(ctx, &forked,
+		`SELECT EXISTS (SELECT 1 FROM memory_forks WHERE snapshot_id = $1)`, snapshotID); err != nil {
+		return fmt.Errorf("fork lookup failed: %w", err)
+	}
+	if forked {
+		return fmt.Errorf("%w: %s", ErrSnapshotForked, snapshotID)
+	}
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM memory_snapshots WHERE id = $1 AND agent_id = $2`, snapshotID, agentID)
+	if err != nil {
+		return fmt.Errorf("snapshot delete failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSnapshotNotFound
+	}
+	released, err := releasePins(ctx, tx, agentID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	m.pinObjects(ctx, released, false)
+	return nil
+}
+
+// PruneSnapshots applies the configured retention policy to agentID
+func (m *MemoryAdapter) PruneSnapshots(ctx context.Context, agentID string) error {
+	policy := m.config.Snapshots
+	if policy.MaxAge > 0 {
+		if _, err := m.db.ExecContext(ctx,
+			`DELETE FROM memory_snapshots
+			 WHERE agent_id = $1 AND created_at < $2 AND `+notForked,
+			agentID, time.Now().Add(-policy.MaxAge)); err != nil {
+			return fmt.Errorf("snapshot age pruning failed: %w", err)
+		}
+	}
+	if policy.KeepLast > 0 {
+		if _, err := m.db.ExecContext(ctx,
+			`DELETE FROM memory_snapshots
+			 WHERE agent_id = $1 AND `+notForked+` AND id NOT IN (
+			     SELECT id FROM memory_snapshots
+			     WHERE agent_id = $1
+			     ORDER BY created_at DESC
+			     LIMIT $2)`, agentID, policy.KeepLast); err != nil {
+			return fmt.Errorf("snapshot count pruning failed: %w", err)
+		}
+	}
+	released, err := releasePins(ctx, m.db, agentID)
+	if err != nil {
+		return err
+	}
+	m.pinObjects(ctx, released, false)
+	return nil
+}
+
+// releasePins gives agentID's records that no snapshot pins any longer
+// back the expiry CreateSnapshot cleared. It returns those whose payloads
+// are offloaded, for pinObjects to release once the change commits.
+func releasePins(ctx context.Context, q sqlx.QueryerContext, agentID string) ([]string, error) {
+	var objects []string
+	if err := sqlx.SelectContext(ctx, q, &objects,
+		`WITH released AS (
+		     UPDATE memories SET expires_at = created_at + make_interval(secs => $2)
+		     WHERE agent_id = $1 AND expires_at IS NULL AND `+notPinned+`
+		     RETURNING id, storage)
+		 SELECT id FROM released WHERE storage = $3`,
+		agentID, recordTTL.Seconds(), storageObject); err != nil {
+		return nil, fmt.Errorf("expiry release failed: %w", err)
+	}
+	return objects, nil
+}
+
+// expiry is when the record expires once no snapshot pins it
+func (r MemoryRecord) expiry() time.Time {
+	if r.ExpiresAt.Valid {
+		return r.ExpiresAt.Time
+	}
+	return r.CreatedAt.Add(recordTTL)
+}
@@ -0,0 +1,306 @@
+// core/memory/tenant_keys.go
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultTenant owns memories stored without a tenant in the context
+const DefaultTenant = "default"
+
+// ErrKeyShredded is returned when a record's tenant key has been destroyed
+var ErrKeyShredded = errors.New("tenant key destroyed")
+
+// keyCacheTTL bounds how long an unwrapped DEK is served from memory, so a
+// replica that missed a shred's invalidation stops decrypting within it
+const keyCacheTTL = 5 * time.Minute
+
+type tenantCtxKey struct{}
+
+// WithTenant scopes memory operations on ctx to tenantID
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant set by WithTenant, or DefaultTenant
+func TenantFromContext(ctx context.Context) string {
+	if t, ok := ctx.Value(tenantCtxKey{}).(string); ok && t != "" {
+		return t
+	}
+	return DefaultTenant
+}
+
+// KeyEncryptionKey generates and unwraps tenant data keys; the crypto
+// package's EnvelopeEncryptor satisfies it
+type KeyEncryptionKey interface {
+	DataKeyProvider
+	GenerateDataKey(ctx context.Context) ([32]byte, []byte, error)
+}
+
+type tenantKeyRow struct {
+	KeyID      string `db:"key_id"`
+	TenantID   string `db:"tenant_id"`
+	WrappedDEK []byte `db:"wrapped_dek"`
+}
+
+type cachedKey struct {
+	key     [32]byte
+	expires time.Time
+}
+
+// TenantKeyring is a MemoryKeyring holding one active data encryption key
+// per tenant, each wrapped by the KEK. Destroying a tenant's wrapped keys
+// renders all of its memories unrecoverable (crypto-shredding).
+type TenantKeyring struct {
+	db  *sqlx.DB
+	kek KeyEncryptionKey
+
+	mu   sync.RWMutex
+	keys map[string]cachedKey
+	// active is each tenant's active key ID, sparing every seal the lookup
+	active map[string]string
+}
+
+// NewTenantKeyring stores wrapped tenant DEKs in the tenant_keys table
+func NewTenantKeyring(db *sqlx.DB, kek KeyEncryptionKey) *TenantKeyring {
+	return &TenantKeyring{
+		db:     db,
+		kek:    kek,
+		keys:   make(map[string]cachedKey),
+		active: make(map[string]string),
+	}
+}
+
+// ActiveKey returns the current DEK for the tenant on ctx, creating one on
+// first use
+func (k *TenantKeyring) ActiveKey(ctx context.Context) (string, [32]byte, error) {
+	tenantID := TenantFromContext(ctx)
+
+	k.mu.RLock()
+	keyID, ok := k.active[tenantID]
+	k.mu.RUnlock()
+	if ok {
+		if key, ok := k.cached(keyID); ok {
+			return keyID, key, nil
+		}
+	}
+
+	var row tenantKeyRow
+	err := k.db.GetContext(ctx, &row,
+		`SELECT key_id, tenant_id, wrapped_dek FROM tenant_keys
+		 WHERE tenant_id = $1 AND state = 'active'`, tenantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return k.createKey(ctx, tenantID)
+	}
+	if err != nil {
+		return "", [32]byte{}, fmt.Errorf("tenant key query failed: %w", err)
+	}
+	key, err := k.unwrap(ctx, row)
+	if err != nil {
+		return "", [32]byte{}, err
+	}
+	k.mu.Lock()
+	k.active[tenantID] = row.KeyID
+	k.mu.Unlock()
+	return row.KeyID, key, nil
+}
+
+// Key resolves any non-destroyed DEK by ID
+func (k *TenantKeyring) Key(ctx context.Context, keyID string) ([32]byte, error) {
+	if key, ok := k.cached(keyID); ok {
+		return key, nil
+	}
+
+	var row tenantKeyRow
+	err := k.db.GetContext(ctx, &row,
+		`SELECT key_id, tenant_id, wrapped_dek FROM tenant_keys WHERE key_id = $1`, keyID)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("tenant key query failed: %w", err)
+	}
+	return k.unwrap(ctx, row)
+}
+
+// Rotate retires the tenant's active DEK and creates a new one. Records
+// sealed under the retired key stay readable and are re-encrypted lazily
+// as they are read.
+func (k *TenantKeyring) Rotate(ctx context.Context, tenantID string) (string, error) {
+	if _, err := k.db.ExecContext(ctx,
+		`UPDATE tenant_keys SET state = 'retired', retired_at = NOW()
+		 WHERE tenant_id = $1 AND state = 'active'`, tenantID); err != nil {
+		return "", fmt.Errorf("tenant key retire failed: %w", err)
+	}
+	k.mu.Lock()
+	delete(k.active, tenantID)
+	k.mu.Unlock()
+	keyID, _, err := k.createKey(ctx, tenantID)
+	return keyID, err
+}
+
+// Shred destroys every wrapped DEK belonging to tenantID and returns the
+// destroyed key IDs
+func (k *TenantKeyring) Shred(ctx context.Context, tenantID string) ([]string, error) {
+	var keyIDs []string
+	if err := k.db.SelectContext(ctx, &keyIDs,
+		`UPDATE tenant_keys
+		 SET state = 'destroyed', wrapped_dek = NULL, destroyed_at = NOW()
+		 WHERE tenant_id = $1 AND state <> 'destroyed'
+		 RETURNING key_id`, tenantID); err != nil {
+		return nil, fmt.Errorf("tenant key destruction failed: %w", err)
+	}
+	k.forget(tenantID, keyIDs)
+	return keyIDs, nil
+}
+
+// forget evicts a tenant's DEKs from memory; other replicas call it when
+// a shred's invalidation reaches them
+func (k *TenantKeyring) forget(tenantID string, keyIDs []string) {
+	k.mu.Lock()
+	for _, id := range keyIDs {
+		if entry, ok := k.keys[id]; ok {
+			clear(entry.key[:])
+			delete(k.keys, id)
+		}
+	}
+	delete(k.active, tenantID)
+	k.mu.Unlock()
+	if p, ok := k.kek.(interface{ Purge() }); ok {
+		p.Purge()
+	}
+}
+
+// cached returns an unwrapped DEK younger than keyCacheTTL, evicting it
+// once older
+func (k *TenantKeyring) cached(keyID string) ([32]byte, bool) {
+	k.mu.RLock()
+	entry, ok := k.keys[keyID]
+	k.mu.RUnlock()
+	if !ok {
+		return [32]byte{}, false
+	}
+	if time.Now().Before(entry.expires) {
+		return entry.key, true
+	}
+	k.mu.Lock()
+	if entry, ok := k.keys[keyID]; ok && !time.Now().Before(entry.expires) {
+		clear(entry.key[:])
+		delete(k.keys, keyID)
+	}
+	k.mu.Unlock()
+	return [32]byte{}, false
+}
+
+func (k *TenantKeyring) remember(keyID string, key [32]byte) {
+	k.mu.Lock()
+	k.keys[keyID] = cachedKey{key: key, expires: time.Now().Add(keyCacheTTL)}
+	k.mu.Unlock()
+}
+
+func (k *TenantKeyring) createKey(ctx context.Context, tenantID string) (string, [32]byte, error) {
+	key, wrapped, err := k.kek.GenerateDataKey(ctx)
+	if err != nil {
+		return "", [32]byte{}, fmt.Errorf("tenant key generation failed: %w", err)
+	}
+	keyID := generateUUID()
+
+	// The partial unique index on active keys makes concurrent first use
+	// converge on a single DEK
+	var winner tenantKeyRow
+	err = k.db.GetContext(ctx, &winner,
+		`WITH ins AS (
+		     INSERT INTO tenant_keys (key_id, tenant_id, wrapped_dek, state, created_at)
+		     VALUES ($1, $2, $3, 'active', $4)
+		     ON CONFLICT DO NOTHING
+		     RETURNING key_id, tenant_id, wrapped_dek)
+		 SELECT key_id, tenant_id, wrapped_dek FROM ins
+		 UNION ALL
+		 SELECT key_id, tenant_id, wrapped_dek FROM tenant_keys
+		 WHERE tenant_id = $2 AND state = 'active'
+		 LIMIT 1`, keyID, tenantID, wrapped, time.Now().UTC())
+	if err != nil {
+		return "", [32]byte{}, fmt.Errorf("tenant key insert failed: %w", err)
+	}
+	if winner.KeyID != keyID {
+		clear(key[:])
+		if key, err = k.unwrap(ctx, winner); err != nil {
+			return "", [32]byte{}, err
+		}
+	} else {
+		k.remember(keyID, key)
+	}
+
+	k.mu.Lock()
+	k.active[tenantID] = winner.KeyID
+	k.mu.Unlock()
+	return winner.KeyID, key, nil
+}
+
+func (k *TenantKeyring) unwrap(ctx context.Context, row tenantKeyRow) ([32]byte, error) {
+	if len(row.WrappedDEK) == 0 {
+		return [32]byte{}, fmt.Errorf("key %s: %w", row.KeyID, ErrKeyShredded)
+	}
+	key, err := k.kek.DataKey(ctx, row.WrappedDEK)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("tenant key unwrap failed: %w", err)
+	}
+	k.remember(row.KeyID, key)
+	return key, nil
+}
+
+// ShredTenant crypto-shreds a tenant: its DEKs are destroyed and every
+// memory sealed under them becomes permanently unreadable
+func (m *MemoryAdapter) ShredTenant(ctx context.Context, tenantID string) error {
+	keyring, ok := m.config.Keyring.(*TenantKeyring)
+	if !ok {
+		return fmt.Errorf("crypto-shredding requires a TenantKeyring")
+	}
+	keyIDs, err := keyring.Shred(ctx, tenantID)
+	if err != nil {
+		memOpsCounter.WithLabelValues("shred", "error").Inc()
+		return err
+	}
+	for _, id := range keyIDs {
+		m.aeads.drop(id)
+	}
+	// other replicas drop the keys and every cached record of the tenant
+	m.cache.Purge()
+	m.publishInvalidation(ctx, invalidation{All: true, TenantID: tenantID, KeyIDs: keyIDs})
+	memOpsCounter.WithLabelValues("shred", "success").Inc()
+	return nil
+}
+
+// reencryptIfStale re-seals a record under its tenant's active key after a
+// successful read; failures are non-fatal since the record stays readable
+func (m *MemoryAdapter) reencryptIfStale(ctx context.Context, record MemoryRecord, plaintext []byte) {
+	// Shared blobs and object pointers are re-encrypted by the bulk rotation
+	if m.config.Keyring == nil || record.KeyID == dedupKeyID || record.Storage == storageObject {
+		return
+	}
+	ctx = WithTenant(ctx, record.TenantID)
+	activeID, _, err := m.config.Keyring.ActiveKey(ctx)
+	if err != nil || (activeID == record.KeyID && m.sealingCipher() == record.Cipher) {
+		return
+	}
+	keyID, cipherName, sealed, err := m.seal(ctx, plaintext)
+	if err != nil {
+		memOpsCounter.WithLabelValues("reencrypt", "error").Inc()
+		return
+	}
+	// Guarding on the old key_id avoids clobbering a concurrent re-encryption
+	if _, err := m.db.ExecContext(ctx,
+		`UPDATE memories SET data = $1, key_id = $2, cipher = $3
+		 WHERE id = $4 AND key_id = $5`,
+		sealed, keyID, cipherName, record.ID, record.KeyID); err != nil {
+		memOpsCounter.WithLabelValues("reencrypt", "error").Inc()
+		return
+	}
+	m.invalidate(ctx, record.AgentID, record.Version)
+	memSizeGauge.WithLabelValues(record.AgentID).Add(float64(len(sealed) - len(record.Data)))
+	memOpsCounter.WithLabelValues("reencrypt", "success").Inc()
+}
@@ -0,0 +1,138 @@
+// core/memory/working_redis.go
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisWorkingStore keeps each agent's working memory in a Redis list,
+// newest item at the head
+type RedisWorkingStore struct {
+	client redis.UniversalClient
+	prefix string
+	// IdleTTL drops an agent's working set after this long without writes
+	IdleTTL time.Duration
+}
+
+// NewRedisWorkingStore creates a working-memory tier on client
+func NewRedisWorkingStore(client redis.UniversalClient, idleTTL time.Duration) *RedisWorkingStore {
+	return &RedisWorkingStore{client: client, prefix: "nuzon:memory:working:", IdleTTL: idleTTL}
+}
+
+func (s *RedisWorkingStore) key(agentID string) string {
+	return s.prefix + agentID
+}
+
+func (s *RedisWorkingStore) Push(ctx context.Context, agentID string, item []byte) (int64, error) {
+	key := s.key(agentID)
+	pipe := s.client.TxPipeline()
+	push := pipe.LPush(ctx, key, item)
+	if s.IdleTTL > 0 {
+		pipe.Expire(ctx, key, s.IdleTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("redis push failed: %w", err)
+	}
+	return push.Val(), nil
+}
+
+func (s *RedisWorkingStore) Recent(ctx context.Context, agentID string, n int) ([][]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	vals, err := s.client.LRange(ctx, s.key(agentID), 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis range failed: %w", err)
+	}
+	return toBytes(vals), nil
+}
+
+func (s *RedisWorkingStore) Oldest(ctx context.Context, agentID string, n int) ([][]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	vals, err := s.client.LRange(ctx, s.key(agentID), int64(-n), -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis range failed: %w", err)
+	}
+	// the tail holds the oldest item last
+	for i, j := 0, len(vals)-1; i < j; i, j = i+1, j-1 {
+		vals[i], vals[j] = vals[j], vals[i]
+	}
+	return toBytes(vals), nil
+}
+
+func (s *RedisWorkingStore) TrimOldest(ctx context.Context, agentID string, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if err := s.client.LTrim(ctx, s.key(agentID), 0, int64(-n-1)).Err(); err != nil {
+		return fmt.Errorf("redis trim failed: %w", err)
+	}
+	return nil
+}
+
+// Agents lists the agents holding working memory
+func (s *RedisWorkingStore) Agents(ctx context.Context) ([]string, error) {
+	var agents []string
+	iter := s.client.Scan(ctx, 0, s.prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		agents = append(agents, strings.TrimPrefix(iter.Val(), s.prefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("redis scan failed: %w", err)
+	}
+	return agents, nil
+}
+
+// Remove deletes the given items from the agent's working memory
+func (s *RedisWorkingStore) Remove(ctx context.Context, agentID string, items [][]byte) (int64, error) {
+	key := s.key(agentID)
+	pipe := s.client.TxPipeline()
+	removed := make([]*redis.IntCmd, len(items))
+	for i, item := range items {
+		removed[i] = pipe.LRem(ctx, key, 0, item)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("redis remove failed: %w", err)
+	}
+	var n int64
+	for _, cmd := range removed {
+		n += cmd.Val()
+	}
+	return n, nil
+}
+
+// replaceScript swaps the first occurrence of ARGV[1] for ARGV[2],
+// keeping the item's position in the list
+var replaceScript = redis.NewScript(`
+local i = redis.call('LPOS', KEYS[1], ARGV[1])
+if not i then
+  return 0
+end
+redis.call('LSET', KEYS[1], i, ARGV[2])
+return 1
+`)
+
+// Replace swaps item old for updated in the agent's working memory,
+// reporting false when old is no longer there
+func (s *RedisWorkingStore) Replace(ctx context.Context, agentID string, old, updated []byte) (bool, error) {
+	n, err := replaceScript.Run(ctx, s.client, []string{s.key(agentID)}, old, updated).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis replace failed: %w", err)
+	}
+	return n == 1, nil
+}
+
+func toBytes(vals []string) [][]byte {
+	out := make([][]byte, len(vals))
+	for i, v := range vals {
+		out[i] = []byte(v)
+	}
+	return out
+}
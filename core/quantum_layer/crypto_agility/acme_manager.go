@@ -0,0 +1,182 @@
+// acme_manager.go - ACME Certificate Issuance and Hot Reload
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	defaultRenewBefore  = 30 * 24 * time.Hour
+	certRefreshInterval = 1 * time.Hour
+)
+
+var ErrNoCertificate = errors.New("certificate not yet issued")
+
+// ACMEConfig selects the ACME directory (Let's Encrypt or an internal CA)
+type ACMEConfig struct {
+	DirectoryURL string
+	Email        string
+	Hosts        []string
+	CacheDir     string
+	RenewBefore  time.Duration
+	// ExternalAccountBinding is required by most internal/enterprise ACME CAs
+	ExternalAccountBinding *acme.ExternalAccountBinding
+}
+
+// CertLifecycleManager issues and renews certificates and pushes every new
+// certificate to registered TLS consumers without a restart
+type CertLifecycleManager struct {
+	manager  *autocert.Manager
+	primary  string
+	current  atomic.Pointer[tls.Certificate]
+	mu       sync.Mutex
+	onRotate []func(*tls.Certificate)
+	logger   *slog.Logger
+}
+
+// NewCertLifecycleManager configures ACME issuance for cfg.Hosts
+func NewCertLifecycleManager(cfg ACMEConfig) (*CertLifecycleManager, error) {
+	if len(cfg.Hosts) == 0 {
+		return nil, errors.New("at least one certificate host is required")
+	}
+	if cfg.RenewBefore == 0 {
+		cfg.RenewBefore = defaultRenewBefore
+	}
+
+	client := &acme.Client{DirectoryURL: cfg.DirectoryURL}
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = acme.LetsEncryptURL
+	}
+
+	return &CertLifecycleManager{
+		manager: &autocert.Manager{
+			Prompt:                 autocert.AcceptTOS,
+			Cache:                  autocert.DirCache(cfg.CacheDir),
+			HostPolicy:             autocert.HostWhitelist(cfg.Hosts...),
+			RenewBefore:            cfg.RenewBefore,
+			Client:                 client,
+			Email:                  cfg.Email,
+			ExternalAccountBinding: cfg.ExternalAccountBinding,
+		},
+		primary: cfg.Hosts[0],
+		logger:  slog.Default().With("component", "acme"),
+	}, nil
+}
+
+// Run keeps the primary certificate fresh until ctx is cancelled
+func (c *CertLifecycleManager) Run(ctx context.Context) error {
+	if err := c.refresh(ctx); err != nil {
+		return fmt.Errorf("initial certificate issuance failed: %w", err)
+	}
+
+	ticker := time.NewTicker(certRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.refresh(ctx); err != nil {
+				c.logger.Error("certificate refresh failed", "host", c.primary, "error", err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *CertLifecycleManager) refresh(ctx context.Context) error {
+	cert, err := c.lookup(ctx, &tls.ClientHelloInfo{ServerName: c.primary})
+	if err != nil {
+		return err
+	}
+
+	prev := c.current.Load()
+	if prev != nil && len(prev.Certificate) > 0 && bytes.Equal(prev.Certificate[0], cert.Certificate[0]) {
+		return nil
+	}
+	c.current.Store(cert)
+
+	c.logger.Info("certificate rotated", "host", c.primary, "not_after", cert.Leaf.NotAfter)
+
+	c.mu.Lock()
+	hooks := append([]func(*tls.Certificate){}, c.onRotate...)
+	c.mu.Unlock()
+	for _, hook := range hooks {
+		hook(cert)
+	}
+	return nil
+}
+
+// OnRotate registers a callback invoked with each newly issued certificate
+func (c *CertLifecycleManager) OnRotate(fn func(*tls.Certificate)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onRotate = append(c.onRotate, fn)
+}
+
+// GetCertificate serves server certificates; assign to tls.Config.GetCertificate
+func (c *CertLifecycleManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName == "" {
+		if cert := c.current.Load(); cert != nil {
+			return cert, nil
+		}
+	}
+	return c.lookup(hello.Context(), hello)
+}
+
+// lookup runs the ACME lookup for hello, giving up when ctx ends. The
+// handshake's context is hello.Context(); autocert takes no context of
+// its own, so a lookup outliving ctx is left to finish in the background.
+func (c *CertLifecycleManager) lookup(ctx context.Context, hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	type result struct {
+		cert *tls.Certificate
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		cert, err := c.manager.GetCertificate(hello)
+		done <- result{cert, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.cert, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// GetClientCertificate serves the current certificate for outbound mTLS;
+// assign to tls.Config.GetClientCertificate
+func (c *CertLifecycleManager) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert := c.current.Load()
+	if cert == nil {
+		return nil, ErrNoCertificate
+	}
+	return cert, nil
+}
+
+// HTTPHandler answers http-01 challenges, falling back to fallback
+func (c *CertLifecycleManager) HTTPHandler(fallback http.Handler) http.Handler {
+	return c.manager.HTTPHandler(fallback)
+}
+
+// Bind installs hot-reloading certificate callbacks on cfg
+func (c *CertLifecycleManager) Bind(cfg *tls.Config) {
+	cfg.Certificates = nil
+	cfg.GetCertificate = c.GetCertificate
+	cfg.GetClientCertificate = c.GetClientCertificate
+	cfg.NextProtos = append(cfg.NextProtos, acme.ALPNProto)
+}
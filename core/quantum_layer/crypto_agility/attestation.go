@@ -0,0 +1,205 @@
+// attestation.go - Signed Proof-of-Rotation Attestations
+package crypto
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const attestationVersion = 1
+
+var ErrNoAttestor = errors.New("no rotation attestor configured")
+
+// AttestationSink persists attestations in the audit system
+type AttestationSink interface {
+	StoreAttestation(ctx context.Context, id string, jsonBody, cborBody []byte) error
+}
+
+// RotationAttestor signs proofs of rotation with a key chained to a verifier CA
+type RotationAttestor struct {
+	Signer crypto.Signer
+	// Chain holds the signing certificate followed by its issuers
+	Chain []*x509.Certificate
+	Sink  AttestationSink
+}
+
+// KeyFingerprint identifies a migrated key without revealing key material
+type KeyFingerprint struct {
+	KeyID  string `json:"key_id" cbor:"1,keyasint"`
+	SHA256 string `json:"sha256" cbor:"2,keyasint"`
+}
+
+// RotationStatement is the signed body of a proof of rotation
+type RotationStatement struct {
+	Version       int              `json:"version" cbor:"1,keyasint"`
+	ID            string           `json:"id" cbor:"2,keyasint"`
+	FromAlgorithm string           `json:"from_algorithm" cbor:"3,keyasint"`
+	ToAlgorithm   string           `json:"to_algorithm" cbor:"4,keyasint"`
+	NISTLevel     int              `json:"nist_level" cbor:"5,keyasint"`
+	StartedAt     time.Time        `json:"started_at" cbor:"6,keyasint"`
+	CompletedAt   time.Time        `json:"completed_at" cbor:"7,keyasint"`
+	Processed     int64            `json:"processed" cbor:"8,keyasint"`
+	Failed        int64            `json:"failed" cbor:"9,keyasint"`
+	OldKeys       []KeyFingerprint `json:"old_keys" cbor:"10,keyasint"`
+}
+
+// RotationAttestation pairs a statement with its signature and verifier chain
+type RotationAttestation struct {
+	Statement     RotationStatement `json:"statement" cbor:"1,keyasint"`
+	SignatureAlgo string            `json:"signature_algorithm" cbor:"2,keyasint"`
+	Signature     []byte            `json:"signature" cbor:"3,keyasint"`
+	VerifierChain [][]byte          `json:"verifier_chain" cbor:"4,keyasint"`
+}
+
+// rotationEvidence accumulates fingerprints of keys replaced during a run
+type rotationEvidence struct {
+	mu   sync.Mutex
+	keys []KeyFingerprint
+}
+
+func (r *rotationEvidence) record(id string, pubKey []byte) {
+	sum := sha256.Sum256(pubKey)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, KeyFingerprint{KeyID: id, SHA256: hex.EncodeToString(sum[:])})
+}
+
+func (r *rotationEvidence) drain() []KeyFingerprint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := r.keys
+	r.keys = nil
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+	return keys
+}
+
+// generateProofOfRotation signs the canonical CBOR encoding of the rotation
+// statement and stores JSON and CBOR renderings in the audit system
+func (e *KeyMigrationEngine) generateProofOfRotation(ctx context.Context) error {
+	if e.attestor.Signer == nil || e.attestor.Sink == nil {
+		return ErrNoAttestor
+	}
+
+	completed := time.Now().UTC()
+	stmt := RotationStatement{
+		Version:       attestationVersion,
+		ID:            fmt.Sprintf("rot-%d-%d-%d", e.currentAlgo.Type, e.targetAlgo.Type, completed.UnixNano()),
+		FromAlgorithm: algorithmName(e.currentAlgo.Type),
+		ToAlgorithm:   algorithmName(e.targetAlgo.Type),
+		NISTLevel:     e.targetAlgo.NISTLevel,
+		StartedAt:     e.metrics.StartTime.UTC(),
+		CompletedAt:   completed,
+		Processed:     e.metrics.Processed,
+		Failed:        e.metrics.Failed,
+		OldKeys:       e.evidence.drain(),
+	}
+
+	att, err := SignRotationStatement(e.attestor, stmt)
+	if err != nil {
+		return err
+	}
+
+	jsonBody, err := json.Marshal(att)
+	if err != nil {
+		return err
+	}
+	cborBody, err := cbor.Marshal(att)
+	if err != nil {
+		return err
+	}
+	return e.attestor.Sink.StoreAttestation(ctx, stmt.ID, jsonBody, cborBody)
+}
+
+// SignRotationStatement produces a detached signature over the canonical CBOR statement
+func SignRotationStatement(a RotationAttestor, stmt RotationStatement) (*RotationAttestation, error) {
+	enc, err := cbor.CanonicalEncOptions().EncMode()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := enc.Marshal(stmt)
+	if err != nil {
+		return nil, fmt.Errorf("statement encoding failed: %w", err)
+	}
+
+	digest := sha256.Sum256(payload)
+	sig, err := a.Signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("attestation signing failed: %w", err)
+	}
+
+	chain := make([][]byte, 0, len(a.Chain))
+	for _, cert := range a.Chain {
+		chain = append(chain, cert.Raw)
+	}
+
+	return &RotationAttestation{
+		Statement:     stmt,
+		SignatureAlgo: signatureAlgorithm(a.Signer.Public()),
+		Signature:     sig,
+		VerifierChain: chain,
+	}, nil
+}
+
+// VerifyRotationAttestation checks the signature and that the signing
+// certificate chains to one of roots
+func VerifyRotationAttestation(att *RotationAttestation, roots *x509.CertPool) error {
+	if len(att.VerifierChain) == 0 {
+		return errors.New("attestation has no verifier chain")
+	}
+	leaf, err := x509.ParseCertificate(att.VerifierChain[0])
+	if err != nil {
+		return fmt.Errorf("signing certificate invalid: %w", err)
+	}
+	intermediates := x509.NewCertPool()
+	for _, raw := range att.VerifierChain[1:] {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("chain certificate invalid: %w", err)
+		}
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   att.Statement.CompletedAt,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("verifier chain rejected: %w", err)
+	}
+
+	enc, err := cbor.CanonicalEncOptions().EncMode()
+	if err != nil {
+		return err
+	}
+	payload, err := enc.Marshal(att.Statement)
+	if err != nil {
+		return err
+	}
+	algo := x509.SHA256WithRSA
+	if att.SignatureAlgo == "ECDSA-SHA256" {
+		algo = x509.ECDSAWithSHA256
+	}
+	return leaf.CheckSignature(algo, payload, att.Signature)
+}
+
+func signatureAlgorithm(pub crypto.PublicKey) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "RSA-PKCS1-SHA256"
+	default:
+		return "ECDSA-SHA256"
+	}
+}
@@ -0,0 +1,424 @@
+// envelope.go - Cloud KMS Envelope Encryption for Data Keys
+package crypto
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	awskms "github.com/aws/aws-sdk-go-v2/service/kms"
+	awskmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+const (
+	dataKeySize       = 32
+	defaultDataKeyTTL = 15 * time.Minute
+	maxCachedDataKeys = 1024
+)
+
+var ErrWrappedKeyMalformed = errors.New("wrapped data key is malformed")
+
+// WrappedKey is the persisted form of a KMS-wrapped data key
+type WrappedKey struct {
+	Provider   string `json:"provider"`
+	KeyID      string `json:"key_id"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// KMSProvider wraps and unwraps data keys under a cloud-managed KEK
+type KMSProvider interface {
+	Name() string
+	Wrap(ctx context.Context, plaintext []byte, aad map[string]string) (WrappedKey, error)
+	Unwrap(ctx context.Context, wrapped WrappedKey, aad map[string]string) ([]byte, error)
+	// CurrentKeyID reports the KEK version new wraps are produced under
+	CurrentKeyID(ctx context.Context) (string, error)
+}
+
+// UnwrapAuditor receives a record of every data key unwrap
+type UnwrapAuditor interface {
+	RecordUnwrap(ctx context.Context, provider, keyID, purpose string, err error)
+}
+
+// EnvelopeConfig tunes caching and rotation behaviour
+type EnvelopeConfig struct {
+	Purpose  string
+	CacheTTL time.Duration
+	// OnRewrap persists a data key re-wrapped under the current KEK version
+	OnRewrap func(ctx context.Context, old, updated []byte) error
+}
+
+type cachedDataKey struct {
+	key     [dataKeySize]byte
+	expires time.Time
+}
+
+// EnvelopeEncryptor resolves data keys for subsystems holding only wrapped material
+type EnvelopeEncryptor struct {
+	kms     KMSProvider
+	auditor UnwrapAuditor
+	config  EnvelopeConfig
+	cache   map[string]cachedDataKey
+	mu      sync.Mutex
+	logger  *slog.Logger
+}
+
+// NewEnvelopeEncryptor creates an envelope provider backed by kms
+func NewEnvelopeEncryptor(kms KMSProvider, auditor UnwrapAuditor, cfg EnvelopeConfig) *EnvelopeEncryptor {
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = defaultDataKeyTTL
+	}
+	return &EnvelopeEncryptor{
+		kms:     kms,
+		auditor: auditor,
+		config:  cfg,
+		cache:   make(map[string]cachedDataKey),
+		logger:  slog.Default().With("component", "envelope", "provider", kms.Name()),
+	}
+}
+
+// GenerateDataKey creates a fresh 256-bit data key and returns its wrapped encoding
+func (e *EnvelopeEncryptor) GenerateDataKey(ctx context.Context) ([dataKeySize]byte, []byte, error) {
+	var key [dataKeySize]byte
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return key, nil, fmt.Errorf("data key generation failed: %w", err)
+	}
+
+	wrapped, err := e.kms.Wrap(ctx, key[:], e.aad())
+	if err != nil {
+		return key, nil, fmt.Errorf("data key wrap failed: %w", err)
+	}
+
+	blob, err := json.Marshal(wrapped)
+	if err != nil {
+		return key, nil, err
+	}
+	e.remember(blob, key)
+	return key, blob, nil
+}
+
+// DataKey unwraps blob, serving from cache when possible and re-wrapping stale KEK versions
+func (e *EnvelopeEncryptor) DataKey(ctx context.Context, blob []byte) ([dataKeySize]byte, error) {
+	if key, ok := e.lookup(blob); ok {
+		return key, nil
+	}
+
+	var key [dataKeySize]byte
+	var wrapped WrappedKey
+	if err := json.Unmarshal(blob, &wrapped); err != nil {
+		return key, fmt.Errorf("%w: %v", ErrWrappedKeyMalformed, err)
+	}
+
+	plaintext, err := e.kms.Unwrap(ctx, wrapped, e.aad())
+	if e.auditor != nil {
+		e.auditor.RecordUnwrap(ctx, e.kms.Name(), wrapped.KeyID, e.config.Purpose, err)
+	}
+	if err != nil {
+		return key, fmt.Errorf("data key unwrap failed: %w", err)
+	}
+	if len(plaintext) != dataKeySize {
+		return key, fmt.Errorf("%w: unexpected key length %d", ErrWrappedKeyMalformed, len(plaintext))
+	}
+	copy(key[:], plaintext)
+	zero(plaintext)
+
+	e.remember(blob, key)
+
+	if err := e.rewrapIfStale(ctx, wrapped, blob, key); err != nil {
+		// The unwrapped key is still valid; rotation will be retried on the next unwrap
+		e.logger.Warn("data key re-wrap failed", "key_id", wrapped.KeyID, "error", err)
+	}
+	return key, nil
+}
+
+func (e *EnvelopeEncryptor) rewrapIfStale(ctx context.Context, wrapped WrappedKey, blob []byte, key [dataKeySize]byte) error {
+	if e.config.OnRewrap == nil {
+		return nil
+	}
+	current, err := e.kms.CurrentKeyID(ctx)
+	if err != nil {
+		return err
+	}
+	if current == wrapped.KeyID {
+		return nil
+	}
+
+	rewrapped, err := e.kms.Wrap(ctx, key[:], e.aad())
+	if err != nil {
+		return err
+	}
+	updated, err := json.Marshal(rewrapped)
+	if err != nil {
+		return err
+	}
+	if err := e.config.OnRewrap(ctx, blob, updated); err != nil {
+		return err
+	}
+
+	e.remember(updated, key)
+	e.logger.Info("data key re-wrapped after KEK rotation", "from", wrapped.KeyID, "to", current)
+	return nil
+}
+
+// Purge drops all cached plaintext data keys
+func (e *EnvelopeEncryptor) Purge() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, entry := range e.cache {
+		zero(entry.key[:])
+		delete(e.cache, id)
+	}
+}
+
+func (e *EnvelopeEncryptor) aad() map[string]string {
+	if e.config.Purpose == "" {
+		return nil
+	}
+	return map[string]string{"purpose": e.config.Purpose}
+}
+
+func (e *EnvelopeEncryptor) lookup(blob []byte) ([dataKeySize]byte, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := blobID(blob)
+	entry, ok := e.cache[id]
+	if !ok {
+		return [dataKeySize]byte{}, false
+	}
+	if time.Now().After(entry.expires) {
+		zero(entry.key[:])
+		delete(e.cache, id)
+		return [dataKeySize]byte{}, false
+	}
+	return entry.key, true
+}
+
+func (e *EnvelopeEncryptor) remember(blob []byte, key [dataKeySize]byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.cache) >= maxCachedDataKeys {
+		now := time.Now()
+		for id, entry := range e.cache {
+			if now.After(entry.expires) {
+				delete(e.cache, id)
+			}
+		}
+		if len(e.cache) >= maxCachedDataKeys {
+			return
+		}
+	}
+	e.cache[blobID(blob)] = cachedDataKey{key: key, expires: time.Now().Add(e.config.CacheTTL)}
+}
+
+func blobID(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return hex.EncodeToString(sum[:])
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// AWS KMS
+
+type AWSKMSProvider struct {
+	client *awskms.Client
+	keyID  string
+}
+
+func NewAWSKMSProvider(cfg aws.Config, keyID string) *AWSKMSProvider {
+	return &AWSKMSProvider{client: awskms.NewFromConfig(cfg), keyID: keyID}
+}
+
+func (p *AWSKMSProvider) Name() string { return "aws-kms" }
+
+func (p *AWSKMSProvider) Wrap(ctx context.Context, plaintext []byte, aad map[string]string) (WrappedKey, error) {
+	out, err := p.client.Encrypt(ctx, &awskms.EncryptInput{
+		KeyId:               aws.String(p.keyID),
+		Plaintext:           plaintext,
+		EncryptionContext:   aad,
+		EncryptionAlgorithm: awskmstypes.EncryptionAlgorithmSpecSymmetricDefault,
+	})
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	keyID, err := p.versionedKeyID(ctx, awsKeyID(aws.ToString(out.KeyId)))
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	return WrappedKey{Provider: p.Name(), KeyID: keyID, Ciphertext: out.CiphertextBlob}, nil
+}
+
+func (p *AWSKMSProvider) Unwrap(ctx context.Context, wrapped WrappedKey, aad map[string]string) ([]byte, error) {
+	out, err := p.client.Decrypt(ctx, &awskms.DecryptInput{
+		KeyId:             aws.String(p.keyID),
+		CiphertextBlob:    wrapped.Ciphertext,
+		EncryptionContext: aad,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+func (p *AWSKMSProvider) CurrentKeyID(ctx context.Context) (string, error) {
+	out, err := p.client.DescribeKey(ctx, &awskms.DescribeKeyInput{KeyId: aws.String(p.keyID)})
+	if err != nil {
+		return "", err
+	}
+	return p.versionedKeyID(ctx, aws.ToString(out.KeyMetadata.KeyId))
+}
+
+// versionedKeyID appends the time of the key's latest rotation as
+// "<key ID>#<unix seconds>". AWS keeps the key ID when it rotates the
+// backing key material, so the bare ID alone never changes on rotation.
+// Keys never rotated keep the bare ID.
+func (p *AWSKMSProvider) versionedKeyID(ctx context.Context, keyID string) (string, error) {
+	var latest time.Time
+	pages := awskms.NewListKeyRotationsPaginator(p.client, &awskms.ListKeyRotationsInput{KeyId: aws.String(keyID)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("key rotation lookup failed: %w", err)
+		}
+		for _, r := range page.Rotations {
+			if at := aws.ToTime(r.RotationDate); at.After(latest) {
+				latest = at
+			}
+		}
+	}
+	if latest.IsZero() {
+		return keyID, nil
+	}
+	return fmt.Sprintf("%s#%d", keyID, latest.Unix()), nil
+}
+
+// awsKeyID reduces the key ARN KMS reports on Encrypt to the bare key ID
+// DescribeKey reports, so wraps compare equal to CurrentKeyID whether the
+// provider was configured with a key ID, ARN or alias
+func awsKeyID(keyARN string) string {
+	parsed, err := arn.Parse(keyARN)
+	if err != nil {
+		return keyARN
+	}
+	return strings.TrimPrefix(parsed.Resource, "key/")
+}
+
+// GCP Cloud KMS
+
+type GCPKMSProvider struct {
+	client  *kms.KeyManagementClient
+	keyName string
+}
+
+func NewGCPKMSProvider(ctx context.Context, keyName string) (*GCPKMSProvider, error) {
+	client, err := kms.NewKeyManagementClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gcp kms client init failed: %w", err)
+	}
+	return &GCPKMSProvider{client: client, keyName: keyName}, nil
+}
+
+func (p *GCPKMSProvider) Name() string { return "gcp-kms" }
+
+func (p *GCPKMSProvider) Wrap(ctx context.Context, plaintext []byte, aad map[string]string) (WrappedKey, error) {
+	resp, err := p.client.Encrypt(ctx, &kmspb.EncryptRequest{
+		Name:                        p.keyName,
+		Plaintext:                   plaintext,
+		AdditionalAuthenticatedData: encodeAAD(aad),
+	})
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	return WrappedKey{Provider: p.Name(), KeyID: resp.Name, Ciphertext: resp.Ciphertext}, nil
+}
+
+func (p *GCPKMSProvider) Unwrap(ctx context.Context, wrapped WrappedKey, aad map[string]string) ([]byte, error) {
+	resp, err := p.client.Decrypt(ctx, &kmspb.DecryptRequest{
+		Name:                        p.keyName,
+		Ciphertext:                  wrapped.Ciphertext,
+		AdditionalAuthenticatedData: encodeAAD(aad),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+func (p *GCPKMSProvider) CurrentKeyID(ctx context.Context) (string, error) {
+	key, err := p.client.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: p.keyName})
+	if err != nil {
+		return "", err
+	}
+	return key.Primary.GetName(), nil
+}
+
+// Azure Key Vault
+
+type AzureKeyVaultProvider struct {
+	client  *azkeys.Client
+	keyName string
+}
+
+func NewAzureKeyVaultProvider(client *azkeys.Client, keyName string) *AzureKeyVaultProvider {
+	return &AzureKeyVaultProvider{client: client, keyName: keyName}
+}
+
+func (p *AzureKeyVaultProvider) Name() string { return "azure-keyvault" }
+
+func (p *AzureKeyVaultProvider) Wrap(ctx context.Context, plaintext []byte, _ map[string]string) (WrappedKey, error) {
+	resp, err := p.client.WrapKey(ctx, p.keyName, "", azkeys.KeyOperationParameters{
+		Algorithm: to.Ptr(azkeys.EncryptionAlgorithmRSAOAEP256),
+		Value:     plaintext,
+	}, nil)
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	return WrappedKey{Provider: p.Name(), KeyID: string(*resp.KID), Ciphertext: resp.Result}, nil
+}
+
+func (p *AzureKeyVaultProvider) Unwrap(ctx context.Context, wrapped WrappedKey, _ map[string]string) ([]byte, error) {
+	// Unwrap against the exact version that produced the ciphertext
+	resp, err := p.client.UnwrapKey(ctx, p.keyName, azkeys.ID(wrapped.KeyID).Version(), azkeys.KeyOperationParameters{
+		Algorithm: to.Ptr(azkeys.EncryptionAlgorithmRSAOAEP256),
+		Value:     wrapped.Ciphertext,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Result, nil
+}
+
+func (p *AzureKeyVaultProvider) CurrentKeyID(ctx context.Context) (string, error) {
+	resp, err := p.client.GetKey(ctx, p.keyName, "", nil)
+	if err != nil {
+		return "", err
+	}
+	return string(*resp.Key.KID), nil
+}
+
+func encodeAAD(aad map[string]string) []byte {
+	if len(aad) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(aad)
+	return b
+}
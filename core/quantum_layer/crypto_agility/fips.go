@@ -0,0 +1,140 @@
+// fips.go - FIPS 140-3 Operating Mode
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/fips140"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	CipherAESGCM           = "aes-256-gcm"
+	CipherChaCha20Poly1305 = "chacha20-poly1305"
+)
+
+var ErrFIPSModuleInactive = errors.New("FIPS mode requested but the Go cryptographic module is not in FIPS 140-3 mode")
+
+// fipsMode is the single record of whether FIPS restrictions are in force.
+// It starts out as the build tag says; SetFIPSMode changes it at runtime.
+var fipsMode atomic.Bool
+
+func init() {
+	fipsMode.Store(fipsBuild)
+}
+
+// FIPSStatus is reported through the controller health endpoint
+type FIPSStatus struct {
+	Enabled       bool   `json:"enabled"`
+	BuildTag      bool   `json:"build_tag"`
+	ModuleActive  bool   `json:"module_active"`
+	SymmetricAEAD string `json:"symmetric_aead"`
+	Compliant     bool   `json:"compliant"`
+}
+
+// EnableFIPSFromEnv turns on FIPS mode when NUZON_FIPS_MODE=1 or the binary
+// was built with -tags fips, and verifies the Go module is running its
+// validated DRBG and algorithms (GODEBUG=fips140=on)
+func EnableFIPSFromEnv() error {
+	if fipsBuild || os.Getenv("NUZON_FIPS_MODE") == "1" {
+		return SetFIPSMode(true)
+	}
+	return nil
+}
+
+// SetFIPSMode toggles FIPS restrictions at runtime
+func SetFIPSMode(enabled bool) error {
+	if !enabled && fipsBuild {
+		return errors.New("FIPS mode cannot be disabled in a fips build")
+	}
+	if enabled && !fips140.Enabled() {
+		return ErrFIPSModuleInactive
+	}
+	fipsMode.Store(enabled)
+	return nil
+}
+
+// FIPSEnabled reports whether FIPS restrictions are in force
+func FIPSEnabled() bool {
+	return fipsMode.Load()
+}
+
+// CurrentFIPSStatus summarises FIPS posture for health reporting
+func CurrentFIPSStatus() FIPSStatus {
+	enabled := FIPSEnabled()
+	return FIPSStatus{
+		Enabled:       enabled,
+		BuildTag:      fipsBuild,
+		ModuleActive:  fips140.Enabled(),
+		SymmetricAEAD: SymmetricAEADName(),
+		Compliant:     !enabled || fips140.Enabled(),
+	}
+}
+
+// SymmetricAEADName returns the AEAD subsystems should seal new data with
+func SymmetricAEADName() string {
+	if FIPSEnabled() {
+		return CipherAESGCM
+	}
+	return CipherChaCha20Poly1305
+}
+
+// NewAEAD builds the named AEAD, refusing non-approved ciphers in FIPS mode
+func NewAEAD(name string, key []byte) (cipher.AEAD, error) {
+	switch name {
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherChaCha20Poly1305, "":
+		if FIPSEnabled() {
+			return nil, fmt.Errorf("%w: %s is not FIPS approved", ErrUnsupportedAlgorithm, CipherChaCha20Poly1305)
+		}
+		return chacha20poly1305.New(key)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, name)
+	}
+}
+
+// fipsTLSSuites are the TLS 1.2 suites permitted under SP 800-52r2
+var fipsTLSSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+}
+
+// ApplyFIPSTLS restricts cfg to FIPS-approved versions, suites and curves
+func ApplyFIPSTLS(cfg *tls.Config) *tls.Config {
+	if !FIPSEnabled() {
+		return cfg
+	}
+	out := cfg.Clone()
+	if out.MinVersion < tls.VersionTLS12 {
+		out.MinVersion = tls.VersionTLS12
+	}
+	out.CipherSuites = fipsTLSSuites
+	out.CurvePreferences = []tls.CurveID{tls.CurveP384, tls.CurveP256}
+	return out
+}
+
+// FIPSApproved reports whether an AlgorithmType may be used in FIPS mode.
+// Only algorithms served by the validated Go cryptographic module qualify:
+// Kyber768 and Dilithium3 are the round-3 schemes rather than ML-KEM and
+// ML-DSA, and SPHINCS+ comes from circl, outside the module boundary.
+func FIPSApproved(t AlgorithmType) bool {
+	switch t {
+	case RSA2048, ECDSA_P256, AES256_GCM:
+		return true
+	default:
+		return false
+	}
+}
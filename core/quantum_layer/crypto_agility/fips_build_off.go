@@ -0,0 +1,6 @@
+//go:build !fips
+
+package crypto
+
+// fipsBuild leaves FIPS mode to EnableFIPSFromEnv and SetFIPSMode
+const fipsBuild = false
@@ -0,0 +1,6 @@
+//go:build fips
+
+package crypto
+
+// fipsBuild forces FIPS mode in binaries built with -tags fips
+const fipsBuild = true
@@ -0,0 +1,570 @@
+// hsm_keystore.go - PKCS#11 Hardware Security Module Key Storage
+package crypto
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+var ErrKeyExportable = errors.New("HSM backend refuses software key material")
+
+var errHSMClosed = errors.New("HSM key store closed")
+
+// oidNamedCurveP256 is the DER-encoded CKA_EC_PARAMS for secp256r1
+var oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+
+// HSMConfig describes a PKCS#11 token (on-prem HSM or cloud HSM client library)
+type HSMConfig struct {
+	ModulePath  string
+	TokenLabel  string
+	PIN         string
+	SessionPool int
+	LegacyKey   []byte
+}
+
+// HSMKeyStore keeps private keys inside the token; only handles leave the device
+type HSMKeyStore struct {
+	ctx      *pkcs11.Ctx
+	slot     uint
+	sessions chan pkcs11.SessionHandle
+	config   HSMConfig
+	logger   *slog.Logger
+	mu       sync.Mutex
+	// live holds the objects currently serving each key ID. Rotation
+	// leaves the old and new objects sharing an ID until Archive retires
+	// the old one, so lookups by ID alone cannot tell them apart.
+	live map[string]keyHandles
+	// opened counts the pooled sessions, which Close waits to get back
+	opened int
+}
+
+type keyHandles struct {
+	private pkcs11.ObjectHandle
+	public  pkcs11.ObjectHandle
+}
+
+// NewHSMKeyStore loads the PKCS#11 module and opens a pool of logged-in sessions
+func NewHSMKeyStore(cfg HSMConfig) (*HSMKeyStore, error) {
+	p := pkcs11.New(cfg.ModulePath)
+	if p == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %s", cfg.ModulePath)
+	}
+	if err := p.Initialize(); err != nil {
+		return nil, fmt.Errorf("PKCS#11 initialize failed: %w", err)
+	}
+
+	slot, err := findTokenSlot(p, cfg.TokenLabel)
+	if err != nil {
+		p.Finalize()
+		return nil, err
+	}
+
+	if cfg.SessionPool <= 0 {
+		cfg.SessionPool = 4
+	}
+
+	h := &HSMKeyStore{
+		ctx:      p,
+		slot:     slot,
+		sessions: make(chan pkcs11.SessionHandle, cfg.SessionPool),
+		config:   cfg,
+		logger:   slog.Default().With("component", "hsm_keystore"),
+		live:     make(map[string]keyHandles),
+	}
+
+	for i := 0; i < cfg.SessionPool; i++ {
+		session, err := p.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("session open failed: %w", err)
+		}
+		// Login state is shared per application, so only the first session logs in
+		if i == 0 {
+			if err := p.Login(session, pkcs11.CKU_USER, cfg.PIN); err != nil {
+				p.CloseSession(session)
+				h.Close()
+				return nil, fmt.Errorf("token login failed: %w", err)
+			}
+		}
+		h.sessions <- session
+		h.opened++
+	}
+
+	return h, nil
+}
+
+func findTokenSlot(p *pkcs11.Ctx, label string) (uint, error) {
+	slots, err := p.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("slot enumeration failed: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := p.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if info.Label == label {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("token %q not present", label)
+}
+
+func (h *HSMKeyStore) acquire(ctx context.Context) (pkcs11.SessionHandle, error) {
+	select {
+	case s, ok := <-h.sessions:
+		if !ok {
+			return 0, errHSMClosed
+		}
+		return s, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (h *HSMKeyStore) release(s pkcs11.SessionHandle) {
+	h.sessions <- s
+}
+
+// GenerateKeyPair creates a non-extractable key pair on the token
+func (h *HSMKeyStore) GenerateKeyPair(ctx context.Context, id string, spec AlgorithmSpec) (crypto.Signer, error) {
+	session, err := h.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer h.release(session)
+
+	privTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_UNWRAP, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, id),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(id)),
+	}
+	pubTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, id),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(id)),
+	}
+
+	var mech *pkcs11.Mechanism
+	switch spec.Type {
+	case ECDSA_P256:
+		params, err := asn1.Marshal(oidNamedCurveP256)
+		if err != nil {
+			return nil, err
+		}
+		pubTemplate = append(pubTemplate, pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params))
+		mech = pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)
+	case RSA2048:
+		pubTemplate = append(pubTemplate,
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, 2048),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		)
+		mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)
+	default:
+		return nil, fmt.Errorf("%w on PKCS#11 token: %d", ErrUnsupportedAlgorithm, spec.Type)
+	}
+
+	pubHandle, privHandle, err := h.ctx.GenerateKeyPair(session, []*pkcs11.Mechanism{mech}, pubTemplate, privTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("in-device key generation failed: %w", err)
+	}
+
+	pub, err := h.exportPublic(session, pubHandle, spec.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	h.setLive(id, keyHandles{private: privHandle, public: pubHandle})
+	h.logger.Info("generated key pair in HSM", "key_id", id, "algorithm", spec.Type)
+	return &hsmSigner{store: h, handle: privHandle, pubHandle: pubHandle, public: pub, algo: spec.Type, id: id}, nil
+}
+
+func (h *HSMKeyStore) exportPublic(session pkcs11.SessionHandle, handle pkcs11.ObjectHandle, algo AlgorithmType) (crypto.PublicKey, error) {
+	switch algo {
+	case ECDSA_P256:
+		attrs, err := h.ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("public key read failed: %w", err)
+		}
+		var point []byte
+		if _, err := asn1.Unmarshal(attrs[0].Value, &point); err != nil {
+			return nil, fmt.Errorf("EC point decode failed: %w", err)
+		}
+		x, y := elliptic.Unmarshal(elliptic.P256(), point)
+		if x == nil {
+			return nil, errors.New("invalid EC point from token")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case RSA2048:
+		attrs, err := h.ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("public key read failed: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		}, nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// Store records the key under id; only handles produced by GenerateKeyPair are accepted
+func (h *HSMKeyStore) Store(ctx context.Context, id string, key crypto.PrivateKey, spec AlgorithmSpec) error {
+	signer, ok := key.(*hsmSigner)
+	if !ok || signer.store != h {
+		return fmt.Errorf("%w: key %s must be generated on the token", ErrKeyExportable, id)
+	}
+	if signer.id == id {
+		return nil
+	}
+
+	session, err := h.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer h.release(session)
+
+	label := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, id),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(id)),
+	}
+	if err := h.ctx.SetAttributeValue(session, signer.handle, label); err != nil {
+		return fmt.Errorf("key relabel failed: %w", err)
+	}
+	if err := h.ctx.SetAttributeValue(session, signer.pubHandle, label); err != nil {
+		return fmt.Errorf("public key relabel failed: %w", err)
+	}
+	h.mu.Lock()
+	// the objects no longer answer to their old ID
+	if stale, ok := h.live[signer.id]; ok && stale.private == signer.handle {
+		delete(h.live, signer.id)
+	}
+	h.live[id] = keyHandles{private: signer.handle, public: signer.pubHandle}
+	h.mu.Unlock()
+	signer.id = id
+	return nil
+}
+
+// Archive retires the token objects for key id without destroying them.
+// Objects generated or stored under id by this store stay live, so after a
+// rotation only the superseded key pair is retired; the retired objects
+// move to the archived:<id> label and ID and lose CKA_SIGN. An id this
+// store holds no live objects for is reported as not found, so the only
+// key pair under it is never retired.
+func (h *HSMKeyStore) Archive(ctx context.Context, id string, key crypto.PrivateKey) error {
+	h.mu.Lock()
+	live, ok := h.live[id]
+	h.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: no live key %s to rotate away from", ErrKeyNotFound, id)
+	}
+
+	session, err := h.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer h.release(session)
+
+	privs, err := h.findObjects(session, pkcs11.CKO_PRIVATE_KEY, id)
+	if err != nil {
+		return err
+	}
+	pubs, err := h.findObjects(session, pkcs11.CKO_PUBLIC_KEY, id)
+	if err != nil {
+		return err
+	}
+
+	retired := 0
+	for _, handle := range privs {
+		if handle == live.private {
+			continue
+		}
+		if err := h.ctx.SetAttributeValue(session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, "archived:"+id),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, []byte("archived:"+id)),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, false),
+		}); err != nil {
+			return fmt.Errorf("key archive failed: %w", err)
+		}
+		retired++
+	}
+	for _, handle := range pubs {
+		if handle == live.public {
+			continue
+		}
+		if err := h.ctx.SetAttributeValue(session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, "archived:"+id),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, []byte("archived:"+id)),
+		}); err != nil {
+			return fmt.Errorf("public key archive failed: %w", err)
+		}
+	}
+	h.logger.Info("archived HSM key", "key_id", id, "retired", retired)
+	return nil
+}
+
+func (h *HSMKeyStore) setLive(id string, handles keyHandles) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.live[id] = handles
+}
+
+func (h *HSMKeyStore) GetLegacyKey() []byte {
+	return h.config.LegacyKey
+}
+
+// Signer returns a crypto.Signer backed by the token object for id
+func (h *HSMKeyStore) Signer(ctx context.Context, id string, algo AlgorithmType) (crypto.Signer, error) {
+	session, err := h.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer h.release(session)
+
+	priv, err := h.findPrivateKey(session, id)
+	if err != nil {
+		return nil, err
+	}
+	pubHandle, err := h.findObject(session, pkcs11.CKO_PUBLIC_KEY, id)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := h.exportPublic(session, pubHandle, algo)
+	if err != nil {
+		return nil, err
+	}
+	return &hsmSigner{store: h, handle: priv, pubHandle: pubHandle, public: pub, algo: algo, id: id}, nil
+}
+
+// Unwrap decrypts a wrapped AES key into a session object that stays on the token
+func (h *HSMKeyStore) Unwrap(ctx context.Context, wrappingID string, wrapped []byte) (pkcs11.ObjectHandle, error) {
+	session, err := h.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer h.release(session)
+
+	wrappingKey, err := h.findPrivateKey(session, wrappingID)
+	if err != nil {
+		return 0, err
+	}
+
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+		pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+	}
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_OAEP,
+		pkcs11.NewOAEPParams(pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256, pkcs11.CKZ_DATA_SPECIFIED, nil))}
+
+	handle, err := h.ctx.UnwrapKey(session, mech, wrappingKey, wrapped, template)
+	if err != nil {
+		return 0, fmt.Errorf("in-device unwrap failed: %w", err)
+	}
+	return handle, nil
+}
+
+func (h *HSMKeyStore) findPrivateKey(session pkcs11.SessionHandle, id string) (pkcs11.ObjectHandle, error) {
+	return h.findObject(session, pkcs11.CKO_PRIVATE_KEY, id)
+}
+
+func (h *HSMKeyStore) findObject(session pkcs11.SessionHandle, class uint, id string) (pkcs11.ObjectHandle, error) {
+	h.mu.Lock()
+	live, ok := h.live[id]
+	h.mu.Unlock()
+	if ok {
+		switch class {
+		case pkcs11.CKO_PRIVATE_KEY:
+			return live.private, nil
+		case pkcs11.CKO_PUBLIC_KEY:
+			return live.public, nil
+		}
+	}
+
+	handles, err := h.findObjects(session, class, id)
+	if err != nil {
+		return 0, err
+	}
+	if len(handles) == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+	return handles[0], nil
+}
+
+// findObjects returns every object of class whose CKA_ID is id
+func (h *HSMKeyStore) findObjects(session pkcs11.SessionHandle, class uint, id string) ([]pkcs11.ObjectHandle, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.ctx.FindObjectsInit(session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(id)),
+	}); err != nil {
+		return nil, fmt.Errorf("object search failed: %w", err)
+	}
+	defer h.ctx.FindObjectsFinal(session)
+
+	var all []pkcs11.ObjectHandle
+	for {
+		handles, _, err := h.ctx.FindObjects(session, 16)
+		if err != nil {
+			return nil, fmt.Errorf("object search failed: %w", err)
+		}
+		if len(handles) == 0 {
+			return all, nil
+		}
+		all = append(all, handles...)
+	}
+}
+
+// Close waits for sessions still in use to be released, logs out and
+// releases the PKCS#11 module. Operations started afterwards fail.
+func (h *HSMKeyStore) Close() {
+	for i := 0; i < h.opened; i++ {
+		s := <-h.sessions
+		if i == 0 {
+			h.ctx.Logout(s)
+		}
+		h.ctx.CloseSession(s)
+	}
+	close(h.sessions)
+	h.ctx.Finalize()
+	h.ctx.Destroy()
+}
+
+// hsmSigner performs signatures inside the token
+type hsmSigner struct {
+	store     *HSMKeyStore
+	handle    pkcs11.ObjectHandle
+	pubHandle pkcs11.ObjectHandle
+	public    crypto.PublicKey
+	algo      AlgorithmType
+	id        string
+}
+
+func (s *hsmSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+func (s *hsmSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	session, err := s.store.acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer s.store.release(session)
+
+	var mech *pkcs11.Mechanism
+	input := digest
+	pss, isPSS := opts.(*rsa.PSSOptions)
+	switch {
+	case s.algo == ECDSA_P256:
+		mech = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	case s.algo == RSA2048 && isPSS:
+		params, err := s.pssParams(pss)
+		if err != nil {
+			return nil, err
+		}
+		mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, params)
+	case s.algo == RSA2048:
+		prefix, err := pkcs1DigestInfoPrefix(opts.HashFunc())
+		if err != nil {
+			return nil, err
+		}
+		input = append(prefix, digest...)
+		mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	if err := s.store.ctx.SignInit(session, []*pkcs11.Mechanism{mech}, s.handle); err != nil {
+		return nil, fmt.Errorf("sign init failed: %w", err)
+	}
+	sig, err := s.store.ctx.Sign(session, input)
+	if err != nil {
+		return nil, fmt.Errorf("in-device signing failed: %w", err)
+	}
+
+	if s.algo == ECDSA_P256 {
+		// PKCS#11 returns raw r||s; Go verifiers expect ASN.1
+		half := len(sig) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			new(big.Int).SetBytes(sig[:half]),
+			new(big.Int).SetBytes(sig[half:]),
+		})
+	}
+	return sig, nil
+}
+
+// pssParams maps Go's PSS options onto CK_RSA_PKCS_PSS_PARAMS, resolving
+// the salt length the way rsa.SignPSS does
+func (s *hsmSigner) pssParams(opts *rsa.PSSOptions) ([]byte, error) {
+	var hashAlg, mgf uint
+	switch opts.HashFunc() {
+	case crypto.SHA256:
+		hashAlg, mgf = pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256
+	case crypto.SHA384:
+		hashAlg, mgf = pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384
+	default:
+		return nil, fmt.Errorf("unsupported digest for PSS signing: %v", opts.HashFunc())
+	}
+	pub, ok := s.public.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	salt := opts.SaltLength
+	switch salt {
+	case rsa.PSSSaltLengthEqualsHash:
+		salt = opts.HashFunc().Size()
+	case rsa.PSSSaltLengthAuto:
+		salt = (pub.N.BitLen()-1+7)/8 - 2 - opts.HashFunc().Size()
+	}
+	if salt < 0 {
+		return nil, fmt.Errorf("invalid PSS salt length %d", opts.SaltLength)
+	}
+	return pkcs11.NewPSSParams(hashAlg, mgf, uint(salt)), nil
+}
+
+func pkcs1DigestInfoPrefix(h crypto.Hash) ([]byte, error) {
+	switch h {
+	case crypto.SHA256:
+		return []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}, nil
+	case crypto.SHA384:
+		return []byte{0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30}, nil
+	default:
+		return nil, fmt.Errorf("unsupported digest for PKCS#1 signing: %v", h)
+	}
+}
+
+// MarshalPublicKey returns the PKIX encoding of an HSM-resident key
+func (s *hsmSigner) MarshalPublicKey() ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(s.public)
+}
@@ -0,0 +1,146 @@
+// kdf.go - SP 800-56C / SP 800-108 Key Derivation
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeyPurpose domain-separates derived keys so no two subsystems share a key
+type KeyPurpose string
+
+const (
+	PurposeMemory        KeyPurpose = "nuzon/memory/v1"
+	PurposeAudit         KeyPurpose = "nuzon/audit/v1"
+	PurposeAuditMAC      KeyPurpose = "nuzon/audit-mac/v1"
+	PurposeConfigSecrets KeyPurpose = "nuzon/config-secrets/v1"
+	PurposeMessaging     KeyPurpose = "nuzon/messaging/v1"
+	PurposeTenantDEK     KeyPurpose = "nuzon/tenant-dek/v1"
+	PurposeMemoryArchive KeyPurpose = "nuzon/memory-archive/v1"
+)
+
+var ErrWeakInputKey = errors.New("input keying material shorter than 32 bytes")
+
+const minIKMLength = 32
+
+// ExtractExpand implements the SP 800-56C rev2 two-step KDF with HMAC-SHA-384
+// (HKDF). salt may be nil; info binds the derivation to its purpose and context.
+func ExtractExpand(ikm, salt, info []byte, length int) ([]byte, error) {
+	if len(ikm) < minIKMLength {
+		return nil, ErrWeakInputKey
+	}
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha512.New384, ikm, salt, info), out); err != nil {
+		return nil, fmt.Errorf("hkdf expansion failed: %w", err)
+	}
+	return out, nil
+}
+
+// CounterKDF implements the SP 800-108 rev1 KDF in counter mode with HMAC-SHA-256:
+// K(i) = PRF(KI, [i]_32 || Label || 0x00 || Context || [L]_32)
+func CounterKDF(ki, label, context []byte, length int) ([]byte, error) {
+	if len(ki) < minIKMLength {
+		return nil, ErrWeakInputKey
+	}
+	return counterKDF(sha256.New, ki, label, context, length), nil
+}
+
+func counterKDF(h func() hash.Hash, ki, label, context []byte, length int) []byte {
+	prf := hmac.New(h, ki)
+	out := make([]byte, 0, length+prf.Size())
+
+	var lenBits [4]byte
+	binary.BigEndian.PutUint32(lenBits[:], uint32(length*8))
+
+	for i := uint32(1); len(out) < length; i++ {
+		var counter [4]byte
+		binary.BigEndian.PutUint32(counter[:], i)
+
+		prf.Reset()
+		prf.Write(counter[:])
+		prf.Write(label)
+		prf.Write([]byte{0x00})
+		prf.Write(context)
+		prf.Write(lenBits[:])
+		out = prf.Sum(out)
+	}
+	return out[:length]
+}
+
+// DeriveKey derives a 256-bit key for purpose from a root key
+func DeriveKey(root []byte, purpose KeyPurpose) ([32]byte, error) {
+	return deriveLabeled(root, purpose, nil)
+}
+
+// DeriveTenantKey derives a per-tenant 256-bit key for purpose
+func DeriveTenantKey(root []byte, purpose KeyPurpose, tenantID string) ([32]byte, error) {
+	if tenantID == "" {
+		return [32]byte{}, errors.New("tenant id required for tenant key derivation")
+	}
+	return deriveLabeled(root, purpose, []byte("tenant:"+tenantID))
+}
+
+// DeriveSubjectKey derives a per-subject 256-bit key for purpose, so each
+// message subject is sealed under its own key
+func DeriveSubjectKey(root []byte, purpose KeyPurpose, subject string) ([32]byte, error) {
+	if subject == "" {
+		return [32]byte{}, errors.New("subject required for subject key derivation")
+	}
+	return deriveLabeled(root, purpose, []byte("subject:"+subject))
+}
+
+func deriveLabeled(root []byte, purpose KeyPurpose, context []byte) ([32]byte, error) {
+	var key [32]byte
+	if purpose == "" {
+		return key, errors.New("key purpose required")
+	}
+
+	// Length-prefix the purpose so (purpose, context) pairs cannot collide
+	info := make([]byte, 0, 2+len(purpose)+len(context))
+	info = binary.BigEndian.AppendUint16(info, uint16(len(purpose)))
+	info = append(info, purpose...)
+	info = append(info, context...)
+
+	out, err := ExtractExpand(root, nil, info, len(key))
+	if err != nil {
+		return key, err
+	}
+	copy(key[:], out)
+	zero(out)
+	return key, nil
+}
+
+// KeyHierarchy derives purpose- and tenant-scoped keys from one root key
+type KeyHierarchy struct {
+	root []byte
+}
+
+// NewKeyHierarchy copies root; callers should wipe their own copy
+func NewKeyHierarchy(root []byte) (*KeyHierarchy, error) {
+	if len(root) < minIKMLength {
+		return nil, ErrWeakInputKey
+	}
+	return &KeyHierarchy{root: append([]byte(nil), root...)}, nil
+}
+
+func (h *KeyHierarchy) Key(purpose KeyPurpose) ([32]byte, error) {
+	return DeriveKey(h.root, purpose)
+}
+
+func (h *KeyHierarchy) TenantKey(purpose KeyPurpose, tenantID string) ([32]byte, error) {
+	return DeriveTenantKey(h.root, purpose, tenantID)
+}
+
+// Destroy wipes the root key from memory
+func (h *KeyHierarchy) Destroy() {
+	zero(h.root)
+	h.root = nil
+}
@@ -0,0 +1,112 @@
+// keystore.go - Key Storage Abstractions
+package crypto
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+	ErrKeyNotFound          = errors.New("key not found")
+	ErrNoKeyBackend         = errors.New("no key storage backend for algorithm")
+)
+
+// KeyBackend identifies where private key material for an AlgorithmSpec lives
+type KeyBackend string
+
+const (
+	BackendDatabase KeyBackend = "database"
+	BackendHSM      KeyBackend = "pkcs11"
+)
+
+// KeyStorage persists migrated key material
+type KeyStorage interface {
+	Store(ctx context.Context, id string, key crypto.PrivateKey, spec AlgorithmSpec) error
+	Archive(ctx context.Context, id string, key crypto.PrivateKey) error
+	GetLegacyKey() []byte
+}
+
+// DeviceKeyGenerator is implemented by backends that generate keys in place
+// so private material never exists in process memory
+type DeviceKeyGenerator interface {
+	GenerateKeyPair(ctx context.Context, id string, spec AlgorithmSpec) (crypto.Signer, error)
+}
+
+// RoutedKeyStorage dispatches to a backend selected by AlgorithmSpec.Backend
+type RoutedKeyStorage struct {
+	mu       sync.RWMutex
+	backends map[KeyBackend]KeyStorage
+	fallback KeyStorage
+}
+
+// NewRoutedKeyStorage creates a router with the given default backend
+func NewRoutedKeyStorage(fallback KeyStorage) *RoutedKeyStorage {
+	return &RoutedKeyStorage{
+		backends: make(map[KeyBackend]KeyStorage),
+		fallback: fallback,
+	}
+}
+
+// Register attaches a backend under its identifier
+func (r *RoutedKeyStorage) Register(name KeyBackend, ks KeyStorage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.backends[name] = ks
+}
+
+// Backend resolves the storage responsible for spec
+func (r *RoutedKeyStorage) Backend(spec AlgorithmSpec) (KeyStorage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if spec.Backend == "" {
+		if r.fallback == nil {
+			return nil, ErrNoKeyBackend
+		}
+		return r.fallback, nil
+	}
+	ks, ok := r.backends[spec.Backend]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoKeyBackend, spec.Backend)
+	}
+	return ks, nil
+}
+
+func (r *RoutedKeyStorage) Store(ctx context.Context, id string, key crypto.PrivateKey, spec AlgorithmSpec) error {
+	ks, err := r.Backend(spec)
+	if err != nil {
+		return err
+	}
+	return ks.Store(ctx, id, key, spec)
+}
+
+func (r *RoutedKeyStorage) Archive(ctx context.Context, id string, key crypto.PrivateKey) error {
+	if r.fallback == nil {
+		return ErrNoKeyBackend
+	}
+	return r.fallback.Archive(ctx, id, key)
+}
+
+func (r *RoutedKeyStorage) GetLegacyKey() []byte {
+	if r.fallback == nil {
+		return nil
+	}
+	return r.fallback.GetLegacyKey()
+}
+
+// GenerateKeyPair delegates in-device generation when the selected backend supports it
+func (r *RoutedKeyStorage) GenerateKeyPair(ctx context.Context, id string, spec AlgorithmSpec) (crypto.Signer, error) {
+	ks, err := r.Backend(spec)
+	if err != nil {
+		return nil, err
+	}
+	gen, ok := ks.(DeviceKeyGenerator)
+	if !ok {
+		return nil, fmt.Errorf("%w: backend %q cannot generate keys in place", ErrUnsupportedAlgorithm, spec.Backend)
+	}
+	return gen.GenerateKeyPair(ctx, id, spec)
+}
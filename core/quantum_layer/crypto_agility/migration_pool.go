@@ -0,0 +1,229 @@
+// migration_pool.go - Batched, Rate-Limited Concurrent Key Migration
+package crypto
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultMigrationBatch   = 1000
+	defaultMigrationWorkers = 8
+	metricsUpdatePeriod     = 5 * time.Second
+)
+
+var (
+	migrationKeysTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_key_migration_keys_total",
+		Help: "Keys processed by the migration engine by status",
+	}, []string{"status"})
+
+	migrationThroughput = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "Wavine_key_migration_throughput_keys_per_second",
+		Help: "Current key migration throughput",
+	})
+
+	migrationETA = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "Wavine_key_migration_eta_seconds",
+		Help: "Estimated seconds until the running key migration completes",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(migrationKeysTotal, migrationThroughput, migrationETA)
+}
+
+// MigrationConcurrency bounds the load a migration places on the database
+type MigrationConcurrency struct {
+	BatchSize int
+	Workers   int
+	// RatePerSecond caps keys migrated per second; zero means unlimited
+	RatePerSecond float64
+}
+
+type keyRow struct {
+	id      string
+	pubKey  []byte
+	privKey []byte
+	spec    AlgorithmSpec
+}
+
+// migrateConcurrently scans crypto_keys in keyset-paginated batches and fans
+// rows out to a bounded worker pool behind a token-bucket rate limiter
+func (e *KeyMigrationEngine) migrateConcurrently(ctx context.Context) error {
+	cfg := e.concurrency
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultMigrationBatch
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultMigrationWorkers
+	}
+
+	limit := rate.Inf
+	if cfg.RatePerSecond > 0 {
+		limit = rate.Limit(cfg.RatePerSecond)
+	}
+	limiter := rate.NewLimiter(limit, cfg.Workers)
+
+	var total int64
+	if err := e.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM crypto_keys WHERE algo_type = $1`,
+		e.currentAlgo.Type).Scan(&total); err != nil {
+		return fmt.Errorf("key count failed: %w", err)
+	}
+	e.metrics.mu.Lock()
+	e.metrics.TotalRecords = total
+	e.metrics.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan keyRow, cfg.BatchSize)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range jobs {
+				if err := limiter.Wait(ctx); err != nil {
+					return
+				}
+				if err := e.migrateKey(ctx, row.id, row.pubKey, row.privKey, row.spec); err != nil {
+					atomic.AddInt64(&e.metrics.Failed, 1)
+					migrationKeysTotal.WithLabelValues("failed").Inc()
+					slog.Error("key migration failed", "key_id", row.id, "error", err)
+				} else {
+					migrationKeysTotal.WithLabelValues("migrated").Inc()
+				}
+				atomic.AddInt64(&e.metrics.Processed, 1)
+			}
+		}()
+	}
+
+	stopMetrics := e.reportProgress(ctx)
+	defer stopMetrics()
+
+	scanErr := e.scanBatches(ctx, cfg.BatchSize, jobs)
+	close(jobs)
+	wg.Wait()
+
+	if scanErr != nil {
+		return scanErr
+	}
+	return ctx.Err()
+}
+
+func (e *KeyMigrationEngine) scanBatches(ctx context.Context, batchSize int, jobs chan<- keyRow) error {
+	cursor := ""
+	for {
+		rows, err := e.db.QueryContext(ctx,
+			`SELECT id, public_key, encrypted_private, key_spec FROM crypto_keys
+			 WHERE algo_type = $1 AND id > $2
+			 ORDER BY id
+			 LIMIT $3`, e.currentAlgo.Type, cursor, batchSize)
+		if err != nil {
+			return fmt.Errorf("key query failed: %w", err)
+		}
+
+		n := 0
+		for rows.Next() {
+			var row keyRow
+			if err := rows.Scan(&row.id, &row.pubKey, &row.privKey, &row.spec); err != nil {
+				rows.Close()
+				return fmt.Errorf("key scan failed: %w", err)
+			}
+			cursor = row.id
+			n++
+
+			select {
+			case jobs <- row:
+			case <-ctx.Done():
+				rows.Close()
+				return ctx.Err()
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("key scan failed: %w", err)
+		}
+		if n < batchSize {
+			return nil
+		}
+	}
+}
+
+// reportProgress refreshes throughput and ETA gauges until the returned stop func is called
+func (e *KeyMigrationEngine) reportProgress(ctx context.Context) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(metricsUpdatePeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.updateThroughput()
+			case <-done:
+				e.updateThroughput()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func (e *KeyMigrationEngine) updateThroughput() {
+	processed := atomic.LoadInt64(&e.metrics.Processed)
+	e.metrics.mu.Lock()
+	elapsed := time.Since(e.metrics.StartTime).Seconds()
+	if elapsed <= 0 {
+		e.metrics.mu.Unlock()
+		return
+	}
+	throughput := float64(processed) / elapsed
+	e.metrics.Throughput = throughput
+	remaining := e.metrics.TotalRecords - processed
+	e.metrics.mu.Unlock()
+
+	migrationThroughput.Set(throughput)
+	if throughput > 0 && remaining > 0 {
+		migrationETA.Set(float64(remaining) / throughput)
+	} else {
+		migrationETA.Set(0)
+	}
+}
+
+// MigrationProgress is a point-in-time view for admin APIs
+type MigrationProgress struct {
+	Total      int64
+	Processed  int64
+	Failed     int64
+	Throughput float64
+	ETA        time.Duration
+}
+
+// Progress reports live migration counters
+func (e *KeyMigrationEngine) Progress() MigrationProgress {
+	e.metrics.mu.Lock()
+	p := MigrationProgress{
+		Total:      e.metrics.TotalRecords,
+		Processed:  atomic.LoadInt64(&e.metrics.Processed),
+		Failed:     atomic.LoadInt64(&e.metrics.Failed),
+		Throughput: e.metrics.Throughput,
+	}
+	e.metrics.mu.Unlock()
+	if p.Throughput > 0 && p.Total > p.Processed {
+		p.ETA = time.Duration(float64(p.Total-p.Processed) / p.Throughput * float64(time.Second))
+	}
+	return p
+}
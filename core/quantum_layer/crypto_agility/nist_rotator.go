@@ -2,6 +2,7 @@
 package crypto
 
 import (
+	"context"
 	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
@@ -15,6 +16,8 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudflare/circl/kem"
@@ -30,6 +33,10 @@ type KeyMigrationEngine struct {
 	metrics      MigrationMetrics
 	compliance   NISTValidator
 	rollbackPlan RollbackStrategy
+	policy       *CryptoPolicy
+	concurrency  MigrationConcurrency
+	evidence     rotationEvidence
+	attestor     RotationAttestor
 }
 
 type AlgorithmSpec struct {
@@ -37,9 +44,14 @@ type AlgorithmSpec struct {
 	Params     json.RawMessage
 	NISTLevel  int
 	QuantumSafe bool
+	Backend    KeyBackend
 }
 
+// MigrationMetrics counts a migration's progress. Processed and Failed are
+// updated atomically; mu guards the other fields, which the progress
+// reporter reads while workers run.
 type MigrationMetrics struct {
+	mu              sync.Mutex
 	TotalRecords    int64
 	Processed       int64
 	Failed          int64
@@ -49,6 +61,25 @@ type MigrationMetrics struct {
 	SecurityChecks  int
 }
 
+// NewKeyMigrationEngine builds an engine migrating keys from current to
+// target. policy is checked before every migration; nil enforces only FIPS
+// mode.
+func NewKeyMigrationEngine(db *sql.DB, current, target AlgorithmSpec, keyStore KeyStorage,
+	compliance NISTValidator, rollbackPlan RollbackStrategy, policy *CryptoPolicy,
+	concurrency MigrationConcurrency, attestor RotationAttestor) *KeyMigrationEngine {
+	return &KeyMigrationEngine{
+		db:           db,
+		currentAlgo:  current,
+		targetAlgo:   target,
+		keyStore:     keyStore,
+		compliance:   compliance,
+		rollbackPlan: rollbackPlan,
+		policy:       policy,
+		concurrency:  concurrency,
+		attestor:     attestor,
+	}
+}
+
 const (
 	RSA2048 AlgorithmType = iota + 1
 	ECDSA_P256
@@ -56,42 +87,39 @@ const (
 	Kyber768
 	Dilithium3
 	ChaCha20_Poly1305
+	SPHINCSPlus_SHA2_192s
 )
 
 func (e *KeyMigrationEngine) RotateKeys(ctx context.Context) error {
+	if err := e.policy.CheckAlgorithm(e.targetAlgo); err != nil {
+		return fmt.Errorf("migration target rejected: %w", err)
+	}
+
+	e.metrics.mu.Lock()
 	e.metrics.StartTime = time.Now()
+	e.metrics.mu.Unlock()
 	defer e.logMigrationSummary()
 
-	rows, err := e.db.QueryContext(ctx, 
-		`SELECT id, public_key, encrypted_private, key_spec FROM crypto_keys 
-		WHERE algo_type = \$1`, e.currentAlgo.Type)
-	if err != nil {
-		return fmt.Errorf("key query failed: %w", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var (
-			id      string
-			pubKey  []byte
-			privKey []byte
-			spec    AlgorithmSpec
-		)
-		
-		if err := rows.Scan(&id, &pubKey, &privKey, &spec); err != nil {
-			return fmt.Errorf("key scan failed: %w", err)
-		}
-
-		if err := e.migrateKey(ctx, id, pubKey, privKey, spec); err != nil {
-			e.metrics.Failed++
-			if errors.Is(err, context.Canceled) {
-				return e.rollbackPlan.Execute(ctx)
-			}
-		}
-		e.metrics.Processed++
+	if err := e.migrateConcurrently(ctx); err != nil {
+		return e.rollback(ctx, err)
+	}
+	if failed := atomic.LoadInt64(&e.metrics.Failed); failed > 0 {
+		return e.rollback(ctx, fmt.Errorf("%d keys failed to migrate", failed))
+	}
+	if err := e.validatePostMigration(ctx); err != nil {
+		return e.rollback(ctx, err)
 	}
+	return nil
+}
 
-	return e.validatePostMigration(ctx)
+// rollback restores the pre-migration key set after cause aborted the
+// migration. The cause is returned either way, joined with the rollback's
+// own failure if it has one.
+func (e *KeyMigrationEngine) rollback(ctx context.Context, cause error) error {
+	if err := e.rollbackPlan.Execute(ctx); err != nil {
+		return errors.Join(cause, fmt.Errorf("rollback failed: %w", err))
+	}
+	return fmt.Errorf("migration rolled back: %w", cause)
 }
 
 func (e *KeyMigrationEngine) migrateKey(ctx context.Context, id string, 
@@ -103,8 +131,13 @@ func (e *KeyMigrationEngine) migrateKey(ctx context.Context, id string,
 		return fmt.Errorf("legacy decryption failed: %w", err)
 	}
 
-	// 2. Generate new key pair
-	newKey, err := e.generateNewKeyPair()
+	// 2. Generate new key pair (in-device when the target backend supports it)
+	var newKey crypto.PrivateKey
+	if gen, ok := e.keyStore.(DeviceKeyGenerator); ok && e.targetAlgo.Backend == BackendHSM {
+		newKey, err = gen.GenerateKeyPair(ctx, id, e.targetAlgo)
+	} else {
+		newKey, err = e.generateNewKeyPair()
+	}
 	if err != nil {
 		return fmt.Errorf("key generation failed: %w", err)
 	}
@@ -114,17 +147,43 @@ func (e *KeyMigrationEngine) migrateKey(ctx context.Context, id string,
 		return fmt.Errorf("compatibility check failed: %w", err)
 	}
 
-	// 4. Store new encrypted key
+	// 4. Archive the retired key so a rollback can restore it
+	if err := e.archiveKey(ctx, id); err != nil {
+		return err
+	}
+
+	// 5. Store new encrypted key
 	if err := e.keyStore.Store(ctx, id, newKey, e.targetAlgo); err != nil {
 		return fmt.Errorf("key storage failed: %w", err)
 	}
 
-	// 5. Maintain legacy key during transition
+	// 6. Maintain legacy key during transition
 	if err := e.keyStore.Archive(ctx, id, legacyKey); err != nil {
 		return fmt.Errorf("key archiving failed: %w", err)
 	}
 
+	e.metrics.mu.Lock()
 	e.metrics.SecurityChecks++
+	e.metrics.mu.Unlock()
+	e.evidence.record(id, pubKey)
+	return nil
+}
+
+// archiveKey copies a key's row into crypto_keys_archive, which
+// RollbackStrategy restores from. Only a row still under the current
+// algorithm is copied, so a retried migration never archives a migrated key.
+func (e *KeyMigrationEngine) archiveKey(ctx context.Context, id string) error {
+	_, err := e.db.ExecContext(ctx,
+		`INSERT INTO crypto_keys_archive (id, public_key, encrypted_private, key_spec, algo_type, archived_at)
+		 SELECT id, public_key, encrypted_private, key_spec, algo_type, NOW() FROM crypto_keys
+		 WHERE id = $1 AND algo_type = $2
+		 ON CONFLICT (id) DO UPDATE
+		 SET public_key = EXCLUDED.public_key, encrypted_private = EXCLUDED.encrypted_private,
+		     key_spec = EXCLUDED.key_spec, algo_type = EXCLUDED.algo_type, archived_at = EXCLUDED.archived_at`,
+		id, e.currentAlgo.Type)
+	if err != nil {
+		return fmt.Errorf("key archive failed: %w", err)
+	}
 	return nil
 }
 
@@ -155,6 +214,8 @@ func (e *KeyMigrationEngine) generateNewKeyPair() (crypto.PrivateKey, error) {
 		}, err
 	case Dilithium3:
 		return dilithium.GenerateKey(nil)
+	case SPHINCSPlus_SHA2_192s:
+		return generateSPHINCSKey()
 	case ChaCha20_Poly1305:
 		key := make([]byte, chacha20poly1305.KeySize)
 		if _, err := io.ReadFull(rand.Reader, key); err != nil {
@@ -180,7 +241,7 @@ func (e *KeyMigrationEngine) validatePostMigration(ctx context.Context) error {
 	}
 
 	// Perform cryptographic proof of migration
-	if err := e.generateProofOfRotation(); err != nil {
+	if err := e.generateProofOfRotation(ctx); err != nil {
 		return fmt.Errorf("audit proof generation failed: %w", err)
 	}
 
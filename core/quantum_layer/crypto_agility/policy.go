@@ -0,0 +1,226 @@
+// policy.go - Environment-Scoped Cryptographic Policy Engine
+package crypto
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrPolicyViolation = errors.New("crypto policy violation")
+
+// PolicyViolation explains which rule rejected an algorithm, key or connection
+type PolicyViolation struct {
+	Environment string
+	Rule        string
+	Subject     string
+	Remediation string
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("crypto policy %q rejects %s (%s): %s",
+		v.Environment, v.Subject, v.Rule, v.Remediation)
+}
+
+func (v *PolicyViolation) Unwrap() error { return ErrPolicyViolation }
+
+// CryptoPolicy declares the algorithms and key lifetimes an environment accepts
+type CryptoPolicy struct {
+	Environment        string          `yaml:"environment"`
+	MinNISTLevel       int             `yaml:"min_nist_level"`
+	RequireQuantumSafe bool            `yaml:"require_quantum_safe"`
+	BannedAlgorithms   []AlgorithmType `yaml:"banned_algorithms"`
+	BannedCiphers      []string        `yaml:"banned_ciphers"`
+	MaxKeyLifetime     time.Duration   `yaml:"max_key_lifetime"`
+	MinTLSVersion      uint16          `yaml:"min_tls_version"`
+	AllowedTLSSuites   []uint16        `yaml:"allowed_tls_suites"`
+}
+
+// PolicySet maps environment names (dev, staging, prod, ...) to policies
+type PolicySet map[string]*CryptoPolicy
+
+// LoadPolicySet reads per-environment policies from a YAML document
+func LoadPolicySet(path string) (PolicySet, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("policy file read failed: %w", err)
+	}
+	var set PolicySet
+	if err := yaml.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("policy file parse failed: %w", err)
+	}
+	for env, p := range set {
+		p.Environment = env
+	}
+	return set, nil
+}
+
+// For returns the policy for env, failing closed when none is declared
+func (s PolicySet) For(env string) (*CryptoPolicy, error) {
+	p, ok := s[env]
+	if !ok {
+		return nil, fmt.Errorf("no crypto policy declared for environment %q", env)
+	}
+	return p, nil
+}
+
+// CheckAlgorithm validates a key algorithm against the policy
+func (p *CryptoPolicy) CheckAlgorithm(spec AlgorithmSpec) error {
+	if FIPSEnabled() && !FIPSApproved(spec.Type) {
+		return &PolicyViolation{
+			Environment: "fips",
+			Rule:        "fips_140_3",
+			Subject:     algorithmName(spec.Type),
+			Remediation: "use RSA2048, ECDSA_P256 or AES256_GCM while FIPS mode is enabled",
+		}
+	}
+	if p == nil {
+		return nil
+	}
+	for _, banned := range p.BannedAlgorithms {
+		if spec.Type == banned {
+			return p.violation("banned_algorithms", algorithmName(spec.Type),
+				"migrate keys to an allowed algorithm before deploying to this environment")
+		}
+	}
+	if spec.NISTLevel < p.MinNISTLevel {
+		return p.violation("min_nist_level",
+			fmt.Sprintf("%s at NIST level %d", algorithmName(spec.Type), spec.NISTLevel),
+			fmt.Sprintf("select an algorithm at NIST level %d or higher", p.MinNISTLevel))
+	}
+	if p.RequireQuantumSafe && !spec.QuantumSafe {
+		return p.violation("require_quantum_safe", algorithmName(spec.Type),
+			"use Kyber768, Dilithium3 or SPHINCS+ (or a hybrid) as the target algorithm")
+	}
+	return nil
+}
+
+// CheckCipher validates a symmetric AEAD by name (e.g. "chacha20-poly1305")
+func (p *CryptoPolicy) CheckCipher(name string) error {
+	if p == nil {
+		return nil
+	}
+	for _, banned := range p.BannedCiphers {
+		if strings.EqualFold(banned, name) {
+			return p.violation("banned_ciphers", name, "configure an allowed AEAD such as aes-256-gcm")
+		}
+	}
+	return nil
+}
+
+// CheckKeyAge rejects keys that have outlived MaxKeyLifetime
+func (p *CryptoPolicy) CheckKeyAge(keyID string, createdAt time.Time) error {
+	if p == nil || p.MaxKeyLifetime == 0 {
+		return nil
+	}
+	if age := time.Since(createdAt); age > p.MaxKeyLifetime {
+		return p.violation("max_key_lifetime",
+			fmt.Sprintf("key %s aged %s", keyID, age.Round(time.Hour)),
+			fmt.Sprintf("rotate keys at least every %s", p.MaxKeyLifetime))
+	}
+	return nil
+}
+
+// ApplyTLS restricts cfg to the policy's TLS version and suites and installs
+// VerifyConnection, after any verifier cfg already carries. A cfg without
+// CipherSuites is restricted from Go's default suites.
+func (p *CryptoPolicy) ApplyTLS(cfg *tls.Config) (*tls.Config, error) {
+	if p == nil {
+		return cfg, nil
+	}
+	out := cfg.Clone()
+	if p.MinTLSVersion != 0 && out.MinVersion < p.MinTLSVersion {
+		out.MinVersion = p.MinTLSVersion
+	}
+	if len(p.AllowedTLSSuites) > 0 {
+		allowed := make(map[uint16]bool, len(p.AllowedTLSSuites))
+		for _, cs := range p.AllowedTLSSuites {
+			allowed[cs] = true
+		}
+		candidates := out.CipherSuites
+		if len(candidates) == 0 {
+			for _, cs := range tls.CipherSuites() {
+				candidates = append(candidates, cs.ID)
+			}
+		}
+		var suites []uint16
+		for _, cs := range candidates {
+			if allowed[cs] {
+				suites = append(suites, cs)
+			}
+		}
+		if len(suites) == 0 {
+			return nil, p.violation("allowed_tls_suites", "server TLS configuration",
+				"enable at least one cipher suite permitted by the environment policy")
+		}
+		out.CipherSuites = suites
+	}
+
+	verify := out.VerifyConnection
+	out.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(cs); err != nil {
+				return err
+			}
+		}
+		return p.VerifyConnection(cs)
+	}
+	return out, nil
+}
+
+// VerifyConnection rejects negotiated TLS sessions outside policy. ApplyTLS
+// installs it as tls.Config.VerifyConnection.
+func (p *CryptoPolicy) VerifyConnection(cs tls.ConnectionState) error {
+	if p == nil {
+		return nil
+	}
+	if p.MinTLSVersion != 0 && cs.Version < p.MinTLSVersion {
+		return p.violation("min_tls_version", tls.VersionName(cs.Version),
+			"upgrade the peer to "+tls.VersionName(p.MinTLSVersion))
+	}
+	if len(p.AllowedTLSSuites) > 0 && cs.Version < tls.VersionTLS13 {
+		for _, allowed := range p.AllowedTLSSuites {
+			if cs.CipherSuite == allowed {
+				return nil
+			}
+		}
+		return p.violation("allowed_tls_suites", tls.CipherSuiteName(cs.CipherSuite),
+			"negotiate a cipher suite permitted by the environment policy")
+	}
+	return nil
+}
+
+func (p *CryptoPolicy) violation(rule, subject, remediation string) error {
+	return &PolicyViolation{
+		Environment: p.Environment,
+		Rule:        rule,
+		Subject:     subject,
+		Remediation: remediation,
+	}
+}
+
+func algorithmName(t AlgorithmType) string {
+	switch t {
+	case RSA2048:
+		return "RSA2048"
+	case ECDSA_P256:
+		return "ECDSA_P256"
+	case AES256_GCM:
+		return "AES256_GCM"
+	case Kyber768:
+		return "Kyber768"
+	case Dilithium3:
+		return "Dilithium3"
+	case ChaCha20_Poly1305:
+		return "ChaCha20_Poly1305"
+	case SPHINCSPlus_SHA2_192s:
+		return "SPHINCS+-SHA2-192s"
+	default:
+		return fmt.Sprintf("algorithm(%d)", t)
+	}
+}
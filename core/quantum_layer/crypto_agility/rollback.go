@@ -0,0 +1,211 @@
+// rollback.go - Transactional Rollback for Failed Crypto Migrations
+package crypto
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const defaultRollbackSample = 32
+
+var ErrRollbackVerification = errors.New("rollback verification failed")
+
+// RollbackStrategy restores the pre-migration key set when RotateKeys aborts
+type RollbackStrategy struct {
+	db         *sql.DB
+	from       AlgorithmSpec
+	to         AlgorithmSpec
+	signer     crypto.Signer
+	sampleSize int
+	// decrypt proves a restored key still opens its protected material
+	decrypt func(encrypted []byte) (crypto.PrivateKey, error)
+}
+
+// RollbackReport is the signed evidence emitted after a rollback
+type RollbackReport struct {
+	StartedAt     time.Time     `json:"started_at"`
+	CompletedAt   time.Time     `json:"completed_at"`
+	FromAlgorithm AlgorithmType `json:"from_algorithm"`
+	ToAlgorithm   AlgorithmType `json:"to_algorithm"`
+	KeysRestored  int64         `json:"keys_restored"`
+	Sampled       int           `json:"sampled"`
+	SampleFailed  []string      `json:"sample_failed,omitempty"`
+	Outcome       string        `json:"outcome"`
+	Signature     []byte        `json:"signature,omitempty"`
+}
+
+// NewRollbackStrategy builds the rollback plan for a migration from → to
+func NewRollbackStrategy(db *sql.DB, from, to AlgorithmSpec, signer crypto.Signer,
+	decrypt func([]byte) (crypto.PrivateKey, error)) RollbackStrategy {
+	return RollbackStrategy{
+		db:         db,
+		from:       from,
+		to:         to,
+		signer:     signer,
+		sampleSize: defaultRollbackSample,
+		decrypt:    decrypt,
+	}
+}
+
+// Execute restores archived keys and algorithm metadata in a single
+// transaction, verifies a sample before committing, and records a signed report
+func (r RollbackStrategy) Execute(ctx context.Context) error {
+	// The migration context is typically cancelled already; rollback must still run
+	ctx = context.WithoutCancel(ctx)
+
+	report := RollbackReport{
+		StartedAt:     time.Now().UTC(),
+		FromAlgorithm: r.to.Type,
+		ToAlgorithm:   r.from.Type,
+	}
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("rollback transaction start failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE crypto_keys k
+		 SET encrypted_private = a.encrypted_private,
+		     public_key        = a.public_key,
+		     key_spec          = a.key_spec,
+		     algo_type         = a.algo_type
+		 FROM crypto_keys_archive a
+		 WHERE a.id = k.id AND k.algo_type = $1 AND a.algo_type = $2`,
+		r.to.Type, r.from.Type)
+	if err != nil {
+		return fmt.Errorf("archived key restore failed: %w", err)
+	}
+	report.KeysRestored, _ = res.RowsAffected()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE crypto_algorithm_state SET active_algo = $1, updated_at = NOW() WHERE active_algo = $2`,
+		r.from.Type, r.to.Type); err != nil {
+		return fmt.Errorf("algorithm metadata revert failed: %w", err)
+	}
+
+	failed, sampled, err := r.verifySample(ctx, tx)
+	if err != nil {
+		return err
+	}
+	report.Sampled = sampled
+	report.SampleFailed = failed
+
+	if len(failed) > 0 {
+		report.Outcome = "aborted"
+		report.CompletedAt = time.Now().UTC()
+		if err := r.persistReport(ctx, r.db, &report); err != nil {
+			slog.Error("rollback report persistence failed", "error", err)
+		}
+		return fmt.Errorf("%w: %d of %d sampled keys unreadable", ErrRollbackVerification, len(failed), sampled)
+	}
+
+	report.Outcome = "restored"
+	report.CompletedAt = time.Now().UTC()
+	if err := r.persistReport(ctx, tx, &report); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("rollback commit failed: %w", err)
+	}
+
+	slog.Warn("crypto migration rolled back",
+		"from", r.to.Type, "to", r.from.Type, "keys_restored", report.KeysRestored)
+	return nil
+}
+
+func (r RollbackStrategy) verifySample(ctx context.Context, tx *sql.Tx) ([]string, int, error) {
+	if r.decrypt == nil {
+		return nil, 0, nil
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, encrypted_private FROM crypto_keys
+		 WHERE algo_type = $1
+		 ORDER BY random() LIMIT $2`, r.from.Type, r.sampleSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("rollback sample query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var failed []string
+	sampled := 0
+	for rows.Next() {
+		var id string
+		var encrypted []byte
+		if err := rows.Scan(&id, &encrypted); err != nil {
+			return nil, 0, fmt.Errorf("rollback sample scan failed: %w", err)
+		}
+		sampled++
+		if _, err := r.decrypt(encrypted); err != nil {
+			slog.Error("restored key not decryptable", "key_id", id, "error", err)
+			failed = append(failed, id)
+		}
+	}
+	return failed, sampled, rows.Err()
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (r RollbackStrategy) persistReport(ctx context.Context, db execer, report *RollbackReport) error {
+	if r.signer != nil {
+		payload, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256(payload)
+		sig, err := r.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return fmt.Errorf("rollback report signing failed: %w", err)
+		}
+		report.Signature = sig
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO crypto_rollback_reports (created_at, outcome, report) VALUES ($1, $2, $3)`,
+		report.CompletedAt, report.Outcome, body)
+	if err != nil {
+		return fmt.Errorf("rollback report insert failed: %w", err)
+	}
+	return nil
+}
+
+// Required SQL schema (execute during initialization)
+/*
+CREATE TABLE IF NOT EXISTS crypto_keys_archive (
+    id                VARCHAR(255) PRIMARY KEY,
+    public_key        BYTEA,
+    encrypted_private BYTEA NOT NULL,
+    key_spec          JSONB NOT NULL,
+    algo_type         INTEGER NOT NULL,
+    archived_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS crypto_algorithm_state (
+    active_algo INTEGER NOT NULL,
+    updated_at  TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS crypto_rollback_reports (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    outcome    VARCHAR(16) NOT NULL,
+    report     JSONB NOT NULL
+);
+*/
@@ -0,0 +1,615 @@
+// rotation_scheduler.go - Continuous Memory Key Rotation with Checkpointing
+package crypto
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	defaultRotationBatch = 500
+	// rotationPollInterval is how often RunScheduled looks for tenants
+	// whose key is due and for resumed rotations
+	rotationPollInterval = 30 * time.Second
+	// nilRotationCursor sorts before every memory ID
+	nilRotationCursor = "00000000-0000-0000-0000-000000000000"
+)
+
+var ErrRotationPaused = errors.New("key rotation paused")
+
+// sealedTables hold data sealed under tenant memory keys besides the
+// memories table, which RotateMemoryKey walks first with a cursor
+var sealedTables = []string{"memories_archive", "memory_blobs", "memory_namespace_entries", "agent_checkpoints"}
+
+// RotationState tracks a rotation run in the crypto_rotations table
+type RotationState string
+
+const (
+	RotationRunning   RotationState = "running"
+	RotationPaused    RotationState = "paused"
+	RotationCompleted RotationState = "completed"
+	RotationFailed    RotationState = "failed"
+)
+
+// RotationSchedule configures continuous memory-key rotation
+type RotationSchedule struct {
+	Interval  time.Duration
+	BatchSize int
+	// BatchPause throttles re-encryption so online traffic is not starved
+	BatchPause time.Duration
+	// Stores re-seals data kept outside Postgres, e.g. the Redis working
+	// tier, before the new key is activated
+	Stores []SealedStore
+}
+
+// MemoryKeyring supplies each tenant's memory-encryption keys by identifier
+type MemoryKeyring interface {
+	// Tenants lists the tenants holding an active key
+	Tenants(ctx context.Context) ([]string, error)
+	ActiveKey(ctx context.Context, tenantID string) (string, [32]byte, error)
+	Key(ctx context.Context, keyID string) ([32]byte, error)
+	// NewKey creates and persists a key that becomes the tenant's active
+	// key once rotation completes
+	NewKey(ctx context.Context, tenantID string) (string, [32]byte, error)
+	Activate(ctx context.Context, tenantID, keyID string) error
+}
+
+// ResealFunc opens data sealed under the rotation's old key with
+// cipherName and seals it under the new key
+type ResealFunc func(cipherName string, data []byte) (keyID, cipher string, sealed []byte, err error)
+
+// SealedStore holds data sealed with memory keys outside the tables
+// RotateMemoryKey rewrites itself
+type SealedStore interface {
+	// Reseal rewrites every item sealed under oldKeyID and returns how
+	// many it rewrote
+	Reseal(ctx context.Context, oldKeyID string, reseal ResealFunc) (int, error)
+}
+
+// RotationProgress is a checkpoint row of crypto_rotations
+type RotationProgress struct {
+	ID          int64
+	TenantID    string
+	OldKeyID    string
+	NewKeyID    string
+	State       RotationState
+	Cursor      string
+	Processed   int64
+	StartedAt   time.Time
+	CompletedAt sql.NullTime
+}
+
+// NewMemoryRotationEngine returns an engine for RunScheduled and the
+// rotation controls alone, which need only the database and the policy
+// bounding key lifetime
+func NewMemoryRotationEngine(db *sql.DB, policy *CryptoPolicy) *KeyMigrationEngine {
+	return &KeyMigrationEngine{db: db, policy: policy}
+}
+
+// RunScheduled rotates each tenant's memory key every schedule.Interval,
+// resuming any unfinished rotation first. It returns when ctx is cancelled.
+func (e *KeyMigrationEngine) RunScheduled(ctx context.Context, keyring MemoryKeyring, schedule RotationSchedule) error {
+	if schedule.BatchSize <= 0 {
+		schedule.BatchSize = defaultRotationBatch
+	}
+
+	for {
+		tenants, err := keyring.Tenants(ctx)
+		if err != nil {
+			slog.Error("memory key rotation tenant lookup failed", "error", err)
+		}
+		for _, tenantID := range tenants {
+			err := e.rotateIfDue(ctx, keyring, tenantID, schedule)
+			switch {
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case errors.Is(err, ErrRotationPaused):
+				slog.Info("memory key rotation paused, waiting for resume", "tenant", tenantID)
+			case err != nil:
+				slog.Error("memory key rotation failed", "tenant", tenantID, "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rotationPollInterval):
+		}
+	}
+}
+
+// rotateIfDue rotates tenantID's key once it is due. It holds a session
+// advisory lock on the tenant, so replicas each running RunScheduled never
+// rotate one tenant side by side; a replica finding the lock taken leaves
+// the tenant to its holder.
+func (e *KeyMigrationEngine) rotateIfDue(ctx context.Context, keyring MemoryKeyring, tenantID string, schedule RotationSchedule) error {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer conn.Close()
+
+	lockKey := "crypto-rotation:" + tenantID
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, lockKey).Scan(&locked); err != nil {
+		return fmt.Errorf("rotation lock failed: %w", err)
+	}
+	if !locked {
+		return nil
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, lockKey)
+
+	// checked under the lock, so a rotation another replica just finished
+	// is seen as completed
+	next, err := e.nextRotationDue(ctx, tenantID, schedule.Interval)
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(next) {
+		return nil
+	}
+	return e.RotateMemoryKey(ctx, keyring, tenantID, schedule)
+}
+
+func (e *KeyMigrationEngine) nextRotationDue(ctx context.Context, tenantID string, interval time.Duration) (time.Time, error) {
+	var last sql.NullTime
+	var pending int
+	err := e.db.QueryRowContext(ctx,
+		`SELECT MAX(completed_at), COUNT(*) FILTER (WHERE state <> 'completed')
+		 FROM crypto_rotations WHERE tenant_id = $1`, tenantID).Scan(&last, &pending)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("rotation schedule lookup failed: %w", err)
+	}
+	if pending > 0 || !last.Valid {
+		return time.Now(), nil
+	}
+
+	// The active key dates from the last completed rotation, and the
+	// policy's key lifetime wins over a longer schedule
+	if err := e.policy.CheckKeyAge("memory", last.Time); err != nil {
+		slog.Warn("memory key outlived policy, rotating now", "tenant", tenantID, "error", err)
+		return time.Now(), nil
+	}
+	if e.policy != nil && e.policy.MaxKeyLifetime > 0 && e.policy.MaxKeyLifetime < interval {
+		interval = e.policy.MaxKeyLifetime
+	}
+	return last.Time.Add(interval), nil
+}
+
+// RotateMemoryKey re-encrypts everything sealed under tenantID's key under
+// a new one, resuming from the last checkpoint of an unfinished rotation
+// if one exists
+func (e *KeyMigrationEngine) RotateMemoryKey(ctx context.Context, keyring MemoryKeyring, tenantID string, schedule RotationSchedule) error {
+	if schedule.BatchSize <= 0 {
+		schedule.BatchSize = defaultRotationBatch
+	}
+	progress, err := e.loadOpenRotation(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if progress == nil {
+		if progress, err = e.startRotation(ctx, keyring, tenantID); err != nil {
+			return err
+		}
+	}
+	if progress.State == RotationPaused {
+		return ErrRotationPaused
+	}
+
+	oldKey, err := keyring.Key(ctx, progress.OldKeyID)
+	if err != nil {
+		return fmt.Errorf("old key lookup failed: %w", err)
+	}
+	newKey, err := keyring.Key(ctx, progress.NewKeyID)
+	if err != nil {
+		return fmt.Errorf("new key lookup failed: %w", err)
+	}
+
+	sealCipher := SymmetricAEADName()
+	newAEAD, err := NewAEAD(sealCipher, newKey[:])
+	if err != nil {
+		return err
+	}
+	// Records may have been sealed with either AEAD before a FIPS toggle
+	openers := func(name string) (cipherAEAD, error) {
+		if name == "" {
+			name = CipherChaCha20Poly1305
+		}
+		if name == CipherChaCha20Poly1305 {
+			return chacha20poly1305.New(oldKey[:])
+		}
+		return NewAEAD(name, oldKey[:])
+	}
+
+	slog.Info("memory key rotation running", "rotation", progress.ID, "tenant", progress.TenantID,
+		"from", progress.OldKeyID, "to", progress.NewKeyID, "cursor", progress.Cursor)
+
+	// Errors leave the rotation running so the next RunScheduled pass
+	// resumes it from the last checkpoint
+	for {
+		state, err := e.rotationState(ctx, progress.ID)
+		if err != nil {
+			return err
+		}
+		if state == RotationPaused {
+			return ErrRotationPaused
+		}
+
+		n, cursor, err := e.reencryptBatch(ctx, progress, openers, newAEAD, sealCipher, schedule.BatchSize)
+		if err != nil {
+			return fmt.Errorf("re-encryption batch failed at %q: %w", progress.Cursor, err)
+		}
+		if n == 0 {
+			// Records written under the old key behind the cursor, e.g.
+			// by a writer that had not yet seen the new key, need another pass
+			remaining, err := e.remainingUnderKey(ctx, progress.OldKeyID)
+			if err != nil {
+				return err
+			}
+			if remaining == 0 {
+				break
+			}
+			if err := e.resetRotationCursor(ctx, progress); err != nil {
+				return err
+			}
+			continue
+		}
+		progress.Cursor = cursor
+		progress.Processed += int64(n)
+		atomic.AddInt64(&e.metrics.Processed, int64(n))
+
+		if schedule.BatchPause > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(schedule.BatchPause):
+			}
+		}
+	}
+
+	// The other tables need no cursor: rows leave the old key's result set
+	// as they are rewritten
+	for _, table := range sealedTables {
+		for {
+			n, err := e.reencryptTableBatch(ctx, table, progress, openers, newAEAD, sealCipher, schedule.BatchSize)
+			if err != nil {
+				return fmt.Errorf("%s re-encryption failed: %w", table, err)
+			}
+			if n == 0 {
+				break
+			}
+			progress.Processed += int64(n)
+			atomic.AddInt64(&e.metrics.Processed, int64(n))
+		}
+	}
+
+	resealFn := func(cipherName string, data []byte) (string, string, []byte, error) {
+		oldAEAD, err := openers(cipherName)
+		if err != nil {
+			return "", "", nil, err
+		}
+		sealed, err := reseal(oldAEAD, newAEAD, data)
+		return progress.NewKeyID, sealCipher, sealed, err
+	}
+	for _, store := range schedule.Stores {
+		n, err := store.Reseal(ctx, progress.OldKeyID, resealFn)
+		if err != nil {
+			return fmt.Errorf("sealed store re-encryption failed: %w", err)
+		}
+		progress.Processed += int64(n)
+		atomic.AddInt64(&e.metrics.Processed, int64(n))
+	}
+
+	if err := keyring.Activate(ctx, progress.TenantID, progress.NewKeyID); err != nil {
+		return fmt.Errorf("key activation failed: %w", err)
+	}
+	_, err = e.db.ExecContext(ctx,
+		`UPDATE crypto_rotations SET state = $1, completed_at = NOW() WHERE id = $2`,
+		RotationCompleted, progress.ID)
+	if err != nil {
+		return fmt.Errorf("rotation completion failed: %w", err)
+	}
+
+	slog.Info("memory key rotation completed", "rotation", progress.ID, "tenant", progress.TenantID, "records", progress.Processed)
+	return nil
+}
+
+// reencryptBatch rewrites one keyset page and advances the checkpoint in
+// the same transaction. Rows held by concurrent writers are waited for
+// rather than skipped, since the cursor moves past everything it returns.
+func (e *KeyMigrationEngine) reencryptBatch(ctx context.Context, progress *RotationProgress,
+	openers func(string) (cipherAEAD, error), newAEAD cipherAEAD, sealCipher string, limit int) (int, string, error) {
+
+	tx, err := e.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	after := progress.Cursor
+	if after == "" {
+		after = nilRotationCursor
+	}
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, data, cipher FROM memories
+		 WHERE id > $1::uuid AND key_id = $2
+		 ORDER BY id
+		 LIMIT $3
+		 FOR UPDATE`, after, progress.OldKeyID, limit)
+	if err != nil {
+		return 0, "", err
+	}
+
+	type pending struct {
+		id     string
+		data   []byte
+		cipher string
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.data, &p.cipher); err != nil {
+			rows.Close()
+			return 0, "", err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+	if len(batch) == 0 {
+		return 0, progress.Cursor, nil
+	}
+
+	for _, p := range batch {
+		oldAEAD, err := openers(p.cipher)
+		if err != nil {
+			return 0, "", fmt.Errorf("record %s: %w", p.id, err)
+		}
+		sealed, err := reseal(oldAEAD, newAEAD, p.data)
+		if err != nil {
+			return 0, "", fmt.Errorf("record %s: %w", p.id, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE memories SET data = $1, key_id = $2, cipher = $3 WHERE id = $4::uuid`,
+			sealed, progress.NewKeyID, sealCipher, p.id); err != nil {
+			return 0, "", err
+		}
+	}
+
+	cursor := batch[len(batch)-1].id
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE crypto_rotations SET cursor = $1, processed = processed + $2, updated_at = NOW()
+		 WHERE id = $3`, cursor, len(batch), progress.ID); err != nil {
+		return 0, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+	return len(batch), cursor, nil
+}
+
+// reencryptTableBatch rewrites one page of table's rows sealed under the
+// old key. Rows are addressed by ctid, which the FOR UPDATE lock holds
+// steady until commit, and locked rows are waited for so an empty page
+// means none remain.
+func (e *KeyMigrationEngine) reencryptTableBatch(ctx context.Context, table string, progress *RotationProgress,
+	openers func(string) (cipherAEAD, error), newAEAD cipherAEAD, sealCipher string, limit int) (int, error) {
+
+	tx, err := e.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT ctid::text, data, cipher FROM `+table+`
+		 WHERE key_id = $1
+		 LIMIT $2
+		 FOR UPDATE`, progress.OldKeyID, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type pending struct {
+		ctid   string
+		data   []byte
+		cipher string
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.ctid, &p.data, &p.cipher); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range batch {
+		oldAEAD, err := openers(p.cipher)
+		if err != nil {
+			return 0, fmt.Errorf("row %s: %w", p.ctid, err)
+		}
+		sealed, err := reseal(oldAEAD, newAEAD, p.data)
+		if err != nil {
+			return 0, fmt.Errorf("row %s: %w", p.ctid, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE `+table+` SET data = $1, key_id = $2, cipher = $3 WHERE ctid = $4::tid`,
+			sealed, progress.NewKeyID, sealCipher, p.ctid); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), tx.Commit()
+}
+
+type cipherAEAD interface {
+	NonceSize() int
+	Seal(dst, nonce, plaintext, additionalData []byte) []byte
+	Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error)
+}
+
+func reseal(oldAEAD, newAEAD cipherAEAD, data []byte) ([]byte, error) {
+	ns := oldAEAD.NonceSize()
+	if len(data) < ns {
+		return nil, errors.New("invalid ciphertext length")
+	}
+	plaintext, err := oldAEAD.Open(nil, data[:ns], data[ns:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+	defer zero(plaintext)
+
+	nonce := make([]byte, newAEAD.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return newAEAD.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (e *KeyMigrationEngine) startRotation(ctx context.Context, keyring MemoryKeyring, tenantID string) (*RotationProgress, error) {
+	oldID, _, err := keyring.ActiveKey(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("active key lookup failed: %w", err)
+	}
+	newID, _, err := keyring.NewKey(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("key creation failed: %w", err)
+	}
+
+	p := &RotationProgress{TenantID: tenantID, OldKeyID: oldID, NewKeyID: newID, State: RotationRunning, StartedAt: time.Now().UTC()}
+	err = e.db.QueryRowContext(ctx,
+		`INSERT INTO crypto_rotations (tenant_id, old_key_id, new_key_id, state, cursor, processed, started_at, updated_at)
+		 VALUES ($1, $2, $3, $4, '', 0, $5, $5) RETURNING id`,
+		p.TenantID, p.OldKeyID, p.NewKeyID, p.State, p.StartedAt).Scan(&p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("rotation record failed: %w", err)
+	}
+	return p, nil
+}
+
+// loadOpenRotation returns the tenant's latest unfinished rotation. A
+// failed rotation is resumed from its checkpoint rather than abandoned,
+// since its records are already split between the old and new keys.
+func (e *KeyMigrationEngine) loadOpenRotation(ctx context.Context, tenantID string) (*RotationProgress, error) {
+	var p RotationProgress
+	err := e.db.QueryRowContext(ctx,
+		`SELECT id, tenant_id, old_key_id, new_key_id, state, cursor, processed, started_at, completed_at
+		 FROM crypto_rotations
+		 WHERE tenant_id = $1 AND state IN ('running', 'paused', 'failed')
+		 ORDER BY started_at DESC LIMIT 1`, tenantID).
+		Scan(&p.ID, &p.TenantID, &p.OldKeyID, &p.NewKeyID, &p.State, &p.Cursor, &p.Processed, &p.StartedAt, &p.CompletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rotation checkpoint lookup failed: %w", err)
+	}
+	if p.State == RotationFailed {
+		if err := e.setRotationState(ctx, p.ID, RotationRunning); err != nil {
+			return nil, fmt.Errorf("rotation resume failed: %w", err)
+		}
+		p.State = RotationRunning
+	}
+	return &p, nil
+}
+
+// remainingUnderKey counts memory records still sealed under keyID
+func (e *KeyMigrationEngine) remainingUnderKey(ctx context.Context, keyID string) (int64, error) {
+	var n int64
+	err := e.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM memories WHERE key_id = $1`, keyID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("rotation remainder lookup failed: %w", err)
+	}
+	return n, nil
+}
+
+// resetRotationCursor restarts the keyset walk from the first memory ID
+func (e *KeyMigrationEngine) resetRotationCursor(ctx context.Context, progress *RotationProgress) error {
+	if _, err := e.db.ExecContext(ctx,
+		`UPDATE crypto_rotations SET cursor = '', updated_at = NOW() WHERE id = $1`, progress.ID); err != nil {
+		return fmt.Errorf("rotation cursor reset failed: %w", err)
+	}
+	progress.Cursor = ""
+	return nil
+}
+
+func (e *KeyMigrationEngine) rotationState(ctx context.Context, id int64) (RotationState, error) {
+	var state RotationState
+	err := e.db.QueryRowContext(ctx, `SELECT state FROM crypto_rotations WHERE id = $1`, id).Scan(&state)
+	return state, err
+}
+
+func (e *KeyMigrationEngine) setRotationState(ctx context.Context, id int64, state RotationState) error {
+	_, err := e.db.ExecContext(ctx,
+		`UPDATE crypto_rotations SET state = $1, updated_at = NOW() WHERE id = $2`, state, id)
+	return err
+}
+
+// PauseRotation halts every running rotation after its current batch
+func (e *KeyMigrationEngine) PauseRotation(ctx context.Context) error {
+	_, err := e.db.ExecContext(ctx,
+		`UPDATE crypto_rotations SET state = 'paused', updated_at = NOW() WHERE state = 'running'`)
+	return err
+}
+
+// ResumeRotation marks paused rotations runnable; RunScheduled picks them up on its next poll
+func (e *KeyMigrationEngine) ResumeRotation(ctx context.Context) error {
+	_, err := e.db.ExecContext(ctx,
+		`UPDATE crypto_rotations SET state = 'running', updated_at = NOW() WHERE state = 'paused'`)
+	return err
+}
+
+// RotationStatus returns the most recent rotation checkpoint
+func (e *KeyMigrationEngine) RotationStatus(ctx context.Context) (*RotationProgress, error) {
+	var p RotationProgress
+	err := e.db.QueryRowContext(ctx,
+		`SELECT id, tenant_id, old_key_id, new_key_id, state, cursor, processed, started_at, completed_at
+		 FROM crypto_rotations ORDER BY started_at DESC LIMIT 1`).
+		Scan(&p.ID, &p.TenantID, &p.OldKeyID, &p.NewKeyID, &p.State, &p.Cursor, &p.Processed, &p.StartedAt, &p.CompletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return &p, err
+}
+
+// Required SQL schema (execute during initialization)
+/*
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS key_id VARCHAR(128) NOT NULL DEFAULT 'initial';
+
+CREATE TABLE IF NOT EXISTS crypto_rotations (
+    id           BIGSERIAL PRIMARY KEY,
+    tenant_id    VARCHAR(255) NOT NULL,
+    old_key_id   VARCHAR(128) NOT NULL,
+    new_key_id   VARCHAR(128) NOT NULL,
+    state        VARCHAR(16) NOT NULL,
+    cursor       TEXT NOT NULL,
+    processed    BIGINT NOT NULL,
+    started_at   TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at   TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_memories_key ON memories (key_id, id);
+CREATE INDEX idx_crypto_rotations_tenant ON crypto_rotations (tenant_id, started_at);
+CREATE INDEX idx_memories_archive_key ON memories_archive (key_id);
+CREATE INDEX idx_memory_blobs_key ON memory_blobs (key_id);
+CREATE INDEX idx_namespace_entries_key ON memory_namespace_entries (key_id);
+CREATE INDEX idx_agent_checkpoints_key ON agent_checkpoints (key_id);
+*/
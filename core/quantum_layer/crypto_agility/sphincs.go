@@ -0,0 +1,75 @@
+// sphincs.go - SPHINCS+ (SLH-DSA) Stateless Hash-Based Signatures
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cloudflare/circl/sign/slhdsa"
+)
+
+// sphincsParams is the SLH-DSA parameter set behind SPHINCSPlus_SHA2_192s
+// (NIST security category 3, small signatures)
+const sphincsParams = slhdsa.SHA2_192s
+
+// SPHINCSSpec is the AlgorithmSpec for migrations targeting SPHINCS+; it
+// relies only on hash function security, for policies that disallow lattices
+var SPHINCSSpec = AlgorithmSpec{
+	Type:        SPHINCSPlus_SHA2_192s,
+	NISTLevel:   3,
+	QuantumSafe: true,
+}
+
+// SPHINCSPrivateKey wraps an SLH-DSA key so it satisfies crypto.Signer
+type SPHINCSPrivateKey struct {
+	key *slhdsa.PrivateKey
+}
+
+func generateSPHINCSKey() (crypto.PrivateKey, error) {
+	_, priv, err := slhdsa.GenerateKey(rand.Reader, sphincsParams)
+	if err != nil {
+		return nil, fmt.Errorf("SPHINCS+ key generation failed: %w", err)
+	}
+	return &SPHINCSPrivateKey{key: &priv}, nil
+}
+
+func (k *SPHINCSPrivateKey) Public() crypto.PublicKey {
+	return k.key.Public()
+}
+
+// Sign signs the full message; SLH-DSA hashes internally so opts must be crypto.Hash(0)
+func (k *SPHINCSPrivateKey) Sign(r io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts != nil && opts.HashFunc() != 0 {
+		return nil, errors.New("SPHINCS+ signs messages directly; pre-hashed input is not supported")
+	}
+	return k.key.Sign(r, message, opts)
+}
+
+// MarshalBinary encodes the private key for storage through KeyStorage
+func (k *SPHINCSPrivateKey) MarshalBinary() ([]byte, error) {
+	return k.key.MarshalBinary()
+}
+
+// UnmarshalSPHINCSPrivateKey restores a key produced by MarshalBinary
+func UnmarshalSPHINCSPrivateKey(data []byte) (*SPHINCSPrivateKey, error) {
+	priv := slhdsa.PrivateKey{ID: sphincsParams}
+	if err := priv.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("SPHINCS+ key decode failed: %w", err)
+	}
+	return &SPHINCSPrivateKey{key: &priv}, nil
+}
+
+// VerifySPHINCS checks an SLH-DSA signature over message
+func VerifySPHINCS(pub crypto.PublicKey, message, sig []byte) error {
+	pk, ok := pub.(*slhdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: expected SLH-DSA public key, got %T", ErrUnsupportedAlgorithm, pub)
+	}
+	if !slhdsa.Verify(pk, slhdsa.NewMessage(message), sig, nil) {
+		return errors.New("SPHINCS+ signature verification failed")
+	}
+	return nil
+}
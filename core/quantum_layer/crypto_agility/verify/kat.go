@@ -0,0 +1,374 @@
+// kat.go - Cryptographic Known-Answer Tests and Interoperability Checks
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	qcrypto "cirium.ai/core/crypto"
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/cloudflare/circl/sign/dilithium/mode3"
+	"github.com/cloudflare/circl/sign/slhdsa"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var ErrSelfTestFailed = errors.New("cryptographic self-test failed")
+
+// Result records the outcome of a single known-answer test
+type Result struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Report is the outcome of a full verification run
+type Report struct {
+	Results []Result `json:"results"`
+	Passed  bool     `json:"passed"`
+}
+
+// Err returns ErrSelfTestFailed naming every failed test, or nil
+func (r Report) Err() error {
+	if r.Passed {
+		return nil
+	}
+	var failed []string
+	for _, res := range r.Results {
+		if !res.Passed {
+			failed = append(failed, res.Name+": "+res.Error)
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrSelfTestFailed, failed)
+}
+
+type knownAnswerTest struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+var suite = []knownAnswerTest{
+	{qcrypto.CipherChaCha20Poly1305, chachaKAT},
+	{qcrypto.CipherAESGCM, aesGCMKAT},
+	{"kyber768", kyberKAT},
+	{"dilithium3", dilithiumKAT},
+	{"sphincs+-sha2-192s", sphincsKAT},
+	{"rsa2048", rsaKAT},
+	{"ecdsa-p256", ecdsaKAT},
+	{"hybrid-tls", hybridTLSCheck},
+}
+
+// Run executes every known-answer test and returns the combined report
+func Run(ctx context.Context) Report {
+	report := Report{Passed: true}
+	for _, kat := range suite {
+		start := time.Now()
+		err := kat.run(ctx)
+		res := Result{Name: kat.name, Passed: err == nil, Duration: time.Since(start)}
+		if err != nil {
+			res.Error = err.Error()
+			report.Passed = false
+			slog.Error("crypto self-test failed", "test", kat.name, "error", err)
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report
+}
+
+// Strict runs the suite and returns an error if any primitive misbehaves;
+// callers use it to refuse to boot on a faulty host
+func Strict(ctx context.Context) error {
+	report := Run(ctx)
+	if err := report.Err(); err != nil {
+		return err
+	}
+	slog.Info("crypto self-tests passed", "tests", len(report.Results))
+	return nil
+}
+
+// RFC 8439 section 2.8.2 AEAD test vector
+var (
+	rfc8439Key   = sequence(32, 0x80)
+	rfc8439Nonce = mustHex("070000004041424344454647")
+	rfc8439AAD   = mustHex("50515253c0c1c2c3c4c5c6c7")
+	rfc8439Plain = []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	rfc8439Tag   = mustHex("1ae10b594f09e26a7e902ecbd0600691")
+)
+
+func chachaKAT(ctx context.Context) error {
+	aead, err := chacha20poly1305.New(rfc8439Key)
+	if err != nil {
+		return err
+	}
+	return aeadKAT(aead, "4e54427e462f3beb69677d39865c5da8d57f603a85f7bf71368dce8ec9b9933c", rfc8439Tag)
+}
+
+func aesGCMKAT(ctx context.Context) error {
+	block, err := aes.NewCipher(rfc8439Key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	return aeadKAT(aead, "889ea5bd3e568a98fe99ab2e83c2f60bd1cdcddff7fd0493174f35eccf702707", nil)
+}
+
+func aeadKAT(aead cipher.AEAD, wantDigest string, wantTag []byte) error {
+	ct := aead.Seal(nil, rfc8439Nonce, rfc8439Plain, rfc8439AAD)
+	if err := expectDigest("ciphertext", ct, wantDigest); err != nil {
+		return err
+	}
+	if wantTag != nil && !bytes.Equal(ct[len(ct)-aead.Overhead():], wantTag) {
+		return errors.New("authentication tag mismatch")
+	}
+	pt, err := aead.Open(nil, rfc8439Nonce, ct, rfc8439AAD)
+	if err != nil || !bytes.Equal(pt, rfc8439Plain) {
+		return errors.New("round-trip decryption mismatch")
+	}
+	ct[0] ^= 0x01
+	if _, err := aead.Open(nil, rfc8439Nonce, ct, rfc8439AAD); err == nil {
+		return errors.New("tampered ciphertext accepted")
+	}
+	return nil
+}
+
+func kyberKAT(ctx context.Context) error {
+	scheme := kyber768.Scheme()
+	pk, sk := scheme.DeriveKeyPair(sequence(scheme.SeedSize(), 0x00))
+	pkBytes, err := pk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := expectDigest("public key", pkBytes,
+		"32992ebf18a03bc8efb6dc12782f0ec788dda3599580f5ffc8a52f761c7fbe5a"); err != nil {
+		return err
+	}
+
+	ct, ss, err := scheme.EncapsulateDeterministically(pk, sequence(scheme.EncapsulationSeedSize(), 0x40))
+	if err != nil {
+		return err
+	}
+	if err := expectDigest("ciphertext", ct,
+		"ef1885c43a88337bfcbd0d2d33ae8bf4f96eb54012b61c0debe322f2eb4dabc5"); err != nil {
+		return err
+	}
+	if err := expectDigest("shared secret", ss,
+		"f39efa6578f26519006196772aae5f803148693350a0f39e073059fcbb8539aa"); err != nil {
+		return err
+	}
+
+	recovered, err := scheme.Decapsulate(sk, ct)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(recovered, ss) {
+		return errors.New("decapsulated secret mismatch")
+	}
+	return nil
+}
+
+func dilithiumKAT(ctx context.Context) error {
+	var seed [mode3.SeedSize]byte
+	copy(seed[:], sequence(mode3.SeedSize, 0x20))
+	pk, sk := mode3.NewKeyFromSeed(&seed)
+	pkBytes, err := pk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := expectDigest("public key", pkBytes,
+		"fb075d77b1d99beb568377a381c5be06da1846cf64c06500e4ad015eb704e48e"); err != nil {
+		return err
+	}
+
+	msg := []byte("nuzon-kat")
+	sig := make([]byte, mode3.SignatureSize)
+	mode3.SignTo(sk, msg, sig)
+	if err := expectDigest("signature", sig,
+		"ad91875cc680d05d7748ea093174e221041fd91561b8fb1521a8bc1d7b5c9bed"); err != nil {
+		return err
+	}
+	if !mode3.Verify(pk, msg, sig) {
+		return errors.New("valid signature rejected")
+	}
+	sig[0] ^= 0x01
+	if mode3.Verify(pk, msg, sig) {
+		return errors.New("tampered signature accepted")
+	}
+	return nil
+}
+
+// sphincsKAT derives a key from a fixed seed and signs deterministically
+// (FIPS 205 with an empty context); the expected values were cross-checked
+// against OpenSSL 3.5
+func sphincsKAT(ctx context.Context) error {
+	pub, priv, err := slhdsa.GenerateKey(bytes.NewReader(sequence(72, 0x60)), slhdsa.SHA2_192s)
+	if err != nil {
+		return err
+	}
+	pkBytes, err := pub.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := expectDigest("public key", pkBytes,
+		"438f88f27ea95d59c742e300a5c7adec229e59374885aa13631087c2d946a238"); err != nil {
+		return err
+	}
+
+	msg := slhdsa.NewMessage([]byte("nuzon-kat"))
+	sig, err := slhdsa.SignDeterministic(&priv, msg, nil)
+	if err != nil {
+		return err
+	}
+	if err := expectDigest("signature", sig,
+		"1339e79c6dd1f9c5cc6a412f68ae71bda4765d57a720017a87a34348db5c1963"); err != nil {
+		return err
+	}
+	if !slhdsa.Verify(&pub, msg, sig, nil) {
+		return errors.New("valid signature rejected")
+	}
+	sig[0] ^= 0x01
+	if slhdsa.Verify(&pub, msg, sig, nil) {
+		return errors.New("tampered signature accepted")
+	}
+	return nil
+}
+
+// Primes of a fixed RSA-2048 test key with e = 65537
+var (
+	rsaKATP = mustHex("ff5d3752c5a7c60e2d8a54fcba27a0c40a22eaff19a2183f84f8be4de8885257" +
+		"299cd473c73a02db98f9dc7b60343d5c4b30f96651fec6644efaa1732a516a94" +
+		"998663f7dcabc294c9ecda8884e00f37126fc4d605fa0144024a0786b1b9d75b" +
+		"5bf43454169621b375e96f0967c83eab71d3303638ac0c96b917c595f685546f")
+	rsaKATQ = mustHex("d5e79f3c5c884a9c9443df62d037fb801d6795f5f9ec4b232f808ee9ed02959e" +
+		"5438d42089422e571ec1b8998958f5ef81035f05768b206c15363d61d4a27df8" +
+		"c6459bb0b139efc65796489b3854cbbf103b18934d822cc04c0a700cdbac36a5" +
+		"2b15ed7d97b0159fb60b752fb4ba394a1ba92f0ccc06135ef7af5690eae99e6f")
+)
+
+// rsaKAT signs with PKCS #1 v1.5, which is deterministic, and checks that
+// PSS signatures round-trip under the same key
+func rsaKAT(ctx context.Context) error {
+	p, q := new(big.Int).SetBytes(rsaKATP), new(big.Int).SetBytes(rsaKATQ)
+	one := big.NewInt(1)
+	phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: new(big.Int).Mul(p, q), E: 65537},
+		D:         new(big.Int).ModInverse(big.NewInt(65537), phi),
+		Primes:    []*big.Int{p, q},
+	}
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	key.Precompute()
+	if err := expectDigest("modulus", key.N.Bytes(),
+		"28fccdde75966196495f9f552c981ded6c685a8692acf662775eb14b1f7bba59"); err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte("nuzon-kat"))
+	sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return err
+	}
+	if err := expectDigest("signature", sig,
+		"74cd0d7db4338086086e970d702222cc6c30566da498aedd8e9cc78e7cb23573"); err != nil {
+		return err
+	}
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		return errors.New("valid signature rejected")
+	}
+	sig[0] ^= 0x01
+	if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig) == nil {
+		return errors.New("tampered signature accepted")
+	}
+
+	pss, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], nil)
+	if err != nil {
+		return err
+	}
+	if err := rsa.VerifyPSS(&key.PublicKey, crypto.SHA256, digest[:], pss, nil); err != nil {
+		return errors.New("valid PSS signature rejected")
+	}
+	return nil
+}
+
+// RFC 6979 appendix A.2.5: P-256 key and the SHA-256 signature of "sample"
+var (
+	rfc6979X  = mustHex("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")
+	rfc6979Ux = mustHex("60fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6")
+	rfc6979Uy = mustHex("7903fe1008b8bc99a41ae9e95628bc64f2f1b20c2d7e9f5177a3c294d4462299")
+	rfc6979R  = mustHex("efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716")
+	rfc6979S  = mustHex("f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8")
+)
+
+// ecdsaKAT checks public key derivation and verification against RFC 6979;
+// signing is randomized, so fresh signatures are checked by round trip
+func ecdsaKAT(ctx context.Context) error {
+	curve := elliptic.P256()
+	x, y := curve.ScalarBaseMult(rfc6979X)
+	if !bytes.Equal(x.FillBytes(make([]byte, 32)), rfc6979Ux) || !bytes.Equal(y.FillBytes(make([]byte, 32)), rfc6979Uy) {
+		return errors.New("public key derivation mismatch")
+	}
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y},
+		D:         new(big.Int).SetBytes(rfc6979X),
+	}
+
+	digest := sha256.Sum256([]byte("sample"))
+	r, s := new(big.Int).SetBytes(rfc6979R), new(big.Int).SetBytes(rfc6979S)
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+		return errors.New("known signature rejected")
+	}
+	if ecdsa.Verify(&key.PublicKey, digest[:], r, new(big.Int).Add(s, big.NewInt(1))) {
+		return errors.New("tampered signature accepted")
+	}
+
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		return errors.New("fresh signature rejected")
+	}
+	return nil
+}
+
+func expectDigest(what string, got []byte, want string) error {
+	sum := sha256.Sum256(got)
+	if hex.EncodeToString(sum[:]) != want {
+		return fmt.Errorf("%s digest mismatch", what)
+	}
+	return nil
+}
+
+func sequence(n int, start byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = start + byte(i)
+	}
+	return b
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
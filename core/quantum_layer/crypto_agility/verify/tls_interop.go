@@ -0,0 +1,94 @@
+// tls_interop.go - Hybrid Post-Quantum TLS Handshake Check
+package verify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+const handshakeTimeout = 5 * time.Second
+
+// hybridTLSCheck completes an in-memory TLS 1.3 handshake restricted to the
+// X25519+ML-KEM-768 hybrid group and confirms it was actually negotiated
+func hybridTLSCheck(ctx context.Context) error {
+	cert, pool, err := selfSignedCert()
+	if err != nil {
+		return err
+	}
+
+	serverCfg := &tls.Config{
+		Certificates:     []tls.Certificate{cert},
+		MinVersion:       tls.VersionTLS13,
+		CurvePreferences: []tls.CurveID{tls.X25519MLKEM768},
+	}
+	clientCfg := &tls.Config{
+		RootCAs:          pool,
+		ServerName:       "kat.nuzon.local",
+		MinVersion:       tls.VersionTLS13,
+		CurvePreferences: []tls.CurveID{tls.X25519MLKEM768},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	server := tls.Server(serverConn, serverCfg)
+	serverErr := make(chan error, 1)
+	go func() { serverErr <- server.HandshakeContext(ctx) }()
+
+	client := tls.Client(clientConn, clientCfg)
+	if err := client.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("client handshake failed: %w", err)
+	}
+	if err := <-serverErr; err != nil {
+		return fmt.Errorf("server handshake failed: %w", err)
+	}
+
+	state := client.ConnectionState()
+	if state.Version != tls.VersionTLS13 {
+		return fmt.Errorf("negotiated %s, want TLS 1.3", tls.VersionName(state.Version))
+	}
+	if state.CurveID != tls.X25519MLKEM768 {
+		return fmt.Errorf("negotiated key exchange %s, want %s", state.CurveID, tls.X25519MLKEM768)
+	}
+	return nil
+}
+
+func selfSignedCert() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "nuzon crypto self-test"},
+		DNSNames:     []string{"kat.nuzon.local"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("self-test certificate creation failed: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool, nil
+}
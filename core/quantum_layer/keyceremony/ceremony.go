@@ -0,0 +1,219 @@
+// ceremony.go - Split-Knowledge Root Key Escrow and Unseal
+package keyceremony
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const rootKeySize = 32
+
+var (
+	ErrSealed          = errors.New("root key is sealed")
+	ErrQuorumNotMet    = errors.New("share quorum not met")
+	ErrShareMismatch   = errors.New("shares do not reconstruct the escrowed root key")
+	ErrDuplicateShare  = errors.New("share already submitted")
+	ErrAlreadyUnsealed = errors.New("root key already unsealed")
+)
+
+// Escrow is the public, non-secret description of a share set; it is safe to
+// persist alongside the sealed data
+type Escrow struct {
+	Threshold   int       `json:"threshold"`
+	Shares      int       `json:"shares"`
+	Fingerprint [32]byte  `json:"fingerprint"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Initialize generates a new root key and splits it into n shares with the
+// given threshold. The caller distributes shares to custodians; the root key
+// is never returned.
+func Initialize(n, threshold int) (Escrow, [][]byte, error) {
+	key := make([]byte, rootKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return Escrow{}, nil, fmt.Errorf("root key generation failed: %w", err)
+	}
+	defer wipe(key)
+	return escrowKey(key, n, threshold)
+}
+
+// ImportRootKey splits an existing root key into n shares with the given
+// threshold, bringing a key that predates the ceremony under escrow. The
+// caller still owns key and should wipe it once the shares are distributed.
+func ImportRootKey(key []byte, n, threshold int) (Escrow, [][]byte, error) {
+	if len(key) != rootKeySize {
+		return Escrow{}, nil, fmt.Errorf("root key must be %d bytes, got %d", rootKeySize, len(key))
+	}
+	return escrowKey(key, n, threshold)
+}
+
+func escrowKey(key []byte, n, threshold int) (Escrow, [][]byte, error) {
+	shares, err := Split(key, n, threshold)
+	if err != nil {
+		return Escrow{}, nil, err
+	}
+	return Escrow{
+		Threshold:   threshold,
+		Shares:      n,
+		Fingerprint: sha256.Sum256(key),
+		CreatedAt:   time.Now().UTC(),
+	}, shares, nil
+}
+
+// Unsealer collects custodian shares at startup until the quorum is reached
+type Unsealer struct {
+	escrow  Escrow
+	mu      sync.Mutex
+	pending map[byte][]byte
+	rootKey []byte
+	logger  *slog.Logger
+}
+
+// NewUnsealer starts in the sealed state for the given escrow
+func NewUnsealer(escrow Escrow) *Unsealer {
+	return &Unsealer{
+		escrow:  escrow,
+		pending: make(map[byte][]byte),
+		logger:  slog.Default().With("component", "keyceremony"),
+	}
+}
+
+// Submit adds one share; it reports true once the root key is unsealed
+func (u *Unsealer) Submit(share []byte) (bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.rootKey != nil {
+		return true, ErrAlreadyUnsealed
+	}
+	if len(share) != rootKeySize+1 {
+		return false, ErrInvalidShares
+	}
+	x := share[len(share)-1]
+	if _, ok := u.pending[x]; ok {
+		return false, ErrDuplicateShare
+	}
+	u.pending[x] = append([]byte(nil), share...)
+	u.logger.Info("unseal share accepted", "progress", len(u.pending), "threshold", u.escrow.Threshold)
+
+	if len(u.pending) < u.escrow.Threshold {
+		return false, nil
+	}
+
+	key, err := reconstruct(u.escrow, u.pending)
+	u.reset()
+	if err != nil {
+		return false, err
+	}
+	u.rootKey = key
+	u.logger.Info("root key unsealed")
+	return true, nil
+}
+
+// Progress reports how many shares have been submitted toward the quorum
+func (u *Unsealer) Progress() (submitted, threshold int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.pending), u.escrow.Threshold
+}
+
+// Sealed reports whether the root key is unavailable
+func (u *Unsealer) Sealed() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.rootKey == nil
+}
+
+// RootKey returns a copy of the unsealed root key
+func (u *Unsealer) RootKey() ([rootKeySize]byte, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var key [rootKeySize]byte
+	if u.rootKey == nil {
+		return key, ErrSealed
+	}
+	copy(key[:], u.rootKey)
+	return key, nil
+}
+
+// Seal discards the in-memory root key and any partial progress
+func (u *Unsealer) Seal() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.rootKey != nil {
+		wipe(u.rootKey)
+		u.rootKey = nil
+	}
+	u.reset()
+}
+
+func (u *Unsealer) reset() {
+	for x, s := range u.pending {
+		wipe(s)
+		delete(u.pending, x)
+	}
+}
+
+// Export returns the root key only when a fresh quorum of shares is presented,
+// independent of the current unseal state
+func Export(escrow Escrow, shares [][]byte) ([]byte, error) {
+	set, err := shareSet(escrow, shares)
+	if err != nil {
+		return nil, err
+	}
+	return reconstruct(escrow, set)
+}
+
+// Rotate re-splits the root key under a new share count and threshold. A quorum
+// of existing shares is required; the previous share set becomes invalid only
+// once custodians destroy it.
+func Rotate(escrow Escrow, shares [][]byte, n, threshold int) (Escrow, [][]byte, error) {
+	key, err := Export(escrow, shares)
+	if err != nil {
+		return Escrow{}, nil, err
+	}
+	defer wipe(key)
+	return escrowKey(key, n, threshold)
+}
+
+func shareSet(escrow Escrow, shares [][]byte) (map[byte][]byte, error) {
+	set := make(map[byte][]byte, len(shares))
+	for _, s := range shares {
+		if len(s) != rootKeySize+1 {
+			return nil, ErrInvalidShares
+		}
+		x := s[len(s)-1]
+		if _, ok := set[x]; ok {
+			return nil, ErrDuplicateShare
+		}
+		set[x] = s
+	}
+	if len(set) < escrow.Threshold {
+		return nil, fmt.Errorf("%w: have %d, need %d", ErrQuorumNotMet, len(set), escrow.Threshold)
+	}
+	return set, nil
+}
+
+func reconstruct(escrow Escrow, set map[byte][]byte) ([]byte, error) {
+	shares := make([][]byte, 0, len(set))
+	for _, s := range set {
+		shares = append(shares, s)
+	}
+	key, err := Combine(shares)
+	if err != nil {
+		return nil, err
+	}
+	fp := sha256.Sum256(key)
+	if !constantTimeEqual(fp[:], escrow.Fingerprint[:]) {
+		wipe(key)
+		return nil, ErrShareMismatch
+	}
+	return key, nil
+}
@@ -0,0 +1,160 @@
+// shamir.go - Shamir Secret Sharing over GF(2^8)
+package keyceremony
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const maxShares = 255
+
+var (
+	ErrInvalidThreshold = errors.New("threshold must be between 2 and the share count")
+	ErrInvalidShares    = errors.New("shares are malformed or inconsistent")
+)
+
+var (
+	gfExp [512]byte
+	gfLog [256]byte
+)
+
+func init() {
+	// Generator 0x03 over the AES polynomial x^8 + x^4 + x^3 + x + 1
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+		x = gfMulNoTable(x, 0x03)
+	}
+	for i := 255; i < 512; i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMulNoTable(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		hi := a & 0x80
+		a <<= 1
+		if hi != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if b == 0 {
+		panic("keyceremony: division by zero in GF(256)")
+	}
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// evaluate computes the polynomial with the given coefficients at x (Horner)
+func evaluate(coeffs []byte, x byte) byte {
+	var out byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		out = gfMul(out, x) ^ coeffs[i]
+	}
+	return out
+}
+
+// Split divides secret into n shares of which any threshold reconstruct it.
+// Each share is len(secret)+1 bytes; the final byte is the share's x coordinate.
+func Split(secret []byte, n, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret must not be empty")
+	}
+	if n > maxShares || threshold < 2 || threshold > n {
+		return nil, ErrInvalidThreshold
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, threshold)
+	for idx, b := range secret {
+		coeffs[0] = b
+		if _, err := io.ReadFull(rand.Reader, coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("coefficient generation failed: %w", err)
+		}
+		for i := range shares {
+			shares[i][idx] = evaluate(coeffs, byte(i+1))
+		}
+	}
+	wipe(coeffs)
+	return shares, nil
+}
+
+// Combine reconstructs the secret from at least threshold distinct shares
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, ErrInvalidShares
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, ErrInvalidShares
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, s := range shares {
+		if len(s) != size {
+			return nil, ErrInvalidShares
+		}
+		x := s[size-1]
+		if x == 0 || seen[x] {
+			return nil, ErrInvalidShares
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	secret := make([]byte, size-1)
+	for idx := range secret {
+		var acc byte
+		for i, si := range shares {
+			// Lagrange basis polynomial evaluated at zero
+			basis := byte(1)
+			for j := range shares {
+				if i == j {
+					continue
+				}
+				basis = gfMul(basis, gfDiv(xs[j], xs[i]^xs[j]))
+			}
+			acc ^= gfMul(si[idx], basis)
+		}
+		secret[idx] = acc
+	}
+	return secret, nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func constantTimeEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
@@ -0,0 +1,62 @@
+// unseal_handler.go - HTTP Unseal Endpoint
+package keyceremony
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type unsealRequest struct {
+	Share string `json:"share"`
+}
+
+type unsealStatus struct {
+	Sealed    bool `json:"sealed"`
+	Progress  int  `json:"progress"`
+	Threshold int  `json:"threshold"`
+}
+
+// UnsealHandler accepts base64 shares via POST and reports seal status via GET,
+// mirroring Vault's sys/unseal workflow
+func UnsealHandler(u *Unsealer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req unsealRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+				http.Error(w, "malformed unseal request", http.StatusBadRequest)
+				return
+			}
+			share, err := base64.StdEncoding.DecodeString(req.Share)
+			if err != nil {
+				http.Error(w, "share must be base64 encoded", http.StatusBadRequest)
+				return
+			}
+			_, err = u.Submit(share)
+			wipe(share)
+			switch {
+			case err == nil, errors.Is(err, ErrAlreadyUnsealed):
+			case errors.Is(err, ErrShareMismatch):
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			default:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		progress, threshold := u.Progress()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(unsealStatus{
+			Sealed:    u.Sealed(),
+			Progress:  progress,
+			Threshold: threshold,
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// clusters.go - Member Cluster Discovery and State Aggregation
+package federation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// federationNamespace holds the kubeconfig Secrets of member clusters
+	federationNamespace = "cirium-federation"
+	// memberClusterLabel marks a Secret as a member cluster's kubeconfig;
+	// its value names the cluster. The Secret's other labels are the
+	// cluster's labels, which placement selectors match.
+	memberClusterLabel = "cirium.ai/member-cluster"
+	// kubeconfigKey is the Secret data key holding the kubeconfig
+	kubeconfigKey = "kubeconfig"
+
+	clusterProbeTimeout = 20 * time.Second
+)
+
+// memberCluster is a connected member cluster, rebuilt when its Secret
+// changes
+type memberCluster struct {
+	name          string
+	labels        map[string]string
+	secretVersion string
+	kubeClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+}
+
+// refreshMembers connects to every member cluster registered in
+// federationNamespace, reusing clients whose Secret is unchanged
+func (c *FederationController) refreshMembers(ctx context.Context) (map[string]*memberCluster, error) {
+	secrets, err := c.kubeClient.CoreV1().Secrets(federationNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: memberClusterLabel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list member clusters: %v", err)
+	}
+
+	c.memberLock.Lock()
+	defer c.memberLock.Unlock()
+	members := make(map[string]*memberCluster, len(secrets.Items))
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		name := secret.Labels[memberClusterLabel]
+		if name == "" {
+			name = secret.Name
+		}
+		if m, ok := c.members[name]; ok && m.secretVersion == secret.ResourceVersion {
+			members[name] = m
+			continue
+		}
+		m, err := connectMember(name, secret)
+		if err != nil {
+			klog.Errorf("Member cluster %s unusable: %v", name, err)
+			continue
+		}
+		members[name] = m
+	}
+	c.members = members
+	return members, nil
+}
+
+func connectMember(name string, secret *corev1.Secret) (*memberCluster, error) {
+	config, err := clientcmd.RESTConfigFromKubeConfig(secret.Data[kubeconfigKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %v", err)
+	}
+	config.Timeout = clusterProbeTimeout
+	kc, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string, len(secret.Labels))
+	for k, v := range secret.Labels {
+		if k != memberClusterLabel {
+			labels[k] = v
+		}
+	}
+	return &memberCluster{
+		name:          name,
+		labels:        labels,
+		secretVersion: secret.ResourceVersion,
+		kubeClient:    kc,
+		dynamicClient: dc,
+	}, nil
+}
+
+// member returns the connected member cluster called name
+func (c *FederationController) member(name string) (*memberCluster, bool) {
+	c.memberLock.RLock()
+	defer c.memberLock.RUnlock()
+	m, ok := c.members[name]
+	return m, ok
+}
+
+// observe reads a member cluster's state. Capacity and Allocatable sum
+// the cluster's ready, schedulable nodes; Allocatable then has the
+// requests of every pod not yet finished taken off, leaving what new
+// workloads can still claim.
+func (m *memberCluster) observe(ctx context.Context) ClusterState {
+	state := ClusterState{
+		Name:        m.name,
+		Labels:      m.labels,
+		Capacity:    corev1.ResourceList{},
+		Allocatable: corev1.ResourceList{},
+	}
+
+	nodes, err := m.kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Warningf("Member cluster %s unreachable: %v", m.name, err)
+		return state
+	}
+	usable := make(map[string]bool, len(nodes.Items))
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable || !nodeReady(node) {
+			continue
+		}
+		usable[node.Name] = true
+		addResources(state.Capacity, node.Status.Capacity)
+		addResources(state.Allocatable, node.Status.Allocatable)
+	}
+
+	pods, err := m.kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(
+			fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
+			fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
+		).String(),
+	})
+	if err != nil {
+		// without the pods in use the free room is unknown
+		klog.Warningf("Member cluster %s pods unreadable: %v", m.name, err)
+		return state
+	}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || usable[pod.Spec.NodeName] {
+			subResources(state.Allocatable, podRequests(&pod))
+		}
+	}
+
+	state.Ready = len(usable) > 0
+	return state
+}
+
+func nodeReady(node corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podRequests is what a pod holds of its node: the sum of its containers'
+// requests, or its largest init container's if that is more, plus overhead
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	out := corev1.ResourceList{}
+	for _, ctr := range pod.Spec.Containers {
+		addResources(out, ctr.Resources.Requests)
+	}
+	for _, ctr := range pod.Spec.InitContainers {
+		for name, q := range ctr.Resources.Requests {
+			if cur, ok := out[name]; !ok || q.Cmp(cur) > 0 {
+				out[name] = q.DeepCopy()
+			}
+		}
+	}
+	addResources(out, pod.Spec.Overhead)
+	return out
+}
+
+func addResources(into, add corev1.ResourceList) {
+	for name, q := range add {
+		sum := into[name]
+		sum.Add(q)
+		into[name] = sum
+	}
+}
+
+func subResources(from, sub corev1.ResourceList) {
+	for name, q := range sub {
+		left, ok := from[name]
+		if !ok {
+			continue
+		}
+		left.Sub(q)
+		if left.Sign() < 0 {
+			left = *resource.NewQuantity(0, left.Format)
+		}
+		from[name] = left
+	}
+}
+
+// distributeResource applies resource to every cluster it was placed on,
+// each copy carrying the replica count placed there
+func (c *FederationController) distributeResource(resource runtime.Object, decisions []PlacementDecision) error {
+	obj, ok := resource.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected federated resource type %T", resource)
+	}
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+	_, hasReplicas, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+
+	var failed []string
+	for _, d := range decisions {
+		m, ok := c.member(d.Cluster)
+		if !ok {
+			failed = append(failed, d.Cluster+": not connected")
+			continue
+		}
+		member := memberCopy(obj)
+		if hasReplicas {
+			if err := unstructured.SetNestedField(member.Object, int64(d.Replicas), "spec", "replicas"); err != nil {
+				return err
+			}
+		}
+		data, err := member.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		force := true
+		ctx, cancel := context.WithTimeout(context.TODO(), clusterProbeTimeout)
+		_, err = m.dynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace()).Patch(ctx,
+			obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: controllerName, Force: &force})
+		cancel()
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", d.Cluster, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to distribute %s/%s: %s", obj.GetNamespace(), obj.GetName(), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// memberCopy strips the host cluster's bookkeeping from obj so it can be
+// applied to a member cluster
+func memberCopy(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	out := obj.DeepCopy()
+	unstructured.RemoveNestedField(out.Object, "status")
+	unstructured.RemoveNestedField(out.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(out.Object, "metadata", "uid")
+	unstructured.RemoveNestedField(out.Object, "metadata", "generation")
+	unstructured.RemoveNestedField(out.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(out.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(out.Object, "metadata", "ownerReferences")
+	return out
+}
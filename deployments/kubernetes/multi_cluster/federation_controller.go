@@ -6,15 +6,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
@@ -34,8 +42,18 @@ const (
 type ClusterState struct {
 	Name       string
 	Ready      bool
+	// Labels are the cluster's own, which placement selectors match
+	Labels     map[string]string
 	Capacity   corev1.ResourceList
+	// Allocatable is what remains free for new workloads: the ready
+	// nodes' allocatable less the requests of unfinished pods, as last
+	// observed by updateAllClusterStates
 	Allocatable corev1.ResourceList
+	// Latency is the cluster's round trip to peer clusters and data
+	// source endpoints, and LocationLatency that of user locations to it,
+	// as reported by probe agents
+	Latency         map[string]LatencySample
+	LocationLatency map[string]LatencySample
 	Conditions []corev1.ClusterCondition
 }
 
@@ -47,6 +65,11 @@ type FederationController struct {
 	clusterLock      sync.RWMutex
 	workqueue        workqueue.RateLimitingInterface
 	clusterSelectors map[string]metav1.LabelSelector
+	mapper           meta.RESTMapper
+	schedulers       map[string]Scheduler
+	schedulerLock    sync.RWMutex
+	members          map[string]*memberCluster
+	memberLock       sync.RWMutex
 }
 
 func NewController(config *rest.Config) (*FederationController, error) {
@@ -66,6 +89,12 @@ func NewController(config *rest.Config) (*FederationController, error) {
 		clusterStates:    make(map[string]ClusterState),
 		workqueue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "FederationResources"),
 		clusterSelectors: make(map[string]metav1.LabelSelector),
+		mapper:           restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kc.Discovery())),
+		schedulers:       make(map[string]Scheduler),
+		members:          make(map[string]*memberCluster),
+	}
+	for _, s := range []Scheduler{spreadScheduler{}, binPackScheduler{}, labelAffinityScheduler{}, latencyScheduler{}} {
+		fc.RegisterScheduler(s)
 	}
 
 	fc.informerFactory = dynamic.NewSharedInformerFactoryWithOptions(
@@ -88,6 +117,7 @@ func (c *FederationController) Run(stopCh <-chan struct{}) {
 
 	go c.syncClusterStates(stopCh)
 	go c.reconcileLoop(5*time.Second, stopCh)
+	go c.serveHTTP(stopCh)
 
 	<-stopCh
 }
@@ -96,6 +126,7 @@ func (c *FederationController) syncClusterStates(stopCh <-chan struct{}) {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
+	c.updateAllClusterStates()
 	for {
 		select {
 		case <-ticker.C:
@@ -106,12 +137,47 @@ func (c *FederationController) syncClusterStates(stopCh <-chan struct{}) {
 	}
 }
 
+// updateAllClusterStates observes every member cluster's health, labels
+// and free capacity. Member clusters are read before clusterLock is taken
+// so placements are not held up by a slow cluster.
 func (c *FederationController) updateAllClusterStates() {
+	ctx, cancel := context.WithTimeout(context.Background(), resyncPeriod)
+	defer cancel()
+
+	members, err := c.refreshMembers(ctx)
+	if err != nil {
+		klog.Errorf("Cluster state sync failed: %v", err)
+		return
+	}
+	observed := make(map[string]ClusterState, len(members))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, m := range members {
+		wg.Add(1)
+		go func(name string, m *memberCluster) {
+			defer wg.Done()
+			state := m.observe(ctx)
+			mu.Lock()
+			observed[name] = state
+			mu.Unlock()
+		}(name, m)
+	}
+	wg.Wait()
+
 	c.clusterLock.Lock()
 	defer c.clusterLock.Unlock()
+	for name, state := range observed {
+		// latency is pushed by probe agents, not observed here
+		prev := c.clusterStates[name]
+		state.Latency, state.LocationLatency = prev.Latency, prev.LocationLatency
+		state.Conditions = prev.Conditions
+		observed[name] = state
+	}
+	c.clusterStates = observed
 
-	// Implementation for multi-cloud cluster state aggregation
-	// Includes health checks, capacity monitoring and network latency metrics
+	// stale probes are dropped so placements follow current network
+	// conditions
+	c.expireProbes(time.Now())
 }
 
 func (c *FederationController) reconcileLoop(interval time.Duration, stopCh <-chan struct{}) {
@@ -137,9 +203,18 @@ func (c *FederationController) reconcileFederatedResources() error {
 }
 
 func (c *FederationController) handleCreate(resource runtime.Object) error {
-	// Implementation for federated resource creation
-	// Includes multi-cloud placement strategy execution
-	return nil
+	obj, ok := resource.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected federated resource type %T", resource)
+	}
+	placement, err := c.selectClusters(obj)
+	if err != nil {
+		return err
+	}
+	if err := c.recordPlacement(context.TODO(), obj, placement); err != nil {
+		return fmt.Errorf("failed to record placement of %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return c.distributeResource(resource, placement.Decisions)
 }
 
 func (c *FederationController) handleUpdate(oldObj, newObj runtime.Object) error {
@@ -154,21 +229,102 @@ func (c *FederationController) handleDelete(obj runtime.Object) error {
 	return nil
 }
 
-func (c *FederationController) selectClusters(resource metav1.Object) ([]string, error) {
-	// Advanced cluster selection using:
-	// - Resource requirements matching
-	// - Geographic constraints
-	// - Cost optimization algorithms
-	// - Compliance requirements
-	return []string{}, nil
+// selectClusters places resource with the scheduler its annotation
+// names. Clusters that are not ready, do not match its cluster selector
+// or lack room for a single replica are rejected before the scheduler
+// sees them.
+func (c *FederationController) selectClusters(resource metav1.Object) (Placement, error) {
+	name := resource.GetAnnotations()[schedulerAnnotation]
+	if name == "" {
+		name = defaultScheduler
+	}
+	c.schedulerLock.RLock()
+	scheduler, ok := c.schedulers[name]
+	c.schedulerLock.RUnlock()
+	if !ok {
+		return Placement{}, fmt.Errorf("unknown placement scheduler %q", name)
+	}
+
+	replicas := int32(1)
+	if u, ok := resource.(*unstructured.Unstructured); ok {
+		if n, found, _ := unstructured.NestedInt64(u.Object, "spec", "replicas"); found {
+			replicas = int32(n)
+		}
+	}
+	req, err := placementRequest(resource, replicas)
+	if err != nil {
+		return Placement{}, err
+	}
+
+	placement := Placement{Scheduler: name, Rejected: make(map[string]string), Time: metav1.Now()}
+	var candidates []*Candidate
+	c.clusterLock.RLock()
+	names := make([]string, 0, len(c.clusterStates))
+	for n := range c.clusterStates {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		state := c.clusterStates[n]
+		cand := &Candidate{State: state, Free: state.Allocatable.DeepCopy()}
+		switch {
+		case !state.Ready:
+			placement.Rejected[n] = "not ready"
+		case !req.Selector.Matches(labels.Set(state.Labels)):
+			placement.Rejected[n] = "labels do not match " + req.Selector.String()
+		case !cand.Fits(req.Requests):
+			placement.Rejected[n] = "insufficient " + cand.insufficient(req.Requests)
+		default:
+			candidates = append(candidates, cand)
+		}
+	}
+	c.clusterLock.RUnlock()
+
+	placement.Decisions = scheduler.Schedule(req, candidates)
+	chosen := make(map[string]bool, len(placement.Decisions))
+	placement.Unplaced = req.Replicas
+	for _, d := range placement.Decisions {
+		chosen[d.Cluster] = true
+		placement.Unplaced -= d.Replicas
+	}
+	for _, cand := range candidates {
+		if !chosen[cand.State.Name] {
+			placement.Rejected[cand.State.Name] = "not chosen by " + name
+		}
+	}
+	if placement.Unplaced < 0 {
+		placement.Unplaced = 0
+	}
+	klog.V(2).Infof("Placed %s/%s with %s on %s, %d replicas unplaced",
+		resource.GetNamespace(), resource.GetName(), name, strings.Join(placement.Clusters(), ","), placement.Unplaced)
+	return placement, nil
 }
 
-func (c *FederationController) distributeResource(resource runtime.Object, clusters []string) error {
-	// Atomic multi-cluster deployment with:
-	// - Transactional consistency
-	// - Rollback capabilities
-	// - Progressive rollout strategies
-	return nil
+// recordPlacement writes placement to the resource's status.placement,
+// for debugging why it runs where it does. Resources without a status
+// subresource get it written with the rest of the object.
+func (c *FederationController) recordPlacement(ctx context.Context, obj *unstructured.Unstructured, placement Placement) error {
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+	raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&placement)
+	if err != nil {
+		return err
+	}
+	obj = obj.DeepCopy()
+	if err := unstructured.SetNestedField(obj.Object, raw, "status", "placement"); err != nil {
+		return err
+	}
+
+	client := c.dynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	opts := metav1.UpdateOptions{FieldManager: controllerName}
+	_, err = client.UpdateStatus(ctx, obj, opts)
+	if apierrors.IsNotFound(err) {
+		_, err = client.Update(ctx, obj, opts)
+	}
+	return err
 }
 
 // Enterprise Features
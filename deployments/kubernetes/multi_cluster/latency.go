@@ -0,0 +1,350 @@
+// latency.go - Latency Probes and Locality-Aware Placement
+package federation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// dataSourcesAnnotation lists the clusters and endpoints a resource
+	// reads from, optionally weighted, as aws-eu-west-1=3,s3-eu-west-1
+	dataSourcesAnnotation = "cirium.ai/placement-data-sources"
+	// userLocationsAnnotation lists where a resource's users are,
+	// weighted by their share of traffic, as eu-west=3,us-east=1
+	userLocationsAnnotation = "cirium.ai/placement-user-locations"
+	// maxLatencyAnnotation rejects clusters whose latency to the data
+	// sources or a user location exceeds it, as 80ms
+	maxLatencyAnnotation = "cirium.ai/placement-max-latency"
+
+	// probeTTL is how long a measurement stays usable without a newer one
+	probeTTL = 10 * time.Minute
+	// probeSmoothing is the weight of a new measurement against the
+	// running average, so one slow probe does not move placements
+	probeSmoothing = 0.3
+	// unmeasuredLatency stands in for a pair never probed, ranking
+	// measured clusters first
+	unmeasuredLatency = 500 * time.Millisecond
+)
+
+// LatencySample is the smoothed round trip to one peer, endpoint or
+// user location
+type LatencySample struct {
+	RTT        time.Duration
+	MeasuredAt time.Time
+}
+
+// LatencyProbe is one measurement reported by a probe agent. Agents in
+// every member cluster measure the cluster's round trips to its peers
+// and to data source endpoints; agents at user locations measure theirs
+// to each cluster.
+type LatencyProbe struct {
+	// Cluster is the cluster measured from, or to for a user location
+	Cluster string `json:"cluster"`
+	// Target is the peer cluster or data source endpoint reached
+	Target string `json:"target,omitempty"`
+	// Location is the user location that reached the cluster
+	Location  string  `json:"location,omitempty"`
+	RTTMillis float64 `json:"rtt_ms"`
+}
+
+// RecordProbe folds a measurement into the cluster's state
+func (c *FederationController) RecordProbe(p LatencyProbe, now time.Time) error {
+	return c.RecordProbes([]LatencyProbe{p}, now)
+}
+
+// RecordProbes folds a batch of measurements into the clusters' states.
+// Every probe is checked before any is applied, so a rejected batch
+// leaves no partial update behind. The latency maps are replaced rather
+// than written, so placements under way keep a consistent view.
+func (c *FederationController) RecordProbes(probes []LatencyProbe, now time.Time) error {
+	for i, p := range probes {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("probe %d: %v", i, err)
+		}
+	}
+
+	c.clusterLock.Lock()
+	defer c.clusterLock.Unlock()
+	for i, p := range probes {
+		if _, ok := c.clusterStates[p.Cluster]; !ok {
+			return fmt.Errorf("probe %d: unknown cluster %q", i, p.Cluster)
+		}
+	}
+	for _, p := range probes {
+		rtt := time.Duration(p.RTTMillis * float64(time.Millisecond))
+		state := c.clusterStates[p.Cluster]
+		if p.Target != "" {
+			state.Latency = withSample(state.Latency, p.Target, rtt, now)
+		} else {
+			state.LocationLatency = withSample(state.LocationLatency, p.Location, rtt, now)
+		}
+		c.clusterStates[p.Cluster] = state
+	}
+	return nil
+}
+
+func (p LatencyProbe) validate() error {
+	if (p.Target == "") == (p.Location == "") {
+		return fmt.Errorf("probe needs exactly one of a target and a location")
+	}
+	if p.RTTMillis < 0 || math.IsNaN(p.RTTMillis) || math.IsInf(p.RTTMillis, 0) {
+		return fmt.Errorf("invalid round trip %v", p.RTTMillis)
+	}
+	return nil
+}
+
+// withSample copies samples with rtt folded into key's average
+func withSample(samples map[string]LatencySample, key string, rtt time.Duration, now time.Time) map[string]LatencySample {
+	out := make(map[string]LatencySample, len(samples)+1)
+	for k, v := range samples {
+		out[k] = v
+	}
+	if prev, ok := out[key]; ok && now.Sub(prev.MeasuredAt) < probeTTL {
+		rtt = time.Duration(float64(prev.RTT)*(1-probeSmoothing) + float64(rtt)*probeSmoothing)
+	}
+	out[key] = LatencySample{RTT: rtt, MeasuredAt: now}
+	return out
+}
+
+// expireProbes drops measurements older than probeTTL; the caller holds
+// clusterLock
+func (c *FederationController) expireProbes(now time.Time) {
+	for name, state := range c.clusterStates {
+		state.Latency = withoutExpired(state.Latency, now)
+		state.LocationLatency = withoutExpired(state.LocationLatency, now)
+		c.clusterStates[name] = state
+	}
+}
+
+func withoutExpired(samples map[string]LatencySample, now time.Time) map[string]LatencySample {
+	out := make(map[string]LatencySample, len(samples))
+	for k, v := range samples {
+		if now.Sub(v.MeasuredAt) < probeTTL {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// ProbeHandler takes a JSON array of LatencyProbes from probe agents.
+// It is served behind authorizeProbes on the controller's metrics
+// address; see serveHTTP.
+func (c *FederationController) ProbeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var probes []LatencyProbe
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&probes); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := c.RecordProbes(probes, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// latencyTo is the cluster's round trip to a peer cluster or endpoint
+func latencyTo(state ClusterState, target string) (time.Duration, bool) {
+	if target == state.Name {
+		return 0, true
+	}
+	s, ok := state.Latency[target]
+	return s.RTT, ok
+}
+
+// latencyFrom is a user location's round trip to the cluster
+func latencyFrom(state ClusterState, location string) (time.Duration, bool) {
+	s, ok := state.LocationLatency[location]
+	return s.RTT, ok
+}
+
+// weightedLatency averages latency over weights and finds the worst;
+// pairs never measured count as unmeasuredLatency
+func weightedLatency(weights map[string]float64, latency func(string) (time.Duration, bool)) (avg, worst time.Duration) {
+	var sum, total float64
+	for key, w := range weights {
+		rtt, ok := latency(key)
+		if !ok {
+			rtt = unmeasuredLatency
+		}
+		if rtt > worst {
+			worst = rtt
+		}
+		sum += w * float64(rtt)
+		total += w
+	}
+	if total == 0 {
+		return 0, worst
+	}
+	return time.Duration(sum / total), worst
+}
+
+// latencyScheduler keeps replicas near their data sources and users.
+// Replicas are split over the user locations by weight, and each share
+// goes to the clusters with the lowest latency to that location plus to
+// the data sources, spilling over to the next once one is full. Without
+// user locations every replica goes by data source latency alone.
+type latencyScheduler struct{}
+
+func (latencyScheduler) Name() string { return "latency" }
+
+func (latencyScheduler) Schedule(req PlacementRequest, candidates []*Candidate) []PlacementDecision {
+	dataLatency := make(map[string]time.Duration, len(candidates))
+	var eligible []*Candidate
+	for _, c := range candidates {
+		avg, worst := weightedLatency(req.DataSources, func(t string) (time.Duration, bool) { return latencyTo(c.State, t) })
+		if req.MaxLatency > 0 && worst > req.MaxLatency {
+			continue
+		}
+		dataLatency[c.State.Name] = avg
+		eligible = append(eligible, c)
+	}
+
+	locations := req.UserLocations
+	if len(locations) == 0 {
+		// one share, placed by data source latency alone
+		locations = map[string]float64{"": 1}
+	}
+	names := make([]string, 0, len(locations))
+	for loc := range locations {
+		names = append(names, loc)
+	}
+	sort.Strings(names)
+
+	reasons := make(map[string][]string)
+	for i, share := range shares(req.Replicas, names, locations) {
+		loc := names[i]
+		userLatency := make(map[string]time.Duration, len(eligible))
+		var ranked []*Candidate
+		for _, c := range eligible {
+			if loc != "" {
+				rtt, ok := latencyFrom(c.State, loc)
+				if !ok {
+					rtt = unmeasuredLatency
+				}
+				if req.MaxLatency > 0 && rtt > req.MaxLatency {
+					continue
+				}
+				userLatency[c.State.Name] = rtt
+			}
+			ranked = append(ranked, c)
+		}
+		sort.SliceStable(ranked, func(i, j int) bool {
+			a, b := ranked[i].State.Name, ranked[j].State.Name
+			return dataLatency[a]+userLatency[a] < dataLatency[b]+userLatency[b]
+		})
+
+		for _, c := range ranked {
+			placed := int32(0)
+			for share > 0 && c.Fits(req.Requests) {
+				c.Take(req.Requests)
+				share--
+				placed++
+			}
+			if placed == 0 {
+				continue
+			}
+			reason := fmt.Sprintf("%d for data sources %v away", placed, dataLatency[c.State.Name].Round(time.Millisecond))
+			if loc != "" {
+				reason = fmt.Sprintf("%d for %s users %v away, data sources %v away", placed, loc,
+					userLatency[c.State.Name].Round(time.Millisecond), dataLatency[c.State.Name].Round(time.Millisecond))
+			}
+			reasons[c.State.Name] = append(reasons[c.State.Name], reason)
+			if share == 0 {
+				break
+			}
+		}
+	}
+	return decisions(candidates, func(c *Candidate) string {
+		return strings.Join(reasons[c.State.Name], "; ")
+	})
+}
+
+// shares splits replicas over names by weight, handing the remainder to
+// the largest fractions
+func shares(replicas int32, names []string, weights map[string]float64) []int32 {
+	var total float64
+	for _, name := range names {
+		total += weights[name]
+	}
+	out := make([]int32, len(names))
+	if total == 0 {
+		return out
+	}
+	type frac struct {
+		i int
+		f float64
+	}
+	fracs := make([]frac, len(names))
+	left := replicas
+	for i, name := range names {
+		exact := float64(replicas) * weights[name] / total
+		out[i] = int32(exact)
+		left -= out[i]
+		fracs[i] = frac{i, exact - float64(out[i])}
+	}
+	sort.SliceStable(fracs, func(a, b int) bool { return fracs[a].f > fracs[b].f })
+	for k := 0; left > 0; k = (k + 1) % len(fracs) {
+		out[fracs[k].i]++
+		left--
+	}
+	return out
+}
+
+// parseWeights reads a list of names, each optionally weighted, as
+// a=3,b; unweighted names weigh 1
+func parseWeights(annotation, v string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for _, item := range strings.Split(v, ",") {
+		name, weight, weighted := strings.Cut(strings.TrimSpace(item), "=")
+		if name == "" {
+			return nil, fmt.Errorf("invalid %s %q", annotation, v)
+		}
+		w := 1.0
+		if weighted {
+			var err error
+			if w, err = strconv.ParseFloat(weight, 64); err != nil || w < 0 {
+				return nil, fmt.Errorf("invalid %s %q", annotation, v)
+			}
+		}
+		weights[name] = w
+	}
+	return weights, nil
+}
+
+// parseLatencyAnnotations reads the data sources, user locations and
+// latency bound of the latency scheduler into req
+func parseLatencyAnnotations(resource metav1.Object, req *PlacementRequest) error {
+	ann := resource.GetAnnotations()
+	var err error
+	if v := ann[dataSourcesAnnotation]; v != "" {
+		if req.DataSources, err = parseWeights(dataSourcesAnnotation, v); err != nil {
+			return err
+		}
+	}
+	if v := ann[userLocationsAnnotation]; v != "" {
+		if req.UserLocations, err = parseWeights(userLocationsAnnotation, v); err != nil {
+			return err
+		}
+	}
+	if v := ann[maxLatencyAnnotation]; v != "" {
+		if req.MaxLatency, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", maxLatencyAnnotation, v, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+// placement.go - Pluggable Placement Schedulers for Federated Resources
+package federation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// schedulerAnnotation picks the scheduler that places a federated
+	// resource; spread when unset
+	schedulerAnnotation = "cirium.ai/placement-scheduler"
+	// replicasAnnotation is how many replicas to place; spec.replicas, or
+	// 1, when unset
+	replicasAnnotation = "cirium.ai/placement-replicas"
+	// requestsAnnotation is what one replica needs of a cluster, as
+	// cpu=2,memory=4Gi
+	requestsAnnotation = "cirium.ai/placement-requests"
+	// clusterSelectorAnnotation is a label selector clusters must match
+	clusterSelectorAnnotation = "cirium.ai/placement-cluster-selector"
+	// preferredLabelsAnnotation ranks clusters for label-affinity, as
+	// region=us-west1,tier=frontend
+	preferredLabelsAnnotation = "cirium.ai/placement-preferred-labels"
+
+	defaultScheduler = "spread"
+)
+
+// PlacementRequest is what a scheduler places: the replicas of one
+// federated resource
+type PlacementRequest struct {
+	Resource metav1.Object
+	Replicas int32
+	// Requests is what one replica needs of a cluster
+	Requests corev1.ResourceList
+	// Selector filters the clusters every scheduler considers
+	Selector labels.Selector
+	// Preferred are the labels label-affinity ranks clusters by
+	Preferred labels.Set
+	// DataSources and UserLocations are what the latency scheduler keeps
+	// replicas near, by weight
+	DataSources   map[string]float64
+	UserLocations map[string]float64
+	// MaxLatency bounds the latency to any data source or user location
+	MaxLatency time.Duration
+}
+
+// PlacementDecision is one cluster a resource is placed on
+type PlacementDecision struct {
+	Cluster  string `json:"cluster"`
+	Replicas int32  `json:"replicas"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Placement is a scheduler's outcome, recorded in the resource's
+// status.placement
+type Placement struct {
+	Scheduler string              `json:"scheduler"`
+	Decisions []PlacementDecision `json:"decisions"`
+	// Rejected says why each cluster not placed on was passed over
+	Rejected map[string]string `json:"rejected,omitempty"`
+	// Unplaced is how many replicas found no cluster with room
+	Unplaced int32       `json:"unplaced,omitempty"`
+	Time     metav1.Time `json:"time"`
+}
+
+// Clusters are the clusters placed on
+func (p Placement) Clusters() []string {
+	names := make([]string, 0, len(p.Decisions))
+	for _, d := range p.Decisions {
+		names = append(names, d.Cluster)
+	}
+	return names
+}
+
+// Scheduler decides which clusters a federated resource runs on.
+// Schedulers are registered with RegisterScheduler and picked per
+// resource by its cirium.ai/placement-scheduler annotation.
+type Scheduler interface {
+	Name() string
+	// Schedule places req on candidates, the ready clusters matching its
+	// selector sorted by name, each with the room it has left
+	Schedule(req PlacementRequest, candidates []*Candidate) []PlacementDecision
+}
+
+// RegisterScheduler makes s available to federated resources, replacing
+// any scheduler of the same name
+func (c *FederationController) RegisterScheduler(s Scheduler) {
+	c.schedulerLock.Lock()
+	defer c.schedulerLock.Unlock()
+	c.schedulers[s.Name()] = s
+}
+
+// Candidate is a cluster under consideration, with the room left on it
+// by the replicas placed so far
+type Candidate struct {
+	State    ClusterState
+	Free     corev1.ResourceList
+	Replicas int32
+}
+
+// Fits reports whether one more replica needing requests fits
+func (c *Candidate) Fits(requests corev1.ResourceList) bool {
+	for name, q := range requests {
+		free, ok := c.Free[name]
+		if !ok || free.Cmp(q) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Take places one replica needing requests
+func (c *Candidate) Take(requests corev1.ResourceList) {
+	for name, q := range requests {
+		free := c.Free[name]
+		free.Sub(q)
+		c.Free[name] = free
+	}
+	c.Replicas++
+}
+
+// Utilization is the share of the cluster's capacity in use, averaged
+// over the resources requested, or CPU and memory
+func (c *Candidate) Utilization(requests corev1.ResourceList) float64 {
+	names := []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+	if len(requests) > 0 {
+		names = names[:0]
+		for name := range requests {
+			names = append(names, name)
+		}
+	}
+	var sum float64
+	var n int
+	for _, name := range names {
+		capacity, ok := c.State.Capacity[name]
+		if !ok || capacity.IsZero() {
+			continue
+		}
+		free := c.Free[name]
+		sum += 1 - free.AsApproximateFloat64()/capacity.AsApproximateFloat64()
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// insufficient names the first resource a replica needs more of than
+// the cluster has free
+func (c *Candidate) insufficient(requests corev1.ResourceList) string {
+	names := make([]string, 0, len(requests))
+	for name := range requests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		free, ok := c.Free[corev1.ResourceName(name)]
+		if !ok || free.Cmp(requests[corev1.ResourceName(name)]) < 0 {
+			return name
+		}
+	}
+	return ""
+}
+
+// spreadScheduler distributes replicas evenly over every cluster with
+// room, one at a time
+type spreadScheduler struct{}
+
+func (spreadScheduler) Name() string { return "spread" }
+
+func (spreadScheduler) Schedule(req PlacementRequest, candidates []*Candidate) []PlacementDecision {
+	roundRobin(req, candidates, req.Replicas)
+	var used int
+	for _, c := range candidates {
+		if c.Replicas > 0 {
+			used++
+		}
+	}
+	return decisions(candidates, func(c *Candidate) string {
+		return fmt.Sprintf("spread over %d clusters", used)
+	})
+}
+
+// binPackScheduler fills the most utilized cluster with room before the
+// next, keeping replicas on as few clusters as possible
+type binPackScheduler struct{}
+
+func (binPackScheduler) Name() string { return "bin-pack" }
+
+func (binPackScheduler) Schedule(req PlacementRequest, candidates []*Candidate) []PlacementDecision {
+	utilization := make(map[string]float64, len(candidates))
+	for _, c := range candidates {
+		utilization[c.State.Name] = c.Utilization(req.Requests)
+	}
+	order := append([]*Candidate(nil), candidates...)
+	sort.SliceStable(order, func(i, j int) bool {
+		return utilization[order[i].State.Name] > utilization[order[j].State.Name]
+	})
+
+	remaining := req.Replicas
+	for _, c := range order {
+		for remaining > 0 && c.Fits(req.Requests) {
+			c.Take(req.Requests)
+			remaining--
+		}
+	}
+	return decisions(order, func(c *Candidate) string {
+		return fmt.Sprintf("packed onto a cluster %.0f%% utilized", utilization[c.State.Name]*100)
+	})
+}
+
+// labelAffinityScheduler prefers the clusters matching most of the
+// resource's preferred labels, spreading over equally good clusters and
+// only moving to worse ones once those are full
+type labelAffinityScheduler struct{}
+
+func (labelAffinityScheduler) Name() string { return "label-affinity" }
+
+func (labelAffinityScheduler) Schedule(req PlacementRequest, candidates []*Candidate) []PlacementDecision {
+	score := make(map[string]int, len(candidates))
+	for _, c := range candidates {
+		for k, v := range req.Preferred {
+			if c.State.Labels[k] == v {
+				score[c.State.Name]++
+			}
+		}
+	}
+	order := append([]*Candidate(nil), candidates...)
+	sort.SliceStable(order, func(i, j int) bool {
+		return score[order[i].State.Name] > score[order[j].State.Name]
+	})
+
+	remaining := req.Replicas
+	for start := 0; start < len(order) && remaining > 0; {
+		end := start
+		for end < len(order) && score[order[end].State.Name] == score[order[start].State.Name] {
+			end++
+		}
+		remaining = roundRobin(req, order[start:end], remaining)
+		start = end
+	}
+	return decisions(order, func(c *Candidate) string {
+		return fmt.Sprintf("matches %d of %d preferred labels", score[c.State.Name], len(req.Preferred))
+	})
+}
+
+// roundRobin places up to replicas replicas on candidates one at a time
+// in turn and returns how many found no room
+func roundRobin(req PlacementRequest, candidates []*Candidate, replicas int32) int32 {
+	for replicas > 0 {
+		placed := false
+		for _, c := range candidates {
+			if replicas > 0 && c.Fits(req.Requests) {
+				c.Take(req.Requests)
+				replicas--
+				placed = true
+			}
+		}
+		if !placed {
+			break
+		}
+	}
+	return replicas
+}
+
+// decisions lists the candidates given replicas, in order
+func decisions(candidates []*Candidate, reason func(*Candidate) string) []PlacementDecision {
+	var out []PlacementDecision
+	for _, c := range candidates {
+		if c.Replicas > 0 {
+			out = append(out, PlacementDecision{Cluster: c.State.Name, Replicas: c.Replicas, Reason: reason(c)})
+		}
+	}
+	return out
+}
+
+// placementRequest reads the placement annotations of resource
+func placementRequest(resource metav1.Object, replicas int32) (PlacementRequest, error) {
+	ann := resource.GetAnnotations()
+	req := PlacementRequest{Resource: resource, Replicas: replicas, Selector: labels.Everything()}
+	if v, ok := ann[replicasAnnotation]; ok {
+		var n int32
+		if _, err := fmt.Sscan(v, &n); err != nil || n < 0 {
+			return req, fmt.Errorf("invalid %s %q", replicasAnnotation, v)
+		}
+		req.Replicas = n
+	}
+	if v := ann[requestsAnnotation]; v != "" {
+		req.Requests = corev1.ResourceList{}
+		for _, pair := range strings.Split(v, ",") {
+			name, qty, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			q, err := resource.ParseQuantity(qty)
+			if !ok || err != nil {
+				return req, fmt.Errorf("invalid %s %q", requestsAnnotation, v)
+			}
+			req.Requests[corev1.ResourceName(name)] = q
+		}
+	}
+	if v := ann[clusterSelectorAnnotation]; v != "" {
+		sel, err := labels.Parse(v)
+		if err != nil {
+			return req, fmt.Errorf("invalid %s %q: %w", clusterSelectorAnnotation, v, err)
+		}
+		req.Selector = sel
+	}
+	if v := ann[preferredLabelsAnnotation]; v != "" {
+		preferred, err := labels.ConvertSelectorToLabelsMap(v)
+		if err != nil {
+			return req, fmt.Errorf("invalid %s %q: %w", preferredLabelsAnnotation, v, err)
+		}
+		req.Preferred = preferred
+	}
+	return req, parseLatencyAnnotations(resource, &req)
+}
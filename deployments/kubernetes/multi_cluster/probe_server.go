@@ -0,0 +1,98 @@
+// probe_server.go - Authenticated Endpoint for Latency Probe Agents
+package federation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// probePath is where probe agents post measurements. Agents authenticate
+// with a service account token and need RBAC allowing create on this
+// non-resource URL.
+const probePath = "/probes"
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// serveHTTP serves the probe endpoint on metricsAddress until stopCh closes
+func (c *FederationController) serveHTTP(stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle(probePath, c.authorizeProbes(c.ProbeHandler()))
+	srv := &http.Server{
+		Addr:              metricsAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.Errorf("Probe endpoint failed: %v", err)
+	}
+}
+
+// authorizeProbes admits requests whose bearer token the API server
+// authenticates and whose user may create probePath
+func (c *FederationController) authorizeProbes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		ctx := r.Context()
+
+		review, err := c.kubeClient.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+			Spec: authenticationv1.TokenReviewSpec{Token: token},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			klog.Errorf("Probe token review failed: %v", err)
+			http.Error(w, "authentication unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if !review.Status.Authenticated {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user := review.Status.User
+		extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+		for k, v := range user.Extra {
+			extra[k] = authorizationv1.ExtraValue(v)
+		}
+		access, err := c.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:   user.Username,
+				UID:    user.UID,
+				Groups: user.Groups,
+				Extra:  extra,
+				NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+					Path: probePath,
+					Verb: "create",
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			klog.Errorf("Probe access review failed: %v", err)
+			http.Error(w, "authorization unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if !access.Status.Allowed {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
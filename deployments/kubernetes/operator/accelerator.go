@@ -0,0 +1,181 @@
+// accelerator.go - GPU Scheduling and Allocation Reporting
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+const (
+	gpuResource corev1.ResourceName = "nvidia.com/gpu"
+	// gpuProductLabel is set on GPU nodes by GPU feature discovery
+	gpuProductLabel   = "nvidia.com/gpu.product"
+	migResourcePrefix = "nvidia.com/mig-"
+)
+
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+
+// gpuNodePool is the node group GPU agents are scheduled onto
+type gpuNodePool struct {
+	Selector map[string]string
+	// Taint keeps other workloads off the group
+	Taint *corev1.Taint
+}
+
+// parseGPUNodePool reads the --gpu-node-selector and --gpu-node-taint
+// flags, the latter given as key=value:Effect
+func parseGPUNodePool(selector, taint string) (gpuNodePool, error) {
+	var pool gpuNodePool
+	sel, err := labels.ConvertSelectorToLabelsMap(selector)
+	if err != nil {
+		return pool, fmt.Errorf("invalid GPU node selector %q: %w", selector, err)
+	}
+	pool.Selector = sel
+	if taint == "" {
+		return pool, nil
+	}
+	kv, effect, ok := strings.Cut(taint, ":")
+	if !ok {
+		return pool, fmt.Errorf("invalid GPU node taint %q: missing effect", taint)
+	}
+	key, value, _ := strings.Cut(kv, "=")
+	pool.Taint = &corev1.Taint{Key: key, Value: value, Effect: corev1.TaintEffect(effect)}
+	return pool, nil
+}
+
+// acceleratorResource is the extended resource an accelerator spec
+// requests: whole GPUs, or MIG slices of one profile
+func acceleratorResource(acc *aiv1alpha1.AcceleratorSpec) corev1.ResourceName {
+	if acc.MIGProfile != "" {
+		return corev1.ResourceName(migResourcePrefix + acc.MIGProfile)
+	}
+	return gpuResource
+}
+
+func acceleratorCount(acc *aiv1alpha1.AcceleratorSpec) int32 {
+	if acc.Count == 0 {
+		return 1
+	}
+	return acc.Count
+}
+
+// applyAccelerator requests the agent's GPUs for its container and pins
+// its pods to the GPU node group, of the requested GPU type if any
+func (r *AgentReconciler) applyAccelerator(agent *aiv1alpha1.AIAgent, tmpl *corev1.PodTemplateSpec) {
+	acc := agent.Spec.Accelerator
+	if acc == nil {
+		return
+	}
+	container := &tmpl.Spec.Containers[0]
+	// the template shares these with the spec
+	container.Resources = *container.Resources.DeepCopy()
+	if container.Resources.Limits == nil {
+		container.Resources.Limits = corev1.ResourceList{}
+	}
+	// extended resources cannot be overcommitted; the limit is the request
+	container.Resources.Limits[acceleratorResource(acc)] = *resource.NewQuantity(int64(acceleratorCount(acc)), resource.DecimalSI)
+
+	selector := make(map[string]string, len(tmpl.Spec.NodeSelector)+len(r.GPUNodes.Selector)+1)
+	for k, v := range r.GPUNodes.Selector {
+		selector[k] = v
+	}
+	if acc.Type != "" {
+		selector[gpuProductLabel] = acc.Type
+	}
+	// the agent's own selector narrows the group further
+	for k, v := range tmpl.Spec.NodeSelector {
+		selector[k] = v
+	}
+	tmpl.Spec.NodeSelector = selector
+
+	tolerations := append([]corev1.Toleration(nil), tmpl.Spec.Tolerations...)
+	if t := r.GPUNodes.Taint; t != nil {
+		tolerations = append(tolerations, corev1.Toleration{
+			Key:      t.Key,
+			Operator: corev1.TolerationOpEqual,
+			Value:    t.Value,
+			Effect:   t.Effect,
+		})
+	}
+	// the taint GPU nodes of managed node pools commonly carry
+	tolerations = append(tolerations, corev1.Toleration{
+		Key:      string(gpuResource),
+		Operator: corev1.TolerationOpExists,
+		Effect:   corev1.TaintEffectNoSchedule,
+	})
+	tmpl.Spec.Tolerations = tolerations
+}
+
+// updateGPUStatus reports the GPUs the agent's pods hold and how many
+// pods wait for free ones
+func (r *AgentReconciler) updateGPUStatus(ctx context.Context, agent *aiv1alpha1.AIAgent) error {
+	acc := agent.Spec.Accelerator
+	if acc == nil {
+		if agent.Status.GPU == nil {
+			return nil
+		}
+		patch := client.MergeFrom(agent.DeepCopy())
+		agent.Status.GPU = nil
+		return r.Status().Patch(ctx, agent, patch)
+	}
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(agent.Namespace), client.MatchingLabels(agentLabels(agent))); err != nil {
+		return err
+	}
+	name := acceleratorResource(acc)
+	status := &aiv1alpha1.GPUStatus{Resource: string(name)}
+	nodes := map[string]bool{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if pod.Spec.NodeName == "" {
+			if podUnschedulable(&pod) {
+				status.PendingPods++
+			}
+			continue
+		}
+		for _, c := range pod.Spec.Containers {
+			if q, ok := c.Resources.Limits[name]; ok {
+				status.Allocated += int32(q.Value())
+				nodes[pod.Spec.NodeName] = true
+			}
+		}
+	}
+	for node := range nodes {
+		status.Nodes = append(status.Nodes, node)
+	}
+	sort.Strings(status.Nodes)
+
+	if equality.Semantic.DeepEqual(agent.Status.GPU, status) {
+		return nil
+	}
+	if status.PendingPods > 0 && (agent.Status.GPU == nil || agent.Status.GPU.PendingPods == 0) {
+		r.Recorder.Eventf(agent, corev1.EventTypeWarning, "InsufficientGPU",
+			"%d pods wait for a node with %d free %s", status.PendingPods, acceleratorCount(acc), name)
+	}
+	patch := client.MergeFrom(agent.DeepCopy())
+	agent.Status.GPU = status
+	return r.Status().Patch(ctx, agent, patch)
+}
+
+// podUnschedulable reports whether the scheduler found no node for pod
+func podUnschedulable(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled {
+			return c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable
+		}
+	}
+	return false
+}
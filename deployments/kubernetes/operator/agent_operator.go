@@ -3,21 +3,30 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+	aiv1beta1 "github.com/Wavine-ai/operator/api/v1beta1"
 )
 
 const (
@@ -26,13 +35,40 @@ const (
 	maxConcurrent    = 5
 	agentVersionKey  = "agent.Wavine.ai/version"
 	configHashKey    = "agent.Wavine.ai/config-hash"
+	// restartedAtKey is set on an AIAgent by the agent manager to restart
+	// an agent whose heartbeats stopped
+	restartedAtKey   = "agent.Wavine.ai/restarted-at"
 )
 
+// scheme holds every served version of the operator's resources, which
+// the conversion webhook converts between
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+	utilruntime.Must(aiv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(aiv1beta1.AddToScheme(scheme))
+}
+
 // AgentReconciler manages the lifecycle of AIAgent resources
 type AgentReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+	// PrometheusAddress is where KEDA ScaledObjects query agent backlogs
+	PrometheusAddress string
+	// VaultSecretStore is the ESO ClusterSecretStore Vault secrets are
+	// read through
+	VaultSecretStore string
+	// ControllerPeer and NATSPeer are the pods every agent's
+	// NetworkPolicy lets it reach
+	ControllerPeer networkPeer
+	NATSPeer       networkPeer
+	// Telemetry is the collector agents with spec.telemetry report to
+	Telemetry telemetryConfig
+	// GPUNodes is the node group agents with spec.accelerator run on
+	GPUNodes gpuNodePool
 }
 
 // +kubebuilder:rbac:groups=ai.nuzon.io,resources=aiagents,verbs=get;list;watch;create;update;patch;delete
@@ -41,19 +77,122 @@ type AgentReconciler struct {
 // +kubebuilder:rbac:groups=core,resources=services;configmaps;secrets,verbs=get;list;watch;create;update;patch;delete
 
 func main() {
+	var prometheusAddress, vaultSecretStore string
+	var watchNamespaces, watchSelector, leaderElectionID string
+	var controllerURL, controllerTokenFile string
+	var controllerNamespace, controllerSelector, natsNamespace, natsSelector string
+	var otelCollectorNamespace, otelCollectorSelector string
+	var telemetry telemetryConfig
+	var gpuNodeSelector, gpuNodeTaint string
+	var webhookCertDir string
+	var migrateStorage bool
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma-separated namespaces to manage; all when empty")
+	flag.StringVar(&watchSelector, "watch-selector", "",
+		"Label selector of the AIAgents and AgentPools to manage")
+	flag.StringVar(&leaderElectionID, "leader-election-id", "nuzon-agent-operator",
+		"Leader election lock name; distinct for every operator instance")
+	flag.StringVar(&prometheusAddress, "prometheus-address", "",
+		"Prometheus URL KEDA queries for agent task backlogs")
+	flag.StringVar(&vaultSecretStore, "vault-secret-store", "vault",
+		"External Secrets ClusterSecretStore that reads Vault")
+	flag.StringVar(&controllerURL, "controller-url", "",
+		"Agent controller API that memory backups and agent jobs go through")
+	flag.StringVar(&controllerTokenFile, "controller-token-file", "",
+		"File holding the bearer token for the agent controller API")
+	flag.StringVar(&controllerNamespace, "controller-namespace", "nuzon-system",
+		"Namespace of the agent controller pods agents may talk to")
+	flag.StringVar(&controllerSelector, "controller-selector", "app=nuzon-agent-controller",
+		"Label selector of the agent controller pods")
+	flag.StringVar(&natsNamespace, "nats-namespace", "nuzon-system",
+		"Namespace of the NATS pods agents may talk to")
+	flag.StringVar(&natsSelector, "nats-selector", "app.kubernetes.io/name=nats",
+		"Label selector of the NATS pods")
+	flag.StringVar(&telemetry.CollectorEndpoint, "otel-collector-endpoint", "",
+		"OTLP gRPC endpoint agents with spec.telemetry report to")
+	flag.StringVar(&otelCollectorNamespace, "otel-collector-namespace", "",
+		"Namespace of the collector pods agents may reach; none when empty")
+	flag.StringVar(&otelCollectorSelector, "otel-collector-selector", "app.kubernetes.io/name=opentelemetry-collector",
+		"Label selector of the collector pods")
+	flag.StringVar(&telemetry.SidecarImage, "otel-sidecar-image", "otel/opentelemetry-collector-contrib:0.98.0",
+		"Collector image injected into agents in sidecar telemetry mode")
+	flag.StringVar(&telemetry.MonitoringNamespace, "monitoring-namespace", "monitoring",
+		"Namespace Prometheus scrapes agent metrics from")
+	flag.StringVar(&gpuNodeSelector, "gpu-node-selector", "eks.amazonaws.com/nodegroup=gpu-accelerated",
+		"Node labels of the GPU node group")
+	flag.StringVar(&gpuNodeTaint, "gpu-node-taint", "nuzon.ai/node-type=gpu:NoSchedule",
+		"Taint of the GPU node group, as key=value:Effect; none when empty")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"Directory holding tls.crt and tls.key of the conversion webhook")
+	flag.BoolVar(&migrateStorage, "migrate-storage-versions", true,
+		"Rewrite stored resources in their CRDs' storage versions on start")
 	opts := zap.Options{
 		Development: false,
 	}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		setupLog.Error(err, "failed to set up tracing")
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	scope, err := parseWatchScope(watchNamespaces, watchSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid watch scope")
+		os.Exit(1)
+	}
+	setupLog.Info("watching", "scope", scope.String())
+
+	controllerPeer, err := parseNetworkPeer(controllerNamespace, controllerSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid controller selector")
+		os.Exit(1)
+	}
+	natsPeer, err := parseNetworkPeer(natsNamespace, natsSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid NATS selector")
+		os.Exit(1)
+	}
+
+	if otelCollectorNamespace != "" {
+		collectorPeer, err := parseNetworkPeer(otelCollectorNamespace, otelCollectorSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid collector selector")
+			os.Exit(1)
+		}
+		telemetry.CollectorPeer = &collectorPeer
+	}
+
+	gpuNodes, err := parseGPUNodePool(gpuNodeSelector, gpuNodeTaint)
+	if err != nil {
+		setupLog.Error(err, "invalid GPU node group")
+		os.Exit(1)
+	}
+
+	controllerClient := controllerAPI{URL: controllerURL}
+	if controllerTokenFile != "" {
+		token, err := os.ReadFile(controllerTokenFile)
+		if err != nil {
+			setupLog.Error(err, "failed to read controller token")
+			os.Exit(1)
+		}
+		controllerClient.Token = strings.TrimSpace(string(token))
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 runtime.NewScheme(),
+		Scheme:                 scheme,
 		MetricsBindAddress:     ":8080",
 		Port:                   9443,
+		CertDir:                webhookCertDir,
 		LeaderElection:         true,
-		LeaderElectionID:       "nuzon-agent-operator",
+		LeaderElectionID:       leaderElectionID,
 		SyncPeriod:             durationPtr(5 * time.Minute),
 		HealthProbeBindAddress: ":8081",
+		NewCache:               scope.newCache(),
 	})
 	if err != nil {
 		setupLog.Error(err, "failed to start manager")
@@ -64,11 +203,69 @@ func main() {
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
 		Recorder: mgr.GetEventRecorderFor("agent-controller"),
+
+		PrometheusAddress: prometheusAddress,
+		VaultSecretStore:  vaultSecretStore,
+		ControllerPeer:    controllerPeer,
+		NATSPeer:          natsPeer,
+		Telemetry:         telemetry,
+		GPUNodes:          gpuNodes,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "failed to create controller", "controller", "AIAgent")
 		os.Exit(1)
 	}
 
+	if err = (&AgentPoolReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("agentpool-controller"),
+		Scope:    scope,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "failed to create controller", "controller", "AgentPool")
+		os.Exit(1)
+	}
+
+	if err = (&MemoryBackupReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("memorybackup-controller"),
+
+		Controller: controllerClient,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "failed to create controller", "controller", "MemoryBackup")
+		os.Exit(1)
+	}
+
+	if err = (&AgentJobReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("agentjob-controller"),
+
+		Controller: controllerClient,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "failed to create controller", "controller", "AgentJob")
+		os.Exit(1)
+	}
+
+	// the API server converts AIAgents between versions through the
+	// manager's webhook server
+	if err = ctrl.NewWebhookManagedBy(mgr).For(&aiv1beta1.AIAgent{}).Complete(); err != nil {
+		setupLog.Error(err, "failed to create webhook", "webhook", "AIAgent")
+		os.Exit(1)
+	}
+
+	if migrateStorage {
+		if err := mgr.Add(&storageMigration{
+			Client:     mgr.GetClient(),
+			APIReader:  mgr.GetAPIReader(),
+			Namespaces: scope.namespaces,
+			PageSize:   500,
+		}); err != nil {
+			setupLog.Error(err, "failed to add storage migration")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -84,13 +281,19 @@ func (r *AgentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&aiv1alpha1.AIAgent{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&appsv1.ReplicaSet{}).
 		Owns(&corev1.Service{}).
 		Owns(&corev1.ConfigMap{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&networkingv1.NetworkPolicy{}).
 		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrent}).
 		Complete(r)
 }
 
-func (r *AgentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *AgentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := startReconcile(ctx, agentController, req)
+	defer func() { endReconcile(span, agentController, result, err) }()
 	log := ctrl.LoggerFrom(ctx)
 	
 	var agent aiv1alpha1.AIAgent
@@ -100,6 +303,7 @@ func (r *AgentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		}
 		return ctrl.Result{}, err
 	}
+	annotateSpan(span, &agent)
 
 	// Handle finalization
 	if !agent.DeletionTimestamp.IsZero() {
@@ -115,7 +319,7 @@ func (r *AgentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	}
 
 	// Reconciliation logic
-	result, err := r.reconcileAgent(ctx, &agent)
+	result, err = r.reconcileAgent(ctx, &agent)
 	if err != nil {
 		log.Error(err, "Reconciliation failed")
 		r.Recorder.Event(&agent, corev1.EventTypeWarning, "ReconcileError", err.Error())
@@ -125,79 +329,98 @@ func (r *AgentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 
 func (r *AgentReconciler) reconcileAgent(ctx context.Context, agent *aiv1alpha1.AIAgent) (ctrl.Result, error) {
 	// Configuration management
-	configHash, err := r.ensureConfigMap(ctx, agent)
+	phaseCtx, end := startPhase(ctx, agentController, "config")
+	configHash, err := r.ensureConfigMap(phaseCtx, agent)
+	end(err)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to manage config: %w", err)
 	}
 
-	// Deployment management
-	if err := r.ensureDeployment(ctx, agent, configHash); err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to manage deployment: %w", err)
+	// External secrets
+	phaseCtx, end = startPhase(ctx, agentController, "secrets")
+	secrets, err := r.ensureSecrets(phaseCtx, agent)
+	end(err)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to manage secrets: %w", err)
+	}
+
+	// Network isolation, in place before the first pod starts
+	phaseCtx, end = startPhase(ctx, agentController, "networkpolicy")
+	err = r.ensureNetworkPolicy(phaseCtx, agent)
+	end(err)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to manage network policy: %w", err)
+	}
+
+	// Telemetry collector config
+	phaseCtx, end = startPhase(ctx, agentController, "telemetry")
+	err = r.ensureTelemetry(phaseCtx, agent)
+	end(err)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to manage telemetry: %w", err)
+	}
+
+	// Workload management
+	phaseCtx, end = startPhase(ctx, agentController, "deployment")
+	err = r.ensureWorkload(phaseCtx, agent, configHash, secrets)
+	end(err)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to manage %s: %w", workloadKind(agent), err)
+	}
+
+	// GPU allocation
+	phaseCtx, end = startPhase(ctx, agentController, "accelerator")
+	err = r.updateGPUStatus(phaseCtx, agent)
+	end(err)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to report GPU allocation: %w", err)
+	}
+
+	// Backlog-driven scaling
+	phaseCtx, end = startPhase(ctx, agentController, "autoscaler")
+	err = r.ensureAutoscaler(phaseCtx, agent)
+	end(err)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to manage autoscaler: %w", err)
 	}
 
 	// Service exposure
-	if err := r.ensureService(ctx, agent); err != nil {
+	phaseCtx, end = startPhase(ctx, agentController, "service")
+	err = r.ensureService(phaseCtx, agent)
+	end(err)
+	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to manage service: %w", err)
 	}
 
 	// Update status
-	if err := r.updateAgentStatus(ctx, agent); err != nil {
+	phaseCtx, end = startPhase(ctx, agentController, "status")
+	err = r.updateAgentStatus(phaseCtx, agent)
+	end(err)
+	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to update status: %w", err)
 	}
 
 	return ctrl.Result{RequeueAfter: requeueDelay}, nil
 }
 
-func (r *AgentReconciler) ensureDeployment(ctx context.Context, agent *aiv1alpha1.AIAgent, configHash string) error {
+func (r *AgentReconciler) ensureDeployment(ctx context.Context, agent *aiv1alpha1.AIAgent, configHash string, secrets *agentSecrets) error {
+	template := podTemplate(agent, configHash)
+	secrets.apply(&template)
+	r.applyTelemetry(agent, &template)
+	r.applyAccelerator(agent, &template)
 	deploy := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      agent.Name,
-			Namespace: agent.Namespace,
-			Labels:    agentLabels(agent),
+			Name:        agent.Name,
+			Namespace:   agent.Namespace,
+			Labels:      agentLabels(agent),
+			Annotations: map[string]string{templateHashKey: templateHash(template)},
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: agent.Spec.Replicas,
+			Replicas: desiredReplicas(agent),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: agentLabels(agent),
 			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels:      withConfigHash(agentLabels(agent), configHash),
-					Annotations: podAnnotations(agent),
-				},
-				Spec: corev1.PodSpec{
-					SecurityContext: &corev1.PodSecurityContext{
-						RunAsNonRoot: ptrBool(true),
-						RunAsUser:    ptrInt64(1000),
-						FSGroup:      ptrInt64(2000),
-					},
-					Containers: []corev1.Container{{
-						Name:            "agent",
-						Image:           agent.Spec.Image,
-						ImagePullPolicy: corev1.PullIfNotPresent,
-						Resources:       agent.Spec.Resources,
-						EnvFrom: []corev1.EnvFromSource{{
-							ConfigMapRef: &corev1.ConfigMapEnvSource{
-								LocalObjectReference: corev1.LocalObjectReference{
-									Name: agent.Name + "-config",
-								},
-							},
-						}},
-						LivenessProbe:  healthProbe(),
-						ReadinessProbe: healthProbe(),
-						SecurityContext: &corev1.SecurityContext{
-							Capabilities: &corev1.Capabilities{
-								Drop: []corev1.Capability{"ALL"},
-							},
-							ReadOnlyRootFilesystem: ptrBool(true),
-						},
-					}},
-					Tolerations:        agent.Spec.Tolerations,
-					NodeSelector:      agent.Spec.NodeSelector,
-					Affinity:          agent.Spec.Affinity,
-					PriorityClassName: agent.Spec.PriorityClassName,
-				},
-			},
+			Template: template,
 		},
 	}
 
@@ -217,6 +440,15 @@ func (r *AgentReconciler) ensureDeployment(ctx context.Context, agent *aiv1alpha
 		return err
 	} else {
 		deploy.ResourceVersion = existingDeploy.ResourceVersion
+		if agent.Spec.Autoscaling != nil {
+			// the autoscaler owns the replica count once the deployment exists
+			deploy.Spec.Replicas = existingDeploy.Spec.Replicas
+		}
+		// canary and blue/green rollouts hold the stable template until
+		// the new one is promoted
+		if hold, err := r.guardRollout(ctx, agent, existingDeploy, deploy); err != nil || hold {
+			return err
+		}
 		if err := r.Update(ctx, deploy); err != nil {
 			return err
 		}
@@ -224,4 +456,69 @@ func (r *AgentReconciler) ensureDeployment(ctx context.Context, agent *aiv1alpha
 	return nil
 }
 
+// podTemplate is the pod of every workload kind an agent runs as
+func podTemplate(agent *aiv1alpha1.AIAgent, configHash string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      withConfigHash(agentLabels(agent), configHash),
+			Annotations: withRestartedAt(podAnnotations(agent), agent),
+		},
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot: ptrBool(true),
+				RunAsUser:    ptrInt64(1000),
+				FSGroup:      ptrInt64(2000),
+			},
+			Containers: []corev1.Container{{
+				Name:            "agent",
+				Image:           agent.Spec.Image,
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				Resources:       agent.Spec.Resources,
+				EnvFrom: []corev1.EnvFromSource{{
+					ConfigMapRef: &corev1.ConfigMapEnvSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: agent.Name + "-config",
+						},
+					},
+				}},
+				LivenessProbe:  healthProbe(),
+				ReadinessProbe: healthProbe(),
+				SecurityContext: &corev1.SecurityContext{
+					Capabilities: &corev1.Capabilities{
+						Drop: []corev1.Capability{"ALL"},
+					},
+					ReadOnlyRootFilesystem: ptrBool(true),
+				},
+			}},
+			Tolerations:        agent.Spec.Tolerations,
+			NodeSelector:      agent.Spec.NodeSelector,
+			Affinity:          agent.Spec.Affinity,
+			PriorityClassName: agent.Spec.PriorityClassName,
+		},
+	}
+}
+
+// withRestartedAt carries a restart request onto the pod template; a new
+// value rolls the deployment's pods
+func withRestartedAt(annotations map[string]string, agent *aiv1alpha1.AIAgent) map[string]string {
+	restartedAt, ok := agent.Annotations[restartedAtKey]
+	if !ok {
+		return annotations
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[restartedAtKey] = restartedAt
+	return annotations
+}
+
+// desiredReplicas is the replica count a new workload starts with
+func desiredReplicas(agent *aiv1alpha1.AIAgent) *int32 {
+	if as := agent.Spec.Autoscaling; as != nil {
+		n := minReplicas(as)
+		return &n
+	}
+	return agent.Spec.Replicas
+}
+
 // Helper functions and remaining implementation...
@@ -0,0 +1,397 @@
+// agentjob.go - Run-to-Completion Agent Tasks as Kubernetes Jobs
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+const (
+	jobController = "agentjob"
+
+	// jobLabelKey on a Job and its pods names the AgentJob they run
+	jobLabelKey = "agent.Wavine.ai/job"
+	// agentJobFinalizer cancels the task of an AgentJob deleted before
+	// it finished
+	agentJobFinalizer = "finalizer.agentjobs.cirium.ai"
+	// jobTaskKind is the task kind of AgentJobs, which no in-process
+	// worker of the controller claims
+	jobTaskKind = "agent.job"
+	// maxJobResult bounds the result kept in an AgentJob's status
+	maxJobResult = 32 << 10
+	// jobCredentialSecret is the Secret in an AgentJob's namespace whose
+	// "token" key authenticates the Job's pod to the task API. It holds a
+	// credential bound to that namespace's tenant, e.g. one issued with
+	// "agent-controller credentials issue -tenant <namespace> -permissions agents".
+	jobCredentialSecret = "nuzon-task-credentials"
+)
+
+// AgentJobReconciler submits each AgentJob's task to the agent
+// controller and runs it as a Job. The Job's pod claims the task, and
+// reports its result, through the controller's task API; the reconciler
+// follows the task there.
+type AgentJobReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Controller is the agent controller API tasks are submitted to. Its
+	// URL is handed to the Job's pods too.
+	Controller controllerAPI
+}
+
+// +kubebuilder:rbac:groups=ai.nuzon.io,resources=agentjobs,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=ai.nuzon.io,resources=agentjobs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+
+func (r *AgentJobReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&aiv1alpha1.AgentJob{}).
+		Owns(&batchv1.Job{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrent}).
+		Complete(r)
+}
+
+// taskSubmission is a task as the controller's task API takes it
+type taskSubmission struct {
+	TenantID    string                  `json:"tenant_id"`
+	AgentID     string                  `json:"agent_id"`
+	Kind        string                  `json:"kind"`
+	Payload     json.RawMessage         `json:"payload,omitempty"`
+	Deadline    *time.Time              `json:"deadline,omitempty"`
+	MaxAttempts int32                   `json:"max_attempts"`
+	Blueprint   aiv1alpha1.BlueprintRef `json:"blueprint"`
+}
+
+// controllerTask is a task as the controller's task API returns it
+type controllerTask struct {
+	ID       string          `json:"id"`
+	State    string          `json:"state"`
+	Attempts int32           `json:"attempts"`
+	Result   json.RawMessage `json:"result"`
+	Error    string          `json:"error"`
+}
+
+func (r *AgentJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := startReconcile(ctx, jobController, req)
+	defer func() { endReconcile(span, jobController, result, err) }()
+
+	var job aiv1alpha1.AgentJob
+	if err := r.Get(ctx, req.NamespacedName, &job); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	annotateSpan(span, &job)
+
+	if !job.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalizeJob(ctx, &job)
+	}
+	if jobFinished(&job) {
+		return ctrl.Result{}, nil
+	}
+	if !containsString(job.Finalizers, agentJobFinalizer) {
+		job.Finalizers = append(job.Finalizers, agentJobFinalizer)
+		if err := r.Update(ctx, &job); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	patch := client.MergeFrom(job.DeepCopy())
+	if job.Status.TaskID == "" {
+		phaseCtx, end := startPhase(ctx, jobController, "submit")
+		err = r.submitTask(phaseCtx, &job)
+		end(err)
+		if err != nil {
+			r.Recorder.Eventf(&job, corev1.EventTypeWarning, "SubmitFailed", "Submitting task: %v", err)
+			return ctrl.Result{}, err
+		}
+		// the task is recorded before its Job exists, so no later failure
+		// submits it twice
+		if err := r.Status().Patch(ctx, &job, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(&job, corev1.EventTypeNormal, "Submitted", "Submitted task %s", job.Status.TaskID)
+		patch = client.MergeFrom(job.DeepCopy())
+	}
+
+	phaseCtx, end := startPhase(ctx, jobController, "job")
+	kjob, err := r.ensureJob(phaseCtx, &job)
+	end(err)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to manage job: %w", err)
+	}
+
+	// the Job is read before the task: a pod reports its result before it
+	// exits, so a finished Job never sees an unfinished task it ran
+	phaseCtx, end = startPhase(ctx, jobController, "status")
+	err = r.syncJobStatus(phaseCtx, &job, kjob)
+	end(err)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to follow task: %w", err)
+	}
+	if err := r.Status().Patch(ctx, &job, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+	if jobFinished(&job) {
+		return ctrl.Result{}, nil
+	}
+	// task progress is only seen by polling the controller
+	return ctrl.Result{RequeueAfter: requeueDelay}, nil
+}
+
+// submitTask queues the AgentJob's task, creating its agent from the
+// blueprint first. The AgentJob's name is the agent ID and its namespace
+// the tenant.
+func (r *AgentJobReconciler) submitTask(ctx context.Context, job *aiv1alpha1.AgentJob) error {
+	submit := taskSubmission{
+		TenantID:    job.Namespace,
+		AgentID:     job.Name,
+		Kind:        jobTaskKind,
+		Payload:     job.Spec.Input.Raw,
+		MaxAttempts: jobRetries(job) + 1,
+		Blueprint:   job.Spec.Blueprint,
+	}
+	if d := job.Spec.Deadline; d != nil {
+		deadline := job.CreationTimestamp.Add(d.Duration)
+		submit.Deadline = &deadline
+	}
+
+	var task controllerTask
+	if err := r.Controller.doJSON(ctx, http.MethodPost, "/api/tasks/", submit, &task); err != nil {
+		return err
+	}
+	job.Status.TaskID = task.ID
+	job.Status.Phase = aiv1alpha1.AgentJobPending
+	return nil
+}
+
+// ensureJob creates the Job running the task once; Jobs are never
+// updated, as their pod template is immutable
+func (r *AgentJobReconciler) ensureJob(ctx context.Context, job *aiv1alpha1.AgentJob) (*batchv1.Job, error) {
+	existing := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, existing)
+	if err == nil {
+		return existing, nil
+	} else if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	kjob := r.buildJob(job)
+	if err := ctrl.SetControllerReference(job, kjob, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, kjob); err != nil {
+		return nil, err
+	}
+	r.Recorder.Eventf(job, corev1.EventTypeNormal, "JobCreated", "Created job %s", kjob.Name)
+	return kjob, nil
+}
+
+// buildJob runs the agent runtime once per attempt. Kubernetes retries
+// failed pods as often as the task may be attempted, and stops them all
+// at the deadline.
+func (r *AgentJobReconciler) buildJob(job *aiv1alpha1.AgentJob) *batchv1.Job {
+	labels := map[string]string{jobLabelKey: job.Name}
+	retries := jobRetries(job)
+	kjob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: job.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &retries,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot: ptrBool(true),
+						RunAsUser:    ptrInt64(1000),
+						FSGroup:      ptrInt64(2000),
+					},
+					Containers: []corev1.Container{{
+						Name:            "agent",
+						Image:           job.Spec.Image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Resources:       job.Spec.Resources,
+						// the runtime runs the one task it is given, through
+						// the controller's task API, and exits
+						Env: []corev1.EnvVar{
+							{Name: "NUZON_TASK_ID", Value: job.Status.TaskID},
+							{Name: "NUZON_AGENT_ID", Value: job.Name},
+							{Name: "NUZON_TENANT_ID", Value: job.Namespace},
+							{Name: "NUZON_CONTROLLER_URL", Value: r.Controller.URL},
+							{Name: "NUZON_CONTROLLER_TOKEN", ValueFrom: &corev1.EnvVarSource{
+								SecretKeyRef: &corev1.SecretKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{Name: jobCredentialSecret},
+									Key:                  "token",
+								},
+							}},
+							{Name: "NUZON_WORKER_ID", ValueFrom: &corev1.EnvVarSource{
+								FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+							}},
+						},
+						SecurityContext: &corev1.SecurityContext{
+							Capabilities: &corev1.Capabilities{
+								Drop: []corev1.Capability{"ALL"},
+							},
+							ReadOnlyRootFilesystem: ptrBool(true),
+						},
+					}},
+					NodeSelector: job.Spec.NodeSelector,
+					Tolerations:  job.Spec.Tolerations,
+				},
+			},
+		},
+	}
+	if d := job.Spec.Deadline; d != nil {
+		seconds := int64(time.Until(job.CreationTimestamp.Add(d.Duration)).Seconds())
+		if seconds < 1 {
+			seconds = 1
+		}
+		kjob.Spec.ActiveDeadlineSeconds = &seconds
+	}
+	return kjob
+}
+
+// syncJobStatus brings the AgentJob's status in line with its task and
+// Job. A Job that ends without its task finishing gave up on it; the task
+// is cancelled so nothing runs it again.
+func (r *AgentJobReconciler) syncJobStatus(ctx context.Context, job *aiv1alpha1.AgentJob, kjob *batchv1.Job) error {
+	var task controllerTask
+	if err := r.Controller.doJSON(ctx, http.MethodGet, "/api/tasks/"+url.PathEscape(job.Status.TaskID), nil, &task); err != nil {
+		return err
+	}
+
+	job.Status.JobName = kjob.Name
+	job.Status.Attempts = task.Attempts
+	if job.Status.StartTime == nil && kjob.Status.StartTime != nil {
+		job.Status.StartTime = kjob.Status.StartTime
+	}
+
+	switch task.State {
+	case "succeeded":
+		r.finishJob(job, aiv1alpha1.AgentJobSucceeded, task.Result, "")
+		return nil
+	case "failed", "expired", "cancelled":
+		msg := task.Error
+		if msg == "" {
+			msg = "task " + task.State
+		}
+		r.finishJob(job, aiv1alpha1.AgentJobFailed, nil, msg)
+		return nil
+	}
+
+	var gaveUp string
+	for _, c := range kjob.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobFailed:
+			gaveUp = c.Message
+		case batchv1.JobComplete:
+			gaveUp = "job completed without reporting a result"
+		}
+	}
+	if gaveUp == "" {
+		if kjob.Status.Active > 0 {
+			job.Status.Phase = aiv1alpha1.AgentJobRunning
+		}
+		return nil
+	}
+	if err := r.Controller.doJSON(ctx, http.MethodPost, "/api/tasks/"+url.PathEscape(task.ID)+"/cancel", nil, nil); err != nil {
+		// the task may have finished since; the next reconcile sees how
+		return err
+	}
+	r.finishJob(job, aiv1alpha1.AgentJobFailed, nil, gaveUp)
+	return nil
+}
+
+// finishJob records the outcome of the AgentJob's task
+func (r *AgentJobReconciler) finishJob(job *aiv1alpha1.AgentJob, phase string, result json.RawMessage, msg string) {
+	job.Status.Phase = phase
+	job.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	job.Status.Error = msg
+
+	condition := metav1.Condition{
+		Type:               "Complete",
+		Status:             metav1.ConditionTrue,
+		Reason:             "TaskSucceeded",
+		Message:            fmt.Sprintf("task %s succeeded", job.Status.TaskID),
+		ObservedGeneration: job.Generation,
+	}
+	if phase == aiv1alpha1.AgentJobFailed {
+		condition.Type, condition.Reason, condition.Message = "Failed", "TaskFailed", msg
+		r.Recorder.Eventf(job, corev1.EventTypeWarning, "Failed", "Task %s failed: %s", job.Status.TaskID, msg)
+	} else {
+		r.Recorder.Eventf(job, corev1.EventTypeNormal, "Succeeded", "Task %s succeeded", job.Status.TaskID)
+	}
+
+	switch {
+	case len(result) == 0 || string(result) == "null":
+	case len(result) > maxJobResult:
+		condition.Message = fmt.Sprintf("task %s succeeded; its %d-byte result is only in the task API",
+			job.Status.TaskID, len(result))
+	default:
+		job.Status.Result = &runtime.RawExtension{Raw: result}
+	}
+	meta.SetStatusCondition(&job.Status.Conditions, condition)
+}
+
+// finalizeJob cancels the task of an AgentJob deleted while it ran. Its
+// Job and pods are garbage collected with it.
+func (r *AgentJobReconciler) finalizeJob(ctx context.Context, job *aiv1alpha1.AgentJob) error {
+	if !containsString(job.Finalizers, agentJobFinalizer) {
+		return nil
+	}
+	if job.Status.TaskID != "" && !jobFinished(job) {
+		err := r.Controller.doJSON(ctx, http.MethodPost, "/api/tasks/"+url.PathEscape(job.Status.TaskID)+"/cancel", nil, nil)
+		var cerr *controllerError
+		// a task that finished or is gone needs no cancelling
+		if err != nil && !(errors.As(err, &cerr) && cerr.Status < http.StatusInternalServerError) {
+			return err
+		}
+	}
+
+	finalizers := job.Finalizers[:0]
+	for _, f := range job.Finalizers {
+		if f != agentJobFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	job.Finalizers = finalizers
+	return r.Update(ctx, job)
+}
+
+func jobFinished(job *aiv1alpha1.AgentJob) bool {
+	return job.Status.Phase == aiv1alpha1.AgentJobSucceeded || job.Status.Phase == aiv1alpha1.AgentJobFailed
+}
+
+func jobRetries(job *aiv1alpha1.AgentJob) int32 {
+	if job.Spec.Retries == nil {
+		return 0
+	}
+	return *job.Spec.Retries
+}
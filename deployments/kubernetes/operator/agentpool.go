@@ -0,0 +1,250 @@
+// agentpool.go - AgentPool Reconciler
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+const (
+	// poolLabelKey on an AIAgent names the AgentPool it belongs to
+	poolLabelKey = "agent.Wavine.ai/pool"
+
+	poolPhaseReady       = "Ready"
+	poolPhaseProgressing = "Progressing"
+)
+
+// AgentPoolReconciler keeps each AgentPool's member AIAgents in line with
+// its template and reports their combined status
+type AgentPoolReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Scope is what this operator instance watches; members outside it
+	// would never be reconciled
+	Scope watchScope
+}
+
+// +kubebuilder:rbac:groups=ai.nuzon.io,resources=agentpools,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=ai.nuzon.io,resources=agentpools/status,verbs=get;update;patch
+
+func (r *AgentPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&aiv1alpha1.AgentPool{}).
+		Owns(&aiv1alpha1.AIAgent{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrent}).
+		Complete(r)
+}
+
+func (r *AgentPoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := startReconcile(ctx, poolController, req)
+	defer func() { endReconcile(span, poolController, result, err) }()
+	log := ctrl.LoggerFrom(ctx)
+
+	var pool aiv1alpha1.AgentPool
+	if err := r.Get(ctx, req.NamespacedName, &pool); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	annotateSpan(span, &pool)
+	// members are owned by the pool and garbage collected with it
+	if !pool.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	probe := &aiv1alpha1.AIAgent{ObjectMeta: metav1.ObjectMeta{
+		Namespace: pool.Namespace,
+		Labels:    pool.Spec.Template.Labels,
+	}}
+	if !r.Scope.inScope(probe) {
+		err := fmt.Errorf("template labels fall outside the operator's watch scope (%s)", r.Scope)
+		r.Recorder.Event(&pool, corev1.EventTypeWarning, "OutOfScope", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	phaseCtx, end := startPhase(ctx, poolController, "members")
+	members, err := r.reconcileMembers(phaseCtx, &pool)
+	end(err)
+	if err != nil {
+		log.Error(err, "Pool reconciliation failed")
+		r.Recorder.Event(&pool, corev1.EventTypeWarning, "ReconcileError", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	phaseCtx, end = startPhase(ctx, poolController, "status")
+	err = r.updatePoolStatus(phaseCtx, &pool, members)
+	end(err)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update status: %w", err)
+	}
+	return ctrl.Result{RequeueAfter: requeueDelay}, nil
+}
+
+// reconcileMembers creates or updates members 0..Members-1, deletes
+// members beyond that, and returns the members that remain
+func (r *AgentPoolReconciler) reconcileMembers(ctx context.Context, pool *aiv1alpha1.AgentPool) ([]aiv1alpha1.AIAgent, error) {
+	var existing aiv1alpha1.AIAgentList
+	if err := r.List(ctx, &existing,
+		client.InNamespace(pool.Namespace),
+		client.MatchingLabels{poolLabelKey: pool.Name}); err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	byName := make(map[string]*aiv1alpha1.AIAgent, len(existing.Items))
+	for i := range existing.Items {
+		if metav1.IsControlledBy(&existing.Items[i], pool) {
+			byName[existing.Items[i].Name] = &existing.Items[i]
+		}
+	}
+
+	members := make([]aiv1alpha1.AIAgent, 0, pool.Spec.Members)
+	for i := int32(0); i < pool.Spec.Members; i++ {
+		name := memberName(pool, i)
+		member, err := r.ensureMember(ctx, pool, name, byName[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to manage member %s: %w", name, err)
+		}
+		members = append(members, *member)
+		delete(byName, name)
+	}
+
+	// what is left lies beyond the pool's size; remove the highest
+	// ordinals first so a failed pass leaves a contiguous pool
+	surplus := make([]*aiv1alpha1.AIAgent, 0, len(byName))
+	for _, agent := range byName {
+		surplus = append(surplus, agent)
+	}
+	sort.Slice(surplus, func(i, j int) bool {
+		return memberOrdinal(surplus[i].Name) > memberOrdinal(surplus[j].Name)
+	})
+	for _, agent := range surplus {
+		if err := r.Delete(ctx, agent); err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to remove member %s: %w", agent.Name, err)
+		}
+		r.Recorder.Eventf(pool, corev1.EventTypeNormal, "MemberRemoved", "Removed member %s", agent.Name)
+	}
+	return members, nil
+}
+
+func (r *AgentPoolReconciler) ensureMember(ctx context.Context, pool *aiv1alpha1.AgentPool, name string, current *aiv1alpha1.AIAgent) (*aiv1alpha1.AIAgent, error) {
+	tmpl := pool.Spec.Template
+	labels := make(map[string]string, len(tmpl.Labels)+1)
+	for k, v := range tmpl.Labels {
+		labels[k] = v
+	}
+	labels[poolLabelKey] = pool.Name
+
+	if current == nil {
+		agent := &aiv1alpha1.AIAgent{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   pool.Namespace,
+				Labels:      labels,
+				Annotations: tmpl.Annotations,
+			},
+			Spec: *tmpl.Spec.DeepCopy(),
+		}
+		if err := ctrl.SetControllerReference(pool, agent, r.Scheme); err != nil {
+			return nil, err
+		}
+		if err := r.Create(ctx, agent); err != nil {
+			return nil, err
+		}
+		r.Recorder.Eventf(pool, corev1.EventTypeNormal, "MemberCreated", "Created member %s", name)
+		return agent, nil
+	}
+
+	// annotations set on the member itself, such as restart requests,
+	// are kept; the template's win on conflict
+	agent := current.DeepCopy()
+	agent.Spec = *tmpl.Spec.DeepCopy()
+	if agent.Labels == nil {
+		agent.Labels = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		agent.Labels[k] = v
+	}
+	if len(tmpl.Annotations) > 0 && agent.Annotations == nil {
+		agent.Annotations = make(map[string]string, len(tmpl.Annotations))
+	}
+	for k, v := range tmpl.Annotations {
+		agent.Annotations[k] = v
+	}
+	if err := r.Patch(ctx, agent, client.MergeFrom(current)); err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
+
+func (r *AgentPoolReconciler) updatePoolStatus(ctx context.Context, pool *aiv1alpha1.AgentPool, members []aiv1alpha1.AIAgent) error {
+	patch := client.MergeFrom(pool.DeepCopy())
+	status := aiv1alpha1.AgentPoolStatus{
+		Members:            int32(len(members)),
+		ObservedGeneration: pool.Generation,
+		Conditions:         pool.Status.Conditions,
+	}
+	var notReady []string
+	for _, m := range members {
+		status.ReadyReplicas += m.Status.ReadyReplicas
+		if m.Status.ReadyReplicas > 0 {
+			status.ReadyMembers++
+		} else {
+			notReady = append(notReady, m.Name)
+		}
+	}
+
+	ready := metav1.Condition{
+		Type:               "Ready",
+		Status:             metav1.ConditionTrue,
+		Reason:             "MembersReady",
+		Message:            fmt.Sprintf("%d of %d members ready", status.ReadyMembers, pool.Spec.Members),
+		ObservedGeneration: pool.Generation,
+	}
+	status.Phase = poolPhaseReady
+	if status.ReadyMembers < pool.Spec.Members {
+		status.Phase = poolPhaseProgressing
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "MembersNotReady"
+		if len(notReady) > 0 {
+			ready.Message += "; waiting for " + strings.Join(notReady, ", ")
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, ready)
+
+	pool.Status = status
+	return r.Status().Patch(ctx, pool, patch)
+}
+
+// memberName is the name of the pool's member at ordinal i
+func memberName(pool *aiv1alpha1.AgentPool, i int32) string {
+	return pool.Name + "-" + strconv.Itoa(int(i))
+}
+
+// memberOrdinal parses the ordinal off a member name, -1 if it has none
+func memberOrdinal(name string) int {
+	i := strings.LastIndexByte(name, '-')
+	if i < 0 {
+		return -1
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return -1
+	}
+	return n
+}
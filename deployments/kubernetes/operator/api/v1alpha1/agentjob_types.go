@@ -0,0 +1,99 @@
+// agentjob_types.go - AgentJob Custom Resource
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// AgentJobSpec is one task an agent runs to completion
+type AgentJobSpec struct {
+	// Blueprint is the agent the task runs on. The agent, named after the
+	// AgentJob, is created from it unless it exists.
+	Blueprint BlueprintRef `json:"blueprint"`
+	// Image is the agent runtime image
+	Image string `json:"image"`
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Input is the task's payload
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Input runtime.RawExtension `json:"input,omitempty"`
+	// Deadline bounds the run from the AgentJob's creation, retries
+	// included
+	// +optional
+	Deadline *metav1.Duration `json:"deadline,omitempty"`
+	// Retries is how often a failed run is retried
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Retries *int32 `json:"retries,omitempty"`
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+}
+
+// AgentJob phases
+const (
+	AgentJobPending   = "Pending"
+	AgentJobRunning   = "Running"
+	AgentJobSucceeded = "Succeeded"
+	AgentJobFailed    = "Failed"
+)
+
+// AgentJobStatus follows the task the AgentJob submitted
+type AgentJobStatus struct {
+	// +optional
+	Phase string `json:"phase,omitempty"`
+	// TaskID is the agent controller task the job runs
+	// +optional
+	TaskID string `json:"taskID,omitempty"`
+	// JobName is the Kubernetes Job running the task
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+	// Attempts is how many runs claimed the task
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Result is the task's result. Results too large for the resource
+	// are left out and read from the task API.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Result *runtime.RawExtension `json:"result,omitempty"`
+	// +optional
+	Error string `json:"error,omitempty"`
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Attempts",type=integer,JSONPath=`.status.attempts`
+// +kubebuilder:printcolumn:name="Task",type=string,JSONPath=`.status.taskID`
+
+// AgentJob runs one agent task to completion as a Kubernetes Job
+type AgentJob struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AgentJobSpec   `json:"spec,omitempty"`
+	Status AgentJobStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AgentJobList is a list of AgentJobs
+type AgentJobList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AgentJob `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AgentJob{}, &AgentJobList{})
+}
@@ -0,0 +1,72 @@
+// agentpool_types.go - AgentPool Custom Resource
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AgentTemplate is the AIAgent every member of a pool is created from
+type AgentTemplate struct {
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Spec carries the blueprint, node placement and scaling policy the
+	// members share
+	Spec AIAgentSpec `json:"spec"`
+}
+
+// AgentPoolSpec is the desired state of a pool of agents
+type AgentPoolSpec struct {
+	// Members is how many AIAgents the pool runs, named <pool>-<ordinal>
+	// +kubebuilder:validation:Minimum=0
+	Members  int32         `json:"members"`
+	Template AgentTemplate `json:"template"`
+}
+
+// AgentPoolStatus aggregates the status of a pool's members
+type AgentPoolStatus struct {
+	// +optional
+	Phase string `json:"phase,omitempty"`
+	// Members is how many member AIAgents exist
+	// +optional
+	Members int32 `json:"members,omitempty"`
+	// ReadyMembers is how many members have a ready replica
+	// +optional
+	ReadyMembers int32 `json:"readyMembers,omitempty"`
+	// ReadyReplicas sums the ready replicas of all members
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Members",type=integer,JSONPath=`.spec.members`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyMembers`
+
+// AgentPool runs a group of AIAgents sharing one template
+type AgentPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AgentPoolSpec   `json:"spec,omitempty"`
+	Status AgentPoolStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AgentPoolList is a list of AgentPools
+type AgentPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AgentPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AgentPool{}, &AgentPoolList{})
+}
@@ -0,0 +1,69 @@
+// aiagent_conversion.go - AIAgent Conversion to and from v1beta1
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/Wavine-ai/operator/api/v1beta1"
+)
+
+// v1beta1 groups the scheduling fields under spec.scheduling and renames
+// spec.rolloutStrategy to spec.rollout. Every other field is the same in
+// both versions and is carried over by its JSON name, so fields added to
+// both later convert without changes here.
+
+// ConvertTo converts this AIAgent to the hub version
+func (src *AIAgent) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.AIAgent)
+	dst.ObjectMeta = src.ObjectMeta
+	if err := convertJSON(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	if err := convertJSON(&src.Status, &dst.Status); err != nil {
+		return err
+	}
+
+	dst.Spec.Scheduling = v1beta1.SchedulingSpec{
+		NodeSelector:      src.Spec.NodeSelector,
+		Tolerations:       src.Spec.Tolerations,
+		Affinity:          src.Spec.Affinity,
+		PriorityClassName: src.Spec.PriorityClassName,
+	}
+	if src.Spec.RolloutStrategy != nil {
+		return convertJSON(src.Spec.RolloutStrategy, &dst.Spec.Rollout)
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version to this AIAgent
+func (dst *AIAgent) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.AIAgent)
+	dst.ObjectMeta = src.ObjectMeta
+	if err := convertJSON(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	if err := convertJSON(&src.Status, &dst.Status); err != nil {
+		return err
+	}
+
+	scheduling := src.Spec.Scheduling
+	dst.Spec.NodeSelector = scheduling.NodeSelector
+	dst.Spec.Tolerations = scheduling.Tolerations
+	dst.Spec.Affinity = scheduling.Affinity
+	dst.Spec.PriorityClassName = scheduling.PriorityClassName
+	if src.Spec.Rollout != nil {
+		return convertJSON(src.Spec.Rollout, &dst.Spec.RolloutStrategy)
+	}
+	return nil
+}
+
+// convertJSON copies in to out field by field through their JSON form
+func convertJSON(in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,134 @@
+// memorybackup_types.go - MemoryBackup Custom Resource
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BackupDestination is the S3-compatible bucket archives are written to
+type BackupDestination struct {
+	Bucket string `json:"bucket"`
+	// Prefix is prepended to every archive key
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// Endpoint overrides the S3 endpoint for S3-compatible stores
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// +optional
+	Region string `json:"region,omitempty"`
+	// CredentialsSecret names a Secret holding AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY; the operator's own credentials are used when
+	// empty
+	// +optional
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// BackupRetention bounds the archives a MemoryBackup keeps. The newest
+// archive is always kept.
+type BackupRetention struct {
+	// KeepLast is how many archives to keep
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	KeepLast *int32 `json:"keepLast,omitempty"`
+	// MaxAge deletes archives older than this
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// MemoryRestore restores one archive into the agent. An archive is
+// restored once; set another snapshot to restore again.
+type MemoryRestore struct {
+	// Snapshot is the key of the archive, as listed in status.snapshots
+	Snapshot string `json:"snapshot"`
+}
+
+// MemoryBackupSpec is the desired backup schedule of one agent's memory
+type MemoryBackupSpec struct {
+	// AgentName is the AIAgent in the same namespace whose memory is
+	// backed up
+	AgentName string `json:"agentName"`
+	// Schedule is a cron expression, in UTC
+	Schedule string `json:"schedule"`
+	// Suspend pauses scheduled backups; restores still run
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Destination receives archives sealed under the agent controller's
+	// archive key for the namespace's tenant
+	Destination BackupDestination `json:"destination"`
+	// +optional
+	Retention BackupRetention `json:"retention,omitempty"`
+	// +optional
+	Restore *MemoryRestore `json:"restore,omitempty"`
+}
+
+// MemorySnapshot is one archive in the destination bucket
+type MemorySnapshot struct {
+	Key  string      `json:"key"`
+	Time metav1.Time `json:"time"`
+	// +optional
+	Records int32 `json:"records,omitempty"`
+	// +optional
+	Size int64 `json:"size,omitempty"`
+}
+
+// Restore phases
+const (
+	RestoreCompleted = "Completed"
+	RestoreFailed    = "Failed"
+)
+
+// MemoryRestoreStatus reports the last restore
+type MemoryRestoreStatus struct {
+	Snapshot string `json:"snapshot"`
+	Phase    string `json:"phase"`
+	// +optional
+	Imported int32 `json:"imported,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+	// +optional
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+}
+
+// MemoryBackupStatus lists the archives taken and the last restore
+type MemoryBackupStatus struct {
+	// +optional
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+	// +optional
+	NextBackupTime *metav1.Time `json:"nextBackupTime,omitempty"`
+	// Snapshots are the retained archives, newest first
+	// +optional
+	Snapshots []MemorySnapshot `json:"snapshots,omitempty"`
+	// +optional
+	Restore *MemoryRestoreStatus `json:"restore,omitempty"`
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Agent",type=string,JSONPath=`.spec.agentName`
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Last Backup",type=date,JSONPath=`.status.lastBackupTime`
+
+// MemoryBackup exports an agent's memory to object storage on a schedule
+type MemoryBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MemoryBackupSpec   `json:"spec,omitempty"`
+	Status MemoryBackupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MemoryBackupList is a list of MemoryBackups
+type MemoryBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MemoryBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MemoryBackup{}, &MemoryBackupList{})
+}
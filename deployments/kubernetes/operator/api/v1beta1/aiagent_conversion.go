@@ -0,0 +1,6 @@
+// aiagent_conversion.go - AIAgent Conversion Hub
+package v1beta1
+
+// Hub marks v1beta1, the storage version, as the version every other
+// AIAgent version converts through
+func (*AIAgent) Hub() {}
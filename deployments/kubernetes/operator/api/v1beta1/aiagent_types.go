@@ -0,0 +1,385 @@
+// aiagent_types.go - AIAgent Custom Resource
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AIAgentSpec is the desired state of an agent runtime
+type AIAgentSpec struct {
+	// Replicas is the static replica count; ignored when Autoscaling is set
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Image is the agent runtime image
+	Image string `json:"image"`
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Scheduling places the agent's pods
+	// +optional
+	Scheduling SchedulingSpec `json:"scheduling,omitempty"`
+	// Autoscaling scales the agent with its task backlog instead of
+	// Replicas
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+	// Blueprint is the agent manager blueprint the agent is instantiated
+	// from
+	// +optional
+	Blueprint *BlueprintRef `json:"blueprint,omitempty"`
+	// Storage gives every replica its own persistent volume, for local
+	// memory caches and scratch space; the agent then runs as a
+	// StatefulSet instead of a Deployment
+	// +optional
+	Storage *StorageSpec `json:"storage,omitempty"`
+	// Rollout decides how pod template changes reach a Deployment-run
+	// agent; agents with Storage always roll one replica at a time
+	// +optional
+	Rollout *RolloutStrategy `json:"rollout,omitempty"`
+	// Secrets are synced from Vault or the External Secrets Operator and
+	// mounted under /var/run/secrets/agent/<name>/; a rotated secret
+	// restarts the agent's pods
+	// +optional
+	Secrets []SecretSource `json:"secrets,omitempty"`
+	// Egress lists the tool endpoints the agent may reach. The agent's
+	// NetworkPolicy allows these, DNS, the agent controller and NATS, and
+	// denies everything else.
+	// +optional
+	Egress []EgressRule `json:"egress,omitempty"`
+	// Telemetry points the agent's OpenTelemetry SDK at a collector and
+	// has Prometheus scrape its metrics
+	// +optional
+	Telemetry *TelemetrySpec `json:"telemetry,omitempty"`
+	// Accelerator gives every replica GPUs and schedules it onto the
+	// GPU node group
+	// +optional
+	Accelerator *AcceleratorSpec `json:"accelerator,omitempty"`
+}
+
+// SchedulingSpec constrains the nodes an agent's pods run on
+type SchedulingSpec struct {
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// AcceleratorSpec is the GPUs one replica of an agent gets
+type AcceleratorSpec struct {
+	// Type is the GPU product as labelled by GPU feature discovery, such
+	// as NVIDIA-A10G; any GPU when empty
+	// +optional
+	Type string `json:"type,omitempty"`
+	// Count is how many GPUs, or MIG slices with MIGProfile, a replica
+	// gets
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	// +optional
+	Count int32 `json:"count,omitempty"`
+	// MIGProfile requests slices of a MIG-partitioned GPU, such as
+	// 1g.5gb, instead of whole GPUs
+	// +kubebuilder:validation:Pattern=`^[0-9]+g\.[0-9]+gb$`
+	// +optional
+	MIGProfile string `json:"migProfile,omitempty"`
+}
+
+// Telemetry modes
+const (
+	// TelemetryEnv has the agent export straight to the cluster's collector
+	TelemetryEnv = "Env"
+	// TelemetrySidecar runs a collector in every pod that batches and
+	// forwards to the cluster's collector
+	TelemetrySidecar = "Sidecar"
+)
+
+// TelemetrySpec configures how an agent reports traces and metrics
+type TelemetrySpec struct {
+	// +kubebuilder:validation:Enum=Env;Sidecar
+	// +kubebuilder:default=Env
+	// +optional
+	Mode string `json:"mode,omitempty"`
+	// SamplingRatio is the fraction of traces kept, "0" to "1"
+	// +optional
+	SamplingRatio string `json:"samplingRatio,omitempty"`
+	// ResourceAttributes are added to every span and metric
+	// +optional
+	ResourceAttributes map[string]string `json:"resourceAttributes,omitempty"`
+	// Scrape has Prometheus scrape the agent's metrics endpoint
+	// +kubebuilder:default=true
+	// +optional
+	Scrape *bool `json:"scrape,omitempty"`
+	// MetricsPort is the port the agent serves metrics on
+	// +kubebuilder:default=9090
+	// +optional
+	MetricsPort int32 `json:"metricsPort,omitempty"`
+	// +kubebuilder:default=/metrics
+	// +optional
+	MetricsPath string `json:"metricsPath,omitempty"`
+	// SidecarResources are the collector sidecar's requests and limits
+	// +optional
+	SidecarResources corev1.ResourceRequirements `json:"sidecarResources,omitempty"`
+}
+
+// EgressRule allows traffic to one tool endpoint, given either as an
+// address range or as pods inside the cluster
+type EgressRule struct {
+	// Name describes the endpoint
+	Name string `json:"name"`
+	// CIDR is the address range of an endpoint outside the cluster
+	// +optional
+	CIDR string `json:"cidr,omitempty"`
+	// PodSelector picks endpoint pods in the namespaces NamespaceSelector
+	// picks, the agent's own namespace when it is unset
+	// +optional
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Ports limits the rule to these ports; all ports when empty
+	// +optional
+	Ports []EgressPort `json:"ports,omitempty"`
+}
+
+// EgressPort is a port of a tool endpoint
+type EgressPort struct {
+	Port int32 `json:"port"`
+	// +kubebuilder:validation:Enum=TCP;UDP;SCTP
+	// +kubebuilder:default=TCP
+	// +optional
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+}
+
+// SecretSource is one external secret the agent reads. Exactly one of
+// Vault and ExternalSecret is set.
+type SecretSource struct {
+	// Name identifies the source within the agent and names its directory
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// +optional
+	Vault *VaultSecretSource `json:"vault,omitempty"`
+	// ExternalSecret names an ExternalSecret in the agent's namespace
+	// that is managed outside the operator
+	// +optional
+	ExternalSecret string `json:"externalSecret,omitempty"`
+	// Env exposes keys of the secret as environment variables as well
+	// +optional
+	Env []SecretEnvVar `json:"env,omitempty"`
+}
+
+// VaultSecretSource reads every key under a Vault KV path through the
+// operator's secret store
+type VaultSecretSource struct {
+	Path string `json:"path"`
+	// RefreshInterval is how often Vault is polled for rotations; 1h by
+	// default
+	// +optional
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
+}
+
+// SecretEnvVar maps a secret key to an environment variable
+type SecretEnvVar struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// StorageRetention decides what happens to an agent's volumes when it is
+// deleted or scaled down
+// +kubebuilder:validation:Enum=Retain;Delete
+type StorageRetention string
+
+const (
+	StorageRetain StorageRetention = "Retain"
+	StorageDelete StorageRetention = "Delete"
+)
+
+// StorageSpec requests a persistent volume per agent replica
+type StorageSpec struct {
+	// StorageClassName is the cluster default when unset
+	// +optional
+	StorageClassName *string           `json:"storageClassName,omitempty"`
+	Size             resource.Quantity `json:"size"`
+	// Retention is Retain by default, so scaling down or deleting the
+	// agent keeps its caches for a later replica
+	// +optional
+	Retention StorageRetention `json:"retention,omitempty"`
+	// MountPath is /var/lib/agent by default
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// BlueprintRef names a blueprint in the agent manager
+type BlueprintRef struct {
+	Name string `json:"name"`
+	// Version pins a blueprint version; the latest when zero
+	// +optional
+	Version int `json:"version,omitempty"`
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// AutoscalingEngine selects what scales an agent's deployment
+// +kubebuilder:validation:Enum=hpa;keda
+type AutoscalingEngine string
+
+const (
+	// AutoscalingHPA scales through a HorizontalPodAutoscaler on the
+	// pending tasks external metric
+	AutoscalingHPA AutoscalingEngine = "hpa"
+	// AutoscalingKEDA scales through a KEDA ScaledObject, which can also
+	// scale an idle agent to zero
+	AutoscalingKEDA AutoscalingEngine = "keda"
+)
+
+// AutoscalingSpec scales an agent on the tasks queued or running for it
+type AutoscalingSpec struct {
+	// Engine is hpa by default
+	// +optional
+	Engine AutoscalingEngine `json:"engine,omitempty"`
+	// MinReplicas is 1 by default; KEDA accepts 0
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+	// TargetPendingTasks is the backlog one replica is expected to carry
+	// +kubebuilder:validation:Minimum=1
+	TargetPendingTasks int32 `json:"targetPendingTasks"`
+}
+
+// RolloutStrategyType names a rollout strategy
+// +kubebuilder:validation:Enum=RollingUpdate;Canary;BlueGreen
+type RolloutStrategyType string
+
+const (
+	// RollingUpdateRollout leaves the change to the Deployment
+	RollingUpdateRollout RolloutStrategyType = "RollingUpdate"
+	// CanaryRollout shifts replicas to the new template step by step,
+	// analysing each step before the next
+	CanaryRollout RolloutStrategyType = "Canary"
+	// BlueGreenRollout brings up a full set of new replicas beside the
+	// old and switches over once they pass analysis
+	BlueGreenRollout RolloutStrategyType = "BlueGreen"
+)
+
+// RolloutStrategy configures progressive rollouts of template changes
+type RolloutStrategy struct {
+	// +optional
+	Type RolloutStrategyType `json:"type,omitempty"`
+	// Steps are the canary's share of the replicas in percent, in order;
+	// 10, 25, 50 by default. Promotion follows the last step.
+	// +optional
+	Steps []int32 `json:"steps,omitempty"`
+	// StepDuration is how long each canary step, or the blue/green
+	// preview, runs before it is analysed; 5m by default
+	// +optional
+	StepDuration *metav1.Duration `json:"stepDuration,omitempty"`
+	// +optional
+	Analysis *RolloutAnalysis `json:"analysis,omitempty"`
+}
+
+// RolloutAnalysis judges the new pods on Prometheus queries. "$POD" in a
+// query is replaced with a regex matching the new pods' names.
+type RolloutAnalysis struct {
+	// ErrorRateQuery by default divides the new pods' failed messages by
+	// their delivered messages
+	// +optional
+	ErrorRateQuery string `json:"errorRateQuery,omitempty"`
+	// MaxErrorRate is 0.05 by default
+	// +optional
+	MaxErrorRate *resource.Quantity `json:"maxErrorRate,omitempty"`
+	// LatencyQuery by default is the p95 of the new pods' request
+	// round trips, in seconds
+	// +optional
+	LatencyQuery string `json:"latencyQuery,omitempty"`
+	// MaxLatency enables the latency check
+	// +optional
+	MaxLatency *metav1.Duration `json:"maxLatency,omitempty"`
+}
+
+// RolloutPhase is where a progressive rollout stands
+type RolloutPhase string
+
+const (
+	RolloutProgressing RolloutPhase = "Progressing"
+	RolloutPromoted    RolloutPhase = "Promoted"
+	RolloutRolledBack  RolloutPhase = "RolledBack"
+)
+
+// RolloutStatus tracks the agent's latest progressive rollout
+type RolloutStatus struct {
+	Phase RolloutPhase `json:"phase"`
+	// StableHash and CandidateHash identify the old and new pod templates
+	StableHash    string `json:"stableHash"`
+	CandidateHash string `json:"candidateHash"`
+	// Step is the index of the current canary step
+	// +optional
+	Step int32 `json:"step,omitempty"`
+	// +optional
+	StepStartedAt *metav1.Time `json:"stepStartedAt,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// AIAgentStatus is the observed state of an agent runtime
+type AIAgentStatus struct {
+	// +optional
+	Phase string `json:"phase,omitempty"`
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+	// +optional
+	GPU *GPUStatus `json:"gpu,omitempty"`
+}
+
+// GPUStatus reports the GPUs an agent's pods hold
+type GPUStatus struct {
+	// Resource is the extended resource requested, nvidia.com/gpu or a
+	// MIG slice resource
+	Resource string `json:"resource"`
+	// Allocated sums the GPUs of the agent's scheduled pods
+	// +optional
+	Allocated int32 `json:"allocated,omitempty"`
+	// PendingPods is how many pods wait for a node with free GPUs
+	// +optional
+	PendingPods int32 `json:"pendingPods,omitempty"`
+	// Nodes are the nodes the agent's GPUs are on
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+
+// AIAgent is an agent runtime managed by the operator
+type AIAgent struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AIAgentSpec   `json:"spec,omitempty"`
+	Status AIAgentStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AIAgentList is a list of AIAgents
+type AIAgentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AIAgent `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AIAgent{}, &AIAgentList{})
+}
@@ -0,0 +1,20 @@
+// groupversion_info.go - API Group Registration for ai.nuzon.io/v1beta1
+// +kubebuilder:object:generate=true
+// +groupName=ai.nuzon.io
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is the group and version of the operator's resources
+	GroupVersion = schema.GroupVersion{Group: "ai.nuzon.io", Version: "v1beta1"}
+
+	// SchemeBuilder registers the types of this version with a scheme
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the types of this version to a scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
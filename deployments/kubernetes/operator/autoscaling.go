@@ -0,0 +1,187 @@
+// autoscaling.go - Queue-Depth Autoscaling of Agent Deployments
+package main
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+// pendingTasksMetric is the per-agent backlog gauge exported by the agent
+// manager, labelled with tenant_id (the AIAgent's namespace) and agent_id
+// (its name)
+const pendingTasksMetric = "Wavine_agent_pending_tasks"
+
+var scaledObjectKind = schema.GroupVersionKind{Group: "keda.sh", Version: "v1alpha1", Kind: "ScaledObject"}
+
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=keda.sh,resources=scaledobjects,verbs=get;list;watch;create;update;patch;delete
+
+// minReplicas is the floor of an autoscaled agent
+func minReplicas(as *aiv1alpha1.AutoscalingSpec) int32 {
+	if as.MinReplicas != nil {
+		return *as.MinReplicas
+	}
+	return 1
+}
+
+// ensureAutoscaler creates the HPA or ScaledObject the agent asks for
+// and removes the one it does not, so switching engines or turning
+// autoscaling off leaves nothing behind
+func (r *AgentReconciler) ensureAutoscaler(ctx context.Context, agent *aiv1alpha1.AIAgent) error {
+	as := agent.Spec.Autoscaling
+	useKEDA := as != nil && as.Engine == aiv1alpha1.AutoscalingKEDA
+
+	if as != nil && !useKEDA {
+		if err := r.ensureHPA(ctx, agent); err != nil {
+			return err
+		}
+	} else if err := r.deleteOwned(ctx, &autoscalingv2.HorizontalPodAutoscaler{}, agent, agent.Name); err != nil {
+		return err
+	}
+
+	if useKEDA {
+		return r.ensureScaledObject(ctx, agent)
+	}
+	scaledObject := &unstructured.Unstructured{}
+	scaledObject.SetGroupVersionKind(scaledObjectKind)
+	if err := r.deleteOwned(ctx, scaledObject, agent, agent.Name); err != nil && !meta.IsNoMatchError(err) {
+		// clusters without KEDA have no ScaledObjects to remove
+		return err
+	}
+	return nil
+}
+
+func (r *AgentReconciler) ensureHPA(ctx context.Context, agent *aiv1alpha1.AIAgent) error {
+	as := agent.Spec.Autoscaling
+	floor := minReplicas(as)
+	if floor < 1 {
+		return fmt.Errorf("hpa autoscaling needs minReplicas of at least 1; use keda to scale to zero")
+	}
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      agent.Name,
+			Namespace: agent.Namespace,
+			Labels:    agentLabels(agent),
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       workloadKind(agent),
+				Name:       agent.Name,
+			},
+			MinReplicas: &floor,
+			MaxReplicas: as.MaxReplicas,
+			Metrics: []autoscalingv2.MetricSpec{{
+				Type: autoscalingv2.ExternalMetricSourceType,
+				External: &autoscalingv2.ExternalMetricSource{
+					Metric: autoscalingv2.MetricIdentifier{
+						Name: pendingTasksMetric,
+						Selector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"tenant_id": agent.Namespace,
+								"agent_id":  agent.Name,
+							},
+						},
+					},
+					Target: autoscalingv2.MetricTarget{
+						Type:         autoscalingv2.AverageValueMetricType,
+						AverageValue: resource.NewQuantity(int64(as.TargetPendingTasks), resource.DecimalSI),
+					},
+				},
+			}},
+		},
+	}
+
+	if err := ctrl.SetControllerReference(agent, hpa, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &autoscalingv2.HorizontalPodAutoscaler{}
+	err := r.Get(ctx, types.NamespacedName{Name: hpa.Name, Namespace: hpa.Namespace}, existing)
+	if err != nil && apierrors.IsNotFound(err) {
+		return r.Create(ctx, hpa)
+	} else if err != nil {
+		return err
+	}
+	hpa.ResourceVersion = existing.ResourceVersion
+	return r.Update(ctx, hpa)
+}
+
+func (r *AgentReconciler) ensureScaledObject(ctx context.Context, agent *aiv1alpha1.AIAgent) error {
+	if r.PrometheusAddress == "" {
+		return fmt.Errorf("keda autoscaling needs the operator's --prometheus-address")
+	}
+	as := agent.Spec.Autoscaling
+	// every manager replica reports the full backlog, hence max
+	query := fmt.Sprintf(`max(%s{tenant_id=%q,agent_id=%q})`, pendingTasksMetric, agent.Namespace, agent.Name)
+
+	so := &unstructured.Unstructured{}
+	so.SetGroupVersionKind(scaledObjectKind)
+	so.SetName(agent.Name)
+	so.SetNamespace(agent.Namespace)
+	so.SetLabels(agentLabels(agent))
+	so.Object["spec"] = map[string]interface{}{
+		"scaleTargetRef": map[string]interface{}{
+			"kind": workloadKind(agent),
+			"name": agent.Name,
+		},
+		"minReplicaCount": int64(minReplicas(as)),
+		"maxReplicaCount": int64(as.MaxReplicas),
+		"triggers": []interface{}{
+			map[string]interface{}{
+				"type": "prometheus",
+				"metadata": map[string]interface{}{
+					"serverAddress": r.PrometheusAddress,
+					"query":         query,
+					"threshold":     fmt.Sprint(as.TargetPendingTasks),
+				},
+			},
+		},
+	}
+
+	if err := ctrl.SetControllerReference(agent, so, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(scaledObjectKind)
+	err := r.Get(ctx, types.NamespacedName{Name: so.GetName(), Namespace: so.GetNamespace()}, existing)
+	if err != nil && apierrors.IsNotFound(err) {
+		return r.Create(ctx, so)
+	} else if err != nil {
+		return err
+	}
+	so.SetResourceVersion(existing.GetResourceVersion())
+	return r.Update(ctx, so)
+}
+
+// deleteOwned deletes the named object in agent's namespace if agent
+// controls it
+func (r *AgentReconciler) deleteOwned(ctx context.Context, obj client.Object, agent *aiv1alpha1.AIAgent, name string) error {
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: agent.Namespace}, obj)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(obj, agent) {
+		return nil
+	}
+	if err := r.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// controller_client.go - Agent Controller API Client
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// controllerAPI is the agent controller's HTTP API, which memory backups
+// and agent jobs are driven through
+type controllerAPI struct {
+	URL string
+	// Token authenticates the operator to the API
+	Token string
+}
+
+// do sends a request to path and returns the response of a 200 or 201;
+// any other status is an error carrying the start of the body
+func (c controllerAPI) do(ctx context.Context, method, path string, header http.Header, body io.Reader) (*http.Response, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("the agent controller API needs the operator's --controller-url")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, &controllerError{Status: resp.StatusCode, Message: fmt.Sprintf("controller returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))}
+	}
+	return resp, nil
+}
+
+// doJSON sends in, if any, as JSON and decodes the response into out
+func (c controllerAPI) doJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	header := http.Header{}
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+		header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.do(ctx, method, path, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("malformed controller response: %w", err)
+	}
+	return nil
+}
+
+// controllerError is a request the controller refused
+type controllerError struct {
+	Status  int
+	Message string
+}
+
+func (e *controllerError) Error() string { return e.Message }
@@ -0,0 +1,373 @@
+// memorybackup.go - Scheduled Agent Memory Backups to Object Storage
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+const (
+	backupController = "memorybackup"
+
+	// archiveRecordsTrailer is how the agent controller's memory export
+	// API reports a completed export
+	archiveRecordsTrailer = "X-Archive-Records"
+
+	archiveSuffix = ".nzmem"
+)
+
+// MemoryBackupReconciler exports agents' memory on each MemoryBackup's
+// schedule, prunes archives past its retention and restores the archive
+// it names. Archives are sealed by the agent controller under its archive
+// key for the tenant; the operator and the bucket only ever see
+// ciphertext.
+type MemoryBackupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Controller is the agent controller API memory is exported from and
+	// restored through
+	Controller controllerAPI
+}
+
+// +kubebuilder:rbac:groups=ai.nuzon.io,resources=memorybackups,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=ai.nuzon.io,resources=memorybackups/status,verbs=get;update;patch
+
+func (r *MemoryBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&aiv1alpha1.MemoryBackup{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrent}).
+		Complete(r)
+}
+
+func (r *MemoryBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := startReconcile(ctx, backupController, req)
+	defer func() { endReconcile(span, backupController, result, err) }()
+
+	var backup aiv1alpha1.MemoryBackup
+	if err := r.Get(ctx, req.NamespacedName, &backup); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	annotateSpan(span, &backup)
+	// archives outlive the MemoryBackup that took them
+	if !backup.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	schedule, err := cron.ParseStandard(backup.Spec.Schedule)
+	if err != nil {
+		// retrying cannot fix the spec; its next edit reconciles again
+		r.Recorder.Eventf(&backup, corev1.EventTypeWarning, "InvalidSchedule", "Schedule %q: %v", backup.Spec.Schedule, err)
+		return ctrl.Result{}, nil
+	}
+
+	patch := client.MergeFrom(backup.DeepCopy())
+	target, err := r.openTarget(ctx, &backup)
+	if err != nil {
+		r.setBackupCondition(&backup, metav1.ConditionFalse, "TargetUnavailable", err.Error())
+		if perr := r.Status().Patch(ctx, &backup, patch); perr != nil {
+			return ctrl.Result{}, perr
+		}
+		return ctrl.Result{}, err
+	}
+
+	if target.restorePending() {
+		phaseCtx, end := startPhase(ctx, backupController, "restore")
+		err = target.restore(phaseCtx)
+		end(err)
+		if err != nil {
+			r.Recorder.Eventf(&backup, corev1.EventTypeWarning, "RestoreFailed", "Restoring %s: %v", backup.Spec.Restore.Snapshot, err)
+		} else {
+			r.Recorder.Eventf(&backup, corev1.EventTypeNormal, "Restored", "Restored %d memories from %s",
+				backup.Status.Restore.Imported, backup.Spec.Restore.Snapshot)
+		}
+		if perr := r.Status().Patch(ctx, &backup, patch); perr != nil {
+			return ctrl.Result{}, perr
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		patch = client.MergeFrom(backup.DeepCopy())
+	}
+
+	// a backup missed while the operator was down is taken once, on start
+	now := time.Now()
+	last := backup.CreationTimestamp.Time
+	if backup.Status.LastBackupTime != nil {
+		last = backup.Status.LastBackupTime.Time
+	}
+	next := schedule.Next(last)
+	if !backup.Spec.Suspend && !now.Before(next) {
+		phaseCtx, end := startPhase(ctx, backupController, "export")
+		snapshot, err := target.export(phaseCtx, now)
+		end(err)
+		if err != nil {
+			r.Recorder.Eventf(&backup, corev1.EventTypeWarning, "BackupFailed", "Exporting memory of %s: %v", backup.Spec.AgentName, err)
+			r.setBackupCondition(&backup, metav1.ConditionFalse, "BackupFailed", err.Error())
+			if perr := r.Status().Patch(ctx, &backup, patch); perr != nil {
+				return ctrl.Result{}, perr
+			}
+			return ctrl.Result{}, err
+		}
+		backup.Status.Snapshots = append([]aiv1alpha1.MemorySnapshot{snapshot}, backup.Status.Snapshots...)
+		backup.Status.LastBackupTime = &metav1.Time{Time: now}
+		r.setBackupCondition(&backup, metav1.ConditionTrue, "BackupSucceeded",
+			fmt.Sprintf("%d memories archived to %s", snapshot.Records, snapshot.Key))
+
+		phaseCtx, end = startPhase(ctx, backupController, "retention")
+		err = target.prune(phaseCtx)
+		end(err)
+		if err != nil {
+			// the archives stay listed and are pruned after the next backup
+			r.Recorder.Eventf(&backup, corev1.EventTypeWarning, "PruneFailed", "Deleting expired archives: %v", err)
+		}
+		next = schedule.Next(now)
+	}
+
+	backup.Status.NextBackupTime = nil
+	if !backup.Spec.Suspend {
+		backup.Status.NextBackupTime = &metav1.Time{Time: next}
+	}
+	if err := r.Status().Patch(ctx, &backup, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+	if backup.Spec.Suspend {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: time.Until(next)}, nil
+}
+
+func (r *MemoryBackupReconciler) setBackupCondition(backup *aiv1alpha1.MemoryBackup, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&backup.Status.Conditions, metav1.Condition{
+		Type:               "Ready",
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: backup.Generation,
+	})
+}
+
+// backupTarget is one MemoryBackup with the agent and bucket it
+// resolved to
+type backupTarget struct {
+	r      *MemoryBackupReconciler
+	backup *aiv1alpha1.MemoryBackup
+	s3     *s3.Client
+}
+
+// openTarget checks the agent exists in the MemoryBackup's namespace,
+// the one tenant it may back up, and reads the bucket credentials
+func (r *MemoryBackupReconciler) openTarget(ctx context.Context, backup *aiv1alpha1.MemoryBackup) (*backupTarget, error) {
+	if r.Controller.URL == "" {
+		return nil, fmt.Errorf("memory backups need the operator's --controller-url")
+	}
+	var agent aiv1alpha1.AIAgent
+	if err := r.Get(ctx, types.NamespacedName{Name: backup.Spec.AgentName, Namespace: backup.Namespace}, &agent); err != nil {
+		return nil, fmt.Errorf("agent %s: %w", backup.Spec.AgentName, err)
+	}
+
+	dest := backup.Spec.Destination
+	var opts []func(*config.LoadOptions) error
+	if dest.Region != "" {
+		opts = append(opts, config.WithRegion(dest.Region))
+	}
+	if dest.CredentialsSecret != "" {
+		var creds corev1.Secret
+		if err := r.Get(ctx, types.NamespacedName{Name: dest.CredentialsSecret, Namespace: backup.Namespace}, &creds); err != nil {
+			return nil, fmt.Errorf("bucket credentials: %w", err)
+		}
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			string(creds.Data["AWS_ACCESS_KEY_ID"]),
+			string(creds.Data["AWS_SECRET_ACCESS_KEY"]),
+			string(creds.Data["AWS_SESSION_TOKEN"]))))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("bucket credentials: %w", err)
+	}
+	s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if dest.Endpoint != "" {
+			o.BaseEndpoint = aws.String(dest.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &backupTarget{r: r, backup: backup, s3: s3Client}, nil
+}
+
+// restorePending reports whether spec.restore names an archive not yet
+// restored. Failed restores are retried until the restore is removed.
+func (t *backupTarget) restorePending() bool {
+	spec, status := t.backup.Spec.Restore, t.backup.Status.Restore
+	if spec == nil || spec.Snapshot == "" {
+		return false
+	}
+	return status == nil || status.Snapshot != spec.Snapshot || status.Phase == aiv1alpha1.RestoreFailed
+}
+
+// export streams a new archive from the controller straight into the
+// bucket
+func (t *backupTarget) export(ctx context.Context, now time.Time) (aiv1alpha1.MemorySnapshot, error) {
+	backup := t.backup
+	objectKey := path.Join(backup.Spec.Destination.Prefix, backup.Namespace, backup.Spec.AgentName,
+		now.UTC().Format("20060102T150405Z")+archiveSuffix)
+
+	resp, err := t.controllerRequest(ctx, http.MethodGet, "memory/export", nil)
+	if err != nil {
+		return aiv1alpha1.MemorySnapshot{}, err
+	}
+	defer resp.Body.Close()
+
+	body := &countingReader{r: resp.Body}
+	if _, err := manager.NewUploader(t.s3).Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(backup.Spec.Destination.Bucket),
+		Key:         aws.String(objectKey),
+		Body:        body,
+		ContentType: aws.String("application/octet-stream"),
+	}); err != nil {
+		return aiv1alpha1.MemorySnapshot{}, fmt.Errorf("upload to %s failed: %w", objectKey, err)
+	}
+
+	// the trailer is only sent once the controller wrote the whole archive
+	records, err := strconv.ParseInt(resp.Trailer.Get(archiveRecordsTrailer), 10, 32)
+	if err != nil {
+		t.deleteObject(ctx, objectKey)
+		return aiv1alpha1.MemorySnapshot{}, fmt.Errorf("export of %s ended early", backup.Spec.AgentName)
+	}
+	return aiv1alpha1.MemorySnapshot{
+		Key:     objectKey,
+		Time:    metav1.Time{Time: now},
+		Records: int32(records),
+		Size:    body.n,
+	}, nil
+}
+
+// restore imports the archive spec.restore names into the agent and
+// records the outcome in status.restore
+func (t *backupTarget) restore(ctx context.Context) error {
+	backup := t.backup
+	snapshot := backup.Spec.Restore.Snapshot
+	err := func() error {
+		obj, err := t.s3.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(backup.Spec.Destination.Bucket),
+			Key:    aws.String(snapshot),
+		})
+		if err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+		defer obj.Body.Close()
+
+		resp, err := t.controllerRequest(ctx, http.MethodPost, "memory/import", obj.Body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var result struct {
+			Imported int32
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("malformed import response: %w", err)
+		}
+		backup.Status.Restore = &aiv1alpha1.MemoryRestoreStatus{
+			Snapshot: snapshot,
+			Phase:    aiv1alpha1.RestoreCompleted,
+			Imported: result.Imported,
+		}
+		return nil
+	}()
+	if err != nil {
+		backup.Status.Restore = &aiv1alpha1.MemoryRestoreStatus{
+			Snapshot: snapshot,
+			Phase:    aiv1alpha1.RestoreFailed,
+			Message:  err.Error(),
+		}
+	}
+	backup.Status.Restore.CompletedAt = &metav1.Time{Time: time.Now()}
+	return err
+}
+
+// prune deletes the archives past the retention. The newest archive is
+// kept regardless; archives whose deletion fails stay listed.
+func (t *backupTarget) prune(ctx context.Context) error {
+	retention := t.backup.Spec.Retention
+	snapshots := t.backup.Status.Snapshots
+	if len(snapshots) == 0 {
+		return nil
+	}
+	kept := []aiv1alpha1.MemorySnapshot{snapshots[0]}
+	var firstErr error
+	for _, snap := range snapshots[1:] {
+		expired := retention.KeepLast != nil && int32(len(kept)) >= *retention.KeepLast ||
+			retention.MaxAge != nil && time.Since(snap.Time.Time) > retention.MaxAge.Duration
+		if !expired {
+			kept = append(kept, snap)
+			continue
+		}
+		if err := t.deleteObject(ctx, snap.Key); err != nil {
+			kept = append(kept, snap)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	t.backup.Status.Snapshots = kept
+	return firstErr
+}
+
+func (t *backupTarget) deleteObject(ctx context.Context, key string) error {
+	_, err := t.s3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(t.backup.Spec.Destination.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// controllerRequest calls the controller's memory API of the agent.
+// The AIAgent's name is its agent ID.
+func (t *backupTarget) controllerRequest(ctx context.Context, method, action string, body io.Reader) (*http.Response, error) {
+	header := http.Header{}
+	if body != nil {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	return t.r.Controller.do(ctx, method, "/api/agents/"+url.PathEscape(t.backup.Spec.AgentName)+"/"+action, header, body)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
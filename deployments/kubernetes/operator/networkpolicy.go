@@ -0,0 +1,162 @@
+// networkpolicy.go - Default-Deny Network Policies for Agents
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+// namespaceNameLabel is set on every namespace by the API server
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+
+// networkPeer is a set of pods agents must be able to talk to
+type networkPeer struct {
+	Namespace string
+	Selector  *metav1.LabelSelector
+}
+
+// parseNetworkPeer reads a peer given by namespace and pod label selector
+func parseNetworkPeer(namespace, selector string) (networkPeer, error) {
+	sel, err := metav1.ParseToLabelSelector(selector)
+	if err != nil {
+		return networkPeer{}, fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	return networkPeer{Namespace: namespace, Selector: sel}, nil
+}
+
+func (p networkPeer) policyPeer() networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{
+		PodSelector: p.Selector,
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{namespaceNameLabel: p.Namespace},
+		},
+	}
+}
+
+// ensureNetworkPolicy confines the agent's pods to the controller, NATS,
+// cluster DNS and the endpoints of spec.egress. Only the controller may
+// connect to them, and Prometheus to the metrics port of agents it
+// scrapes.
+func (r *AgentReconciler) ensureNetworkPolicy(ctx context.Context, agent *aiv1alpha1.AIAgent) error {
+	egress, err := egressRules(agent.Spec.Egress)
+	if err != nil {
+		return err
+	}
+	udp, tcp := corev1.ProtocolUDP, corev1.ProtocolTCP
+	dns := intstr.FromInt(53)
+	egress = append([]networkingv1.NetworkPolicyEgressRule{
+		{To: []networkingv1.NetworkPolicyPeer{r.ControllerPeer.policyPeer()}},
+		{To: []networkingv1.NetworkPolicyPeer{r.NATSPeer.policyPeer()}},
+		{
+			To: []networkingv1.NetworkPolicyPeer{{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{namespaceNameLabel: metav1.NamespaceSystem},
+				},
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"k8s-app": "kube-dns"},
+				},
+			}},
+			Ports: []networkingv1.NetworkPolicyPort{
+				{Protocol: &udp, Port: &dns},
+				{Protocol: &tcp, Port: &dns},
+			},
+		},
+	}, egress...)
+
+	ingress := []networkingv1.NetworkPolicyIngressRule{
+		{From: []networkingv1.NetworkPolicyPeer{r.ControllerPeer.policyPeer()}},
+	}
+	if t := agent.Spec.Telemetry; t != nil {
+		if peer := r.Telemetry.CollectorPeer; peer != nil {
+			egress = append(egress, networkingv1.NetworkPolicyEgressRule{
+				To: []networkingv1.NetworkPolicyPeer{peer.policyPeer()},
+			})
+		}
+		if scrapeEnabled(t) {
+			port := intstr.FromInt(int(metricsPort(t)))
+			ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{
+				From: []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{namespaceNameLabel: r.Telemetry.MonitoringNamespace},
+					},
+				}},
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port}},
+			})
+		}
+	}
+
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      agent.Name,
+			Namespace: agent.Namespace,
+			Labels:    agentLabels(agent),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: agentLabels(agent)},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Ingress:     ingress,
+			Egress:      egress,
+		},
+	}
+
+	if err := ctrl.SetControllerReference(agent, policy, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &networkingv1.NetworkPolicy{}
+	err = r.Get(ctx, types.NamespacedName{Name: policy.Name, Namespace: policy.Namespace}, existing)
+	if err != nil && apierrors.IsNotFound(err) {
+		return r.Create(ctx, policy)
+	} else if err != nil {
+		return err
+	}
+	policy.ResourceVersion = existing.ResourceVersion
+	return r.Update(ctx, policy)
+}
+
+// egressRules translates spec.egress into NetworkPolicy rules
+func egressRules(rules []aiv1alpha1.EgressRule) ([]networkingv1.NetworkPolicyEgressRule, error) {
+	out := make([]networkingv1.NetworkPolicyEgressRule, 0, len(rules))
+	for _, rule := range rules {
+		var peer networkingv1.NetworkPolicyPeer
+		switch {
+		case rule.CIDR != "" && (rule.PodSelector != nil || rule.NamespaceSelector != nil):
+			return nil, fmt.Errorf("egress %s sets both a CIDR and selectors", rule.Name)
+		case rule.CIDR != "":
+			if _, _, err := net.ParseCIDR(rule.CIDR); err != nil {
+				return nil, fmt.Errorf("egress %s: %w", rule.Name, err)
+			}
+			peer.IPBlock = &networkingv1.IPBlock{CIDR: rule.CIDR}
+		case rule.PodSelector != nil || rule.NamespaceSelector != nil:
+			peer.PodSelector = rule.PodSelector
+			peer.NamespaceSelector = rule.NamespaceSelector
+		default:
+			return nil, fmt.Errorf("egress %s sets neither a CIDR nor selectors", rule.Name)
+		}
+
+		egress := networkingv1.NetworkPolicyEgressRule{To: []networkingv1.NetworkPolicyPeer{peer}}
+		for _, p := range rule.Ports {
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = corev1.ProtocolTCP
+			}
+			port := intstr.FromInt(int(p.Port))
+			egress.Ports = append(egress.Ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+		}
+		out = append(out, egress)
+	}
+	return out, nil
+}
@@ -0,0 +1,135 @@
+// observability.go - Reconciler Metrics and Tracing
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	agentController = "aiagent"
+	poolController  = "agentpool"
+)
+
+var (
+	reconcilePhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "Wavine_operator_reconcile_phase_duration_seconds",
+		Help:    "Time spent in each reconcile phase",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 9),
+	}, []string{"controller", "phase", "outcome"})
+
+	reconcileRequeues = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_operator_requeues_total",
+		Help: "Reconciles that ended in a requeue, by reason",
+	}, []string{"controller", "reason"})
+)
+
+func init() {
+	// the manager serves this registry at MetricsBindAddress
+	metrics.Registry.MustRegister(reconcilePhaseDuration, reconcileRequeues)
+}
+
+var tracer = otel.Tracer("agent-operator")
+
+// setupTracing exports spans over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT
+// is set; the returned func flushes them on exit
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("nuzon-agent-operator"))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// startReconcile opens the span of one reconcile of req and puts its
+// trace ID on the context's logger, so log lines and spans of a slow or
+// looping reconcile can be matched up
+func startReconcile(ctx context.Context, controller string, req ctrl.Request) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, controller+".Reconcile", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("nuzon.resource.name", req.Name),
+	))
+	if sc := span.SpanContext(); sc.IsValid() {
+		ctx = ctrl.LoggerInto(ctx, ctrl.LoggerFrom(ctx).WithValues("trace_id", sc.TraceID().String()))
+	}
+	return ctx, span
+}
+
+// annotateSpan links the reconcile span to the resource it loaded. The
+// UID tells apart resources deleted and recreated under one name.
+func annotateSpan(span trace.Span, obj metav1.Object) {
+	span.SetAttributes(
+		attribute.String("nuzon.resource.uid", string(obj.GetUID())),
+		attribute.Int64("nuzon.resource.generation", obj.GetGeneration()),
+	)
+}
+
+// startPhase times one reconcile phase as a child span; call the
+// returned func with the phase's error when it ends
+func startPhase(ctx context.Context, controller, phase string) (context.Context, func(error)) {
+	ctx, span := tracer.Start(ctx, controller+"."+phase)
+	start := time.Now()
+	return ctx, func(err error) {
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		reconcilePhaseDuration.WithLabelValues(controller, phase, outcome).Observe(time.Since(start).Seconds())
+		span.End()
+	}
+}
+
+// endReconcile records why the reconcile will run again, if it will,
+// and closes its span
+func endReconcile(span trace.Span, controller string, result ctrl.Result, err error) {
+	reason := ""
+	switch {
+	case apierrors.IsConflict(err):
+		// a stale read; frequent conflicts mean two writers fight over
+		// one object
+		reason = "conflict"
+	case err != nil:
+		reason = "error"
+	case result.Requeue:
+		reason = "requested"
+	case result.RequeueAfter > 0:
+		reason = "resync"
+	}
+	if reason != "" {
+		reconcileRequeues.WithLabelValues(controller, reason).Inc()
+		span.SetAttributes(attribute.String("nuzon.requeue.reason", reason))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
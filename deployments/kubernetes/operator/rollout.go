@@ -0,0 +1,389 @@
+// rollout.go - Canary and Blue/Green Rollouts of Agent Deployments
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+const (
+	// templateHashKey on an agent's Deployment identifies the pod template
+	// it runs
+	templateHashKey = "agent.Wavine.ai/template-hash"
+	// trackKey labels the pods of a rollout's candidate ReplicaSet
+	trackKey = "agent.Wavine.ai/track"
+
+	defaultStepDuration = 5 * time.Minute
+	defaultMaxErrorRate = 0.05
+	analysisTimeout     = 10 * time.Second
+
+	defaultErrorRateQuery = `sum(rate(Wavine_nats_messages_failed_total{pod=~"$POD"}[5m])) / sum(rate(Wavine_nats_messages_delivered_total{pod=~"$POD"}[5m]))`
+	defaultLatencyQuery   = `histogram_quantile(0.95, sum by (le) (rate(Wavine_nats_rpc_duration_seconds_bucket{pod=~"$POD"}[5m])))`
+)
+
+var defaultCanarySteps = []int32{10, 25, 50}
+
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch;create;update;patch;delete
+
+// templateHash identifies a pod template
+func templateHash(tmpl corev1.PodTemplateSpec) string {
+	data, _ := json.Marshal(tmpl)
+	h := fnv.New64a()
+	h.Write(data)
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// progressive reports whether template changes of agent go through a
+// canary or blue/green rollout
+func progressive(agent *aiv1alpha1.AIAgent) bool {
+	rs := agent.Spec.RolloutStrategy
+	return rs != nil && (rs.Type == aiv1alpha1.CanaryRollout || rs.Type == aiv1alpha1.BlueGreenRollout)
+}
+
+func candidateName(agent *aiv1alpha1.AIAgent) string {
+	return agent.Name + "-candidate"
+}
+
+// guardRollout runs before the agent's Deployment is updated to desired.
+// It returns true while a rollout holds the Deployment at its stable
+// template; false lets the update through, either because there is
+// nothing to roll out or because the candidate was just promoted.
+func (r *AgentReconciler) guardRollout(ctx context.Context, agent *aiv1alpha1.AIAgent, existing, desired *appsv1.Deployment) (bool, error) {
+	stableHash := existing.Annotations[templateHashKey]
+	candidateHash := desired.Annotations[templateHashKey]
+	st := agent.Status.Rollout
+
+	if !progressive(agent) || stableHash == "" || stableHash == candidateHash {
+		// the candidate serves until the promoted Deployment has fully
+		// replaced its pods
+		if deploymentComplete(existing) {
+			if err := r.deleteOwned(ctx, &appsv1.ReplicaSet{}, agent, candidateName(agent)); err != nil {
+				return false, err
+			}
+		}
+		if st != nil && st.Phase == aiv1alpha1.RolloutProgressing && st.CandidateHash != stableHash {
+			r.setRollout(ctx, agent, func(st *aiv1alpha1.RolloutStatus) {
+				st.Phase = aiv1alpha1.RolloutRolledBack
+				st.Message = "candidate superseded by a spec change"
+			})
+		}
+		return false, nil
+	}
+
+	if st != nil && st.CandidateHash == candidateHash {
+		switch st.Phase {
+		case aiv1alpha1.RolloutRolledBack:
+			// a rejected template stays out until the spec changes again
+			return true, nil
+		case aiv1alpha1.RolloutPromoted:
+			// promoted, but the Deployment update did not go through
+			return false, nil
+		}
+	}
+	if st == nil || st.CandidateHash != candidateHash {
+		now := metav1.Now()
+		r.setRollout(ctx, agent, func(st *aiv1alpha1.RolloutStatus) {
+			*st = aiv1alpha1.RolloutStatus{
+				Phase:         aiv1alpha1.RolloutProgressing,
+				StableHash:    stableHash,
+				CandidateHash: candidateHash,
+				StepStartedAt: &now,
+			}
+		})
+		r.Recorder.Eventf(agent, corev1.EventTypeNormal, "RolloutStarted",
+			"%s rollout of template %s started", agent.Spec.RolloutStrategy.Type, candidateHash)
+		st = agent.Status.Rollout
+	}
+
+	strategy := agent.Spec.RolloutStrategy
+	steps := strategy.Steps
+	if len(steps) == 0 {
+		steps = defaultCanarySteps
+	}
+	total, err := r.rolloutTotal(ctx, agent, existing)
+	if err != nil {
+		return true, err
+	}
+	candidateReplicas, stableReplicas := total, total
+	if strategy.Type == aiv1alpha1.CanaryRollout {
+		i := int(st.Step)
+		if i >= len(steps) {
+			i = len(steps) - 1
+		}
+		step := steps[i]
+		candidateReplicas = int32(math.Ceil(float64(total) * float64(step) / 100))
+		stableReplicas = total - candidateReplicas
+	}
+
+	candidate, err := r.ensureCandidate(ctx, agent, desired, candidateReplicas)
+	if err != nil {
+		return true, fmt.Errorf("failed to manage candidate: %w", err)
+	}
+	if existing.Spec.Replicas == nil || *existing.Spec.Replicas != stableReplicas {
+		patch := client.MergeFrom(existing.DeepCopy())
+		existing.Spec.Replicas = &stableReplicas
+		if err := r.Patch(ctx, existing, patch); err != nil {
+			return true, err
+		}
+	}
+
+	stepDuration := defaultStepDuration
+	if strategy.StepDuration != nil {
+		stepDuration = strategy.StepDuration.Duration
+	}
+	if candidate.Status.ReadyReplicas < candidateReplicas || time.Since(st.StepStartedAt.Time) < stepDuration {
+		return true, nil
+	}
+
+	healthy, reason, err := r.analyze(ctx, agent)
+	if err != nil {
+		r.Recorder.Eventf(agent, corev1.EventTypeWarning, "AnalysisFailed", "Rollout analysis failed: %v", err)
+		return true, nil
+	}
+	if !healthy {
+		if err := r.deleteOwned(ctx, &appsv1.ReplicaSet{}, agent, candidateName(agent)); err != nil {
+			return true, err
+		}
+		patch := client.MergeFrom(existing.DeepCopy())
+		existing.Spec.Replicas = &total
+		if err := r.Patch(ctx, existing, patch); err != nil {
+			return true, err
+		}
+		r.setRollout(ctx, agent, func(st *aiv1alpha1.RolloutStatus) {
+			st.Phase = aiv1alpha1.RolloutRolledBack
+			st.Message = reason
+		})
+		r.Recorder.Eventf(agent, corev1.EventTypeWarning, "RolloutRolledBack",
+			"Template %s rolled back: %s", candidateHash, reason)
+		return true, nil
+	}
+
+	if strategy.Type == aiv1alpha1.CanaryRollout && int(st.Step) < len(steps)-1 {
+		now := metav1.Now()
+		r.setRollout(ctx, agent, func(st *aiv1alpha1.RolloutStatus) {
+			st.Step++
+			st.StepStartedAt = &now
+			st.Message = ""
+		})
+		r.Recorder.Eventf(agent, corev1.EventTypeNormal, "RolloutStepAdvanced",
+			"Canary advanced to %d%%", steps[st.Step])
+		return true, nil
+	}
+
+	r.setRollout(ctx, agent, func(st *aiv1alpha1.RolloutStatus) {
+		st.Phase = aiv1alpha1.RolloutPromoted
+		st.Message = ""
+	})
+	r.Recorder.Eventf(agent, corev1.EventTypeNormal, "RolloutPromoted", "Template %s promoted", candidateHash)
+	desired.Spec.Replicas = &total
+	return false, nil
+}
+
+// rolloutTotal is how many replicas the agent should run across the
+// stable Deployment and the candidate
+func (r *AgentReconciler) rolloutTotal(ctx context.Context, agent *aiv1alpha1.AIAgent, existing *appsv1.Deployment) (int32, error) {
+	if agent.Spec.Autoscaling == nil {
+		if agent.Spec.Replicas != nil {
+			return *agent.Spec.Replicas, nil
+		}
+		return 1, nil
+	}
+	// an autoscaled agent keeps what it has; the split moves replicas
+	// between the two without changing the sum
+	var total int32
+	if existing.Spec.Replicas != nil {
+		total = *existing.Spec.Replicas
+	}
+	candidate := &appsv1.ReplicaSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: candidateName(agent), Namespace: agent.Namespace}, candidate)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return 0, err
+	}
+	if err == nil && candidate.Spec.Replicas != nil {
+		total += *candidate.Spec.Replicas
+	}
+	if floor := minReplicas(agent.Spec.Autoscaling); total < floor {
+		total = floor
+	}
+	return total, nil
+}
+
+// ensureCandidate runs desired's pod template in the candidate
+// ReplicaSet at the given size, replacing a candidate of an older template
+func (r *AgentReconciler) ensureCandidate(ctx context.Context, agent *aiv1alpha1.AIAgent, desired *appsv1.Deployment, replicas int32) (*appsv1.ReplicaSet, error) {
+	track := "canary"
+	if agent.Spec.RolloutStrategy.Type == aiv1alpha1.BlueGreenRollout {
+		track = "preview"
+	}
+	selector := make(map[string]string)
+	for k, v := range agentLabels(agent) {
+		selector[k] = v
+	}
+	selector[trackKey] = track
+
+	template := *desired.Spec.Template.DeepCopy()
+	for k, v := range selector {
+		template.Labels[k] = v
+	}
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        candidateName(agent),
+			Namespace:   agent.Namespace,
+			Labels:      agentLabels(agent),
+			Annotations: map[string]string{templateHashKey: desired.Annotations[templateHashKey]},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: template,
+		},
+	}
+	if err := ctrl.SetControllerReference(agent, rs, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	existing := &appsv1.ReplicaSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: rs.Name, Namespace: rs.Namespace}, existing)
+	if err != nil && apierrors.IsNotFound(err) {
+		return rs, r.Create(ctx, rs)
+	} else if err != nil {
+		return nil, err
+	}
+	if existing.Annotations[templateHashKey] != rs.Annotations[templateHashKey] {
+		// a ReplicaSet does not replace its pods when its template
+		// changes; the next pass creates the new candidate
+		if err := r.Delete(ctx, existing); err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		return rs, nil
+	}
+	patch := client.MergeFrom(existing.DeepCopy())
+	existing.Spec.Replicas = &replicas
+	return existing, r.Patch(ctx, existing, patch)
+}
+
+// analyze judges the candidate's pods against the strategy's thresholds
+func (r *AgentReconciler) analyze(ctx context.Context, agent *aiv1alpha1.AIAgent) (bool, string, error) {
+	if r.PrometheusAddress == "" {
+		return false, "", fmt.Errorf("rollout analysis needs the operator's --prometheus-address")
+	}
+	analysis := agent.Spec.RolloutStrategy.Analysis
+	if analysis == nil {
+		analysis = &aiv1alpha1.RolloutAnalysis{}
+	}
+	pods := candidateName(agent) + "-.*"
+
+	errorQuery := analysis.ErrorRateQuery
+	if errorQuery == "" {
+		errorQuery = defaultErrorRateQuery
+	}
+	maxErrorRate := defaultMaxErrorRate
+	if analysis.MaxErrorRate != nil {
+		maxErrorRate = analysis.MaxErrorRate.AsApproximateFloat64()
+	}
+	errorRate, ok, err := r.queryPrometheus(ctx, strings.ReplaceAll(errorQuery, "$POD", pods))
+	if err != nil {
+		return false, "", err
+	}
+	if ok && errorRate > maxErrorRate {
+		return false, fmt.Sprintf("error rate %.4f exceeds %.4f", errorRate, maxErrorRate), nil
+	}
+
+	if analysis.MaxLatency != nil {
+		latencyQuery := analysis.LatencyQuery
+		if latencyQuery == "" {
+			latencyQuery = defaultLatencyQuery
+		}
+		latency, ok, err := r.queryPrometheus(ctx, strings.ReplaceAll(latencyQuery, "$POD", pods))
+		if err != nil {
+			return false, "", err
+		}
+		if limit := analysis.MaxLatency.Seconds(); ok && latency > limit {
+			return false, fmt.Sprintf("latency %.3fs exceeds %.3fs", latency, limit), nil
+		}
+	}
+	// a candidate without samples has had no work to fail at
+	return true, "", nil
+}
+
+// queryPrometheus runs an instant query and returns its first sample;
+// ok is false when the result is empty or not a number
+func (r *AgentReconciler) queryPrometheus(ctx context.Context, query string) (float64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, analysisTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(r.PrometheusAddress, "/")+"/api/v1/query?query="+url.QueryEscape(query), nil)
+	if err != nil {
+		return 0, false, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("prometheus returned %s", resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Result []struct {
+				Value [2]interface{} `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, false, fmt.Errorf("malformed prometheus response: %w", err)
+	}
+	if len(body.Data.Result) == 0 {
+		return 0, false, nil
+	}
+	raw, _ := body.Data.Result[0].Value[1].(string)
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false, nil
+	}
+	return v, true, nil
+}
+
+// setRollout changes the agent's rollout status and saves it
+func (r *AgentReconciler) setRollout(ctx context.Context, agent *aiv1alpha1.AIAgent, change func(*aiv1alpha1.RolloutStatus)) {
+	patch := client.MergeFrom(agent.DeepCopy())
+	if agent.Status.Rollout == nil {
+		agent.Status.Rollout = &aiv1alpha1.RolloutStatus{}
+	}
+	change(agent.Status.Rollout)
+	if err := r.Status().Patch(ctx, agent, patch); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to save rollout status")
+	}
+}
+
+// deploymentComplete reports whether every replica of d runs its current
+// template and is available
+func deploymentComplete(d *appsv1.Deployment) bool {
+	want := int32(1)
+	if d.Spec.Replicas != nil {
+		want = *d.Spec.Replicas
+	}
+	return d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.UpdatedReplicas == want &&
+		d.Status.AvailableReplicas == want
+}
@@ -0,0 +1,94 @@
+// scope.go - Namespace and Label Scoping of the Operator's Watches
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+// watchScope limits what one operator instance manages, so several can
+// share a cluster. Instances must not overlap: two operators reconciling
+// the same AIAgent fight over its workload.
+type watchScope struct {
+	// namespaces is empty to watch the whole cluster
+	namespaces []string
+	// selector matches the AIAgents, AgentPools, MemoryBackups and
+	// AgentJobs to manage; nil for all
+	selector labels.Selector
+}
+
+// parseWatchScope reads the --watch-namespaces and --watch-selector flags
+func parseWatchScope(namespaces, selector string) (watchScope, error) {
+	var scope watchScope
+	for _, ns := range strings.Split(namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			scope.namespaces = append(scope.namespaces, ns)
+		}
+	}
+	if selector != "" {
+		sel, err := labels.Parse(selector)
+		if err != nil {
+			return scope, fmt.Errorf("invalid watch selector %q: %w", selector, err)
+		}
+		scope.selector = sel
+	}
+	return scope, nil
+}
+
+// newCache builds the manager's cache for the scope. The selector only
+// applies to the operator's own resources; their children carry the
+// agent's labels rather than the user's and are narrowed by namespace.
+func (s watchScope) newCache() cache.NewCacheFunc {
+	var byObject cache.SelectorsByObject
+	if s.selector != nil {
+		byObject = cache.SelectorsByObject{
+			&aiv1alpha1.AIAgent{}:      {Label: s.selector},
+			&aiv1alpha1.AgentPool{}:    {Label: s.selector},
+			&aiv1alpha1.MemoryBackup{}: {Label: s.selector},
+			&aiv1alpha1.AgentJob{}:     {Label: s.selector},
+		}
+	}
+	if len(s.namespaces) == 0 {
+		return cache.BuilderWithOptions(cache.Options{SelectorsByObject: byObject})
+	}
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		opts.SelectorsByObject = byObject
+		return cache.MultiNamespacedCacheBuilder(s.namespaces)(config, opts)
+	}
+}
+
+// String describes the scope for the startup log
+func (s watchScope) String() string {
+	ns := "all namespaces"
+	if len(s.namespaces) > 0 {
+		ns = "namespaces " + strings.Join(s.namespaces, ",")
+	}
+	if s.selector == nil {
+		return ns
+	}
+	return ns + " with labels " + s.selector.String()
+}
+
+// inScope reports whether obj is one this instance manages
+func (s watchScope) inScope(obj client.Object) bool {
+	if len(s.namespaces) > 0 {
+		found := false
+		for _, ns := range s.namespaces {
+			if ns == obj.GetNamespace() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return s.selector == nil || s.selector.Matches(labels.Set(obj.GetLabels()))
+}
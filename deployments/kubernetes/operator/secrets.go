@@ -0,0 +1,214 @@
+// secrets.go - External Secrets Injection from Vault and ESO
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+const (
+	// secretsHashKey on the pod template changes whenever a mounted
+	// secret's content does, rolling the pods onto the rotated values
+	secretsHashKey = "agent.Wavine.ai/secrets-hash"
+
+	agentSecretsVolume    = "agent-secrets"
+	agentSecretsMountPath = "/var/run/secrets/agent"
+	defaultVaultRefresh   = "1h"
+)
+
+var externalSecretKind = schema.GroupVersionKind{Group: "external-secrets.io", Version: "v1beta1", Kind: "ExternalSecret"}
+
+// +kubebuilder:rbac:groups=external-secrets.io,resources=externalsecrets,verbs=get;list;watch;create;update;patch;delete
+
+// agentSecrets are the synced Secrets an agent's pods mount
+type agentSecrets struct {
+	sources []aiv1alpha1.SecretSource
+	// secrets holds the Secret synced for each source, in source order
+	secrets []*corev1.Secret
+}
+
+// ensureSecrets creates the ExternalSecrets of the agent's Vault sources
+// and returns the Secrets every source has been synced into. A source
+// whose Secret does not exist yet fails the reconcile until it does.
+// Rotations are read on the periodic requeue.
+func (r *AgentReconciler) ensureSecrets(ctx context.Context, agent *aiv1alpha1.AIAgent) (*agentSecrets, error) {
+	out := &agentSecrets{sources: agent.Spec.Secrets}
+	for _, src := range agent.Spec.Secrets {
+		var target string
+		switch {
+		case src.Vault != nil && src.ExternalSecret != "":
+			return nil, fmt.Errorf("secret %s sets both vault and externalSecret", src.Name)
+		case src.Vault != nil:
+			target = agent.Name + "-" + src.Name
+			if err := r.ensureVaultExternalSecret(ctx, agent, src, target); err != nil {
+				return nil, fmt.Errorf("secret %s: %w", src.Name, err)
+			}
+		case src.ExternalSecret != "":
+			var err error
+			if target, err = r.externalSecretTarget(ctx, agent.Namespace, src.ExternalSecret); err != nil {
+				return nil, fmt.Errorf("secret %s: %w", src.Name, err)
+			}
+		default:
+			return nil, fmt.Errorf("secret %s sets neither vault nor externalSecret", src.Name)
+		}
+
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: target, Namespace: agent.Namespace}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("secret %s not synced into %s yet", src.Name, target)
+			}
+			return nil, err
+		}
+		out.secrets = append(out.secrets, secret)
+	}
+	return out, nil
+}
+
+// ensureVaultExternalSecret has ESO sync every key under the source's
+// Vault path into a Secret named target, owned by that ExternalSecret
+func (r *AgentReconciler) ensureVaultExternalSecret(ctx context.Context, agent *aiv1alpha1.AIAgent, src aiv1alpha1.SecretSource, target string) error {
+	if r.VaultSecretStore == "" {
+		return fmt.Errorf("vault secrets need the operator's --vault-secret-store")
+	}
+	refresh := defaultVaultRefresh
+	if src.Vault.RefreshInterval != nil {
+		refresh = src.Vault.RefreshInterval.Duration.String()
+	}
+
+	es := &unstructured.Unstructured{}
+	es.SetGroupVersionKind(externalSecretKind)
+	es.SetName(target)
+	es.SetNamespace(agent.Namespace)
+	es.SetLabels(agentLabels(agent))
+	es.Object["spec"] = map[string]interface{}{
+		"refreshInterval": refresh,
+		"secretStoreRef": map[string]interface{}{
+			"kind": "ClusterSecretStore",
+			"name": r.VaultSecretStore,
+		},
+		"target": map[string]interface{}{
+			"name":           target,
+			"creationPolicy": "Owner",
+		},
+		"dataFrom": []interface{}{
+			map[string]interface{}{
+				"extract": map[string]interface{}{"key": src.Vault.Path},
+			},
+		},
+	}
+
+	if err := ctrl.SetControllerReference(agent, es, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(externalSecretKind)
+	err := r.Get(ctx, types.NamespacedName{Name: target, Namespace: agent.Namespace}, existing)
+	if err != nil && apierrors.IsNotFound(err) {
+		return r.Create(ctx, es)
+	} else if err != nil {
+		return err
+	}
+	es.SetResourceVersion(existing.GetResourceVersion())
+	return r.Update(ctx, es)
+}
+
+// externalSecretTarget returns the Secret an ExternalSecret syncs into,
+// which is the ExternalSecret's own name unless its target renames it
+func (r *AgentReconciler) externalSecretTarget(ctx context.Context, namespace, name string) (string, error) {
+	es := &unstructured.Unstructured{}
+	es.SetGroupVersionKind(externalSecretKind)
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, es); err != nil {
+		return "", fmt.Errorf("external secret %s: %w", name, err)
+	}
+	if target, _, _ := unstructured.NestedString(es.Object, "spec", "target", "name"); target != "" {
+		return target, nil
+	}
+	return name, nil
+}
+
+// hash changes whenever any synced value does
+func (s *agentSecrets) hash() string {
+	h := fnv.New64a()
+	for i, secret := range s.secrets {
+		keys := make([]string, 0, len(secret.Data))
+		for k := range secret.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		h.Write([]byte(s.sources[i].Name))
+		for _, k := range keys {
+			h.Write([]byte(k))
+			h.Write(secret.Data[k])
+			h.Write([]byte{0})
+		}
+	}
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// apply mounts the secrets into the agent container of tmpl as one
+// projected volume, <source>/<key> per value, and adds the requested
+// environment variables
+func (s *agentSecrets) apply(tmpl *corev1.PodTemplateSpec) {
+	if s == nil || len(s.secrets) == 0 {
+		return
+	}
+	projected := &corev1.ProjectedVolumeSource{}
+	container := &tmpl.Spec.Containers[0]
+	for i, secret := range s.secrets {
+		src := s.sources[i]
+		keys := make([]string, 0, len(secret.Data))
+		for k := range secret.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := make([]corev1.KeyToPath, len(keys))
+		for j, k := range keys {
+			items[j] = corev1.KeyToPath{Key: k, Path: path.Join(src.Name, k)}
+		}
+		projected.Sources = append(projected.Sources, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name},
+				Items:                items,
+			},
+		})
+		for _, env := range src.Env {
+			container.Env = append(container.Env, corev1.EnvVar{
+				Name: env.Name,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name},
+						Key:                  env.Key,
+					},
+				},
+			})
+		}
+	}
+
+	tmpl.Spec.Volumes = append(tmpl.Spec.Volumes, corev1.Volume{
+		Name:         agentSecretsVolume,
+		VolumeSource: corev1.VolumeSource{Projected: projected},
+	})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      agentSecretsVolume,
+		MountPath: agentSecretsMountPath,
+		ReadOnly:  true,
+	})
+	if tmpl.Annotations == nil {
+		tmpl.Annotations = make(map[string]string)
+	}
+	tmpl.Annotations[secretsHashKey] = s.hash()
+}
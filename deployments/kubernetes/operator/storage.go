@@ -0,0 +1,133 @@
+// storage.go - Persistent Local Storage for Agents
+package main
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+const (
+	agentDataVolume       = "agent-data"
+	defaultAgentMountPath = "/var/lib/agent"
+)
+
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch
+
+// workloadKind is the kind of workload an agent runs as: a StatefulSet
+// when it asks for storage, a Deployment otherwise
+func workloadKind(agent *aiv1alpha1.AIAgent) string {
+	if agent.Spec.Storage != nil {
+		return "StatefulSet"
+	}
+	return "Deployment"
+}
+
+// ensureWorkload applies the agent's workload and removes one of the
+// other kind left from before storage was added or dropped. Volumes of a
+// removed StatefulSet follow its retention policy.
+func (r *AgentReconciler) ensureWorkload(ctx context.Context, agent *aiv1alpha1.AIAgent, configHash string, secrets *agentSecrets) error {
+	if agent.Spec.Storage != nil {
+		if err := r.ensureStatefulSet(ctx, agent, configHash, secrets); err != nil {
+			return err
+		}
+		return r.deleteOwned(ctx, &appsv1.Deployment{}, agent, agent.Name)
+	}
+	if err := r.ensureDeployment(ctx, agent, configHash, secrets); err != nil {
+		return err
+	}
+	return r.deleteOwned(ctx, &appsv1.StatefulSet{}, agent, agent.Name)
+}
+
+func (r *AgentReconciler) ensureStatefulSet(ctx context.Context, agent *aiv1alpha1.AIAgent, configHash string, secrets *agentSecrets) error {
+	storage := agent.Spec.Storage
+	mountPath := storage.MountPath
+	if mountPath == "" {
+		mountPath = defaultAgentMountPath
+	}
+	retention := appsv1.RetainPersistentVolumeClaimRetentionPolicyType
+	if storage.Retention == aiv1alpha1.StorageDelete {
+		retention = appsv1.DeletePersistentVolumeClaimRetentionPolicyType
+	}
+
+	template := podTemplate(agent, configHash)
+	secrets.apply(&template)
+	r.applyTelemetry(agent, &template)
+	r.applyAccelerator(agent, &template)
+	template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts,
+		corev1.VolumeMount{Name: agentDataVolume, MountPath: mountPath})
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      agent.Name,
+			Namespace: agent.Namespace,
+			Labels:    agentLabels(agent),
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    desiredReplicas(agent),
+			ServiceName: agent.Name,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: agentLabels(agent),
+			},
+			// agents share no state between replicas, so they need not
+			// start one at a time
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Template:            template,
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   agentDataVolume,
+					Labels: agentLabels(agent),
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					StorageClassName: storage.StorageClassName,
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: storage.Size},
+					},
+				},
+			}},
+			PersistentVolumeClaimRetentionPolicy: &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenDeleted: retention,
+				WhenScaled:  retention,
+			},
+		},
+	}
+
+	if err := ctrl.SetControllerReference(agent, sts, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: sts.Name, Namespace: sts.Namespace}, existing)
+	if err != nil && apierrors.IsNotFound(err) {
+		return r.Create(ctx, sts)
+	} else if err != nil {
+		return err
+	}
+
+	sts.ResourceVersion = existing.ResourceVersion
+	if agent.Spec.Autoscaling != nil {
+		// the autoscaler owns the replica count once the workload exists
+		sts.Spec.Replicas = existing.Spec.Replicas
+	}
+	// claim templates cannot change; volumes keep the size they were
+	// created with until the StatefulSet is recreated
+	if len(existing.Spec.VolumeClaimTemplates) > 0 {
+		current := existing.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage]
+		if current.Cmp(storage.Size) != 0 {
+			r.Recorder.Eventf(agent, corev1.EventTypeWarning, "StorageImmutable",
+				"Volume size stays %s; delete the StatefulSet with --cascade=orphan to apply %s",
+				current.String(), storage.Size.String())
+		}
+	}
+	sts.Spec.VolumeClaimTemplates = existing.Spec.VolumeClaimTemplates
+	return r.Update(ctx, sts)
+}
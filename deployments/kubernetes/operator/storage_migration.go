@@ -0,0 +1,156 @@
+// storage_migration.go - Storage Version Migration of the Operator's Resources
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=get;update;patch
+
+// migrationRetry is how long a failed migration waits before it runs again
+const migrationRetry = time.Minute
+
+// migratedResources are the CRDs the operator migrates, by plural name
+var migratedResources = []string{"aiagents", "agentpools", "memorybackups", "agentjobs"}
+
+// storageMigration rewrites every stored object of the operator's CRDs
+// in their current storage version, then drops the older versions from
+// the CRDs' storedVersions, so those versions can be removed in a later
+// release. It runs once on the leader after each start; an operator
+// upgrade that changes a storage version thereby migrates existing
+// objects by itself.
+type storageMigration struct {
+	client.Client
+	// APIReader reads CRDs uncached, sparing the operator a watch on them
+	APIReader client.Reader
+	// Namespaces are those of the watch scope; all when empty. The old
+	// versions are only dropped from storedVersions by an operator that
+	// migrated all of them.
+	Namespaces []string
+	// PageSize bounds each list of objects to rewrite
+	PageSize int64
+}
+
+// NeedLeaderElection keeps two operator instances from migrating at once
+func (m *storageMigration) NeedLeaderElection() bool {
+	return true
+}
+
+// Start migrates every resource, retrying until it succeeds or the
+// operator stops
+func (m *storageMigration) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("storage-migration")
+	for {
+		err := m.migrateAll(ctx)
+		if err == nil {
+			return nil
+		}
+		log.Error(err, "storage version migration failed", "retryIn", migrationRetry)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(migrationRetry):
+		}
+	}
+}
+
+func (m *storageMigration) migrateAll(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("storage-migration")
+	for _, plural := range migratedResources {
+		name := plural + "." + aiv1alpha1.GroupVersion.Group
+		var crd apiextensionsv1.CustomResourceDefinition
+		if err := m.APIReader.Get(ctx, types.NamespacedName{Name: name}, &crd); err != nil {
+			return fmt.Errorf("CRD %s: %w", name, err)
+		}
+		storage := storageVersion(&crd)
+		if storage == "" {
+			return fmt.Errorf("CRD %s has no storage version", name)
+		}
+		if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storage {
+			continue
+		}
+
+		log.Info("migrating", "crd", name, "storedVersions", crd.Status.StoredVersions, "to", storage)
+		gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: storage, Kind: crd.Spec.Names.Kind}
+		var n int
+		for _, ns := range m.namespaces() {
+			rewritten, err := m.rewrite(ctx, gvk, ns)
+			n += rewritten
+			if err != nil {
+				return fmt.Errorf("migrating %s: %w", name, err)
+			}
+		}
+		if len(m.Namespaces) > 0 {
+			log.Info("migrated; stored versions are left to a cluster-wide operator", "crd", name, "objects", n)
+			continue
+		}
+
+		// objects created during the rewrite are stored in the storage
+		// version already
+		patch := client.MergeFrom(crd.DeepCopy())
+		crd.Status.StoredVersions = []string{storage}
+		if err := m.Status().Patch(ctx, &crd, patch); err != nil {
+			return fmt.Errorf("updating stored versions of %s: %w", name, err)
+		}
+		log.Info("migrated", "crd", name, "objects", n)
+	}
+	return nil
+}
+
+// rewrite writes every object of gvk back unchanged. The API server
+// stores each write in the storage version, converting it through the
+// conversion webhook where needed.
+func (m *storageMigration) rewrite(ctx context.Context, gvk schema.GroupVersionKind, namespace string) (int, error) {
+	var n int
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	for {
+		err := m.List(ctx, list, client.InNamespace(namespace), client.Limit(m.PageSize), client.Continue(list.GetContinue()))
+		if err != nil {
+			return n, err
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			// an empty patch is a write without a resourceVersion
+			// precondition, so it cannot conflict with the controllers
+			err := m.Patch(ctx, obj, client.RawPatch(types.MergePatchType, []byte("{}")))
+			if client.IgnoreNotFound(err) != nil {
+				return n, fmt.Errorf("%s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+			}
+			n++
+		}
+		if list.GetContinue() == "" {
+			return n, nil
+		}
+	}
+}
+
+func (m *storageMigration) namespaces() []string {
+	if len(m.Namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return m.Namespaces
+}
+
+// storageVersion is the version a CRD's objects are stored in
+func storageVersion(crd *apiextensionsv1.CustomResourceDefinition) string {
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			return v.Name
+		}
+	}
+	return ""
+}
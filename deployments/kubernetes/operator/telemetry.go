@@ -0,0 +1,252 @@
+// telemetry.go - OpenTelemetry and Prometheus Wiring of Agent Pods
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	aiv1alpha1 "github.com/Wavine-ai/operator/api/v1alpha1"
+)
+
+const (
+	// telemetryHashKey on the pod template changes with the sidecar's
+	// collector config, which the collector only reads on start
+	telemetryHashKey = "agent.Wavine.ai/telemetry-hash"
+
+	otelSidecarName    = "otel-collector"
+	otelConfigVolume   = "otel-collector-config"
+	otelConfigPath     = "/etc/otelcol"
+	defaultMetricsPort = 9090
+	defaultMetricsPath = "/metrics"
+)
+
+// telemetryConfig is the cluster's telemetry backend every agent with
+// spec.telemetry reports to
+type telemetryConfig struct {
+	// CollectorEndpoint is the OTLP gRPC endpoint of the cluster's
+	// collector
+	CollectorEndpoint string
+	// CollectorPeer is the collector's pods, which agents' NetworkPolicies
+	// let them reach; unset when the collector runs outside the cluster
+	CollectorPeer *networkPeer
+	// SidecarImage is the collector image of Sidecar mode
+	SidecarImage string
+	// MonitoringNamespace is where Prometheus scrapes agents from
+	MonitoringNamespace string
+}
+
+// sidecarConfig receives OTLP on the pod's loopback only and forwards it
+// in batches, so an agent never blocks on a slow collector
+const sidecarConfig = `receivers:
+  otlp:
+    protocols:
+      grpc:
+        endpoint: 127.0.0.1:4317
+      http:
+        endpoint: 127.0.0.1:4318
+processors:
+  memory_limiter:
+    check_interval: 1s
+    limit_percentage: 80
+    spike_limit_percentage: 20
+  batch: {}
+exporters:
+  otlp:
+    endpoint: %s
+service:
+  pipelines:
+    traces:
+      receivers: [otlp]
+      processors: [memory_limiter, batch]
+      exporters: [otlp]
+    metrics:
+      receivers: [otlp]
+      processors: [memory_limiter, batch]
+      exporters: [otlp]
+    logs:
+      receivers: [otlp]
+      processors: [memory_limiter, batch]
+      exporters: [otlp]
+`
+
+func telemetryMode(t *aiv1alpha1.TelemetrySpec) string {
+	if t.Mode == "" {
+		return aiv1alpha1.TelemetryEnv
+	}
+	return t.Mode
+}
+
+func scrapeEnabled(t *aiv1alpha1.TelemetrySpec) bool {
+	return t.Scrape == nil || *t.Scrape
+}
+
+func metricsPort(t *aiv1alpha1.TelemetrySpec) int32 {
+	if t.MetricsPort == 0 {
+		return defaultMetricsPort
+	}
+	return t.MetricsPort
+}
+
+// ensureTelemetry applies the collector config of a sidecar-mode agent
+// and removes it once the agent leaves sidecar mode
+func (r *AgentReconciler) ensureTelemetry(ctx context.Context, agent *aiv1alpha1.AIAgent) error {
+	name := agent.Name + "-otel"
+	t := agent.Spec.Telemetry
+	if t == nil || telemetryMode(t) != aiv1alpha1.TelemetrySidecar {
+		return r.deleteOwned(ctx, &corev1.ConfigMap{}, agent, name)
+	}
+	if r.Telemetry.CollectorEndpoint == "" {
+		return fmt.Errorf("telemetry needs the operator's --otel-collector-endpoint")
+	}
+	if r.Telemetry.SidecarImage == "" {
+		return fmt.Errorf("sidecar telemetry needs the operator's --otel-sidecar-image")
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: agent.Namespace,
+			Labels:    agentLabels(agent),
+		},
+		Data: map[string]string{"config.yaml": r.sidecarConfig()},
+	}
+	if err := ctrl.SetControllerReference(agent, cm, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, existing)
+	if err != nil && apierrors.IsNotFound(err) {
+		return r.Create(ctx, cm)
+	} else if err != nil {
+		return err
+	}
+	cm.ResourceVersion = existing.ResourceVersion
+	return r.Update(ctx, cm)
+}
+
+func (r *AgentReconciler) sidecarConfig() string {
+	return fmt.Sprintf(sidecarConfig, r.Telemetry.CollectorEndpoint)
+}
+
+// applyTelemetry configures the OpenTelemetry SDK of the agent container
+// through its standard environment, adds the collector sidecar and marks
+// the pods for scraping
+func (r *AgentReconciler) applyTelemetry(agent *aiv1alpha1.AIAgent, tmpl *corev1.PodTemplateSpec) {
+	t := agent.Spec.Telemetry
+	if t == nil {
+		return
+	}
+	sidecar := telemetryMode(t) == aiv1alpha1.TelemetrySidecar
+	endpoint := r.Telemetry.CollectorEndpoint
+	if sidecar {
+		endpoint = "http://127.0.0.1:4317"
+	}
+
+	container := &tmpl.Spec.Containers[0]
+	// POD_NAME comes first so the attributes below can expand it
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+		}},
+		corev1.EnvVar{Name: "OTEL_SERVICE_NAME", Value: agent.Name},
+		corev1.EnvVar{Name: "OTEL_RESOURCE_ATTRIBUTES", Value: resourceAttributes(agent)},
+		corev1.EnvVar{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: endpoint},
+		corev1.EnvVar{Name: "OTEL_EXPORTER_OTLP_PROTOCOL", Value: "grpc"},
+	)
+	if t.SamplingRatio != "" {
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "OTEL_TRACES_SAMPLER", Value: "parentbased_traceidratio"},
+			corev1.EnvVar{Name: "OTEL_TRACES_SAMPLER_ARG", Value: t.SamplingRatio},
+		)
+	}
+
+	if tmpl.Annotations == nil {
+		tmpl.Annotations = make(map[string]string)
+	}
+	if scrapeEnabled(t) {
+		path := t.MetricsPath
+		if path == "" {
+			path = defaultMetricsPath
+		}
+		port := metricsPort(t)
+		container.Ports = append(container.Ports, corev1.ContainerPort{
+			Name:          "metrics",
+			ContainerPort: port,
+			Protocol:      corev1.ProtocolTCP,
+		})
+		tmpl.Annotations["prometheus.io/scrape"] = "true"
+		tmpl.Annotations["prometheus.io/port"] = strconv.Itoa(int(port))
+		tmpl.Annotations["prometheus.io/path"] = path
+	}
+
+	if !sidecar {
+		return
+	}
+	config := r.sidecarConfig()
+	h := fnv.New64a()
+	h.Write([]byte(config))
+	tmpl.Annotations[telemetryHashKey] = strconv.FormatUint(h.Sum64(), 36)
+
+	tmpl.Spec.Containers = append(tmpl.Spec.Containers, corev1.Container{
+		Name:            otelSidecarName,
+		Image:           r.Telemetry.SidecarImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args:            []string{"--config=" + otelConfigPath + "/config.yaml"},
+		Resources:       t.SidecarResources,
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      otelConfigVolume,
+			MountPath: otelConfigPath,
+			ReadOnly:  true,
+		}},
+		SecurityContext: &corev1.SecurityContext{
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+			},
+			ReadOnlyRootFilesystem: ptrBool(true),
+		},
+	})
+	tmpl.Spec.Volumes = append(tmpl.Spec.Volumes, corev1.Volume{
+		Name: otelConfigVolume,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: agent.Name + "-otel"},
+			},
+		},
+	})
+}
+
+// resourceAttributes identifies the agent on everything it reports. The
+// namespace is the agent's tenant.
+func resourceAttributes(agent *aiv1alpha1.AIAgent) string {
+	attrs := map[string]string{
+		"k8s.namespace.name": agent.Namespace,
+		"nuzon.agent.id":     agent.Name,
+		"nuzon.tenant.id":    agent.Namespace,
+	}
+	for k, v := range agent.Spec.Telemetry.ResourceAttributes {
+		attrs[k] = v
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{"k8s.pod.name=$(POD_NAME)"}
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+url.PathEscape(attrs[k]))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -28,6 +28,10 @@ type JES2Config struct {
 	TLSCert         tls.Certificate
 	JobCardTemplate string
 	Timeout         time.Duration
+
+	// GetClientCertificate, when set, replaces TLSCert so renewed
+	// certificates are picked up on reconnect
+	GetClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
 }
 
 // JES2Bridge implements atomic job control operations
@@ -56,6 +60,10 @@ func NewJES2Bridge(ctx context.Context, cfg JES2Config) (*JES2Bridge, error) {
 		InsecureSkipVerify: false,
 		ServerName:         cfg.Host,
 	}
+	if cfg.GetClientCertificate != nil {
+		tlsConfig.Certificates = nil
+		tlsConfig.GetClientCertificate = cfg.GetClientCertificate
+	}
 
 	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%d", cfg.Host, cfg.Port), tlsConfig)
 	if err != nil {
@@ -0,0 +1,103 @@
+// bedrock.go - AWS Bedrock Embeddings Provider
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/smithy-go"
+)
+
+// BedrockProvider invokes Titan or Cohere embedding models on Bedrock.
+// Titan embeds one text per call; Cohere models take batches.
+type BedrockProvider struct {
+	Client *bedrockruntime.Client
+	// ModelID is e.g. amazon.titan-embed-text-v2:0 or
+	// cohere.embed-english-v3
+	ModelID    string
+	Dimensions int
+}
+
+func (p *BedrockProvider) Name() string   { return "bedrock" }
+func (p *BedrockProvider) Model() string  { return p.ModelID }
+func (p *BedrockProvider) Dimension() int { return p.Dimensions }
+
+func (p *BedrockProvider) cohere() bool { return strings.HasPrefix(p.ModelID, "cohere.") }
+
+func (p *BedrockProvider) MaxBatch() int {
+	if p.cohere() {
+		return 96
+	}
+	return 1
+}
+
+func (p *BedrockProvider) Embed(ctx context.Context, texts []string) (Result, error) {
+	if p.cohere() {
+		return p.embedCohere(ctx, texts)
+	}
+	res := Result{Vectors: make([][]float32, 0, len(texts))}
+	for _, t := range texts {
+		body := map[string]interface{}{"inputText": t, "normalize": true}
+		if p.Dimensions > 0 {
+			body["dimensions"] = p.Dimensions
+		}
+		var out struct {
+			Embedding           []float32 `json:"embedding"`
+			InputTextTokenCount int       `json:"inputTextTokenCount"`
+		}
+		if err := p.invoke(ctx, body, &out); err != nil {
+			return Result{}, err
+		}
+		res.Vectors = append(res.Vectors, out.Embedding)
+		res.Tokens += out.InputTextTokenCount
+	}
+	return res, nil
+}
+
+func (p *BedrockProvider) embedCohere(ctx context.Context, texts []string) (Result, error) {
+	var out struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	err := p.invoke(ctx, map[string]interface{}{
+		"texts":      texts,
+		"input_type": CohereSearchDocument,
+	}, &out)
+	if err != nil {
+		return Result{}, err
+	}
+	// Bedrock's Cohere response carries no token count
+	return Result{Vectors: out.Embeddings}, nil
+}
+
+func (p *BedrockProvider) invoke(ctx context.Context, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := p.Client.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(p.ModelID),
+		ContentType: aws.String("application/json"),
+		Accept:      aws.String("application/json"),
+		Body:        body,
+	})
+	if err != nil {
+		err = fmt.Errorf("bedrock embeddings: %w", err)
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			switch apiErr.ErrorCode() {
+			case "ThrottlingException", "ServiceUnavailableException", "ModelNotReadyException", "InternalServerException":
+				return &RetryableError{Err: err}
+			}
+		}
+		return err
+	}
+	if err := json.Unmarshal(resp.Body, out); err != nil {
+		return fmt.Errorf("bedrock embeddings: malformed response: %w", err)
+	}
+	return nil
+}
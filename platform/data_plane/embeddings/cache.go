@@ -0,0 +1,139 @@
+// cache.go - Embedding Caches Keyed by Content Hash
+package embeddings
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache stores vectors under CacheKey values. Get returns only the keys it
+// holds.
+type Cache interface {
+	Get(ctx context.Context, keys []string) (map[string][]float32, error)
+	Set(ctx context.Context, entries map[string][]float32) error
+}
+
+// MemoryCache is a process-local LRU bounded by entry count
+type MemoryCache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key    string
+	vector []float32
+}
+
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		max:     maxEntries,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(_ context.Context, keys []string) (map[string][]float32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string][]float32)
+	for _, k := range keys {
+		if el, ok := c.entries[k]; ok {
+			c.order.MoveToFront(el)
+			out[k] = el.Value.(*memoryEntry).vector
+		}
+	}
+	return out, nil
+}
+
+func (c *MemoryCache) Set(_ context.Context, entries map[string][]float32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, v := range entries {
+		if el, ok := c.entries[k]; ok {
+			el.Value.(*memoryEntry).vector = v
+			c.order.MoveToFront(el)
+			continue
+		}
+		c.entries[k] = c.order.PushFront(&memoryEntry{key: k, vector: v})
+		for c.max > 0 && c.order.Len() > c.max {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*memoryEntry).key)
+		}
+	}
+	return nil
+}
+
+// RedisCache shares embeddings across replicas, storing each vector as
+// little-endian float32s with a TTL
+type RedisCache struct {
+	client redis.UniversalClient
+	prefix string
+	TTL    time.Duration
+}
+
+func NewRedisCache(client redis.UniversalClient, ttl time.Duration) *RedisCache {
+	return &RedisCache{client: client, prefix: "nuzon:embeddings:", TTL: ttl}
+}
+
+func (c *RedisCache) Get(ctx context.Context, keys []string) (map[string][]float32, error) {
+	out := make(map[string][]float32)
+	if len(keys) == 0 {
+		return out, nil
+	}
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = c.prefix + k
+	}
+	vals, err := c.client.MGet(ctx, full...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("embedding cache read failed: %w", err)
+	}
+	for i, v := range vals {
+		s, ok := v.(string)
+		if !ok || len(s)%4 != 0 {
+			continue
+		}
+		out[keys[i]] = decodeVector([]byte(s))
+	}
+	return out, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, entries map[string][]float32) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	pipe := c.client.Pipeline()
+	for k, v := range entries {
+		pipe.Set(ctx, c.prefix+k, encodeVector(v), c.TTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("embedding cache write failed: %w", err)
+	}
+	return nil
+}
+
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
@@ -0,0 +1,73 @@
+// cohere.go - Cohere Embeddings Provider
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+const cohereEmbedURL = "https://api.cohere.com/v2/embed"
+
+// Cohere input types; documents and queries embed differently
+const (
+	CohereSearchDocument = "search_document"
+	CohereSearchQuery    = "search_query"
+)
+
+// CohereProvider calls Cohere's v2 embed endpoint
+type CohereProvider struct {
+	APIKey string
+	// ModelName is e.g. embed-english-v3.0
+	ModelName  string
+	Dimensions int
+	// InputType defaults to search_document
+	InputType string
+	Client    *http.Client
+}
+
+type cohereRequest struct {
+	Model          string   `json:"model"`
+	Texts          []string `json:"texts"`
+	InputType      string   `json:"input_type"`
+	EmbeddingTypes []string `json:"embedding_types"`
+}
+
+type cohereResponse struct {
+	Embeddings struct {
+		Float [][]float32 `json:"float"`
+	} `json:"embeddings"`
+	Meta struct {
+		BilledUnits struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"billed_units"`
+	} `json:"meta"`
+}
+
+func (p *CohereProvider) Name() string   { return "cohere" }
+func (p *CohereProvider) Model() string  { return p.ModelName + "/" + p.inputType() }
+func (p *CohereProvider) Dimension() int { return p.Dimensions }
+func (p *CohereProvider) MaxBatch() int  { return 96 }
+
+func (p *CohereProvider) inputType() string {
+	if p.InputType == "" {
+		return CohereSearchDocument
+	}
+	return p.InputType
+}
+
+func (p *CohereProvider) Embed(ctx context.Context, texts []string) (Result, error) {
+	var out cohereResponse
+	err := postJSON(ctx, p.Client, cohereEmbedURL,
+		map[string]string{"Authorization": "Bearer " + p.APIKey},
+		cohereRequest{
+			Model:          p.ModelName,
+			Texts:          texts,
+			InputType:      p.inputType(),
+			EmbeddingTypes: []string{"float"},
+		}, &out)
+	if err != nil {
+		return Result{}, fmt.Errorf("cohere embeddings: %w", err)
+	}
+	return Result{Vectors: out.Embeddings.Float, Tokens: out.Meta.BilledUnits.InputTokens}, nil
+}
@@ -0,0 +1,350 @@
+// embeddings.go - Embedding Providers with Batching, Retry and Caching
+package embeddings
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	defaultMaxRetries  = 5
+	defaultBaseDelay   = 500 * time.Millisecond
+	defaultMaxDelay    = 30 * time.Second
+	defaultConcurrency = 4
+)
+
+var (
+	embedTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_embeddings_tokens_total",
+		Help: "Input tokens billed by embedding providers",
+	}, []string{"provider", "model"})
+
+	embedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_embeddings_requests_total",
+		Help: "Embedding provider calls by outcome",
+	}, []string{"provider", "status"})
+
+	embedLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "Wavine_embeddings_request_duration_seconds",
+		Help:    "Embedding provider call latency",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"provider"})
+
+	embedCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_embeddings_cache_total",
+		Help: "Embedding cache lookups by result",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(embedTokens, embedRequests, embedLatency, embedCache)
+}
+
+// Result is one provider call's output: a vector per input, in order, and
+// the tokens billed for the call (zero when the provider does not say)
+type Result struct {
+	Vectors [][]float32
+	Tokens  int
+}
+
+// Provider is one embedding model behind a vendor API or local runtime
+type Provider interface {
+	Name() string
+	Model() string
+	Dimension() int
+	// MaxBatch is the most inputs one Embed call accepts
+	MaxBatch() int
+	Embed(ctx context.Context, texts []string) (Result, error)
+}
+
+// RetryableError marks provider failures worth retrying: rate limits,
+// server errors and timeouts
+type RetryableError struct {
+	Err error
+	// RetryAfter is the provider's requested wait, zero if unspecified
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string { return e.Err.Error() }
+func (e *RetryableError) Unwrap() error { return e.Err }
+
+// TokenMeter receives token usage for billing and quota enforcement
+type TokenMeter interface {
+	Record(ctx context.Context, provider, model string, tokens int)
+}
+
+// Config assembles an Embedder. Cache and Meter are optional.
+type Config struct {
+	Provider    Provider
+	Cache       Cache
+	Meter       TokenMeter
+	MaxRetries  int
+	BaseDelay   time.Duration
+	Concurrency int
+}
+
+// Embedder fronts a Provider with a content-hash cache, request batching,
+// bounded concurrency and retry with exponential backoff
+type Embedder struct {
+	provider Provider
+	cache    Cache
+	meter    TokenMeter
+	retries  int
+	delay    time.Duration
+	sem      *semaphore.Weighted
+	logger   *zap.Logger
+}
+
+func New(cfg Config, logger *zap.Logger) (*Embedder, error) {
+	if cfg.Provider == nil {
+		return nil, errors.New("embeddings: provider is required")
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = defaultBaseDelay
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultConcurrency
+	}
+	return &Embedder{
+		provider: cfg.Provider,
+		cache:    cfg.Cache,
+		meter:    cfg.Meter,
+		retries:  cfg.MaxRetries,
+		delay:    cfg.BaseDelay,
+		sem:      semaphore.NewWeighted(int64(cfg.Concurrency)),
+		logger:   logger.Named("embeddings").With(zap.String("provider", cfg.Provider.Name())),
+	}, nil
+}
+
+// Dimension is the provider's output size
+func (e *Embedder) Dimension() int { return e.provider.Dimension() }
+
+// CacheKey identifies text under one provider, model and output dimension
+func CacheKey(provider Provider, text string) string {
+	sum := sha256.Sum256([]byte(provider.Name() + "\x00" + provider.Model() + "\x00" +
+		strconv.Itoa(provider.Dimension()) + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// EmbedOne embeds a single text
+func (e *Embedder) EmbedOne(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := e.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// TextEmbedder embeds one text per call, the shape the memory adapter's
+// Embedder takes
+type TextEmbedder struct {
+	e *Embedder
+}
+
+// Text adapts e to callers embedding a single text at a time
+func (e *Embedder) Text() TextEmbedder {
+	return TextEmbedder{e: e}
+}
+
+// Embed embeds text through the cache, batching and retries of e
+func (t TextEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return t.e.EmbedOne(ctx, text)
+}
+
+// Embed returns one vector per text, in order. Cached texts are served
+// without a provider call and duplicates are embedded once.
+func (e *Embedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	keys := make([]string, len(texts))
+	for i, t := range texts {
+		keys[i] = CacheKey(e.provider, t)
+	}
+
+	found := map[string][]float32{}
+	if e.cache != nil {
+		var err error
+		if found, err = e.cache.Get(ctx, keys); err != nil {
+			// a cache outage costs money, not correctness
+			e.logger.Warn("Embedding cache read failed", zap.Error(err))
+			found = map[string][]float32{}
+		}
+	}
+
+	var missTexts, missKeys []string
+	seen := map[string]bool{}
+	for i, k := range keys {
+		if v, ok := found[k]; ok {
+			// a cached vector is held to the same checks as a fresh one
+			// and re-embedded when it fails them
+			err := e.check(Result{Vectors: [][]float32{v}}, 1)
+			if err == nil {
+				out[i] = v
+				embedCache.WithLabelValues("hit").Inc()
+				continue
+			}
+			e.logger.Warn("Discarding invalid cached embedding", zap.Error(err))
+		}
+		embedCache.WithLabelValues("miss").Inc()
+		if !seen[k] {
+			seen[k] = true
+			missTexts = append(missTexts, texts[i])
+			missKeys = append(missKeys, k)
+		}
+	}
+	if len(missTexts) == 0 {
+		return out, nil
+	}
+
+	fresh, err := e.embedBatches(ctx, missTexts)
+	if err != nil {
+		return nil, err
+	}
+	computed := make(map[string][]float32, len(missKeys))
+	for i, k := range missKeys {
+		computed[k] = fresh[i]
+	}
+	for i, k := range keys {
+		if out[i] == nil {
+			out[i] = computed[k]
+		}
+	}
+	if e.cache != nil {
+		if err := e.cache.Set(ctx, computed); err != nil {
+			e.logger.Warn("Embedding cache write failed", zap.Error(err))
+		}
+	}
+	return out, nil
+}
+
+// embedBatches splits texts at the provider's batch limit and runs the
+// batches concurrently
+func (e *Embedder) embedBatches(ctx context.Context, texts []string) ([][]float32, error) {
+	size := e.provider.MaxBatch()
+	if size <= 0 {
+		size = 1
+	}
+	out := make([][]float32, len(texts))
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, (len(texts)+size-1)/size)
+	for start := 0; start < len(texts); start += size {
+		end := start + size
+		if end > len(texts) {
+			end = len(texts)
+		}
+		if err := e.sem.Acquire(ctx, 1); err != nil {
+			errChan <- err
+			break
+		}
+		wg.Add(1)
+		go func(start int, batch []string) {
+			defer wg.Done()
+			defer e.sem.Release(1)
+
+			vectors, err := e.embedWithRetry(ctx, batch)
+			if err != nil {
+				errChan <- fmt.Errorf("batch at %d: %w", start, err)
+				return
+			}
+			copy(out[start:], vectors)
+		}(start, texts[start:end])
+	}
+	wg.Wait()
+	close(errChan)
+
+	for err := range errChan {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (e *Embedder) embedWithRetry(ctx context.Context, batch []string) ([][]float32, error) {
+	name, model := e.provider.Name(), e.provider.Model()
+	var lastErr error
+	for attempt := 1; attempt <= e.retries; attempt++ {
+		start := time.Now()
+		res, err := e.provider.Embed(ctx, batch)
+		embedLatency.WithLabelValues(name).Observe(time.Since(start).Seconds())
+
+		if err == nil {
+			err = e.check(res, len(batch))
+		}
+		if err == nil {
+			embedRequests.WithLabelValues(name, "ok").Inc()
+			if res.Tokens > 0 {
+				embedTokens.WithLabelValues(name, model).Add(float64(res.Tokens))
+				if e.meter != nil {
+					e.meter.Record(ctx, name, model, res.Tokens)
+				}
+			}
+			return res.Vectors, nil
+		}
+
+		lastErr = err
+		var retryable *RetryableError
+		if !errors.As(err, &retryable) {
+			embedRequests.WithLabelValues(name, "error").Inc()
+			return nil, err
+		}
+		embedRequests.WithLabelValues(name, "retry").Inc()
+		if attempt == e.retries {
+			break
+		}
+
+		delay := e.backoff(attempt, retryable.RetryAfter)
+		e.logger.Warn("Embedding request failed, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_delay", delay),
+			zap.Error(err))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	embedRequests.WithLabelValues(name, "error").Inc()
+	return nil, fmt.Errorf("exhausted %d attempts: %w", e.retries, lastErr)
+}
+
+// backoff doubles per attempt with full jitter, honouring a provider's
+// Retry-After when it asks for longer
+func (e *Embedder) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	ceiling := e.delay << (attempt - 1)
+	if ceiling > defaultMaxDelay || ceiling <= 0 {
+		ceiling = defaultMaxDelay
+	}
+	delay := time.Duration(rand.Int63n(int64(ceiling)) + 1)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+func (e *Embedder) check(res Result, want int) error {
+	if len(res.Vectors) != want {
+		return fmt.Errorf("%s returned %d vectors for %d inputs", e.provider.Name(), len(res.Vectors), want)
+	}
+	dim := e.provider.Dimension()
+	for i, v := range res.Vectors {
+		if dim > 0 && len(v) != dim {
+			return fmt.Errorf("%s returned dimension %d at %d, expected %d", e.provider.Name(), len(v), i, dim)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+// local.go - Self-Hosted Embedding Providers
+package embeddings
+
+import "net/http"
+
+// NewLlamaCppProvider targets a llama.cpp server started with --embedding,
+// which serves the OpenAI embeddings API under /v1. dim must match the
+// loaded model.
+func NewLlamaCppProvider(baseURL, model string, dim int, client *http.Client) *OpenAIProvider {
+	return &OpenAIProvider{
+		ModelName:  model,
+		Dimensions: dim,
+		BaseURL:    baseURL + "/v1",
+		Client:     client,
+		name:       "llamacpp",
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !onnx
+
+package embeddings
+
+import (
+	"context"
+	"errors"
+)
+
+var errNoONNX = errors.New("local ONNX embeddings unavailable: built without -tags onnx")
+
+// ONNXConfig is accepted but unusable without the onnx build tag
+type ONNXConfig struct {
+	ModelPath      string
+	TokenizerPath  string
+	RuntimeLibrary string
+	Dimension      int
+	MaxLength      int
+	BatchSize      int
+}
+
+type ONNXProvider struct{}
+
+// NewONNXProvider needs a binary built with -tags onnx, which links
+// onnxruntime and the tokenizers library
+func NewONNXProvider(ONNXConfig) (*ONNXProvider, error) {
+	return nil, errNoONNX
+}
+
+func (*ONNXProvider) Name() string   { return "onnx" }
+func (*ONNXProvider) Model() string  { return "" }
+func (*ONNXProvider) Dimension() int { return 0 }
+func (*ONNXProvider) MaxBatch() int  { return 1 }
+
+func (*ONNXProvider) Embed(context.Context, []string) (Result, error) {
+	return Result{}, errNoONNX
+}
+
+func (*ONNXProvider) Close() error { return nil }
@@ -0,0 +1,180 @@
+//go:build onnx
+
+// onnx_on.go - In-Process Sentence Embeddings on ONNX Runtime
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/daulet/tokenizers"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+var ortInit sync.Once
+
+// ONNXConfig points at a sentence-transformer exported to ONNX (for
+// example all-MiniLM-L6-v2 or bge-small) and its tokenizer.json
+type ONNXConfig struct {
+	ModelPath      string
+	TokenizerPath  string
+	RuntimeLibrary string
+	Dimension      int
+	// MaxLength truncates inputs, 512 tokens by default
+	MaxLength int
+	// BatchSize is the number of texts per inference call, 32 by default
+	BatchSize int
+}
+
+// ONNXProvider mean-pools the last hidden state and L2-normalizes it, the
+// sentence-transformers recipe
+type ONNXProvider struct {
+	cfg           ONNXConfig
+	tokenizer     *tokenizers.Tokenizer
+	session       *ort.DynamicAdvancedSession
+	useTokenTypes bool
+}
+
+func NewONNXProvider(cfg ONNXConfig) (*ONNXProvider, error) {
+	if cfg.Dimension <= 0 {
+		return nil, fmt.Errorf("onnx embeddings: dimension is required")
+	}
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = 512
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 32
+	}
+
+	var initErr error
+	ortInit.Do(func() {
+		ort.SetSharedLibraryPath(cfg.RuntimeLibrary)
+		initErr = ort.InitializeEnvironment()
+	})
+	if initErr != nil {
+		return nil, fmt.Errorf("onnxruntime initialization failed: %w", initErr)
+	}
+
+	tk, err := tokenizers.FromFile(cfg.TokenizerPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+	inputs, outputs, err := ort.GetInputOutputInfo(cfg.ModelPath)
+	if err != nil || len(outputs) == 0 {
+		tk.Close()
+		return nil, fmt.Errorf("failed to inspect model: %v", err)
+	}
+	inputNames := []string{"input_ids", "attention_mask"}
+	useTokenTypes := false
+	for _, in := range inputs {
+		if in.Name == "token_type_ids" {
+			useTokenTypes = true
+			inputNames = append(inputNames, in.Name)
+		}
+	}
+	session, err := ort.NewDynamicAdvancedSession(cfg.ModelPath, inputNames, []string{outputs[0].Name}, nil)
+	if err != nil {
+		tk.Close()
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return &ONNXProvider{cfg: cfg, tokenizer: tk, session: session, useTokenTypes: useTokenTypes}, nil
+}
+
+func (p *ONNXProvider) Name() string   { return "onnx" }
+func (p *ONNXProvider) Model() string  { return p.cfg.ModelPath }
+func (p *ONNXProvider) Dimension() int { return p.cfg.Dimension }
+func (p *ONNXProvider) MaxBatch() int  { return p.cfg.BatchSize }
+
+// Embed counts tokens locally so usage is comparable with hosted providers
+func (p *ONNXProvider) Embed(ctx context.Context, texts []string) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	encoded := make([][]uint32, len(texts))
+	width, tokens := 0, 0
+	for i, t := range texts {
+		ids, _ := p.tokenizer.Encode(t, true)
+		if len(ids) > p.cfg.MaxLength {
+			ids = ids[:p.cfg.MaxLength]
+		}
+		encoded[i] = ids
+		tokens += len(ids)
+		if len(ids) > width {
+			width = len(ids)
+		}
+	}
+
+	n := len(texts)
+	ids := make([]int64, n*width)
+	mask := make([]int64, n*width)
+	for i, enc := range encoded {
+		for j, id := range enc {
+			ids[i*width+j] = int64(id)
+			mask[i*width+j] = 1
+		}
+	}
+
+	shape := ort.NewShape(int64(n), int64(width))
+	idsT, err := ort.NewTensor(shape, ids)
+	if err != nil {
+		return Result{}, err
+	}
+	defer idsT.Destroy()
+	maskT, err := ort.NewTensor(shape, mask)
+	if err != nil {
+		return Result{}, err
+	}
+	defer maskT.Destroy()
+	inputs := []ort.Value{idsT, maskT}
+	if p.useTokenTypes {
+		typesT, err := ort.NewTensor(shape, make([]int64, n*width))
+		if err != nil {
+			return Result{}, err
+		}
+		defer typesT.Destroy()
+		inputs = append(inputs, typesT)
+	}
+
+	dim := p.cfg.Dimension
+	hidden, err := ort.NewEmptyTensor[float32](ort.NewShape(int64(n), int64(width), int64(dim)))
+	if err != nil {
+		return Result{}, err
+	}
+	defer hidden.Destroy()
+	if err := p.session.Run(inputs, []ort.Value{hidden}); err != nil {
+		return Result{}, fmt.Errorf("onnx inference failed: %w", err)
+	}
+
+	data := hidden.GetData()
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		v := make([]float32, dim)
+		count := float32(len(encoded[i]))
+		for j := range encoded[i] {
+			row := data[(i*width+j)*dim : (i*width+j+1)*dim]
+			for d := range v {
+				v[d] += row[d]
+			}
+		}
+		var norm float64
+		for d := range v {
+			v[d] /= count
+			norm += float64(v[d]) * float64(v[d])
+		}
+		if norm > 0 {
+			inv := float32(1 / math.Sqrt(norm))
+			for d := range v {
+				v[d] *= inv
+			}
+		}
+		vectors[i] = v
+	}
+	return Result{Vectors: vectors, Tokens: tokens}, nil
+}
+
+func (p *ONNXProvider) Close() error {
+	p.tokenizer.Close()
+	return p.session.Destroy()
+}
@@ -0,0 +1,84 @@
+// openai.go - OpenAI Embeddings Provider
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const openAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIProvider calls /embeddings on the OpenAI API or any server that
+// speaks it
+type OpenAIProvider struct {
+	APIKey string
+	// ModelName is e.g. text-embedding-3-small
+	ModelName string
+	// Dimensions shortens text-embedding-3 outputs when set; it must
+	// otherwise match the model's native size
+	Dimensions int
+	BaseURL    string
+	Client     *http.Client
+
+	name string
+}
+
+type openAIRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type openAIResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func (p *OpenAIProvider) Name() string {
+	if p.name != "" {
+		return p.name
+	}
+	return "openai"
+}
+
+func (p *OpenAIProvider) Model() string  { return p.ModelName }
+func (p *OpenAIProvider) Dimension() int { return p.Dimensions }
+
+// MaxBatch is OpenAI's per-request input limit
+func (p *OpenAIProvider) MaxBatch() int { return 2048 }
+
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string) (Result, error) {
+	base := p.BaseURL
+	if base == "" {
+		base = openAIBaseURL
+	}
+	headers := map[string]string{}
+	if p.APIKey != "" {
+		headers["Authorization"] = "Bearer " + p.APIKey
+	}
+
+	var out openAIResponse
+	req := openAIRequest{Model: p.ModelName, Input: texts}
+	if p.name == "" {
+		req.Dimensions = p.Dimensions
+	}
+	if err := postJSON(ctx, p.Client, strings.TrimRight(base, "/")+"/embeddings", headers, req, &out); err != nil {
+		return Result{}, fmt.Errorf("%s embeddings: %w", p.Name(), err)
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return Result{}, fmt.Errorf("%s embeddings: index %d out of range", p.Name(), d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return Result{Vectors: vectors, Tokens: out.Usage.TotalTokens}, nil
+}
@@ -0,0 +1,96 @@
+// admin_service.go - Vector Collection Admin gRPC Service
+package vectordb
+
+import (
+	"context"
+
+	vectoradmin "github.com/Wavine-ai/protos/vectordb/admin/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AdminServer serves VectorAdminService over a CollectionAdmin. It carries
+// no authorization of its own and belongs on the operator-only listener.
+type AdminServer struct {
+	vectoradmin.UnimplementedVectorAdminServiceServer
+
+	admin  CollectionAdmin
+	logger *zap.Logger
+}
+
+func NewAdminServer(admin CollectionAdmin, logger *zap.Logger) *AdminServer {
+	return &AdminServer{admin: admin, logger: logger.Named("vector_admin")}
+}
+
+// Register attaches the service to a gRPC server
+func (s *AdminServer) Register(g *grpc.Server) {
+	vectoradmin.RegisterVectorAdminServiceServer(g, s)
+}
+
+func (s *AdminServer) ListCollections(ctx context.Context, _ *vectoradmin.ListCollectionsRequest) (*vectoradmin.ListCollectionsResponse, error) {
+	names, err := s.admin.ListCollections(ctx)
+	if err != nil {
+		return nil, s.internal("list collections", err)
+	}
+	return &vectoradmin.ListCollectionsResponse{Names: names}, nil
+}
+
+func (s *AdminServer) DescribeCollection(ctx context.Context, req *vectoradmin.DescribeCollectionRequest) (*vectoradmin.CollectionInfo, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	info, err := s.admin.DescribeCollection(ctx, req.GetName())
+	if err != nil {
+		return nil, s.internal("describe collection", err)
+	}
+	return &vectoradmin.CollectionInfo{
+		Name:        info.Name,
+		Id:          info.ID,
+		Dimension:   info.Dimension,
+		Shards:      info.Shards,
+		Loaded:      info.Loaded,
+		Partitions:  info.Partitions,
+		RowCount:    info.RowCount,
+		LoadedRows:  info.LoadedRows,
+		MemoryBytes: info.MemoryBytes,
+	}, nil
+}
+
+func (s *AdminServer) DropCollection(ctx context.Context, req *vectoradmin.DropCollectionRequest) (*vectoradmin.DropCollectionResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if req.GetConfirm() != req.GetName() {
+		return nil, status.Error(codes.FailedPrecondition, "confirm must repeat the collection name")
+	}
+	if err := s.admin.DropCollection(ctx, req.GetName()); err != nil {
+		return nil, s.internal("drop collection", err)
+	}
+	return &vectoradmin.DropCollectionResponse{}, nil
+}
+
+func (s *AdminServer) Compact(ctx context.Context, req *vectoradmin.CompactRequest) (*vectoradmin.CompactResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	id, err := s.admin.Compact(ctx, req.GetName())
+	if err != nil {
+		return nil, s.internal("compact", err)
+	}
+	return &vectoradmin.CompactResponse{CompactionId: id}, nil
+}
+
+func (s *AdminServer) GetCompactionState(ctx context.Context, req *vectoradmin.CompactionStateRequest) (*vectoradmin.CompactionStateResponse, error) {
+	done, err := s.admin.CompactionCompleted(ctx, req.GetCompactionId())
+	if err != nil {
+		return nil, s.internal("compaction state", err)
+	}
+	return &vectoradmin.CompactionStateResponse{Completed: done}, nil
+}
+
+func (s *AdminServer) internal(op string, err error) error {
+	s.logger.Error("Admin operation failed", zap.String("op", op), zap.Error(err))
+	return status.Errorf(codes.Internal, "%s failed: %v", op, err)
+}
@@ -0,0 +1,478 @@
+// bulk_import.go - Bulk Embedding Import from Parquet and JSONL
+package vectordb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/parquet-go/parquet-go"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultImportBatchSize = 1000
+	defaultImportWorkers   = 4
+	// maxJSONLLine bounds one JSONL record; a 4096-dim vector printed as
+	// text is well under 100 KB
+	maxJSONLLine = 4 << 20
+)
+
+// ImportSource reads corpus files from object storage. JSONL is streamed
+// through Open; Parquet needs random access for its footer and row groups.
+type ImportSource interface {
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	OpenReaderAt(ctx context.Context, key string) (io.ReaderAt, int64, error)
+}
+
+// S3ImportSource reads import files from an S3 bucket, serving Parquet
+// with ranged GETs so files are never downloaded whole
+type S3ImportSource struct {
+	Client *s3.Client
+	Bucket string
+}
+
+func (s *S3ImportSource) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *S3ImportSource) OpenReaderAt(ctx context.Context, key string) (io.ReaderAt, int64, error) {
+	head, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	size := aws.ToInt64(head.ContentLength)
+	return &s3RangeReader{ctx: ctx, source: s, key: key, size: size}, size, nil
+}
+
+type s3RangeReader struct {
+	ctx    context.Context
+	source *S3ImportSource
+	key    string
+	size   int64
+}
+
+func (r *s3RangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	out, err := r.source.Client.GetObject(r.ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.source.Bucket),
+		Key:    aws.String(r.key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", off, end-1)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer out.Body.Close()
+
+	n, err := io.ReadFull(out.Body, p[:end-off])
+	if err == nil && end < off+int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// ImportProgress is the checkpointed state of one file: Rows leading rows
+// are durably in the store
+type ImportProgress struct {
+	Rows      int64     `json:"rows"`
+	Done      bool      `json:"done"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CheckpointStore persists per-file import progress under a job ID so an
+// interrupted import resumes where it stopped
+type CheckpointStore interface {
+	Load(ctx context.Context, jobID string) (map[string]ImportProgress, error)
+	Save(ctx context.Context, jobID string, progress map[string]ImportProgress) error
+}
+
+// FileCheckpointStore keeps checkpoints as JSON files in Dir
+type FileCheckpointStore struct {
+	Dir string
+}
+
+func (f *FileCheckpointStore) path(jobID string) string {
+	return filepath.Join(f.Dir, jobID+".json")
+}
+
+func (f *FileCheckpointStore) Load(_ context.Context, jobID string) (map[string]ImportProgress, error) {
+	raw, err := os.ReadFile(f.path(jobID))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]ImportProgress{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	progress := map[string]ImportProgress{}
+	if err := json.Unmarshal(raw, &progress); err != nil {
+		return nil, fmt.Errorf("corrupt checkpoint %s: %w", f.path(jobID), err)
+	}
+	return progress, nil
+}
+
+// Save writes through a temporary file so a crash never leaves a torn
+// checkpoint
+func (f *FileCheckpointStore) Save(_ context.Context, jobID string, progress map[string]ImportProgress) error {
+	raw, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	tmp := f.path(jobID) + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path(jobID))
+}
+
+// ImportJob describes one corpus load. Files are JSONL (.jsonl, .ndjson)
+// or Parquet (.parquet) with fields id (int64, optional), vector (list of
+// float) and metadata (object in JSONL, JSON string in Parquet, optional).
+// Rows without an id get one derived from file and row number, so a
+// resumed import rewrites rather than duplicates them.
+type ImportJob struct {
+	ID         string
+	Collection string
+	Keys       []string
+	// Dim defaults to the collection's dimension
+	Dim       int
+	BatchSize int
+	Workers   int
+}
+
+// ImportReport summarizes a finished or interrupted import
+type ImportReport struct {
+	JobID    string
+	Files    int
+	Imported int64
+	// Resumed counts rows skipped because a checkpoint covered them
+	Resumed int64
+}
+
+// BulkImporter streams files from an ImportSource into a Store with
+// parallel upsert workers
+type BulkImporter struct {
+	store       Store
+	source      ImportSource
+	checkpoints CheckpointStore
+	logger      *zap.Logger
+
+	mu       sync.Mutex
+	progress map[string]ImportProgress
+}
+
+func NewBulkImporter(store Store, source ImportSource, checkpoints CheckpointStore, logger *zap.Logger) *BulkImporter {
+	return &BulkImporter{
+		store:       store,
+		source:      source,
+		checkpoints: checkpoints,
+		logger:      logger.Named("bulk_import"),
+	}
+}
+
+type importRecord struct {
+	ID       *int64                 `json:"id"`
+	Vector   []float32              `json:"vector"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+type parquetRecord struct {
+	ID       *int64    `parquet:"id,optional"`
+	Vector   []float32 `parquet:"vector,list"`
+	Metadata *string   `parquet:"metadata,optional"`
+}
+
+type importBatch struct {
+	seq     int
+	vectors []Vector
+}
+
+// Run imports every file of job not already marked done. Tenant scoping
+// follows ctx as for any other Store write.
+func (b *BulkImporter) Run(ctx context.Context, job ImportJob) (ImportReport, error) {
+	report := ImportReport{JobID: job.ID}
+	if job.ID == "" || job.Collection == "" {
+		return report, fmt.Errorf("import job needs an ID and a collection")
+	}
+	if job.BatchSize <= 0 {
+		job.BatchSize = defaultImportBatchSize
+	}
+	if job.Workers <= 0 {
+		job.Workers = defaultImportWorkers
+	}
+
+	stats, err := b.store.Stats(ctx, job.Collection)
+	if err != nil {
+		return report, fmt.Errorf("collection lookup failed: %w", err)
+	}
+	switch {
+	case job.Dim == 0 && stats.Dimension == 0:
+		return report, fmt.Errorf("dimension unknown for %q; set ImportJob.Dim", job.Collection)
+	case job.Dim == 0:
+		job.Dim = int(stats.Dimension)
+	case stats.Dimension != 0 && int64(job.Dim) != stats.Dimension:
+		return report, fmt.Errorf("job dimension %d does not match collection dimension %d", job.Dim, stats.Dimension)
+	}
+
+	progress, err := b.checkpoints.Load(ctx, job.ID)
+	if err != nil {
+		return report, fmt.Errorf("checkpoint load failed: %w", err)
+	}
+	b.mu.Lock()
+	b.progress = progress
+	b.mu.Unlock()
+
+	for _, key := range job.Keys {
+		p := progress[key]
+		report.Resumed += p.Rows
+		if p.Done {
+			continue
+		}
+
+		start := time.Now()
+		n, err := b.importFile(ctx, job, key, p.Rows)
+		report.Imported += n
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", key, err)
+		}
+		report.Files++
+		b.logger.Info("Imported file",
+			zap.String("job", job.ID),
+			zap.String("key", key),
+			zap.Int64("rows", n),
+			zap.Duration("elapsed", time.Since(start)))
+	}
+	return report, nil
+}
+
+// importFile loads one file from row skip onwards and returns the rows
+// written. Batches finish out of order, so the checkpoint only advances
+// over the contiguous prefix that has completed.
+func (b *BulkImporter) importFile(ctx context.Context, job ImportJob, key string, skip int64) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan importBatch, job.Workers)
+	done := make(chan importBatch, job.Workers)
+	errChan := make(chan error, job.Workers+1)
+
+	go func() {
+		defer close(batches)
+		// a cancellation caused by a failed worker is not the root error
+		if err := b.readFile(ctx, job, key, skip, batches); err != nil && ctx.Err() == nil {
+			errChan <- err
+			cancel()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < job.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if err := b.store.Upsert(ctx, job.Collection, batch.vectors); err != nil {
+					errChan <- fmt.Errorf("batch %d upsert failed: %w", batch.seq, err)
+					cancel()
+					return
+				}
+				done <- batch
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var imported int64
+	watermark := skip
+	pending := map[int]int{}
+	next := 0
+	for batch := range done {
+		pending[batch.seq] = len(batch.vectors)
+		advanced := false
+		for n, ok := pending[next]; ok; n, ok = pending[next] {
+			delete(pending, next)
+			watermark += int64(n)
+			imported += int64(n)
+			next++
+			advanced = true
+		}
+		if advanced {
+			if err := b.checkpoint(ctx, job.ID, key, ImportProgress{Rows: watermark}); err != nil {
+				b.logger.Warn("Checkpoint save failed", zap.String("key", key), zap.Error(err))
+			}
+		}
+	}
+
+	close(errChan)
+	if err := <-errChan; err != nil {
+		return imported, err
+	}
+	if err := ctx.Err(); err != nil {
+		return imported, err
+	}
+	return imported, b.checkpoint(ctx, job.ID, key, ImportProgress{Rows: watermark, Done: true})
+}
+
+func (b *BulkImporter) checkpoint(ctx context.Context, jobID, key string, p ImportProgress) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p.UpdatedAt = time.Now().UTC()
+	b.progress[key] = p
+	return b.checkpoints.Save(ctx, jobID, b.progress)
+}
+
+// readFile decodes key from row skip onwards, validating each row and
+// cutting batches for the workers
+func (b *BulkImporter) readFile(ctx context.Context, job ImportJob, key string, skip int64, out chan<- importBatch) error {
+	batch := importBatch{}
+	emit := func(row int64, rec importRecord) error {
+		if len(rec.Vector) != job.Dim {
+			return fmt.Errorf("row %d: vector has dimension %d, expected %d", row, len(rec.Vector), job.Dim)
+		}
+		id := rowID(key, row)
+		if rec.ID != nil {
+			id = *rec.ID
+		}
+		batch.vectors = append(batch.vectors, Vector{ID: id, Values: rec.Vector, Metadata: rec.Metadata})
+		if len(batch.vectors) < job.BatchSize {
+			return nil
+		}
+		select {
+		case out <- batch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		batch = importBatch{seq: batch.seq + 1}
+		return nil
+	}
+
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(key)); ext {
+	case ".jsonl", ".ndjson":
+		err = b.readJSONL(ctx, key, skip, emit)
+	case ".parquet":
+		err = b.readParquet(ctx, key, skip, job.BatchSize, emit)
+	default:
+		err = fmt.Errorf("unsupported import format %q", ext)
+	}
+	if err != nil {
+		return err
+	}
+	if len(batch.vectors) > 0 {
+		select {
+		case out <- batch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *BulkImporter) readJSONL(ctx context.Context, key string, skip int64, emit func(int64, importRecord) error) error {
+	body, err := b.source.Open(ctx, key)
+	if err != nil {
+		return fmt.Errorf("open failed: %w", err)
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), maxJSONLLine)
+	var row int64
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		row++
+		if row <= skip {
+			continue
+		}
+		var rec importRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("row %d: %w", row, err)
+		}
+		if err := emit(row, rec); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (b *BulkImporter) readParquet(ctx context.Context, key string, skip int64, batchSize int, emit func(int64, importRecord) error) error {
+	ra, size, err := b.source.OpenReaderAt(ctx, key)
+	if err != nil {
+		return fmt.Errorf("open failed: %w", err)
+	}
+	file, err := parquet.OpenFile(ra, size)
+	if err != nil {
+		return fmt.Errorf("not a readable parquet file: %w", err)
+	}
+	reader := parquet.NewGenericReader[parquetRecord](file)
+	defer reader.Close()
+	if skip > 0 {
+		if err := reader.SeekToRow(skip); err != nil {
+			return fmt.Errorf("seek to row %d failed: %w", skip, err)
+		}
+	}
+
+	buf := make([]parquetRecord, batchSize)
+	row := skip
+	for {
+		n, readErr := reader.Read(buf)
+		for _, r := range buf[:n] {
+			row++
+			rec := importRecord{ID: r.ID, Vector: r.Vector}
+			if r.Metadata != nil && *r.Metadata != "" {
+				if err := json.Unmarshal([]byte(*r.Metadata), &rec.Metadata); err != nil {
+					return fmt.Errorf("row %d metadata: %w", row, err)
+				}
+			}
+			if err := emit(row, rec); err != nil {
+				return err
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("read failed after row %d: %w", row, readErr)
+		}
+	}
+}
+
+// rowID derives a stable 63-bit ID from a file and 1-based row number
+func rowID(key string, row int64) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s:%d", key, row)
+	return int64(h.Sum64() >> 1)
+}
@@ -0,0 +1,506 @@
+// filter.go - Metadata Filter Expressions for Vector Search
+package vectordb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrInvalidFilter wraps every filter parse and validation error
+var ErrInvalidFilter = errors.New("invalid vector filter")
+
+// FieldType is the declared type of a metadata field
+type FieldType int
+
+const (
+	FieldString FieldType = iota
+	FieldInt
+	FieldFloat
+	FieldBool
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case FieldString:
+		return "string"
+	case FieldInt:
+		return "int"
+	case FieldFloat:
+		return "float"
+	case FieldBool:
+		return "bool"
+	default:
+		return fmt.Sprintf("FieldType(%d)", int(t))
+	}
+}
+
+// MetadataSchema declares the filterable metadata fields of a collection
+type MetadataSchema map[string]FieldType
+
+// CompareOp is a leaf comparison operator
+type CompareOp string
+
+const (
+	OpEq CompareOp = "="
+	OpNe CompareOp = "!="
+	OpLt CompareOp = "<"
+	OpLe CompareOp = "<="
+	OpGt CompareOp = ">"
+	OpGe CompareOp = ">="
+)
+
+var negatedOp = map[CompareOp]CompareOp{
+	OpEq: OpNe, OpNe: OpEq,
+	OpLt: OpGe, OpGe: OpLt,
+	OpGt: OpLe, OpLe: OpGt,
+}
+
+// Filter is a parsed predicate over vector metadata such as
+//
+//	tenant_id = 'acme' AND doc_type IN ('pdf', 'html') AND NOT archived = true
+//
+// It supports = != < <= > >= IN and NOT IN on fields, combined with AND,
+// OR, NOT and parentheses. Values are quoted strings, integers, floats and
+// true/false. Negations are pushed down to the comparisons at parse time,
+// so backends only translate AND, OR and leaf predicates.
+type Filter struct {
+	root filterNode
+	expr string
+}
+
+type filterNode interface{ isFilterNode() }
+
+type andNode struct{ children []filterNode }
+type orNode struct{ children []filterNode }
+
+type compareNode struct {
+	field string
+	op    CompareOp
+	value interface{} // string, int64, float64 or bool
+}
+
+type inNode struct {
+	field  string
+	values []interface{}
+	negate bool
+}
+
+func (andNode) isFilterNode()     {}
+func (orNode) isFilterNode()      {}
+func (compareNode) isFilterNode() {}
+func (inNode) isFilterNode()      {}
+
+// ParseFilter compiles a filter expression; an empty expression yields a
+// nil filter, which matches everything
+func ParseFilter(expr string) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	toks, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.toks[p.pos].text)
+	}
+	return &Filter{root: root, expr: expr}, nil
+}
+
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// Validate checks every referenced field against schema: the field must be
+// declared, values must match its type, and ordering comparisons are only
+// allowed on numbers
+func (f *Filter) Validate(schema MetadataSchema) error {
+	if f == nil {
+		return nil
+	}
+	return validateNode(f.root, schema)
+}
+
+func validateNode(n filterNode, schema MetadataSchema) error {
+	switch n := n.(type) {
+	case andNode:
+		for _, c := range n.children {
+			if err := validateNode(c, schema); err != nil {
+				return err
+			}
+		}
+	case orNode:
+		for _, c := range n.children {
+			if err := validateNode(c, schema); err != nil {
+				return err
+			}
+		}
+	case compareNode:
+		typ, ok := schema[n.field]
+		if !ok {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, n.field)
+		}
+		if err := checkValue(n.field, typ, n.value); err != nil {
+			return err
+		}
+		if n.op != OpEq && n.op != OpNe && typ != FieldInt && typ != FieldFloat {
+			return fmt.Errorf("%w: %s is not supported on %s field %q", ErrInvalidFilter, n.op, typ, n.field)
+		}
+	case inNode:
+		typ, ok := schema[n.field]
+		if !ok {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, n.field)
+		}
+		for _, v := range n.values {
+			if err := checkValue(n.field, typ, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkValue(field string, typ FieldType, v interface{}) error {
+	ok := false
+	switch v.(type) {
+	case string:
+		ok = typ == FieldString
+	case int64:
+		ok = typ == FieldInt || typ == FieldFloat
+	case float64:
+		ok = typ == FieldFloat
+	case bool:
+		ok = typ == FieldBool
+	}
+	if !ok {
+		return fmt.Errorf("%w: %q is a %s field, got %v", ErrInvalidFilter, field, typ, v)
+	}
+	return nil
+}
+
+// schemaRegistry holds per-collection metadata schemas for an adapter
+type schemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[string]MetadataSchema
+}
+
+// SetSchema declares the filterable metadata of a collection; filters on
+// collections without a schema are checked for syntax only
+func (r *schemaRegistry) SetSchema(collection string, schema MetadataSchema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.schemas == nil {
+		r.schemas = make(map[string]MetadataSchema)
+	}
+	r.schemas[collection] = schema
+}
+
+func (r *schemaRegistry) schema(collection string) (MetadataSchema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.schemas[collection]
+	return s, ok
+}
+
+func (r *schemaRegistry) validateFilter(collection string, f *Filter) error {
+	if schema, ok := r.schema(collection); ok {
+		return f.Validate(schema)
+	}
+	return nil
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+}
+
+func lexFilter(s string) ([]filterToken, error) {
+	var toks []filterToken
+	r := []rune(s)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			toks = append(toks, filterToken{tokLParen, "("})
+			i++
+		case c == ')':
+			toks = append(toks, filterToken{tokRParen, ")"})
+			i++
+		case c == ',':
+			toks = append(toks, filterToken{tokComma, ","})
+			i++
+		case c == '\'' || c == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(r) && r[j] != c; j++ {
+				if r[j] == '\\' && j+1 < len(r) {
+					j++
+				}
+				sb.WriteRune(r[j])
+			}
+			if j >= len(r) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			toks = append(toks, filterToken{tokString, sb.String()})
+			i = j + 1
+		case strings.ContainsRune("=!<>", c):
+			j := i + 1
+			if j < len(r) && (r[j] == '=' || (c == '<' && r[j] == '>')) {
+				j++
+			}
+			op := string(r[i:j])
+			switch op {
+			case "!":
+				return nil, fmt.Errorf("%w: unexpected '!'", ErrInvalidFilter)
+			case "==":
+				op = "="
+			case "<>":
+				op = "!="
+			}
+			toks = append(toks, filterToken{tokOp, op})
+			i = j
+		case c == '-' || unicode.IsDigit(c):
+			j := i + 1
+			for j < len(r) && (unicode.IsDigit(r[j]) || strings.ContainsRune(".eE+-", r[j])) {
+				j++
+			}
+			toks = append(toks, filterToken{tokNumber, string(r[i:j])})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i + 1
+			for j < len(r) && (r[j] == '_' || unicode.IsLetter(r[j]) || unicode.IsDigit(r[j])) {
+				j++
+			}
+			toks = append(toks, filterToken{tokIdent, string(r[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q", ErrInvalidFilter, c)
+		}
+	}
+	return toks, nil
+}
+
+// Parser
+
+type filterParser struct {
+	toks []filterToken
+	pos  int
+}
+
+func (p *filterParser) keyword(kw string) bool {
+	if p.pos < len(p.toks) && p.toks[p.pos].kind == tokIdent && strings.EqualFold(p.toks[p.pos].text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []filterNode{first}
+	for p.keyword("OR") {
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return orNode{children}, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	children := []filterNode{first}
+	for p.keyword("AND") {
+		next, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return andNode{children}, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.keyword("NOT") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negate(inner), nil
+	}
+	if p.pos < len(p.toks) && p.toks[p.pos].kind == tokLParen {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.toks) || p.toks[p.pos].kind != tokRParen {
+			return nil, fmt.Errorf("%w: missing ')'", ErrInvalidFilter)
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *filterParser) parsePredicate() (filterNode, error) {
+	if p.pos >= len(p.toks) || p.toks[p.pos].kind != tokIdent {
+		return nil, fmt.Errorf("%w: expected a field name", ErrInvalidFilter)
+	}
+	field := p.toks[p.pos].text
+	p.pos++
+
+	negateIn := p.keyword("NOT")
+	if p.keyword("IN") {
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{field: field, values: values, negate: negateIn}, nil
+	}
+	if negateIn {
+		return nil, fmt.Errorf("%w: expected IN after NOT", ErrInvalidFilter)
+	}
+
+	if p.pos >= len(p.toks) || p.toks[p.pos].kind != tokOp {
+		return nil, fmt.Errorf("%w: expected an operator after %q", ErrInvalidFilter, field)
+	}
+	op := CompareOp(p.toks[p.pos].text)
+	p.pos++
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{field: field, op: op, value: value}, nil
+}
+
+func (p *filterParser) parseList() ([]interface{}, error) {
+	if p.pos >= len(p.toks) || p.toks[p.pos].kind != tokLParen {
+		return nil, fmt.Errorf("%w: expected '(' after IN", ErrInvalidFilter)
+	}
+	p.pos++
+	var values []interface{}
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		if p.pos >= len(p.toks) {
+			return nil, fmt.Errorf("%w: missing ')'", ErrInvalidFilter)
+		}
+		switch p.toks[p.pos].kind {
+		case tokComma:
+			p.pos++
+		case tokRParen:
+			p.pos++
+			return values, nil
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q in list", ErrInvalidFilter, p.toks[p.pos].text)
+		}
+	}
+}
+
+func (p *filterParser) parseValue() (interface{}, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("%w: expected a value", ErrInvalidFilter)
+	}
+	tok := p.toks[p.pos]
+	p.pos++
+	switch tok.kind {
+	case tokString:
+		return tok.text, nil
+	case tokNumber:
+		if i, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad number %q", ErrInvalidFilter, tok.text)
+		}
+		return f, nil
+	case tokIdent:
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: expected a value, got %q", ErrInvalidFilter, tok.text)
+}
+
+// negate applies De Morgan's laws so NOT never reaches the backends
+func negate(n filterNode) filterNode {
+	switch n := n.(type) {
+	case andNode:
+		out := make([]filterNode, len(n.children))
+		for i, c := range n.children {
+			out[i] = negate(c)
+		}
+		return orNode{out}
+	case orNode:
+		out := make([]filterNode, len(n.children))
+		for i, c := range n.children {
+			out[i] = negate(c)
+		}
+		return andNode{out}
+	case compareNode:
+		n.op = negatedOp[n.op]
+		return n
+	case inNode:
+		n.negate = !n.negate
+		return n
+	}
+	return n
+}
+
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,212 @@
+// iterator.go - Server-Side Paging Over Whole Collections
+package vectordb
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+const defaultIterBatchSize = 1000
+
+// SearchIterator pages through the rows of a collection without holding
+// more than one batch in memory. Next returns io.EOF once exhausted.
+type SearchIterator interface {
+	Next(ctx context.Context) ([]Vector, error)
+	Close() error
+}
+
+// IterateOptions controls a scan. A nil Filter matches every row of the
+// context tenant; Values are only returned with WithVectors, as they
+// dominate the transfer size.
+type IterateOptions struct {
+	Filter      *Filter
+	BatchSize   int
+	WithVectors bool
+}
+
+func (o IterateOptions) batchSize() int {
+	if o.BatchSize <= 0 {
+		return defaultIterBatchSize
+	}
+	return o.BatchSize
+}
+
+// Iterable is implemented by backends that can scan a collection in
+// server-side pages, for exports and analytics over entire collections
+type Iterable interface {
+	Iterate(ctx context.Context, collection string, opts IterateOptions) (SearchIterator, error)
+}
+
+var (
+	_ Iterable = (*MilvusAdapter)(nil)
+	_ Iterable = (*QdrantAdapter)(nil)
+)
+
+// Iterate scans the context tenant's partition with a Milvus query
+// iterator, which pages by primary key on the server
+func (m *MilvusAdapter) Iterate(ctx context.Context, collection string, opts IterateOptions) (SearchIterator, error) {
+	if err := m.validateFilter(collection, opts.Filter); err != nil {
+		return nil, err
+	}
+	partition := tenantPartition(TenantFromContext(ctx))
+	exists, err := m.partitionExists(ctx, collection, partition, false)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return emptyIterator{}, nil
+	}
+
+	fields := []string{"id", "metadata"}
+	if opts.WithVectors {
+		fields = append(fields, "vector")
+	}
+	opt := client.NewQueryIteratorOption(collection).
+		WithPartitions(partition).
+		WithOutputFields(fields...).
+		WithBatchSize(opts.batchSize())
+	if opts.Filter != nil {
+		opt = opt.WithExpr(milvusExpr(opts.Filter.root))
+	}
+
+	if err := m.connPool.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer m.connPool.Release(1)
+
+	it, err := m.client.QueryIterator(ctx, opt)
+	if err != nil {
+		m.metrics.ErrorCount.Inc()
+		return nil, fmt.Errorf("query iterator failed: %w", err)
+	}
+	recordPartitionUsage("milvus", collection, partition, "iterate", 1)
+	return &milvusIterator{adapter: m, it: it}, nil
+}
+
+type milvusIterator struct {
+	adapter *MilvusAdapter
+	it      *client.QueryIterator
+}
+
+func (i *milvusIterator) Next(ctx context.Context) ([]Vector, error) {
+	if err := i.adapter.connPool.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer i.adapter.connPool.Release(1)
+
+	rs, err := i.it.Next(ctx)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		i.adapter.metrics.ErrorCount.Inc()
+		return nil, fmt.Errorf("query iterator page failed: %w", err)
+	}
+
+	ids, ok := rs.GetColumn("id").(*entity.ColumnInt64)
+	if !ok || ids.Len() == 0 {
+		return nil, io.EOF
+	}
+	var metas [][]byte
+	if col, ok := rs.GetColumn("metadata").(*entity.ColumnJSONBytes); ok {
+		metas = col.Data()
+	}
+	var values [][]float32
+	if col, ok := rs.GetColumn("vector").(*entity.ColumnFloatVector); ok {
+		values = col.Data()
+	}
+
+	out := make([]Vector, ids.Len())
+	for n, id := range ids.Data() {
+		out[n].ID = id
+		if n < len(metas) {
+			out[n].Metadata = deserializeMetadata(metas[n])
+		}
+		if n < len(values) {
+			out[n].Values = values[n]
+		}
+	}
+	return out, nil
+}
+
+func (i *milvusIterator) Close() error { return nil }
+
+// Iterate scans the context tenant's points with Qdrant scroll paging
+func (q *QdrantAdapter) Iterate(ctx context.Context, collection string, opts IterateOptions) (SearchIterator, error) {
+	if err := q.validateFilter(collection, opts.Filter); err != nil {
+		return nil, err
+	}
+	tenant := TenantFromContext(ctx)
+	scoped := qdrantFilter(opts.Filter)
+	if scoped == nil {
+		scoped = &qdrant.Filter{}
+	}
+	scoped.Must = append(scoped.Must, qdrant.NewMatchKeyword(tenantPayloadKey, tenant))
+	recordPartitionUsage("qdrant", collection, tenantPartition(tenant), "iterate", 1)
+
+	limit := uint32(opts.batchSize())
+	return &qdrantIterator{
+		adapter: q,
+		req: &qdrant.ScrollPoints{
+			CollectionName: collection,
+			Filter:         scoped,
+			Limit:          &limit,
+			WithPayload:    qdrant.NewWithPayload(true),
+			WithVectors:    qdrant.NewWithVectors(opts.WithVectors),
+		},
+	}, nil
+}
+
+type qdrantIterator struct {
+	adapter *QdrantAdapter
+	req     *qdrant.ScrollPoints
+	done    bool
+}
+
+func (i *qdrantIterator) Next(ctx context.Context) ([]Vector, error) {
+	if i.done {
+		return nil, io.EOF
+	}
+	client, release, err := i.adapter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := client.GetPointsClient().Scroll(ctx, i.req)
+	if err != nil {
+		i.adapter.metrics.ErrorCount.Inc()
+		return nil, fmt.Errorf("scroll failed: %w", err)
+	}
+	// the next page starts at the returned offset; none means this was
+	// the last page
+	i.req.Offset = resp.GetNextPageOffset()
+	i.done = i.req.Offset == nil
+
+	points := resp.GetResult()
+	if len(points) == 0 {
+		i.done = true
+		return nil, io.EOF
+	}
+	out := make([]Vector, len(points))
+	for n, p := range points {
+		out[n] = Vector{
+			ID:       vectorID(p.GetId(), p.GetPayload()),
+			Values:   p.GetVectors().GetVector().GetData(),
+			Metadata: payloadToMap(p.GetPayload()),
+		}
+	}
+	return out, nil
+}
+
+func (i *qdrantIterator) Close() error { return nil }
+
+type emptyIterator struct{}
+
+func (emptyIterator) Next(context.Context) ([]Vector, error) { return nil, io.EOF }
+func (emptyIterator) Close() error                           { return nil }
@@ -0,0 +1,505 @@
+// jobs.go - Persistent Asynchronous Index Build and Backfill Jobs
+package vectordb
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// jobHeartbeat is how often a running job persists progress and checks
+	// for cancellation
+	jobHeartbeat = 10 * time.Second
+	// jobLease is how long a job may go without a heartbeat before another
+	// controller may resume it
+	jobLease = 3 * jobHeartbeat
+)
+
+// ErrJobNotFound is returned for unknown job IDs
+var ErrJobNotFound = errors.New("job not found")
+
+// JobKind names the work a job performs
+type JobKind string
+
+const (
+	JobIndexBuild JobKind = "index_build"
+	JobBackfill   JobKind = "backfill"
+)
+
+// JobState is a job's lifecycle position. Succeeded, failed and cancelled
+// are final.
+type JobState string
+
+const (
+	JobPending   JobState = "pending"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Final reports whether the job will not change state again
+func (s JobState) Final() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// Job is the persisted record of one index build or backfill. Completed
+// and Total count indexed rows for index builds; backfills report rows
+// imported in Completed and leave Total zero, as the corpus size is not
+// known up front.
+type Job struct {
+	ID         string
+	Kind       JobKind
+	Collection string
+	State      JobState
+	Index      *IndexConfig
+	Import     *ImportJob
+	Completed  int64
+	Total      int64
+	Error      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// jobParams is the JSON payload that lets a job be re-run after a restart
+type jobParams struct {
+	Index  *IndexConfig `json:"index,omitempty"`
+	Import *ImportJob   `json:"import,omitempty"`
+}
+
+// JobStore persists jobs in Postgres. Each running job is leased to one
+// controller by a heartbeat, so a job whose controller died is picked up by
+// whichever controller next calls Resume.
+type JobStore struct {
+	db *sql.DB
+}
+
+func NewJobStore(db *sql.DB) *JobStore {
+	return &JobStore{db: db}
+}
+
+func (s *JobStore) create(ctx context.Context, job Job) error {
+	params, err := json.Marshal(jobParams{Index: job.Index, Import: job.Import})
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO vector_jobs (id, kind, collection, state, params)
+		VALUES ($1, $2, $3, $4, $5)`,
+		job.ID, job.Kind, job.Collection, job.State, params)
+	if err != nil {
+		return fmt.Errorf("job create failed: %w", err)
+	}
+	return nil
+}
+
+func (s *JobStore) Get(ctx context.Context, id string) (Job, error) {
+	job := Job{ID: id}
+	var params []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT kind, collection, state, params, completed, total, error, created_at, updated_at
+		FROM vector_jobs WHERE id = $1`, id).
+		Scan(&job.Kind, &job.Collection, &job.State, &params, &job.Completed, &job.Total,
+			&job.Error, &job.CreatedAt, &job.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return job, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if err != nil {
+		return job, fmt.Errorf("job lookup failed: %w", err)
+	}
+	var p jobParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return job, fmt.Errorf("corrupt job params for %s: %w", id, err)
+	}
+	job.Index, job.Import = p.Index, p.Import
+	return job, nil
+}
+
+// claim leases an unfinished job to owner unless another controller holds
+// a live lease on it
+func (s *JobStore) claim(ctx context.Context, id, owner string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE vector_jobs
+		SET state = 'running', owner = $2, heartbeat = NOW(), updated_at = NOW()
+		WHERE id = $1 AND state IN ('pending', 'running')
+		  AND (owner = '' OR owner = $2 OR heartbeat < NOW() - make_interval(secs => $3))`,
+		id, owner, jobLease.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("job claim failed: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// heartbeat records progress, renews the lease and returns the job's
+// current state so the runner notices a cancellation
+func (s *JobStore) heartbeat(ctx context.Context, id, owner string, completed, total int64) (JobState, error) {
+	var state JobState
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE vector_jobs
+		SET completed = $3, total = $4, heartbeat = NOW(), updated_at = NOW()
+		WHERE id = $1 AND owner = $2
+		RETURNING state`, id, owner, completed, total).Scan(&state)
+	if err != nil {
+		return "", fmt.Errorf("job heartbeat failed: %w", err)
+	}
+	return state, nil
+}
+
+// finish moves a running job to a final state; a job cancelled meanwhile
+// stays cancelled
+func (s *JobStore) finish(ctx context.Context, id, owner string, state JobState, completed, total int64, msg string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE vector_jobs
+		SET state = $3, completed = $4, total = $5, error = $6, updated_at = NOW()
+		WHERE id = $1 AND owner = $2 AND state = 'running'`,
+		id, owner, state, completed, total, msg)
+	if err != nil {
+		return fmt.Errorf("job finish failed: %w", err)
+	}
+	return nil
+}
+
+func (s *JobStore) cancel(ctx context.Context, id string) (JobState, error) {
+	var state JobState
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE vector_jobs
+		SET state = CASE WHEN state IN ('pending', 'running') THEN 'cancelled' ELSE state END,
+		    updated_at = NOW()
+		WHERE id = $1
+		RETURNING state`, id).Scan(&state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("job cancel failed: %w", err)
+	}
+	return state, nil
+}
+
+// orphaned lists unfinished jobs with no live lease
+func (s *JobStore) orphaned(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id FROM vector_jobs
+		WHERE state IN ('pending', 'running')
+		  AND (owner = '' OR heartbeat < NOW() - make_interval(secs => $1))
+		ORDER BY created_at`, jobLease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("job scan failed: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// JobManagerConfig wires a JobManager. Milvus runs index builds; Store,
+// Source and Checkpoints run backfills. Owner identifies this controller
+// in job leases and defaults to hostname and PID.
+type JobManagerConfig struct {
+	Jobs        *JobStore
+	Milvus      *MilvusAdapter
+	Store       Store
+	Source      ImportSource
+	Checkpoints CheckpointStore
+	Owner       string
+}
+
+// JobManager runs index builds and backfills in the background so callers
+// get a job ID immediately instead of blocking for the duration
+type JobManager struct {
+	cfg    JobManagerConfig
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewJobManager(cfg JobManagerConfig, logger *zap.Logger) *JobManager {
+	if cfg.Owner == "" {
+		host, _ := os.Hostname()
+		cfg.Owner = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return &JobManager{
+		cfg:     cfg,
+		logger:  logger.Named("vector_jobs"),
+		running: make(map[string]context.CancelFunc),
+	}
+}
+
+// StartIndexBuild replaces a Milvus collection's index in the background.
+// The collection is released until the build finishes; cancelling the job
+// stops waiting on it but leaves the collection released until another
+// build completes.
+func (m *JobManager) StartIndexBuild(ctx context.Context, collection string, cfg IndexConfig) (Job, error) {
+	if m.cfg.Milvus == nil {
+		return Job{}, fmt.Errorf("index build jobs need a Milvus adapter")
+	}
+	cfg = cfg.withDefaults()
+	return m.start(ctx, Job{Kind: JobIndexBuild, Collection: collection, Index: &cfg})
+}
+
+// StartBackfill runs a bulk import in the background. The import is
+// checkpointed under the job ID, so a resumed job continues where the
+// last controller stopped.
+func (m *JobManager) StartBackfill(ctx context.Context, imp ImportJob) (Job, error) {
+	if m.cfg.Store == nil || m.cfg.Source == nil || m.cfg.Checkpoints == nil {
+		return Job{}, fmt.Errorf("backfill jobs need a store, source and checkpoint store")
+	}
+	return m.start(ctx, Job{Kind: JobBackfill, Collection: imp.Collection, Import: &imp})
+}
+
+func (m *JobManager) start(ctx context.Context, job Job) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	job.ID = id
+	job.State = JobPending
+	if job.Import != nil {
+		job.Import.ID = id
+	}
+	if err := m.cfg.Jobs.create(ctx, job); err != nil {
+		return Job{}, err
+	}
+	m.launch(job.ID)
+	return m.cfg.Jobs.Get(ctx, job.ID)
+}
+
+// Status returns a job's persisted state and progress
+func (m *JobManager) Status(ctx context.Context, id string) (Job, error) {
+	return m.cfg.Jobs.Get(ctx, id)
+}
+
+// Cancel marks a job cancelled. A job running on this controller stops
+// at once; one running elsewhere stops at its next heartbeat.
+func (m *JobManager) Cancel(ctx context.Context, id string) error {
+	state, err := m.cfg.Jobs.cancel(ctx, id)
+	if err != nil {
+		return err
+	}
+	if state != JobCancelled {
+		return fmt.Errorf("job %s already %s", id, state)
+	}
+	m.mu.Lock()
+	if stop, ok := m.running[id]; ok {
+		stop()
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// Resume restarts unfinished jobs whose controller stopped heartbeating.
+// Call it at startup and periodically to adopt jobs from failed peers.
+func (m *JobManager) Resume(ctx context.Context) error {
+	ids, err := m.cfg.Jobs.orphaned(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		m.launch(id)
+	}
+	return nil
+}
+
+// Close stops local runs without finishing them, leaving them for Resume
+// on this or another controller
+func (m *JobManager) Close() {
+	m.mu.Lock()
+	for _, stop := range m.running {
+		stop()
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+func (m *JobManager) launch(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.running[id]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.running[id] = cancel
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() {
+			m.mu.Lock()
+			delete(m.running, id)
+			m.mu.Unlock()
+			cancel()
+		}()
+		m.run(ctx, id)
+	}()
+}
+
+// jobProgress is updated by the running work and read by the heartbeat
+type jobProgress struct {
+	completed atomic.Int64
+	total     atomic.Int64
+}
+
+func (m *JobManager) run(ctx context.Context, id string) {
+	owner := m.cfg.Owner
+	logger := m.logger.With(zap.String("job", id))
+
+	claimed, err := m.cfg.Jobs.claim(ctx, id, owner)
+	if err != nil || !claimed {
+		if err != nil {
+			logger.Error("Job claim failed", zap.Error(err))
+		}
+		return
+	}
+	job, err := m.cfg.Jobs.Get(ctx, id)
+	if err != nil {
+		logger.Error("Job load failed", zap.Error(err))
+		return
+	}
+	logger = logger.With(zap.String("kind", string(job.Kind)), zap.String("collection", job.Collection))
+	// recorded progress means a previous controller got as far as
+	// starting the work
+	resumed := job.Completed > 0 || job.Total > 0
+
+	progress := &jobProgress{}
+	progress.completed.Store(job.Completed)
+	progress.total.Store(job.Total)
+
+	workCtx, stopWork := context.WithCancel(ctx)
+	defer stopWork()
+	beatDone := make(chan struct{})
+	go func() {
+		defer close(beatDone)
+		m.heartbeat(workCtx, job, progress, stopWork, logger)
+	}()
+
+	logger.Info("Job started", zap.Bool("resumed", resumed))
+	switch job.Kind {
+	case JobIndexBuild:
+		err = m.cfg.Milvus.buildIndexTracked(workCtx, job.Collection, *job.Index, resumed, func(indexed, total int64) {
+			progress.completed.Store(indexed)
+			progress.total.Store(total)
+		})
+	case JobBackfill:
+		var report ImportReport
+		importer := NewBulkImporter(m.cfg.Store, m.cfg.Source, m.cfg.Checkpoints, m.logger)
+		report, err = importer.Run(workCtx, *job.Import)
+		progress.completed.Store(report.Resumed + report.Imported)
+	default:
+		err = fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+	stopWork()
+	<-beatDone
+
+	if errors.Is(err, context.Canceled) {
+		// stopped by Close, Cancel or a lost lease rather than by the work
+		// itself; the job is either already cancelled or left for Resume
+		logger.Info("Job stopped")
+		return
+	}
+
+	state, msg := JobSucceeded, ""
+	if err != nil {
+		state, msg = JobFailed, err.Error()
+		logger.Error("Job failed", zap.Error(err))
+	} else {
+		logger.Info("Job succeeded", zap.Int64("completed", progress.completed.Load()))
+	}
+	finishCtx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if err := m.cfg.Jobs.finish(finishCtx, id, owner, state, progress.completed.Load(), progress.total.Load(), msg); err != nil {
+		logger.Error("Job state save failed", zap.Error(err))
+	}
+}
+
+// heartbeat persists progress until the work ends, stopping it when the
+// job is cancelled or the lease is lost
+func (m *JobManager) heartbeat(ctx context.Context, job Job, progress *jobProgress, stop context.CancelFunc, logger *zap.Logger) {
+	ticker := time.NewTicker(jobHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if job.Kind == JobBackfill {
+			if rows, err := m.checkpointedRows(ctx, job.ID); err == nil {
+				progress.completed.Store(rows)
+			}
+		}
+		state, err := m.cfg.Jobs.heartbeat(ctx, job.ID, m.cfg.Owner, progress.completed.Load(), progress.total.Load())
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			logger.Warn("Job lease lost, stopping")
+			stop()
+			return
+		case err != nil:
+			logger.Warn("Job heartbeat failed", zap.Error(err))
+		case state == JobCancelled:
+			logger.Info("Job cancelled")
+			stop()
+			return
+		}
+	}
+}
+
+func (m *JobManager) checkpointedRows(ctx context.Context, jobID string) (int64, error) {
+	progress, err := m.cfg.Checkpoints.Load(ctx, jobID)
+	if err != nil {
+		return 0, err
+	}
+	var rows int64
+	for _, p := range progress {
+		rows += p.Rows
+	}
+	return rows, nil
+}
+
+func newJobID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("job ID generation failed: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+/*
+CREATE TABLE IF NOT EXISTS vector_jobs (
+    id          VARCHAR(64) PRIMARY KEY,
+    kind        VARCHAR(32) NOT NULL,
+    collection  VARCHAR(255) NOT NULL,
+    state       VARCHAR(16) NOT NULL,
+    params      JSONB NOT NULL DEFAULT '{}',
+    completed   BIGINT NOT NULL DEFAULT 0,
+    total       BIGINT NOT NULL DEFAULT 0,
+    error       TEXT NOT NULL DEFAULT '',
+    owner       VARCHAR(255) NOT NULL DEFAULT '',
+    heartbeat   TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_vector_jobs_unfinished
+    ON vector_jobs (created_at) WHERE state IN ('pending', 'running');
+*/
@@ -0,0 +1,102 @@
+// memory_index.go - Agent Memory Embeddings on a Vector Store
+package vectordb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"cirium.ai/core/memory"
+)
+
+const (
+	memoryAgentField = "agent_id"
+	memoryIDField    = "memory_id"
+)
+
+var (
+	_ memory.VectorIndex  = (*MemoryIndex)(nil)
+	_ memory.VectorEraser = (*MemoryIndex)(nil)
+)
+
+// MemoryIndex keeps agent memory embeddings in one collection of a Store,
+// as the memory adapter's VectorIndex. Memory IDs are UUIDs, so each point
+// is addressed by a hash of its agent and memory ID and carries both in
+// its metadata. Operations run in the memory tenant of the context.
+type MemoryIndex struct {
+	store      Store
+	collection string
+}
+
+// NewMemoryIndex stores embeddings in collection, which must exist with
+// the embedder's dimension
+func NewMemoryIndex(store Store, collection string) *MemoryIndex {
+	store.SetSchema(collection, MetadataSchema{
+		memoryAgentField: FieldString,
+		memoryIDField:    FieldString,
+	})
+	return &MemoryIndex{store: store, collection: collection}
+}
+
+// Upsert writes the embedding of one memory
+func (x *MemoryIndex) Upsert(ctx context.Context, agentID, memoryID string, vector []float32) error {
+	return x.store.Upsert(x.scope(ctx), x.collection, []Vector{{
+		ID:     memoryPointID(agentID, memoryID),
+		Values: vector,
+		Metadata: map[string]interface{}{
+			memoryAgentField: agentID,
+			memoryIDField:    memoryID,
+		},
+	}})
+}
+
+// Search finds the k memories of agentID nearest to vector
+func (x *MemoryIndex) Search(ctx context.Context, agentID string, vector []float32, k int) ([]memory.VectorMatch, error) {
+	filter, err := ParseFilter(memoryAgentField + " = " + quoteFilterString(agentID))
+	if err != nil {
+		return nil, err
+	}
+	results, err := x.store.Search(x.scope(ctx), x.collection, vector, k, filter)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]memory.VectorMatch, 0, len(results))
+	for _, r := range results {
+		id, ok := r.Metadata[memoryIDField].(string)
+		if !ok {
+			return nil, fmt.Errorf("point %d in %s has no %s", r.ID, x.collection, memoryIDField)
+		}
+		matches = append(matches, memory.VectorMatch{MemoryID: id, Score: r.Score})
+	}
+	return matches, nil
+}
+
+// Delete removes the embeddings of memoryIDs
+func (x *MemoryIndex) Delete(ctx context.Context, agentID string, memoryIDs []string) error {
+	if len(memoryIDs) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(memoryIDs))
+	for i, id := range memoryIDs {
+		ids[i] = memoryPointID(agentID, id)
+	}
+	return x.store.Delete(x.scope(ctx), x.collection, ids)
+}
+
+// scope carries the memory tenant of ctx over to the vector store
+func (x *MemoryIndex) scope(ctx context.Context) context.Context {
+	return WithTenant(ctx, memory.TenantFromContext(ctx))
+}
+
+// memoryPointID is the positive point ID of one agent's memory
+func memoryPointID(agentID, memoryID string) int64 {
+	sum := sha256.Sum256([]byte(agentID + "\x00" + memoryID))
+	return int64(binary.BigEndian.Uint64(sum[:8]) >> 1)
+}
+
+// quoteFilterString quotes s as a filter string literal
+func quoteFilterString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,60 @@
+// metrics.go - Shared Vector Backend Metrics
+package vectordb
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	vectorQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "Wavine_vectordb_query_duration_seconds",
+		Help:    "Vector search latency by backend",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"backend"})
+
+	vectorInsertDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "Wavine_vectordb_insert_duration_seconds",
+		Help:    "Vector batch insert latency by backend",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"backend"})
+
+	vectorErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_vectordb_errors_total",
+		Help: "Failed vector database operations by backend",
+	}, []string{"backend"})
+
+	vectorConnectionState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "Wavine_vectordb_connection_up",
+		Help: "1 while the backend connection is healthy",
+	}, []string{"backend"})
+
+	vectorPartitionUsage = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "Wavine_vectordb_partition_usage_total",
+		Help: "Per-tenant partition usage: vectors upserted and deleted, searches run",
+	}, []string{"backend", "collection", "partition", "op"})
+
+	rerankDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "Wavine_vectordb_rerank_duration_seconds",
+		Help:    "Reranking latency by collection",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"collection"})
+)
+
+func init() {
+	prometheus.MustRegister(vectorQueryDuration, vectorInsertDuration, vectorErrors, vectorConnectionState, vectorPartitionUsage, rerankDuration)
+}
+
+// recordPartitionUsage counts n units of op against a tenant partition
+func recordPartitionUsage(backend, collection, partition, op string, n int) {
+	vectorPartitionUsage.WithLabelValues(backend, collection, partition, op).Add(float64(n))
+}
+
+// newVectorDBMetrics returns the shared collectors labelled for one backend
+func newVectorDBMetrics(backend string) *VectorDBMetrics {
+	return &VectorDBMetrics{
+		QueryDuration:   vectorQueryDuration.WithLabelValues(backend),
+		InsertDuration:  vectorInsertDuration.WithLabelValues(backend),
+		ErrorCount:      vectorErrors.WithLabelValues(backend),
+		ConnectionState: vectorConnectionState.WithLabelValues(backend),
+	}
+}
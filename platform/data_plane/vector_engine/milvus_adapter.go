@@ -4,12 +4,17 @@ package vectordb
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/milvus-io/milvus-sdk-go/v2/client"
 	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	"golang.org/x/sync/semaphore"
 )
@@ -31,6 +36,8 @@ type MilvusConfig struct {
 	TLSConfig         *tls.Config
 	ConnectionTimeout time.Duration
 	Namespace         string
+	// Index is the vector index built for new collections
+	Index IndexConfig
 }
 
 type MilvusAdapter struct {
@@ -41,11 +48,14 @@ type MilvusAdapter struct {
 	healthCheck chan struct{}
 	metrics     *VectorDBMetrics
 	mu          sync.RWMutex
+	partitions  sync.Map // "collection/partition" known to exist
+	indexes     sync.Map // collection -> IndexConfig
+	schemaRegistry
 }
 
 type VectorDBMetrics struct {
-	QueryDuration   prometheus.Histogram
-	InsertDuration  prometheus.Histogram
+	QueryDuration   prometheus.Observer
+	InsertDuration  prometheus.Observer
 	ErrorCount      prometheus.Counter
 	ConnectionState prometheus.Gauge
 }
@@ -56,6 +66,7 @@ func NewMilvusAdapter(cfg MilvusConfig, logger *zap.Logger) (*MilvusAdapter, err
 		logger:      logger.Named("milvus_adapter"),
 		connPool:    semaphore.NewWeighted(maxConnPoolSize),
 		healthCheck: make(chan struct{}, 1),
+		metrics:     newVectorDBMetrics("milvus"),
 	}
 
 	if err := adapter.connectWithRetry(); err != nil {
@@ -78,6 +89,7 @@ func (m *MilvusAdapter) connectWithRetry() error {
 		
 		if err == nil {
 			m.client = conn
+			m.metrics.ConnectionState.Set(1)
 			m.logger.Info("Successfully connected to Milvus cluster")
 			return nil
 		}
@@ -103,6 +115,7 @@ func (m *MilvusAdapter) connectionMonitor() {
 		case <-ticker.C:
 			if err := m.healthCheckConnection(); err != nil {
 				m.logger.Error("Connection health check failed", zap.Error(err))
+				m.metrics.ConnectionState.Set(0)
 				m.reconnect()
 			}
 		case <-m.healthCheck:
@@ -133,6 +146,9 @@ func (m *MilvusAdapter) reconnect() {
 }
 
 func (m *MilvusAdapter) CreateCollection(ctx context.Context, name string, dim int64) error {
+	if err := m.config.Index.Validate(dim); err != nil {
+		return fmt.Errorf("invalid index config: %w", err)
+	}
 	if err := m.connPool.Acquire(ctx, 1); err != nil {
 		return err
 	}
@@ -143,6 +159,11 @@ func (m *MilvusAdapter) CreateCollection(ctx context.Context, name string, dim i
 		Description:    "Nuzon AI Agent Memory",
 		AutoID:         false,
 		Fields: []*entity.Field{
+			{
+				Name:       "id",
+				DataType:   entity.FieldTypeInt64,
+				PrimaryKey: true,
+			},
 			{
 				Name:       "vector",
 				DataType:   entity.FieldTypeFloatVector,
@@ -155,70 +176,116 @@ func (m *MilvusAdapter) CreateCollection(ctx context.Context, name string, dim i
 		},
 	}
 
-	index := entity.NewGenericIndex("nuzon_agent_index", 
-		entity.L2,
-		[]string{"vector"},
-		entity.WithIndexParam("nlist", "2048"),
-		entity.WithIndexParam("m", "24"),
-	)
-
 	err := m.client.CreateCollection(ctx, schema, 2)
 	if err != nil {
 		return fmt.Errorf("failed to create collection: %w", err)
 	}
 
-	return m.client.CreateIndex(ctx, name, index)
+	return m.buildIndex(ctx, name, m.config.Index.withDefaults())
 }
 
-func (m *MilvusAdapter) InsertVectors(ctx context.Context, collection string, vectors []float32, metadatas []map[string]interface{}) error {
-	if len(vectors) == 0 || len(vectors) != len(metadatas) {
-		return fmt.Errorf("invalid input dimensions")
+// InsertVectors writes vectors under random IDs to the context tenant's
+// partition in parallel batches, at most maxConnPoolSize in flight. Every
+// batch is attempted; if some fail the error is a *PartialInsertError
+// naming them, and the other batches stay written.
+func (m *MilvusAdapter) InsertVectors(ctx context.Context, collection string, vectors [][]float32, metadatas []map[string]interface{}) error {
+	points, err := withRandomIDs(vectors, metadatas)
+	if err != nil {
+		return err
+	}
+	dim, err := vectorDim(points)
+	if err != nil {
+		return err
+	}
+	stats, err := m.Stats(ctx, collection)
+	if err != nil {
+		return err
+	}
+	if stats.Dimension != 0 && int64(dim) != stats.Dimension {
+		return fmt.Errorf("vectors have dimension %d, collection %s expects %d", dim, collection, stats.Dimension)
 	}
 
-	batches := chunkSlice(vectors, maxBulkInsertSize)
-	metaBatches := chunkSlice(metadatas, maxBulkInsertSize)
+	partition := tenantPartition(TenantFromContext(ctx))
+	if err := m.ensurePartition(ctx, collection, partition); err != nil {
+		return err
+	}
+	recordPartitionUsage("milvus", collection, partition, "upsert", len(points))
 
 	var wg sync.WaitGroup
-	errChan := make(chan error, len(batches))
+	errChan := make(chan BatchError, (len(points)+maxBulkInsertSize-1)/maxBulkInsertSize)
 
-	for i := range batches {
+	for start := 0; start < len(points); start += maxBulkInsertSize {
+		end := start + maxBulkInsertSize
+		if end > len(points) {
+			end = len(points)
+		}
+		// acquiring before spawning bounds the goroutines, not just the
+		// calls, by the pool size
+		if err := m.connPool.Acquire(ctx, 1); err != nil {
+			errChan <- BatchError{Offset: start, Count: len(points) - start, Err: err}
+			break
+		}
 		wg.Add(1)
-		go func(batchIndex int) {
+		go func(start int, batch []Vector) {
 			defer wg.Done()
-			
-			if err := m.connPool.Acquire(ctx, 1); err != nil {
-				errChan <- err
-				return
-			}
 			defer m.connPool.Release(1)
 
-			start := time.Now()
-			vectors := entity.NewColumnFloatVector("vector", int32(len(batches[batchIndex])/dim), batches[batchIndex])
-			metadatas := entity.NewColumnJSONBytes("metadata", serializeMetadata(metaBatches[batchIndex]))
-			
-			_, err := m.client.Insert(ctx, collection, "", vectors, metadatas)
-			m.metrics.InsertDuration.Observe(time.Since(start).Seconds())
-			
+			ids := make([]int64, len(batch))
+			values := make([][]float32, len(batch))
+			metas := make([]map[string]interface{}, len(batch))
+			for i, v := range batch {
+				ids[i], values[i], metas[i] = v.ID, v.Values, v.Metadata
+			}
+
+			begin := time.Now()
+			_, err := m.client.Insert(ctx, collection, partition,
+				entity.NewColumnInt64("id", ids),
+				entity.NewColumnFloatVector("vector", dim, values),
+				entity.NewColumnJSONBytes("metadata", serializeMetadata(metas)),
+			)
+			m.metrics.InsertDuration.Observe(time.Since(begin).Seconds())
 			if err != nil {
 				m.metrics.ErrorCount.Inc()
-				errChan <- fmt.Errorf("batch %d insert failed: %w", batchIndex, err)
-				return
+				errChan <- BatchError{Offset: start, Count: len(batch), Err: err}
 			}
-		}(i)
+		}(start, points[start:end])
 	}
 
 	wg.Wait()
 	close(errChan)
 
-	for err := range errChan {
-		if err != nil {
-			return err
-		}
+	partial := &PartialInsertError{Total: len(points)}
+	for failure := range errChan {
+		partial.Failed = append(partial.Failed, failure)
+	}
+	if len(partial.Failed) > 0 {
+		sort.Slice(partial.Failed, func(i, j int) bool { return partial.Failed[i].Offset < partial.Failed[j].Offset })
+		return partial
 	}
 	return nil
 }
 
-func (m *MilvusAdapter) SearchVectors(ctx context.Context, collection string, query []float32, k int) ([]SearchResult, error) {
+func (m *MilvusAdapter) SearchVectors(ctx context.Context, collection string, query []float32, k int, filter *Filter) ([]SearchResult, error) {
+	if err := m.validateFilter(collection, filter); err != nil {
+		return nil, err
+	}
+	expr := ""
+	if filter != nil {
+		expr = milvusExpr(filter.root)
+	}
+	index := m.indexFor(ctx, collection)
+
+	partition := tenantPartition(TenantFromContext(ctx))
+	exists, err := m.partitionExists(ctx, collection, partition, false)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		// the tenant has never written to this collection
+		return nil, nil
+	}
+	recordPartitionUsage("milvus", collection, partition, "search", 1)
+
 	if err := m.connPool.Acquire(ctx, 1); err != nil {
 		return nil, err
 	}
@@ -229,7 +296,7 @@ func (m *MilvusAdapter) SearchVectors(ctx context.Context, collection string, qu
 		m.metrics.QueryDuration.Observe(time.Since(start).Seconds())
 	}()
 
-	sp, err := entity.NewIndexFlatSearchParam()
+	sp, err := index.searchParam(k)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create search params: %w", err)
 	}
@@ -238,12 +305,12 @@ func (m *MilvusAdapter) SearchVectors(ctx context.Context, collection string, qu
 	results, err := m.client.Search(
 		ctx,
 		collection,
-		[]string{},
-		"",
-		[]string{"vector", "metadata"},
+		[]string{partition},
+		expr,
+		[]string{"metadata"},
 		vectors,
 		"vector",
-		entity.L2,
+		index.metric(),
 		k,
 		sp,
 	)
@@ -255,26 +322,282 @@ func (m *MilvusAdapter) SearchVectors(ctx context.Context, collection string, qu
 
 	var searchResults []SearchResult
 	for _, result := range results {
-		for _, score := range result.Scores {
+		ids := result.IDs.(*entity.ColumnInt64).Data()
+		metas := result.Fields.GetColumn("metadata").(*entity.ColumnJSONBytes).Data()
+		for i, score := range result.Scores {
 			searchResults = append(searchResults, SearchResult{
-				ID:       result.IDs.(*entity.ColumnInt64).Data()[0],
+				ID:       ids[i],
 				Score:    score,
-				Metadata: deserializeMetadata(result.Fields["metadata"].(*entity.ColumnJSONBytes).Data()[0]),
+				Metadata: deserializeMetadata(metas[i]),
 			})
 		}
 	}
 	return searchResults, nil
 }
 
+// Upsert writes vectors keyed by ID to the context tenant's partition
+func (m *MilvusAdapter) Upsert(ctx context.Context, collection string, vectors []Vector) error {
+	return m.UpsertVectors(ctx, collection, tenantPartition(TenantFromContext(ctx)), vectors)
+}
+
+// UpsertVectors writes vectors keyed by ID into partition, replacing
+// existing rows; the partition is created on first use and the empty name
+// routes to the default partition
+func (m *MilvusAdapter) UpsertVectors(ctx context.Context, collection, partition string, vectors []Vector) error {
+	dim, err := vectorDim(vectors)
+	if err != nil {
+		return err
+	}
+	if err := m.ensurePartition(ctx, collection, partition); err != nil {
+		return err
+	}
+	if partition == "" {
+		partition = "_default"
+	}
+	recordPartitionUsage("milvus", collection, partition, "upsert", len(vectors))
+
+	for start := 0; start < len(vectors); start += maxBulkInsertSize {
+		end := start + maxBulkInsertSize
+		if end > len(vectors) {
+			end = len(vectors)
+		}
+		batch := vectors[start:end]
+
+		ids := make([]int64, len(batch))
+		values := make([][]float32, len(batch))
+		metas := make([][]byte, len(batch))
+		for i, v := range batch {
+			ids[i], values[i] = v.ID, v.Values
+			if metas[i], err = json.Marshal(v.Metadata); err != nil {
+				return fmt.Errorf("vector %d metadata: %w", v.ID, err)
+			}
+		}
+
+		if err := m.connPool.Acquire(ctx, 1); err != nil {
+			return err
+		}
+		begin := time.Now()
+		_, err = m.client.Upsert(ctx, collection, partition,
+			entity.NewColumnInt64("id", ids),
+			entity.NewColumnFloatVector("vector", dim, values),
+			entity.NewColumnJSONBytes("metadata", metas),
+		)
+		m.metrics.InsertDuration.Observe(time.Since(begin).Seconds())
+		m.connPool.Release(1)
+		if err != nil {
+			m.metrics.ErrorCount.Inc()
+			return fmt.Errorf("upsert failed at offset %d: %w", start, err)
+		}
+	}
+	return nil
+}
+
+// Delete removes vectors by primary key from the context tenant's partition
+func (m *MilvusAdapter) Delete(ctx context.Context, collection string, ids []int64) error {
+	partition := tenantPartition(TenantFromContext(ctx))
+	exists, err := m.partitionExists(ctx, collection, partition, false)
+	if err != nil || !exists {
+		return err
+	}
+	return m.DeleteByIDs(ctx, collection, partition, ids)
+}
+
+// DeleteByIDs removes vectors by primary key, from partition only when it
+// is non-empty
+func (m *MilvusAdapter) DeleteByIDs(ctx context.Context, collection, partition string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := m.connPool.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer m.connPool.Release(1)
+
+	recordPartitionUsage("milvus", collection, partitionLabel(partition), "delete", len(ids))
+	for start := 0; start < len(ids); start += maxBulkInsertSize {
+		end := start + maxBulkInsertSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if err := m.client.DeleteByPks(ctx, collection, partition, entity.NewColumnInt64("id", ids[start:end])); err != nil {
+			m.metrics.ErrorCount.Inc()
+			return fmt.Errorf("delete failed at offset %d: %w", start, err)
+		}
+	}
+	return nil
+}
+
+// DeleteByFilter removes every vector whose metadata matches filter, from
+// partition only when it is non-empty. A nil filter is rejected rather than
+// emptying the collection.
+func (m *MilvusAdapter) DeleteByFilter(ctx context.Context, collection, partition string, filter *Filter) error {
+	if filter == nil {
+		return fmt.Errorf("%w: delete requires a filter", ErrInvalidFilter)
+	}
+	if err := m.validateFilter(collection, filter); err != nil {
+		return err
+	}
+	if err := m.connPool.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer m.connPool.Release(1)
+
+	if err := m.client.Delete(ctx, collection, partition, milvusExpr(filter.root)); err != nil {
+		m.metrics.ErrorCount.Inc()
+		return fmt.Errorf("delete by filter failed: %w", err)
+	}
+	m.logger.Info("Deleted vectors by filter",
+		zap.String("collection", collection),
+		zap.String("partition", partition),
+		zap.String("filter", filter.String()))
+	return nil
+}
+
+// ensurePartition creates a named partition the first time it is written
+// to; the empty name routes to the default partition
+func (m *MilvusAdapter) ensurePartition(ctx context.Context, collection, partition string) error {
+	_, err := m.partitionExists(ctx, collection, partition, true)
+	return err
+}
+
+// partitionExists reports whether partition exists, creating it when
+// create is set. Known partitions are cached.
+func (m *MilvusAdapter) partitionExists(ctx context.Context, collection, partition string, create bool) (bool, error) {
+	if partition == "" || partition == "_default" {
+		return true, nil
+	}
+	key := collection + "/" + partition
+	if _, ok := m.partitions.Load(key); ok {
+		return true, nil
+	}
+	if err := m.connPool.Acquire(ctx, 1); err != nil {
+		return false, err
+	}
+	defer m.connPool.Release(1)
+
+	exists, err := m.client.HasPartition(ctx, collection, partition)
+	if err != nil {
+		m.metrics.ErrorCount.Inc()
+		return false, fmt.Errorf("partition lookup failed: %w", err)
+	}
+	if !exists {
+		if !create {
+			return false, nil
+		}
+		if err := m.client.CreatePartition(ctx, collection, partition); err != nil {
+			m.metrics.ErrorCount.Inc()
+			return false, fmt.Errorf("failed to create partition %q: %w", partition, err)
+		}
+		m.logger.Info("Created tenant partition", zap.String("collection", collection), zap.String("partition", partition))
+	}
+	m.partitions.Store(key, struct{}{})
+	return true, nil
+}
+
+// partitionLabel names the metric series for deletes, where the empty
+// partition means all of them
+func partitionLabel(partition string) string {
+	if partition == "" {
+		return "_all"
+	}
+	return partition
+}
+
+// Search is SearchVectors under the Store interface
+func (m *MilvusAdapter) Search(ctx context.Context, collection string, query []float32, k int, filter *Filter) ([]SearchResult, error) {
+	return m.SearchVectors(ctx, collection, query, k, filter)
+}
+
+// Stats reports the collection's row count and vector dimension
+func (m *MilvusAdapter) Stats(ctx context.Context, collection string) (CollectionStats, error) {
+	if err := m.connPool.Acquire(ctx, 1); err != nil {
+		return CollectionStats{}, err
+	}
+	defer m.connPool.Release(1)
+
+	stats := CollectionStats{Name: collection}
+	raw, err := m.client.GetCollectionStatistics(ctx, collection)
+	if err != nil {
+		m.metrics.ErrorCount.Inc()
+		return stats, fmt.Errorf("statistics query failed: %w", err)
+	}
+	stats.RowCount, _ = strconv.ParseInt(raw["row_count"], 10, 64)
+
+	coll, err := m.client.DescribeCollection(ctx, collection)
+	if err != nil {
+		m.metrics.ErrorCount.Inc()
+		return stats, fmt.Errorf("describe collection failed: %w", err)
+	}
+	for _, field := range coll.Schema.Fields {
+		if field.Name == "vector" {
+			stats.Dimension, _ = strconv.ParseInt(field.TypeParams["dim"], 10, 64)
+		}
+	}
+	return stats, nil
+}
+
 func (m *MilvusAdapter) Close() error {
 	close(m.healthCheck)
 	return m.client.Close()
 }
 
-// Helper functions omitted for brevity: chunkSlice, serializeMetadata, deserializeMetadata
+// milvusExpr renders a filter as a boolean expression over the JSON
+// metadata field
+func milvusExpr(n filterNode) string {
+	switch n := n.(type) {
+	case andNode:
+		return joinMilvus(n.children, " && ")
+	case orNode:
+		return joinMilvus(n.children, " || ")
+	case compareNode:
+		op := string(n.op)
+		if n.op == OpEq {
+			op = "=="
+		}
+		return fmt.Sprintf("metadata[%s] %s %s", milvusLiteral(n.field), op, milvusLiteral(n.value))
+	case inNode:
+		values := make([]string, len(n.values))
+		for i, v := range n.values {
+			values[i] = milvusLiteral(v)
+		}
+		op := "in"
+		if n.negate {
+			op = "not in"
+		}
+		return fmt.Sprintf("metadata[%s] %s [%s]", milvusLiteral(n.field), op, strings.Join(values, ", "))
+	}
+	return ""
+}
+
+func joinMilvus(children []filterNode, sep string) string {
+	parts := make([]string, len(children))
+	for i, c := range children {
+		parts[i] = "(" + milvusExpr(c) + ")"
+	}
+	return strings.Join(parts, sep)
+}
+
+func milvusLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// Helper functions omitted for brevity: serializeMetadata, deserializeMetadata
 
 type SearchResult struct {
 	ID       int64
 	Score    float32
 	Metadata map[string]interface{}
+	// VectorScore keeps the similarity score when a reranker has replaced
+	// Score
+	VectorScore float32
 }
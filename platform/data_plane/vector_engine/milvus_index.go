@@ -0,0 +1,349 @@
+// milvus_index.go - Configurable Milvus Vector Index Types
+package vectordb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"go.uber.org/zap"
+)
+
+// indexPollInterval paces build progress checks for tracked index jobs
+const indexPollInterval = 5 * time.Second
+
+// IndexType selects the Milvus vector index
+type IndexType string
+
+const (
+	// IndexFlat is exact brute-force search; only for small collections
+	// and recall baselines
+	IndexFlat IndexType = "FLAT"
+	// IndexIVFFlat clusters vectors into NList buckets and scans NProbe of
+	// them. Good recall at moderate memory; the long-standing default.
+	IndexIVFFlat IndexType = "IVF_FLAT"
+	// IndexIVFPQ adds product quantization to IVF, cutting memory roughly
+	// dim*4/PQM times at some recall cost. PQM must divide the dimension.
+	IndexIVFPQ IndexType = "IVF_PQ"
+	// IndexHNSW is a graph index with the best latency/recall trade-off
+	// while the collection fits in memory
+	IndexHNSW IndexType = "HNSW"
+	// IndexDiskANN keeps the graph on NVMe for collections too large to
+	// hold in memory
+	IndexDiskANN IndexType = "DISKANN"
+)
+
+// IndexConfig chooses the index built by CreateCollection and Reindex and
+// the search-time parameters used against it. Zero values take the
+// defaults below. Benchmark before changing them in production: measure
+// recall@k against an IndexFlat copy of a sample and p99 latency at the
+// expected QPS, then raise Ef, NProbe or SearchList until recall is
+// acceptable.
+type IndexConfig struct {
+	Type   IndexType
+	Metric string // L2, IP or COSINE
+
+	// HNSW build: M is graph degree (4-64), EfConstruction the build
+	// beam width (8-512)
+	M              int
+	EfConstruction int
+	// IVF build: NList buckets (1-65536); IVF_PQ also takes PQM
+	// sub-quantizers and NBits per code (1-16)
+	NList int
+	PQM   int
+	NBits int
+
+	// Search: Ef for HNSW (>= k), NProbe for IVF (<= NList), SearchList
+	// for DiskANN (>= k)
+	Ef         int
+	NProbe     int
+	SearchList int
+}
+
+var defaultIndexConfig = IndexConfig{
+	Type:           IndexIVFFlat,
+	Metric:         "L2",
+	M:              16,
+	EfConstruction: 200,
+	NList:          2048,
+	NBits:          8,
+	Ef:             64,
+	NProbe:         16,
+	SearchList:     100,
+}
+
+func (c IndexConfig) withDefaults() IndexConfig {
+	d := defaultIndexConfig
+	if c.Type == "" {
+		c.Type = d.Type
+	}
+	if c.Metric == "" {
+		c.Metric = d.Metric
+	}
+	if c.M == 0 {
+		c.M = d.M
+	}
+	if c.EfConstruction == 0 {
+		c.EfConstruction = d.EfConstruction
+	}
+	if c.NList == 0 {
+		c.NList = d.NList
+	}
+	if c.NBits == 0 {
+		c.NBits = d.NBits
+	}
+	if c.Ef == 0 {
+		c.Ef = d.Ef
+	}
+	if c.NProbe == 0 {
+		c.NProbe = d.NProbe
+	}
+	if c.SearchList == 0 {
+		c.SearchList = d.SearchList
+	}
+	return c
+}
+
+// Validate checks the configuration against a vector dimension
+func (c IndexConfig) Validate(dim int64) error {
+	c = c.withDefaults()
+	switch strings.ToUpper(c.Metric) {
+	case "L2", "IP", "COSINE":
+	default:
+		return fmt.Errorf("unsupported metric %q", c.Metric)
+	}
+	switch c.Type {
+	case IndexFlat, IndexDiskANN:
+	case IndexHNSW:
+		if c.M < 4 || c.M > 64 {
+			return fmt.Errorf("HNSW M must be in [4, 64], got %d", c.M)
+		}
+		if c.EfConstruction < 8 || c.EfConstruction > 512 {
+			return fmt.Errorf("HNSW efConstruction must be in [8, 512], got %d", c.EfConstruction)
+		}
+	case IndexIVFFlat, IndexIVFPQ:
+		if c.NList < 1 || c.NList > 65536 {
+			return fmt.Errorf("nlist must be in [1, 65536], got %d", c.NList)
+		}
+		if c.NProbe > c.NList {
+			return fmt.Errorf("nprobe %d exceeds nlist %d", c.NProbe, c.NList)
+		}
+		if c.Type == IndexIVFPQ {
+			if c.PQM <= 0 || dim%int64(c.PQM) != 0 {
+				return fmt.Errorf("IVF_PQ m must divide dimension %d, got %d", dim, c.PQM)
+			}
+			if c.NBits < 1 || c.NBits > 16 {
+				return fmt.Errorf("IVF_PQ nbits must be in [1, 16], got %d", c.NBits)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported index type %q", c.Type)
+	}
+	return nil
+}
+
+func (c IndexConfig) metric() entity.MetricType {
+	return entity.MetricType(strings.ToUpper(c.Metric))
+}
+
+func (c IndexConfig) index() (entity.Index, error) {
+	switch c.Type {
+	case IndexFlat:
+		return entity.NewIndexFlat(c.metric())
+	case IndexIVFFlat:
+		return entity.NewIndexIvfFlat(c.metric(), c.NList)
+	case IndexIVFPQ:
+		return entity.NewIndexIvfPQ(c.metric(), c.NList, c.PQM, c.NBits)
+	case IndexHNSW:
+		return entity.NewIndexHNSW(c.metric(), c.M, c.EfConstruction)
+	case IndexDiskANN:
+		return entity.NewIndexDISKANN(c.metric())
+	}
+	return nil, fmt.Errorf("unsupported index type %q", c.Type)
+}
+
+func (c IndexConfig) searchParam(k int) (entity.SearchParam, error) {
+	switch c.Type {
+	case IndexIVFFlat:
+		return entity.NewIndexIvfFlatSearchParam(c.NProbe)
+	case IndexIVFPQ:
+		return entity.NewIndexIvfPQSearchParam(c.NProbe)
+	case IndexHNSW:
+		return entity.NewIndexHNSWSearchParam(maxInt(c.Ef, k))
+	case IndexDiskANN:
+		return entity.NewIndexDISKANNSearchParam(maxInt(c.SearchList, k))
+	}
+	return entity.NewIndexFlatSearchParam()
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// indexFor returns the index configuration of a collection, reading it
+// back from Milvus for collections this process did not create
+func (m *MilvusAdapter) indexFor(ctx context.Context, collection string) IndexConfig {
+	if cfg, ok := m.indexes.Load(collection); ok {
+		return cfg.(IndexConfig)
+	}
+	cfg := m.config.Index.withDefaults()
+
+	if err := m.connPool.Acquire(ctx, 1); err != nil {
+		return cfg
+	}
+	defer m.connPool.Release(1)
+
+	indexes, err := m.client.DescribeIndex(ctx, collection, "vector")
+	if err != nil || len(indexes) == 0 {
+		return cfg
+	}
+	params := indexes[0].Params()
+	cfg.Type = IndexType(indexes[0].IndexType())
+	if metric, ok := params["metric_type"]; ok {
+		cfg.Metric = metric
+	}
+	if v, err := strconv.Atoi(params["nlist"]); err == nil {
+		cfg.NList = v
+	}
+	m.indexes.Store(collection, cfg)
+	return cfg
+}
+
+// buildIndex creates and loads the vector index for collection
+func (m *MilvusAdapter) buildIndex(ctx context.Context, collection string, cfg IndexConfig) error {
+	idx, err := cfg.index()
+	if err != nil {
+		return fmt.Errorf("invalid index parameters: %w", err)
+	}
+	if err := m.client.CreateIndex(ctx, collection, "vector", idx, false); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	if err := m.client.LoadCollection(ctx, collection, false); err != nil {
+		return fmt.Errorf("failed to load collection: %w", err)
+	}
+	m.indexes.Store(collection, cfg)
+	return nil
+}
+
+// Reindex replaces the vector index of an existing collection. The
+// collection is released while the new index builds, so searches fail
+// until it is loaded again; schedule it outside peak traffic.
+func (m *MilvusAdapter) Reindex(ctx context.Context, collection string, cfg IndexConfig) error {
+	cfg = cfg.withDefaults()
+	stats, err := m.Stats(ctx, collection)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(stats.Dimension); err != nil {
+		return fmt.Errorf("invalid index config: %w", err)
+	}
+
+	if err := m.connPool.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer m.connPool.Release(1)
+
+	logger := m.logger.With(zap.String("collection", collection), zap.String("index", string(cfg.Type)))
+	logger.Info("Re-indexing collection")
+	if err := m.client.ReleaseCollection(ctx, collection); err != nil {
+		m.metrics.ErrorCount.Inc()
+		return fmt.Errorf("failed to release collection: %w", err)
+	}
+	if err := m.client.DropIndex(ctx, collection, "vector"); err != nil {
+		m.metrics.ErrorCount.Inc()
+		return fmt.Errorf("failed to drop index: %w", err)
+	}
+	m.indexes.Delete(collection)
+	if err := m.buildIndex(ctx, collection, cfg); err != nil {
+		m.metrics.ErrorCount.Inc()
+		return err
+	}
+	logger.Info("Re-index complete")
+	return nil
+}
+
+// buildIndexTracked replaces the vector index like Reindex but lets Milvus
+// build in the background, polling until the build finishes and passing
+// indexed and total rows to progress. With resume set, an index of the
+// requested type already on the collection is taken to be the one an
+// interrupted job started and is only waited on.
+func (m *MilvusAdapter) buildIndexTracked(ctx context.Context, collection string, cfg IndexConfig, resume bool, progress func(indexed, total int64)) error {
+	cfg = cfg.withDefaults()
+	stats, err := m.Stats(ctx, collection)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(stats.Dimension); err != nil {
+		return fmt.Errorf("invalid index config: %w", err)
+	}
+	idx, err := cfg.index()
+	if err != nil {
+		return fmt.Errorf("invalid index parameters: %w", err)
+	}
+
+	if err := m.connPool.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	existing, err := m.client.DescribeIndex(ctx, collection, "vector")
+	hasIndex := err == nil && len(existing) > 0
+	if !resume || !hasIndex || IndexType(existing[0].IndexType()) != cfg.Type {
+		err = m.startIndexBuild(ctx, collection, idx, hasIndex)
+	}
+	m.connPool.Release(1)
+	if err != nil {
+		m.metrics.ErrorCount.Inc()
+		return err
+	}
+
+	ticker := time.NewTicker(indexPollInterval)
+	defer ticker.Stop()
+	for {
+		state, err := m.client.GetIndexState(ctx, collection, "vector")
+		if err != nil {
+			return fmt.Errorf("index state check failed: %w", err)
+		}
+		if total, indexed, err := m.client.GetIndexBuildProgress(ctx, collection, "vector"); err == nil {
+			progress(indexed, total)
+		}
+		switch state {
+		case entity.IndexState_Finished:
+			if err := m.client.LoadCollection(ctx, collection, false); err != nil {
+				return fmt.Errorf("failed to load collection: %w", err)
+			}
+			m.indexes.Store(collection, cfg)
+			return nil
+		case entity.IndexState_Failed:
+			m.metrics.ErrorCount.Inc()
+			return fmt.Errorf("index build failed for %s", collection)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// startIndexBuild releases the collection, drops any existing index and
+// issues an asynchronous build
+func (m *MilvusAdapter) startIndexBuild(ctx context.Context, collection string, idx entity.Index, hasIndex bool) error {
+	if err := m.client.ReleaseCollection(ctx, collection); err != nil {
+		return fmt.Errorf("failed to release collection: %w", err)
+	}
+	if hasIndex {
+		if err := m.client.DropIndex(ctx, collection, "vector"); err != nil {
+			return fmt.Errorf("failed to drop index: %w", err)
+		}
+	}
+	m.indexes.Delete(collection)
+	if err := m.client.CreateIndex(ctx, collection, "vector", idx, true); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,445 @@
+// pinecone_adapter.go - Pinecone Serverless Vector Database Integration
+package vectordb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pinecone-io/go-pinecone/pinecone"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// pineconeUpsertBatch stays well under Pinecone's 2 MB request limit for
+// typical embedding sizes
+const pineconeUpsertBatch = 100
+
+var pineconeUsage = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "Wavine_vectordb_pinecone_usage_total",
+	Help: "Pinecone usage by tenant: read units consumed and vectors written",
+}, []string{"tenant", "kind"})
+
+func init() {
+	prometheus.MustRegister(pineconeUsage)
+}
+
+// UsageMeter receives per-tenant consumption for billing; kind is
+// "read_units" or "write_vectors"
+type UsageMeter interface {
+	Record(ctx context.Context, tenant, kind string, units float64)
+}
+
+type PineconeConfig struct {
+	APIKey string
+	// Cloud and Region place serverless indexes created by CreateCollection
+	Cloud  pinecone.Cloud
+	Region string
+	Metric pinecone.IndexMetric
+	// NamespacePrefix is prepended to tenant IDs to form namespaces
+	NamespacePrefix   string
+	ConnectionTimeout time.Duration
+	Meter             UsageMeter
+}
+
+type PineconeAdapter struct {
+	client   *pinecone.Client
+	config   PineconeConfig
+	logger   *zap.Logger
+	connPool *semaphore.Weighted
+	metrics  *VectorDBMetrics
+
+	mu    sync.Mutex
+	hosts map[string]string
+	conns map[string]*pinecone.IndexConnection // index/namespace
+
+	schemaRegistry
+}
+
+func NewPineconeAdapter(cfg PineconeConfig, logger *zap.Logger) (*PineconeAdapter, error) {
+	if cfg.Cloud == "" {
+		cfg.Cloud = pinecone.Aws
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Metric == "" {
+		cfg.Metric = pinecone.Cosine
+	}
+	client, err := pinecone.NewClient(pinecone.NewClientParams{ApiKey: cfg.APIKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize client: %w", err)
+	}
+	adapter := &PineconeAdapter{
+		client:   client,
+		config:   cfg,
+		logger:   logger.Named("pinecone_adapter"),
+		connPool: semaphore.NewWeighted(maxConnPoolSize),
+		metrics:  newVectorDBMetrics("pinecone"),
+		hosts:    make(map[string]string),
+		conns:    make(map[string]*pinecone.IndexConnection),
+	}
+
+	if err := adapter.connectWithRetry(); err != nil {
+		return nil, fmt.Errorf("failed to initialize connection: %w", err)
+	}
+	return adapter, nil
+}
+
+// connectWithRetry verifies the API key by listing indexes. Pinecone is a
+// managed HTTP service, so there is no long-lived connection to monitor.
+func (p *PineconeAdapter) connectWithRetry() error {
+	var lastErr error
+	for attempt := 1; attempt <= maxRetryAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+		_, err := p.client.ListIndexes(ctx)
+		cancel()
+		if err == nil {
+			p.metrics.ConnectionState.Set(1)
+			p.logger.Info("Successfully connected to Pinecone")
+			return nil
+		}
+
+		lastErr = err
+		delay := baseRetryDelay * time.Duration(attempt)
+		p.logger.Warn("Connection attempt failed",
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+			zap.Duration("retry_delay", delay),
+		)
+		time.Sleep(delay)
+	}
+	p.metrics.ConnectionState.Set(0)
+	return fmt.Errorf("exhausted connection attempts: %w", lastErr)
+}
+
+func (p *PineconeAdapter) timeout() time.Duration {
+	if p.config.ConnectionTimeout == 0 {
+		return queryTimeout
+	}
+	return p.config.ConnectionTimeout
+}
+
+// namespace maps the context's tenant onto a Pinecone namespace
+func (p *PineconeAdapter) namespace(ctx context.Context) string {
+	return p.config.NamespacePrefix + TenantFromContext(ctx)
+}
+
+// indexConn returns a cached data-plane connection for index and namespace
+func (p *PineconeAdapter) indexConn(ctx context.Context, index, namespace string) (*pinecone.IndexConnection, error) {
+	key := index + "/" + namespace
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if conn, ok := p.conns[key]; ok {
+		return conn, nil
+	}
+	host, ok := p.hosts[index]
+	if !ok {
+		desc, err := p.client.DescribeIndex(ctx, index)
+		if err != nil {
+			return nil, fmt.Errorf("index lookup failed: %w", err)
+		}
+		host = desc.Host
+		p.hosts[index] = host
+	}
+	conn, err := p.client.Index(pinecone.NewIndexConnParams{Host: host, Namespace: namespace})
+	if err != nil {
+		return nil, fmt.Errorf("index connection failed: %w", err)
+	}
+	p.conns[key] = conn
+	return conn, nil
+}
+
+func (p *PineconeAdapter) meter(ctx context.Context, tenant, kind string, units float64) {
+	if units == 0 {
+		return
+	}
+	pineconeUsage.WithLabelValues(tenant, kind).Add(units)
+	if p.config.Meter != nil {
+		p.config.Meter.Record(ctx, tenant, kind, units)
+	}
+}
+
+// CreateCollection creates a serverless index named after the collection
+func (p *PineconeAdapter) CreateCollection(ctx context.Context, name string, dim int64) error {
+	if err := p.connPool.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer p.connPool.Release(1)
+
+	_, err := p.client.CreateServerlessIndex(ctx, &pinecone.CreateServerlessIndexRequest{
+		Name:      name,
+		Dimension: int32(dim),
+		Metric:    p.config.Metric,
+		Cloud:     p.config.Cloud,
+		Region:    p.config.Region,
+	})
+	if err != nil {
+		p.metrics.ErrorCount.Inc()
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+	return nil
+}
+
+// InsertVectors upserts under random IDs; see Upsert
+func (p *PineconeAdapter) InsertVectors(ctx context.Context, collection string, vectors [][]float32, metadatas []map[string]interface{}) error {
+	points, err := withRandomIDs(vectors, metadatas)
+	if err != nil {
+		return err
+	}
+	return p.Upsert(ctx, collection, points)
+}
+
+// Upsert writes into the tenant's namespace in batches of
+// pineconeUpsertBatch, bounded by the connection pool
+func (p *PineconeAdapter) Upsert(ctx context.Context, collection string, vectors []Vector) error {
+	if _, err := vectorDim(vectors); err != nil {
+		return err
+	}
+
+	tenant := TenantFromContext(ctx)
+	conn, err := p.indexConn(ctx, collection, p.namespace(ctx))
+	if err != nil {
+		p.metrics.ErrorCount.Inc()
+		return err
+	}
+
+	points := make([]*pinecone.Vector, len(vectors))
+	for i, v := range vectors {
+		meta, err := structpb.NewStruct(v.Metadata)
+		if err != nil {
+			return fmt.Errorf("vector %d metadata: %w", v.ID, err)
+		}
+		points[i] = &pinecone.Vector{
+			Id:       strconv.FormatInt(v.ID, 10),
+			Values:   v.Values,
+			Metadata: meta,
+		}
+	}
+
+	recordPartitionUsage("pinecone", collection, p.namespace(ctx), "upsert", len(points))
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, (len(points)+pineconeUpsertBatch-1)/pineconeUpsertBatch)
+	for start := 0; start < len(points); start += pineconeUpsertBatch {
+		end := start + pineconeUpsertBatch
+		if end > len(points) {
+			end = len(points)
+		}
+
+		wg.Add(1)
+		go func(batchIndex int, batch []*pinecone.Vector) {
+			defer wg.Done()
+
+			if err := p.connPool.Acquire(ctx, 1); err != nil {
+				errChan <- err
+				return
+			}
+			defer p.connPool.Release(1)
+
+			begin := time.Now()
+			n, err := conn.UpsertVectors(ctx, batch)
+			p.metrics.InsertDuration.Observe(time.Since(begin).Seconds())
+			if err != nil {
+				p.metrics.ErrorCount.Inc()
+				errChan <- fmt.Errorf("batch %d insert failed: %w", batchIndex, err)
+				return
+			}
+			p.meter(ctx, tenant, "write_vectors", float64(n))
+		}(start/pineconeUpsertBatch, points[start:end])
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	for err := range errChan {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchVectors queries the tenant's namespace only, narrowed by filter
+// when it is non-nil
+func (p *PineconeAdapter) SearchVectors(ctx context.Context, collection string, query []float32, k int, filter *Filter) ([]SearchResult, error) {
+	var metaFilter *pinecone.MetadataFilter
+	if filter != nil {
+		if err := p.validateFilter(collection, filter); err != nil {
+			return nil, err
+		}
+		var err error
+		if metaFilter, err = structpb.NewStruct(pineconeFilter(filter.root)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+		}
+	}
+
+	if err := p.connPool.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer p.connPool.Release(1)
+
+	start := time.Now()
+	defer func() {
+		p.metrics.QueryDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	tenant := TenantFromContext(ctx)
+	conn, err := p.indexConn(ctx, collection, p.namespace(ctx))
+	if err != nil {
+		p.metrics.ErrorCount.Inc()
+		return nil, err
+	}
+
+	recordPartitionUsage("pinecone", collection, p.namespace(ctx), "search", 1)
+	resp, err := conn.QueryByVectorValues(ctx, &pinecone.QueryByVectorValuesRequest{
+		Vector:          query,
+		TopK:            uint32(k),
+		MetadataFilter:  metaFilter,
+		IncludeMetadata: true,
+	})
+	if err != nil {
+		p.metrics.ErrorCount.Inc()
+		return nil, fmt.Errorf("search operation failed: %w", err)
+	}
+	if resp.Usage != nil {
+		p.meter(ctx, tenant, "read_units", float64(resp.Usage.ReadUnits))
+	}
+
+	results := make([]SearchResult, 0, len(resp.Matches))
+	for _, match := range resp.Matches {
+		result := SearchResult{Score: match.Score}
+		if match.Vector != nil {
+			result.ID, _ = strconv.ParseInt(match.Vector.Id, 10, 64)
+			if match.Vector.Metadata != nil {
+				result.Metadata = match.Vector.Metadata.AsMap()
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+var pineconeOps = map[CompareOp]string{
+	OpEq: "$eq", OpNe: "$ne",
+	OpLt: "$lt", OpLe: "$lte",
+	OpGt: "$gt", OpGe: "$gte",
+}
+
+// pineconeFilter renders a filter in Pinecone's Mongo-style metadata
+// filter language
+func pineconeFilter(n filterNode) map[string]interface{} {
+	switch n := n.(type) {
+	case andNode:
+		return map[string]interface{}{"$and": pineconeOperands(n.children)}
+	case orNode:
+		return map[string]interface{}{"$or": pineconeOperands(n.children)}
+	case compareNode:
+		return map[string]interface{}{n.field: map[string]interface{}{pineconeOps[n.op]: n.value}}
+	case inNode:
+		op := "$in"
+		if n.negate {
+			op = "$nin"
+		}
+		return map[string]interface{}{n.field: map[string]interface{}{op: n.values}}
+	}
+	return nil
+}
+
+func pineconeOperands(nodes []filterNode) []interface{} {
+	out := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		out[i] = pineconeFilter(n)
+	}
+	return out
+}
+
+// Delete removes vectors by ID from the tenant's namespace
+func (p *PineconeAdapter) Delete(ctx context.Context, collection string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := p.connPool.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer p.connPool.Release(1)
+
+	conn, err := p.indexConn(ctx, collection, p.namespace(ctx))
+	if err != nil {
+		p.metrics.ErrorCount.Inc()
+		return err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = strconv.FormatInt(id, 10)
+	}
+	recordPartitionUsage("pinecone", collection, p.namespace(ctx), "delete", len(keys))
+	if err := conn.DeleteVectorsById(ctx, keys); err != nil {
+		p.metrics.ErrorCount.Inc()
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	return nil
+}
+
+// Search is SearchVectors under the Store interface
+func (p *PineconeAdapter) Search(ctx context.Context, collection string, query []float32, k int, filter *Filter) ([]SearchResult, error) {
+	return p.SearchVectors(ctx, collection, query, k, filter)
+}
+
+// Stats reports the vector count of the tenant's namespace and the index
+// dimension
+func (p *PineconeAdapter) Stats(ctx context.Context, collection string) (CollectionStats, error) {
+	if err := p.connPool.Acquire(ctx, 1); err != nil {
+		return CollectionStats{}, err
+	}
+	defer p.connPool.Release(1)
+
+	namespace := p.namespace(ctx)
+	conn, err := p.indexConn(ctx, collection, namespace)
+	if err != nil {
+		p.metrics.ErrorCount.Inc()
+		return CollectionStats{}, err
+	}
+	resp, err := conn.DescribeIndexStats(ctx)
+	if err != nil {
+		p.metrics.ErrorCount.Inc()
+		return CollectionStats{}, fmt.Errorf("index stats failed: %w", err)
+	}
+	stats := CollectionStats{Name: collection, Dimension: int64(resp.Dimension)}
+	if ns, ok := resp.Namespaces[namespace]; ok {
+		stats.RowCount = int64(ns.VectorCount)
+	}
+	return stats, nil
+}
+
+// DeleteTenant removes every vector in the tenant's namespace of index
+func (p *PineconeAdapter) DeleteTenant(ctx context.Context, index, tenant string) error {
+	conn, err := p.indexConn(ctx, index, p.config.NamespacePrefix+tenant)
+	if err != nil {
+		return err
+	}
+	if err := conn.DeleteAllVectorsInNamespace(ctx); err != nil {
+		p.metrics.ErrorCount.Inc()
+		return fmt.Errorf("namespace delete failed: %w", err)
+	}
+	return nil
+}
+
+func (p *PineconeAdapter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for key, conn := range p.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(p.conns, key)
+	}
+	return firstErr
+}
@@ -0,0 +1,630 @@
+// qdrant_adapter.go - Qdrant Vector Database Integration
+package vectordb
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qdrant/go-client/qdrant"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+)
+
+// tenantPayloadKey is the reserved payload field scoping points to a
+// tenant; pointIDPayloadKey keeps the caller's ID, since Qdrant IDs are
+// derived from the tenant and that ID (see pointID)
+const (
+	tenantPayloadKey  = "_tenant"
+	pointIDPayloadKey = "_id"
+)
+
+type QdrantConfig struct {
+	Host              string
+	Port              int // gRPC port, 6334 by default
+	APIKey            string
+	TLSConfig         *tls.Config
+	ConnectionTimeout time.Duration
+	// Distance defaults to cosine
+	Distance qdrant.Distance
+	// OnDiskVectors keeps vectors memory-mapped, matching on_disk_vectors in
+	// qdrant_config.toml
+	OnDiskVectors bool
+}
+
+type QdrantAdapter struct {
+	client      *qdrant.Client
+	config      QdrantConfig
+	logger      *zap.Logger
+	connPool    *semaphore.Weighted
+	healthCheck chan struct{}
+	metrics     *VectorDBMetrics
+	mu          sync.RWMutex
+	schemaRegistry
+}
+
+func NewQdrantAdapter(cfg QdrantConfig, logger *zap.Logger) (*QdrantAdapter, error) {
+	if cfg.Port == 0 {
+		cfg.Port = 6334
+	}
+	if cfg.Distance == qdrant.Distance_UnknownDistance {
+		cfg.Distance = qdrant.Distance_Cosine
+	}
+	adapter := &QdrantAdapter{
+		config:      cfg,
+		logger:      logger.Named("qdrant_adapter"),
+		connPool:    semaphore.NewWeighted(maxConnPoolSize),
+		healthCheck: make(chan struct{}, 1),
+		metrics:     newVectorDBMetrics("qdrant"),
+	}
+
+	if err := adapter.connectWithRetry(); err != nil {
+		return nil, fmt.Errorf("failed to initialize connection: %w", err)
+	}
+
+	go adapter.connectionMonitor()
+	return adapter, nil
+}
+
+func (q *QdrantAdapter) connectWithRetry() error {
+	var lastErr error
+	for attempt := 1; attempt <= maxRetryAttempts; attempt++ {
+		conn, err := qdrant.NewClient(&qdrant.Config{
+			Host:      q.config.Host,
+			Port:      q.config.Port,
+			APIKey:    q.config.APIKey,
+			UseTLS:    q.config.TLSConfig != nil,
+			TLSConfig: q.config.TLSConfig,
+		})
+		if err == nil {
+			if err = q.ping(conn); err == nil {
+				q.client = conn
+				q.metrics.ConnectionState.Set(1)
+				q.logger.Info("Successfully connected to Qdrant cluster")
+				return nil
+			}
+			conn.Close()
+		}
+
+		lastErr = err
+		delay := baseRetryDelay * time.Duration(attempt)
+		q.logger.Warn("Connection attempt failed",
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+			zap.Duration("retry_delay", delay),
+		)
+		time.Sleep(delay)
+	}
+	return fmt.Errorf("exhausted connection attempts: %w", lastErr)
+}
+
+func (q *QdrantAdapter) ping(conn *qdrant.Client) error {
+	timeout := q.config.ConnectionTimeout
+	if timeout == 0 {
+		timeout = queryTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err := conn.HealthCheck(ctx)
+	return err
+}
+
+func (q *QdrantAdapter) connectionMonitor() {
+	ticker := time.NewTicker(healthCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.mu.RLock()
+			err := q.ping(q.client)
+			q.mu.RUnlock()
+			if err != nil {
+				q.logger.Error("Connection health check failed", zap.Error(err))
+				q.metrics.ConnectionState.Set(0)
+				q.reconnect()
+			}
+		case <-q.healthCheck:
+			return
+		}
+	}
+}
+
+func (q *QdrantAdapter) reconnect() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.client.Close(); err != nil {
+		q.logger.Error("Error closing stale connection", zap.Error(err))
+	}
+
+	if err := q.connectWithRetry(); err != nil {
+		q.logger.Error("Failed to re-establish connection", zap.Error(err))
+	}
+}
+
+// acquire takes a pool slot and returns the current client under the read
+// lock so a concurrent reconnect cannot swap it mid-call
+func (q *QdrantAdapter) acquire(ctx context.Context) (*qdrant.Client, func(), error) {
+	if err := q.connPool.Acquire(ctx, 1); err != nil {
+		return nil, nil, err
+	}
+	q.mu.RLock()
+	return q.client, func() {
+		q.mu.RUnlock()
+		q.connPool.Release(1)
+	}, nil
+}
+
+func (q *QdrantAdapter) CreateCollection(ctx context.Context, name string, dim int64) error {
+	client, release, err := q.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	onDisk := q.config.OnDiskVectors
+	err = client.CreateCollection(ctx, &qdrant.CreateCollection{
+		CollectionName: name,
+		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
+			Size:     uint64(dim),
+			Distance: q.config.Distance,
+			OnDisk:   &onDisk,
+		}),
+	})
+	if err != nil {
+		q.metrics.ErrorCount.Inc()
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+
+	// every query filters on the tenant, so index it up front
+	wait := true
+	_, err = client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+		CollectionName: name,
+		FieldName:      tenantPayloadKey,
+		FieldType:      qdrant.FieldType_FieldTypeKeyword.Enum(),
+		Wait:           &wait,
+	})
+	if err != nil {
+		q.metrics.ErrorCount.Inc()
+		return fmt.Errorf("failed to index tenant field: %w", err)
+	}
+	return nil
+}
+
+// CreatePayloadIndex indexes a metadata field so filtered searches on it
+// do not scan the collection
+func (q *QdrantAdapter) CreatePayloadIndex(ctx context.Context, collection, field string, fieldType qdrant.FieldType) error {
+	client, release, err := q.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	wait := true
+	_, err = client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+		CollectionName: collection,
+		FieldName:      field,
+		FieldType:      qdrant.PtrOf(fieldType),
+		Wait:           &wait,
+	})
+	if err != nil {
+		q.metrics.ErrorCount.Inc()
+		return fmt.Errorf("failed to create payload index: %w", err)
+	}
+	return nil
+}
+
+// InsertVectors stores one point per vector with a random ID, carrying the
+// matching metadata as payload
+func (q *QdrantAdapter) InsertVectors(ctx context.Context, collection string, vectors [][]float32, metadatas []map[string]interface{}) error {
+	points, err := withRandomIDs(vectors, metadatas)
+	if err != nil {
+		return err
+	}
+	return q.Upsert(ctx, collection, points)
+}
+
+// Upsert writes points keyed by ID in concurrent batches of
+// maxBulkInsertSize, replacing existing points
+func (q *QdrantAdapter) Upsert(ctx context.Context, collection string, vectors []Vector) error {
+	if _, err := vectorDim(vectors); err != nil {
+		return err
+	}
+
+	tenant := TenantFromContext(ctx)
+	points := make([]*qdrant.PointStruct, len(vectors))
+	for i, v := range vectors {
+		payload, err := qdrant.TryValueMap(v.Metadata)
+		if err != nil {
+			return fmt.Errorf("vector %d metadata: %w", v.ID, err)
+		}
+		payload[tenantPayloadKey] = qdrant.NewValueString(tenant)
+		payload[pointIDPayloadKey] = qdrant.NewValueInt(v.ID)
+		points[i] = &qdrant.PointStruct{
+			Id:      pointID(tenant, v.ID),
+			Vectors: qdrant.NewVectorsDense(v.Values),
+			Payload: payload,
+		}
+	}
+
+	recordPartitionUsage("qdrant", collection, tenantPartition(tenant), "upsert", len(points))
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, (len(points)+maxBulkInsertSize-1)/maxBulkInsertSize)
+
+	for start := 0; start < len(points); start += maxBulkInsertSize {
+		end := start + maxBulkInsertSize
+		if end > len(points) {
+			end = len(points)
+		}
+
+		// acquiring before spawning bounds the goroutines, not just the
+		// calls, by the pool size
+		client, release, err := q.acquire(ctx)
+		if err != nil {
+			errChan <- err
+			break
+		}
+		wg.Add(1)
+		go func(batchIndex int, points []*qdrant.PointStruct) {
+			defer wg.Done()
+			defer release()
+
+			begin := time.Now()
+			wait := true
+			_, err := client.Upsert(ctx, &qdrant.UpsertPoints{
+				CollectionName: collection,
+				Wait:           &wait,
+				Points:         points,
+			})
+			q.metrics.InsertDuration.Observe(time.Since(begin).Seconds())
+
+			if err != nil {
+				q.metrics.ErrorCount.Inc()
+				errChan <- fmt.Errorf("batch %d insert failed: %w", batchIndex, err)
+			}
+		}(start/maxBulkInsertSize, points[start:end])
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	for err := range errChan {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes points by ID, only those owned by the context tenant
+func (q *QdrantAdapter) Delete(ctx context.Context, collection string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	client, release, err := q.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tenant := TenantFromContext(ctx)
+	// numeric IDs cover points written before IDs were derived; the tenant
+	// condition keeps those to the caller's own
+	pointIDs := make([]*qdrant.PointId, 0, 2*len(ids))
+	for _, id := range ids {
+		pointIDs = append(pointIDs, pointID(tenant, id), qdrant.NewIDNum(uint64(id)))
+	}
+	recordPartitionUsage("qdrant", collection, tenantPartition(tenant), "delete", len(ids))
+	wait := true
+	if _, err := client.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: collection,
+		Wait:           &wait,
+		Points: qdrant.NewPointsSelectorFilter(&qdrant.Filter{
+			Must: []*qdrant.Condition{
+				qdrant.NewHasID(pointIDs...),
+				qdrant.NewMatchKeyword(tenantPayloadKey, tenant),
+			},
+		}),
+	}); err != nil {
+		q.metrics.ErrorCount.Inc()
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	return nil
+}
+
+// Search is SearchVectors under the Store interface
+func (q *QdrantAdapter) Search(ctx context.Context, collection string, query []float32, k int, filter *Filter) ([]SearchResult, error) {
+	return q.SearchVectors(ctx, collection, query, k, filter)
+}
+
+// Stats reports the collection's point count and vector size
+func (q *QdrantAdapter) Stats(ctx context.Context, collection string) (CollectionStats, error) {
+	client, release, err := q.acquire(ctx)
+	if err != nil {
+		return CollectionStats{}, err
+	}
+	defer release()
+
+	info, err := client.GetCollectionInfo(ctx, collection)
+	if err != nil {
+		q.metrics.ErrorCount.Inc()
+		return CollectionStats{}, fmt.Errorf("collection info failed: %w", err)
+	}
+	return CollectionStats{
+		Name:      collection,
+		RowCount:  int64(info.GetPointsCount()),
+		Dimension: int64(info.GetConfig().GetParams().GetVectorsConfig().GetParams().GetSize()),
+	}, nil
+}
+
+// SearchVectors returns the k nearest points of the context tenant,
+// restricted to payloads matching filter when it is non-nil
+func (q *QdrantAdapter) SearchVectors(ctx context.Context, collection string, query []float32, k int, filter *Filter) ([]SearchResult, error) {
+	if err := q.validateFilter(collection, filter); err != nil {
+		return nil, err
+	}
+
+	client, release, err := q.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	start := time.Now()
+	defer func() {
+		q.metrics.QueryDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	tenant := TenantFromContext(ctx)
+	recordPartitionUsage("qdrant", collection, tenantPartition(tenant), "search", 1)
+	scoped := qdrantFilter(filter)
+	if scoped == nil {
+		scoped = &qdrant.Filter{}
+	}
+	scoped.Must = append(scoped.Must, qdrant.NewMatchKeyword(tenantPayloadKey, tenant))
+
+	limit := uint64(k)
+	points, err := client.Query(ctx, &qdrant.QueryPoints{
+		CollectionName: collection,
+		Query:          qdrant.NewQueryDense(query),
+		Filter:         scoped,
+		Limit:          &limit,
+		WithPayload:    qdrant.NewWithPayload(true),
+	})
+	if err != nil {
+		q.metrics.ErrorCount.Inc()
+		return nil, fmt.Errorf("search operation failed: %w", err)
+	}
+
+	results := make([]SearchResult, 0, len(points))
+	for _, p := range points {
+		results = append(results, SearchResult{
+			ID:       vectorID(p.GetId(), p.GetPayload()),
+			Score:    p.GetScore(),
+			Metadata: payloadToMap(p.GetPayload()),
+		})
+	}
+	return results, nil
+}
+
+// CreateSnapshot asks the cluster to snapshot a collection and returns the
+// snapshot name, which the backup job copies to object storage
+func (q *QdrantAdapter) CreateSnapshot(ctx context.Context, collection string) (string, error) {
+	client, release, err := q.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	snap, err := client.CreateSnapshot(ctx, collection)
+	if err != nil {
+		q.metrics.ErrorCount.Inc()
+		return "", fmt.Errorf("snapshot creation failed: %w", err)
+	}
+	return snap.GetName(), nil
+}
+
+// ListSnapshots returns the snapshot names held for a collection
+func (q *QdrantAdapter) ListSnapshots(ctx context.Context, collection string) ([]string, error) {
+	client, release, err := q.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	snaps, err := client.ListSnapshots(ctx, collection)
+	if err != nil {
+		q.metrics.ErrorCount.Inc()
+		return nil, fmt.Errorf("snapshot listing failed: %w", err)
+	}
+	names := make([]string, 0, len(snaps))
+	for _, s := range snaps {
+		names = append(names, s.GetName())
+	}
+	return names, nil
+}
+
+// DeleteSnapshot removes a collection snapshot from the cluster
+func (q *QdrantAdapter) DeleteSnapshot(ctx context.Context, collection, name string) error {
+	client, release, err := q.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := client.DeleteSnapshot(ctx, collection, name); err != nil {
+		q.metrics.ErrorCount.Inc()
+		return fmt.Errorf("snapshot deletion failed: %w", err)
+	}
+	return nil
+}
+
+func (q *QdrantAdapter) Close() error {
+	close(q.healthCheck)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.client.Close()
+}
+
+// qdrantFilter translates a parsed filter into Qdrant conditions
+func qdrantFilter(f *Filter) *qdrant.Filter {
+	if f == nil {
+		return nil
+	}
+	if and, ok := f.root.(andNode); ok {
+		return &qdrant.Filter{Must: qdrantConditions(and.children)}
+	}
+	return &qdrant.Filter{Must: []*qdrant.Condition{qdrantCondition(f.root)}}
+}
+
+func qdrantConditions(nodes []filterNode) []*qdrant.Condition {
+	conds := make([]*qdrant.Condition, len(nodes))
+	for i, n := range nodes {
+		conds[i] = qdrantCondition(n)
+	}
+	return conds
+}
+
+func qdrantCondition(n filterNode) *qdrant.Condition {
+	switch n := n.(type) {
+	case andNode:
+		return qdrant.NewFilterAsCondition(&qdrant.Filter{Must: qdrantConditions(n.children)})
+	case orNode:
+		return qdrant.NewFilterAsCondition(&qdrant.Filter{Should: qdrantConditions(n.children)})
+	case compareNode:
+		switch n.op {
+		case OpEq:
+			return qdrantMatch(n.field, n.value)
+		case OpNe:
+			return qdrant.NewFilterAsCondition(&qdrant.Filter{MustNot: []*qdrant.Condition{qdrantMatch(n.field, n.value)}})
+		}
+		bound := toFloat(n.value)
+		r := &qdrant.Range{}
+		switch n.op {
+		case OpLt:
+			r.Lt = &bound
+		case OpLe:
+			r.Lte = &bound
+		case OpGt:
+			r.Gt = &bound
+		case OpGe:
+			r.Gte = &bound
+		}
+		return qdrant.NewRange(n.field, r)
+	case inNode:
+		in := qdrantIn(n.field, n.values)
+		if n.negate {
+			return qdrant.NewFilterAsCondition(&qdrant.Filter{MustNot: []*qdrant.Condition{in}})
+		}
+		return in
+	}
+	return nil
+}
+
+func qdrantMatch(field string, value interface{}) *qdrant.Condition {
+	switch v := value.(type) {
+	case string:
+		return qdrant.NewMatchKeyword(field, v)
+	case int64:
+		return qdrant.NewMatchInt(field, v)
+	case bool:
+		return qdrant.NewMatchBool(field, v)
+	}
+	// Qdrant only matches floats by range
+	f := toFloat(value)
+	return qdrant.NewRange(field, &qdrant.Range{Gte: &f, Lte: &f})
+}
+
+// qdrantIn uses the native any-of matchers for homogeneous keyword or
+// integer lists and falls back to a should-filter otherwise
+func qdrantIn(field string, values []interface{}) *qdrant.Condition {
+	var keywords []string
+	var ints []int64
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			keywords = append(keywords, v)
+		case int64:
+			ints = append(ints, v)
+		}
+	}
+	switch {
+	case len(keywords) == len(values):
+		return qdrant.NewMatchKeywords(field, keywords...)
+	case len(ints) == len(values):
+		return qdrant.NewMatchInts(field, ints...)
+	}
+	conds := make([]*qdrant.Condition, len(values))
+	for i, v := range values {
+		conds[i] = qdrantMatch(field, v)
+	}
+	return qdrant.NewFilterAsCondition(&qdrant.Filter{Should: conds})
+}
+
+func payloadToMap(payload map[string]*qdrant.Value) map[string]interface{} {
+	out := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		if k == tenantPayloadKey || k == pointIDPayloadKey {
+			continue
+		}
+		out[k] = valueToInterface(v)
+	}
+	return out
+}
+
+func valueToInterface(v *qdrant.Value) interface{} {
+	switch kind := v.GetKind().(type) {
+	case *qdrant.Value_StringValue:
+		return kind.StringValue
+	case *qdrant.Value_IntegerValue:
+		return kind.IntegerValue
+	case *qdrant.Value_DoubleValue:
+		return kind.DoubleValue
+	case *qdrant.Value_BoolValue:
+		return kind.BoolValue
+	case *qdrant.Value_StructValue:
+		return payloadToMap(kind.StructValue.GetFields())
+	case *qdrant.Value_ListValue:
+		list := kind.ListValue.GetValues()
+		out := make([]interface{}, len(list))
+		for i, item := range list {
+			out[i] = valueToInterface(item)
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// pointID derives a point's Qdrant ID from its tenant and ID, so tenants
+// sharing a collection cannot overwrite each other's points
+func pointID(tenant string, id int64) *qdrant.PointId {
+	name := tenant + "\x00" + strconv.FormatInt(id, 10)
+	return qdrant.NewIDUUID(uuid.NewSHA1(uuid.NameSpaceOID, []byte(name)).String())
+}
+
+// vectorID recovers the caller's ID of a point; points written before IDs
+// were derived carry it as their numeric Qdrant ID
+func vectorID(id *qdrant.PointId, payload map[string]*qdrant.Value) int64 {
+	if v, ok := payload[pointIDPayloadKey]; ok {
+		return v.GetIntegerValue()
+	}
+	return int64(id.GetNum())
+}
+
+// randomPointID returns a random non-negative 63-bit ID so results fit the
+// int64 SearchResult.ID shared with Milvus
+func randomPointID() uint64 {
+	var b [8]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint64(b[:]) >> 1
+}
@@ -0,0 +1,257 @@
+// registry.go - Collection Dimension and Schema Registry
+package vectordb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDimensionMismatch is returned before any backend call when a
+	// vector does not match its collection's registered dimension
+	ErrDimensionMismatch = errors.New("vector dimension mismatch")
+	// ErrCollectionNotRegistered is returned for collections the registry
+	// has no record of
+	ErrCollectionNotRegistered = errors.New("collection not registered")
+)
+
+// CollectionSpec is the registered contract of a collection
+type CollectionSpec struct {
+	Name      string
+	Dimension int64
+	Metric    string
+	Schema    MetadataSchema
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CollectionRegistry records each collection's dimension, metric and
+// metadata schema in Postgres so every replica validates against the same
+// contract, whichever backend holds the vectors
+type CollectionRegistry struct {
+	db *sql.DB
+
+	mu    sync.RWMutex
+	specs map[string]CollectionSpec
+}
+
+func NewCollectionRegistry(db *sql.DB) *CollectionRegistry {
+	return &CollectionRegistry{db: db, specs: make(map[string]CollectionSpec)}
+}
+
+// Register records a new collection, or updates metric and schema of an
+// existing one. The dimension of a registered collection never changes, and
+// an empty metric or schema leaves the recorded one in place.
+func (r *CollectionRegistry) Register(ctx context.Context, spec CollectionSpec) error {
+	if spec.Name == "" || spec.Dimension <= 0 {
+		return fmt.Errorf("collection spec needs a name and a positive dimension")
+	}
+	schema, err := json.Marshal(encodeSchema(spec.Schema))
+	if err != nil {
+		return err
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO vector_collections (name, dimension, metric, metadata_schema)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE
+		SET metric = COALESCE(NULLIF(EXCLUDED.metric, ''), vector_collections.metric),
+		    metadata_schema = CASE WHEN EXCLUDED.metadata_schema = '{}'::jsonb
+		        THEN vector_collections.metadata_schema
+		        ELSE EXCLUDED.metadata_schema END,
+		    updated_at = NOW()
+		WHERE vector_collections.dimension = EXCLUDED.dimension`,
+		spec.Name, spec.Dimension, spec.Metric, schema)
+	if err != nil {
+		return fmt.Errorf("collection registration failed: %w", err)
+	}
+	r.forget(spec.Name)
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	// the conflict update was skipped, so the dimensions differ
+	existing, err := r.Get(ctx, spec.Name)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %q is registered with dimension %d, not %d",
+		ErrDimensionMismatch, spec.Name, existing.Dimension, spec.Dimension)
+}
+
+// Get returns a collection's spec, served from cache after the first read
+func (r *CollectionRegistry) Get(ctx context.Context, name string) (CollectionSpec, error) {
+	r.mu.RLock()
+	spec, ok := r.specs[name]
+	r.mu.RUnlock()
+	if ok {
+		return spec, nil
+	}
+
+	var raw []byte
+	spec.Name = name
+	err := r.db.QueryRowContext(ctx, `
+		SELECT dimension, metric, metadata_schema, created_at, updated_at
+		FROM vector_collections WHERE name = $1`, name).
+		Scan(&spec.Dimension, &spec.Metric, &raw, &spec.CreatedAt, &spec.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return spec, fmt.Errorf("%w: %q", ErrCollectionNotRegistered, name)
+	}
+	if err != nil {
+		return spec, fmt.Errorf("collection lookup failed: %w", err)
+	}
+	var encoded map[string]string
+	if err := json.Unmarshal(raw, &encoded); err != nil {
+		return spec, fmt.Errorf("corrupt schema for %q: %w", name, err)
+	}
+	if spec.Schema, err = decodeSchema(encoded); err != nil {
+		return spec, fmt.Errorf("corrupt schema for %q: %w", name, err)
+	}
+
+	r.mu.Lock()
+	r.specs[name] = spec
+	r.mu.Unlock()
+	return spec, nil
+}
+
+// Unregister removes a collection's record after it is dropped
+func (r *CollectionRegistry) Unregister(ctx context.Context, name string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM vector_collections WHERE name = $1`, name); err != nil {
+		return fmt.Errorf("collection unregister failed: %w", err)
+	}
+	r.forget(name)
+	return nil
+}
+
+func (r *CollectionRegistry) forget(name string) {
+	r.mu.Lock()
+	delete(r.specs, name)
+	r.mu.Unlock()
+}
+
+// CheckVectors verifies every vector against the registered dimension
+func (r *CollectionRegistry) CheckVectors(ctx context.Context, collection string, vectors []Vector) error {
+	spec, err := r.Get(ctx, collection)
+	if err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		if int64(len(v.Values)) != spec.Dimension {
+			return fmt.Errorf("%w: vector %d in %q has dimension %d, collection expects %d",
+				ErrDimensionMismatch, v.ID, collection, len(v.Values), spec.Dimension)
+		}
+	}
+	return nil
+}
+
+// CheckQuery verifies a query vector and filter against the registered
+// dimension and metadata schema
+func (r *CollectionRegistry) CheckQuery(ctx context.Context, collection string, query []float32, filter *Filter) error {
+	spec, err := r.Get(ctx, collection)
+	if err != nil {
+		return err
+	}
+	if int64(len(query)) != spec.Dimension {
+		return fmt.Errorf("%w: query for %q has dimension %d, collection expects %d",
+			ErrDimensionMismatch, collection, len(query), spec.Dimension)
+	}
+	if filter != nil && len(spec.Schema) > 0 {
+		return filter.Validate(spec.Schema)
+	}
+	return nil
+}
+
+func encodeSchema(schema MetadataSchema) map[string]string {
+	out := make(map[string]string, len(schema))
+	for field, typ := range schema {
+		out[field] = typ.String()
+	}
+	return out
+}
+
+func decodeSchema(encoded map[string]string) (MetadataSchema, error) {
+	schema := make(MetadataSchema, len(encoded))
+	for field, name := range encoded {
+		switch name {
+		case "string":
+			schema[field] = FieldString
+		case "int":
+			schema[field] = FieldInt
+		case "float":
+			schema[field] = FieldFloat
+		case "bool":
+			schema[field] = FieldBool
+		default:
+			return nil, fmt.Errorf("unknown type %q for field %q", name, field)
+		}
+	}
+	return schema, nil
+}
+
+// ValidatingStore checks writes and searches against a CollectionRegistry
+// before they reach the backend, so mismatches fail with the same error on
+// every backend
+type ValidatingStore struct {
+	Store
+	registry *CollectionRegistry
+	// metric is recorded for collections this store creates
+	metric string
+}
+
+func NewValidatingStore(store Store, registry *CollectionRegistry, metric string) *ValidatingStore {
+	return &ValidatingStore{Store: store, registry: registry, metric: metric}
+}
+
+// CreateCollection registers the collection before creating it, so a
+// dimension conflict with an existing registration creates nothing
+func (v *ValidatingStore) CreateCollection(ctx context.Context, name string, dim int64) error {
+	if err := v.registry.Register(ctx, CollectionSpec{Name: name, Dimension: dim, Metric: v.metric}); err != nil {
+		return err
+	}
+	return v.Store.CreateCollection(ctx, name, dim)
+}
+
+func (v *ValidatingStore) Upsert(ctx context.Context, collection string, vectors []Vector) error {
+	if err := v.registry.CheckVectors(ctx, collection, vectors); err != nil {
+		return err
+	}
+	return v.Store.Upsert(ctx, collection, vectors)
+}
+
+func (v *ValidatingStore) Search(ctx context.Context, collection string, query []float32, k int, filter *Filter) ([]SearchResult, error) {
+	if err := v.registry.CheckQuery(ctx, collection, query, filter); err != nil {
+		return nil, err
+	}
+	return v.Store.Search(ctx, collection, query, k, filter)
+}
+
+// RegisterSchema persists a collection's metadata schema and applies it to
+// the backend
+func (v *ValidatingStore) RegisterSchema(ctx context.Context, collection string, schema MetadataSchema) error {
+	spec, err := v.registry.Get(ctx, collection)
+	if err != nil {
+		return err
+	}
+	spec.Schema = schema
+	if err := v.registry.Register(ctx, spec); err != nil {
+		return err
+	}
+	v.Store.SetSchema(collection, schema)
+	return nil
+}
+
+/*
+CREATE TABLE IF NOT EXISTS vector_collections (
+    name            VARCHAR(255) PRIMARY KEY,
+    dimension       BIGINT NOT NULL CHECK (dimension > 0),
+    metric          VARCHAR(32) NOT NULL DEFAULT '',
+    metadata_schema JSONB NOT NULL DEFAULT '{}',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+*/
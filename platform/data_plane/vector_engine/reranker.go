@@ -0,0 +1,209 @@
+// reranker.go - Cross-Encoder Reranking of Vector Search Results
+package vectordb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRerankCandidates = 50
+	defaultRerankTextField  = "content"
+)
+
+// Reranker scores query/document pairs; higher is more relevant. It
+// returns one score per document, in order.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, docs []string) ([]float32, error)
+}
+
+// RerankConfig enables reranking for one collection
+type RerankConfig struct {
+	Reranker Reranker
+	// Candidates is how many vector hits are fetched and re-scored before
+	// the top k are kept; defaults to 50 and is never below k
+	Candidates int
+	// TextField is the metadata key holding the text to score, "content"
+	// by default. Hits without it keep their vector order after the
+	// reranked ones.
+	TextField string
+	// FailOpen returns vector-ranked results when the reranker errors
+	// instead of failing the search
+	FailOpen bool
+}
+
+// RerankingStore wraps a Store with an optional per-collection reranking
+// stage for SearchText
+type RerankingStore struct {
+	Store
+	logger *zap.Logger
+
+	mu      sync.RWMutex
+	configs map[string]RerankConfig
+}
+
+func NewRerankingStore(store Store, logger *zap.Logger) *RerankingStore {
+	return &RerankingStore{
+		Store:   store,
+		logger:  logger.Named("reranker"),
+		configs: make(map[string]RerankConfig),
+	}
+}
+
+// SetReranker enables reranking for collection; a nil Reranker disables it
+func (r *RerankingStore) SetReranker(collection string, cfg RerankConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cfg.Reranker == nil {
+		delete(r.configs, collection)
+		return
+	}
+	r.configs[collection] = cfg
+}
+
+// SearchText runs a vector search for query and, when the collection has
+// a reranker, re-scores the candidates against text. Score then holds the
+// reranker score and VectorScore the original similarity.
+func (r *RerankingStore) SearchText(ctx context.Context, collection, text string, query []float32, k int, filter *Filter) ([]SearchResult, error) {
+	r.mu.RLock()
+	cfg, ok := r.configs[collection]
+	r.mu.RUnlock()
+	if !ok || text == "" {
+		return r.Store.Search(ctx, collection, query, k, filter)
+	}
+
+	candidates := cfg.Candidates
+	if candidates <= 0 {
+		candidates = defaultRerankCandidates
+	}
+	if candidates < k {
+		candidates = k
+	}
+	field := cfg.TextField
+	if field == "" {
+		field = defaultRerankTextField
+	}
+
+	results, err := r.Store.Search(ctx, collection, query, candidates, filter)
+	if err != nil || len(results) == 0 {
+		return results, err
+	}
+
+	var docs []string
+	var scored, unscored []SearchResult
+	for _, res := range results {
+		res.VectorScore = res.Score
+		if doc, ok := res.Metadata[field].(string); ok && doc != "" {
+			docs = append(docs, doc)
+			scored = append(scored, res)
+		} else {
+			unscored = append(unscored, res)
+		}
+	}
+
+	if len(docs) > 0 {
+		start := time.Now()
+		scores, err := cfg.Reranker.Rerank(ctx, text, docs)
+		rerankDuration.WithLabelValues(collection).Observe(time.Since(start).Seconds())
+		if err == nil && len(scores) != len(docs) {
+			err = fmt.Errorf("reranker returned %d scores for %d documents", len(scores), len(docs))
+		}
+		if err != nil {
+			if !cfg.FailOpen {
+				return nil, fmt.Errorf("rerank failed: %w", err)
+			}
+			r.logger.Warn("Reranker failed, returning vector order",
+				zap.String("collection", collection), zap.Error(err))
+			return truncate(results, k), nil
+		}
+		for i := range scored {
+			scored[i].Score = scores[i]
+		}
+		sort.SliceStable(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+	}
+	return truncate(append(scored, unscored...), k), nil
+}
+
+func truncate(results []SearchResult, k int) []SearchResult {
+	if len(results) > k {
+		return results[:k]
+	}
+	return results
+}
+
+// HTTPReranker calls a rerank endpoint speaking the Cohere/Jina/TEI
+// request shape: {"query", "documents", "model"} in, {"results": [{"index",
+// "relevance_score"}]} out
+type HTTPReranker struct {
+	Endpoint string
+	Model    string
+	APIKey   string
+	Client   *http.Client
+}
+
+type httpRerankRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+}
+
+type httpRerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float32 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+func (h *HTTPReranker) Rerank(ctx context.Context, query string, docs []string) ([]float32, error) {
+	body, err := json.Marshal(httpRerankRequest{Model: h.Model, Query: query, Documents: docs})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.APIKey)
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rerank request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rerank endpoint returned %s", resp.Status)
+	}
+
+	var out httpRerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("malformed rerank response: %w", err)
+	}
+	scores := make([]float32, len(docs))
+	seen := 0
+	for _, r := range out.Results {
+		if r.Index < 0 || r.Index >= len(docs) {
+			return nil, fmt.Errorf("rerank response index %d out of range", r.Index)
+		}
+		scores[r.Index] = r.RelevanceScore
+		seen++
+	}
+	if seen != len(docs) {
+		return nil, fmt.Errorf("rerank response scored %d of %d documents", seen, len(docs))
+	}
+	return scores, nil
+}
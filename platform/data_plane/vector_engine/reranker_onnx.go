@@ -0,0 +1,179 @@
+//go:build onnx
+
+// reranker_onnx.go - Local Cross-Encoder Reranker on ONNX Runtime
+package vectordb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/daulet/tokenizers"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+var ortInit sync.Once
+
+// ONNXRerankerConfig points at a BERT- or XLM-R-style cross-encoder exported
+// to ONNX (for example ms-marco-MiniLM or bge-reranker) and its
+// tokenizer.json
+type ONNXRerankerConfig struct {
+	ModelPath     string
+	TokenizerPath string
+	// RuntimeLibrary is the onnxruntime shared library path
+	RuntimeLibrary string
+	// MaxLength caps query plus document tokens, 512 by default
+	MaxLength int
+	// BatchSize is the number of pairs per inference call, 16 by default
+	BatchSize int
+}
+
+// ONNXReranker scores query/document pairs in-process
+type ONNXReranker struct {
+	cfg           ONNXRerankerConfig
+	tokenizer     *tokenizers.Tokenizer
+	session       *ort.DynamicAdvancedSession
+	useTokenTypes bool
+}
+
+func NewONNXReranker(cfg ONNXRerankerConfig) (*ONNXReranker, error) {
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = 512
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 16
+	}
+
+	var initErr error
+	ortInit.Do(func() {
+		ort.SetSharedLibraryPath(cfg.RuntimeLibrary)
+		initErr = ort.InitializeEnvironment()
+	})
+	if initErr != nil {
+		return nil, fmt.Errorf("onnxruntime initialization failed: %w", initErr)
+	}
+
+	tk, err := tokenizers.FromFile(cfg.TokenizerPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+
+	inputs, outputs, err := ort.GetInputOutputInfo(cfg.ModelPath)
+	if err != nil {
+		tk.Close()
+		return nil, fmt.Errorf("failed to inspect model: %w", err)
+	}
+	if len(outputs) == 0 {
+		tk.Close()
+		return nil, fmt.Errorf("model has no outputs")
+	}
+	inputNames := []string{"input_ids", "attention_mask"}
+	useTokenTypes := false
+	for _, in := range inputs {
+		if in.Name == "token_type_ids" {
+			useTokenTypes = true
+			inputNames = append(inputNames, in.Name)
+		}
+	}
+
+	session, err := ort.NewDynamicAdvancedSession(cfg.ModelPath, inputNames, []string{outputs[0].Name}, nil)
+	if err != nil {
+		tk.Close()
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return &ONNXReranker{cfg: cfg, tokenizer: tk, session: session, useTokenTypes: useTokenTypes}, nil
+}
+
+func (o *ONNXReranker) Rerank(ctx context.Context, query string, docs []string) ([]float32, error) {
+	scores := make([]float32, 0, len(docs))
+	for start := 0; start < len(docs); start += o.cfg.BatchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := start + o.cfg.BatchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+		batch, err := o.score(query, docs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, batch...)
+	}
+	return scores, nil
+}
+
+// score encodes each pair as [CLS] query [SEP] doc [SEP], taking the
+// separator from the end of the query encoding so BERT and XLM-R
+// vocabularies both work
+func (o *ONNXReranker) score(query string, docs []string) ([]float32, error) {
+	q, _ := o.tokenizer.Encode(query, true)
+	if len(q) < 2 || len(q) >= o.cfg.MaxLength {
+		return nil, fmt.Errorf("query encodes to %d tokens, limit %d", len(q), o.cfg.MaxLength)
+	}
+	sep := q[len(q)-1]
+
+	pairs := make([][]uint32, len(docs))
+	width := 0
+	for i, doc := range docs {
+		d, _ := o.tokenizer.Encode(doc, false)
+		if room := o.cfg.MaxLength - len(q) - 1; len(d) > room {
+			d = d[:room]
+		}
+		pair := append(append(append([]uint32{}, q...), d...), sep)
+		pairs[i] = pair
+		if len(pair) > width {
+			width = len(pair)
+		}
+	}
+
+	n := len(docs)
+	ids := make([]int64, n*width)
+	mask := make([]int64, n*width)
+	types := make([]int64, n*width)
+	for i, pair := range pairs {
+		for j, id := range pair {
+			ids[i*width+j] = int64(id)
+			mask[i*width+j] = 1
+			if j >= len(q) {
+				types[i*width+j] = 1
+			}
+		}
+	}
+
+	shape := ort.NewShape(int64(n), int64(width))
+	idsT, err := ort.NewTensor(shape, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer idsT.Destroy()
+	maskT, err := ort.NewTensor(shape, mask)
+	if err != nil {
+		return nil, err
+	}
+	defer maskT.Destroy()
+	inputs := []ort.Value{idsT, maskT}
+	if o.useTokenTypes {
+		typesT, err := ort.NewTensor(shape, types)
+		if err != nil {
+			return nil, err
+		}
+		defer typesT.Destroy()
+		inputs = append(inputs, typesT)
+	}
+
+	out, err := ort.NewEmptyTensor[float32](ort.NewShape(int64(n), 1))
+	if err != nil {
+		return nil, err
+	}
+	defer out.Destroy()
+	if err := o.session.Run(inputs, []ort.Value{out}); err != nil {
+		return nil, fmt.Errorf("inference failed: %w", err)
+	}
+	return append([]float32(nil), out.GetData()...), nil
+}
+
+func (o *ONNXReranker) Close() error {
+	o.tokenizer.Close()
+	return o.session.Destroy()
+}
@@ -0,0 +1,33 @@
+//go:build !onnx
+
+package vectordb
+
+import (
+	"context"
+	"errors"
+)
+
+var errNoONNX = errors.New("local reranker unavailable: built without -tags onnx")
+
+// ONNXRerankerConfig is accepted but unusable without the onnx build tag
+type ONNXRerankerConfig struct {
+	ModelPath      string
+	TokenizerPath  string
+	RuntimeLibrary string
+	MaxLength      int
+	BatchSize      int
+}
+
+type ONNXReranker struct{}
+
+// NewONNXReranker needs a binary built with -tags onnx, which links
+// onnxruntime and the tokenizers library
+func NewONNXReranker(ONNXRerankerConfig) (*ONNXReranker, error) {
+	return nil, errNoONNX
+}
+
+func (*ONNXReranker) Rerank(context.Context, string, []string) ([]float32, error) {
+	return nil, errNoONNX
+}
+
+func (*ONNXReranker) Close() error { return nil }
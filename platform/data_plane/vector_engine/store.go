@@ -0,0 +1,182 @@
+// store.go - Backend-Agnostic Vector Store Interface and Factory
+package vectordb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pinecone-io/go-pinecone/pinecone"
+	"github.com/qdrant/go-client/qdrant"
+	"go.uber.org/zap"
+)
+
+// Vector is one embedding addressed by a caller-chosen ID
+type Vector struct {
+	ID       int64
+	Values   []float32
+	Metadata map[string]interface{}
+}
+
+// CollectionStats summarizes a collection; Dimension is zero when the
+// backend cannot report it
+type CollectionStats struct {
+	Name      string
+	RowCount  int64
+	Dimension int64
+}
+
+// Store is implemented by every vector backend. The memory and RAG layers
+// depend on it rather than on a concrete adapter. Search takes a nil filter
+// to match everything; filters are validated against the schema given to
+// SetSchema, when there is one.
+type Store interface {
+	CreateCollection(ctx context.Context, name string, dim int64) error
+	SetSchema(collection string, schema MetadataSchema)
+	Upsert(ctx context.Context, collection string, vectors []Vector) error
+	Delete(ctx context.Context, collection string, ids []int64) error
+	Search(ctx context.Context, collection string, query []float32, k int, filter *Filter) ([]SearchResult, error)
+	Stats(ctx context.Context, collection string) (CollectionStats, error)
+	Close() error
+}
+
+var (
+	_ Store = (*MilvusAdapter)(nil)
+	_ Store = (*QdrantAdapter)(nil)
+	_ Store = (*WeaviateAdapter)(nil)
+	_ Store = (*PineconeAdapter)(nil)
+)
+
+// Backend names a vector database implementation
+type Backend string
+
+const (
+	BackendMilvus   Backend = "milvus"
+	BackendQdrant   Backend = "qdrant"
+	BackendWeaviate Backend = "weaviate"
+	BackendPinecone Backend = "pinecone"
+)
+
+// Config selects a backend and carries its settings; only the section for
+// the selected backend is read
+type Config struct {
+	Backend  Backend
+	Milvus   MilvusConfig
+	Qdrant   QdrantConfig
+	Weaviate WeaviateConfig
+	Pinecone PineconeConfig
+	// Registry, when set, validates dimensions and filters against the
+	// collection contracts recorded in Postgres before calling the backend
+	Registry *CollectionRegistry
+}
+
+// NewStore connects to the configured backend
+func NewStore(cfg Config, logger *zap.Logger) (Store, error) {
+	store, err := newBackend(cfg, logger)
+	if err != nil || cfg.Registry == nil {
+		return store, err
+	}
+	return NewValidatingStore(store, cfg.Registry, cfg.metric()), nil
+}
+
+func newBackend(cfg Config, logger *zap.Logger) (Store, error) {
+	switch cfg.Backend {
+	case BackendMilvus, "":
+		return NewMilvusAdapter(cfg.Milvus, logger)
+	case BackendQdrant:
+		return NewQdrantAdapter(cfg.Qdrant, logger)
+	case BackendWeaviate:
+		return NewWeaviateAdapter(cfg.Weaviate, logger)
+	case BackendPinecone:
+		return NewPineconeAdapter(cfg.Pinecone, logger)
+	default:
+		return nil, fmt.Errorf("unknown vector backend %q", cfg.Backend)
+	}
+}
+
+// metric names the selected backend's distance metric, applying the same
+// defaults as the adapters
+func (c Config) metric() string {
+	switch c.Backend {
+	case BackendQdrant:
+		if c.Qdrant.Distance == qdrant.Distance_UnknownDistance {
+			return qdrant.Distance_Cosine.String()
+		}
+		return c.Qdrant.Distance.String()
+	case BackendWeaviate:
+		if c.Weaviate.Distance == "" {
+			return "cosine"
+		}
+		return c.Weaviate.Distance
+	case BackendPinecone:
+		if c.Pinecone.Metric == "" {
+			return string(pinecone.Cosine)
+		}
+		return string(c.Pinecone.Metric)
+	default:
+		return c.Milvus.Index.withDefaults().Metric
+	}
+}
+
+// BatchError is one failed write batch: Count vectors starting at Offset
+// in the caller's input
+type BatchError struct {
+	Offset int
+	Count  int
+	Err    error
+}
+
+// PartialInsertError reports batches that failed while others succeeded,
+// so callers can retry only the failed ranges
+type PartialInsertError struct {
+	Total  int
+	Failed []BatchError
+}
+
+func (e *PartialInsertError) Error() string {
+	failed := 0
+	for _, b := range e.Failed {
+		failed += b.Count
+	}
+	return fmt.Sprintf("%d of %d vectors failed in %d batches; first at offset %d: %v",
+		failed, e.Total, len(e.Failed), e.Failed[0].Offset, e.Failed[0].Err)
+}
+
+// Unwrap exposes the batch errors to errors.Is and errors.As
+func (e *PartialInsertError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, b := range e.Failed {
+		errs[i] = b.Err
+	}
+	return errs
+}
+
+// vectorDim validates that vectors is non-empty and uniformly sized,
+// returning the shared dimension
+func vectorDim(vectors []Vector) (int, error) {
+	if len(vectors) == 0 {
+		return 0, fmt.Errorf("invalid input dimensions")
+	}
+	dim := len(vectors[0].Values)
+	if dim == 0 {
+		return 0, fmt.Errorf("vector %d is empty", vectors[0].ID)
+	}
+	for _, v := range vectors[1:] {
+		if len(v.Values) != dim {
+			return 0, fmt.Errorf("vector %d has dimension %d, expected %d", v.ID, len(v.Values), dim)
+		}
+	}
+	return dim, nil
+}
+
+// withRandomIDs pairs raw vectors and metadata under fresh random IDs for
+// the InsertVectors entry points
+func withRandomIDs(vectors [][]float32, metadatas []map[string]interface{}) ([]Vector, error) {
+	if len(vectors) == 0 || len(vectors) != len(metadatas) {
+		return nil, fmt.Errorf("invalid input dimensions")
+	}
+	out := make([]Vector, len(vectors))
+	for i := range vectors {
+		out[i] = Vector{ID: int64(randomPointID()), Values: vectors[i], Metadata: metadatas[i]}
+	}
+	return out, nil
+}
@@ -0,0 +1,51 @@
+// tenant.go - Tenant Scoping for Vector Operations
+package vectordb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// DefaultTenant owns vectors written without a tenant in the context
+const DefaultTenant = "default"
+
+type tenantCtxKey struct{}
+
+// WithTenant scopes vector operations on ctx to tenantID
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant set by WithTenant, or DefaultTenant
+func TenantFromContext(ctx context.Context) string {
+	if t, ok := ctx.Value(tenantCtxKey{}).(string); ok && t != "" {
+		return t
+	}
+	return DefaultTenant
+}
+
+// tenantPartition maps a tenant onto a partition name that is valid on
+// every backend: letters, digits and underscores, at most 64 characters.
+// The default tenant uses Milvus's built-in default partition. Tenant IDs
+// that need rewriting get a hash suffix so two IDs never collide.
+func tenantPartition(tenant string) string {
+	if tenant == DefaultTenant {
+		return "_default"
+	}
+	clean := strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, tenant)
+	if clean == tenant && len(tenant) <= 62 {
+		return "t_" + tenant
+	}
+	sum := sha256.Sum256([]byte(tenant))
+	if len(clean) > 45 {
+		clean = clean[:45]
+	}
+	return "t_" + clean + "_" + hex.EncodeToString(sum[:8])
+}
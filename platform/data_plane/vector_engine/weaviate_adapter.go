@@ -0,0 +1,826 @@
+// weaviate_adapter.go - Weaviate Vector Database Integration with Hybrid Search
+package vectordb
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/auth"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/filters"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+	"github.com/weaviate/weaviate/entities/models"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// contentProperty holds the text BM25 ranks; InsertVectors fills it
+	// from metadata["content"]
+	contentProperty  = "content"
+	metadataProperty = "metadata"
+	pointIDProperty  = "point_id"
+	// filterPropertyPrefix marks top-level copies of metadata fields
+	// declared with DeclareFilterFields, which native where-filters need
+	filterPropertyPrefix = "meta_"
+
+	defaultHybridAlpha = 0.5
+)
+
+type WeaviateConfig struct {
+	Host              string // host:port
+	Scheme            string // http or https
+	APIKey            string
+	TLSConfig         *tls.Config
+	ConnectionTimeout time.Duration
+	// HybridAlpha weights vector against keyword relevance in HybridSearch:
+	// 1 is pure vector, 0 is pure BM25. Defaults to 0.5.
+	HybridAlpha float32
+	// Distance is the HNSW metric, "cosine" by default
+	Distance string
+}
+
+type WeaviateAdapter struct {
+	client      *weaviate.Client
+	config      WeaviateConfig
+	logger      *zap.Logger
+	connPool    *semaphore.Weighted
+	healthCheck chan struct{}
+	metrics     *VectorDBMetrics
+	mu          sync.RWMutex
+	tenants     sync.Map // "class/tenant" known to exist
+	schemaRegistry
+}
+
+func NewWeaviateAdapter(cfg WeaviateConfig, logger *zap.Logger) (*WeaviateAdapter, error) {
+	if cfg.Scheme == "" {
+		cfg.Scheme = "https"
+	}
+	if cfg.HybridAlpha == 0 {
+		cfg.HybridAlpha = defaultHybridAlpha
+	}
+	if cfg.Distance == "" {
+		cfg.Distance = "cosine"
+	}
+	adapter := &WeaviateAdapter{
+		config:      cfg,
+		logger:      logger.Named("weaviate_adapter"),
+		connPool:    semaphore.NewWeighted(maxConnPoolSize),
+		healthCheck: make(chan struct{}, 1),
+		metrics:     newVectorDBMetrics("weaviate"),
+	}
+
+	if err := adapter.connectWithRetry(); err != nil {
+		return nil, fmt.Errorf("failed to initialize connection: %w", err)
+	}
+
+	go adapter.connectionMonitor()
+	return adapter, nil
+}
+
+func (w *WeaviateAdapter) connectWithRetry() error {
+	cfg := weaviate.Config{
+		Host:   w.config.Host,
+		Scheme: w.config.Scheme,
+	}
+	if w.config.APIKey != "" {
+		cfg.AuthConfig = auth.ApiKey{Value: w.config.APIKey}
+	}
+	if w.config.TLSConfig != nil {
+		cfg.ConnectionClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: w.config.TLSConfig},
+		}
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= maxRetryAttempts; attempt++ {
+		conn, err := weaviate.NewClient(cfg)
+		if err == nil {
+			if err = w.ping(conn); err == nil {
+				w.client = conn
+				w.metrics.ConnectionState.Set(1)
+				w.logger.Info("Successfully connected to Weaviate cluster")
+				return nil
+			}
+		}
+
+		lastErr = err
+		delay := baseRetryDelay * time.Duration(attempt)
+		w.logger.Warn("Connection attempt failed",
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+			zap.Duration("retry_delay", delay),
+		)
+		time.Sleep(delay)
+	}
+	return fmt.Errorf("exhausted connection attempts: %w", lastErr)
+}
+
+func (w *WeaviateAdapter) ping(conn *weaviate.Client) error {
+	timeout := w.config.ConnectionTimeout
+	if timeout == 0 {
+		timeout = queryTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ready, err := conn.Misc().ReadyChecker().Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return fmt.Errorf("weaviate node not ready")
+	}
+	return nil
+}
+
+func (w *WeaviateAdapter) connectionMonitor() {
+	ticker := time.NewTicker(healthCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.RLock()
+			err := w.ping(w.client)
+			w.mu.RUnlock()
+			if err != nil {
+				w.logger.Error("Connection health check failed", zap.Error(err))
+				w.metrics.ConnectionState.Set(0)
+				w.reconnect()
+			}
+		case <-w.healthCheck:
+			return
+		}
+	}
+}
+
+// reconnect rebuilds the client; Weaviate's client is stateless HTTP so
+// there is nothing to close
+func (w *WeaviateAdapter) reconnect() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.connectWithRetry(); err != nil {
+		w.logger.Error("Failed to re-establish connection", zap.Error(err))
+	}
+}
+
+func (w *WeaviateAdapter) acquire(ctx context.Context) (*weaviate.Client, func(), error) {
+	if err := w.connPool.Acquire(ctx, 1); err != nil {
+		return nil, nil, err
+	}
+	w.mu.RLock()
+	return w.client, func() {
+		w.mu.RUnlock()
+		w.connPool.Release(1)
+	}, nil
+}
+
+// className maps a collection name onto a valid Weaviate class name, which
+// must start with an upper-case letter
+func className(collection string) string {
+	if collection == "" {
+		return collection
+	}
+	r := []rune(collection)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// CreateCollection creates a multi-tenant class with externally supplied
+// vectors, a BM25-searchable content property and opaque JSON metadata.
+// dim is recorded in the class description since Weaviate infers it from
+// the first insert.
+func (w *WeaviateAdapter) CreateCollection(ctx context.Context, name string, dim int64) error {
+	client, release, err := w.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	searchable, notSearchable := true, false
+	class := &models.Class{
+		Class:           className(name),
+		Description:     fmt.Sprintf("Nuzon AI Agent Memory (dim=%d)", dim),
+		Vectorizer:      "none",
+		VectorIndexType: "hnsw",
+		VectorIndexConfig: map[string]interface{}{
+			"distance": w.config.Distance,
+		},
+		MultiTenancyConfig: &models.MultiTenancyConfig{Enabled: true},
+		Properties: []*models.Property{
+			{
+				Name:            contentProperty,
+				DataType:        []string{"text"},
+				IndexSearchable: &searchable,
+			},
+			{
+				Name:            metadataProperty,
+				DataType:        []string{"text"},
+				IndexSearchable: &notSearchable,
+			},
+			{
+				Name:            pointIDProperty,
+				DataType:        []string{"text"},
+				IndexSearchable: &notSearchable,
+			},
+		},
+	}
+	if err := client.Schema().ClassCreator().WithClass(class).Do(ctx); err != nil {
+		w.metrics.ErrorCount.Inc()
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+	return nil
+}
+
+// DropCollection deletes a class and all of its objects
+func (w *WeaviateAdapter) DropCollection(ctx context.Context, name string) error {
+	client, release, err := w.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := client.Schema().ClassDeleter().WithClassName(className(name)).Do(ctx); err != nil {
+		w.metrics.ErrorCount.Inc()
+		return fmt.Errorf("failed to drop collection: %w", err)
+	}
+	prefix := className(name) + "/"
+	w.tenants.Range(func(key, _ interface{}) bool {
+		if k, _ := key.(string); strings.HasPrefix(k, prefix) {
+			w.tenants.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
+
+// HasCollection reports whether the class exists
+func (w *WeaviateAdapter) HasCollection(ctx context.Context, name string) (bool, error) {
+	client, release, err := w.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	ok, err := client.Schema().ClassExistenceChecker().WithClassName(className(name)).Do(ctx)
+	if err != nil {
+		w.metrics.ErrorCount.Inc()
+		return false, fmt.Errorf("collection lookup failed: %w", err)
+	}
+	return ok, nil
+}
+
+// AddProperty adds a filterable top-level property to an existing class,
+// for metadata that callers want to filter on natively
+func (w *WeaviateAdapter) AddProperty(ctx context.Context, collection, property, dataType string) error {
+	client, release, err := w.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = client.Schema().PropertyCreator().
+		WithClassName(className(collection)).
+		WithProperty(&models.Property{Name: property, DataType: []string{dataType}}).
+		Do(ctx)
+	if err != nil {
+		w.metrics.ErrorCount.Inc()
+		return fmt.Errorf("failed to add property: %w", err)
+	}
+	return nil
+}
+
+// DeclareFilterFields registers schema for filter validation and creates
+// a top-level property for each field so Upsert can copy metadata into it.
+// Objects written before the declaration are not filterable until
+// rewritten.
+func (w *WeaviateAdapter) DeclareFilterFields(ctx context.Context, collection string, schema MetadataSchema) error {
+	client, release, err := w.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	class, err := client.Schema().ClassGetter().WithClassName(className(collection)).Do(ctx)
+	if err != nil {
+		w.metrics.ErrorCount.Inc()
+		return fmt.Errorf("failed to read class: %w", err)
+	}
+	existing := make(map[string]bool, len(class.Properties))
+	for _, p := range class.Properties {
+		existing[p.Name] = true
+	}
+
+	for field, typ := range schema {
+		if existing[filterProperty(field)] {
+			continue
+		}
+		prop := &models.Property{Name: filterProperty(field), DataType: []string{weaviateDataType(typ)}}
+		if typ == FieldString {
+			// match whole values, not words
+			prop.Tokenization = models.PropertyTokenizationField
+		}
+		err := client.Schema().PropertyCreator().
+			WithClassName(className(collection)).
+			WithProperty(prop).
+			Do(ctx)
+		if err != nil {
+			w.metrics.ErrorCount.Inc()
+			return fmt.Errorf("failed to add property for field %q: %w", field, err)
+		}
+	}
+	w.SetSchema(collection, schema)
+	return nil
+}
+
+func filterProperty(field string) string {
+	return filterPropertyPrefix + field
+}
+
+func weaviateDataType(t FieldType) string {
+	switch t {
+	case FieldInt:
+		return "int"
+	case FieldFloat:
+		return "number"
+	case FieldBool:
+		return "boolean"
+	default:
+		return "text"
+	}
+}
+
+// InsertVectors writes objects under random IDs; see Upsert
+func (w *WeaviateAdapter) InsertVectors(ctx context.Context, collection string, vectors [][]float32, metadatas []map[string]interface{}) error {
+	points, err := withRandomIDs(vectors, metadatas)
+	if err != nil {
+		return err
+	}
+	return w.Upsert(ctx, collection, points)
+}
+
+// tenantShard resolves the context tenant to its Weaviate tenant, creating
+// it when create is set. ok is false for a tenant that does not exist yet.
+func (w *WeaviateAdapter) tenantShard(ctx context.Context, client *weaviate.Client, collection string, create bool) (string, bool, error) {
+	class := className(collection)
+	tenant := tenantPartition(TenantFromContext(ctx))
+	key := class + "/" + tenant
+	if _, ok := w.tenants.Load(key); ok {
+		return tenant, true, nil
+	}
+
+	existing, err := client.Schema().TenantsGetter().WithClassName(class).Do(ctx)
+	if err != nil {
+		w.metrics.ErrorCount.Inc()
+		return tenant, false, fmt.Errorf("tenant lookup failed: %w", err)
+	}
+	for _, t := range existing {
+		if t.Name == tenant {
+			w.tenants.Store(key, struct{}{})
+			return tenant, true, nil
+		}
+	}
+	if !create {
+		return tenant, false, nil
+	}
+	err = client.Schema().TenantsCreator().
+		WithClassName(class).
+		WithTenants(models.Tenant{Name: tenant}).
+		Do(ctx)
+	if err != nil {
+		w.metrics.ErrorCount.Inc()
+		return tenant, false, fmt.Errorf("failed to create tenant %q: %w", tenant, err)
+	}
+	w.logger.Info("Created tenant", zap.String("class", class), zap.String("tenant", tenant))
+	w.tenants.Store(key, struct{}{})
+	return tenant, true, nil
+}
+
+// objectID derives a stable object UUID from a point ID, which makes batch
+// writes of an existing ID replace the object
+func objectID(id int64) strfmt.UUID {
+	return strfmt.UUID(uuid.NewSHA1(uuid.NameSpaceOID, []byte(strconv.FormatInt(id, 10))).String())
+}
+
+// Upsert writes objects into the context tenant in batches of
+// maxBulkInsertSize. A "content" metadata entry, when present, becomes the
+// BM25 text.
+func (w *WeaviateAdapter) Upsert(ctx context.Context, collection string, vectors []Vector) error {
+	if _, err := vectorDim(vectors); err != nil {
+		return err
+	}
+
+	client, release, err := w.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	tenant, _, err := w.tenantShard(ctx, client, collection, true)
+	release()
+	if err != nil {
+		return err
+	}
+	recordPartitionUsage("weaviate", collection, tenant, "upsert", len(vectors))
+
+	schema, _ := w.schema(collection)
+	objects := make([]*models.Object, len(vectors))
+	for i, v := range vectors {
+		meta, err := json.Marshal(v.Metadata)
+		if err != nil {
+			return fmt.Errorf("vector %d metadata: %w", v.ID, err)
+		}
+		content, _ := v.Metadata[contentProperty].(string)
+		props := map[string]interface{}{
+			contentProperty:  content,
+			metadataProperty: string(meta),
+			pointIDProperty:  strconv.FormatInt(v.ID, 10),
+		}
+		for field := range schema {
+			if value, ok := v.Metadata[field]; ok {
+				props[filterProperty(field)] = value
+			}
+		}
+		objects[i] = &models.Object{
+			Class:      className(collection),
+			ID:         objectID(v.ID),
+			Vector:     v.Values,
+			Properties: props,
+			Tenant:     tenant,
+		}
+	}
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, (len(objects)+maxBulkInsertSize-1)/maxBulkInsertSize)
+	for start := 0; start < len(objects); start += maxBulkInsertSize {
+		end := start + maxBulkInsertSize
+		if end > len(objects) {
+			end = len(objects)
+		}
+
+		wg.Add(1)
+		go func(batchIndex int, batch []*models.Object) {
+			defer wg.Done()
+
+			client, release, err := w.acquire(ctx)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			defer release()
+
+			begin := time.Now()
+			resp, err := client.Batch().ObjectsBatcher().WithObjects(batch...).Do(ctx)
+			w.metrics.InsertDuration.Observe(time.Since(begin).Seconds())
+			if err == nil {
+				err = batchError(resp)
+			}
+			if err != nil {
+				w.metrics.ErrorCount.Inc()
+				errChan <- fmt.Errorf("batch %d insert failed: %w", batchIndex, err)
+			}
+		}(start/maxBulkInsertSize, objects[start:end])
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	for err := range errChan {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes objects by point ID from the context tenant
+func (w *WeaviateAdapter) Delete(ctx context.Context, collection string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	client, release, err := w.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tenant, ok, err := w.tenantShard(ctx, client, collection, false)
+	if err != nil || !ok {
+		return err
+	}
+	recordPartitionUsage("weaviate", collection, tenant, "delete", len(ids))
+
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = strconv.FormatInt(id, 10)
+	}
+	_, err = client.Batch().ObjectsBatchDeleter().
+		WithClassName(className(collection)).
+		WithTenant(tenant).
+		WithWhere(filters.Where().
+			WithPath([]string{pointIDProperty}).
+			WithOperator(filters.ContainsAny).
+			WithValueText(values...)).
+		Do(ctx)
+	if err != nil {
+		w.metrics.ErrorCount.Inc()
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	return nil
+}
+
+// Search is SearchVectors under the Store interface
+func (w *WeaviateAdapter) Search(ctx context.Context, collection string, query []float32, k int, filter *Filter) ([]SearchResult, error) {
+	return w.SearchVectors(ctx, collection, query, k, filter)
+}
+
+// Stats counts the context tenant's objects; the dimension comes from the
+// class description written by CreateCollection
+func (w *WeaviateAdapter) Stats(ctx context.Context, collection string) (CollectionStats, error) {
+	client, release, err := w.acquire(ctx)
+	if err != nil {
+		return CollectionStats{}, err
+	}
+	defer release()
+
+	class := className(collection)
+	stats := CollectionStats{Name: collection}
+	tenant, ok, err := w.tenantShard(ctx, client, collection, false)
+	if err != nil {
+		return stats, err
+	}
+	if ok {
+		resp, err := client.GraphQL().Aggregate().
+			WithClassName(class).
+			WithTenant(tenant).
+			WithFields(graphql.Field{Name: "meta", Fields: []graphql.Field{{Name: "count"}}}).
+			Do(ctx)
+		if err == nil && len(resp.Errors) > 0 {
+			err = fmt.Errorf("%s", resp.Errors[0].Message)
+		}
+		if err != nil {
+			w.metrics.ErrorCount.Inc()
+			return stats, fmt.Errorf("aggregate query failed: %w", err)
+		}
+		agg, _ := resp.Data["Aggregate"].(map[string]interface{})
+		if groups, _ := agg[class].([]interface{}); len(groups) > 0 {
+			group, _ := groups[0].(map[string]interface{})
+			meta, _ := group["meta"].(map[string]interface{})
+			if count, ok := meta["count"].(float64); ok {
+				stats.RowCount = int64(count)
+			}
+		}
+	}
+
+	schema, err := client.Schema().ClassGetter().WithClassName(class).Do(ctx)
+	if err != nil {
+		w.metrics.ErrorCount.Inc()
+		return stats, fmt.Errorf("class lookup failed: %w", err)
+	}
+	fmt.Sscanf(schema.Description, "Nuzon AI Agent Memory (dim=%d)", &stats.Dimension)
+	return stats, nil
+}
+
+// batchError collects per-object failures, which Weaviate reports in the
+// response body rather than as a request error
+func batchError(resp []models.ObjectsGetResponse) error {
+	var msgs []string
+	for _, r := range resp {
+		if r.Result == nil || r.Result.Errors == nil {
+			continue
+		}
+		for _, e := range r.Result.Errors.Error {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d objects rejected: %s", len(msgs), strings.Join(msgs, "; "))
+}
+
+// SearchVectors runs a pure nearest-neighbour query. A non-nil filter
+// requires the collection's fields to have been declared with
+// DeclareFilterFields.
+func (w *WeaviateAdapter) SearchVectors(ctx context.Context, collection string, query []float32, k int, filter *Filter) ([]SearchResult, error) {
+	var where *filters.WhereBuilder
+	if filter != nil {
+		schema, ok := w.schema(collection)
+		if !ok {
+			return nil, fmt.Errorf("%w: no filter fields declared for %q", ErrInvalidFilter, collection)
+		}
+		if err := filter.Validate(schema); err != nil {
+			return nil, err
+		}
+		where = weaviateWhere(filter.root, schema)
+	}
+
+	client, release, err := w.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	nearVector := client.GraphQL().NearVectorArgBuilder().WithVector(query)
+	return w.get(ctx, client, collection, k, func(b *graphql.GetBuilder) *graphql.GetBuilder {
+		b = b.WithNearVector(nearVector)
+		if where != nil {
+			b = b.WithWhere(where)
+		}
+		return b
+	})
+}
+
+var weaviateOps = map[CompareOp]filters.WhereOperator{
+	OpEq: filters.Equal,
+	OpNe: filters.NotEqual,
+	OpLt: filters.LessThan,
+	OpLe: filters.LessThanEqual,
+	OpGt: filters.GreaterThan,
+	OpGe: filters.GreaterThanEqual,
+}
+
+// weaviateWhere translates a validated filter over the meta_ properties;
+// schema decides whether integer literals are sent as int or number
+func weaviateWhere(n filterNode, schema MetadataSchema) *filters.WhereBuilder {
+	switch n := n.(type) {
+	case andNode:
+		return filters.Where().WithOperator(filters.And).WithOperands(weaviateOperands(n.children, schema))
+	case orNode:
+		return filters.Where().WithOperator(filters.Or).WithOperands(weaviateOperands(n.children, schema))
+	case compareNode:
+		return weaviateValue(filters.Where().
+			WithPath([]string{filterProperty(n.field)}).
+			WithOperator(weaviateOps[n.op]), schema[n.field], n.value)
+	case inNode:
+		if n.negate {
+			// no ContainsNone on older servers: AND the inequalities
+			operands := make([]*filters.WhereBuilder, len(n.values))
+			for i, v := range n.values {
+				operands[i] = weaviateValue(filters.Where().
+					WithPath([]string{filterProperty(n.field)}).
+					WithOperator(filters.NotEqual), schema[n.field], v)
+			}
+			return filters.Where().WithOperator(filters.And).WithOperands(operands)
+		}
+		b := filters.Where().
+			WithPath([]string{filterProperty(n.field)}).
+			WithOperator(filters.ContainsAny)
+		switch schema[n.field] {
+		case FieldString:
+			values := make([]string, len(n.values))
+			for i, v := range n.values {
+				values[i], _ = v.(string)
+			}
+			return b.WithValueText(values...)
+		case FieldInt:
+			values := make([]int64, len(n.values))
+			for i, v := range n.values {
+				values[i], _ = v.(int64)
+			}
+			return b.WithValueInt(values...)
+		case FieldFloat:
+			values := make([]float64, len(n.values))
+			for i, v := range n.values {
+				values[i] = toFloat(v)
+			}
+			return b.WithValueNumber(values...)
+		default:
+			values := make([]bool, len(n.values))
+			for i, v := range n.values {
+				values[i], _ = v.(bool)
+			}
+			return b.WithValueBoolean(values...)
+		}
+	}
+	return nil
+}
+
+func weaviateOperands(nodes []filterNode, schema MetadataSchema) []*filters.WhereBuilder {
+	out := make([]*filters.WhereBuilder, len(nodes))
+	for i, n := range nodes {
+		out[i] = weaviateWhere(n, schema)
+	}
+	return out
+}
+
+func weaviateValue(b *filters.WhereBuilder, typ FieldType, v interface{}) *filters.WhereBuilder {
+	switch typ {
+	case FieldString:
+		s, _ := v.(string)
+		return b.WithValueText(s)
+	case FieldInt:
+		i, _ := v.(int64)
+		return b.WithValueInt(i)
+	case FieldFloat:
+		return b.WithValueNumber(toFloat(v))
+	default:
+		flag, _ := v.(bool)
+		return b.WithValueBoolean(flag)
+	}
+}
+
+// HybridSearch fuses BM25 ranking of text over the content property with
+// vector similarity to query. A negative alpha uses the configured
+// default; 1 is pure vector and 0 pure keyword.
+func (w *WeaviateAdapter) HybridSearch(ctx context.Context, collection, text string, query []float32, k int, alpha float32) ([]SearchResult, error) {
+	client, release, err := w.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if alpha < 0 {
+		alpha = w.config.HybridAlpha
+	}
+	hybrid := client.GraphQL().HybridArgumentBuilder().
+		WithQuery(text).
+		WithVector(query).
+		WithAlpha(alpha).
+		WithProperties([]string{contentProperty})
+	return w.get(ctx, client, collection, k, func(b *graphql.GetBuilder) *graphql.GetBuilder {
+		return b.WithHybrid(hybrid)
+	})
+}
+
+func (w *WeaviateAdapter) get(ctx context.Context, client *weaviate.Client, collection string, k int, search func(*graphql.GetBuilder) *graphql.GetBuilder) ([]SearchResult, error) {
+	tenant, ok, err := w.tenantShard(ctx, client, collection, false)
+	if err != nil || !ok {
+		return nil, err
+	}
+	recordPartitionUsage("weaviate", collection, tenant, "search", 1)
+
+	start := time.Now()
+	defer func() {
+		w.metrics.QueryDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	class := className(collection)
+	builder := client.GraphQL().Get().
+		WithClassName(class).
+		WithTenant(tenant).
+		WithFields(
+			graphql.Field{Name: metadataProperty},
+			graphql.Field{Name: pointIDProperty},
+			graphql.Field{Name: "_additional", Fields: []graphql.Field{
+				{Name: "score"},
+				{Name: "distance"},
+			}},
+		).
+		WithLimit(k)
+
+	resp, err := search(builder).Do(ctx)
+	if err == nil && len(resp.Errors) > 0 {
+		err = fmt.Errorf("%s", resp.Errors[0].Message)
+	}
+	if err != nil {
+		w.metrics.ErrorCount.Inc()
+		return nil, fmt.Errorf("search operation failed: %w", err)
+	}
+
+	get, _ := resp.Data["Get"].(map[string]interface{})
+	hits, _ := get[class].([]interface{})
+	results := make([]SearchResult, 0, len(hits))
+	for _, h := range hits {
+		hit, _ := h.(map[string]interface{})
+		result := SearchResult{Metadata: map[string]interface{}{}}
+		if raw, ok := hit[metadataProperty].(string); ok {
+			_ = json.Unmarshal([]byte(raw), &result.Metadata)
+		}
+		if raw, ok := hit[pointIDProperty].(string); ok {
+			result.ID, _ = strconv.ParseInt(raw, 10, 64)
+		}
+		result.Score = additionalScore(hit["_additional"])
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// additionalScore normalizes hybrid scores and vector distances so higher is
+// always better
+func additionalScore(v interface{}) float32 {
+	add, _ := v.(map[string]interface{})
+	if s, ok := add["score"].(string); ok && s != "" {
+		f, _ := strconv.ParseFloat(s, 32)
+		return float32(f)
+	}
+	if d, ok := add["distance"].(float64); ok {
+		return float32(1 - d)
+	}
+	return 0
+}
+
+func (w *WeaviateAdapter) Close() error {
+	close(w.healthCheck)
+	return nil
+}
@@ -0,0 +1,108 @@
+// attestations.go - Compliance Evidence Storage and Download
+package auditor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrAttestationNotFound = errors.New("attestation not found")
+
+func (a *EnterpriseAuditor) initializeAttestations() error {
+	_, err := a.db.Exec(`CREATE TABLE IF NOT EXISTS rotation_attestations (
+		id TEXT PRIMARY KEY,
+		created_at DATETIME,
+		json_body BLOB,
+		cbor_body BLOB,
+		hmac_signature BLOB
+	) STRICT`)
+	return err
+}
+
+// StoreAttestation persists a signed proof-of-rotation and logs its creation
+func (a *EnterpriseAuditor) StoreAttestation(ctx context.Context, id string, jsonBody, cborBody []byte) error {
+	m := a.computeHMAC(jsonBody)
+	if _, err := a.db.ExecContext(ctx,
+		`INSERT INTO rotation_attestations (id, created_at, json_body, cbor_body, hmac_signature)
+		 VALUES (?, ?, ?, ?, ?)`,
+		id, time.Now().UTC(), jsonBody, cborBody, m); err != nil {
+		return fmt.Errorf("attestation insert failed: %w", err)
+	}
+
+	return a.LogEvent(ctx, &EnterpriseAuditEvent{
+		Timestamp:  time.Now().UTC(),
+		UserID:     "system:key-rotation",
+		ActionType: "KEY_ROTATION_ATTESTED",
+		ResourceID: id,
+		Result:     "SUCCESS",
+		Severity:   3,
+	})
+}
+
+// Attestation returns the stored JSON or CBOR rendering of an attestation
+func (a *EnterpriseAuditor) Attestation(ctx context.Context, id, format string) ([]byte, error) {
+	var jsonBody, cborBody, mac []byte
+	err := a.db.QueryRowContext(ctx,
+		`SELECT json_body, cbor_body, hmac_signature FROM rotation_attestations WHERE id = ?`, id).
+		Scan(&jsonBody, &cborBody, &mac)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAttestationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !a.verifyHMAC(jsonBody, mac) {
+		return nil, errors.New("attestation integrity check failed")
+	}
+	if format == "cbor" {
+		return cborBody, nil
+	}
+	return jsonBody, nil
+}
+
+func (a *EnterpriseAuditor) computeHMAC(data []byte) []byte {
+	m := hmac.New(sha256.New, a.macKey[:])
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// AttestationHandler serves GET /admin/attestations/{id}[?format=cbor]
+func (a *EnterpriseAuditor) AttestationHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/admin/attestations/")
+		if id == "" || strings.Contains(id, "/") {
+			http.Error(w, "attestation id required", http.StatusBadRequest)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		body, err := a.Attestation(r.Context(), id, format)
+		if errors.Is(err, ErrAttestationNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		contentType, ext := "application/json", "json"
+		if format == "cbor" {
+			contentType, ext = "application/cbor", "cbor"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, id, ext))
+		w.Write(body)
+	}
+}
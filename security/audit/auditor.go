@@ -3,7 +3,10 @@ package auditor
 
 import ( 
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
@@ -15,6 +18,7 @@ import (
 	"sync"
 	"time"
 
+	qcrypto "cirium.ai/core/crypto"
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
 	"golang.org/x/crypto/chacha20poly1305"
 )
@@ -29,6 +33,9 @@ type EnterpriseAuditEvent struct {
 	ClientIP   string    `json:"client_ip"`
 	DeviceID   string    `json:"device_id"`
 	Severity   int       `json:"severity"`
+	// SubjectID is the data subject the event concerns, so the entry can
+	// be erased with the subject's data; see EraseSubject
+	SubjectID string `json:"subject_id,omitempty"`
 }
 
 // EnterpriseAuditor core system structure
@@ -39,6 +46,7 @@ type EnterpriseAuditor struct {
 	wg           sync.WaitGroup
 	config       AuditConfig
 	cryptoKey    [32]byte
+	macKey       [32]byte
 	mu           sync.RWMutex
 }
 
@@ -50,6 +58,16 @@ type AuditConfig struct {
 	RetentionDays     int
 	EncryptionKey     string
 	CompliancePolicy string
+
+	// WrappedKey, when set, is unwrapped through KeyProvider instead of
+	// deriving the key from EncryptionKey
+	WrappedKey  []byte
+	KeyProvider DataKeyProvider
+}
+
+// DataKeyProvider resolves a KMS-wrapped data key into plaintext
+type DataKeyProvider interface {
+	DataKey(ctx context.Context, wrapped []byte) ([32]byte, error)
 }
 
 // NewEnterpriseAuditor initializes production-grade audit system
@@ -70,7 +88,17 @@ func NewEnterpriseAuditor(cfg AuditConfig) (*EnterpriseAuditor, error) {
 		config:       cfg,
 	}
 
-	if err := a.deriveCryptoKey(); err != nil {
+	if cfg.KeyProvider != nil && len(cfg.WrappedKey) > 0 {
+		key, err := cfg.KeyProvider.DataKey(context.Background(), cfg.WrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("crypto setup failed: %w", err)
+		}
+		a.cryptoKey = key
+	} else if err := a.deriveCryptoKey(); err != nil {
+		return nil, fmt.Errorf("crypto setup failed: %w", err)
+	}
+	// Signatures get their own key rather than reusing the AEAD key
+	if a.macKey, err = qcrypto.DeriveKey(a.cryptoKey[:], qcrypto.PurposeAuditMAC); err != nil {
 		return nil, fmt.Errorf("crypto setup failed: %w", err)
 	}
 
@@ -78,6 +106,10 @@ func NewEnterpriseAuditor(cfg AuditConfig) (*EnterpriseAuditor, error) {
 		return nil, fmt.Errorf("database schema error: %w", err)
 	}
 
+	if err := a.initializeAttestations(); err != nil {
+		return nil, fmt.Errorf("database schema error: %w", err)
+	}
+
 	a.startWorkers()
 
 	return a, nil
@@ -95,10 +127,65 @@ func (a *EnterpriseAuditor) LogEvent(ctx context.Context, event *EnterpriseAudit
 	}
 }
 
+// RecordUnwrap logs a KMS data key unwrap so key usage is auditable
+func (a *EnterpriseAuditor) RecordUnwrap(ctx context.Context, provider, keyID, purpose string, err error) {
+	result := "SUCCESS"
+	severity := 2
+	if err != nil {
+		result = "FAILURE: " + err.Error()
+		severity = 4
+	}
+
+	event := &EnterpriseAuditEvent{
+		Timestamp:  time.Now().UTC(),
+		UserID:     "system:" + purpose,
+		ActionType: "KMS_UNWRAP",
+		ResourceID: provider + "/" + keyID,
+		Result:     result,
+		Severity:   severity,
+	}
+	if logErr := a.LogEvent(ctx, event); logErr != nil {
+		slog.Error("Unwrap audit dropped", "error", logErr, "key", keyID)
+	}
+}
+
+// RecordToolCall logs a sandboxed tool invocation on behalf of an agent
+func (a *EnterpriseAuditor) RecordToolCall(ctx context.Context, tenantID, agentID, tool string, version int, err error) {
+	result := "SUCCESS"
+	severity := 1
+	if err != nil {
+		result = "FAILURE: " + err.Error()
+		severity = 3
+	}
+
+	event := &EnterpriseAuditEvent{
+		Timestamp:  time.Now().UTC(),
+		UserID:     "agent:" + tenantID + "/" + agentID,
+		ActionType: "TOOL_INVOKE",
+		ResourceID: fmt.Sprintf("%s@%d", tool, version),
+		Result:     result,
+		Severity:   severity,
+	}
+	if logErr := a.LogEvent(ctx, event); logErr != nil {
+		slog.Error("Tool call audit dropped", "error", logErr, "tool", tool)
+	}
+}
+
 // Security Features Implementation
 
+// deriveCryptoKey derives the audit key from the root so it is
+// domain-separated from memory and config-secret keys derived from the same root
+func (a *EnterpriseAuditor) deriveCryptoKey() error {
+	key, err := qcrypto.DeriveKey([]byte(a.config.EncryptionKey), qcrypto.PurposeAudit)
+	if err != nil {
+		return fmt.Errorf("audit key derivation failed: %w", err)
+	}
+	a.cryptoKey = key
+	return nil
+}
+
 func (a *EnterpriseAuditor) encryptData(data []byte) ([]byte, error) {
-	aead, err := chacha20poly1305.NewX(a.cryptoKey[:])
+	aead, err := a.newAEAD()
 	if err != nil {
 		return nil, err
 	}
@@ -111,8 +198,20 @@ func (a *EnterpriseAuditor) encryptData(data []byte) ([]byte, error) {
 	return aead.Seal(nonce, nonce, data, nil), nil
 }
 
+// newAEAD is AES-256-GCM in FIPS mode and XChaCha20-Poly1305 otherwise
+func (a *EnterpriseAuditor) newAEAD() (cipher.AEAD, error) {
+	if qcrypto.FIPSEnabled() {
+		block, err := aes.NewCipher(a.cryptoKey[:])
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	}
+	return chacha20poly1305.NewX(a.cryptoKey[:])
+}
+
 func (a *EnterpriseAuditor) verifyHMAC(data, mac []byte) bool {
-	m := hmac.New(sha256.New, a.cryptoKey[:])
+	m := hmac.New(sha256.New, a.macKey[:])
 	m.Write(data)
 	expected := m.Sum(nil)
 	return hmac.Equal(mac, expected)
@@ -126,8 +225,29 @@ func (a *EnterpriseAuditor) initializeDatabase() error {
 		timestamp DATETIME,
 		encrypted_data BLOB,
 		hmac_signature BLOB,
-		compliance_check BOOLEAN
+		compliance_check BOOLEAN,
+		subject_mac BLOB
 	) STRICT`)
+	if err != nil {
+		return err
+	}
+	_, err = a.db.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_subject ON audit_logs (subject_mac)`)
+	return err
+}
+
+func (a *EnterpriseAuditor) persistEvent(event *EnterpriseAuditEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("event encoding failed: %w", err)
+	}
+	sealed, err := a.encryptData(payload)
+	if err != nil {
+		return fmt.Errorf("event encryption failed: %w", err)
+	}
+	_, err = a.db.Exec(
+		`INSERT INTO audit_logs (timestamp, encrypted_data, hmac_signature, compliance_check, subject_mac)
+		 VALUES (?, ?, ?, ?, ?)`,
+		event.Timestamp, sealed, a.computeHMAC(sealed), a.checkCompliance(event), a.subjectMAC(event.SubjectID))
 	return err
 }
 